@@ -0,0 +1,335 @@
+// Package backup 导出和恢复全部数据：以一致性快照读取各表，gzip压缩后分块加密写入单个文件
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	formatVersion = 1
+	// restoreBatchSize 恢复时每次插入的行数
+	restoreBatchSize = 500
+	// timeLayout 时间列的导出格式，MySQL可直接写入
+	timeLayout = "2006-01-02 15:04:05.999999"
+)
+
+var (
+	ErrNoKey         = errors.New("backup encryption key is not configured")
+	ErrInvalidBackup = errors.New("invalid backup file or wrong encryption key")
+	ErrNotEmpty      = errors.New("table is not empty")
+)
+
+// referenceColumns 保存外部对象（如头像、冷存储中的消息内容）地址的列，备份只包含地址，对象本身需另行同步
+var referenceColumns = map[string][]string{
+	"users":            {"avatar"},
+	"message_archives": {"object_key"},
+}
+
+// releasedColumns 不为空时表示该行引用的对象已删除（如已恢复的冷存储批次），不再列为引用
+var releasedColumns = map[string]string{
+	"message_archives": "rehydrated_at",
+}
+
+// Manifest 备份的摘要，写在文件末尾，恢复时用于校验行数
+type Manifest struct {
+	Version   int              `json:"version"`
+	CreatedAt time.Time        `json:"created_at"`
+	Tables    map[string]int64 `json:"tables"`
+	// References 数据中引用的外部对象地址
+	References []string `json:"references,omitempty"`
+}
+
+// record 备份文件中的一条记录：某个表的一行，或最后的摘要
+type record struct {
+	Table string                 `json:"table,omitempty"`
+	Row   map[string]interface{} `json:"row,omitempty"`
+	// Binary Row中以base64编码的二进制列（如压缩的消息内容），JSON字符串不能保存任意字节
+	Binary   []string  `json:"binary,omitempty"`
+	Manifest *Manifest `json:"manifest,omitempty"`
+}
+
+// Backup 在同一个只读的可重复读事务中导出tables的全部行，各表数据属于同一时刻的快照
+func Backup(ctx context.Context, db *gorm.DB, tables []string, w io.Writer, key string) (*Manifest, error) {
+	enc, err := newEncryptWriter(w, key)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(enc)
+	encoder := json.NewEncoder(gz)
+
+	manifest := &Manifest{Version: formatVersion, CreatedAt: time.Now().UTC(), Tables: make(map[string]int64)}
+	references := make(map[string]bool)
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			count, err := exportTable(tx, table, encoder, references)
+			if err != nil {
+				return fmt.Errorf("export %s: %w", table, err)
+			}
+			manifest.Tables[table] = count
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	for ref := range references {
+		manifest.References = append(manifest.References, ref)
+	}
+	sort.Strings(manifest.References)
+	if err := encoder.Encode(record{Manifest: manifest}); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func exportTable(tx *gorm.DB, table string, encoder *json.Encoder, references map[string]bool) (int64, error) {
+	rows, err := tx.Table(table).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	binary := make(map[string]bool)
+	for _, columnType := range columnTypes {
+		if binaryColumnType(columnType.DatabaseTypeName()) {
+			binary[columnType.Name()] = true
+		}
+	}
+
+	var count int64
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := tx.ScanRows(rows, &row); err != nil {
+			return count, err
+		}
+		for _, ref := range rowReferences(table, row) {
+			references[ref] = true
+		}
+		rec := exportRow(table, row, binary)
+		if err := encoder.Encode(rec); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// rowReferences 一行中引用的外部对象地址
+func rowReferences(table string, row map[string]interface{}) []string {
+	if column, ok := releasedColumns[table]; ok && row[column] != nil {
+		return nil
+	}
+	var refs []string
+	for _, column := range referenceColumns[table] {
+		switch ref := row[column].(type) {
+		case string:
+			if ref != "" {
+				refs = append(refs, ref)
+			}
+		case []byte:
+			if len(ref) > 0 {
+				refs = append(refs, string(ref))
+			}
+		}
+	}
+	return refs
+}
+
+// binaryColumnType 列类型是否保存任意字节，文本列的值同样可能以[]byte读出，按列类型区分
+func binaryColumnType(name string) bool {
+	name = strings.ToUpper(name)
+	return strings.HasSuffix(name, "BLOB") || strings.HasSuffix(name, "BINARY")
+}
+
+// exportRow 转换一行数据用于JSON导出：时间列格式化，二进制列以base64编码并记录在Binary中
+func exportRow(table string, row map[string]interface{}, binary map[string]bool) record {
+	rec := record{Table: table, Row: row}
+	for column, value := range row {
+		switch v := value.(type) {
+		case time.Time:
+			row[column] = v.UTC().Format(timeLayout)
+		case []byte:
+			if binary[column] {
+				row[column] = base64.StdEncoding.EncodeToString(v)
+				rec.Binary = append(rec.Binary, column)
+			} else {
+				row[column] = string(v)
+			}
+		}
+	}
+	sort.Strings(rec.Binary)
+	return rec
+}
+
+// restoreRow 还原导出时以base64编码的二进制列
+func restoreRow(rec *record) error {
+	for _, column := range rec.Binary {
+		value, ok := rec.Row[column].(string)
+		if !ok {
+			return fmt.Errorf("%w: binary column %s.%s is not a string", ErrInvalidBackup, rec.Table, column)
+		}
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("%w: binary column %s.%s: %v", ErrInvalidBackup, rec.Table, column, err)
+		}
+		rec.Row[column] = data
+	}
+	return nil
+}
+
+// Restore 在一个事务中导入备份，任何一步失败时全部回滚，备份中只能包含tables中的表。
+// 备份中的表在目标库中不为空时返回ErrNotEmpty，replace为true时先清空这些表
+func Restore(ctx context.Context, db *gorm.DB, tables []string, r io.Reader, key string, replace bool) (*Manifest, error) {
+	dec, err := newDecryptReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return nil, backupError(err)
+	}
+	decoder := json.NewDecoder(gz)
+	// 保留整数精度
+	decoder.UseNumber()
+
+	known := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		known[table] = true
+	}
+
+	var manifest *Manifest
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 按表依次导入，期间不检查外键
+		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return err
+		}
+		defer tx.Exec("SET FOREIGN_KEY_CHECKS = 1")
+
+		counts := make(map[string]int64)
+		var table string
+		var batch []map[string]interface{}
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := tx.Table(table).Create(&batch).Error; err != nil {
+				return fmt.Errorf("import %s: %w", table, err)
+			}
+			counts[table] += int64(len(batch))
+			batch = batch[:0]
+			return nil
+		}
+
+		for {
+			var rec record
+			if err := decoder.Decode(&rec); err != nil {
+				if errors.Is(err, io.EOF) {
+					// 没有摘要，文件不完整
+					return ErrInvalidBackup
+				}
+				return backupError(err)
+			}
+			if rec.Manifest != nil {
+				manifest = rec.Manifest
+				break
+			}
+			if rec.Table != table {
+				if err := flush(); err != nil {
+					return err
+				}
+				if !known[rec.Table] {
+					return fmt.Errorf("%w: unknown table %q", ErrInvalidBackup, rec.Table)
+				}
+				if _, seen := counts[rec.Table]; seen {
+					return fmt.Errorf("%w: rows of table %s are not contiguous", ErrInvalidBackup, rec.Table)
+				}
+				table = rec.Table
+				counts[table] = 0
+				if err := prepareTable(tx, table, replace); err != nil {
+					return err
+				}
+			}
+			if err := restoreRow(&rec); err != nil {
+				return err
+			}
+			batch = append(batch, rec.Row)
+			if len(batch) >= restoreBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		if manifest.Version != formatVersion {
+			return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, manifest.Version)
+		}
+		for name, expected := range manifest.Tables {
+			// 备份时为空的表同样按replace清空或检查
+			if _, seen := counts[name]; !seen && known[name] {
+				if err := prepareTable(tx, name, replace); err != nil {
+					return err
+				}
+			}
+			if counts[name] != expected {
+				return fmt.Errorf("%w: table %s has %d rows, expected %d", ErrInvalidBackup, name, counts[name], expected)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// prepareTable 检查表存在，replace时清空，否则要求表为空
+func prepareTable(tx *gorm.DB, table string, replace bool) error {
+	if !tx.Migrator().HasTable(table) {
+		return fmt.Errorf("table %s does not exist, run migrations first", table)
+	}
+	if replace {
+		return tx.Exec(fmt.Sprintf("DELETE FROM `%s`", table)).Error
+	}
+	var count int64
+	if err := tx.Table(table).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrNotEmpty, table)
+	}
+	return nil
+}
+
+// backupError 解压或解析失败说明文件内容无效
+func backupError(err error) error {
+	if errors.Is(err, ErrInvalidBackup) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+}
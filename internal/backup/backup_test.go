@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 二进制列经JSON导出后还原为原始字节，无效的UTF-8不能变成替换字符
+func TestExportRowBinaryRoundTrip(t *testing.T) {
+	compressed := []byte{0x28, 0xb5, 0x2f, 0xfd, 0xff, 0xfe, 0x00, 0x80}
+	row := map[string]interface{}{
+		"id":                 int64(7),
+		"content":            []byte("plain text"),
+		"compressed_content": compressed,
+		"avatar":             nil,
+		"created_at":         time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	rec := exportRow("messages", row, map[string]bool{"compressed_content": true, "avatar": true})
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var restored record
+	if err := decoder.Decode(&restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreRow(&restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := restored.Row["compressed_content"].([]byte); !ok || !bytes.Equal(got, compressed) {
+		t.Fatalf("compressed_content = %#v, want %#v", restored.Row["compressed_content"], compressed)
+	}
+	if got := restored.Row["content"]; got != "plain text" {
+		t.Fatalf("content = %#v", got)
+	}
+	if got := restored.Row["avatar"]; got != nil {
+		t.Fatalf("avatar = %#v, want nil", got)
+	}
+	if got := restored.Row["created_at"]; got != "2026-01-02 03:04:05" {
+		t.Fatalf("created_at = %#v", got)
+	}
+}
+
+func TestRestoreRowInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"not base64", "%%%"},
+		{"not a string", json.Number("1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := record{Table: "messages", Row: map[string]interface{}{"compressed_content": tt.value}, Binary: []string{"compressed_content"}}
+			if err := restoreRow(&rec); !errors.Is(err, ErrInvalidBackup) {
+				t.Fatalf("err = %v, want ErrInvalidBackup", err)
+			}
+		})
+	}
+}
+
+func TestBinaryColumnType(t *testing.T) {
+	for name, want := range map[string]bool{
+		"MEDIUMBLOB": true,
+		"BLOB":       true,
+		"VARBINARY":  true,
+		"TEXT":       false,
+		"MEDIUMTEXT": false,
+		"VARCHAR":    false,
+	} {
+		if got := binaryColumnType(name); got != want {
+			t.Errorf("binaryColumnType(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRowReferences(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		row   map[string]interface{}
+		want  []string
+	}{
+		{"avatar", "users", map[string]interface{}{"avatar": "avatars/1.png"}, []string{"avatars/1.png"}},
+		{"avatar read as bytes", "users", map[string]interface{}{"avatar": []byte("avatars/2.png")}, []string{"avatars/2.png"}},
+		{"no avatar", "users", map[string]interface{}{"avatar": ""}, nil},
+		{"cold storage archive", "message_archives", map[string]interface{}{"object_key": "messages/1/a.jsonl.gz", "rehydrated_at": nil}, []string{"messages/1/a.jsonl.gz"}},
+		{"rehydrated archive", "message_archives", map[string]interface{}{"object_key": "messages/1/b.jsonl.gz", "rehydrated_at": time.Now()}, nil},
+		{"other table", "messages", map[string]interface{}{"content": "hello"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rowReferences(tt.table, tt.row); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rowReferences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
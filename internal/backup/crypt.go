@@ -0,0 +1,174 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// fileMagic 备份文件头，区分格式版本
+	fileMagic = "AICHATBK1\n"
+	// chunkSize 每个加密块的明文长度
+	chunkSize = 64 << 10
+)
+
+// newAEAD 与utils.SecretBox相同，由任意长度的密钥字符串派生AES-256密钥
+func newAEAD(key string) (cipher.AEAD, error) {
+	if key == "" {
+		return nil, ErrNoKey
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkAD 块的附加认证数据：序号和是否为最后一块，块被重排、删除或文件被截断时解密失败
+func chunkAD(index uint64, final bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, index)
+	if final {
+		ad[8] = 1
+	}
+	return ad
+}
+
+// encryptWriter 将明文按块以AES-GCM加密写入w，每块格式为 4字节长度 + nonce + 密文。
+// 必须调用Close写入最后一块
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+func newEncryptWriter(w io.Writer, key string) (*encryptWriter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, fileMagic); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		take := chunkSize - len(e.buf)
+		if take > len(p) {
+			take = len(p)
+		}
+		e.buf = append(e.buf, p[:take]...)
+		p = p[take:]
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close 写入最后一块（可以为空），不关闭底层的w
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := e.aead.Seal(nonce, nonce, e.buf, chunkAD(e.index, final))
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := e.w.Write(length[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// decryptReader 读取encryptWriter的输出，密钥错误、内容被篡改或截断时返回ErrInvalidBackup
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+	final bool
+}
+
+func newDecryptReader(r io.Reader, key string) (*decryptReader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != fileMagic {
+		return nil, ErrInvalidBackup
+	}
+	return &decryptReader{r: br, aead: aead}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.final {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	var length [4]byte
+	if _, err := io.ReadFull(d.r, length[:]); err != nil {
+		// 没有读到最后一块即结束，文件被截断
+		return ErrInvalidBackup
+	}
+	size := int(binary.BigEndian.Uint32(length[:]))
+	if size < d.aead.NonceSize()+d.aead.Overhead() || size > chunkSize+d.aead.NonceSize()+d.aead.Overhead() {
+		return ErrInvalidBackup
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return ErrInvalidBackup
+	}
+	nonce, ciphertext := sealed[:d.aead.NonceSize()], sealed[d.aead.NonceSize():]
+
+	// 先按普通块解密，失败再按最后一块解密
+	plaintext, err := d.aead.Open(nil, nonce, ciphertext, chunkAD(d.index, false))
+	if err != nil {
+		plaintext, err = d.aead.Open(nil, nonce, ciphertext, chunkAD(d.index, true))
+		if err != nil {
+			return ErrInvalidBackup
+		}
+		d.final = true
+		// 最后一块之后不应再有数据
+		if _, err := d.r.ReadByte(); !errors.Is(err, io.EOF) {
+			return ErrInvalidBackup
+		}
+	}
+	d.index++
+	d.buf = plaintext
+	return nil
+}
@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/database"
+
+	"gorm.io/gorm"
+)
+
+const (
+	filePrefix = "backup-"
+	fileSuffix = ".bak"
+)
+
+// Scheduler 定期将备份写入目录，只保留最近的若干个文件
+type Scheduler struct {
+	db        *gorm.DB
+	dir       string
+	key       string
+	retention int
+}
+
+func NewScheduler(db *gorm.DB, cfg config.BackupConfig) *Scheduler {
+	return &Scheduler{
+		db:        db,
+		dir:       cfg.Dir,
+		key:       cfg.EncryptionKey,
+		retention: cfg.Retention,
+	}
+}
+
+// Start 按interval定期备份，interval<=0或未配置加密密钥时不启动。返回停止函数
+func (s *Scheduler) Start(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	if s.key == "" {
+		log.Printf("Scheduled backups disabled: BACKUP_ENCRYPTION_KEY is not configured")
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				path, manifest, err := s.Run(context.Background())
+				if err != nil {
+					log.Printf("Scheduled backup failed: %v", err)
+					continue
+				}
+				log.Printf("Backup written to %s (%d tables)", path, len(manifest.Tables))
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Run 立即备份到目录中以时间命名的文件并清理超出保留数量的旧文件，返回文件路径
+func (s *Scheduler) Run(ctx context.Context) (string, *Manifest, error) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(s.dir, filePrefix+time.Now().UTC().Format("20060102T150405Z")+fileSuffix)
+	manifest, err := WriteFile(ctx, s.db, path, s.key)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.prune(); err != nil {
+		log.Printf("Failed to prune old backups: %v", err)
+	}
+	return path, manifest, nil
+}
+
+// prune 删除超出保留数量的旧备份，文件名按时间排序
+func (s *Scheduler) prune() error {
+	if s.retention <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			files = append(files, name)
+		}
+	}
+	if len(files) <= s.retention {
+		return nil
+	}
+	sort.Strings(files)
+	for _, name := range files[:len(files)-s.retention] {
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile 备份全部表到path，先写入临时文件，完成后再重命名，失败时不留下不完整的文件
+func WriteFile(ctx context.Context, db *gorm.DB, path, key string) (*Manifest, error) {
+	tables, err := database.TableNames(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := Backup(ctx, db, tables, f, key)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to finalize backup: %w", err)
+	}
+	return manifest, nil
+}
+
+// RestoreFile 从path恢复全部表
+func RestoreFile(ctx context.Context, db *gorm.DB, path, key string, replace bool) (*Manifest, error) {
+	tables, err := database.TableNames(db)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Restore(ctx, db, tables, f, key, replace)
+}
@@ -0,0 +1,258 @@
+package billing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stripeAPIBase = "https://api.stripe.com/v1"
+	// signatureTolerance webhook签名时间戳允许的最大偏差，防止重放
+	signatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Client Stripe REST API的最小封装，只包含结账、发票和webhook验签
+type Client struct {
+	secretKey  string
+	httpClient *http.Client
+
+	mu sync.RWMutex
+}
+
+func NewClient(secretKey string) *Client {
+	return &Client{
+		secretKey:  secretKey,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SetSecretKey 密钥轮换后替换API密钥，之后的请求使用新密钥
+func (c *Client) SetSecretKey(secretKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.secretKey = secretKey
+}
+
+func (c *Client) key() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.secretKey
+}
+
+// CheckoutParams 创建结账会话的参数
+type CheckoutParams struct {
+	Mode          string // subscription（订阅）或 payment（一次性购买）
+	PriceID       string
+	Quantity      int
+	CustomerID    string // 已有Stripe客户时复用，否则按邮箱创建
+	CustomerEmail string
+	ReferenceID   string
+	Metadata      map[string]string
+	SuccessURL    string
+	CancelURL     string
+}
+
+type CheckoutSession struct {
+	ID                string            `json:"id"`
+	URL               string            `json:"url"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Customer          string            `json:"customer"`
+	Subscription      string            `json:"subscription"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+type Subscription struct {
+	ID               string `json:"id"`
+	Customer         string `json:"customer"`
+	Status           string `json:"status"`
+	CurrentPeriodEnd int64  `json:"current_period_end"`
+	Items            struct {
+		Data []struct {
+			Price struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// PriceID 订阅的第一个价格ID
+func (s *Subscription) PriceID() string {
+	if len(s.Items.Data) == 0 {
+		return ""
+	}
+	return s.Items.Data[0].Price.ID
+}
+
+type Invoice struct {
+	ID               string `json:"id"`
+	Number           string `json:"number"`
+	Customer         string `json:"customer"`
+	Subscription     string `json:"subscription"`
+	Status           string `json:"status"`
+	Currency         string `json:"currency"`
+	AmountDue        int64  `json:"amount_due"`
+	AmountPaid       int64  `json:"amount_paid"`
+	HostedInvoiceURL string `json:"hosted_invoice_url"`
+	InvoicePDF       string `json:"invoice_pdf"`
+	Created          int64  `json:"created"`
+}
+
+// Event webhook事件，Object按事件类型解析为对应对象
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// CreateCheckoutSession 创建结账会话
+func (c *Client) CreateCheckoutSession(ctx context.Context, params *CheckoutParams) (*CheckoutSession, error) {
+	quantity := params.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+
+	form := url.Values{}
+	form.Set("mode", params.Mode)
+	form.Set("line_items[0][price]", params.PriceID)
+	form.Set("line_items[0][quantity]", strconv.Itoa(quantity))
+	form.Set("success_url", params.SuccessURL)
+	form.Set("cancel_url", params.CancelURL)
+	form.Set("client_reference_id", params.ReferenceID)
+	if params.CustomerID != "" {
+		form.Set("customer", params.CustomerID)
+	} else {
+		form.Set("customer_email", params.CustomerEmail)
+	}
+	for key, value := range params.Metadata {
+		form.Set("metadata["+key+"]", value)
+		if params.Mode == "subscription" {
+			form.Set("subscription_data[metadata]["+key+"]", value)
+		}
+	}
+
+	var session CheckoutSession
+	if err := c.do(ctx, http.MethodPost, "/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListInvoices 列出客户最近的发票
+func (c *Client) ListInvoices(ctx context.Context, customerID string, limit int) ([]Invoice, error) {
+	query := url.Values{}
+	query.Set("customer", customerID)
+	query.Set("limit", strconv.Itoa(limit))
+
+	var list struct {
+		Data []Invoice `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/invoices?"+query.Encode(), nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Data, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, stripeAPIBase+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.key(), "")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("stripe error (%d): %s", resp.StatusCode, apiErr.Error.Message)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// ParseWebhook 校验Stripe-Signature头并解析事件，secret为空时拒绝所有事件（空密钥的签名任何人都能伪造）
+func ParseWebhook(payload []byte, signatureHeader, secret string) (*Event, error) {
+	if secret == "" {
+		return nil, ErrInvalidSignature
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signatureHeader, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	valid := false
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -0,0 +1,66 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func sign(payload []byte, secret string, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseWebhook(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1"}}}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		header  string
+		secret  string
+		wantErr bool
+	}{
+		{name: "valid", header: sign(payload, secret, now), secret: secret},
+		{name: "unsigned", header: "", secret: secret, wantErr: true},
+		{name: "timestamp only", header: "t=" + strconv.FormatInt(now.Unix(), 10), secret: secret, wantErr: true},
+		{name: "wrong secret", header: sign(payload, "whsec_attacker", now), secret: secret, wantErr: true},
+		{name: "expired", header: sign(payload, secret, now.Add(-10*time.Minute)), secret: secret, wantErr: true},
+		{name: "empty secret rejects unsigned", header: "", secret: "", wantErr: true},
+		{name: "empty secret rejects empty-key signature", header: sign(payload, "", now), secret: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ParseWebhook(payload, tt.header, tt.secret)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("ParseWebhook() error = %v, want ErrInvalidSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWebhook() error = %v", err)
+			}
+			if event.ID != "evt_1" || event.Type != "checkout.session.completed" {
+				t.Fatalf("ParseWebhook() event = %+v", event)
+			}
+		})
+	}
+}
+
+func TestParseWebhookTamperedPayload(t *testing.T) {
+	const secret = "whsec_test"
+	header := sign([]byte(`{"id":"evt_1","type":"invoice.paid"}`), secret, time.Now())
+	_, err := ParseWebhook([]byte(`{"id":"evt_1","type":"checkout.session.completed"}`), header, secret)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("ParseWebhook() error = %v, want ErrInvalidSignature", err)
+	}
+}
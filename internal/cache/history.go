@@ -0,0 +1,131 @@
+// Package cache 基于Redis的读缓存，缓存内容以数据库为准，丢失或过期时从数据库重建
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ai-chat-backend/internal/metrics"
+	"ai-chat-backend/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// setHistoryScript 缓存从数据库读取的上下文：版本号与读取前一致（期间没有失效）且缓存不存在时才写入，
+// 避免覆盖并发追加的消息或写入已失效的内容。KEYS: 消息列表、版本号；ARGV: 读取前的版本号、过期毫秒数、消息...
+var setHistoryScript = redis.NewScript(`
+local version = redis.call('GET', KEYS[2]) or ''
+if version ~= ARGV[1] or redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+for i = 3, #ARGV do
+	redis.call('RPUSH', KEYS[1], ARGV[i])
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// appendHistoryScript 缓存存在时追加一条消息并只保留最近的limit条，缓存不存在时不写入，
+// 下次读取时从数据库重建。ARGV: 消息、limit、过期毫秒数
+var appendHistoryScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+redis.call('LTRIM', KEYS[1], -tonumber(ARGV[2]), -1)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// HistoryCache 在Redis中缓存会话最近的上下文消息（按时间正序），活跃会话组装上下文时不必查询数据库。
+// 新消息保存后追加到缓存（write-through）；压缩、删除、涂抹、合并、冷存储等改变上下文的操作使缓存失效
+type HistoryCache struct {
+	rdb   *redis.Client
+	limit int
+	ttl   time.Duration
+}
+
+// NewHistoryCache limit为缓存的最近消息数，ttl为会话闲置后缓存的保留时间
+func NewHistoryCache(rdb *redis.Client, limit int, ttl time.Duration) *HistoryCache {
+	return &HistoryCache{rdb: rdb, limit: limit, ttl: ttl}
+}
+
+func (c *HistoryCache) messagesKey(conversationID uint) string {
+	return fmt.Sprintf("history:conversation:%d:messages", conversationID)
+}
+
+func (c *HistoryCache) versionKey(conversationID uint) string {
+	return fmt.Sprintf("history:conversation:%d:version", conversationID)
+}
+
+// Get 读取缓存的上下文，未命中时messages为nil，返回的版本号在从数据库重建后传给Set
+func (c *HistoryCache) Get(ctx context.Context, conversationID uint) ([]model.Message, string, error) {
+	pipe := c.rdb.Pipeline()
+	items := pipe.LRange(ctx, c.messagesKey(conversationID), 0, -1)
+	version := pipe.Get(ctx, c.versionKey(conversationID))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, "", err
+	}
+
+	if len(items.Val()) == 0 {
+		metrics.HistoryCacheLookups.Inc("miss")
+		return nil, version.Val(), nil
+	}
+	messages := make([]model.Message, 0, len(items.Val()))
+	for _, item := range items.Val() {
+		var msg model.Message
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			return nil, "", err
+		}
+		messages = append(messages, msg)
+	}
+	metrics.HistoryCacheLookups.Inc("hit")
+	return messages, version.Val(), nil
+}
+
+// Set 以从数据库读取的上下文重建缓存，version为读取数据库前Get返回的版本号，期间缓存失效过时不写入
+func (c *HistoryCache) Set(ctx context.Context, conversationID uint, version string, messages []model.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	if len(messages) > c.limit {
+		messages = messages[len(messages)-c.limit:]
+	}
+
+	args := make([]interface{}, 0, len(messages)+2)
+	args = append(args, version, c.ttl.Milliseconds())
+	for i := range messages {
+		data, err := json.Marshal(&messages[i])
+		if err != nil {
+			return err
+		}
+		args = append(args, data)
+	}
+	return setHistoryScript.Run(ctx, c.rdb, []string{c.messagesKey(conversationID), c.versionKey(conversationID)}, args...).Err()
+}
+
+// Append 新消息保存到数据库后追加到缓存
+func (c *HistoryCache) Append(ctx context.Context, msg *model.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return appendHistoryScript.Run(ctx, c.rdb, []string{c.messagesKey(msg.ConversationID)},
+		data, strconv.Itoa(c.limit), c.ttl.Milliseconds()).Err()
+}
+
+// Invalidate 删除会话的缓存并递增版本号，进行中的重建不会写入失效前读取的内容
+func (c *HistoryCache) Invalidate(ctx context.Context, conversationIDs ...uint) error {
+	pipe := c.rdb.TxPipeline()
+	for _, conversationID := range conversationIDs {
+		pipe.Del(ctx, c.messagesKey(conversationID))
+		pipe.Incr(ctx, c.versionKey(conversationID))
+		pipe.Expire(ctx, c.versionKey(conversationID), c.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
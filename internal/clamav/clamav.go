@@ -0,0 +1,104 @@
+// Package clamav ClamAV（clamd）客户端，以INSTREAM命令扫描内存中的数据
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize 每次发送的数据块大小，clamd的StreamMaxLength限制的是总大小
+const chunkSize = 64 * 1024
+
+// ErrSizeLimit 数据超过clamd的StreamMaxLength
+var ErrSizeLimit = errors.New("clamd: stream size limit exceeded")
+
+// Result 扫描结果，Signature为命中的病毒特征名
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Client clamd客户端，每次扫描建立一个连接
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// New addr为"unix:///var/run/clamav/clamd.ctl"或"host:3310"（可带tcp://前缀）
+func New(addr string, timeout time.Duration) *Client {
+	network, address := "tcp", strings.TrimPrefix(addr, "tcp://")
+	if strings.HasPrefix(addr, "unix://") {
+		network, address = "unix", strings.TrimPrefix(addr, "unix://")
+	}
+	return &Client{network: network, address: address, timeout: timeout}
+}
+
+// Scan 扫描数据
+func (c *Client) Scan(ctx context.Context, data []byte) (*Result, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// 以null结尾的命令，随后为若干"4字节长度（网络字节序）+数据"的块，以长度为0的块结束
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	for offset := 0; offset < len(data); offset += chunkSize {
+		chunk := data[offset:min(offset+chunkSize, len(data))]
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		if _, err := w.Write(size[:]); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return nil, err
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := w.Write(size[:]); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return nil, fmt.Errorf("clamd: %w", err)
+	}
+	return parseReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseReply 解析"stream: OK"、"stream: <特征名> FOUND"或"<说明> ERROR"
+func parseReply(reply string) (*Result, error) {
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case reply == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.Contains(reply, "size limit exceeded"):
+		return nil, ErrSizeLimit
+	}
+	return nil, fmt.Errorf("clamd: unexpected reply %q", reply)
+}
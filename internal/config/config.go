@@ -0,0 +1,975 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	App      AppConfig
+	Server   ServerConfig
+	Database DatabaseConfig
+	Redis    RedisConfig
+	AI       AIConfig
+	JWT      JWTConfig
+	Stream   StreamConfig
+	Chat     ChatConfig
+	Job      JobConfig
+	Legal    LegalConfig
+	Mail     MailConfig
+	Kafka    KafkaConfig
+	Billing  BillingConfig
+	Credits  CreditsConfig
+	Internal InternalConfig
+	Secrets  SecretsConfig
+	Slack    SlackConfig
+	Telegram TelegramConfig
+	Region   RegionConfig
+	Backup   BackupConfig
+	Storage  StorageConfig
+	Signup   SignupConfig
+	Avatar   AvatarConfig
+	Export   ExportConfig
+	Calendar CalendarConfig
+	SLO      SLOConfig
+	Guest    GuestConfig
+	Share    ShareConfig
+	Upload   UploadConfig
+	RAG      RAGConfig
+	Tools    ToolsConfig
+
+	Impersonation ImpersonationConfig
+	RateLimit     RateLimitConfig
+}
+
+type AppConfig struct {
+	// FrontendURL 前端地址，用于生成邮件中的链接
+	FrontendURL string
+	// EncryptionKey 加密落库敏感信息（如用户API Key）的密钥，为空时不启用相关功能
+	EncryptionKey string
+}
+
+type ServerConfig struct {
+	Address string
+	// ReadOnly 启动时即进入只读模式，运行中可由管理员切换
+	ReadOnly bool
+	// MetricsEnabled 是否在MetricsAddr上开放 /metrics（Prometheus文本格式），不经过对外的服务地址
+	MetricsEnabled bool
+	// MetricsAddr /metrics的独立监听地址，应只绑定本机或内网
+	MetricsAddr string
+	// PprofAddr pprof的独立监听地址，为空时不开放，应只绑定本机
+	PprofAddr string
+	// TrustedProxies 受信任的反向代理（CIDR或IP），只有来自这些地址的请求才从X-Forwarded-For/X-Real-IP读取客户端IP，
+	// 为空时始终使用连接的对端地址
+	TrustedProxies []string
+}
+
+type DatabaseConfig struct {
+	DSN string
+	// AutoMigrate 启动时是否自动迁移表结构，蓝绿发布时应关闭并由迁移任务单独执行
+	AutoMigrate bool
+	// SchemaCheck 启动时的表结构兼容性检查模式：off / warn / strict
+	SchemaCheck string
+	// CompressThreshold 消息内容达到该字节数时以zstd压缩保存，0表示不压缩
+	CompressThreshold int
+}
+
+type RedisConfig struct {
+	// Addr 为空时不启用Redis，依赖Redis的功能不可用
+	Addr     string
+	Password string
+	DB       int
+}
+
+type AIConfig struct {
+	// Provider 模型服务类型：openai（含兼容接口）/ azure
+	Provider string
+	BaseURL  string
+	APIKey   string
+	Model    string
+	Timeout  time.Duration
+	// MaxOutputTokens 单次生成的输出token上限，用户级配置不能超过该值
+	MaxOutputTokens int
+	// ContextWindow 模型上下文窗口（token数），0表示按模型名称推断
+	ContextWindow int
+	// AzureDeployment Azure部署名，为空时与Model相同；Model仍用于套餐校验和上下文窗口推断
+	AzureDeployment string
+	AzureAPIVersion string
+	// AzureTenantID 等服务主体凭据在未配置APIKey时用于Azure AD认证
+	AzureTenantID     string
+	AzureClientID     string
+	AzureClientSecret string
+	// Providers 可在会话或消息中按模型名称选用的其他模型服务，由 AI_PROVIDERS 列出名称，通过 AI_PROVIDER_<名称>_* 配置
+	Providers map[string]AIProvider
+	// Fallback 选用的模型服务出错时是否改用默认模型重试
+	Fallback bool
+}
+
+// AIProvider 一个可选用的模型服务，Models为该服务提供的模型，模型名称在所有服务中唯一
+type AIProvider struct {
+	// Type 服务类型：openai（含兼容接口）/ azure / ollama / deepseek
+	Type            string
+	BaseURL         string
+	APIKey          string
+	Models          []string
+	AzureAPIVersion string
+	// Region 配置了数据区域时，只有该区域的用户可以选用，未设置时不可选用
+	Region string
+}
+
+type StreamConfig struct {
+	// Coalesce 是否将模型增量输出合并到词/句边界后再推送
+	Coalesce bool
+	// CoalesceInterval 两次推送之间的最小间隔
+	CoalesceInterval time.Duration
+	// UsageEvery 每推送多少个模型输出片段发送一次预估用量事件，0表示不发送
+	UsageEvery int
+	// PromptPrice、CompletionPrice 每1K输入/输出token的价格，用于计算用量事件中的费用
+	PromptPrice     float64
+	CompletionPrice float64
+}
+
+type ChatConfig struct {
+	// IncognitoTTL 无痕会话消息在Redis中的保留时间
+	IncognitoTTL time.Duration
+	// CounterReconcileInterval 用户会话/消息计数的校正间隔，0表示不自动校正
+	CounterReconcileInterval time.Duration
+	// AutoArchiveDays 会话闲置多少天后自动归档（用户未单独设置时），0表示默认不归档
+	AutoArchiveDays int
+	// AutoArchiveInterval 自动归档任务的执行间隔，0表示不运行
+	AutoArchiveInterval time.Duration
+	// CompactThreshold 会话未压缩的消息数超过该值时自动汇总较早的消息，0表示不汇总
+	CompactThreshold int
+	// CompactKeep 汇总后保留原样作为上下文的最近消息数
+	CompactKeep int
+	// SystemPrompt 默认助手的系统提示词，为空时不添加
+	SystemPrompt string
+	// PromptAudit 是否记录每次模型调用的完整提示词和回复，供合规审计
+	PromptAudit bool
+	// GenerationTraces 是否保存每次回复的生成过程（上下文、检索、工具调用、模型参数和耗时），供排查问题
+	GenerationTraces bool
+	// JailbreakDetection 是否检测用户输入和检索内容中疑似提示词注入/越狱的内容并记录安全事件
+	JailbreakDetection bool
+	// JailbreakClassifier 规则之外是否由模型对用户输入再做一次分类，每条消息增加一次模型调用
+	JailbreakClassifier bool
+	// JailbreakRefuse 达到该严重程度（low/medium/high）时拒绝用户输入、丢弃检索文档，为空时只记录
+	JailbreakRefuse string
+	// SanitizeStrip 检索文档和MCP工具结果放入提示词前是否删除类指令片段
+	SanitizeStrip bool
+	// SanitizeDelimit 是否以标记包裹检索文档和MCP工具结果并注明来源
+	SanitizeDelimit bool
+	// SanitizeProvenance 是否要求来源信息，丢弃没有来源信息（元数据source/url或文档ID）的检索文档
+	SanitizeProvenance bool
+	// ColdStorageDays 早于多少天的消息内容移入对象存储，只保留消息记录，0表示不移出
+	ColdStorageDays int
+	// ColdStorageInterval 冷存储归档任务的执行间隔
+	ColdStorageInterval time.Duration
+	// DedupeWindow 该时间内发往同一会话的相同用户消息视为重复提交，只生成一次回复，0表示不合并
+	DedupeWindow time.Duration
+	// SecretDetection 用户消息中API密钥、私钥等凭据的处理：off不检测，warn保存时替换为占位并在响应中提示，block拒绝消息
+	SecretDetection string
+	// WelcomeConversation 用户首次登录时是否创建欢迎会话，WelcomeTitle为其标题
+	WelcomeConversation bool
+	WelcomeTitle        string
+	// WelcomeMessage 欢迎会话中引导消息的模板（FString），可使用{nickname}、{date}变量，为空时使用内置的引导消息；
+	// 发布了welcome提示词模板时使用模板
+	WelcomeMessage string
+	// AutoTitle 会话完成首轮问答后是否调用模型生成标题替换创建时的标题，单条消息可通过auto_title=false关闭
+	AutoTitle bool
+	// HistoryCacheTTL 配置Redis时活跃会话最近上下文在Redis中的缓存时间，0表示不缓存
+	HistoryCacheTTL time.Duration
+	// QuotaWarningRatio 当天剩余消息数不超过每日上限的该比例时在回复中提醒，0表示不提醒
+	QuotaWarningRatio float64
+}
+
+type JobConfig struct {
+	// Workers 同时执行的后台任务数
+	Workers int
+	// QueueSize 等待执行的任务上限，队列已满时拒绝新任务
+	QueueSize int
+}
+
+type LegalConfig struct {
+	// TermsVersion/PrivacyVersion 当前生效的条款版本，为空表示不要求接受
+	TermsVersion   string
+	PrivacyVersion string
+}
+
+type MailConfig struct {
+	// Host 为空时不发送邮件，只打印到日志
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type KafkaConfig struct {
+	// Brokers 为空时不启用Kafka分析事件
+	Brokers        []string
+	AnalyticsTopic string
+}
+
+type BillingConfig struct {
+	// StripeSecretKey 为空时不启用计费
+	StripeSecretKey     string
+	StripeWebhookSecret string
+	// PriceIDs 套餐编码到Stripe价格ID的映射
+	PriceIDs map[string]string
+	// GracePeriod 扣款失败后保留付费套餐的宽限期
+	GracePeriod time.Duration
+}
+
+type CreditsConfig struct {
+	// Enabled 开启后生成前检查余额，并按实际token用量扣减
+	Enabled bool
+	// SignupBonus 新用户注册赠送的额度
+	SignupBonus int64
+	// PackSize 每购买一份额度包获得的额度，对应Stripe价格 STRIPE_PRICE_CREDITS
+	PackSize int64
+	// WarningBalance 余额不超过该值时在回复中提醒，0表示不提醒
+	WarningBalance int64
+}
+
+type InternalConfig struct {
+	// Services 受信任的内部服务，为空时不开放 /internal 接口
+	Services []ServiceIdentity
+	// TokenMaxAge 服务token允许的最长有效期
+	TokenMaxAge time.Duration
+}
+
+// ServiceIdentity 内部服务身份，服务用Secret签发token，只能访问Scopes中的接口
+type ServiceIdentity struct {
+	Name   string
+	Secret string
+	Scopes []string
+}
+
+type SecretsConfig struct {
+	// VaultAddr 为空时不从Vault加载密钥，只使用环境变量
+	VaultAddr string
+	// VaultPath KV的API路径，如 secret/data/ai-chat
+	VaultPath      string
+	VaultToken     string
+	VaultTokenFile string
+	VaultNamespace string
+	// RefreshInterval 重新拉取密钥以支持轮换的间隔，0表示只在启动时加载
+	RefreshInterval time.Duration
+}
+
+type SlackConfig struct {
+	// BotToken/SigningSecret 均配置时启用Slack机器人桥接
+	BotToken      string
+	SigningSecret string
+}
+
+type TelegramConfig struct {
+	// BotToken/WebhookSecret 均配置时启用Telegram机器人
+	BotToken string
+	// BotUsername 用于生成 t.me 绑定链接
+	BotUsername string
+	// WebhookSecret 调用setWebhook时设置的secret_token，同时用于签名绑定码
+	WebhookSecret string
+}
+
+type RegionConfig struct {
+	// Current 本部署存储数据的区域，为空时为单区域部署，不拒绝其他区域的用户
+	Current string
+	// Default 未设置区域的用户所属的区域，未配置时与Current相同
+	Default string
+	// Providers 各区域使用的模型服务，由 DATA_REGIONS 列出区域，为空时所有区域使用 AI_* 配置的服务
+	Providers map[string]RegionProvider
+}
+
+// RegionProvider 区域的模型服务，通过 REGION_<区域>_AI_* 配置，未配置的模型名称沿用 AI_MODEL
+type RegionProvider struct {
+	Provider        string
+	BaseURL         string
+	APIKey          string
+	Model           string
+	AzureDeployment string
+	AzureAPIVersion string
+}
+
+type BackupConfig struct {
+	// Dir 定时备份和未指定输出文件时的备份目录
+	Dir string
+	// EncryptionKey 备份文件的加密密钥，备份和恢复都需要，为空时不能备份
+	EncryptionKey string
+	// Interval 定时备份的间隔，0表示不定时备份
+	Interval time.Duration
+	// Retention 定时备份保留的文件数，0表示全部保留
+	Retention int
+}
+
+type StorageConfig struct {
+	// Backend 对象存储类型：fs（本地目录）/ s3（S3兼容服务），为空时不启用
+	Backend string
+	// Dir fs类型的存储目录
+	Dir string
+	// S3Endpoint 为空时使用AWS S3在S3Region的地址，MinIO等自建服务需要设置
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	// S3PublicEndpoint 下载地址使用的地址，为空时与S3Endpoint相同
+	S3PublicEndpoint string
+	// SignedURLTTL 文件下载地址的有效期，存储支持时客户端被重定向到限时地址直接下载，0表示始终由API服务转发
+	SignedURLTTL time.Duration
+	// ContentDisposition 下载时的Content-Disposition：inline在浏览器中打开，attachment作为附件下载
+	ContentDisposition string
+}
+
+type SignupConfig struct {
+	// DisposableDomains 一次性邮箱域名列表的文件路径或http(s)地址，每行一个域名，为空时不检查
+	DisposableDomains string
+	// DisposableRefresh 重新加载域名列表的间隔，0表示只在启动时加载
+	DisposableRefresh time.Duration
+	// RequireEmailVerification 注册后需输入邮箱收到的验证码激活账号，激活前不能登录
+	RequireEmailVerification bool
+	// CodeTTL 邮箱验证码（注册验证、重置密码）的有效期
+	CodeTTL time.Duration
+	// CodeMaxAttempts 每个验证码允许输错的次数，达到后验证码失效
+	CodeMaxAttempts int
+}
+
+type AvatarConfig struct {
+	// ImageModel 生成头像的图像模型（Azure时为部署名），为空时不开放头像生成
+	ImageModel string
+	// ImageSize 生成的图片尺寸，如1024x1024
+	ImageSize string
+	// DailyLimit 每个用户每天（按用户时区）可生成的头像数
+	DailyLimit int
+	// URLPrefix 头像地址前缀，默认由本服务提供，也可设置为指向对象存储的CDN地址
+	URLPrefix string
+}
+
+type ExportConfig struct {
+	// CallbackURL OAuth回调地址前缀，如https://api.example.com/api/v1/integrations/export，
+	// 各服务方的回调为 {CallbackURL}/{provider}/callback，需在服务方后台登记
+	CallbackURL string
+	// NotionClientID 为空时不开放导出到Notion
+	NotionClientID     string
+	NotionClientSecret string
+	// GoogleClientID 为空时不开放导出到Google文档
+	GoogleClientID     string
+	GoogleClientSecret string
+}
+
+type CalendarConfig struct {
+	// CallbackURL 日历授权的OAuth回调地址，需在Google OAuth客户端中登记；客户端凭证与导出共用
+	CallbackURL string
+}
+
+type SLOConfig struct {
+	// FirstTokenP95 首token延迟p95的目标值，0表示不监控
+	FirstTokenP95 time.Duration
+	// FirstTokenTargets 按模型（或 provider/model）单独设置的目标值，未设置的使用FirstTokenP95
+	FirstTokenTargets map[string]time.Duration
+	// Window 计算p95的滚动窗口
+	Window time.Duration
+	// MinSamples 窗口内样本数达到该值才评估，避免少量慢请求触发告警
+	MinSamples int
+	// EvalInterval 评估间隔
+	EvalInterval time.Duration
+	// AlertWebhookURL 告警推送地址，为空时只发布事件；AlertWebhookSecret 用于签名
+	AlertWebhookURL    string
+	AlertWebhookSecret string
+}
+
+type GuestConfig struct {
+	// MessageQuota 每个IP（及每个访客）在Window内可发送的免费消息数，0表示不开放访客试用；访客试用依赖Redis
+	MessageQuota int
+	// Window 额度和签发次数的统计周期
+	Window time.Duration
+	// TokensPerIP 每个IP在Window内可签发的访客token数
+	TokensPerIP int
+	// BlockDuration 同一IP签发请求超过TokensPerIP的3倍时封禁的时长
+	BlockDuration time.Duration
+	// TokenTTL 访客token的有效期，过期且未注册的访客及其会话由后台任务删除
+	TokenTTL time.Duration
+}
+
+type ShareConfig struct {
+	// IdleTimeout 分享链接在该时间内无人访问（从创建或最近一次访问算起）时自动撤销，0表示不按闲置撤销
+	IdleTimeout time.Duration
+	// RevokeInterval 撤销过期、达到访问次数上限和闲置链接的任务执行间隔，0表示不运行（访问时仍会校验）
+	RevokeInterval time.Duration
+	// CacheSize 进程内缓存的分享页内容数（按链接和内容版本），0表示不缓存
+	CacheSize int
+	// CacheMaxAge 不限访问次数的分享页允许浏览器缓存的时间（private，不允许CDN缓存），0表示不允许缓存。
+	// 缓存期内的访问不计入访问次数，撤销也最迟在该时间后生效
+	CacheMaxAge time.Duration
+	// AnalyticsRetention 分享访问记录的保留时间，0表示一直保留
+	AnalyticsRetention time.Duration
+}
+
+type UploadConfig struct {
+	// MaxSize 单个上传文件的大小上限（字节）
+	MaxSize int64
+	// ClamAVAddr clamd地址（host:port或unix:///path），为空时不扫描上传的文件
+	ClamAVAddr string
+	// ScanTimeout 单个文件的扫描超时
+	ScanTimeout time.Duration
+	// RescanInterval 重新扫描仍在隔离区的文件（扫描失败或实例重启）的间隔
+	RescanInterval time.Duration
+	// StripMetadata 是否重新编码上传的图片以去掉EXIF/GPS等元数据
+	StripMetadata bool
+	// ThumbnailSizes 为图片生成的缩略图尺寸（最长边像素），为空时不生成
+	ThumbnailSizes []int
+	// URLPrefix 附件下载地址前缀
+	URLPrefix string
+	// OCR 是否识别消息附带的图片中的文字，OCRMinChars、OCRConfidence为视为包含文字的最少字符数和最低平均置信度
+	OCR           bool
+	OCRMinChars   int
+	OCRConfidence float64
+}
+
+type RAGConfig struct {
+	// ChunkSize 知识库文档分块的最大字符数，ChunkOverlap为相邻块重叠的字符数，Splitter为分块方式，
+	// 均为知识库未单独设置时的默认值
+	ChunkSize    int
+	ChunkOverlap int
+	Splitter     string
+	// PDFToText、PDFToPPM、Tesseract 外部工具路径（poppler-utils和tesseract-ocr），为空表示未安装
+	PDFToText string
+	PDFToPPM  string
+	Tesseract string
+	// OCRLanguages Tesseract语言，如eng+chi_sim
+	OCRLanguages string
+	// OCRMinChars 文本层少于该字符数的PDF页面改用OCR
+	OCRMinChars int
+	// OCRDPI OCR时渲染PDF页面的分辨率
+	OCRDPI int
+	// MaxPages 单个PDF最多提取的页数
+	MaxPages int
+	// ExtractTimeout 单个文档的提取超时
+	ExtractTimeout time.Duration
+	// EmbeddingModel 向量检索使用的嵌入模型（OpenAI兼容接口），为空时只使用关键词检索
+	EmbeddingModel   string
+	EmbeddingBaseURL string
+	EmbeddingAPIKey  string
+	// RerankURL 重排模型接口地址（Cohere/Jina兼容），为空时不重排，按两路检索的融合得分排序
+	RerankURL    string
+	RerankModel  string
+	RerankAPIKey string
+	// TopK 每次检索放入上下文的分块数，Candidates为每路检索召回（及送去重排）的候选数
+	TopK       int
+	Candidates int
+	// KeywordWeight、VectorWeight 以倒数排名融合（RRF）两路检索结果时的权重
+	KeywordWeight float64
+	VectorWeight  float64
+	// MaxScanChunks 单次检索最多扫描的分块数，超出时只检索最近加入的文档
+	MaxScanChunks int
+	// CrawlInterval 网页文档重新抓取的间隔，0表示不定期抓取；CrawlTimeout和CrawlMaxSize为单次抓取的超时和大小上限
+	CrawlInterval time.Duration
+	CrawlTimeout  time.Duration
+	CrawlMaxSize  int64
+}
+
+type ToolsConfig struct {
+	// Builtin 提供给模型的内置工具（calculator、current_time、web_search），逗号分隔，none表示不提供
+	Builtin string
+	// SearchURL SearXNG兼容的搜索接口地址（返回JSON），为空时不提供web_search；SearchAPIKey以Bearer方式发送
+	SearchURL    string
+	SearchAPIKey string
+	// SearchResults web_search返回给模型的结果数
+	SearchResults int
+}
+
+type ImpersonationConfig struct {
+	// RequireConsent 管理员代入用户身份前是否需要用户同意
+	RequireConsent bool
+	// ConsentTimeout 等待用户同意的时间，MaxDuration为单次代入的最长时间
+	ConsentTimeout time.Duration
+	MaxDuration    time.Duration
+}
+
+// RateLimitConfig 令牌桶限流，认证前按客户端IP、认证后按用户计数，Limit为0的规则不限流
+type RateLimitConfig struct {
+	// Redis 配置Redis时是否在Redis中计数，多实例部署共享限额；否则每个实例单独计数
+	Redis bool
+	// Login 登录、注册、找回密码、访客token等公开接口（按IP）
+	Login RateLimitRule
+	// API 需要认证的接口（按用户）
+	API RateLimitRule
+	// Chat 发送消息、流式聊天和建立WebSocket连接（按用户），在API之外单独计数
+	Chat RateLimitRule
+}
+
+// RateLimitRule 每Period补充Limit个令牌，桶容量为Burst
+type RateLimitRule struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+type JWTConfig struct {
+	Secret string
+	// PreviousSecret 轮换前的密钥，轮换期间仍可验证已签发的token
+	PreviousSecret string
+	// Expiration 访问token的有效期，RefreshExpiration为刷新token的有效期（每次刷新后重新计算）
+	Expiration        time.Duration
+	RefreshExpiration time.Duration
+}
+
+// Load 从环境变量加载配置，未设置时使用默认值
+func Load() *Config {
+	return &Config{
+		App: AppConfig{
+			FrontendURL:   getEnv("APP_FRONTEND_URL", "http://localhost:3000"),
+			EncryptionKey: getEnv("APP_ENCRYPTION_KEY", ""),
+		},
+		Server: ServerConfig{
+			Address:        getEnv("SERVER_ADDRESS", ":8080"),
+			ReadOnly:       getEnvBool("SERVER_READ_ONLY", false),
+			MetricsEnabled: getEnvBool("METRICS_ENABLED", false),
+			MetricsAddr:    getEnv("METRICS_ADDR", "127.0.0.1:9090"),
+			PprofAddr:      getEnv("PPROF_ADDR", ""),
+			TrustedProxies: getEnvList("SERVER_TRUSTED_PROXIES"),
+		},
+		Database: DatabaseConfig{
+			DSN:               getEnv("DATABASE_DSN", "root:password@tcp(127.0.0.1:3306)/ai_chat?charset=utf8mb4&parseTime=True&loc=UTC"),
+			AutoMigrate:       getEnvBool("DATABASE_AUTO_MIGRATE", true),
+			SchemaCheck:       getEnv("DATABASE_SCHEMA_CHECK", "off"),
+			CompressThreshold: getEnvInt("DATABASE_COMPRESS_THRESHOLD", 4096),
+		},
+		Redis: RedisConfig{
+			Addr:     getEnv("REDIS_ADDR", ""),
+			Password: getEnv("REDIS_PASSWORD", ""),
+			DB:       getEnvInt("REDIS_DB", 0),
+		},
+		AI: AIConfig{
+			Provider:        getEnv("AI_PROVIDER", "openai"),
+			BaseURL:         getEnv("AI_BASE_URL", "https://openai.qiniu.com/v1"),
+			APIKey:          getEnv("AI_API_KEY", ""),
+			Model:           getEnv("AI_MODEL", "deepseek-v3-0324"),
+			Timeout:         60 * time.Second,
+			MaxOutputTokens: getEnvInt("AI_MAX_OUTPUT_TOKENS", 4096),
+			ContextWindow:   getEnvInt("AI_CONTEXT_WINDOW", 0),
+
+			AzureDeployment:   getEnv("AI_AZURE_DEPLOYMENT", ""),
+			AzureAPIVersion:   getEnv("AI_AZURE_API_VERSION", "2024-10-21"),
+			AzureTenantID:     getEnv("AZURE_TENANT_ID", ""),
+			AzureClientID:     getEnv("AZURE_CLIENT_ID", ""),
+			AzureClientSecret: getEnv("AZURE_CLIENT_SECRET", ""),
+
+			Providers: getEnvProviders("AI_PROVIDERS"),
+			Fallback:  getEnvBool("AI_FALLBACK", true),
+		},
+		JWT: JWTConfig{
+			Secret:            getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+			PreviousSecret:    getEnv("JWT_PREVIOUS_SECRET", ""),
+			Expiration:        getEnvDuration("JWT_EXPIRATION", 24*time.Hour),
+			RefreshExpiration: getEnvDuration("JWT_REFRESH_EXPIRATION", 30*24*time.Hour),
+		},
+		Stream: StreamConfig{
+			Coalesce:         getEnvBool("STREAM_COALESCE", false),
+			CoalesceInterval: getEnvDuration("STREAM_COALESCE_INTERVAL", 50*time.Millisecond),
+			UsageEvery:       getEnvInt("STREAM_USAGE_EVERY", 20),
+			PromptPrice:      getEnvFloat("STREAM_PROMPT_PRICE", 0),
+			CompletionPrice:  getEnvFloat("STREAM_COMPLETION_PRICE", 0),
+		},
+		Chat: ChatConfig{
+			IncognitoTTL:             getEnvDuration("CHAT_INCOGNITO_TTL", 24*time.Hour),
+			CounterReconcileInterval: getEnvDuration("CHAT_COUNTER_RECONCILE_INTERVAL", time.Hour),
+			AutoArchiveDays:          getEnvInt("CHAT_AUTO_ARCHIVE_DAYS", 30),
+			AutoArchiveInterval:      getEnvDuration("CHAT_AUTO_ARCHIVE_INTERVAL", time.Hour),
+			CompactThreshold:         getEnvInt("CHAT_COMPACT_THRESHOLD", 40),
+			CompactKeep:              getEnvInt("CHAT_COMPACT_KEEP", 10),
+			SystemPrompt:             getEnv("CHAT_SYSTEM_PROMPT", ""),
+			PromptAudit:              getEnvBool("CHAT_PROMPT_AUDIT", false),
+			GenerationTraces:         getEnvBool("CHAT_GENERATION_TRACES", false),
+			JailbreakDetection:       getEnvBool("CHAT_JAILBREAK_DETECTION", true),
+			JailbreakClassifier:      getEnvBool("CHAT_JAILBREAK_CLASSIFIER", false),
+			JailbreakRefuse:          getEnv("CHAT_JAILBREAK_REFUSE", ""),
+			SanitizeStrip:            getEnvBool("CHAT_SANITIZE_STRIP", true),
+			SanitizeDelimit:          getEnvBool("CHAT_SANITIZE_DELIMIT", true),
+			SanitizeProvenance:       getEnvBool("CHAT_SANITIZE_REQUIRE_PROVENANCE", false),
+			ColdStorageDays:          getEnvInt("CHAT_COLD_STORAGE_DAYS", 0),
+			ColdStorageInterval:      getEnvDuration("CHAT_COLD_STORAGE_INTERVAL", 24*time.Hour),
+			DedupeWindow:             getEnvDuration("CHAT_DEDUPE_WINDOW", 10*time.Second),
+			SecretDetection:          getEnv("CHAT_SECRET_DETECTION", "warn"),
+			WelcomeConversation:      getEnvBool("CHAT_WELCOME_CONVERSATION", true),
+			WelcomeTitle:             getEnv("CHAT_WELCOME_TITLE", "Welcome"),
+			WelcomeMessage:           getEnv("CHAT_WELCOME_MESSAGE", ""),
+			AutoTitle:                getEnvBool("CHAT_AUTO_TITLE", true),
+			QuotaWarningRatio:        getEnvFloat("CHAT_QUOTA_WARNING_RATIO", 0.2),
+			HistoryCacheTTL:          getEnvDuration("CHAT_HISTORY_CACHE_TTL", 30*time.Minute),
+		},
+		Job: JobConfig{
+			Workers:   getEnvInt("JOB_WORKERS", 4),
+			QueueSize: getEnvInt("JOB_QUEUE_SIZE", 100),
+		},
+		Legal: LegalConfig{
+			TermsVersion:   getEnv("LEGAL_TERMS_VERSION", ""),
+			PrivacyVersion: getEnv("LEGAL_PRIVACY_VERSION", ""),
+		},
+		Mail: MailConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnvInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", ""),
+		},
+		Kafka: KafkaConfig{
+			Brokers:        getEnvList("KAFKA_BROKERS"),
+			AnalyticsTopic: getEnv("KAFKA_ANALYTICS_TOPIC", "ai-chat-analytics"),
+		},
+		Billing: BillingConfig{
+			StripeSecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
+			StripeWebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+			PriceIDs: map[string]string{
+				"pro":        getEnv("STRIPE_PRICE_PRO", ""),
+				"enterprise": getEnv("STRIPE_PRICE_ENTERPRISE", ""),
+				"credits":    getEnv("STRIPE_PRICE_CREDITS", ""),
+			},
+			GracePeriod: getEnvDuration("BILLING_GRACE_PERIOD", 72*time.Hour),
+		},
+		Credits: CreditsConfig{
+			Enabled:        getEnvBool("CREDITS_ENABLED", false),
+			SignupBonus:    int64(getEnvInt("CREDITS_SIGNUP_BONUS", 0)),
+			PackSize:       int64(getEnvInt("CREDITS_PACK_SIZE", 1000000)),
+			WarningBalance: int64(getEnvInt("CREDITS_WARNING_BALANCE", 10000)),
+		},
+		Internal: InternalConfig{
+			Services:    getEnvServices("INTERNAL_SERVICES"),
+			TokenMaxAge: getEnvDuration("INTERNAL_TOKEN_MAX_AGE", 5*time.Minute),
+		},
+		Secrets: SecretsConfig{
+			VaultAddr:       getEnv("VAULT_ADDR", ""),
+			VaultPath:       getEnv("VAULT_SECRET_PATH", "secret/data/ai-chat"),
+			VaultToken:      getEnv("VAULT_TOKEN", ""),
+			VaultTokenFile:  getEnv("VAULT_TOKEN_FILE", ""),
+			VaultNamespace:  getEnv("VAULT_NAMESPACE", ""),
+			RefreshInterval: getEnvDuration("VAULT_REFRESH_INTERVAL", 5*time.Minute),
+		},
+		Slack: SlackConfig{
+			BotToken:      getEnv("SLACK_BOT_TOKEN", ""),
+			SigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+		},
+		Telegram: TelegramConfig{
+			BotToken:      getEnv("TELEGRAM_BOT_TOKEN", ""),
+			BotUsername:   getEnv("TELEGRAM_BOT_USERNAME", ""),
+			WebhookSecret: getEnv("TELEGRAM_WEBHOOK_SECRET", ""),
+		},
+		Region: RegionConfig{
+			Current:   strings.ToLower(getEnv("DATA_REGION", "")),
+			Default:   strings.ToLower(getEnv("DATA_REGION_DEFAULT", getEnv("DATA_REGION", ""))),
+			Providers: getEnvRegions("DATA_REGIONS"),
+		},
+		Backup: BackupConfig{
+			Dir:           getEnv("BACKUP_DIR", "backups"),
+			EncryptionKey: getEnv("BACKUP_ENCRYPTION_KEY", ""),
+			Interval:      getEnvDuration("BACKUP_INTERVAL", 0),
+			Retention:     getEnvInt("BACKUP_RETENTION", 7),
+		},
+		Storage: StorageConfig{
+			Backend:            getEnv("STORAGE_BACKEND", ""),
+			Dir:                getEnv("STORAGE_DIR", "data/objects"),
+			S3Endpoint:         getEnv("S3_ENDPOINT", ""),
+			S3Region:           getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:           getEnv("S3_BUCKET", ""),
+			S3AccessKey:        getEnv("S3_ACCESS_KEY_ID", ""),
+			S3SecretKey:        getEnv("S3_SECRET_ACCESS_KEY", ""),
+			S3PublicEndpoint:   getEnv("S3_PUBLIC_ENDPOINT", ""),
+			SignedURLTTL:       getEnvDuration("STORAGE_SIGNED_URL_TTL", 5*time.Minute),
+			ContentDisposition: getEnv("STORAGE_CONTENT_DISPOSITION", "inline"),
+		},
+		Signup: SignupConfig{
+			DisposableDomains:        getEnv("DISPOSABLE_EMAIL_DOMAINS", ""),
+			DisposableRefresh:        getEnvDuration("DISPOSABLE_EMAIL_REFRESH", 24*time.Hour),
+			RequireEmailVerification: getEnvBool("SIGNUP_REQUIRE_EMAIL_VERIFICATION", false),
+			CodeTTL:                  getEnvDuration("VERIFICATION_CODE_TTL", 15*time.Minute),
+			CodeMaxAttempts:          getEnvInt("VERIFICATION_CODE_MAX_ATTEMPTS", 5),
+		},
+		Avatar: AvatarConfig{
+			ImageModel: getEnv("AVATAR_IMAGE_MODEL", ""),
+			ImageSize:  getEnv("AVATAR_IMAGE_SIZE", "1024x1024"),
+			DailyLimit: getEnvInt("AVATAR_DAILY_LIMIT", 5),
+			URLPrefix:  getEnv("AVATAR_URL_PREFIX", "/api/v1/avatars"),
+		},
+		Export: ExportConfig{
+			CallbackURL:        getEnv("EXPORT_CALLBACK_URL", "http://localhost:8080/api/v1/integrations/export"),
+			NotionClientID:     getEnv("NOTION_CLIENT_ID", ""),
+			NotionClientSecret: getEnv("NOTION_CLIENT_SECRET", ""),
+			GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
+			GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+		},
+		Calendar: CalendarConfig{
+			CallbackURL: getEnv("CALENDAR_CALLBACK_URL", "http://localhost:8080/api/v1/integrations/calendar/callback"),
+		},
+		SLO: SLOConfig{
+			FirstTokenP95:      getEnvDuration("SLO_FIRST_TOKEN_P95", 3*time.Second),
+			FirstTokenTargets:  getEnvDurations("SLO_FIRST_TOKEN_TARGETS"),
+			Window:             getEnvDuration("SLO_WINDOW", 10*time.Minute),
+			MinSamples:         getEnvInt("SLO_MIN_SAMPLES", 20),
+			EvalInterval:       getEnvDuration("SLO_EVAL_INTERVAL", time.Minute),
+			AlertWebhookURL:    getEnv("SLO_ALERT_WEBHOOK_URL", ""),
+			AlertWebhookSecret: getEnv("SLO_ALERT_WEBHOOK_SECRET", ""),
+		},
+		Guest: GuestConfig{
+			MessageQuota:  getEnvInt("GUEST_MESSAGE_QUOTA", 0),
+			Window:        getEnvDuration("GUEST_WINDOW", 24*time.Hour),
+			TokensPerIP:   getEnvInt("GUEST_TOKENS_PER_IP", 3),
+			BlockDuration: getEnvDuration("GUEST_BLOCK_DURATION", 24*time.Hour),
+			TokenTTL:      getEnvDuration("GUEST_TOKEN_TTL", 72*time.Hour),
+		},
+		Upload: UploadConfig{
+			MaxSize:        int64(getEnvInt("UPLOAD_MAX_SIZE", 20<<20)),
+			ClamAVAddr:     getEnv("CLAMAV_ADDR", ""),
+			ScanTimeout:    getEnvDuration("CLAMAV_TIMEOUT", time.Minute),
+			RescanInterval: getEnvDuration("UPLOAD_RESCAN_INTERVAL", 5*time.Minute),
+			StripMetadata:  getEnvBool("UPLOAD_STRIP_METADATA", true),
+			ThumbnailSizes: getEnvInts("UPLOAD_THUMBNAIL_SIZES", []int{256, 1024}),
+			URLPrefix:      getEnv("ATTACHMENT_URL_PREFIX", "/api/v1/attachments"),
+			OCR:            getEnvBool("UPLOAD_OCR", true),
+			OCRMinChars:    getEnvInt("UPLOAD_OCR_MIN_CHARS", 10),
+			OCRConfidence:  getEnvFloat("UPLOAD_OCR_MIN_CONFIDENCE", 60),
+		},
+		Share: ShareConfig{
+			IdleTimeout:        getEnvDuration("SHARE_IDLE_TIMEOUT", 30*24*time.Hour),
+			RevokeInterval:     getEnvDuration("SHARE_REVOKE_INTERVAL", 10*time.Minute),
+			CacheSize:          getEnvInt("SHARE_CACHE_SIZE", 1000),
+			CacheMaxAge:        getEnvDuration("SHARE_CACHE_MAX_AGE", time.Minute),
+			AnalyticsRetention: getEnvDuration("SHARE_ANALYTICS_RETENTION", 90*24*time.Hour),
+		},
+		RAG: RAGConfig{
+			ChunkSize:      getEnvInt("RAG_CHUNK_SIZE", 1000),
+			ChunkOverlap:   getEnvInt("RAG_CHUNK_OVERLAP", 150),
+			Splitter:       getEnv("RAG_SPLITTER", "recursive"),
+			PDFToText:      getEnv("PDFTOTEXT_PATH", "pdftotext"),
+			PDFToPPM:       getEnv("PDFTOPPM_PATH", "pdftoppm"),
+			Tesseract:      getEnv("TESSERACT_PATH", "tesseract"),
+			OCRLanguages:   getEnv("OCR_LANGUAGES", "eng"),
+			OCRMinChars:    getEnvInt("OCR_MIN_CHARS", 50),
+			OCRDPI:         getEnvInt("OCR_DPI", 300),
+			MaxPages:       getEnvInt("EXTRACT_MAX_PAGES", 500),
+			ExtractTimeout: getEnvDuration("EXTRACT_TIMEOUT", 10*time.Minute),
+
+			EmbeddingModel:   getEnv("RAG_EMBEDDING_MODEL", ""),
+			EmbeddingBaseURL: getEnv("RAG_EMBEDDING_BASE_URL", getEnv("AI_BASE_URL", "https://openai.qiniu.com/v1")),
+			EmbeddingAPIKey:  getEnv("RAG_EMBEDDING_API_KEY", getEnv("AI_API_KEY", "")),
+			RerankURL:        getEnv("RAG_RERANK_URL", ""),
+			RerankModel:      getEnv("RAG_RERANK_MODEL", ""),
+			RerankAPIKey:     getEnv("RAG_RERANK_API_KEY", ""),
+			TopK:             getEnvInt("RAG_TOP_K", 5),
+			Candidates:       getEnvInt("RAG_CANDIDATES", 30),
+			KeywordWeight:    getEnvFloat("RAG_KEYWORD_WEIGHT", 1),
+			VectorWeight:     getEnvFloat("RAG_VECTOR_WEIGHT", 1),
+			MaxScanChunks:    getEnvInt("RAG_MAX_SCAN_CHUNKS", 20000),
+
+			CrawlInterval: getEnvDuration("RAG_CRAWL_INTERVAL", 24*time.Hour),
+			CrawlTimeout:  getEnvDuration("RAG_CRAWL_TIMEOUT", 30*time.Second),
+			CrawlMaxSize:  int64(getEnvInt("RAG_CRAWL_MAX_SIZE", 10<<20)),
+		},
+		Tools: ToolsConfig{
+			Builtin:       getEnv("TOOLS_BUILTIN", "calculator,current_time,web_search"),
+			SearchURL:     getEnv("TOOLS_SEARCH_URL", ""),
+			SearchAPIKey:  getEnv("TOOLS_SEARCH_API_KEY", ""),
+			SearchResults: getEnvInt("TOOLS_SEARCH_RESULTS", 5),
+		},
+		Impersonation: ImpersonationConfig{
+			RequireConsent: getEnvBool("IMPERSONATION_REQUIRE_CONSENT", true),
+			ConsentTimeout: getEnvDuration("IMPERSONATION_CONSENT_TIMEOUT", 24*time.Hour),
+			MaxDuration:    getEnvDuration("IMPERSONATION_MAX_DURATION", time.Hour),
+		},
+		RateLimit: RateLimitConfig{
+			Redis: getEnvBool("RATE_LIMIT_REDIS", true),
+			Login: getEnvRateLimit("RATE_LIMIT_LOGIN", RateLimitRule{Limit: 10, Period: time.Minute, Burst: 5}),
+			API:   getEnvRateLimit("RATE_LIMIT_API", RateLimitRule{Limit: 300, Period: time.Minute, Burst: 60}),
+			Chat:  getEnvRateLimit("RATE_LIMIT_CHAT", RateLimitRule{Limit: 20, Period: time.Minute, Burst: 5}),
+		},
+	}
+}
+
+// Validate 检查配置组合是否安全可用，启动时调用，返回错误时拒绝启动
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Billing.StripeSecretKey != "" && c.Billing.StripeWebhookSecret == "" {
+		errs = append(errs, errors.New("STRIPE_WEBHOOK_SECRET is required when STRIPE_SECRET_KEY is set"))
+	}
+	return errors.Join(errs...)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvInts 解析以逗号分隔的正整数列表，未设置时使用默认值，设置为none时返回空列表
+func getEnvInts(key string, defaultValue []int) []int {
+	if os.Getenv(key) == "" {
+		return defaultValue
+	}
+	var ints []int
+	for _, item := range getEnvList(key) {
+		if i, err := strconv.Atoi(item); err == nil && i > 0 {
+			ints = append(ints, i)
+		}
+	}
+	return ints
+}
+
+// getEnvServices 解析服务身份列表，格式为 name:secret:scope1|scope2（密钥不能包含冒号），多个服务以逗号分隔
+func getEnvServices(key string) []ServiceIdentity {
+	var services []ServiceIdentity
+	for _, item := range getEnvList(key) {
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		services = append(services, ServiceIdentity{
+			Name:   parts[0],
+			Secret: parts[1],
+			Scopes: strings.Split(parts[2], "|"),
+		})
+	}
+	return services
+}
+
+// getEnvDurations 解析 key=duration 列表（如 gpt-4o=5s,azure/gpt-4=4s），格式错误的项忽略
+func getEnvDurations(key string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, item := range getEnvList(key) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			continue
+		}
+		durations[strings.TrimSpace(name)] = d
+	}
+	return durations
+}
+
+// getEnvRateLimit 解析限流规则 limit/period[:burst]（如 20/m:5，period可为s、m、h或时长如10s），
+// 未指定burst时等于limit，值为0时不限流，格式错误时使用默认值
+func getEnvRateLimit(key string, defaultValue RateLimitRule) RateLimitRule {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	if value == "0" {
+		return RateLimitRule{}
+	}
+	rate, burst, hasBurst := strings.Cut(value, ":")
+	count, per, ok := strings.Cut(rate, "/")
+	if !ok {
+		return defaultValue
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || limit < 0 {
+		return defaultValue
+	}
+	var period time.Duration
+	switch per = strings.TrimSpace(per); per {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		if period, err = time.ParseDuration(per); err != nil || period <= 0 {
+			return defaultValue
+		}
+	}
+	rule := RateLimitRule{Limit: limit, Period: period, Burst: limit}
+	if hasBurst {
+		if rule.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || rule.Burst <= 0 {
+			return defaultValue
+		}
+	}
+	return rule
+}
+
+// getEnvProviders 解析模型服务列表（如 deepseek,local）及各服务的配置，名称统一为小写
+func getEnvProviders(key string) map[string]AIProvider {
+	providers := make(map[string]AIProvider)
+	for _, name := range getEnvList(key) {
+		name = strings.ToLower(name)
+		prefix := "AI_PROVIDER_" + strings.ToUpper(name) + "_"
+		providers[name] = AIProvider{
+			Type:            getEnv(prefix+"TYPE", "openai"),
+			BaseURL:         getEnv(prefix+"BASE_URL", ""),
+			APIKey:          getEnv(prefix+"API_KEY", ""),
+			Models:          getEnvList(prefix + "MODELS"),
+			AzureAPIVersion: getEnv(prefix+"AZURE_API_VERSION", "2024-10-21"),
+			Region:          strings.ToLower(getEnv(prefix+"REGION", "")),
+		}
+	}
+	return providers
+}
+
+// getEnvRegions 解析区域列表（如 eu,us）及各区域的模型服务配置，区域名统一为小写
+func getEnvRegions(key string) map[string]RegionProvider {
+	regions := make(map[string]RegionProvider)
+	for _, region := range getEnvList(key) {
+		region = strings.ToLower(region)
+		prefix := "REGION_" + strings.ToUpper(region) + "_AI_"
+		regions[region] = RegionProvider{
+			Provider:        getEnv(prefix+"PROVIDER", "openai"),
+			BaseURL:         getEnv(prefix+"BASE_URL", ""),
+			APIKey:          getEnv(prefix+"API_KEY", ""),
+			Model:           getEnv(prefix+"MODEL", getEnv("AI_MODEL", "deepseek-v3-0324")),
+			AzureDeployment: getEnv(prefix+"AZURE_DEPLOYMENT", ""),
+			AzureAPIVersion: getEnv(prefix+"AZURE_API_VERSION", "2024-10-21"),
+		}
+	}
+	return regions
+}
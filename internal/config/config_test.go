@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		billing BillingConfig
+		wantErr bool
+	}{
+		{name: "billing disabled", billing: BillingConfig{}},
+		{name: "billing with webhook secret", billing: BillingConfig{StripeSecretKey: "sk_test", StripeWebhookSecret: "whsec_test"}},
+		{name: "billing without webhook secret", billing: BillingConfig{StripeSecretKey: "sk_test"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Billing: tt.billing}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
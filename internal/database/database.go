@@ -1,30 +1,163 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"time"
+
+	"ai-chat-backend/internal/config"
 	"ai-chat-backend/internal/model"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func Init(dsn string) (*gorm.DB, error) {
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+// models 当前代码期望的全部表，自动迁移与表结构检查共用
+var models = []interface{}{
+	&model.User{},
+	&model.Conversation{},
+	&model.ConversationTag{},
+	&model.Message{},
+	&model.MessageArchive{},
+	&model.MessageFeedback{},
+	&model.UserConsent{},
+	&model.AuditLog{},
+	&model.Impersonation{},
+	&model.PromptAudit{},
+	&model.SecurityIncident{},
+	&model.GenerationTrace{},
+	&model.CanaryRollout{},
+	&model.PromptTemplate{},
+	&model.EmailChangeRequest{},
+	&model.VerificationCode{},
+	&model.RefreshToken{},
+	&model.OnboardingStep{},
+	&model.EmailDomainOverride{},
+	&model.AvatarGeneration{},
+	&model.UserIntegration{},
+	&model.OAuthState{},
+	&model.CalendarMutation{},
+	&model.SupportTicket{},
+	&model.SupportTicketEvent{},
+	&model.Activity{},
+	&model.Plan{},
+	&model.DailyUsage{},
+	&model.UsageRecord{},
+	&model.Subscription{},
+	&model.PromoCode{},
+	&model.PromoRedemption{},
+	&model.CreditTransaction{},
+	&model.UserAPIKey{},
+	&model.Organization{},
+	&model.OrganizationMember{},
+	&model.ModelEndpoint{},
+	&model.ConversationWebhook{},
+	&model.ConversationShare{},
+	&model.ShareVisit{},
+	&model.Attachment{},
+	&model.AttachmentVariant{},
+	&model.Collection{},
+	&model.Document{},
+	&model.DocumentChunk{},
+	&model.ConversationCollection{},
+	&model.ChannelLink{},
+	&model.MCPServer{},
+	&model.ConversationTool{},
+	&model.ToolInvocation{},
+	&model.Workflow{},
+	&model.WorkflowRun{},
+	&model.WorkflowStepRun{},
+	&model.Job{},
+	&model.EvalCase{},
+	&model.EvalRun{},
+	&model.EvalResult{},
+	&model.EvalReport{},
+}
+
+// Init 连接数据库。currentDSN不为nil时（启用Vault轮换DATABASE_DSN），每个新连接使用其返回的DSN中的密码
+func Init(cfg config.DatabaseConfig, currentDSN func() string) (*gorm.DB, error) {
+	dsnConfig, err := mysqldriver.ParseDSN(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if currentDSN != nil {
+		if err := dsnConfig.Apply(mysqldriver.BeforeConnect(refreshPassword(currentDSN))); err != nil {
+			return nil, err
+		}
+	}
+	connector, err := mysqldriver.NewConnector(dsnConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:      sql.OpenDB(connector),
+		DSNConfig: dsnConfig,
+	}), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// 时间统一以UTC写入，API返回带时区的RFC3339，由客户端按用户时区展示
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	// 自动迁移数据库表
-	err = db.AutoMigrate(
-		&model.User{},
-		&model.Conversation{},
-		&model.Message{},
-	)
-	if err != nil {
+	if cfg.AutoMigrate {
+		if err := db.AutoMigrate(models...); err != nil {
+			return nil, err
+		}
+		if err := backfill(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkSchema(db, cfg.SchemaCheck); err != nil {
+		return nil, err
+	}
+
+	// 长消息内容压缩保存，对服务层透明
+	if err := db.Use(model.ContentCompression{Threshold: cfg.CompressThreshold}); err != nil {
 		return nil, err
 	}
 
 	return db, nil
-}
\ No newline at end of file
+}
+
+// refreshPassword 建立新连接前重新读取DSN中的密码，数据库密码轮换后新连接即使用新密码，已有连接不受影响。
+// currentDSN返回空时沿用原密码
+func refreshPassword(currentDSN func() string) func(context.Context, *mysqldriver.Config) error {
+	return func(ctx context.Context, c *mysqldriver.Config) error {
+		dsn := currentDSN()
+		if dsn == "" {
+			return nil
+		}
+		current, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return err
+		}
+		c.Passwd = current.Passwd
+		return nil
+	}
+}
+
+// backfill 为迁移新增的列填充历史数据，可重复执行
+func backfill(db *gorm.DB) error {
+	// 新增last_message_at之前的会话以updated_at作为最后活跃时间
+	if err := db.Exec("UPDATE conversations SET last_message_at = updated_at WHERE last_message_at IS NULL").Error; err != nil {
+		return err
+	}
+	// 新增level之前创建的内置套餐按默认等级排列
+	if err := db.Exec("UPDATE plans SET level = CASE code WHEN ? THEN 10 WHEN ? THEN 20 ELSE level END WHERE level = 0",
+		model.PlanPro, model.PlanEnterprise).Error; err != nil {
+		return err
+	}
+	// 已有的支付和奖励流水补上幂等键，升级前的支付会话重复投递时不会再次入账；已重复的流水只保留第一条的键
+	return db.Exec("UPDATE IGNORE credit_transactions SET idempotency_key = CONCAT(type, ':', reference) "+
+		"WHERE idempotency_key IS NULL AND type IN ? AND reference <> '' ORDER BY id",
+		[]string{model.CreditPurchase, model.CreditReward}).Error
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+func TestRefreshPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		currentDSN string
+		want       string
+	}{
+		{name: "rotated password", currentDSN: "app:rotated@tcp(db:3306)/chat", want: "rotated"},
+		{name: "secret missing from vault keeps password", currentDSN: "", want: "initial"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := mysqldriver.ParseDSN("app:initial@tcp(db:3306)/chat")
+			if err != nil {
+				t.Fatalf("ParseDSN: %v", err)
+			}
+			hook := refreshPassword(func() string { return tt.currentDSN })
+			if err := hook(context.Background(), c); err != nil {
+				t.Fatalf("refreshPassword: %v", err)
+			}
+			if c.Passwd != tt.want {
+				t.Fatalf("Passwd = %q, want %q", c.Passwd, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SchemaCheckOff    = "off"
+	SchemaCheckWarn   = "warn"
+	SchemaCheckStrict = "strict"
+)
+
+// SchemaDrift 代码期望存在但数据库中缺失的表、列或索引
+type SchemaDrift struct {
+	Table string
+	Kind  string // table / column / index
+	Name  string
+}
+
+func (d SchemaDrift) String() string {
+	if d.Kind == "table" {
+		return fmt.Sprintf("missing table %s", d.Table)
+	}
+	return fmt.Sprintf("missing %s %s.%s", d.Kind, d.Table, d.Name)
+}
+
+// DiffSchema 对比模型期望的表结构与数据库实际结构。
+// 只检查缺失项：数据库中多出的表或列通常来自更新版本的迁移，对旧版本代码是兼容的
+func DiffSchema(db *gorm.DB) ([]SchemaDrift, error) {
+	var drifts []SchemaDrift
+	migrator := db.Migrator()
+
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, err
+		}
+		table := stmt.Schema.Table
+
+		if !migrator.HasTable(m) {
+			drifts = append(drifts, SchemaDrift{Table: table, Kind: "table"})
+			continue
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !migrator.HasColumn(m, field.DBName) {
+				drifts = append(drifts, SchemaDrift{Table: table, Kind: "column", Name: field.DBName})
+			}
+		}
+
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !migrator.HasIndex(m, index.Name) {
+				drifts = append(drifts, SchemaDrift{Table: table, Kind: "index", Name: index.Name})
+			}
+		}
+	}
+
+	return drifts, nil
+}
+
+// TableNames 当前代码的全部表名，顺序与迁移顺序相同
+func TableNames(db *gorm.DB) ([]string, error) {
+	tables := make([]string, 0, len(models))
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, err
+		}
+		tables = append(tables, stmt.Schema.Table)
+	}
+	return tables, nil
+}
+
+// checkSchema 按配置的模式执行启动检查：warn 只打印差异，strict 存在差异时拒绝启动
+func checkSchema(db *gorm.DB, mode string) error {
+	switch mode {
+	case "", SchemaCheckOff:
+		return nil
+	case SchemaCheckWarn, SchemaCheckStrict:
+	default:
+		return fmt.Errorf("unknown schema check mode %q", mode)
+	}
+
+	drifts, err := DiffSchema(db)
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		log.Println("Schema check passed")
+		return nil
+	}
+
+	items := make([]string, len(drifts))
+	for i, d := range drifts {
+		items[i] = d.String()
+		log.Printf("Schema drift: %s", items[i])
+	}
+	if mode == SchemaCheckStrict {
+		return fmt.Errorf("schema is not compatible with this version: %s", strings.Join(items, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package diagnostics
+
+import (
+	"net/http"
+
+	"ai-chat-backend/internal/metrics"
+)
+
+// StartMetrics 在独立的监听地址上开放 /metrics（Prometheus文本格式），不经过公网入口。
+// 与pprof一样不做认证，地址应只绑定本机或内网，公网可达时应改用带服务token的 /internal/v1/metrics
+func StartMetrics(addr string) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.WritePrometheus(w)
+	})
+	return serve("metrics", addr, mux)
+}
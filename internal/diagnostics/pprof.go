@@ -0,0 +1,51 @@
+package diagnostics
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// StartPprof 在独立的监听地址上开放 net/http/pprof。
+// pprof 不做认证，地址应只绑定本机（如 127.0.0.1:6060），通过SSH隧道或kubectl port-forward访问
+func StartPprof(addr string) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return serve("pprof", addr, mux)
+}
+
+// serve 在独立的监听地址上启动不做认证的诊断服务，地址不是本机时打印警告
+func serve(name, addr string, handler http.Handler) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		log.Printf("Warning: %s is listening on non-loopback address %s", name, addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s server stopped: %v", name, err)
+		}
+	}()
+
+	log.Printf("%s listening on %s", name, addr)
+	return server, nil
+}
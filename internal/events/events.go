@@ -0,0 +1,141 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// 领域事件类型
+const (
+	UserRegistered           = "user.registered"
+	UserEmailChangeRequested = "user.email_change_requested"
+	UserEmailChanged         = "user.email_changed"
+	UserEmailVerified        = "user.email_verified"
+	UserPasswordReset        = "user.password_reset"
+	UserPlanChanged          = "user.plan_changed"
+	UserProfileStepCompleted = "user.profile_step_completed"
+	UserProfileCompleted     = "user.profile_completed"
+	ConversationCreated      = "conversation.created"
+	ConversationRenamed      = "conversation.renamed"
+	ConversationDeleted      = "conversation.deleted"
+	ConversationArchived     = "conversation.archived"
+	ConversationMerged       = "conversation.merged"
+	MessageCreated           = "message.created"
+	MessageDeleted           = "message.deleted"
+	MessageRedacted          = "message.redacted"
+	AttachmentInfected       = "attachment.infected"
+	SupportTicketUpdated     = "support.ticket_updated"
+	SLOBreached              = "slo.first_token_breached"
+	SLORecovered             = "slo.first_token_recovered"
+	CanaryRolledBack         = "canary.rolled_back"
+
+	// 新手引导步骤完成及全部完成
+	UserOnboardingStepCompleted = "user.onboarding_step_completed"
+	UserOnboardingCompleted     = "user.onboarding_completed"
+)
+
+// All 订阅全部事件类型
+const All = "*"
+
+// Event 领域事件
+type Event struct {
+	Type       string      `json:"type"`
+	UserID     uint        `json:"user_id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Payload    interface{} `json:"payload"`
+}
+
+// New 创建事件
+func New(eventType string, userID uint, payload interface{}) Event {
+	return Event{
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: time.Now(),
+		Payload:    payload,
+	}
+}
+
+// Handler 事件处理函数
+type Handler func(ctx context.Context, event Event) error
+
+// Bus 事件总线，服务只负责发布事件，通知、审计、统计等通过订阅处理
+// 目前只有进程内实现 MemoryBus，KafkaSink 只单向写出分析事件，没有NATS适配器
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+	Subscribe(eventType string, handler Handler)
+	Close() error
+}
+
+// UserPayload user.registered 事件内容
+type UserPayload struct {
+	Email    string `json:"email"`
+	Nickname string `json:"nickname"`
+}
+
+// ProfilePayload user.profile_* 事件内容，Percent为完成后的资料完成度
+type ProfilePayload struct {
+	Step    string `json:"step,omitempty"`
+	Percent int    `json:"percent"`
+}
+
+// OnboardingPayload user.onboarding_* 事件内容，Percent为完成后的新手引导进度
+type OnboardingPayload struct {
+	Step    string `json:"step,omitempty"`
+	Percent int    `json:"percent"`
+}
+
+// AccountPayload 账号安全相关事件内容
+type AccountPayload struct {
+	IP     string `json:"ip"`
+	Detail string `json:"detail"`
+}
+
+// ConversationPayload conversation.* 事件内容
+type ConversationPayload struct {
+	ConversationID uint   `json:"conversation_id"`
+	Title          string `json:"title"`
+}
+
+// ConversationMergedPayload conversation.merged 事件内容，源会话同时发布conversation.deleted
+type ConversationMergedPayload struct {
+	ConversationID uint   `json:"conversation_id"`
+	Title          string `json:"title"`
+	SourceID       uint   `json:"source_id"`
+	MessageCount   int64  `json:"message_count"`
+}
+
+// MessagePayload message.created 事件内容
+type MessagePayload struct {
+	ConversationID    uint   `json:"conversation_id"`
+	ConversationTitle string `json:"conversation_title"`
+	MessageID         uint   `json:"message_id"`
+	Role              string `json:"role"`
+	ContentLength     int    `json:"content_length"`
+	// Preview 消息开头的片段，用于会话列表实时推送，不外发到分析管道
+	Preview string `json:"preview,omitempty"`
+}
+
+// SupportTicketPayload support.ticket_updated 事件内容
+type SupportTicketPayload struct {
+	TicketID uint   `json:"ticket_id"`
+	Subject  string `json:"subject"`
+	Status   string `json:"status"`
+	Note     string `json:"note,omitempty"`
+}
+
+// SLOPayload slo.* 事件内容，系统事件的UserID为0
+type SLOPayload struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	P95Ms      int64  `json:"p95_ms"`
+	TargetMs   int64  `json:"target_ms"`
+	Samples    int    `json:"samples"`
+	WindowSecs int64  `json:"window_seconds"`
+}
+
+// CanaryPayload canary.rolled_back 事件内容，自动回滚时UserID为0
+type CanaryPayload struct {
+	RolloutID uint   `json:"rollout_id"`
+	Model     string `json:"model"`
+	Reason    string `json:"reason"`
+}
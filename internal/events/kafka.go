@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// analyticsSchemaVersion 写入Kafka的事件结构版本，字段有不兼容变更时递增
+const analyticsSchemaVersion = 1
+
+// analyticsEventTypes 发送到分析管道的事件类型，账号安全类事件不外发
+var analyticsEventTypes = []string{
+	UserRegistered,
+	UserProfileStepCompleted,
+	UserProfileCompleted,
+	UserOnboardingStepCompleted,
+	UserOnboardingCompleted,
+	ConversationCreated,
+	ConversationDeleted,
+	ConversationArchived,
+	MessageCreated,
+}
+
+// AnalyticsRecord 写入Kafka的消息结构
+type AnalyticsRecord struct {
+	SchemaVersion int         `json:"schema_version"`
+	Type          string      `json:"type"`
+	UserID        uint        `json:"user_id"`
+	OccurredAt    time.Time   `json:"occurred_at"`
+	Payload       interface{} `json:"payload"`
+}
+
+// KafkaSink 订阅事件总线并将聊天事件写入Kafka主题，供数据团队构建分析管道而不访问业务库
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: 100 * time.Millisecond,
+			Async:        true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Printf("Failed to write %d analytics events to kafka: %v", len(messages), err)
+				}
+			},
+		},
+	}
+}
+
+// Subscribe 订阅需要外发的事件类型
+func (k *KafkaSink) Subscribe(bus Bus) {
+	for _, eventType := range analyticsEventTypes {
+		bus.Subscribe(eventType, k.Handle)
+	}
+}
+
+// Handle 将事件转换为分析记录写入Kafka，同一用户的事件写入同一分区以保证顺序
+func (k *KafkaSink) Handle(ctx context.Context, event Event) error {
+	record := AnalyticsRecord{
+		SchemaVersion: analyticsSchemaVersion,
+		Type:          event.Type,
+		UserID:        event.UserID,
+		OccurredAt:    event.OccurredAt.UTC(),
+		Payload:       analyticsPayload(event),
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(strconv.FormatUint(uint64(event.UserID), 10)),
+		Value: data,
+	})
+}
+
+// Close 刷新缓冲区并关闭连接
+func (k *KafkaSink) Close() error {
+	return k.writer.Close()
+}
+
+// analyticsPayload 去除事件中的个人信息
+func analyticsPayload(event Event) interface{} {
+	switch event.Type {
+	case UserRegistered:
+		return struct{}{}
+	case MessageCreated:
+		if payload, ok := event.Payload.(MessagePayload); ok {
+			payload.Preview = ""
+			return payload
+		}
+		return event.Payload
+	default:
+		return event.Payload
+	}
+}
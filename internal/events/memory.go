@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MemoryBus 进程内事件总线，每个订阅者在独立的goroutine中异步处理，不阻塞发布方
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	wg       sync.WaitGroup
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		handlers: make(map[string][]Handler),
+	}
+}
+
+func (b *MemoryBus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers[event.Type])+len(b.handlers[All]))
+	handlers = append(handlers, b.handlers[event.Type]...)
+	handlers = append(handlers, b.handlers[All]...)
+	b.mu.RUnlock()
+
+	// 订阅者的处理不应随请求取消而中断
+	ctx = context.WithoutCancel(ctx)
+	for _, handler := range handlers {
+		b.wg.Add(1)
+		go func(handler Handler) {
+			defer b.wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Event handler for %s panicked: %v", event.Type, r)
+				}
+			}()
+			if err := handler(ctx, event); err != nil {
+				log.Printf("Event handler for %s failed: %v", event.Type, err)
+			}
+		}(handler)
+	}
+	return nil
+}
+
+// Close 等待正在处理的事件完成
+func (b *MemoryBus) Close() error {
+	b.wg.Wait()
+	return nil
+}
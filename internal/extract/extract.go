@@ -0,0 +1,217 @@
+// Package extract 从上传的文件中提取文本，供知识库分块使用。纯文本直接读取，网页去掉标签后提取正文；PDF优先使用文本层（pdftotext），
+// 文本层缺失或乱码的页面以Tesseract识别，并将按列对齐的内容识别为表格。外部工具通过命令行调用
+package extract
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 提取方式
+const (
+	MethodText    = "text"     // 纯文本文件
+	MethodHTML    = "html"     // 网页正文
+	MethodPDFText = "pdf_text" // PDF文本层
+	MethodOCR     = "ocr"      // OCR识别
+	MethodMixed   = "mixed"    // 部分页面使用OCR
+	MethodEmpty   = "empty"    // 没有提取到文本
+)
+
+// 内容块类型
+const (
+	KindText  = "text"
+	KindTable = "table"
+)
+
+// maxGarbled 文本层中无法识别字符的比例超过该值时视为乱码（通常是字体缺少Unicode映射），改用OCR
+const maxGarbled = 0.2
+
+var (
+	ErrUnsupported = errors.New("extract: unsupported file type")
+	ErrNoText      = errors.New("extract: no text could be extracted")
+	ErrToolMissing = errors.New("extract: required tool is not installed")
+)
+
+// Config 外部工具和提取参数，工具路径为空时视为未安装
+type Config struct {
+	PDFToText string
+	PDFToPPM  string
+	Tesseract string
+	// Languages Tesseract语言，如eng+chi_sim
+	Languages string
+	// MinChars 文本层少于该字符数的页面改用OCR
+	MinChars int
+	// DPI OCR时渲染页面的分辨率
+	DPI int
+	// MaxPages 最多提取的页数，超出部分忽略
+	MaxPages int
+	Timeout  time.Duration
+}
+
+// Block 提取出的内容块，表格单独成块，分块时不在行中间拆开
+type Block struct {
+	Page int    `json:"page"`
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// PageReport 单页的提取情况
+type PageReport struct {
+	Page       int     `json:"page"`
+	Method     string  `json:"method"`
+	Chars      int     `json:"chars"`
+	Tables     int     `json:"tables,omitempty"`
+	Garbled    float64 `json:"garbled,omitempty"`    // 无法识别的字符比例
+	Confidence float64 `json:"confidence,omitempty"` // OCR平均置信度（0-100）
+}
+
+// Report 提取质量报告，Quality为0-1的综合评分（文本层按乱码比例，OCR页按置信度，空白页为0）
+type Report struct {
+	Method   string       `json:"method"`
+	Quality  float64      `json:"quality"`
+	Pages    []PageReport `json:"pages,omitempty"`
+	Warnings []string     `json:"warnings,omitempty"`
+}
+
+// OCRPages 使用OCR的页数
+func (r *Report) OCRPages() int {
+	n := 0
+	for _, page := range r.Pages {
+		if page.Method == MethodOCR {
+			n++
+		}
+	}
+	return n
+}
+
+// Tables 识别出的表格数
+func (r *Report) Tables() int {
+	n := 0
+	for _, page := range r.Pages {
+		n += page.Tables
+	}
+	return n
+}
+
+// Result 提取结果
+type Result struct {
+	Blocks []Block
+	Report
+}
+
+// Extractor 文本提取器
+type Extractor struct {
+	cfg Config
+}
+
+func New(cfg Config) *Extractor {
+	return &Extractor{cfg: cfg}
+}
+
+// Supported 是否为可提取的文件类型
+func Supported(contentType string) bool {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return contentType == "application/pdf" || isText(contentType) || isHTML(contentType)
+}
+
+func isText(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || contentType == "application/json"
+}
+
+// Extract 提取文本。没有提取到任何文本时返回ErrNoText，此时仍返回包含报告的结果
+func (e *Extractor) Extract(ctx context.Context, contentType string, data []byte) (*Result, error) {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	switch {
+	case contentType == "application/pdf":
+		return e.extractPDF(ctx, data)
+	case isHTML(contentType):
+		return extractHTML(data)
+	case isText(contentType):
+		return extractText(data)
+	}
+	return nil, ErrUnsupported
+}
+
+func extractText(data []byte) (*Result, error) {
+	text := strings.ToValidUTF8(string(data), "�")
+	garbled := garbledRatio(text)
+	result := &Result{Report: Report{
+		Method:  MethodText,
+		Quality: round(1 - garbled),
+		Pages:   []PageReport{{Page: 1, Method: MethodText, Chars: countChars(text), Garbled: round(garbled)}},
+	}}
+	if result.Pages[0].Chars == 0 {
+		result.Method = MethodEmpty
+		result.Quality = 0
+		return result, ErrNoText
+	}
+	result.Blocks = []Block{{Page: 1, Kind: KindText, Text: text}}
+	return result, nil
+}
+
+// run 执行外部命令并返回标准输出，失败时错误中包含标准错误的开头部分
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if name == "" {
+		return nil, ErrToolMissing
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrToolMissing, name)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(name), ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		return nil, fmt.Errorf("%s: %v: %s", filepath.Base(name), err, msg)
+	}
+	return out, nil
+}
+
+// countChars 非空白字符数
+func countChars(text string) int {
+	n := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// garbledRatio 非空白字符中替换字符、私有区字符和控制字符的比例，文本层字体缺少Unicode映射时这一比例很高
+func garbledRatio(text string) float64 {
+	total, bad := 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		if r == utf8.RuneError || unicode.Is(unicode.Co, r) || unicode.IsControl(r) {
+			bad++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total)
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,167 @@
+package extract
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// isHTML 网页内容，去掉标签后按正文提取
+func isHTML(contentType string) bool {
+	return contentType == "text/html" || contentType == "application/xhtml+xml"
+}
+
+// skippedElements 不含正文的元素，其中的内容整体跳过
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Iframe: true, atom.Nav: true,
+	atom.Footer: true, atom.Form: true,
+}
+
+// blockElements 块级元素，前后换行
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Header: true, atom.Aside: true, atom.Blockquote: true, atom.Pre: true,
+	atom.Ul: true, atom.Ol: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Table: true, atom.Tr: true, atom.Br: true, atom.Hr: true, atom.Figure: true,
+}
+
+// headingLevels 标题转换为Markdown标题，便于按章节分块
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// HTMLTitle 网页的<title>，没有时返回空
+func HTMLTitle(data []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if atom.Lookup(name) == atom.Title && z.Next() == html.TextToken {
+				return strings.Join(strings.Fields(string(z.Text())), " ")
+			}
+		}
+	}
+}
+
+// extractHTML 提取网页正文：跳过脚本、样式、导航等，块级元素换行，标题转换为Markdown标题，表格单元格以|分隔
+func extractHTML(data []byte) (*Result, error) {
+	var b strings.Builder
+	z := html.NewTokenizer(bytes.NewReader(data))
+	skip := 0
+	pre := 0
+	space := false
+	newline := func() {
+		text := b.String()
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+loop:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if skippedElements[a] {
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			if a == atom.Pre {
+				if tt == html.StartTagToken {
+					pre++
+				} else if tt == html.EndTagToken && pre > 0 {
+					pre--
+				}
+			}
+			switch {
+			case headingLevels[a] > 0:
+				newline()
+				if tt == html.StartTagToken {
+					b.WriteString("\n" + strings.Repeat("#", headingLevels[a]) + " ")
+				} else {
+					b.WriteByte('\n')
+				}
+			case a == atom.Li:
+				newline()
+				if tt == html.StartTagToken {
+					b.WriteString("- ")
+				}
+			case a == atom.Td || a == atom.Th:
+				if tt == html.StartTagToken {
+					b.WriteString(" | ")
+				}
+			case blockElements[a]:
+				newline()
+				if a == atom.P && tt == html.EndTagToken {
+					b.WriteByte('\n')
+				}
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			raw := html.UnescapeString(string(z.Text()))
+			if pre > 0 {
+				b.WriteString(raw)
+				continue
+			}
+			// 折叠空白，行内元素两侧原有空白时保留一个空格
+			text := strings.Join(strings.Fields(raw), " ")
+			if text == "" {
+				space = space || raw != ""
+				continue
+			}
+			if (space || unicode.IsSpace([]rune(raw)[0])) && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteByte(' ')
+			}
+			b.WriteString(text)
+			space = unicode.IsSpace([]rune(raw)[len([]rune(raw))-1])
+		}
+	}
+
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(b.String(), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "|"))
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	text := strings.Join(lines, "\n")
+
+	result := &Result{Report: Report{
+		Method:  MethodHTML,
+		Quality: 1,
+		Pages:   []PageReport{{Page: 1, Method: MethodHTML, Chars: countChars(text)}},
+	}}
+	if result.Pages[0].Chars == 0 {
+		result.Method = MethodEmpty
+		result.Quality = 0
+		return result, ErrNoText
+	}
+	result.Blocks = []Block{{Page: 1, Kind: KindText, Text: text}}
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OCR 识别图片中的文字，返回文本和平均置信度（0-100）。languages为空时使用配置的语言
+func (e *Extractor) OCR(ctx context.Context, image []byte, languages string) (string, float64, error) {
+	if e.cfg.Tesseract == "" {
+		return "", 0, ErrToolMissing
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "ocr-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "image")
+	if err := os.WriteFile(file, image, 0o600); err != nil {
+		return "", 0, err
+	}
+	return e.ocrFile(ctx, file, languages)
+}
+
+// ocrFile 以TSV格式输出识别结果，按块、段落和行还原文本，并计算单词的平均置信度
+func (e *Extractor) ocrFile(ctx context.Context, file, languages string) (string, float64, error) {
+	if languages == "" {
+		languages = e.cfg.Languages
+	}
+	args := []string{file, "stdout"}
+	if languages != "" {
+		args = append(args, "-l", languages)
+	}
+	out, err := run(ctx, e.cfg.Tesseract, append(args, "tsv")...)
+	if err != nil {
+		return "", 0, err
+	}
+	text, confidence := parseTSV(string(out))
+	return text, confidence, nil
+}
+
+// parseTSV 解析tesseract的TSV输出：level page_num block_num par_num line_num word_num left top width height conf text，
+// 只有level为5的行是单词
+func parseTSV(out string) (string, float64) {
+	var b strings.Builder
+	var lastLine, lastPar string
+	var total float64
+	words := 0
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) < 12 || fields[0] != "5" {
+			continue
+		}
+		word := strings.TrimSpace(fields[11])
+		conf, err := strconv.ParseFloat(fields[10], 64)
+		if word == "" || err != nil || conf < 0 {
+			continue
+		}
+
+		par := fmt.Sprintf("%s/%s/%s", fields[1], fields[2], fields[3])
+		lineKey := par + "/" + fields[4]
+		switch {
+		case b.Len() == 0:
+		case par != lastPar:
+			b.WriteString("\n\n")
+		case lineKey != lastLine:
+			b.WriteString("\n")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(word)
+		lastPar, lastLine = par, lineKey
+		total += conf
+		words++
+	}
+	if words == 0 {
+		return "", 0
+	}
+	return b.String(), round(total / float64(words))
+}
+
+// tesseractLanguages BCP 47语言标签（小写）对应的tesseract语言包
+var tesseractLanguages = map[string]string{
+	"en":      "eng",
+	"zh":      "chi_sim",
+	"zh-cn":   "chi_sim",
+	"zh-sg":   "chi_sim",
+	"zh-hans": "chi_sim",
+	"zh-tw":   "chi_tra",
+	"zh-hk":   "chi_tra",
+	"zh-mo":   "chi_tra",
+	"zh-hant": "chi_tra",
+	"ja":      "jpn",
+	"ko":      "kor",
+	"fr":      "fra",
+	"de":      "deu",
+	"es":      "spa",
+	"it":      "ita",
+	"pt":      "por",
+	"ru":      "rus",
+	"ar":      "ara",
+	"vi":      "vie",
+}
+
+// LanguageHint 将用户的语言标签（如zh-Hant-TW）转换为tesseract的语言参数，依次尝试完整标签、前两段和基本语言。
+// 非英语时附加英语，截图中常夹杂英文。无法识别时返回空字符串，使用配置的语言
+func LanguageHint(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	parts := strings.Split(tag, "-")
+	candidates := []string{tag, parts[0]}
+	if len(parts) > 2 {
+		candidates = []string{tag, parts[0] + "-" + parts[1], parts[0]}
+	}
+	for _, candidate := range candidates {
+		language, ok := tesseractLanguages[candidate]
+		if !ok {
+			continue
+		}
+		if language != "eng" {
+			language += "+eng"
+		}
+		return language
+	}
+	return ""
+}
@@ -0,0 +1,287 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 表格识别参数：至少minTableRows行连续按列对齐的文本，且单元格平均长度不超过maxCellLength
+// （双栏排版的正文也按列对齐，但每栏很长）
+const (
+	minTableRows  = 3
+	maxCellLength = 40
+)
+
+// columnGap 版式模式下列之间至少两个空格
+var columnGap = regexp.MustCompile(` {2,}`)
+
+// extractPDF 逐页提取：文本层字符过少或乱码的页面以OCR识别，按版式输出识别表格
+func (e *Extractor) extractPDF(ctx context.Context, data []byte) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "extract-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	// 阅读顺序的文本用于正文，版式文本用于识别表格
+	raw, err := e.pdfToText(ctx, file, false)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := e.pdfToText(ctx, file, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(layout) != len(raw) {
+		raw = layout
+	}
+
+	result := &Result{}
+	if e.cfg.MaxPages > 0 && len(raw) > e.cfg.MaxPages {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("only the first %d of %d pages were extracted", e.cfg.MaxPages, len(raw)))
+		raw, layout = raw[:e.cfg.MaxPages], layout[:e.cfg.MaxPages]
+	}
+
+	var score float64
+	ocrMissing := false
+	for i := range raw {
+		page := i + 1
+		report := PageReport{Page: page, Method: MethodPDFText}
+		text, tableSource := raw[i], layout[i]
+		garbled := garbledRatio(text)
+
+		if countChars(text) < e.cfg.MinChars || garbled > maxGarbled {
+			ocrText, confidence, err := e.ocrPage(ctx, dir, file, page)
+			switch {
+			case errors.Is(err, ErrToolMissing):
+				ocrMissing = true
+			case err != nil:
+				result.Warnings = append(result.Warnings, fmt.Sprintf("page %d: OCR failed: %v", page, err))
+			case countChars(ocrText) > countChars(text) || (garbled > maxGarbled && countChars(ocrText) > 0):
+				text, tableSource = ocrText, ocrText
+				garbled = garbledRatio(ocrText)
+				report.Method = MethodOCR
+				report.Confidence = confidence
+			}
+		}
+
+		blocks, tables := pageBlocks(page, text, tableSource)
+		report.Chars = countChars(text)
+		report.Tables = tables
+		report.Garbled = round(garbled)
+		switch {
+		case report.Chars == 0:
+			report.Method = MethodEmpty
+			result.Warnings = append(result.Warnings, fmt.Sprintf("page %d: no text found", page))
+		case report.Method == MethodOCR:
+			score += report.Confidence / 100 * (1 - garbled)
+			if report.Confidence < 60 {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("page %d: low OCR confidence (%.0f)", page, report.Confidence))
+			}
+		default:
+			score += 1 - garbled
+			if garbled > maxGarbled {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("page %d: text layer looks garbled (%.0f%% unreadable characters)", page, garbled*100))
+			}
+		}
+		result.Pages = append(result.Pages, report)
+		result.Blocks = append(result.Blocks, blocks...)
+	}
+	if ocrMissing {
+		result.Warnings = append(result.Warnings, "some pages have no usable text layer and OCR is not available")
+	}
+	if len(result.Pages) > 0 {
+		result.Quality = round(score / float64(len(result.Pages)))
+	}
+	result.Method = overallMethod(result.Pages)
+	if result.Method == MethodEmpty {
+		return result, ErrNoText
+	}
+	return result, nil
+}
+
+// pdfToText 输出UTF-8文本，pdftotext在每页之后输出换页符
+func (e *Extractor) pdfToText(ctx context.Context, file string, layout bool) ([]string, error) {
+	args := []string{"-enc", "UTF-8", file, "-"}
+	if layout {
+		args = append([]string{"-layout"}, args...)
+	}
+	out, err := run(ctx, e.cfg.PDFToText, args...)
+	if err != nil {
+		return nil, err
+	}
+	pages := strings.Split(string(out), "\f")
+	if len(pages) > 1 && strings.TrimSpace(pages[len(pages)-1]) == "" {
+		pages = pages[:len(pages)-1]
+	}
+	return pages, nil
+}
+
+// ocrPage 将单页渲染为灰度PNG后识别
+func (e *Extractor) ocrPage(ctx context.Context, dir, file string, page int) (string, float64, error) {
+	if e.cfg.PDFToPPM == "" || e.cfg.Tesseract == "" {
+		return "", 0, ErrToolMissing
+	}
+	n := strconv.Itoa(page)
+	prefix := filepath.Join(dir, "page")
+	if _, err := run(ctx, e.cfg.PDFToPPM, "-f", n, "-l", n, "-r", strconv.Itoa(e.cfg.DPI), "-gray", "-png", "-singlefile", file, prefix); err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(prefix + ".png")
+	return e.ocrFile(ctx, prefix+".png", "")
+}
+
+// pageBlocks 将页面切分为正文块和表格块。页面包含表格时按版式文本输出以保持表格与正文的相对位置
+func pageBlocks(page int, text, layout string) ([]Block, int) {
+	segments := splitTables(layout)
+	tables := 0
+	for _, segment := range segments {
+		if segment.Kind == KindTable {
+			tables++
+		}
+	}
+	if tables == 0 {
+		if strings.TrimSpace(text) == "" {
+			return nil, 0
+		}
+		return []Block{{Page: page, Kind: KindText, Text: strings.TrimSpace(text)}}, 0
+	}
+
+	var blocks []Block
+	for _, segment := range segments {
+		if segment.Kind == KindText {
+			segment.Text = collapseSpaces(segment.Text)
+		}
+		if strings.TrimSpace(segment.Text) == "" {
+			continue
+		}
+		segment.Page = page
+		blocks = append(blocks, segment)
+	}
+	return blocks, tables
+}
+
+// splitTables 找出连续按列对齐的行并转换为Markdown表格，其余部分作为正文
+func splitTables(layout string) []Block {
+	lines := strings.Split(layout, "\n")
+	var blocks []Block
+	var text []string
+	flush := func() {
+		if len(text) > 0 {
+			blocks = append(blocks, Block{Kind: KindText, Text: strings.Join(text, "\n")})
+			text = nil
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		j := i
+		var rows [][]string
+		for j < len(lines) {
+			cells := columnGap.Split(strings.TrimSpace(lines[j]), -1)
+			if len(cells) < 2 {
+				break
+			}
+			rows = append(rows, cells)
+			j++
+		}
+		if isTable(rows) {
+			flush()
+			blocks = append(blocks, Block{Kind: KindTable, Text: markdownTable(rows)})
+			i = j
+			continue
+		}
+		if j == i {
+			j = i + 1
+		}
+		text = append(text, lines[i:j]...)
+		i = j
+	}
+	flush()
+	return blocks
+}
+
+// isTable 行数足够、多数行的列数相同且单元格较短时视为表格
+func isTable(rows [][]string) bool {
+	if len(rows) < minTableRows {
+		return false
+	}
+	counts := make(map[int]int)
+	cells, length := 0, 0
+	for _, row := range rows {
+		counts[len(row)]++
+		for _, cell := range row {
+			cells++
+			length += utf8.RuneCountInString(cell)
+		}
+	}
+	best := 0
+	for _, count := range counts {
+		best = max(best, count)
+	}
+	return best*3 >= len(rows)*2 && length/cells <= maxCellLength
+}
+
+// markdownTable 以第一行为表头，列数取最多的一行，不足的补空
+func markdownTable(rows [][]string) string {
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		b.WriteString("|")
+		for c := 0; c < columns; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = strings.ReplaceAll(row[c], "|", "\\|")
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// collapseSpaces 去掉版式文本中用于对齐的多余空格
+func collapseSpaces(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = columnGap.ReplaceAllString(strings.TrimSpace(line), " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func overallMethod(pages []PageReport) string {
+	methods := make(map[string]bool)
+	for _, page := range pages {
+		if page.Method != MethodEmpty {
+			methods[page.Method] = true
+		}
+	}
+	switch {
+	case len(methods) == 0:
+		return MethodEmpty
+	case len(methods) > 1:
+		return MethodMixed
+	case methods[MethodOCR]:
+		return MethodOCR
+	}
+	return MethodPDFText
+}
@@ -0,0 +1,232 @@
+package gcal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	authURL     = "https://accounts.google.com/o/oauth2/v2/auth"
+	tokenURL    = "https://oauth2.googleapis.com/token"
+	revokeURL   = "https://oauth2.googleapis.com/revoke"
+	calendarAPI = "https://www.googleapis.com/calendar/v3/calendars/primary/events"
+)
+
+// 授权范围：只读，或读写日程（不含日历本身的管理）
+const (
+	ScopeReadOnly = "https://www.googleapis.com/auth/calendar.readonly"
+	ScopeEvents   = "https://www.googleapis.com/auth/calendar.events"
+)
+
+// ErrUnauthorized 授权已失效（用户撤销了授权或刷新令牌过期），需要重新授权
+var ErrUnauthorized = errors.New("google calendar authorization is no longer valid")
+
+// Client Google OAuth和Calendar API的最小封装，只操作用户的主日历
+type Client struct {
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+}
+
+func NewClient(clientID, clientSecret string) *Client {
+	return &Client{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// AuthURL 用户授权页面地址，请求离线访问以获得刷新令牌
+func (c *Client) AuthURL(redirectURI, state, scope string) string {
+	query := url.Values{
+		"client_id":     {c.clientID},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {scope},
+		"access_type":   {"offline"},
+		"prompt":        {"consent"},
+		"state":         {state},
+	}
+	return authURL + "?" + query.Encode()
+}
+
+// Token 访问令牌，Scope为用户实际授予的范围（空格分隔），刷新时RefreshToken可能为空
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	Scope        string
+	ExpiresAt    time.Time
+}
+
+// ExchangeCode 用授权码换取令牌
+func (c *Client) ExchangeCode(ctx context.Context, code, redirectURI string) (*Token, error) {
+	return c.token(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURI},
+	})
+}
+
+// Refresh 用刷新令牌换取新的访问令牌
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	return c.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// Revoke 撤销令牌，刷新令牌撤销后对应的访问令牌同时失效
+func (c *Client) Revoke(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revokeURL,
+		strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("google revoke request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// 令牌已失效时返回400，同样视为已撤销
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("google revoke error (%d)", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *Client) token(ctx context.Context, form url.Values) (*Token, error) {
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("google token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		Scope            string `json:"scope"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("google token error (%d): %w", resp.StatusCode, err)
+	}
+	// invalid_grant表示授权码无效或刷新令牌已被撤销
+	if result.Error == "invalid_grant" {
+		return nil, ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("google token error (%d): %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	return &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		Scope:        result.Scope,
+		ExpiresAt:    time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// EventTime 日程时间，全天日程只有Date（YYYY-MM-DD）
+type EventTime struct {
+	DateTime string `json:"dateTime,omitempty"`
+	Date     string `json:"date,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Event 日程，只包含助手需要的字段
+type Event struct {
+	ID          string    `json:"id,omitempty"`
+	Summary     string    `json:"summary"`
+	Description string    `json:"description,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Start       EventTime `json:"start"`
+	End         EventTime `json:"end"`
+	HTMLLink    string    `json:"htmlLink,omitempty"`
+}
+
+// ListEvents 按开始时间顺序列出时间范围内的日程，重复日程展开为单次
+func (c *Client) ListEvents(ctx context.Context, accessToken string, timeMin, timeMax time.Time, maxResults int) ([]Event, error) {
+	query := url.Values{
+		"timeMin":      {timeMin.Format(time.RFC3339)},
+		"timeMax":      {timeMax.Format(time.RFC3339)},
+		"singleEvents": {"true"},
+		"orderBy":      {"startTime"},
+		"maxResults":   {strconv.Itoa(maxResults)},
+	}
+	var result struct {
+		Items []Event `json:"items"`
+	}
+	if err := c.call(ctx, http.MethodGet, calendarAPI+"?"+query.Encode(), accessToken, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// CreateEvent 在主日历中创建日程，返回创建后的日程
+func (c *Client) CreateEvent(ctx context.Context, accessToken string, event *Event) (*Event, error) {
+	var created Event
+	if err := c.call(ctx, http.MethodPost, calendarAPI, accessToken, event, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) call(ctx context.Context, method, endpoint, accessToken string, params interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if params != nil {
+		if err := json.NewEncoder(&body).Encode(params); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("google calendar request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		if result.Error != nil {
+			return fmt.Errorf("google calendar error (%d): %s", resp.StatusCode, result.Error.Message)
+		}
+		return fmt.Errorf("google calendar error (%d)", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,191 @@
+package gdocs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	authURL   = "https://accounts.google.com/o/oauth2/v2/auth"
+	tokenURL  = "https://oauth2.googleapis.com/token"
+	uploadURL = "https://www.googleapis.com/upload/drive/v3/files?uploadType=multipart&fields=id,webViewLink"
+	// scope 只能访问本应用创建的文件
+	scope = "https://www.googleapis.com/auth/drive.file"
+)
+
+// ErrUnauthorized 授权已失效（用户撤销了授权或刷新令牌过期），需要重新授权
+var ErrUnauthorized = errors.New("google authorization is no longer valid")
+
+// Client Google OAuth和Drive API的最小封装，只包含授权、刷新令牌和创建文档
+type Client struct {
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+}
+
+func NewClient(clientID, clientSecret string) *Client {
+	return &Client{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// AuthURL 用户授权页面地址，请求离线访问以获得刷新令牌
+func (c *Client) AuthURL(redirectURI, state string) string {
+	query := url.Values{
+		"client_id":     {c.clientID},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {scope},
+		"access_type":   {"offline"},
+		"prompt":        {"consent"},
+		"state":         {state},
+	}
+	return authURL + "?" + query.Encode()
+}
+
+// Token 访问令牌，刷新时RefreshToken可能为空
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// ExchangeCode 用授权码换取令牌
+func (c *Client) ExchangeCode(ctx context.Context, code, redirectURI string) (*Token, error) {
+	return c.token(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURI},
+	})
+}
+
+// Refresh 用刷新令牌换取新的访问令牌
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	return c.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+func (c *Client) token(ctx context.Context, form url.Values) (*Token, error) {
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("google token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("google token error (%d): %w", resp.StatusCode, err)
+	}
+	// invalid_grant表示授权码无效或刷新令牌已被撤销
+	if result.Error == "invalid_grant" {
+		return nil, ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("google token error (%d): %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	return &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// CreateDocument 上传markdown并由Drive转换为Google文档，folderID为空时放在根目录，返回文档地址
+func (c *Client) CreateDocument(ctx context.Context, accessToken, folderID, title, markdown string) (string, error) {
+	metadata := map[string]interface{}{
+		"name":     title,
+		"mimeType": "application/vnd.google-apps.document",
+	}
+	if folderID != "" {
+		metadata["parents"] = []string{folderID}
+	}
+	meta, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{"application/json; charset=UTF-8", meta},
+		{"text/markdown; charset=UTF-8", []byte(markdown)},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+writer.Boundary())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("google drive request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", ErrUnauthorized
+	}
+	var result struct {
+		ID          string `json:"id"`
+		WebViewLink string `json:"webViewLink"`
+		Error       *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("google drive error (%d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != nil {
+			return "", fmt.Errorf("google drive error (%d): %s", resp.StatusCode, result.Error.Message)
+		}
+		return "", fmt.Errorf("google drive error (%d)", resp.StatusCode)
+	}
+	if result.WebViewLink == "" {
+		result.WebViewLink = "https://docs.google.com/document/d/" + result.ID + "/edit"
+	}
+	return result.WebViewLink, nil
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"context"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type ActivityHandler struct {
+	activityService *service.ActivityService
+}
+
+func NewActivityHandler(activityService *service.ActivityService) *ActivityHandler {
+	return &ActivityHandler{
+		activityService: activityService,
+	}
+}
+
+// GetActivities 获取用户动态
+func (h *ActivityHandler) GetActivities(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	activities, total, err := h.activityService.GetActivities(userID.(uint), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, activities, total, page, pageSize)
+}
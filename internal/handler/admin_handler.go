@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ai-chat-backend/internal/metrics"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+const auditActionReadOnly = "system.read_only"
+
+type AdminHandler struct {
+	systemService      *service.SystemService
+	auditService       *service.AuditService
+	counterService     *service.CounterService
+	diagnosticsService *service.DiagnosticsService
+	sloService         *service.SLOService
+	validator          *validator.Validate
+}
+
+func NewAdminHandler(systemService *service.SystemService, auditService *service.AuditService, counterService *service.CounterService, diagnosticsService *service.DiagnosticsService, sloService *service.SLOService) *AdminHandler {
+	return &AdminHandler{
+		systemService:      systemService,
+		auditService:       auditService,
+		counterService:     counterService,
+		diagnosticsService: diagnosticsService,
+		sloService:         sloService,
+		validator:          validator.New(),
+	}
+}
+
+// GetReadOnly 获取只读模式状态
+func (h *AdminHandler) GetReadOnly(ctx context.Context, c *app.RequestContext) {
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Read-only status retrieved successfully",
+		Data:    h.systemService.ReadOnlyStatus(),
+	})
+}
+
+// SetReadOnly 开启或关闭只读模式，可由管理员或内部服务调用
+func (h *AdminHandler) SetReadOnly(ctx context.Context, c *app.RequestContext) {
+	userID, isUser := c.Get("user_id")
+	serviceName, isService := c.Get("service_name")
+	if !isUser && !isService {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.SetReadOnlyRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	// 内部服务调用时操作人记为0，服务名写入审计详情
+	actorID, _ := userID.(uint)
+	status := h.systemService.SetReadOnly(actorID, *req.Enabled, req.Reason)
+	detail := fmt.Sprintf("enabled=%t reason=%s", status.Enabled, status.Reason)
+	if isService {
+		detail += fmt.Sprintf(" service=%s", serviceName)
+	}
+	h.auditService.Record(actorID, auditActionReadOnly, c.ClientIP(), detail)
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Read-only status updated successfully",
+		Data:    status,
+	})
+}
+
+// ReconcileCounters 立即校正所有用户的会话/消息计数
+func (h *AdminHandler) ReconcileCounters(ctx context.Context, c *app.RequestContext) {
+	corrected, err := h.counterService.Reconcile()
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Counters reconciled successfully",
+		Data:    map[string]int64{"corrected": corrected},
+	})
+}
+
+// ValidationReport 按接口、字段和规则统计的参数校验失败排行
+func (h *AdminHandler) ValidationReport(ctx context.Context, c *app.RequestContext) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	samples := metrics.ValidationFailures.Snapshot()
+	var total uint64
+	for _, sample := range samples {
+		total += sample.Value
+	}
+	if len(samples) > limit {
+		samples = samples[:limit]
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Validation report retrieved successfully",
+		Data: map[string]interface{}{
+			"total":    total,
+			"failures": samples,
+		},
+	})
+}
+
+// DebugStats 获取运行时诊断信息
+func (h *AdminHandler) DebugStats(ctx context.Context, c *app.RequestContext) {
+	stats, err := h.diagnosticsService.Stats()
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Debug stats retrieved successfully",
+		Data:    stats,
+	})
+}
+
+// FirstTokenSLO 获取各模型的首token延迟和SLO状态，warnings为当前超标的模型（管理员）
+func (h *AdminHandler) FirstTokenSLO(ctx context.Context, c *app.RequestContext) {
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "SLO report retrieved successfully",
+		Data:    h.sloService.Report(),
+	})
+}
+
+// ListPromptAudits 获取模型调用审计记录，可按user_id、conversation_id过滤（需开启CHAT_PROMPT_AUDIT）
+func (h *AdminHandler) ListPromptAudits(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	var userID, conversationID uint64
+	if value := c.Query("user_id"); value != "" {
+		var err error
+		if userID, err = strconv.ParseUint(value, 10, 32); err != nil {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+	}
+	if value := c.Query("conversation_id"); value != "" {
+		var err error
+		if conversationID, err = strconv.ParseUint(value, 10, 32); err != nil {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+			return
+		}
+	}
+
+	audits, total, err := h.auditService.ListPromptAudits(uint(userID), uint(conversationID), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, audits, total, page, pageSize)
+}
+
+// GetGenerationTrace 按追踪ID获取一次回复的生成过程（需开启CHAT_GENERATION_TRACES）
+func (h *AdminHandler) GetGenerationTrace(ctx context.Context, c *app.RequestContext) {
+	trace, err := h.auditService.GetGenerationTrace(c.Param("id"))
+	if err != nil {
+		c.JSON(adminErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Generation trace retrieved successfully",
+		Data:    trace,
+	})
+}
+
+// ListSecurityIncidents 获取疑似提示词注入/越狱的安全事件（管理员），可按user_id、severity、source过滤
+func (h *AdminHandler) ListSecurityIncidents(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	filter := service.SecurityIncidentFilter{
+		Severity: c.Query("severity"),
+		Source:   c.Query("source"),
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+		filter.UserID = uint(userID)
+	}
+
+	incidents, total, err := h.auditService.ListSecurityIncidents(filter, page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, incidents, total, page, pageSize)
+}
+
+// SecurityIncidentSummary 汇总最近days天（默认7，最多90）的安全事件（管理员）
+func (h *AdminHandler) SecurityIncidentSummary(ctx context.Context, c *app.RequestContext) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > 90 {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "days must be between 1 and 90"})
+		return
+	}
+
+	summary, err := h.auditService.SummarizeSecurityIncidents(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Security incident summary retrieved successfully",
+		Data:    summary,
+	})
+}
+
+func adminErrorStatus(err error) int {
+	if errors.Is(err, service.ErrGenerationTraceNotFound) {
+		return consts.StatusNotFound
+	}
+	return consts.StatusInternalServerError
+}
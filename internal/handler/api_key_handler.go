@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+	validator     *validator.Validate
+}
+
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		validator:     validator.New(),
+	}
+}
+
+// GetAPIKey 获取自带Key的配置和用量（不返回Key本身）
+func (h *APIKeyHandler) GetAPIKey(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	key, err := h.apiKeyService.Get(userID.(uint))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "API key retrieved successfully",
+		Data:    key,
+	})
+}
+
+// SetAPIKey 校验并保存自带Key
+func (h *APIKeyHandler) SetAPIKey(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.SetAPIKeyRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	key, err := h.apiKeyService.Set(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "API key saved successfully",
+		Data:    key,
+	})
+}
+
+// DeleteAPIKey 删除自带Key
+func (h *APIKeyHandler) DeleteAPIKey(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	if err := h.apiKeyService.Delete(userID.(uint)); err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "API key deleted successfully",
+	})
+}
+
+// ValidateAPIKey 重新校验已保存的自带Key
+func (h *APIKeyHandler) ValidateAPIKey(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	key, err := h.apiKeyService.Validate(ctx, userID.(uint))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "API key is valid",
+		Data:    key,
+	})
+}
+
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrBYOKDisabled):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrAPIKeyInvalid), errors.Is(err, service.ErrEndpointURL):
+		return consts.StatusBadRequest
+	}
+	return consts.StatusInternalServerError
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type AttachmentHandler struct {
+	attachmentService *service.AttachmentService
+	maxSize           int64
+}
+
+func NewAttachmentHandler(attachmentService *service.AttachmentService, maxSize int64) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentService: attachmentService,
+		maxSize:           maxSize,
+	}
+}
+
+// Upload 上传文件（multipart字段file，可选conversation_id），需要扫描时返回202
+func (h *AttachmentHandler) Upload(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "File is required"})
+		return
+	}
+	if header.Size > h.maxSize {
+		c.JSON(consts.StatusRequestEntityTooLarge, ErrorResponse{Error: service.ErrAttachmentTooLarge.Error()})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, h.maxSize+1))
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	req := service.UploadRequest{
+		Filename:    header.Filename,
+		ContentType: header.Header.Get("Content-Type"),
+		Data:        data,
+		IP:          c.ClientIP(),
+	}
+	if raw := c.PostForm("conversation_id"); raw != "" {
+		conversationID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+			return
+		}
+		id := uint(conversationID)
+		req.ConversationID = &id
+	}
+
+	attachment, err := h.attachmentService.Upload(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(attachmentErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	status := consts.StatusCreated
+	if attachment.ScanStatus == model.ScanPending {
+		status = consts.StatusAccepted
+	}
+	c.JSON(status, SuccessResponse{
+		Message: "File uploaded successfully",
+		Data:    attachment,
+	})
+}
+
+// GetAttachment 获取附件信息（含扫描状态）
+func (h *AttachmentHandler) GetAttachment(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid attachment ID"})
+		return
+	}
+
+	attachment, err := h.attachmentService.Get(userID.(uint), uint(attachmentID))
+	if err != nil {
+		c.JSON(attachmentErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Attachment retrieved successfully",
+		Data:    attachment,
+	})
+}
+
+// Download 下载附件（?variant=thumb_256下载缩略图），存储支持时重定向到限时下载地址
+func (h *AttachmentHandler) Download(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid attachment ID"})
+		return
+	}
+
+	file, err := h.attachmentService.Download(ctx, userID.(uint), uint(attachmentID), c.Query("variant"))
+	if err != nil {
+		c.JSON(attachmentErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if file.URL != "" {
+		c.Redirect(consts.StatusFound, []byte(file.URL))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(consts.StatusOK, file.ContentType, file.Data)
+}
+
+// DeleteAttachment 删除附件
+func (h *AttachmentHandler) DeleteAttachment(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid attachment ID"})
+		return
+	}
+
+	if err := h.attachmentService.Delete(userID.(uint), uint(attachmentID)); err != nil {
+		c.JSON(attachmentErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Attachment deleted successfully",
+	})
+}
+
+func attachmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAttachmentUnavailable):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrAttachmentNotFound), errors.Is(err, service.ErrConversationNotFound),
+		errors.Is(err, service.ErrVariantNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrAttachmentTooLarge):
+		return consts.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrAttachmentEmpty):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrAttachmentPending):
+		return consts.StatusConflict
+	case errors.Is(err, service.ErrAttachmentInfected):
+		return consts.StatusUnprocessableEntity
+	}
+	return consts.StatusInternalServerError
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type AvatarHandler struct {
+	avatarService *service.AvatarService
+	validator     *validator.Validate
+}
+
+func NewAvatarHandler(avatarService *service.AvatarService) *AvatarHandler {
+	return &AvatarHandler{
+		avatarService: avatarService,
+		validator:     validator.New(),
+	}
+}
+
+// Generate 按描述生成头像并设为用户头像
+func (h *AvatarHandler) Generate(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.GenerateAvatarRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	result, err := h.avatarService.Generate(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(avatarErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Avatar generated successfully",
+		Data:    result,
+	})
+}
+
+// Get 获取生成的头像图片（公开访问，文件名为随机串）
+func (h *AvatarHandler) Get(ctx context.Context, c *app.RequestContext) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusNotFound, ErrorResponse{Error: service.ErrAvatarNotFound.Error()})
+		return
+	}
+
+	// 存储支持时重定向到限时下载地址，由存储直接返回图片
+	url, err := h.avatarService.DownloadURL(uint(userID), c.Param("name"))
+	if err != nil {
+		c.JSON(avatarErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+	if url != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(consts.StatusFound, []byte(url))
+		return
+	}
+
+	data, contentType, err := h.avatarService.Get(ctx, uint(userID), c.Param("name"))
+	if err != nil {
+		c.JSON(avatarErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 每次生成的文件名都不同，内容不会变化
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(consts.StatusOK, contentType, data)
+}
+
+func avatarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAvatarUnavailable), errors.Is(err, service.ErrRegionUnavailable):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrAvatarQuotaExceeded):
+		return consts.StatusTooManyRequests
+	case errors.Is(err, service.ErrAvatarNotFound):
+		return consts.StatusNotFound
+	default:
+		return consts.StatusInternalServerError
+	}
+}
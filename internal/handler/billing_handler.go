@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"ai-chat-backend/internal/billing"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type BillingHandler struct {
+	billingService *service.BillingService
+	validator      *validator.Validate
+}
+
+func NewBillingHandler(billingService *service.BillingService) *BillingHandler {
+	return &BillingHandler{
+		billingService: billingService,
+		validator:      validator.New(),
+	}
+}
+
+// Checkout 创建订阅结账会话
+func (h *BillingHandler) Checkout(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CheckoutRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	url, err := h.billingService.CreateCheckout(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(billingErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Checkout session created successfully",
+		Data:    map[string]string{"url": url},
+	})
+}
+
+// CreditCheckout 创建额度包购买结账会话
+func (h *BillingHandler) CreditCheckout(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreditCheckoutRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	url, err := h.billingService.CreateCreditCheckout(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(billingErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Checkout session created successfully",
+		Data:    map[string]string{"url": url},
+	})
+}
+
+// GetInvoices 获取用户发票
+func (h *BillingHandler) GetInvoices(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	invoices, err := h.billingService.GetInvoices(ctx, userID.(uint))
+	if err != nil {
+		c.JSON(billingErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Invoices retrieved successfully",
+		Data:    invoices,
+	})
+}
+
+// Webhook 接收Stripe webhook，处理失败返回5xx由Stripe重试
+func (h *BillingHandler) Webhook(ctx context.Context, c *app.RequestContext) {
+	err := h.billingService.HandleWebhook(c.Request.Body(), string(c.GetHeader("Stripe-Signature")))
+	if err != nil {
+		if errors.Is(err, billing.ErrInvalidSignature) {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		log.Printf("Failed to handle billing webhook: %v", err)
+		c.JSON(billingErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "ok"})
+}
+
+func billingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrBillingDisabled):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrPlanNotForSale):
+		return consts.StatusBadRequest
+	}
+	return consts.StatusInternalServerError
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"errors"
+
+	"ai-chat-backend/internal/metrics"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+// bindAndValidate 绑定并校验请求参数，失败时返回400并按接口、字段和规则记录校验失败指标。
+// 所有处理器都应通过该函数校验请求，以保证指标完整
+func bindAndValidate(c *app.RequestContext, v *validator.Validate, req interface{}) bool {
+	method, route := string(c.Method()), c.FullPath()
+
+	if err := c.BindAndValidate(req); err != nil {
+		metrics.ValidationFailures.Inc(method, route, "", "bind")
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+
+	if err := validateRequest(v, method, route, req); err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// validateRequest 校验请求并按接口、字段和规则记录校验失败指标，
+// 用于不经过HTTP请求绑定的参数（如WebSocket消息），以method和route标识所属接口
+func validateRequest(v *validator.Validate, method, route string, req interface{}) error {
+	err := v.Struct(req)
+	var fieldErrors validator.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		for _, fieldError := range fieldErrors {
+			metrics.ValidationFailures.Inc(method, route, fieldError.Field(), fieldError.Tag())
+		}
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestBindStreamChatQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		uri    string
+		wantOK bool
+	}{
+		{"all parameters", "/stream?content=hi&attachment_ids=1,2&model=gpt&retrieval=false&source_budget=3&auto_title=true", true},
+		{"content only", "/stream?content=hi", true},
+		{"missing content", "/stream?model=gpt", false},
+		{"invalid retrieval flag", "/stream?content=hi&retrieval=maybe", false},
+		{"source budget out of range", "/stream?content=hi&source_budget=30", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := app.NewContext(0)
+			c.Request.SetMethod("GET")
+			c.Request.SetRequestURI(tt.uri)
+
+			var query StreamChatQuery
+			if got := bindAndValidate(c, validator.New(), &query); got != tt.wantOK {
+				t.Fatalf("bindAndValidate = %v, want %v (status %d)", got, tt.wantOK, c.Response.StatusCode())
+			}
+		})
+	}
+
+	c := app.NewContext(0)
+	c.Request.SetMethod("GET")
+	c.Request.SetRequestURI("/stream?content=hi&attachment_ids=1,2&retrieval=false&source_budget=3")
+	var query StreamChatQuery
+	if !bindAndValidate(c, validator.New(), &query) {
+		t.Fatal("bind failed")
+	}
+	if query.Content != "hi" || query.AttachmentIDs != "1,2" || query.Retrieval == nil || *query.Retrieval || query.SourceBudget == nil || *query.SourceBudget != 3 {
+		t.Errorf("unexpected query %+v", query)
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type CalendarHandler struct {
+	calendarService *service.CalendarService
+	frontendURL     string
+	validator       *validator.Validate
+}
+
+// NewCalendarHandler frontendURL用于OAuth回调完成后跳转回前端的集成设置页
+func NewCalendarHandler(calendarService *service.CalendarService, frontendURL string) *CalendarHandler {
+	return &CalendarHandler{
+		calendarService: calendarService,
+		frontendURL:     strings.TrimRight(frontendURL, "/"),
+		validator:       validator.New(),
+	}
+}
+
+// Status 获取日历授权状态
+func (h *CalendarHandler) Status(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	status, err := h.calendarService.Status(userID.(uint))
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Calendar status retrieved successfully",
+		Data:    status,
+	})
+}
+
+// Authorize 获取Google日历的授权地址，前端跳转到该地址完成授权
+func (h *CalendarHandler) Authorize(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.AuthorizeCalendarRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	authURL, err := h.calendarService.AuthorizeURL(userID.(uint), &req)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Authorization URL generated successfully",
+		Data:    map[string]string{"url": authURL},
+	})
+}
+
+// Disconnect 删除日历授权
+func (h *CalendarHandler) Disconnect(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	if err := h.calendarService.Disconnect(ctx, userID.(uint)); err != nil {
+		c.JSON(calendarErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "Calendar disconnected successfully"})
+}
+
+// ListMutations 获取助手对日历的修改记录
+func (h *CalendarHandler) ListMutations(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	mutations, total, err := h.calendarService.ListMutations(userID.(uint), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, mutations, total, page, pageSize)
+}
+
+// Callback Google的OAuth回调（公开访问），带着授权码和state跳转回前端，由前端在登录状态下调用Connect完成授权
+func (h *CalendarHandler) Callback(ctx context.Context, c *app.RequestContext) {
+	c.Redirect(consts.StatusFound, []byte(oauthCallbackRedirect(h.frontendURL, model.IntegrationGoogleCalendar, c)))
+}
+
+// Connect 以回调带回的授权码和state完成日历授权，state必须由当前用户发起且只能使用一次
+func (h *CalendarHandler) Connect(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.ConnectIntegrationRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.calendarService.Connect(ctx, userID.(uint), &req); err != nil {
+		log.Printf("Failed to connect calendar: %v", err)
+		c.JSON(calendarErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "Calendar connected successfully"})
+}
+
+func calendarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrIntegrationDisabled):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrIntegrationNotConnected):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrInvalidOAuthState), errors.Is(err, service.ErrCalendarAccessNotGranted):
+		return consts.StatusBadRequest
+	default:
+		return consts.StatusInternalServerError
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type CanaryHandler struct {
+	canaryService *service.CanaryService
+	validator     *validator.Validate
+}
+
+func NewCanaryHandler(canaryService *service.CanaryService) *CanaryHandler {
+	return &CanaryHandler{
+		canaryService: canaryService,
+		validator:     validator.New(),
+	}
+}
+
+// ListRollouts 获取灰度发布记录（管理员）
+func (h *CanaryHandler) ListRollouts(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	rollouts, total, err := h.canaryService.List(page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, rollouts, total, page, pageSize)
+}
+
+// GetRollout 获取灰度发布及当前的错误率、差评率（管理员）
+func (h *CanaryHandler) GetRollout(ctx context.Context, c *app.RequestContext) {
+	rolloutID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid rollout ID"})
+		return
+	}
+
+	stats, err := h.canaryService.Get(uint(rolloutID))
+	if err != nil {
+		c.JSON(canaryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Canary rollout retrieved successfully",
+		Data:    stats,
+	})
+}
+
+// CreateRollout 开始新模型的灰度发布（管理员）
+func (h *CanaryHandler) CreateRollout(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreateCanaryRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	rollout, err := h.canaryService.Create(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(canaryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Canary rollout started successfully",
+		Data:    rollout,
+	})
+}
+
+// UpdateRollout 调整灰度比例（管理员）
+func (h *CanaryHandler) UpdateRollout(ctx context.Context, c *app.RequestContext) {
+	rolloutID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid rollout ID"})
+		return
+	}
+
+	var req service.UpdateCanaryRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	rollout, err := h.canaryService.UpdatePercent(uint(rolloutID), &req)
+	if err != nil {
+		c.JSON(canaryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Canary rollout updated successfully",
+		Data:    rollout,
+	})
+}
+
+// CompleteRollout 结束灰度发布（管理员）
+func (h *CanaryHandler) CompleteRollout(ctx context.Context, c *app.RequestContext) {
+	h.endRollout(c, h.canaryService.Complete, "Canary rollout completed successfully")
+}
+
+// RollbackRollout 手动回滚灰度发布（管理员）
+func (h *CanaryHandler) RollbackRollout(ctx context.Context, c *app.RequestContext) {
+	h.endRollout(c, h.canaryService.Rollback, "Canary rollout rolled back successfully")
+}
+
+func (h *CanaryHandler) endRollout(c *app.RequestContext, end func(adminID, id uint, req *service.EndCanaryRequest) (*model.CanaryRollout, error), message string) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	rolloutID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid rollout ID"})
+		return
+	}
+
+	var req service.EndCanaryRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	rollout, err := end(userID.(uint), uint(rolloutID), &req)
+	if err != nil {
+		c.JSON(canaryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: message,
+		Data:    rollout,
+	})
+}
+
+func canaryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCanaryNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrCanaryInProgress), errors.Is(err, service.ErrCanaryEnded):
+		return consts.StatusConflict
+	case errors.Is(err, service.ErrCanaryModelUnavailable):
+		return consts.StatusBadRequest
+	default:
+		return consts.StatusInternalServerError
+	}
+}
@@ -3,40 +3,126 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
-	"log"
+	"sync"
+	"time"
 
 	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/middleware"
+	"ai-chat-backend/internal/model"
 	"ai-chat-backend/internal/service"
 	"ai-chat-backend/internal/utils"
 
+	sseImpl "ai-chat-backend/internal/utils"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
-	sseImpl "ai-chat-backend/internal/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/http1/resp"
 	"github.com/go-playground/validator/v10"
 	"github.com/hertz-contrib/sse"
+	"github.com/hertz-contrib/websocket"
 )
 
+const (
+	// ndjsonContentType 流式消息列表的响应类型
+	ndjsonContentType = "application/x-ndjson"
+	// messageStreamFlushRows 流式返回消息时每写入多少条刷新一次输出
+	messageStreamFlushRows = 20
+)
+
+// MessageTooLongResponse 消息超长时的响应，客户端可据此提示或截断
+type MessageTooLongResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	Length    int    `json:"length"`
+	MaxLength int    `json:"max_length"`
+}
+
+// writeMessageTooLong err为消息超长错误时写入400响应并返回true
+func writeMessageTooLong(c *app.RequestContext, err error) bool {
+	var tooLong *service.MessageTooLongError
+	if !errors.As(err, &tooLong) {
+		return false
+	}
+	c.JSON(consts.StatusBadRequest, MessageTooLongResponse{
+		Error:     "message too long",
+		Code:      "message_too_long",
+		Length:    tooLong.Length,
+		MaxLength: tooLong.Limit,
+	})
+	return true
+}
+
+// SecretDetectedResponse 消息中含有凭据被拒绝时的响应
+type SecretDetectedResponse struct {
+	Error string   `json:"error"`
+	Code  string   `json:"code"`
+	Types []string `json:"secret_types"`
+}
+
+// writeSecretDetected err为含凭据被拒绝的错误时写入422响应并返回true
+func writeSecretDetected(c *app.RequestContext, err error) bool {
+	var detected *service.SecretDetectedError
+	if !errors.As(err, &detected) {
+		return false
+	}
+	c.JSON(consts.StatusUnprocessableEntity, SecretDetectedResponse{
+		Error: err.Error(),
+		Code:  "secret_detected",
+		Types: detected.Types,
+	})
+	return true
+}
+
+// messageAttachmentStatus 消息附带的文件不可用时对应的状态码
+func messageAttachmentStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, service.ErrAttachmentInUse):
+		return consts.StatusConflict, true
+	case errors.Is(err, service.ErrAttachmentConversation):
+		return consts.StatusBadRequest, true
+	case errors.Is(err, service.ErrAttachmentUnavailable), errors.Is(err, service.ErrAttachmentNotFound),
+		errors.Is(err, service.ErrAttachmentPending), errors.Is(err, service.ErrAttachmentInfected):
+		return attachmentErrorStatus(err), true
+	}
+	return 0, false
+}
+
+// secretWarning 用户消息中的凭据已被替换时附带在响应中的提示，未检测到时为nil
+func secretWarning(message *model.Message) map[string]interface{} {
+	if message == nil || message.SecretTypes == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"types":   strings.Split(message.SecretTypes, ","),
+		"message": "Your message appeared to contain credentials. They were redacted before storage and were not sent to the model; consider rotating them.",
+	}
+}
+
 type ChatHandler struct {
-	chatService *service.ChatService
-	validator   *validator.Validate
+	chatService  *service.ChatService
+	guestService *service.GuestService
+	validator    *validator.Validate
+
+	// socketChecks WebSocket连接中每条消息生成前的检查
+	socketChecks []middleware.SocketCheck
 }
 
-func NewChatHandler(chatService *service.ChatService) *ChatHandler {
+// NewChatHandler guestService用于WebSocket连接中按条扣减访客的消息额度
+func NewChatHandler(chatService *service.ChatService, guestService *service.GuestService) *ChatHandler {
 	return &ChatHandler{
-		chatService: chatService,
-		validator:   validator.New(),
+		chatService:  chatService,
+		guestService: guestService,
+		validator:    validator.New(),
 	}
 }
 
-type PaginationResponse struct {
-	Data       interface{} `json:"data"`
-	Total      int64       `json:"total"`
-	Page       int         `json:"page"`
-	PageSize   int         `json:"page_size"`
-	TotalPages int         `json:"total_pages"`
+// UseSocketChecks 添加WebSocket连接中逐条消息的检查（限流、只读模式等），启动时设置
+func (h *ChatHandler) UseSocketChecks(checks ...middleware.SocketCheck) {
+	h.socketChecks = append(h.socketChecks, checks...)
 }
 
 // GetConversations 获取会话列表
@@ -48,31 +134,35 @@ func (h *ChatHandler) GetConversations(ctx context.Context, c *app.RequestContex
 	}
 
 	// 获取分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	page, pageSize := pagination(c, 20)
 
-	if page < 1 {
-		page = 1
+	opts := service.ConversationListOptions{
+		Archived: c.Query("archived") == "true",
+		Sort:     c.Query("sort"),
+		Order:    c.Query("order"),
+		Query:    c.Query("q"),
+		Tag:      c.Query("tag"),
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	if assistantID := c.Query("assistant_id"); assistantID != "" {
+		id, err := strconv.ParseUint(assistantID, 10, 32)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid assistant ID"})
+			return
+		}
+		opts.AssistantID = uint(id)
 	}
 
-	conversations, total, err := h.chatService.GetConversations(userID.(uint), page, pageSize)
+	conversations, total, err := h.chatService.GetConversations(userID.(uint), opts, page, pageSize)
+	if errors.Is(err, service.ErrInvalidConversationSort) {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
-
-	c.JSON(consts.StatusOK, PaginationResponse{
-		Data:       conversations,
-		Total:      total,
-		Page:       page,
-		PageSize:   pageSize,
-		TotalPages: totalPages,
-	})
+	writePage(c, conversations, total, page, pageSize)
 }
 
 // CreateConversation 创建新会话
@@ -84,18 +174,23 @@ func (h *ChatHandler) CreateConversation(ctx context.Context, c *app.RequestCont
 	}
 
 	var req service.CreateConversationRequest
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	if err := h.validator.Struct(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if !bindAndValidate(c, h.validator, &req) {
 		return
 	}
 
 	conversation, err := h.chatService.CreateConversation(userID.(uint), &req)
 	if err != nil {
+		if errors.Is(err, service.ErrIncognitoUnavailable) || errors.Is(err, service.ErrModelNotFound) || errors.Is(err, service.ErrAssistantNotFound) {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInputRejected) {
+			c.JSON(consts.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if writeEntitlementError(c, err) {
+			return
+		}
 		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
@@ -106,6 +201,41 @@ func (h *ChatHandler) CreateConversation(ctx context.Context, c *app.RequestCont
 	})
 }
 
+// MergeConversations 将一个会话的消息按时间并入另一个会话，并删除前者
+func (h *ChatHandler) MergeConversations(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.MergeConversationsRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	conversation, moved, err := h.chatService.MergeConversations(userID.(uint), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrConversationNotFound):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Conversation not found"})
+		case errors.Is(err, service.ErrMergeSameConversation), errors.Is(err, service.ErrMergeIncognito):
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Conversations merged successfully",
+		Data: map[string]interface{}{
+			"conversation":    conversation,
+			"merged_messages": moved,
+		},
+	})
+}
+
 // GetConversation 获取会话详情
 func (h *ChatHandler) GetConversation(ctx context.Context, c *app.RequestContext) {
 	userID, exists := c.Get("user_id")
@@ -146,28 +276,247 @@ func (h *ChatHandler) UpdateConversation(ctx context.Context, c *app.RequestCont
 		return
 	}
 
+	var req service.UpdateConversationRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	conversation, err := h.chatService.UpdateConversation(userID.(uint), uint(conversationID), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrConversationNotFound):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Conversation not found"})
+		case errors.Is(err, service.ErrModelNotFound):
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrInputRejected):
+			c.JSON(consts.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrRegionUnavailable):
+			c.JSON(consts.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Conversation updated successfully",
+		Data:    conversation,
+	})
+}
+
+// SetAutoArchive 设置会话是否允许闲置后自动归档
+func (h *ChatHandler) SetAutoArchive(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
 	var req struct {
-		Title string `json:"title" validate:"required,max=100"`
+		Enabled *bool `json:"enabled" validate:"required"`
 	}
 
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	err = h.chatService.SetAutoArchive(userID.(uint), uint(conversationID), *req.Enabled)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Conversation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Auto-archive setting updated successfully",
+	})
+}
+
+// SetRetrieval 设置会话的知识库检索开关和每次回复最多引用的分块数
+func (h *ChatHandler) SetRetrieval(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req service.RetrievalSettingsRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	conversation, err := h.chatService.SetRetrieval(userID.(uint), uint(conversationID), &req)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Conversation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Retrieval settings updated successfully",
+		Data: map[string]interface{}{
+			"retrieval_enabled": conversation.RetrievalEnabled,
+			"source_budget":     conversation.SourceBudget,
+		},
+	})
+}
+
+// SetTags 替换会话的标签
+func (h *ChatHandler) SetTags(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req service.ConversationTagsRequest
+	if !bindAndValidate(c, h.validator, &req) {
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
+	tags, err := h.chatService.SetTags(userID.(uint), uint(conversationID), req.Tags)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Conversation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Tags updated successfully",
+		Data:    map[string]interface{}{"tags": tags},
+	})
+}
+
+// SetModelEndpoint 为会话选用组织的模型服务
+func (h *ChatHandler) SetModelEndpoint(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req struct {
+		EndpointID *uint `json:"endpoint_id"`
+	}
+
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	err = h.chatService.SetModelEndpoint(userID.(uint), uint(conversationID), req.EndpointID)
+	if errors.Is(err, service.ErrConversationNotFound) || errors.Is(err, service.ErrModelEndpointNotFound) {
+		c.JSON(consts.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Model endpoint updated successfully",
+	})
+}
+
+// SetModel 为会话选用模型，model为空时恢复默认模型
+func (h *ChatHandler) SetModel(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req struct {
+		Model string `json:"model" validate:"max=100"`
+	}
+
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	err = h.chatService.SetModel(userID.(uint), uint(conversationID), req.Model)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		c.JSON(consts.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrModelNotFound) {
 		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if errors.Is(err, service.ErrRegionUnavailable) {
+		c.JSON(consts.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
 
-	err = h.chatService.UpdateConversation(userID.(uint), uint(conversationID), req.Title)
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Model updated successfully",
+	})
+}
+
+// GetModels 获取可选用的服务端模型
+func (h *ChatHandler) GetModels(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	models, err := h.chatService.Models(userID.(uint))
+	if errors.Is(err, service.ErrRegionUnavailable) {
+		c.JSON(consts.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	c.JSON(consts.StatusOK, SuccessResponse{
-		Message: "Conversation updated successfully",
+		Message: "Models retrieved successfully",
+		Data:    models,
 	})
 }
 
@@ -196,7 +545,7 @@ func (h *ChatHandler) DeleteConversation(ctx context.Context, c *app.RequestCont
 	})
 }
 
-// GetMessages 获取消息列表
+// GetMessages 获取消息列表，format=ndjson时流式返回全部消息
 func (h *ChatHandler) GetMessages(ctx context.Context, c *app.RequestContext) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -211,35 +560,98 @@ func (h *ChatHandler) GetMessages(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// 获取分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	page, pageSize := pagination(c, 50)
 
-	if page < 1 {
-		page = 1
+	opts := service.MessageListOptions{Contains: c.Query("contains")}
+	if role := c.Query("role"); role != "" {
+		opts.Roles = strings.Split(role, ",")
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 50
+	var ok bool
+	if opts.From, ok = timeQuery(c, "from"); !ok {
+		return
+	}
+	if opts.To, ok = timeQuery(c, "to"); !ok {
+		return
 	}
 
-	messages, total, err := h.chatService.GetMessages(userID.(uint), uint(conversationID), page, pageSize)
+	if wantsNDJSON(c) {
+		h.streamMessages(ctx, c, userID.(uint), uint(conversationID), opts)
+		return
+	}
+
+	messages, total, err := h.chatService.GetMessages(userID.(uint), uint(conversationID), opts, page, pageSize)
+	if errors.Is(err, service.ErrInvalidMessageFilter) {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	writePage(c, messages, total, page, pageSize)
+}
+
+// wantsNDJSON 请求指定format=ndjson或Accept为application/x-ndjson时以NDJSON流式返回
+func wantsNDJSON(c *app.RequestContext) bool {
+	return c.Query("format") == "ndjson" || strings.Contains(string(c.GetHeader("Accept")), ndjsonContentType)
+}
 
-	c.JSON(consts.StatusOK, PaginationResponse{
-		Data:       messages,
-		Total:      total,
-		Page:       page,
-		PageSize:   pageSize,
-		TotalPages: totalPages,
+// streamMessages 以NDJSON（每行一条消息的JSON）分块返回符合条件的全部消息，不分页，
+// 客户端可边接收边渲染。会话不存在或筛选条件无效时在写出第一行之前返回JSON错误
+func (h *ChatHandler) streamMessages(ctx context.Context, c *app.RequestContext, userID, conversationID uint, opts service.MessageListOptions) {
+	started := false
+	start := func() {
+		c.SetContentType(ndjsonContentType)
+		c.Header("Cache-Control", "no-cache")
+		c.SetStatusCode(consts.StatusOK)
+		c.Response.HijackWriter(resp.NewChunkedBodyWriter(&c.Response, c.GetWriter()))
+		started = true
+	}
+
+	enc := json.NewEncoder(c)
+	written := 0
+	err := h.chatService.StreamMessages(ctx, userID, conversationID, opts, func(msg *model.Message) error {
+		if !started {
+			start()
+		}
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+		written++
+		if written%messageStreamFlushRows == 0 {
+			return c.Flush()
+		}
+		return nil
 	})
+
+	if !started {
+		switch {
+		case err == nil:
+			// 没有符合条件的消息，返回空的流
+			start()
+		case errors.Is(err, service.ErrInvalidMessageFilter):
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		case errors.Is(err, service.ErrConversationNotFound):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		default:
+			c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if err == nil {
+		err = c.Flush()
+	}
+	// 响应头已发出，出错时只能中断输出
+	if err != nil {
+		log.Printf("Failed to stream messages of conversation %d: %v", conversationID, err)
+	}
 }
 
-// SendMessage 发送消息
-func (h *ChatHandler) SendMessage(ctx context.Context, c *app.RequestContext) {
+// GetMessageContext 获取一条消息及其前后的消息，用于从搜索结果跳转到消息所在位置
+func (h *ChatHandler) GetMessageContext(ctx context.Context, c *app.RequestContext) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
@@ -251,72 +663,234 @@ func (h *ChatHandler) SendMessage(ctx context.Context, c *app.RequestContext) {
 		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
 		return
 	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid message ID"})
+		return
+	}
+	before, err := strconv.Atoi(c.DefaultQuery("before", "10"))
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: service.ErrInvalidMessageContext.Error()})
+		return
+	}
+	after, err := strconv.Atoi(c.DefaultQuery("after", "10"))
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: service.ErrInvalidMessageContext.Error()})
+		return
+	}
 
-	var req service.SendMessageRequest
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	result, err := h.chatService.GetMessageContext(userID.(uint), uint(conversationID), uint(messageID), before, after)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrConversationNotFound):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Conversation not found"})
+		case errors.Is(err, service.ErrMessageNotFound):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Message not found"})
+		case errors.Is(err, service.ErrInvalidMessageContext):
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Message context retrieved successfully",
+		Data:    result,
+	})
+}
+
+// timeQuery 读取RFC 3339格式的时间参数，未提供时返回nil，格式错误时返回400并返回false
+func timeQuery(c *app.RequestContext, name string) (*time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: name + " must be an RFC 3339 timestamp"})
+		return nil, false
+	}
+	return &parsed, true
+}
+
+// DeleteMessage 删除或涂抹单条消息，mode=redact时保留消息记录但清空内容
+func (h *ChatHandler) DeleteMessage(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
 		return
 	}
 
-	userMessage, assistantMessage, err := h.chatService.SendMessage(ctx, userID.(uint), uint(conversationID), &req)
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid message ID"})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", service.MessageDeleteSoft)
+	err = h.chatService.DeleteMessage(userID.(uint), uint(conversationID), uint(messageID), mode, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrConversationNotFound):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Conversation not found"})
+		case errors.Is(err, service.ErrMessageNotFound):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: "Message not found"})
+		case errors.Is(err, service.ErrIncognitoMessage), errors.Is(err, service.ErrInvalidDeleteMode):
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	message := "Message deleted successfully"
+	if mode == service.MessageDeleteRedact {
+		message = "Message redacted successfully"
+	}
+	c.JSON(consts.StatusOK, SuccessResponse{Message: message})
+}
+
+// SendMessage 发送消息
+func (h *ChatHandler) SendMessage(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req service.SendMessageRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	userMessage, assistantMessage, truncated, err := h.chatService.SendMessage(ctx, userID.(uint), uint(conversationID), &req)
+	if err != nil {
+		if writeMessageTooLong(c, err) || writeSecretDetected(c, err) {
+			return
+		}
+		if writeEntitlementError(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInputRejected) {
+			c.JSON(consts.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrModelNotFound) {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrRegionUnavailable) {
+			c.JSON(consts.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if status, ok := messageAttachmentStatus(err); ok {
+			c.JSON(status, ErrorResponse{Error: err.Error()})
+			return
+		}
 		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// 接近每日消息数或额度余额上限时以响应头提醒
+	if warnings := h.chatService.QuotaWarnings(userID.(uint)); len(warnings) > 0 {
+		c.Header("X-Quota-Warning", quotaWarningHeader(warnings))
+	}
 	c.JSON(consts.StatusOK, SuccessResponse{
 		Message: "Message sent successfully",
 		Data: map[string]interface{}{
 			"user_message":      userMessage,
 			"assistant_message": assistantMessage,
+			"truncated":         truncated,
+			"secret_warning":    secretWarning(userMessage),
 		},
 	})
 }
 
-// StreamChat 流式聊天
+// StreamChatQuery SSE流式聊天的URL参数，字段含义与发送消息相同
+type StreamChatQuery struct {
+	Content string `query:"content" validate:"required"`
+	// AttachmentIDs 随消息发送的文件，逗号分隔，如attachment_ids=1,2
+	AttachmentIDs string `query:"attachment_ids"`
+	// Model 仅对本条消息选用的模型
+	Model string `query:"model" validate:"max=100"`
+	// Retrieval、SourceBudget 仅对本条消息覆盖会话的知识库检索设置，如retrieval=false、source_budget=3
+	Retrieval    *bool `query:"retrieval"`
+	SourceBudget *int  `query:"source_budget" validate:"omitempty,min=0,max=20"`
+	// AutoTitle 为false时本条消息不触发自动生成会话标题
+	AutoTitle *bool `query:"auto_title"`
+}
+
+// StreamChat 流式聊天（token通过URL参数由QueryAuth中间件验证）
 func (h *ChatHandler) StreamChat(ctx context.Context, c *app.RequestContext) {
-	// 对于SSE，从URL参数获取token（因为EventSource不支持自定义headers）
-	token := c.Query("token")
-	if token == "" {
-		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "Token is required"})
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
 		return
 	}
 
-	// 移除可能的 "Bearer " 前缀
-	tokenString := strings.TrimPrefix(token, "Bearer ")
-
-	// 验证JWT token
 	cfg := config.Load()
-	claims, err := utils.ValidateJWT(tokenString, cfg.JWT.Secret)
-	if err != nil {
-		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "Invalid token"})
-		return
-	}
-
 	sseSender := sseImpl.NewSSESender(sse.NewStream(c))
 
-
-	userID := claims.UserID
-
 	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
 		return
 	}
 
-	content := c.Query("content")
-	if content == "" {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Content is required"})
+	var query StreamChatQuery
+	if !bindAndValidate(c, h.validator, &query) {
+		return
+	}
+	content := query.Content
+	req := service.SendMessageRequest{
+		Content:      content,
+		Model:        query.Model,
+		Retrieval:    query.Retrieval,
+		SourceBudget: query.SourceBudget,
+		AutoTitle:    query.AutoTitle,
+	}
+	for _, field := range strings.Split(query.AttachmentIDs, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid attachment ID"})
+			return
+		}
+		req.AttachmentIDs = append(req.AttachmentIDs, uint(id))
+	}
+	if err := validateRequest(h.validator, string(c.Method()), c.FullPath(), &req); err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	// SSE开始后只能以事件返回错误，长度在此之前检查；其他错误仍在生成时以事件返回
+	if err := h.chatService.CheckMessageLength(userID.(uint), uint(conversationID), req.Model, content); err != nil && writeMessageTooLong(c, err) {
+		return
+	}
+	if err := h.chatService.CheckSecrets(content); err != nil {
+		writeSecretDetected(c, err)
+		return
+	}
+	// 额度用尽时以429返回，其他错误仍在生成时以事件返回
+	if err := h.chatService.CheckQuota(userID.(uint), uint(conversationID), req.Model); err != nil && writeEntitlementError(c, err) {
 		return
 	}
 
 	// 设置SSE头
-	c.Header("X-Accel-Buffering", "no")  // 禁用nginx缓冲
+	c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
 
 	// 发送开始事件
 	err = sseSender.Send(ctx, &sse.Event{
@@ -327,17 +901,45 @@ func (h *ChatHandler) StreamChat(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// 流式处理
-	userMessage, err := h.chatService.StreamChat(ctx, userID, uint(conversationID), content, func(chunk string) error {
-		// 正确转义JSON字符串
-		chunkBytes, _ := json.Marshal(chunk)
-		data := fmt.Sprintf("{\"type\": \"chunk\", \"content\": %s}", string(chunkBytes))
-		// log.Printf("Sending chunk: %s", data)
+	sendChunk := func(chunk string) error {
 		return sseSender.Send(ctx, &sse.Event{
-			Data: []byte(data),
+			Data: utils.ChunkEventData(chunk),
 		})
-	})
+	}
 
+	// 可选：合并增量输出后再推送
+	var coalescer *utils.ChunkCoalescer
+	if cfg.Stream.Coalesce {
+		coalescer = utils.NewChunkCoalescer(cfg.Stream.CoalesceInterval, sendChunk)
+		sendChunk = coalescer.Write
+	}
+
+	// 按间隔推送预估用量，先刷新合并中的内容保证事件顺序
+	sendUsage := func(usage service.StreamUsage) error {
+		if coalescer != nil {
+			if err := coalescer.Flush(); err != nil {
+				return err
+			}
+		}
+		return sseSender.Send(ctx, &sse.Event{
+			Data: usageEventData(usage),
+		})
+	}
+
+	// 流式处理
+	userMessage, result, err := h.chatService.StreamChat(ctx, userID.(uint), uint(conversationID), &req, sendChunk, sendUsage)
+	if coalescer != nil {
+		if flushErr := coalescer.Flush(); flushErr != nil {
+			log.Printf("Error flushing coalesced chunks: %v", flushErr)
+		}
+	}
+
+	if errors.Is(err, service.ErrGenerationCancelled) {
+		sseSender.Send(ctx, &sse.Event{
+			Data: []byte("{\"type\": \"cancelled\"}"),
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("Error: %s", err.Error())
 		sseSender.Send(ctx, &sse.Event{
@@ -347,8 +949,361 @@ func (h *ChatHandler) StreamChat(ctx context.Context, c *app.RequestContext) {
 	}
 
 	log.Printf("StreamChat completed, user_message_id: %d", userMessage.ID)
-	// 发送结束事件
+	// 接近额度上限时在结束事件前推送提醒，访客的额度由GuestQuota单独计算
+	if !c.GetBool("guest") {
+		for _, warning := range h.chatService.QuotaWarnings(userID.(uint)) {
+			sseSender.Send(ctx, &sse.Event{
+				Data: quotaWarningEventData(warning),
+			})
+		}
+	}
+	// 发送结束事件，附带最终用量
 	sseSender.Send(ctx, &sse.Event{
-		Data: []byte(fmt.Sprintf("{\"type\": \"end\", \"user_message_id\": %d}", userMessage.ID)),
+		Data: endEventData(userMessage, result),
+	})
+}
+
+// CancelStream 中止会话中进行中的流式生成，已生成的部分作为回复保存，SSE或WebSocket连接随后收到cancelled事件
+func (h *ChatHandler) CancelStream(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	if err := h.chatService.CancelGeneration(userID.(uint), uint(conversationID)); err != nil {
+		if errors.Is(err, service.ErrNoActiveGeneration) {
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "Generation cancelled"})
+}
+
+// endEventData 构造流式生成结束事件的data，生成被取消时事件类型为cancelled，字段与end相同
+func endEventData(userMessage *model.Message, result *service.StreamResult) []byte {
+	eventType := "end"
+	if result.Cancelled {
+		eventType = "cancelled"
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":            eventType,
+		"user_message_id": userMessage.ID,
+		"truncated":       result.Truncated,
+		"usage":           result.Usage,
+		"sources_used":    result.SourcesUsed,
+		"secret_warning":  secretWarning(userMessage),
+	})
+	return data
+}
+
+// quotaWarningEventData 构造额度提醒事件的data
+func quotaWarningEventData(warning service.QuotaWarning) []byte {
+	data, _ := json.Marshal(struct {
+		Type string `json:"type"`
+		service.QuotaWarning
+	}{Type: "quota_warning", QuotaWarning: warning})
+	return data
+}
+
+// quotaWarningHeader 构造X-Quota-Warning响应头，多项以逗号分隔，
+// 如 messages;remaining=5;limit=50;reset=2024-01-02T00:00:00+08:00, credits;remaining=8000
+func quotaWarningHeader(warnings []service.QuotaWarning) string {
+	items := make([]string, len(warnings))
+	for i, warning := range warnings {
+		item := fmt.Sprintf("%s;remaining=%d", warning.Quota, warning.Remaining)
+		if warning.Limit > 0 {
+			item += fmt.Sprintf(";limit=%d", warning.Limit)
+		}
+		if warning.ResetAt != nil {
+			item += ";reset=" + warning.ResetAt.Format(time.RFC3339)
+		}
+		items[i] = item
+	}
+	return strings.Join(items, ", ")
+}
+
+// usageEventData 构造预估用量事件的data
+func usageEventData(usage service.StreamUsage) []byte {
+	data, _ := json.Marshal(struct {
+		Type string `json:"type"`
+		service.StreamUsage
+	}{Type: "usage", StreamUsage: usage})
+	return data
+}
+
+// chatSocketReadLimit 客户端单条WebSocket消息的最大字节数
+const chatSocketReadLimit = 1 << 20
+
+// WebSocket客户端发送的指令类型
+const (
+	socketMessage = "message" // 发送新消息并流式返回回复
+	socketCancel  = "cancel"  // 取消进行中的生成
+)
+
+// chatUpgrader 与会话列表推送一样不限制来源；客户端以子协议传递token时选择bearer子协议
+var chatUpgrader = websocket.HertzUpgrader{
+	CheckOrigin:  func(c *app.RequestContext) bool { return true },
+	Subprotocols: []string{middleware.BearerSubprotocol},
+}
+
+// ChatSocketRequest WebSocket客户端发送的指令，type为message时其余字段与发送消息相同
+type ChatSocketRequest struct {
+	Type string `json:"type"`
+	service.SendMessageRequest
+}
+
+// chatSocket 串行化WebSocket写入，生成回复的goroutine和读循环都会写入
+type chatSocket struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+	// route 升级前的请求路由，消息校验失败时按该接口记录指标
+	route string
+}
+
+func (s *chatSocket) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(updateWriteTimeout))
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (s *chatSocket) send(event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+// closePolicy 逐条消息的检查未通过时以策略违规关闭连接，reason作为关闭原因告知客户端
+func (s *chatSocket) closePolicy(reason error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason.Error()),
+		time.Now().Add(updateWriteTimeout))
+}
+
+// sendError 发送错误事件，消息超长和含凭据时附带与HTTP接口相同的code等字段
+func (s *chatSocket) sendError(err error) error {
+	event := map[string]interface{}{"type": "error", "message": err.Error()}
+	var tooLong *service.MessageTooLongError
+	var detected *service.SecretDetectedError
+	switch {
+	case errors.As(err, &tooLong):
+		event["code"] = "message_too_long"
+		event["length"] = tooLong.Length
+		event["max_length"] = tooLong.Limit
+	case errors.As(err, &detected):
+		event["code"] = "secret_detected"
+		event["secret_types"] = detected.Types
+	}
+	return s.send(event)
+}
+
+// ChatSocket 通过WebSocket进行流式聊天（token通过Authorization头或子协议由SocketAuth中间件验证）。
+// 同一连接上可多次发送消息和取消生成，服务端推送的事件与StreamChat相同，取消时推送cancelled事件。
+// 每条消息生成前执行UseSocketChecks添加的检查，未通过时以1008（策略违规）关闭连接。
+// 同一时间只进行一个生成，生成中收到新消息时返回错误事件；连接断开时取消进行中的生成
+func (h *ChatHandler) ChatSocket(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+	// 升级后无法再读取请求，访客扣减额度所需的信息提前取出
+	guest := c.GetBool("guest")
+	clientIP, userAgent := c.ClientIP(), string(c.UserAgent())
+	route := c.FullPath()
+	checks := make([]func(context.Context) error, 0, len(h.socketChecks))
+	for _, check := range h.socketChecks {
+		checks = append(checks, check(c))
+	}
+
+	err = chatUpgrader.Upgrade(c, func(conn *websocket.Conn) {
+		defer conn.Close()
+		socket := &chatSocket{conn: conn, route: route}
+		conn.SetReadLimit(chatSocketReadLimit)
+		conn.SetReadDeadline(time.Now().Add(updatePongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(updatePongWait))
+		})
+
+		// 定时ping保活，WriteControl可与其他写入并发调用
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(updatePingInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(updateWriteTimeout)); err != nil {
+						return
+					}
+				}
+			}
+		}()
+
+		var (
+			mu      sync.Mutex
+			cancel  context.CancelFunc
+			running sync.WaitGroup
+		)
+		defer func() {
+			mu.Lock()
+			if cancel != nil {
+				cancel()
+			}
+			mu.Unlock()
+			running.Wait()
+		}()
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(updatePongWait))
+
+			var req ChatSocketRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				socket.sendError(errors.New("invalid message"))
+				continue
+			}
+			switch req.Type {
+			case socketCancel:
+				// 经ChatService取消以保存已生成的部分；尚未开始生成（如仍在校验）时直接结束本次生成
+				if err := h.chatService.CancelGeneration(userID.(uint), uint(conversationID)); err == nil {
+					continue
+				}
+				mu.Lock()
+				if cancel != nil {
+					cancel()
+				}
+				mu.Unlock()
+			case socketMessage:
+				// 升级时的限流、只读等中间件只执行一次，每条消息重新检查
+				for _, check := range checks {
+					if err := check(ctx); err != nil {
+						socket.closePolicy(err)
+						return
+					}
+				}
+				mu.Lock()
+				if cancel != nil {
+					mu.Unlock()
+					socket.sendError(errors.New("a reply is already being generated"))
+					continue
+				}
+				genCtx, genCancel := context.WithCancel(ctx)
+				cancel = genCancel
+				mu.Unlock()
+
+				running.Add(1)
+				go func(req service.SendMessageRequest) {
+					defer running.Done()
+					defer func() {
+						mu.Lock()
+						cancel = nil
+						mu.Unlock()
+						genCancel()
+					}()
+					h.streamSocket(genCtx, socket, userID.(uint), uint(conversationID), guest, clientIP, userAgent, &req)
+				}(req.SendMessageRequest)
+			default:
+				socket.sendError(fmt.Errorf("unknown message type %q", req.Type))
+			}
+		}
 	})
-}
\ No newline at end of file
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+	}
+}
+
+// streamSocket 生成一条回复并通过WebSocket推送，校验失败和生成出错时推送错误事件
+func (h *ChatHandler) streamSocket(ctx context.Context, socket *chatSocket, userID, conversationID uint, guest bool, clientIP, userAgent string, req *service.SendMessageRequest) {
+	if err := validateRequest(h.validator, consts.MethodGet, socket.route, req); err != nil {
+		socket.sendError(err)
+		return
+	}
+	if err := h.chatService.CheckMessageLength(userID, conversationID, req.Model, req.Content); err != nil {
+		socket.sendError(err)
+		return
+	}
+	if err := h.chatService.CheckSecrets(req.Content); err != nil {
+		socket.sendError(err)
+		return
+	}
+
+	start := map[string]interface{}{"type": "start"}
+	// 访客每条消息扣减一次额度，与GuestQuota中间件相同
+	if guest {
+		quota, err := h.guestService.ConsumeMessage(ctx, userID, clientIP, userAgent)
+		if err != nil {
+			socket.sendError(err)
+			return
+		}
+		start["guest_remaining"] = quota.Remaining
+	}
+	if err := socket.send(start); err != nil {
+		return
+	}
+
+	sendChunk := func(chunk string) error {
+		return socket.write(utils.ChunkEventData(chunk))
+	}
+	var coalescer *utils.ChunkCoalescer
+	if cfg := config.Load(); cfg.Stream.Coalesce {
+		coalescer = utils.NewChunkCoalescer(cfg.Stream.CoalesceInterval, sendChunk)
+		sendChunk = coalescer.Write
+	}
+	sendUsage := func(usage service.StreamUsage) error {
+		if coalescer != nil {
+			if err := coalescer.Flush(); err != nil {
+				return err
+			}
+		}
+		return socket.write(usageEventData(usage))
+	}
+
+	userMessage, result, err := h.chatService.StreamChat(ctx, userID, conversationID, req, sendChunk, sendUsage)
+	if coalescer != nil {
+		if flushErr := coalescer.Flush(); flushErr != nil {
+			log.Printf("Error flushing coalesced chunks: %v", flushErr)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, service.ErrGenerationCancelled) {
+			socket.send(map[string]interface{}{"type": "cancelled"})
+			return
+		}
+		log.Printf("Error: %s", err.Error())
+		socket.sendError(err)
+		return
+	}
+	if !guest {
+		for _, warning := range h.chatService.QuotaWarnings(userID) {
+			socket.write(quotaWarningEventData(warning))
+		}
+	}
+	socket.write(endEventData(userMessage, result))
+}
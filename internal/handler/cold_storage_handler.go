@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type ColdStorageHandler struct {
+	coldStorageService *service.ColdStorageService
+}
+
+func NewColdStorageHandler(coldStorageService *service.ColdStorageService) *ColdStorageHandler {
+	return &ColdStorageHandler{
+		coldStorageService: coldStorageService,
+	}
+}
+
+// Rehydrate 恢复会话中已移入冷存储的消息内容
+func (h *ColdStorageHandler) Rehydrate(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	restored, err := h.coldStorageService.Rehydrate(ctx, userID.(uint), uint(conversationID))
+	if err != nil {
+		c.JSON(coldStorageErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Messages restored successfully",
+		Data:    map[string]int{"restored": restored},
+	})
+}
+
+func coldStorageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConversationNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrColdStorageDisabled):
+		return consts.StatusServiceUnavailable
+	default:
+		return consts.StatusInternalServerError
+	}
+}
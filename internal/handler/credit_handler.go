@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type CreditHandler struct {
+	creditService *service.CreditService
+	validator     *validator.Validate
+}
+
+func NewCreditHandler(creditService *service.CreditService) *CreditHandler {
+	return &CreditHandler{
+		creditService: creditService,
+		validator:     validator.New(),
+	}
+}
+
+// GetBalance 获取额度余额
+func (h *CreditHandler) GetBalance(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	balance, err := h.creditService.Balance(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Balance retrieved successfully",
+		Data: map[string]interface{}{
+			"balance": balance,
+			"enabled": h.creditService.Enabled(),
+		},
+	})
+}
+
+// GetTransactions 获取额度流水
+func (h *CreditHandler) GetTransactions(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	transactions, total, err := h.creditService.GetTransactions(userID.(uint), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, transactions, total, page, pageSize)
+}
+
+// AdjustCredits 调整指定用户的额度（管理员）
+func (h *CreditHandler) AdjustCredits(ctx context.Context, c *app.RequestContext) {
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	var req service.AdjustCreditsRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	entry, err := h.creditService.Adjust(adminID.(uint), uint(targetID), &req)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Credits adjusted successfully",
+		Data:    entry,
+	})
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type EmailDomainHandler struct {
+	blocklist *service.EmailBlocklist
+	validator *validator.Validate
+}
+
+func NewEmailDomainHandler(blocklist *service.EmailBlocklist) *EmailDomainHandler {
+	return &EmailDomainHandler{
+		blocklist: blocklist,
+		validator: validator.New(),
+	}
+}
+
+// GetStatus 获取一次性邮箱域名列表的状态和域名设置（管理员）
+func (h *EmailDomainHandler) GetStatus(ctx context.Context, c *app.RequestContext) {
+	status, err := h.blocklist.Status()
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Email domain blocklist retrieved successfully",
+		Data:    status,
+	})
+}
+
+// Refresh 立即重新加载一次性邮箱域名列表（管理员）
+func (h *EmailDomainHandler) Refresh(ctx context.Context, c *app.RequestContext) {
+	if err := h.blocklist.Load(ctx); err != nil {
+		c.JSON(consts.StatusBadGateway, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	status, err := h.blocklist.Status()
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Email domain blocklist refreshed successfully",
+		Data:    status,
+	})
+}
+
+// SetOverride 放行或禁止单个邮箱域名（管理员）
+func (h *EmailDomainHandler) SetOverride(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.SetDomainOverrideRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	override, err := h.blocklist.SetOverride(userID.(uint), c.Param("domain"), &req)
+	if err != nil {
+		c.JSON(emailDomainErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Email domain override saved successfully",
+		Data:    override,
+	})
+}
+
+// DeleteOverride 删除邮箱域名的设置（管理员）
+func (h *EmailDomainHandler) DeleteOverride(ctx context.Context, c *app.RequestContext) {
+	if err := h.blocklist.DeleteOverride(c.Param("domain")); err != nil {
+		c.JSON(emailDomainErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Email domain override deleted successfully",
+	})
+}
+
+func emailDomainErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidEmailDomain):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrDomainOverrideNotFound):
+		return consts.StatusNotFound
+	default:
+		return consts.StatusInternalServerError
+	}
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type EvalHandler struct {
+	evalService *service.EvalService
+	validator   *validator.Validate
+}
+
+func NewEvalHandler(evalService *service.EvalService) *EvalHandler {
+	return &EvalHandler{
+		evalService: evalService,
+		validator:   validator.New(),
+	}
+}
+
+// ListCases 获取评测用例（管理员），可按suite过滤
+func (h *EvalHandler) ListCases(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	cases, total, err := h.evalService.ListCases(c.Query("suite"), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, cases, total, page, pageSize)
+}
+
+// CreateCase 添加评测用例（管理员）
+func (h *EvalHandler) CreateCase(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.SaveEvalCaseRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	evalCase, err := h.evalService.CreateCase(userID.(uint), &req)
+	if err != nil {
+		c.JSON(evalErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Evaluation case created successfully",
+		Data:    evalCase,
+	})
+}
+
+// UpdateCase 修改评测用例（管理员）
+func (h *EvalHandler) UpdateCase(ctx context.Context, c *app.RequestContext) {
+	caseID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid case ID"})
+		return
+	}
+
+	var req service.SaveEvalCaseRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	evalCase, err := h.evalService.UpdateCase(uint(caseID), &req)
+	if err != nil {
+		c.JSON(evalErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Evaluation case updated successfully",
+		Data:    evalCase,
+	})
+}
+
+// DeleteCase 删除评测用例（管理员）
+func (h *EvalHandler) DeleteCase(ctx context.Context, c *app.RequestContext) {
+	caseID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid case ID"})
+		return
+	}
+
+	if err := h.evalService.DeleteCase(uint(caseID)); err != nil {
+		c.JSON(evalErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Evaluation case deleted successfully",
+	})
+}
+
+// StartRun 以指定的模型和系统提示词版本异步执行评测套件（管理员），进度通过任务事件获取
+func (h *EvalHandler) StartRun(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.StartEvalRunRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	started, err := h.evalService.StartRun(userID.(uint), &req)
+	if err != nil {
+		c.JSON(evalErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusAccepted, SuccessResponse{
+		Message: "Evaluation run queued",
+		Data:    started,
+	})
+}
+
+// ListRuns 获取评测执行记录（管理员），可按suite过滤
+func (h *EvalHandler) ListRuns(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	runs, total, err := h.evalService.ListRuns(c.Query("suite"), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, runs, total, page, pageSize)
+}
+
+// GetRun 获取评测执行记录及各用例的回答和得分（管理员）
+func (h *EvalHandler) GetRun(ctx context.Context, c *app.RequestContext) {
+	runID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid run ID"})
+		return
+	}
+
+	run, err := h.evalService.GetRun(uint(runID))
+	if err != nil {
+		c.JSON(evalErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Evaluation run retrieved successfully",
+		Data:    run,
+	})
+}
+
+// CreateReport 对比两次评测执行并保存报告（管理员）
+func (h *EvalHandler) CreateReport(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreateEvalReportRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	report, err := h.evalService.CreateReport(userID.(uint), &req)
+	if err != nil {
+		c.JSON(evalErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Evaluation report created successfully",
+		Data:    report,
+	})
+}
+
+// ListReports 获取评测对比报告（管理员）
+func (h *EvalHandler) ListReports(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	reports, total, err := h.evalService.ListReports(page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, reports, total, page, pageSize)
+}
+
+// GetReport 获取评测对比报告及各用例的得分对比（管理员）
+func (h *EvalHandler) GetReport(ctx context.Context, c *app.RequestContext) {
+	reportID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid report ID"})
+		return
+	}
+
+	report, err := h.evalService.GetReport(uint(reportID))
+	if err != nil {
+		c.JSON(evalErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Evaluation report retrieved successfully",
+		Data:    report,
+	})
+}
+
+func evalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrEvalCaseInvalid), errors.Is(err, service.ErrEvalRunInvalid):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrEvalCaseNotFound), errors.Is(err, service.ErrEvalRunNotFound), errors.Is(err, service.ErrEvalReportNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrJobQueueFull):
+		return consts.StatusServiceUnavailable
+	}
+	return consts.StatusInternalServerError
+}
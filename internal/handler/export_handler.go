@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type ExportHandler struct {
+	exportService *service.ExportService
+	frontendURL   string
+	validator     *validator.Validate
+}
+
+// NewExportHandler frontendURL用于OAuth回调完成后跳转回前端的集成设置页
+func NewExportHandler(exportService *service.ExportService, frontendURL string) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		frontendURL:   strings.TrimRight(frontendURL, "/"),
+		validator:     validator.New(),
+	}
+}
+
+// Markdown 下载会话的markdown
+func (h *ExportHandler) Markdown(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	_, markdown, err := h.exportService.Markdown(ctx, userID.(uint), uint(conversationID))
+	if err != nil {
+		c.JSON(exportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%d.md"`, conversationID))
+	c.Data(consts.StatusOK, "text/markdown; charset=utf-8", []byte(markdown))
+}
+
+// Push 将会话导出到已授权的Notion或Google文档
+func (h *ExportHandler) Push(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req service.ExportRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	result, err := h.exportService.Push(ctx, userID.(uint), uint(conversationID), c.Param("provider"), &req)
+	if err != nil {
+		c.JSON(exportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Conversation exported successfully",
+		Data:    result,
+	})
+}
+
+// ListIntegrations 获取已授权的导出集成
+func (h *ExportHandler) ListIntegrations(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	integrations, err := h.exportService.ListIntegrations(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Integrations retrieved successfully",
+		Data:    integrations,
+	})
+}
+
+// Authorize 获取服务方的授权地址，前端跳转到该地址完成授权
+func (h *ExportHandler) Authorize(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	authURL, err := h.exportService.AuthorizeURL(userID.(uint), c.Param("provider"))
+	if err != nil {
+		c.JSON(exportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Authorization URL generated successfully",
+		Data:    map[string]string{"url": authURL},
+	})
+}
+
+// Disconnect 删除导出集成的授权
+func (h *ExportHandler) Disconnect(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	if err := h.exportService.Disconnect(userID.(uint), c.Param("provider")); err != nil {
+		c.JSON(exportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "Integration disconnected successfully"})
+}
+
+// Callback 服务方的OAuth回调（公开访问），带着授权码和state跳转回前端，由前端在登录状态下调用Connect完成授权。
+// 回调中无法确认浏览器里的用户就是发起授权的用户，因此不在这里换取令牌
+func (h *ExportHandler) Callback(ctx context.Context, c *app.RequestContext) {
+	c.Redirect(consts.StatusFound, []byte(oauthCallbackRedirect(h.frontendURL, c.Param("provider"), c)))
+}
+
+// Connect 以回调带回的授权码和state完成授权，state必须由当前用户发起且只能使用一次
+func (h *ExportHandler) Connect(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.ConnectIntegrationRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	provider := c.Param("provider")
+	if err := h.exportService.Connect(ctx, userID.(uint), provider, &req); err != nil {
+		log.Printf("Failed to connect %s integration: %v", provider, err)
+		c.JSON(exportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "Integration connected successfully"})
+}
+
+// oauthCallbackRedirect 回调跳转回前端集成设置页的地址，用户在授权页拒绝时服务方带回error参数
+func oauthCallbackRedirect(frontendURL, provider string, c *app.RequestContext) string {
+	query := url.Values{"provider": {provider}}
+	if denied := c.Query("error"); denied != "" {
+		query.Set("error", denied)
+	} else {
+		query.Set("code", c.Query("code"))
+		query.Set("state", c.Query("state"))
+	}
+	return frontendURL + "/settings/integrations?" + query.Encode()
+}
+
+func exportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConversationNotFound), errors.Is(err, service.ErrIntegrationNotConnected):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrIntegrationDisabled), errors.Is(err, service.ErrColdStorageDisabled):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrExportTargetRequired), errors.Is(err, service.ErrIncognitoExport), errors.Is(err, service.ErrInvalidOAuthState):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrIntegrationExpired):
+		return consts.StatusConflict
+	default:
+		return consts.StatusInternalServerError
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type FeedbackHandler struct {
+	feedbackService *service.FeedbackService
+	validator       *validator.Validate
+}
+
+func NewFeedbackHandler(feedbackService *service.FeedbackService) *FeedbackHandler {
+	return &FeedbackHandler{
+		feedbackService: feedbackService,
+		validator:       validator.New(),
+	}
+}
+
+// RateMessage 评价AI回复（赞或踩），再次评价时覆盖
+func (h *FeedbackHandler) RateMessage(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, messageID, ok := feedbackParams(c)
+	if !ok {
+		return
+	}
+
+	var req service.RateMessageRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	feedback, err := h.feedbackService.Rate(userID.(uint), conversationID, messageID, &req)
+	if err != nil {
+		c.JSON(feedbackErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Feedback saved successfully",
+		Data:    feedback,
+	})
+}
+
+// RemoveRating 撤销对AI回复的评价
+func (h *FeedbackHandler) RemoveRating(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, messageID, ok := feedbackParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.feedbackService.Remove(userID.(uint), conversationID, messageID); err != nil {
+		c.JSON(feedbackErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "Feedback removed successfully"})
+}
+
+// feedbackParams 解析会话ID和消息ID，失败时已写入响应
+func feedbackParams(c *app.RequestContext) (uint, uint, bool) {
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return 0, 0, false
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid message ID"})
+		return 0, 0, false
+	}
+	return uint(conversationID), uint(messageID), true
+}
+
+func feedbackErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrMessageNotFound), errors.Is(err, service.ErrFeedbackNotFound):
+		return consts.StatusNotFound
+	default:
+		return consts.StatusInternalServerError
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type GuestHandler struct {
+	guestService   *service.GuestService
+	consentService *service.ConsentService
+	validator      *validator.Validate
+}
+
+func NewGuestHandler(guestService *service.GuestService, consentService *service.ConsentService) *GuestHandler {
+	return &GuestHandler{
+		guestService:   guestService,
+		consentService: consentService,
+		validator:      validator.New(),
+	}
+}
+
+// CreateGuest 签发访客token，未注册即可发送少量免费消息
+func (h *GuestHandler) CreateGuest(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		AcceptTerms bool `json:"accept_terms"`
+	}
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	session, err := h.guestService.Create(ctx, c.ClientIP(), string(c.UserAgent()))
+	if err != nil {
+		c.JSON(guestErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if req.AcceptTerms {
+		if err := h.consentService.AcceptCurrent(session.User.ID, c.ClientIP()); err != nil {
+			log.Printf("Failed to record consent for guest %d: %v", session.User.ID, err)
+		}
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Guest session created",
+		Data:    session,
+	})
+}
+
+func guestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrGuestUnavailable):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrGuestTokenLimit), errors.Is(err, service.ErrGuestQuotaExceeded):
+		return consts.StatusTooManyRequests
+	case errors.Is(err, service.ErrGuestBlocked), errors.Is(err, service.ErrGuestClientRejected):
+		return consts.StatusForbidden
+	default:
+		return consts.StatusInternalServerError
+	}
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type ImpersonationHandler struct {
+	impersonationService *service.ImpersonationService
+	validator            *validator.Validate
+}
+
+func NewImpersonationHandler(impersonationService *service.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonationService: impersonationService,
+		validator:            validator.New(),
+	}
+}
+
+// Create 请求代入用户身份（管理员），需要用户同意时返回202且不含token
+func (h *ImpersonationHandler) Create(ctx context.Context, c *app.RequestContext) {
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	var req service.CreateImpersonationRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	grant, err := h.impersonationService.Create(adminID.(uint), uint(targetID), &req, c.ClientIP())
+	if err != nil {
+		c.JSON(impersonationErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if grant.Token == "" {
+		c.JSON(consts.StatusAccepted, SuccessResponse{
+			Message: "Impersonation requested, waiting for user consent",
+			Data:    grant,
+		})
+		return
+	}
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Impersonation started successfully",
+		Data:    grant,
+	})
+}
+
+// IssueToken 获取用户已同意的代入会话的token（管理员）
+func (h *ImpersonationHandler) IssueToken(ctx context.Context, c *app.RequestContext) {
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	impersonationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid impersonation ID"})
+		return
+	}
+
+	grant, err := h.impersonationService.IssueToken(adminID.(uint), uint(impersonationID), c.ClientIP())
+	if err != nil {
+		c.JSON(impersonationErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Impersonation started successfully",
+		Data:    grant,
+	})
+}
+
+// List 获取代入会话（管理员），可按user_id、admin_id筛选
+func (h *ImpersonationHandler) List(ctx context.Context, c *app.RequestContext) {
+	page, pageSize := pagination(c, 20)
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 32)
+	adminID, _ := strconv.ParseUint(c.Query("admin_id"), 10, 32)
+
+	impersonations, total, err := h.impersonationService.List(uint(userID), uint(adminID), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, impersonations, total, page, pageSize)
+}
+
+// Get 获取代入会话及其审计记录（管理员）
+func (h *ImpersonationHandler) Get(ctx context.Context, c *app.RequestContext) {
+	impersonationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid impersonation ID"})
+		return
+	}
+
+	detail, err := h.impersonationService.Detail(uint(impersonationID))
+	if err != nil {
+		c.JSON(impersonationErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Impersonation retrieved successfully",
+		Data:    detail,
+	})
+}
+
+// End 结束代入会话，管理员和被代入的用户都可以调用
+func (h *ImpersonationHandler) End(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	impersonationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid impersonation ID"})
+		return
+	}
+
+	if err := h.impersonationService.End(userID.(uint), uint(impersonationID), c.ClientIP()); err != nil {
+		c.JSON(impersonationErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{Message: "Impersonation ended successfully"})
+}
+
+// ListMine 获取当前用户账号上的代入会话
+func (h *ImpersonationHandler) ListMine(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	impersonations, err := h.impersonationService.ListForUser(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Impersonations retrieved successfully",
+		Data:    impersonations,
+	})
+}
+
+// Approve 同意管理员的代入请求
+func (h *ImpersonationHandler) Approve(ctx context.Context, c *app.RequestContext) {
+	h.respond(c, true)
+}
+
+// Deny 拒绝管理员的代入请求
+func (h *ImpersonationHandler) Deny(ctx context.Context, c *app.RequestContext) {
+	h.respond(c, false)
+}
+
+func (h *ImpersonationHandler) respond(c *app.RequestContext, approve bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	impersonationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid impersonation ID"})
+		return
+	}
+
+	impersonation, err := h.impersonationService.Respond(userID.(uint), uint(impersonationID), approve, c.ClientIP())
+	if err != nil {
+		c.JSON(impersonationErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Impersonation " + impersonation.Status,
+		Data:    impersonation,
+	})
+}
+
+func impersonationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrImpersonationNotFound), errors.Is(err, service.ErrUserNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrImpersonationNotAllowed):
+		return consts.StatusForbidden
+	case errors.Is(err, service.ErrImpersonationState):
+		return consts.StatusConflict
+	default:
+		return consts.StatusInternalServerError
+	}
+}
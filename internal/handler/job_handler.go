@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"ai-chat-backend/internal/service"
+	sseImpl "ai-chat-backend/internal/utils"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/hertz-contrib/sse"
+)
+
+// jobPollInterval 任务可能由其他实例执行，推送之外定期查询任务状态
+const jobPollInterval = 2 * time.Second
+
+type JobHandler struct {
+	jobService *service.JobService
+}
+
+func NewJobHandler(jobService *service.JobService) *JobHandler {
+	return &JobHandler{
+		jobService: jobService,
+	}
+}
+
+// GetJob 获取后台任务的状态、进度和结果
+func (h *JobHandler) GetJob(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.Get(userID.(uint), uint(jobID))
+	if err != nil {
+		c.JSON(jobErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Job retrieved successfully",
+		Data:    job,
+	})
+}
+
+// StreamJob 以SSE推送任务进度直到任务结束（token通过URL参数由QueryAuth中间件验证）
+func (h *JobHandler) StreamJob(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid job ID"})
+		return
+	}
+
+	// 先监听再读取当前状态，避免两者之间的变化丢失
+	events, cancel := h.jobService.Listen(uint(jobID))
+	defer cancel()
+	job, err := h.jobService.Get(userID.(uint), uint(jobID))
+	if err != nil {
+		c.JSON(jobErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
+	sseSender := sseImpl.NewSSESender(sse.NewStream(c))
+	send := func(event service.JobEvent) bool {
+		data, _ := json.Marshal(event)
+		if err := sseSender.Send(ctx, &sse.Event{Data: data}); err != nil {
+			log.Printf("Error sending job event: %v", err)
+			return false
+		}
+		return !event.Finished()
+	}
+
+	last := service.JobEventOf(job)
+	if !send(last) {
+		return
+	}
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// 本实例上的监听已结束，改为查询
+				events = nil
+				continue
+			}
+			last = event
+			if !send(event) {
+				return
+			}
+		case <-ticker.C:
+			job, err := h.jobService.Get(userID.(uint), uint(jobID))
+			if err != nil {
+				log.Printf("Error polling job %d: %v", jobID, err)
+				continue
+			}
+			current := service.JobEventOf(job)
+			if current.Status == last.Status && current.Progress == last.Progress && current.Message == last.Message {
+				continue
+			}
+			last = current
+			if !send(current) {
+				return
+			}
+		}
+	}
+}
+
+func jobErrorStatus(err error) int {
+	if errors.Is(err, service.ErrJobNotFound) {
+		return consts.StatusNotFound
+	}
+	return consts.StatusInternalServerError
+}
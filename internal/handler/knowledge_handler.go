@@ -0,0 +1,428 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type KnowledgeHandler struct {
+	knowledgeService *service.KnowledgeService
+	validator        *validator.Validate
+}
+
+func NewKnowledgeHandler(knowledgeService *service.KnowledgeService) *KnowledgeHandler {
+	return &KnowledgeHandler{
+		knowledgeService: knowledgeService,
+		validator:        validator.New(),
+	}
+}
+
+// ListCollections 获取知识库列表
+func (h *KnowledgeHandler) ListCollections(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	collections, err := h.knowledgeService.ListCollections(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Collections retrieved successfully",
+		Data:    collections,
+	})
+}
+
+// CreateCollection 创建知识库
+func (h *KnowledgeHandler) CreateCollection(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CollectionRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	collection, err := h.knowledgeService.CreateCollection(userID.(uint), &req)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Collection created successfully",
+		Data:    collection,
+	})
+}
+
+// UpdateCollection 更新知识库的名称、描述和分块设置
+func (h *KnowledgeHandler) UpdateCollection(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	collectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID"})
+		return
+	}
+
+	var req service.UpdateCollectionRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	collection, err := h.knowledgeService.UpdateCollection(userID.(uint), uint(collectionID), &req)
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Collection updated successfully",
+		Data:    collection,
+	})
+}
+
+// ReindexCollection 按当前分块设置重新索引知识库中的文档，all=true时包括未过期和提取失败的文档
+func (h *KnowledgeHandler) ReindexCollection(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	collectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID"})
+		return
+	}
+
+	queued, err := h.knowledgeService.ReindexCollection(userID.(uint), uint(collectionID), c.Query("all") == "true")
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusAccepted, SuccessResponse{
+		Message: "Documents queued for reindexing",
+		Data:    map[string]int{"queued": queued},
+	})
+}
+
+// SearchCollection 在知识库中检索，返回命中的分块及各路检索的得分，用于调试检索效果
+func (h *KnowledgeHandler) SearchCollection(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	collectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID"})
+		return
+	}
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Query is required"})
+		return
+	}
+	topK, _ := strconv.Atoi(c.DefaultQuery("top_k", "0"))
+	if topK < 0 || topK > 50 {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "top_k must be between 1 and 50"})
+		return
+	}
+
+	result, err := h.knowledgeService.SearchCollection(ctx, userID.(uint), uint(collectionID), query, topK)
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Search completed successfully",
+		Data:    result,
+	})
+}
+
+// DeleteCollection 删除知识库及其中的文档
+func (h *KnowledgeHandler) DeleteCollection(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	collectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID"})
+		return
+	}
+
+	if err := h.knowledgeService.DeleteCollection(userID.(uint), uint(collectionID)); err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Collection deleted successfully",
+	})
+}
+
+// ListDocuments 获取知识库中的文档及其处理状态
+func (h *KnowledgeHandler) ListDocuments(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	collectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID"})
+		return
+	}
+
+	documents, err := h.knowledgeService.ListDocuments(userID.(uint), uint(collectionID))
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Documents retrieved successfully",
+		Data:    documents,
+	})
+}
+
+// AddDocument 将已上传的附件加入知识库，提取在后台进行
+func (h *KnowledgeHandler) AddDocument(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	collectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID"})
+		return
+	}
+
+	var req service.AddDocumentRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	document, err := h.knowledgeService.AddDocument(userID.(uint), uint(collectionID), &req)
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusAccepted, SuccessResponse{
+		Message: "Document queued for processing",
+		Data:    document,
+	})
+}
+
+// GetDocument 获取文档及其提取报告
+func (h *KnowledgeHandler) GetDocument(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid document ID"})
+		return
+	}
+
+	document, err := h.knowledgeService.GetDocument(userID.(uint), uint(documentID))
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Document retrieved successfully",
+		Data:    document,
+	})
+}
+
+// GetDocumentChunks 获取文档的分块
+func (h *KnowledgeHandler) GetDocumentChunks(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid document ID"})
+		return
+	}
+
+	chunks, err := h.knowledgeService.DocumentChunks(userID.(uint), uint(documentID))
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Document chunks retrieved successfully",
+		Data:    chunks,
+	})
+}
+
+// RecrawlDocument 立即重新抓取网页文档，内容变化时重新索引
+func (h *KnowledgeHandler) RecrawlDocument(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid document ID"})
+		return
+	}
+
+	if err := h.knowledgeService.RecrawlDocument(userID.(uint), uint(documentID)); err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusAccepted, SuccessResponse{
+		Message: "Document queued for crawling",
+	})
+}
+
+// DeleteDocument 从知识库中删除文档
+func (h *KnowledgeHandler) DeleteDocument(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid document ID"})
+		return
+	}
+
+	if err := h.knowledgeService.DeleteDocument(userID.(uint), uint(documentID)); err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Document deleted successfully",
+	})
+}
+
+// ListConversationCollections 获取用户的知识库及在会话中的启用状态
+func (h *KnowledgeHandler) ListConversationCollections(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	collections, err := h.knowledgeService.ConversationCollections(userID.(uint), uint(conversationID))
+	if err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Conversation collections retrieved successfully",
+		Data:    collections,
+	})
+}
+
+// SetConversationCollection 为会话启用或停用知识库
+func (h *KnowledgeHandler) SetConversationCollection(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+	collectionID, err := strconv.ParseUint(c.Param("collection_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID"})
+		return
+	}
+
+	var req service.SetConversationCollectionRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.knowledgeService.SetConversationCollection(userID.(uint), uint(conversationID), uint(collectionID), &req); err != nil {
+		c.JSON(knowledgeErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Conversation collection updated successfully",
+	})
+}
+
+func knowledgeErrorStatus(err error) int {
+	if status, ok := entitlementStatus(err); ok {
+		return status
+	}
+	switch {
+	case errors.Is(err, service.ErrCollectionNotFound),
+		errors.Is(err, service.ErrDocumentNotFound),
+		errors.Is(err, service.ErrConversationNotFound),
+		errors.Is(err, service.ErrOrgNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrOrgForbidden):
+		return consts.StatusForbidden
+	case errors.Is(err, service.ErrDocumentUnsupported):
+		return consts.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrInvalidChunking),
+		errors.Is(err, service.ErrDocumentNotCrawlable):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrJobQueueFull):
+		return consts.StatusServiceUnavailable
+	}
+	return attachmentErrorStatus(err)
+}
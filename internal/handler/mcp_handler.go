@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type MCPHandler struct {
+	mcpService *service.MCPService
+}
+
+func NewMCPHandler(mcpService *service.MCPService) *MCPHandler {
+	return &MCPHandler{
+		mcpService: mcpService,
+	}
+}
+
+// Handle MCP Streamable HTTP端点，每个请求返回一个JSON响应，通知返回202
+func (h *MCPHandler) Handle(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	reply := h.mcpService.Handle(ctx, userID.(uint), c.Request.Body())
+	if reply == nil {
+		c.Status(consts.StatusAccepted)
+		return
+	}
+	c.Data(consts.StatusOK, "application/json", reply)
+}
+
+// Stream 服务端不主动推送消息，按规范对GET返回405
+func (h *MCPHandler) Stream(ctx context.Context, c *app.RequestContext) {
+	c.Header("Allow", consts.MethodPost)
+	c.Status(consts.StatusMethodNotAllowed)
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// 回调只把授权码和state交给前端，由登录用户提交完成授权
+func TestOAuthCallbackRedirect(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  url.Values
+	}{
+		{
+			name:  "authorized",
+			query: "code=abc&state=xyz",
+			want:  url.Values{"provider": {"notion"}, "code": {"abc"}, "state": {"xyz"}},
+		},
+		{
+			name:  "denied",
+			query: "error=access_denied&state=xyz",
+			want:  url.Values{"provider": {"notion"}, "error": {"access_denied"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := app.NewContext(0)
+			c.Request.SetRequestURI("/api/v1/integrations/export/notion/callback?" + tt.query)
+
+			location := oauthCallbackRedirect("https://app.example.com", "notion", c)
+			u, err := url.Parse(location)
+			if err != nil {
+				t.Fatalf("parse %q: %v", location, err)
+			}
+			if u.Path != "/settings/integrations" {
+				t.Errorf("path = %q", u.Path)
+			}
+			if got := u.Query(); got.Encode() != tt.want.Encode() {
+				t.Errorf("query = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
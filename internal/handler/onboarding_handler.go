@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"context"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type OnboardingHandler struct {
+	onboardingService *service.OnboardingService
+}
+
+func NewOnboardingHandler(onboardingService *service.OnboardingService) *OnboardingHandler {
+	return &OnboardingHandler{
+		onboardingService: onboardingService,
+	}
+}
+
+// GetOnboarding 获取新手引导清单及进度
+func (h *OnboardingHandler) GetOnboarding(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	status, err := h.onboardingService.Status(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Onboarding retrieved successfully",
+		Data:    status,
+	})
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type OrgHandler struct {
+	orgService *service.OrgService
+	validator  *validator.Validate
+}
+
+func NewOrgHandler(orgService *service.OrgService) *OrgHandler {
+	return &OrgHandler{
+		orgService: orgService,
+		validator:  validator.New(),
+	}
+}
+
+// CreateOrg 创建组织
+func (h *OrgHandler) CreateOrg(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreateOrgRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	org, err := h.orgService.CreateOrg(userID.(uint), &req)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Organization created successfully",
+		Data:    org,
+	})
+}
+
+// ListOrgs 获取所在的组织
+func (h *OrgHandler) ListOrgs(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	orgs, err := h.orgService.ListOrgs(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Organizations retrieved successfully",
+		Data:    orgs,
+	})
+}
+
+// AddMember 添加组织成员（组织管理员）
+func (h *OrgHandler) AddMember(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid organization ID"})
+		return
+	}
+
+	var req service.AddOrgMemberRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	member, err := h.orgService.AddMember(userID.(uint), uint(orgID), &req)
+	if err != nil {
+		c.JSON(orgErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Member added successfully",
+		Data:    member,
+	})
+}
+
+// RemoveMember 移除组织成员（组织管理员）
+func (h *OrgHandler) RemoveMember(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid organization ID"})
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if err := h.orgService.RemoveMember(userID.(uint), uint(orgID), uint(memberID)); err != nil {
+		c.JSON(orgErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Member removed successfully",
+	})
+}
+
+// ListEndpoints 获取组织的模型服务
+func (h *OrgHandler) ListEndpoints(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid organization ID"})
+		return
+	}
+
+	endpoints, err := h.orgService.ListEndpoints(userID.(uint), uint(orgID))
+	if err != nil {
+		c.JSON(orgErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Model endpoints retrieved successfully",
+		Data:    endpoints,
+	})
+}
+
+// CreateEndpoint 注册组织模型服务（组织管理员），保存前校验连通性
+func (h *OrgHandler) CreateEndpoint(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid organization ID"})
+		return
+	}
+
+	var req service.CreateModelEndpointRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	endpoint, err := h.orgService.CreateEndpoint(ctx, userID.(uint), uint(orgID), &req)
+	if err != nil {
+		c.JSON(orgErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Model endpoint created successfully",
+		Data:    endpoint,
+	})
+}
+
+// DeleteEndpoint 删除组织模型服务（组织管理员）
+func (h *OrgHandler) DeleteEndpoint(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid organization ID"})
+		return
+	}
+	endpointID, err := strconv.ParseUint(c.Param("endpoint_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid endpoint ID"})
+		return
+	}
+
+	if err := h.orgService.DeleteEndpoint(userID.(uint), uint(orgID), uint(endpointID)); err != nil {
+		c.JSON(orgErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Model endpoint deleted successfully",
+	})
+}
+
+func orgErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrOrgNotFound),
+		errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrModelEndpointNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrOrgForbidden):
+		return consts.StatusForbidden
+	case errors.Is(err, service.ErrOrgMemberExists):
+		return consts.StatusConflict
+	case errors.Is(err, service.ErrModelEndpointInvalid), errors.Is(err, service.ErrEndpointURL):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrRegionMismatch):
+		return consts.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrBYOKDisabled):
+		return consts.StatusServiceUnavailable
+	}
+	return consts.StatusInternalServerError
+}
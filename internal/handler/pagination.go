@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// maxPageSize 列表接口允许的最大page_size
+const maxPageSize = 100
+
+// PageResponse 所有分页列表接口统一的响应结构
+type PageResponse struct {
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// Pagination 分页信息，Next/Prev为下一页、上一页的地址（不含域名），没有时为空。
+// 同样的链接以RFC 5988格式在Link响应头中返回
+type Pagination struct {
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	Total      int64  `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
+}
+
+// pagination 读取page、page_size参数，page小于1时为1，page_size超出1-100时使用defaultSize
+func pagination(c *app.RequestContext, defaultSize int) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultSize)))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > maxPageSize {
+		pageSize = defaultSize
+	}
+	return page, pageSize
+}
+
+// writePage 以统一的分页结构返回列表，并在Link头中给出first、last以及存在时的next、prev链接，
+// 链接保留请求的其他查询参数
+func writePage(c *app.RequestContext, data interface{}, total int64, page, pageSize int) {
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	result := Pagination{
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		TotalPages: totalPages,
+	}
+
+	lastPage := totalPages
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	links := []string{
+		pageLink(c, 1, pageSize, "first"),
+		pageLink(c, lastPage, pageSize, "last"),
+	}
+	if page < totalPages {
+		result.Next = pageURL(c, page+1, pageSize)
+		links = append(links, pageLink(c, page+1, pageSize, "next"))
+	}
+	if page > 1 {
+		// 超出末页时上一页指向末页
+		prev := page - 1
+		if prev > lastPage {
+			prev = lastPage
+		}
+		result.Prev = pageURL(c, prev, pageSize)
+		links = append(links, pageLink(c, prev, pageSize, "prev"))
+	}
+	c.Header("Link", strings.Join(links, ", "))
+
+	c.JSON(consts.StatusOK, PageResponse{Data: data, Pagination: result})
+}
+
+// pageURL 当前请求地址替换page、page_size后的路径和查询参数
+func pageURL(c *app.RequestContext, page, pageSize int) string {
+	var uri protocol.URI
+	c.URI().CopyTo(&uri)
+	uri.QueryArgs().Set("page", strconv.Itoa(page))
+	uri.QueryArgs().Set("page_size", strconv.Itoa(pageSize))
+	return string(uri.RequestURI())
+}
+
+func pageLink(c *app.RequestContext, page, pageSize int, rel string) string {
+	return "<" + pageURL(c, page, pageSize) + `>; rel="` + rel + `"`
+}
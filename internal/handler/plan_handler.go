@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+)
+
+type PlanHandler struct {
+	planService *service.PlanService
+}
+
+func NewPlanHandler(planService *service.PlanService) *PlanHandler {
+	return &PlanHandler{
+		planService: planService,
+	}
+}
+
+// GetPlan 获取用户当前套餐及用量
+func (h *PlanHandler) GetPlan(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	usage, err := h.planService.GetUsage(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Plan retrieved successfully",
+		Data:    usage,
+	})
+}
+
+// GetUsage 获取用户当天的用量、套餐的每日额度及最近days天（默认7天）的每日用量
+func (h *PlanHandler) GetUsage(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid days"})
+		return
+	}
+
+	report, err := h.planService.GetUsageReport(userID.(uint), days)
+	if errors.Is(err, service.ErrInvalidUsageDays) {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Usage retrieved successfully",
+		Data:    report,
+	})
+}
+
+// usageExportFlushRows 导出用量时每写入多少行刷新一次输出
+const usageExportFlushRows = 100
+
+// ExportUsage 以CSV流式导出按日期和模型汇总的token用量和费用，from/to为YYYY-MM-DD，默认最近30天
+func (h *PlanHandler) ExportUsage(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	if format := c.DefaultQuery("format", "csv"); format != "csv" {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Unsupported export format"})
+		return
+	}
+	from, to, err := service.ParseUsageRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "from and to must be dates (YYYY-MM-DD) within one year, from not after to"})
+		return
+	}
+
+	c.SetContentType("text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s-%s.csv"`, from, to))
+	c.SetStatusCode(consts.StatusOK)
+	c.Response.HijackWriter(resp.NewChunkedBodyWriter(&c.Response, c.GetWriter()))
+
+	w := csv.NewWriter(c)
+	written := 0
+	flush := func() error {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		return c.Flush()
+	}
+	_ = w.Write([]string{"date", "model", "generations", "prompt_tokens", "completion_tokens", "total_tokens", "cost", "estimated"})
+	err = h.planService.ExportUsage(userID.(uint), from, to, func(row service.UsageExportRow) error {
+		if err := w.Write([]string{
+			row.Date,
+			row.Model,
+			strconv.FormatInt(row.Generations, 10),
+			strconv.FormatInt(row.PromptTokens, 10),
+			strconv.FormatInt(row.CompletionTokens, 10),
+			strconv.FormatInt(row.TotalTokens, 10),
+			strconv.FormatFloat(row.Cost, 'f', 6, 64),
+			strconv.FormatBool(row.Estimated),
+		}); err != nil {
+			return err
+		}
+		written++
+		if written%usageExportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	// 响应头已发出，出错时只能中断输出
+	if err != nil {
+		log.Printf("Failed to export usage for user %d: %v", userID.(uint), err)
+	}
+}
+
+// entitlementStatus 将套餐额度/余额错误映射为HTTP状态码，非额度错误返回false
+func entitlementStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, service.ErrMessageLimitReached),
+		errors.Is(err, service.ErrTokenLimitReached):
+		return consts.StatusTooManyRequests, true
+	case errors.Is(err, service.ErrInsufficientCredits):
+		return consts.StatusPaymentRequired, true
+	case errors.Is(err, service.ErrConversationLimitReached),
+		errors.Is(err, service.ErrModelNotAllowed),
+		errors.Is(err, service.ErrStorageLimitReached):
+		return consts.StatusForbidden, true
+	}
+	return 0, false
+}
+
+// QuotaExceededResponse 每日额度用尽时的429响应，客户端可据此显示已用量和重置时间
+type QuotaExceededResponse struct {
+	Error   string    `json:"error"`
+	Code    string    `json:"code"`
+	Quota   string    `json:"quota"`
+	Limit   int64     `json:"limit"`
+	Used    int64     `json:"used"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// writeEntitlementError err为套餐额度/余额错误时写入响应并返回true，每日额度用尽时返回结构化的429并设置Retry-After
+func writeEntitlementError(c *app.RequestContext, err error) bool {
+	var exceeded *service.QuotaExceededError
+	if errors.As(err, &exceeded) {
+		retryAfter := int(math.Ceil(time.Until(exceeded.ResetAt).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		c.JSON(consts.StatusTooManyRequests, QuotaExceededResponse{
+			Error:   err.Error(),
+			Code:    "quota_exceeded",
+			Quota:   exceeded.Quota,
+			Limit:   exceeded.Limit,
+			Used:    exceeded.Used,
+			ResetAt: exceeded.ResetAt,
+		})
+		return true
+	}
+	status, ok := entitlementStatus(err)
+	if ok {
+		c.JSON(status, ErrorResponse{Error: err.Error()})
+	}
+	return ok
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type PromoHandler struct {
+	promoService *service.PromoService
+	validator    *validator.Validate
+}
+
+func NewPromoHandler(promoService *service.PromoService) *PromoHandler {
+	return &PromoHandler{
+		promoService: promoService,
+		validator:    validator.New(),
+	}
+}
+
+// CreateCode 创建优惠码（管理员）
+func (h *PromoHandler) CreateCode(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreatePromoCodeRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	promo, err := h.promoService.CreateCode(userID.(uint), &req)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Promo code created successfully",
+		Data:    promo,
+	})
+}
+
+// ListCodes 获取优惠码列表（管理员）
+func (h *PromoHandler) ListCodes(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	codes, total, err := h.promoService.ListCodes(page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, codes, total, page, pageSize)
+}
+
+// Redeem 兑换优惠码
+func (h *PromoHandler) Redeem(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.RedeemPromoRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	result, err := h.promoService.Redeem(userID.(uint), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPromoInvalid):
+			c.JSON(consts.StatusNotFound, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrPromoExpired),
+			errors.Is(err, service.ErrPromoExhausted),
+			errors.Is(err, service.ErrPromoRedeemed),
+			errors.Is(err, service.ErrPromoPlanNotApplicable):
+			c.JSON(consts.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Promo code redeemed successfully",
+		Data:    result,
+	})
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type PromptHandler struct {
+	promptService *service.PromptService
+	validator     *validator.Validate
+}
+
+func NewPromptHandler(promptService *service.PromptService) *PromptHandler {
+	return &PromptHandler{
+		promptService: promptService,
+		validator:     validator.New(),
+	}
+}
+
+// ListTemplates 获取提示词模板及其当前版本（管理员）
+func (h *PromptHandler) ListTemplates(ctx context.Context, c *app.RequestContext) {
+	templates, err := h.promptService.ListTemplates()
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Prompt templates retrieved successfully",
+		Data:    templates,
+	})
+}
+
+// ListVersions 获取提示词模板的全部版本（管理员）
+func (h *PromptHandler) ListVersions(ctx context.Context, c *app.RequestContext) {
+	versions, err := h.promptService.ListVersions(c.Param("name"))
+	if err != nil {
+		c.JSON(promptErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Prompt template versions retrieved successfully",
+		Data:    versions,
+	})
+}
+
+// CreateVersion 发布提示词模板的新版本（管理员）
+func (h *PromptHandler) CreateVersion(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreatePromptVersionRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	version, err := h.promptService.CreateVersion(userID.(uint), c.Param("name"), &req)
+	if err != nil {
+		c.JSON(promptErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Prompt template version created successfully",
+		Data:    version,
+	})
+}
+
+// Rollback 回滚提示词模板，返回回滚后的当前版本（管理员）
+func (h *PromptHandler) Rollback(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.RollbackPromptRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	active, err := h.promptService.Rollback(userID.(uint), c.Param("name"), &req)
+	if err != nil {
+		c.JSON(promptErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Prompt template rolled back successfully",
+		Data:    service.PromptTemplateInfo{Name: c.Param("name"), Active: active},
+	})
+}
+
+func promptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrPromptTemplateInvalid):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrPromptTemplateNotFound):
+		return consts.StatusNotFound
+	}
+	return consts.StatusInternalServerError
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type ShareHandler struct {
+	shareService *service.ShareService
+	validator    *validator.Validate
+}
+
+func NewShareHandler(shareService *service.ShareService) *ShareHandler {
+	return &ShareHandler{
+		shareService: shareService,
+		validator:    validator.New(),
+	}
+}
+
+// ListShares 获取会话当前有效的分享链接
+func (h *ShareHandler) ListShares(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	shares, err := h.shareService.List(userID.(uint), uint(conversationID))
+	if err != nil {
+		c.JSON(shareErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Shares retrieved successfully",
+		Data:    shares,
+	})
+}
+
+// CreateShare 为会话创建只读分享链接
+func (h *ShareHandler) CreateShare(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req service.CreateShareRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	share, err := h.shareService.Create(userID.(uint), uint(conversationID), &req)
+	if err != nil {
+		c.JSON(shareErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Share created successfully",
+		Data:    share,
+	})
+}
+
+// RevokeShare 撤销分享链接
+func (h *ShareHandler) RevokeShare(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+	shareID, err := strconv.ParseUint(c.Param("share_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid share ID"})
+		return
+	}
+
+	if err := h.shareService.Revoke(userID.(uint), uint(conversationID), uint(shareID)); err != nil {
+		c.JSON(shareErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Share revoked successfully",
+	})
+}
+
+// ViewShare 通过分享链接查看会话，无需登录
+func (h *ShareHandler) ViewShare(ctx context.Context, c *app.RequestContext) {
+	viewer := service.ShareViewer{IP: c.ClientIP(), UserAgent: string(c.UserAgent())}
+	shared, err := h.shareService.View(ctx, c.Param("token"), viewer)
+	if err != nil {
+		c.JSON(shareErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Header("ETag", shared.ETag)
+	c.Header("Cache-Control", shareCacheControl(shared, config.Load().Share.CacheMaxAge))
+	// 访问已计数，内容未变化时不再返回正文
+	if etagMatches(string(c.GetHeader("If-None-Match")), shared.ETag) {
+		c.Status(consts.StatusNotModified)
+		return
+	}
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Shared conversation retrieved successfully",
+		Data:    shared,
+	})
+}
+
+// shareCacheControl 限制访问次数的链接每次访问都要计数，不允许缓存；其他链接只允许浏览器缓存maxAge，且不超过链接的剩余有效期。
+// 不允许CDN等共享缓存：共享缓存的命中不计访问，撤销也无法及时生效
+func shareCacheControl(shared *service.SharedConversation, maxAge time.Duration) string {
+	if shared.ViewsRemaining != nil || maxAge <= 0 {
+		return "no-cache"
+	}
+	if shared.ExpiresAt != nil {
+		maxAge = min(maxAge, time.Until(*shared.ExpiresAt))
+	}
+	seconds := int(maxAge / time.Second)
+	if seconds <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("private, max-age=%d", seconds)
+}
+
+// etagMatches If-None-Match中是否包含etag，忽略弱校验前缀
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Analytics 汇总最近days天（默认7，最多90）的分享链接访问统计（管理员）
+func (h *ShareHandler) Analytics(ctx context.Context, c *app.RequestContext) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > 90 {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "days must be between 1 and 90"})
+		return
+	}
+
+	analytics, err := h.shareService.Analytics(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Share analytics retrieved successfully",
+		Data:    analytics,
+	})
+}
+
+func shareErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConversationNotFound),
+		errors.Is(err, service.ErrShareNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrShareUnavailable):
+		return consts.StatusGone
+	case errors.Is(err, service.ErrShareLimitExceeded):
+		return consts.StatusConflict
+	case errors.Is(err, service.ErrShareIncognito):
+		return consts.StatusBadRequest
+	}
+	return consts.StatusInternalServerError
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/service"
+)
+
+func TestShareCacheControl(t *testing.T) {
+	remaining := 3
+	soon := time.Now().Add(30 * time.Second)
+	past := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name   string
+		shared service.SharedConversation
+		maxAge time.Duration
+		want   string
+	}{
+		{"unlimited link", service.SharedConversation{}, time.Minute, "private, max-age=60"},
+		{"caching disabled", service.SharedConversation{}, 0, "no-cache"},
+		{"view limited link", service.SharedConversation{ViewsRemaining: &remaining}, time.Minute, "no-cache"},
+		{"capped by expiry", service.SharedConversation{ExpiresAt: &soon}, time.Minute, "private, max-age=29"},
+		{"already expired", service.SharedConversation{ExpiresAt: &past}, time.Minute, "no-cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shareCacheControl(&tt.shared, tt.maxAge); got != tt.want {
+				t.Errorf("shareCacheControl = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+	"ai-chat-backend/internal/slack"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type SlackHandler struct {
+	slackService *service.SlackService
+}
+
+func NewSlackHandler(slackService *service.SlackService) *SlackHandler {
+	return &SlackHandler{
+		slackService: slackService,
+	}
+}
+
+// Events 接收Slack Events API推送，通过签名校验来源
+func (h *SlackHandler) Events(ctx context.Context, c *app.RequestContext) {
+	// 回复在后台生成，Slack因超时发起的重试直接确认，避免重复回复
+	if len(c.GetHeader("X-Slack-Retry-Num")) > 0 {
+		c.Status(consts.StatusOK)
+		return
+	}
+
+	challenge, err := h.slackService.HandleEvent(c.Request.Body(),
+		string(c.GetHeader("X-Slack-Request-Timestamp")), string(c.GetHeader("X-Slack-Signature")))
+	if err != nil {
+		if errors.Is(err, slack.ErrInvalidSignature) {
+			c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+			return
+		}
+		log.Printf("Failed to handle slack event: %v", err)
+		c.JSON(slackErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if challenge != "" {
+		c.JSON(consts.StatusOK, map[string]string{"challenge": challenge})
+		return
+	}
+	c.Status(consts.StatusOK)
+}
+
+// ListChannels 获取关联的Slack频道
+func (h *SlackHandler) ListChannels(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	links, err := h.slackService.ListLinks(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Slack channels retrieved successfully",
+		Data:    links,
+	})
+}
+
+// CreateLinkCode 生成Slack绑定码，在要关联的频道中发送绑定命令完成关联
+func (h *SlackHandler) CreateLinkCode(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	code, err := h.slackService.LinkCode(userID.(uint))
+	if err != nil {
+		c.JSON(slackErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Link code created successfully",
+		Data:    code,
+	})
+}
+
+// UnlinkChannel 取消关联Slack频道
+func (h *SlackHandler) UnlinkChannel(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid channel link ID"})
+		return
+	}
+
+	if err := h.slackService.UnlinkChannel(userID.(uint), uint(linkID)); err != nil {
+		c.JSON(slackErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Slack channel unlinked successfully",
+	})
+}
+
+func slackErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrSlackDisabled):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrChannelLinkNotFound):
+		return consts.StatusNotFound
+	}
+	return consts.StatusInternalServerError
+}
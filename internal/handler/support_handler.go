@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type SupportHandler struct {
+	supportService *service.SupportService
+	validator      *validator.Validate
+}
+
+func NewSupportHandler(supportService *service.SupportService) *SupportHandler {
+	return &SupportHandler{
+		supportService: supportService,
+		validator:      validator.New(),
+	}
+}
+
+// CreateTicket 提交工单，可关联会话并在用户同意时附带会话记录
+func (h *SupportHandler) CreateTicket(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreateTicketRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	ticket, err := h.supportService.CreateTicket(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(supportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Ticket created successfully",
+		Data:    ticket,
+	})
+}
+
+// ListTickets 获取自己的工单
+func (h *SupportHandler) ListTickets(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	page, pageSize := pagination(c, 20)
+	tickets, total, err := h.supportService.ListTickets(userID.(uint), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, tickets, total, page, pageSize)
+}
+
+// GetTicket 获取自己的工单及处理记录
+func (h *SupportHandler) GetTicket(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+
+	ticket, err := h.supportService.GetTicket(userID.(uint), uint(ticketID))
+	if err != nil {
+		c.JSON(supportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Ticket retrieved successfully",
+		Data:    ticket,
+	})
+}
+
+// AdminListTickets 获取工单，可按status、assignee_id、user_id过滤（管理员）
+func (h *SupportHandler) AdminListTickets(ctx context.Context, c *app.RequestContext) {
+	page, pageSize := pagination(c, 20)
+
+	filter := service.TicketFilter{Status: c.Query("status")}
+	for param, target := range map[string]*uint{"assignee_id": &filter.AssigneeID, "user_id": &filter.UserID} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid " + param})
+				return
+			}
+			*target = uint(id)
+		}
+	}
+
+	tickets, total, err := h.supportService.AdminListTickets(&filter, page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, tickets, total, page, pageSize)
+}
+
+// AdminGetTicket 获取工单详情，含会话记录和处理记录（管理员）
+func (h *SupportHandler) AdminGetTicket(ctx context.Context, c *app.RequestContext) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+
+	ticket, err := h.supportService.AdminGetTicket(uint(ticketID))
+	if err != nil {
+		c.JSON(supportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Ticket retrieved successfully",
+		Data:    ticket,
+	})
+}
+
+// AssignTicket 分配工单（管理员）
+func (h *SupportHandler) AssignTicket(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+
+	var req service.AssignTicketRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	ticket, err := h.supportService.AssignTicket(userID.(uint), uint(ticketID), &req)
+	if err != nil {
+		c.JSON(supportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Ticket assigned successfully",
+		Data:    ticket,
+	})
+}
+
+// UpdateTicketStatus 修改工单状态并通知用户（管理员）
+func (h *SupportHandler) UpdateTicketStatus(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+
+	var req service.UpdateTicketStatusRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	ticket, err := h.supportService.UpdateStatus(userID.(uint), uint(ticketID), &req)
+	if err != nil {
+		c.JSON(supportErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Ticket status updated successfully",
+		Data:    ticket,
+	})
+}
+
+func supportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrTicketNotFound), errors.Is(err, service.ErrConversationNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrTranscriptNeedsConversation), errors.Is(err, service.ErrIncognitoExport),
+		errors.Is(err, service.ErrInvalidAssignee):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrTooManyOpenTickets):
+		return consts.StatusTooManyRequests
+	case errors.Is(err, service.ErrTicketStatusConflict):
+		return consts.StatusConflict
+	case errors.Is(err, service.ErrColdStorageDisabled):
+		return consts.StatusServiceUnavailable
+	default:
+		return consts.StatusInternalServerError
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type SyncHandler struct {
+	syncService *service.SyncService
+}
+
+func NewSyncHandler(syncService *service.SyncService) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+	}
+}
+
+// Sync 获取自游标以来的会话和消息变更
+func (h *SyncHandler) Sync(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if limit < 1 || limit > 1000 {
+		limit = 200
+	}
+
+	result, err := h.syncService.Changes(userID.(uint), c.Query("since"), limit)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Changes retrieved successfully",
+		Data:    result,
+	})
+}
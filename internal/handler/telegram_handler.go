@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type TelegramHandler struct {
+	telegramService *service.TelegramService
+}
+
+func NewTelegramHandler(telegramService *service.TelegramService) *TelegramHandler {
+	return &TelegramHandler{
+		telegramService: telegramService,
+	}
+}
+
+// Webhook 接收Telegram推送的更新，通过secret token校验来源
+func (h *TelegramHandler) Webhook(ctx context.Context, c *app.RequestContext) {
+	err := h.telegramService.HandleUpdate(c.Request.Body(), string(c.GetHeader("X-Telegram-Bot-Api-Secret-Token")))
+	if err != nil {
+		if !errors.Is(err, service.ErrInvalidTelegramSecret) {
+			log.Printf("Failed to handle telegram update: %v", err)
+		}
+		c.JSON(telegramErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(consts.StatusOK)
+}
+
+// CreateLinkCode 生成Telegram绑定码
+func (h *TelegramHandler) CreateLinkCode(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	code, err := h.telegramService.LinkCode(userID.(uint))
+	if err != nil {
+		c.JSON(telegramErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Link code created successfully",
+		Data:    code,
+	})
+}
+
+// ListChats 获取绑定的Telegram聊天
+func (h *TelegramHandler) ListChats(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	links, err := h.telegramService.ListLinks(userID.(uint))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Telegram chats retrieved successfully",
+		Data:    links,
+	})
+}
+
+// UnlinkChat 解除绑定Telegram聊天
+func (h *TelegramHandler) UnlinkChat(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid chat link ID"})
+		return
+	}
+
+	if err := h.telegramService.UnlinkChat(userID.(uint), uint(linkID)); err != nil {
+		c.JSON(telegramErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Telegram chat unlinked successfully",
+	})
+}
+
+func telegramErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrTelegramDisabled):
+		return consts.StatusServiceUnavailable
+	case errors.Is(err, service.ErrInvalidTelegramSecret):
+		return consts.StatusUnauthorized
+	case errors.Is(err, service.ErrChannelLinkNotFound):
+		return consts.StatusNotFound
+	}
+	return consts.StatusInternalServerError
+}
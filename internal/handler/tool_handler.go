@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type ToolHandler struct {
+	toolService *service.ToolService
+	validator   *validator.Validate
+}
+
+func NewToolHandler(toolService *service.ToolService) *ToolHandler {
+	return &ToolHandler{
+		toolService: toolService,
+		validator:   validator.New(),
+	}
+}
+
+// ListServers 获取MCP服务列表（管理员）
+func (h *ToolHandler) ListServers(ctx context.Context, c *app.RequestContext) {
+	servers, err := h.toolService.ListServers(ctx)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "MCP servers retrieved successfully",
+		Data:    servers,
+	})
+}
+
+// CreateServer 注册MCP服务（管理员）
+func (h *ToolHandler) CreateServer(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.CreateMCPServerRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	server, err := h.toolService.CreateServer(ctx, userID.(uint), &req)
+	if err != nil {
+		c.JSON(toolErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "MCP server created successfully",
+		Data:    server,
+	})
+}
+
+// UpdateServer 启用或停用MCP服务（管理员）
+func (h *ToolHandler) UpdateServer(ctx context.Context, c *app.RequestContext) {
+	serverID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid server ID"})
+		return
+	}
+
+	var req service.UpdateMCPServerRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.toolService.UpdateServer(uint(serverID), &req); err != nil {
+		c.JSON(toolErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "MCP server updated successfully",
+	})
+}
+
+// DeleteServer 删除MCP服务（管理员）
+func (h *ToolHandler) DeleteServer(ctx context.Context, c *app.RequestContext) {
+	serverID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid server ID"})
+		return
+	}
+
+	if err := h.toolService.DeleteServer(uint(serverID)); err != nil {
+		c.JSON(toolErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "MCP server deleted successfully",
+	})
+}
+
+// ListInvocations 获取工具调用审计记录（管理员），可按conversation_id过滤
+func (h *ToolHandler) ListInvocations(ctx context.Context, c *app.RequestContext) {
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	var conversationID uint64
+	if value := c.Query("conversation_id"); value != "" {
+		var err error
+		if conversationID, err = strconv.ParseUint(value, 10, 32); err != nil {
+			c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+			return
+		}
+	}
+
+	invocations, total, err := h.toolService.ListInvocations(uint(conversationID), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, invocations, total, page, pageSize)
+}
+
+// ListConversationTools 获取会话可用的MCP服务及启用状态
+func (h *ToolHandler) ListConversationTools(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	tools, err := h.toolService.ConversationTools(userID.(uint), uint(conversationID))
+	if err != nil {
+		c.JSON(toolErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Conversation tools retrieved successfully",
+		Data:    tools,
+	})
+}
+
+// SetConversationTool 为会话启用或停用MCP服务
+func (h *ToolHandler) SetConversationTool(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+	serverID, err := strconv.ParseUint(c.Param("server_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid server ID"})
+		return
+	}
+
+	var req service.SetConversationToolRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.toolService.SetConversationTool(userID.(uint), uint(conversationID), uint(serverID), &req); err != nil {
+		c.JSON(toolErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Conversation tool updated successfully",
+	})
+}
+
+func toolErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConversationNotFound), errors.Is(err, service.ErrMCPServerNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrMCPServerExists):
+		return consts.StatusConflict
+	case errors.Is(err, service.ErrMCPServerInvalid):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrBYOKDisabled):
+		return consts.StatusServiceUnavailable
+	}
+	return consts.StatusInternalServerError
+}
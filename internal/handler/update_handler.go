@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/middleware"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/hertz-contrib/websocket"
+)
+
+const (
+	// updateWriteTimeout 单次写入的超时时间
+	updateWriteTimeout = 10 * time.Second
+	// updatePongWait 超过该时间未收到客户端消息或pong则断开
+	updatePongWait = 60 * time.Second
+	// updatePingInterval 服务端发送ping的间隔，需小于updatePongWait
+	updatePingInterval = 50 * time.Second
+)
+
+// updateUpgrader 与CORS中间件一致，不限制来源，连接通过token认证
+var updateUpgrader = websocket.HertzUpgrader{
+	CheckOrigin: func(c *app.RequestContext) bool { return true },
+}
+
+type UpdateHandler struct {
+	updateService *service.UpdateService
+
+	// socketChecks 每次推送前的检查
+	socketChecks []middleware.SocketCheck
+}
+
+func NewUpdateHandler(updateService *service.UpdateService) *UpdateHandler {
+	return &UpdateHandler{
+		updateService: updateService,
+	}
+}
+
+// UseSocketChecks 添加每次推送前的检查（代入会话等），启动时设置
+func (h *UpdateHandler) UseSocketChecks(checks ...middleware.SocketCheck) {
+	h.socketChecks = append(h.socketChecks, checks...)
+}
+
+// Updates 通过WebSocket推送会话列表变更（token通过URL参数由QueryAuth中间件验证）。
+// 每次推送前执行UseSocketChecks添加的检查，未通过时以1008（策略违规）关闭连接
+func (h *UpdateHandler) Updates(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	checks := make([]func(context.Context) error, 0, len(h.socketChecks))
+	for _, check := range h.socketChecks {
+		checks = append(checks, check(c))
+	}
+
+	err := updateUpgrader.Upgrade(c, func(conn *websocket.Conn) {
+		defer conn.Close()
+		updates, cancel := h.updateService.Listen(userID.(uint))
+		defer cancel()
+
+		// 客户端不需要发送消息，读循环只用于处理pong和检测断开
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			conn.SetReadDeadline(time.Now().Add(updatePongWait))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(updatePongWait))
+			})
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(updatePingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case update, ok := <-updates:
+				if !ok {
+					// 积压过多，通知客户端稍后重连并通过增量同步补齐
+					conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many pending updates"),
+						time.Now().Add(updateWriteTimeout))
+					return
+				}
+				for _, check := range checks {
+					if err := check(ctx); err != nil {
+						conn.WriteControl(websocket.CloseMessage,
+							websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+							time.Now().Add(updateWriteTimeout))
+						return
+					}
+				}
+				conn.SetWriteDeadline(time.Now().Add(updateWriteTimeout))
+				if err := conn.WriteJSON(update); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(updateWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+	}
+}
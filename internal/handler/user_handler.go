@@ -2,6 +2,9 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"log"
+	"net/http"
 
 	"ai-chat-backend/internal/service"
 
@@ -11,14 +14,16 @@ import (
 )
 
 type UserHandler struct {
-	userService *service.UserService
-	validator   *validator.Validate
+	userService    *service.UserService
+	consentService *service.ConsentService
+	validator      *validator.Validate
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
+func NewUserHandler(userService *service.UserService, consentService *service.ConsentService) *UserHandler {
 	return &UserHandler{
-		userService: userService,
-		validator:   validator.New(),
+		userService:    userService,
+		consentService: consentService,
+		validator:      validator.New(),
 	}
 }
 
@@ -34,19 +39,35 @@ type SuccessResponse struct {
 // Register 用户注册
 func (h *UserHandler) Register(ctx context.Context, c *app.RequestContext) {
 	var req service.RegisterRequest
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if !bindAndValidate(c, h.validator, &req) {
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
+	resp, err := h.userService.Register(&req)
+	if err != nil {
+		// 指定了其他区域时告知客户端应访问的区域
+		var mismatch *service.RegionMismatchError
+		if errors.As(err, &mismatch) {
+			c.Header("X-Data-Region", mismatch.Region)
+			c.JSON(http.StatusMisdirectedRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
 		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	resp, err := h.userService.Register(&req)
-	if err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if req.AcceptTerms {
+		if err := h.consentService.AcceptCurrent(resp.User.ID, c.ClientIP()); err != nil {
+			log.Printf("Failed to record consent for user %d: %v", resp.User.ID, err)
+		}
+	}
+
+	// 需验证邮箱时账号尚未激活，不签发token
+	if resp.VerificationRequired {
+		c.JSON(consts.StatusAccepted, SuccessResponse{
+			Message: "Verification code sent to email",
+			Data:    resp,
+		})
 		return
 	}
 
@@ -59,17 +80,15 @@ func (h *UserHandler) Register(ctx context.Context, c *app.RequestContext) {
 // Login 用户登录
 func (h *UserHandler) Login(ctx context.Context, c *app.RequestContext) {
 	var req service.LoginRequest
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if !bindAndValidate(c, h.validator, &req) {
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	resp, err := h.userService.Login(&req)
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		c.JSON(consts.StatusForbidden, ErrorResponse{Error: err.Error()})
 		return
 	}
-
-	resp, err := h.userService.Login(&req)
 	if err != nil {
 		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: err.Error()})
 		return
@@ -81,6 +100,46 @@ func (h *UserHandler) Login(ctx context.Context, c *app.RequestContext) {
 	})
 }
 
+// Refresh 以刷新token换取新的访问token和刷新token
+func (h *UserHandler) Refresh(ctx context.Context, c *app.RequestContext) {
+	var req service.RefreshRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	resp, err := h.userService.Refresh(&req)
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenInvalid) || errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Token refreshed successfully",
+		Data:    resp,
+	})
+}
+
+// Logout 登出，撤销刷新token
+func (h *UserHandler) Logout(ctx context.Context, c *app.RequestContext) {
+	var req service.RefreshRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.userService.Logout(&req); err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Logged out successfully",
+	})
+}
+
 // GetProfile 获取用户资料
 func (h *UserHandler) GetProfile(ctx context.Context, c *app.RequestContext) {
 	userID, exists := c.Get("user_id")
@@ -95,31 +154,102 @@ func (h *UserHandler) GetProfile(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	consent, err := h.consentService.GetStatus(user.ID)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	c.JSON(consts.StatusOK, SuccessResponse{
 		Message: "Profile retrieved successfully",
-		Data:    user,
+		Data: service.ProfileResponse{
+			User:       user,
+			Consent:    consent,
+			Completion: service.ProfileCompletionOf(user),
+		},
 	})
 }
 
-// UpdateProfile 更新用户资料
-func (h *UserHandler) UpdateProfile(ctx context.Context, c *app.RequestContext) {
+// ChangeEmail 申请修改邮箱（需要密码确认，新邮箱确认后生效）
+func (h *UserHandler) ChangeEmail(ctx context.Context, c *app.RequestContext) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
 		return
 	}
 
+	var req service.ChangeEmailRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.userService.RequestEmailChange(userID.(uint), c.ClientIP(), &req); err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Verification email sent to the new address",
+	})
+}
+
+// ConfirmEmailChange 确认修改邮箱
+func (h *UserHandler) ConfirmEmailChange(ctx context.Context, c *app.RequestContext) {
 	var req struct {
-		Nickname string `json:"nickname"`
-		Avatar   string `json:"avatar"`
+		Token string `json:"token" validate:"required"`
+	}
+
+	if !bindAndValidate(c, h.validator, &req) {
+		return
 	}
 
-	if err := c.BindAndValidate(&req); err != nil {
+	if err := h.userService.ConfirmEmailChange(req.Token, c.ClientIP()); err != nil {
 		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	err := h.userService.UpdateProfile(userID.(uint), req.Nickname, req.Avatar)
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Email changed successfully",
+	})
+}
+
+// AcceptConsent 接受当前版本的服务条款和隐私政策
+func (h *UserHandler) AcceptConsent(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.AcceptConsentRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.consentService.Accept(userID.(uint), c.ClientIP(), &req); err != nil {
+		c.JSON(consts.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Consent recorded successfully",
+	})
+}
+
+// UpdateProfile 更新用户资料
+func (h *UserHandler) UpdateProfile(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.UpdateProfileRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	err := h.userService.UpdateProfile(userID.(uint), &req)
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
@@ -130,8 +260,28 @@ func (h *UserHandler) UpdateProfile(ctx context.Context, c *app.RequestContext)
 	})
 }
 
-// ChangePassword 修改密码
-func (h *UserHandler) ChangePassword(ctx context.Context, c *app.RequestContext) {
+// CheckUsername 检查用户名是否可用
+func (h *UserHandler) CheckUsername(ctx context.Context, c *app.RequestContext) {
+	username := c.Query("username")
+	if username == "" {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Username is required"})
+		return
+	}
+
+	available, err := h.userService.IsUsernameAvailable(username)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Username checked successfully",
+		Data:    map[string]bool{"available": available},
+	})
+}
+
+// SetUsername 设置用户名
+func (h *UserHandler) SetUsername(ctx context.Context, c *app.RequestContext) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
@@ -139,20 +289,40 @@ func (h *UserHandler) ChangePassword(ctx context.Context, c *app.RequestContext)
 	}
 
 	var req struct {
-		OldPassword string `json:"old_password" validate:"required"`
-		NewPassword string `json:"new_password" validate:"required,min=6"`
+		Username string `json:"username" validate:"required"`
 	}
 
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if !bindAndValidate(c, h.validator, &req) {
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
+	if err := h.userService.SetUsername(userID.(uint), req.Username); err != nil {
 		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Username updated successfully",
+	})
+}
+
+// ChangePassword 修改密码
+func (h *UserHandler) ChangePassword(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		OldPassword string `json:"old_password" validate:"required"`
+		NewPassword string `json:"new_password" validate:"required,min=6"`
+	}
+
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
 	err := h.userService.ChangePassword(userID.(uint), req.OldPassword, req.NewPassword)
 	if err != nil {
 		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
@@ -164,48 +334,89 @@ func (h *UserHandler) ChangePassword(ctx context.Context, c *app.RequestContext)
 	})
 }
 
-// ForgotPassword 忘记密码（暂时返回成功，实际需要邮件服务）
+// ForgotPassword 忘记密码，向邮箱发送重置密码的验证码。邮箱未注册时同样返回成功
 func (h *UserHandler) ForgotPassword(ctx context.Context, c *app.RequestContext) {
 	var req struct {
 		Email string `json:"email" validate:"required,email"`
 	}
 
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if !bindAndValidate(c, h.validator, &req) {
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if err := h.userService.ForgotPassword(req.Email); err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// TODO: 实现邮件发送逻辑
 	c.JSON(consts.StatusOK, SuccessResponse{
 		Message: "Password reset email sent",
 	})
 }
 
-// ResetPassword 重置密码（暂时返回成功，实际需要验证码）
+// ResetPassword 使用邮箱收到的验证码重置密码
 func (h *UserHandler) ResetPassword(ctx context.Context, c *app.RequestContext) {
+	var req service.ResetPasswordRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	if err := h.userService.ResetPassword(&req, c.ClientIP()); err != nil {
+		c.JSON(verificationErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Password reset successfully",
+	})
+}
+
+// VerifyEmail 使用注册后邮箱收到的验证码激活账号，成功后直接登录
+func (h *UserHandler) VerifyEmail(ctx context.Context, c *app.RequestContext) {
+	var req service.VerifyEmailRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	resp, err := h.userService.VerifyEmail(&req, c.ClientIP())
+	if err != nil {
+		c.JSON(verificationErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Email verified successfully",
+		Data:    resp,
+	})
+}
+
+// ResendVerification 重新发送注册验证码，邮箱未注册或已验证时同样返回成功
+func (h *UserHandler) ResendVerification(ctx context.Context, c *app.RequestContext) {
 	var req struct {
-		Email       string `json:"email" validate:"required,email"`
-		Code        string `json:"code" validate:"required"`
-		NewPassword string `json:"new_password" validate:"required,min=6"`
+		Email string `json:"email" validate:"required,email"`
 	}
 
-	if err := c.BindAndValidate(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if !bindAndValidate(c, h.validator, &req) {
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
-		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if err := h.userService.ResendVerification(req.Email); err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// TODO: 实现验证码验证和密码重置逻辑
 	c.JSON(consts.StatusOK, SuccessResponse{
-		Message: "Password reset successfully",
+		Message: "Verification code sent",
 	})
-}
\ No newline at end of file
+}
+
+// verificationErrorStatus 验证码错误或过期返回400，尝试次数用尽返回429
+func verificationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidVerificationCode):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrVerificationAttempts):
+		return consts.StatusTooManyRequests
+	}
+	return consts.StatusInternalServerError
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+	validator      *validator.Validate
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		validator:      validator.New(),
+	}
+}
+
+// ListWebhooks 获取会话的webhook
+func (h *WebhookHandler) ListWebhooks(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	webhooks, err := h.webhookService.List(userID.(uint), uint(conversationID))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Webhooks retrieved successfully",
+		Data:    webhooks,
+	})
+}
+
+// CreateWebhook 为会话添加webhook，AI回复完成后推送消息
+func (h *WebhookHandler) CreateWebhook(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req service.CreateWebhookRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	webhook, err := h.webhookService.Create(userID.(uint), uint(conversationID), &req)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Webhook created successfully",
+		Data:    webhook,
+	})
+}
+
+// DeleteWebhook 删除webhook
+func (h *WebhookHandler) DeleteWebhook(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+	webhookID, err := strconv.ParseUint(c.Param("webhook_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid webhook ID"})
+		return
+	}
+
+	if err := h.webhookService.Delete(userID.(uint), uint(conversationID), uint(webhookID)); err != nil {
+		c.JSON(webhookErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Webhook deleted successfully",
+	})
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConversationNotFound),
+		errors.Is(err, service.ErrWebhookNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrWebhookLimitExceeded):
+		return consts.StatusConflict
+	}
+	return consts.StatusInternalServerError
+}
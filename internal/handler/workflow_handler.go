@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/go-playground/validator/v10"
+)
+
+type WorkflowHandler struct {
+	workflowService *service.WorkflowService
+	validator       *validator.Validate
+}
+
+func NewWorkflowHandler(workflowService *service.WorkflowService) *WorkflowHandler {
+	return &WorkflowHandler{
+		workflowService: workflowService,
+		validator:       validator.New(),
+	}
+}
+
+// ListAgents 获取工作流可用的角色
+func (h *WorkflowHandler) ListAgents(ctx context.Context, c *app.RequestContext) {
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Workflow agents retrieved successfully",
+		Data:    h.workflowService.Agents(),
+	})
+}
+
+// RunWorkflow 在会话中执行多智能体工作流，返回各步骤输出和最终答案
+func (h *WorkflowHandler) RunWorkflow(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	var req service.RunWorkflowRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	run, userMessage, assistantMessage, err := h.workflowService.Run(ctx, userID.(uint), uint(conversationID), &req)
+	if err != nil {
+		if writeMessageTooLong(c, err) || writeSecretDetected(c, err) {
+			return
+		}
+		if writeEntitlementError(c, err) {
+			return
+		}
+		c.JSON(workflowErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Workflow completed successfully",
+		Data: map[string]interface{}{
+			"run":               run,
+			"user_message":      userMessage,
+			"assistant_message": assistantMessage,
+		},
+	})
+}
+
+// ListRuns 获取会话的工作流执行记录
+func (h *WorkflowHandler) ListRuns(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	runs, total, err := h.workflowService.ListRuns(userID.(uint), uint(conversationID), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, runs, total, page, pageSize)
+}
+
+// GetRun 获取工作流执行记录及各步骤输出
+func (h *WorkflowHandler) GetRun(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid conversation ID"})
+		return
+	}
+	runID, err := strconv.ParseUint(c.Param("run_id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid run ID"})
+		return
+	}
+
+	run, err := h.workflowService.GetRun(userID.(uint), uint(conversationID), uint(runID))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Workflow run retrieved successfully",
+		Data:    run,
+	})
+}
+
+// ListWorkflows 获取保存的工作流
+func (h *WorkflowHandler) ListWorkflows(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	// 获取分页参数
+	page, pageSize := pagination(c, 20)
+
+	workflows, total, err := h.workflowService.ListWorkflows(userID.(uint), page, pageSize)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writePage(c, workflows, total, page, pageSize)
+}
+
+// CreateWorkflow 保存工作流定义
+func (h *WorkflowHandler) CreateWorkflow(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	var req service.SaveWorkflowRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	workflow, err := h.workflowService.CreateWorkflow(userID.(uint), &req)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusCreated, SuccessResponse{
+		Message: "Workflow created successfully",
+		Data:    workflow,
+	})
+}
+
+// GetWorkflow 获取保存的工作流
+func (h *WorkflowHandler) GetWorkflow(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	workflowID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid workflow ID"})
+		return
+	}
+
+	workflow, err := h.workflowService.GetWorkflow(userID.(uint), uint(workflowID))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Workflow retrieved successfully",
+		Data:    workflow,
+	})
+}
+
+// UpdateWorkflow 替换保存的工作流
+func (h *WorkflowHandler) UpdateWorkflow(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	workflowID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid workflow ID"})
+		return
+	}
+
+	var req service.SaveWorkflowRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	workflow, err := h.workflowService.UpdateWorkflow(userID.(uint), uint(workflowID), &req)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Workflow updated successfully",
+		Data:    workflow,
+	})
+}
+
+// DeleteWorkflow 删除保存的工作流
+func (h *WorkflowHandler) DeleteWorkflow(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	workflowID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid workflow ID"})
+		return
+	}
+
+	if err := h.workflowService.DeleteWorkflow(userID.(uint), uint(workflowID)); err != nil {
+		c.JSON(workflowErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusOK, SuccessResponse{
+		Message: "Workflow deleted successfully",
+	})
+}
+
+// RunSavedWorkflow 在会话中异步执行保存的工作流，返回后台任务，进度通过任务事件获取
+func (h *WorkflowHandler) RunSavedWorkflow(ctx context.Context, c *app.RequestContext) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	workflowID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, ErrorResponse{Error: "Invalid workflow ID"})
+		return
+	}
+
+	var req service.RunSavedWorkflowRequest
+	if !bindAndValidate(c, h.validator, &req) {
+		return
+	}
+
+	job, err := h.workflowService.RunWorkflow(userID.(uint), uint(workflowID), &req)
+	if err != nil {
+		if writeMessageTooLong(c, err) || writeSecretDetected(c, err) {
+			return
+		}
+		c.JSON(workflowErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(consts.StatusAccepted, SuccessResponse{
+		Message: "Workflow run queued",
+		Data:    job,
+	})
+}
+
+func workflowErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkflowInvalid):
+		return consts.StatusBadRequest
+	case errors.Is(err, service.ErrWorkflowNotFound), errors.Is(err, service.ErrWorkflowRunNotFound), errors.Is(err, service.ErrConversationNotFound):
+		return consts.StatusNotFound
+	case errors.Is(err, service.ErrJobQueueFull):
+		return consts.StatusServiceUnavailable
+	}
+	return consts.StatusInternalServerError
+}
@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+
+	"ai-chat-backend/internal/config"
+)
+
+// Sender 邮件发送接口
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// NewSender 根据配置创建邮件发送器，未配置SMTP时不发送，只在日志中记录收件人和主题（开发环境）
+func NewSender(cfg config.MailConfig) Sender {
+	if cfg.Host == "" {
+		return &logSender{}
+	}
+	return &smtpSender{cfg: cfg}
+}
+
+type smtpSender struct {
+	cfg config.MailConfig
+}
+
+func (s *smtpSender) Send(to, subject, body string) error {
+	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
+	// 密码每次发送时重新读取，密钥轮换后无需重建发送器
+	auth := smtp.PlainAuth("", s.cfg.Username, config.Load().Mail.Password, s.cfg.Host)
+
+	msg := strings.Join([]string{
+		"From: " + s.cfg.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(addr, auth, s.cfg.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// logSender 不记录正文：其中的验证码、重置链接等凭据不能出现在日志中
+type logSender struct{}
+
+func (s *logSender) Send(to, subject, body string) error {
+	log.Printf("[mail] SMTP not configured, dropped mail to=%s subject=%q", to, subject)
+	return nil
+}
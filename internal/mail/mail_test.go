@@ -0,0 +1,26 @@
+package mail
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// 未配置SMTP时只记录收件人和主题，正文中的验证码不能写入日志
+func TestLogSenderOmitsBody(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	if err := (&logSender{}).Send("user@example.com", "Verify your email", "Your code is 123456"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "user@example.com") || !strings.Contains(out, "Verify your email") {
+		t.Errorf("log %q is missing the recipient or subject", out)
+	}
+	if strings.Contains(out, "123456") {
+		t.Errorf("log %q contains the mail body", out)
+	}
+}
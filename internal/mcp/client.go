@@ -0,0 +1,388 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ProtocolVersion 客户端使用的MCP协议版本
+const ProtocolVersion = "2025-06-18"
+
+// maxResponseSize 单个响应的最大字节数
+const maxResponseSize = 4 << 20
+
+// errSessionExpired 服务端会话失效（404），需要重新初始化
+var errSessionExpired = errors.New("mcp session expired")
+
+// Client MCP客户端，使用Streamable HTTP传输：JSON-RPC请求以POST发送，
+// 响应为JSON或SSE流。首次调用时自动完成初始化握手，会话失效后重新初始化
+type Client struct {
+	url        string
+	token      string
+	httpClient *http.Client
+	nextID     atomic.Int64
+
+	mu        sync.Mutex
+	sessionID string
+	server    *InitializeResult
+}
+
+// NewClient token不为空时以Bearer token认证
+func NewClient(url, token string, httpClient *http.Client) *Client {
+	return &Client{
+		url:        url,
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+// InitializeResult 初始化握手的结果
+type InitializeResult struct {
+	ProtocolVersion string `json:"protocolVersion"`
+	Capabilities    struct {
+		Tools     *struct{} `json:"tools,omitempty"`
+		Resources *struct{} `json:"resources,omitempty"`
+	} `json:"capabilities"`
+	ServerInfo struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"serverInfo"`
+	Instructions string `json:"instructions,omitempty"`
+}
+
+// Tool 服务端提供的工具，InputSchema为JSON Schema
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// Resource 服务端提供的资源
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// Content 工具结果或资源中的一段内容，只解析文本
+type Content struct {
+	Type     string `json:"type,omitempty"`
+	Text     string `json:"text,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// CallToolResult 工具调用结果，IsError表示工具执行失败（协议层面调用成功）
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text 拼接结果中的文本内容，非文本内容以类型占位
+func (r *CallToolResult) Text() string {
+	return joinContents(r.Content)
+}
+
+// Error JSON-RPC错误
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	ID *int64 `json:"id"`
+	// Method 不为空时是服务端发起的请求或通知
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// Initialize 完成初始化握手，返回服务端信息
+func (c *Client) Initialize(ctx context.Context) (*InitializeResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.initializeLocked(ctx)
+}
+
+func (c *Client) initializeLocked(ctx context.Context) (*InitializeResult, error) {
+	if c.server != nil {
+		return c.server, nil
+	}
+
+	c.sessionID = ""
+	params := map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "ai-chat-backend", "version": "1.0.0"},
+	}
+	var result InitializeResult
+	sessionID, err := c.send(ctx, "", "initialize", params, &result)
+	if err != nil {
+		return nil, err
+	}
+	c.sessionID = sessionID
+	if _, err := c.send(ctx, sessionID, "notifications/initialized", nil, nil); err != nil {
+		return nil, err
+	}
+	c.server = &result
+	return c.server, nil
+}
+
+// session 返回当前会话ID，未初始化时先初始化
+func (c *Client) session(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.initializeLocked(ctx); err != nil {
+		return "", err
+	}
+	return c.sessionID, nil
+}
+
+// reset 丢弃失效的会话，下次调用重新初始化
+func (c *Client) reset(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessionID == sessionID {
+		c.server = nil
+		c.sessionID = ""
+	}
+}
+
+// call 在会话中发送请求，会话失效时重新初始化并重试一次
+func (c *Client) call(ctx context.Context, method string, params, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		sessionID, err := c.session(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = c.send(ctx, sessionID, method, params, out)
+		if errors.Is(err, errSessionExpired) && sessionID != "" && attempt == 0 {
+			c.reset(sessionID)
+			continue
+		}
+		return err
+	}
+}
+
+// ListTools 获取服务端的全部工具
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", cursorParams(cursor), &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool 调用工具，arguments为JSON对象
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	err := c.call(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": arguments,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListResources 获取服务端的全部资源
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	cursor := ""
+	for {
+		var result struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "resources/list", cursorParams(cursor), &result); err != nil {
+			return nil, err
+		}
+		resources = append(resources, result.Resources...)
+		if result.NextCursor == "" {
+			return resources, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// ReadResource 读取资源，返回其中的文本内容
+func (c *Client) ReadResource(ctx context.Context, uri string) (string, error) {
+	var result struct {
+		Contents []Content `json:"contents"`
+	}
+	if err := c.call(ctx, "resources/read", map[string]string{"uri": uri}, &result); err != nil {
+		return "", err
+	}
+	return joinContents(result.Contents), nil
+}
+
+func cursorParams(cursor string) interface{} {
+	if cursor == "" {
+		return nil
+	}
+	return map[string]string{"cursor": cursor}
+}
+
+func joinContents(contents []Content) string {
+	parts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		switch {
+		case content.Text != "":
+			parts = append(parts, content.Text)
+		case content.URI != "":
+			parts = append(parts, fmt.Sprintf("[%s: %s]", content.Type, content.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content]", content.Type))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// send 发送一条JSON-RPC消息，method以notifications/开头时为通知，不等待结果。
+// 返回服务端分配的会话ID
+func (c *Client) send(ctx context.Context, sessionID, method string, params, out interface{}) (string, error) {
+	msg := request{JSONRPC: "2.0", Method: method, Params: params}
+	notification := strings.HasPrefix(method, "notifications/")
+	if !notification {
+		id := c.nextID.Add(1)
+		msg.ID = &id
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("MCP-Protocol-Version", ProtocolVersion)
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && sessionID != "" {
+		return "", errSessionExpired
+	}
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("mcp %s failed (%d): %s", method, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if sessionID == "" {
+		sessionID = resp.Header.Get("Mcp-Session-Id")
+	}
+	if notification {
+		return sessionID, nil
+	}
+
+	var result *response
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		result, err = readEventStream(resp.Body, *msg.ID)
+	} else {
+		result = &response{}
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(result)
+	}
+	if err != nil {
+		return "", fmt.Errorf("mcp %s: invalid response: %w", method, err)
+	}
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if out != nil {
+		if err := json.Unmarshal(result.Result, out); err != nil {
+			return "", fmt.Errorf("mcp %s: invalid result: %w", method, err)
+		}
+	}
+	return sessionID, nil
+}
+
+// readEventStream 从SSE流中读取对应请求ID的响应，忽略服务端在此之前发送的通知和请求
+func readEventStream(body io.Reader, id int64) (*response, error) {
+	scanner := bufio.NewScanner(io.LimitReader(body, maxResponseSize))
+	scanner.Buffer(make([]byte, 64*1024), maxResponseSize)
+
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		// 空行表示一个事件结束
+		if msg := matchResponse(data.String(), id); msg != nil {
+			return msg, nil
+		}
+		data.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if msg := matchResponse(data.String(), id); msg != nil {
+		return msg, nil
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func matchResponse(data string, id int64) *response {
+	var msg response
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return nil
+	}
+	if msg.Method != "" || msg.ID == nil || *msg.ID != id {
+		return nil
+	}
+	return &msg
+}
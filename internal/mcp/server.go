@@ -0,0 +1,253 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// JSON-RPC错误码
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// supportedVersions 服务端支持的协议版本，客户端请求其他版本时返回最新版本
+var supportedVersions = map[string]bool{
+	ProtocolVersion: true,
+	"2025-03-26":    true,
+	"2024-11-05":    true,
+}
+
+// ErrInvalidParams 工具参数或资源URI无效，以JSON-RPC的invalid params错误返回
+var ErrInvalidParams = errors.New("invalid params")
+
+// ErrResourceNotFound 资源不存在
+var ErrResourceNotFound = errors.New("resource not found")
+
+// ToolHandler 执行工具调用，返回的文本作为结果内容。
+// 返回的error作为工具执行失败（isError）交给模型处理，ErrInvalidParams除外
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// ResourceTemplate 资源URI模板
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceProvider 提供资源列表和读取
+type ResourceProvider interface {
+	ListResources(ctx context.Context) ([]Resource, error)
+	ReadResource(ctx context.Context, uri string) (*Content, error)
+}
+
+type serverTool struct {
+	tool    Tool
+	handler ToolHandler
+}
+
+// Server 与传输无关的MCP服务端，处理单条JSON-RPC消息。
+// 不维护会话状态，也不主动向客户端发送消息，适合以无状态的Streamable HTTP方式提供
+type Server struct {
+	name         string
+	version      string
+	instructions string
+	tools        []serverTool
+	toolIndex    map[string]int
+	resources    ResourceProvider
+	templates    []ResourceTemplate
+}
+
+func NewServer(name, version, instructions string) *Server {
+	return &Server{
+		name:         name,
+		version:      version,
+		instructions: instructions,
+		toolIndex:    make(map[string]int),
+	}
+}
+
+// AddTool 注册工具，inputSchema为JSON Schema
+func (s *Server) AddTool(name, description, inputSchema string, handler ToolHandler) {
+	s.toolIndex[name] = len(s.tools)
+	s.tools = append(s.tools, serverTool{
+		tool:    Tool{Name: name, Description: description, InputSchema: json.RawMessage(inputSchema)},
+		handler: handler,
+	})
+}
+
+// SetResources 设置资源提供方及URI模板
+func (s *Server) SetResources(provider ResourceProvider, templates ...ResourceTemplate) {
+	s.resources = provider
+	s.templates = templates
+}
+
+type incoming struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type outgoing struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Handle 处理一条客户端消息，通知和客户端的响应返回nil
+func (s *Server) Handle(ctx context.Context, body []byte) []byte {
+	var msg incoming
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return encode(outgoing{ID: json.RawMessage("null"), Error: &Error{Code: codeParseError, Message: "parse error"}})
+	}
+	if msg.Method == "" {
+		// 客户端对服务端请求的响应，服务端不发送请求，忽略
+		return nil
+	}
+	if len(msg.ID) == 0 {
+		// 通知无需响应
+		return nil
+	}
+	if msg.JSONRPC != "2.0" {
+		return encode(outgoing{ID: msg.ID, Error: &Error{Code: codeInvalidRequest, Message: "invalid request"}})
+	}
+
+	result, err := s.dispatch(ctx, msg.Method, msg.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			log.Printf("MCP %s failed: %v", msg.Method, err)
+			rpcErr = &Error{Code: codeInternalError, Message: "internal error"}
+		}
+		return encode(outgoing{ID: msg.ID, Error: rpcErr})
+	}
+	return encode(outgoing{ID: msg.ID, Result: result})
+}
+
+func encode(msg outgoing) []byte {
+	msg.JSONRPC = "2.0"
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+func invalidParams(message string) *Error {
+	return &Error{Code: codeInvalidParams, Message: message}
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return s.initialize(params)
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools := make([]Tool, len(s.tools))
+		for i, tool := range s.tools {
+			tools[i] = tool.tool
+		}
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		return s.callTool(ctx, params)
+	}
+
+	if s.resources != nil {
+		switch method {
+		case "resources/list":
+			resources, err := s.resources.ListResources(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"resources": resources}, nil
+		case "resources/templates/list":
+			templates := s.templates
+			if templates == nil {
+				templates = []ResourceTemplate{}
+			}
+			return map[string]interface{}{"resourceTemplates": templates}, nil
+		case "resources/read":
+			return s.readResource(ctx, params)
+		}
+	}
+	return nil, &Error{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams("invalid initialize params")
+	}
+	version := ProtocolVersion
+	if supportedVersions[req.ProtocolVersion] {
+		version = req.ProtocolVersion
+	}
+
+	capabilities := map[string]interface{}{"tools": map[string]interface{}{}}
+	if s.resources != nil {
+		capabilities["resources"] = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    capabilities,
+		"serverInfo":      map[string]string{"name": s.name, "version": s.version},
+		"instructions":    s.instructions,
+	}, nil
+}
+
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, invalidParams("invalid tools/call params")
+	}
+	index, ok := s.toolIndex[req.Name]
+	if !ok {
+		return nil, invalidParams("unknown tool: " + req.Name)
+	}
+	if len(req.Arguments) == 0 || string(req.Arguments) == "null" {
+		req.Arguments = json.RawMessage("{}")
+	}
+
+	text, err := s.tools[index].handler(ctx, req.Arguments)
+	if errors.Is(err, ErrInvalidParams) {
+		return nil, invalidParams(err.Error())
+	}
+	if err != nil {
+		return CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return CallToolResult{Content: []Content{{Type: "text", Text: text}}}, nil
+}
+
+func (s *Server) readResource(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.URI == "" {
+		return nil, invalidParams("invalid resources/read params")
+	}
+
+	content, err := s.resources.ReadResource(ctx, req.URI)
+	if errors.Is(err, ErrResourceNotFound) {
+		// 规范建议资源不存在时返回 -32002
+		return nil, &Error{Code: -32002, Message: "resource not found: " + req.URI}
+	}
+	if errors.Is(err, ErrInvalidParams) {
+		return nil, invalidParams(err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	content.URI = req.URI
+	return map[string]interface{}{"contents": []*Content{content}}, nil
+}
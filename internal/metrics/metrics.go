@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   []*CounterVec
+)
+
+// CounterVec 带标签的计数器，输出格式兼容Prometheus文本格式
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+// Sample 一组标签值及其计数
+type Sample struct {
+	Labels map[string]string `json:"labels"`
+	Value  uint64            `json:"value"`
+}
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*Sample),
+	}
+	registryMu.Lock()
+	registry = append(registry, c)
+	registryMu.Unlock()
+	return c
+}
+
+// Inc 按标签值加一，标签值顺序与创建时的标签名一致
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add 按标签值增加delta
+func (c *CounterVec) Add(delta uint64, values ...string) {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", c.name, len(c.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sample, ok := c.values[key]
+	if !ok {
+		sample = &Sample{Labels: make(map[string]string, len(values))}
+		for i, label := range c.labels {
+			sample.Labels[label] = values[i]
+		}
+		c.values[key] = sample
+	}
+	sample.Value += delta
+}
+
+// Snapshot 返回当前所有样本的副本，按计数从大到小排序
+func (c *CounterVec) Snapshot() []Sample {
+	c.mu.Lock()
+	samples := make([]Sample, 0, len(c.values))
+	for _, sample := range c.values {
+		samples = append(samples, Sample{Labels: sample.Labels, Value: sample.Value})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Value > samples[j].Value
+	})
+	return samples
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, sample := range c.Snapshot() {
+		pairs := make([]string, len(c.labels))
+		for i, label := range c.labels {
+			pairs[i] = fmt.Sprintf("%s=%q", label, sample.Labels[label])
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", c.name, strings.Join(pairs, ","), sample.Value)
+	}
+}
+
+// WritePrometheus 以Prometheus文本格式输出所有已注册的指标
+func WritePrometheus(w io.Writer) {
+	registryMu.Lock()
+	vecs := append([]*CounterVec(nil), registry...)
+	registryMu.Unlock()
+
+	for _, c := range vecs {
+		c.write(w)
+	}
+}
+
+// ValidationFailures 请求参数校验失败次数，rule为校验规则（如required、email），绑定失败时为bind
+var ValidationFailures = NewCounterVec("validation_failures_total",
+	"Request validation failures by endpoint, field and rule.",
+	"method", "route", "field", "rule")
+
+// ModelCalls 模型调用次数，status为ok或error
+var ModelCalls = NewCounterVec("model_calls_total",
+	"Chat model calls by model and status.",
+	"model", "status")
+
+// ModelCallDuration 模型调用累计耗时，与ModelCalls相除得到平均耗时
+var ModelCallDuration = NewCounterVec("model_call_milliseconds_total",
+	"Total chat model call duration in milliseconds.",
+	"model")
+
+// ModelTokens 模型调用消耗的token数，type为prompt或completion
+var ModelTokens = NewCounterVec("model_tokens_total",
+	"Tokens consumed by chat model calls.",
+	"model", "type")
+
+// FirstTokens 流式生成收到首个内容片段的次数
+var FirstTokens = NewCounterVec("first_tokens_total",
+	"Streaming model calls that produced a first token, by provider and model.",
+	"provider", "model")
+
+// FirstTokenDuration 首token延迟累计值，与FirstTokens相除得到平均延迟
+var FirstTokenDuration = NewCounterVec("first_token_milliseconds_total",
+	"Total time to first token of streaming model calls in milliseconds.",
+	"provider", "model")
+
+// CanaryGenerations 灰度期间使用服务端模型的生成次数，variant为canary或baseline，status为ok或error
+var CanaryGenerations = NewCounterVec("canary_generations_total",
+	"Generations during a canary rollout, by variant, model and status.",
+	"variant", "model", "status")
+
+// ToolCalls 工具调用次数，status为ok或error
+var ToolCalls = NewCounterVec("tool_calls_total",
+	"Tool calls requested by the model, by tool and status.",
+	"tool", "status")
+
+// DuplicateMessages 被合并的重复用户消息数，source为inflight（等待进行中的生成）或recent（返回刚完成的回复）
+var DuplicateMessages = NewCounterVec("duplicate_messages_total",
+	"Duplicate user messages suppressed within the dedupe window, by source.",
+	"source")
+
+// DisposableEmailBlocked 因使用一次性邮箱被拒绝的注册/修改邮箱次数，action为register或change_email
+var DisposableEmailBlocked = NewCounterVec("disposable_email_blocked_total",
+	"Registrations and email changes rejected for disposable email domains, by action.",
+	"action")
+
+// HistoryCacheLookups 会话上下文缓存的读取次数，result为hit或miss
+var HistoryCacheLookups = NewCounterVec("history_cache_lookups_total",
+	"Conversation history cache lookups, by result.",
+	"result")
+
+// ContextTrimmedMessages 上下文超过模型窗口时被丢弃的历史消息数
+var ContextTrimmedMessages = NewCounterVec("context_trimmed_messages_total",
+	"History messages dropped to fit the model context window, by model.",
+	"model")
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// ClientIP 创建获取客户端IP的函数，供服务器SetClientIPFunc使用。
+// 只有连接来自trustedProxies（CIDR或单个IP）时才采用X-Forwarded-For/X-Real-IP中的地址，否则使用连接的对端地址，
+// 避免客户端伪造请求头绕过按IP的限流和访客额度。trustedProxies为空时不信任任何代理
+func ClientIP(trustedProxies []string) (app.ClientIP, error) {
+	cidrs := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return app.ClientIPWithOption(app.ClientIPOptions{
+		RemoteIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
+		TrustedCIDRs:    cidrs,
+	}), nil
+}
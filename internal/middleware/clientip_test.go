@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/mock"
+)
+
+// remoteConn 指定对端地址的连接
+type remoteConn struct {
+	*mock.Conn
+	remote net.Addr
+}
+
+func (c *remoteConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func newClientIPContext(remoteIP string, headers map[string]string) *app.RequestContext {
+	c := app.NewContext(0)
+	c.SetConn(&remoteConn{Conn: mock.NewConn(""), remote: &net.TCPAddr{IP: net.ParseIP(remoteIP), Port: 40000}})
+	for key, value := range headers {
+		c.Request.Header.Set(key, value)
+	}
+	return c
+}
+
+func TestClientIP(t *testing.T) {
+	spoofed := map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "5.6.7.8"}
+
+	tests := []struct {
+		name    string
+		trusted []string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "no trusted proxies ignores headers", remote: "203.0.113.9", headers: spoofed, want: "203.0.113.9"},
+		{name: "untrusted peer ignores headers", trusted: []string{"10.0.0.0/8"}, remote: "203.0.113.9", headers: spoofed, want: "203.0.113.9"},
+		{name: "trusted proxy CIDR", trusted: []string{"10.0.0.0/8"}, remote: "10.1.2.3", headers: spoofed, want: "1.2.3.4"},
+		{name: "trusted proxy IP", trusted: []string{"10.1.2.3"}, remote: "10.1.2.3", headers: map[string]string{"X-Real-IP": "5.6.7.8"}, want: "5.6.7.8"},
+		{name: "trusted proxy without headers", trusted: []string{"10.0.0.0/8"}, remote: "10.1.2.3", want: "10.1.2.3"},
+		{name: "chained proxies", trusted: []string{"10.0.0.0/8"}, remote: "10.1.2.3", headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 10.9.9.9"}, want: "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := ClientIP(tt.trusted)
+			if err != nil {
+				t.Fatalf("ClientIP() error = %v", err)
+			}
+			c := newClientIPContext(tt.remote, tt.headers)
+			c.SetClientIPFunc(fn)
+			if got := c.ClientIP(); got != tt.want {
+				t.Fatalf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPInvalidProxy(t *testing.T) {
+	for _, proxy := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := ClientIP([]string{proxy}); err == nil {
+			t.Fatalf("ClientIP(%q) error = nil, want error", proxy)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// fakeImpersonations 记录审计请求的ImpersonationChecker，ended为true时会话视为已结束
+type fakeImpersonations struct {
+	ended    bool
+	recorded []string
+}
+
+func (f *fakeImpersonations) Check(impersonationID uint) (*model.Impersonation, error) {
+	if f.ended {
+		return nil, service.ErrImpersonationInactive
+	}
+	return &model.Impersonation{ID: impersonationID, AdminID: 1, UserID: 2}, nil
+}
+
+func (f *fakeImpersonations) RecordRequest(impersonation *model.Impersonation, method, path string, status int, ip string) {
+	f.recorded = append(f.recorded, method+" "+path)
+}
+
+func TestImpersonation(t *testing.T) {
+	blocked := []string{
+		"/api/v1/user/password",
+		"POST /api/v1/conversations/:id/shares",
+		"/api/v1/integrations/calendar/authorize",
+	}
+	tests := []struct {
+		name            string
+		impersonationID uint
+		ended           bool
+		method          string
+		route           string
+		wantStatus      int
+		wantNext        bool
+		wantAudit       bool
+	}{
+		{name: "regular token", method: "POST", route: "/api/v1/user/password", wantStatus: consts.StatusOK, wantNext: true},
+		{name: "allowed path", impersonationID: 5, method: "GET", route: "/api/v1/conversations", wantStatus: consts.StatusOK, wantNext: true, wantAudit: true},
+		{name: "blocked path", impersonationID: 5, method: "PUT", route: "/api/v1/user/password", wantStatus: consts.StatusForbidden, wantAudit: true},
+		{name: "blocked method", impersonationID: 5, method: "POST", route: "/api/v1/conversations/:id/shares", wantStatus: consts.StatusForbidden, wantAudit: true},
+		{name: "other method on blocked route", impersonationID: 5, method: "GET", route: "/api/v1/conversations/:id/shares", wantStatus: consts.StatusOK, wantNext: true, wantAudit: true},
+		{name: "integration authorization", impersonationID: 5, method: "POST", route: "/api/v1/integrations/calendar/authorize", wantStatus: consts.StatusForbidden, wantAudit: true},
+		{name: "ended session", impersonationID: 5, ended: true, method: "GET", route: "/api/v1/conversations", wantStatus: consts.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			impersonations := &fakeImpersonations{ended: tt.ended}
+			c := newClientIPContext("127.0.0.1", nil)
+			c.Request.Header.SetMethod(tt.method)
+			c.Request.SetRequestURI(tt.route)
+			c.SetFullPath(tt.route)
+			if tt.impersonationID != 0 {
+				c.Set("impersonation_id", tt.impersonationID)
+			}
+			next := false
+			c.SetHandlers(app.HandlersChain{
+				Impersonation(impersonations, blocked...),
+				func(ctx context.Context, c *app.RequestContext) { next = true },
+			})
+
+			c.Next(context.Background())
+
+			if got := c.Response.StatusCode(); got != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if next != tt.wantNext {
+				t.Fatalf("next called = %v, want %v", next, tt.wantNext)
+			}
+			if got := len(impersonations.recorded) == 1; got != tt.wantAudit {
+				t.Fatalf("audit records = %v, want one: %v", impersonations.recorded, tt.wantAudit)
+			}
+		})
+	}
+}
+
+// 连接建立后会话被结束，下一条消息被拒绝；结束前的每条消息都写入审计
+func TestSocketImpersonation(t *testing.T) {
+	impersonations := &fakeImpersonations{}
+	c := newClientIPContext("127.0.0.1", nil)
+	c.Request.SetRequestURI("/api/v1/conversations/3/ws")
+	c.Set("impersonation_id", uint(5))
+	check := SocketImpersonation(impersonations)(c)
+
+	for i := 0; i < 2; i++ {
+		if err := check(context.Background()); err != nil {
+			t.Fatalf("message %d: check() = %v", i, err)
+		}
+	}
+	impersonations.ended = true
+	if err := check(context.Background()); !errors.Is(err, service.ErrImpersonationInactive) {
+		t.Fatalf("after end: check() = %v, want %v", err, service.ErrImpersonationInactive)
+	}
+	want := "WS /api/v1/conversations/3/ws"
+	if len(impersonations.recorded) != 2 || impersonations.recorded[0] != want {
+		t.Fatalf("audit records = %v, want two %q", impersonations.recorded, want)
+	}
+
+	// 普通token不检查代入会话
+	plain := SocketImpersonation(impersonations)(newClientIPContext("127.0.0.1", nil))
+	if err := plain(context.Background()); err != nil {
+		t.Fatalf("regular token: check() = %v", err)
+	}
+}
+
+// 代入token不能访问管理接口，拒绝时不查询用户角色
+func TestAdminRejectsImpersonation(t *testing.T) {
+	c := app.NewContext(0)
+	c.Set("user_id", uint(2))
+	c.Set("impersonation_id", uint(5))
+	next := false
+	c.SetHandlers(app.HandlersChain{
+		Admin(nil),
+		func(ctx context.Context, c *app.RequestContext) { next = true },
+	})
+
+	c.Next(context.Background())
+
+	if got := c.Response.StatusCode(); got != consts.StatusForbidden {
+		t.Fatalf("status = %d, want %d", got, consts.StatusForbidden)
+	}
+	if next {
+		t.Fatal("admin handler ran for an impersonation token")
+	}
+}
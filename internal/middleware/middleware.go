@@ -2,10 +2,15 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/service"
 	"ai-chat-backend/internal/utils"
 
 	"github.com/cloudwego/hertz/pkg/app"
@@ -19,6 +24,7 @@ func CORS() app.HandlerFunc {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Expose-Headers", "Link, X-Quota-Warning")
 		c.Header("Access-Control-Max-Age", "86400")
 
 		if string(c.Method()) == "OPTIONS" {
@@ -69,8 +75,7 @@ func Auth() app.HandlerFunc {
 		}
 
 		// 验证JWT token
-		cfg := config.Load()
-		claims, err := utils.ValidateJWT(tokenString, cfg.JWT.Secret)
+		claims, err := validateJWT(tokenString)
 		if err != nil {
 			c.JSON(consts.StatusUnauthorized, map[string]string{
 				"error": "Invalid token",
@@ -80,7 +85,430 @@ func Auth() app.HandlerFunc {
 		}
 
 		// 将用户ID存储到上下文中
-		c.Set("user_id", claims.UserID)
+		setClaims(c, claims)
 		c.Next(ctx)
 	}
-}
\ No newline at end of file
+}
+
+// validateJWT 验证用户token，密钥轮换期间同时接受旧密钥签发的token
+func validateJWT(tokenString string) (*utils.Claims, error) {
+	cfg := config.Load()
+	claims, err := utils.ValidateJWT(tokenString, cfg.JWT.Secret)
+	if err != nil && cfg.JWT.PreviousSecret != "" {
+		return utils.ValidateJWT(tokenString, cfg.JWT.PreviousSecret)
+	}
+	return claims, err
+}
+
+// setClaims 将token中的用户信息存储到上下文中，管理员代入的token同时记录管理员和代入会话
+func setClaims(c *app.RequestContext, claims *utils.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("guest", claims.Guest)
+	if claims.ImpersonationID != 0 {
+		c.Set("impersonator_id", claims.ImpersonatorID)
+		c.Set("impersonation_id", claims.ImpersonationID)
+	}
+}
+
+// QueryAuth 从URL参数读取token的认证中间件（EventSource不支持自定义headers）
+func QueryAuth() app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		token := c.Query("token")
+		if token == "" {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "Token is required",
+			})
+			c.Abort()
+			return
+		}
+
+		// 移除可能的 "Bearer " 前缀
+		tokenString := strings.TrimPrefix(token, "Bearer ")
+
+		// 验证JWT token
+		claims, err := validateJWT(tokenString)
+		if err != nil {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "Invalid token",
+			})
+			c.Abort()
+			return
+		}
+
+		setClaims(c, claims)
+		c.Next(ctx)
+	}
+}
+
+// BearerSubprotocol 浏览器WebSocket不能设置请求头，客户端以子协议["bearer", "<token>"]传递token，服务端选择bearer子协议
+const BearerSubprotocol = "bearer"
+
+// SocketAuth WebSocket认证中间件，优先使用Authorization头，其次为Sec-WebSocket-Protocol中bearer之后的token。
+// 与QueryAuth不同，token不出现在URL中，不会被记入访问日志
+func SocketAuth() app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		tokenString := strings.TrimPrefix(string(c.GetHeader("Authorization")), "Bearer ")
+		if tokenString == "" {
+			tokenString = subprotocolToken(string(c.GetHeader("Sec-WebSocket-Protocol")))
+		}
+		if tokenString == "" {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "Token is required",
+			})
+			c.Abort()
+			return
+		}
+
+		claims, err := validateJWT(tokenString)
+		if err != nil {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "Invalid token",
+			})
+			c.Abort()
+			return
+		}
+
+		setClaims(c, claims)
+		c.Next(ctx)
+	}
+}
+
+// subprotocolToken 子协议列表中紧跟在bearer之后的token
+func subprotocolToken(header string) string {
+	protocols := strings.Split(header, ",")
+	for i := 0; i+1 < len(protocols); i++ {
+		if strings.TrimSpace(protocols[i]) == BearerSubprotocol {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+	return ""
+}
+
+// GuestAccess 访客token只能访问allowed中的路由，其他路由要求注册，需放在认证中间件之后
+func GuestAccess(allowed ...string) app.HandlerFunc {
+	paths := make(map[string]bool, len(allowed))
+	for _, path := range allowed {
+		paths[path] = true
+	}
+
+	return func(ctx context.Context, c *app.RequestContext) {
+		if c.GetBool("guest") && !paths[c.FullPath()] {
+			c.JSON(consts.StatusForbidden, map[string]string{
+				"error": "Registration required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// GuestQuota 访客发送消息时扣减免费额度，剩余额度在 X-Guest-Remaining 头中返回；注册用户不受影响
+func GuestQuota(guestService *service.GuestService) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !c.GetBool("guest") {
+			c.Next(ctx)
+			return
+		}
+
+		quota, err := guestService.ConsumeMessage(ctx, c.GetUint("user_id"), c.ClientIP(), string(c.UserAgent()))
+		if err != nil {
+			status := consts.StatusInternalServerError
+			switch {
+			case errors.Is(err, service.ErrGuestQuotaExceeded):
+				status = consts.StatusTooManyRequests
+			case errors.Is(err, service.ErrGuestBlocked), errors.Is(err, service.ErrGuestClientRejected):
+				status = consts.StatusForbidden
+			case errors.Is(err, service.ErrGuestUnavailable):
+				status = consts.StatusServiceUnavailable
+			}
+			c.JSON(status, map[string]string{
+				"error": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Header("X-Guest-Remaining", strconv.Itoa(quota.Remaining))
+		c.Next(ctx)
+	}
+}
+
+// Consent 条款检查中间件，条款版本更新后要求用户重新接受，需放在认证中间件之后
+func Consent(consentService *service.ConsentService) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "User not authenticated",
+			})
+			c.Abort()
+			return
+		}
+
+		required, err := consentService.RequiresAcceptance(userID.(uint))
+		if err != nil {
+			c.JSON(consts.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if required {
+			c.JSON(consts.StatusForbidden, map[string]string{
+				"error": "Terms acceptance required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// Residency 数据驻留检查中间件，用户的数据属于其他区域时返回421并在 X-Data-Region 头中给出区域，
+// 由网关或客户端转到该区域的部署，避免数据写入本区域。需放在认证中间件之后
+func Residency(userService *service.UserService) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "User not authenticated",
+			})
+			c.Abort()
+			return
+		}
+
+		if err := userService.CheckRegion(userID.(uint)); err != nil {
+			var mismatch *service.RegionMismatchError
+			if errors.As(err, &mismatch) {
+				c.Header("X-Data-Region", mismatch.Region)
+				c.JSON(http.StatusMisdirectedRequest, map[string]string{
+					"error": err.Error(),
+				})
+			} else {
+				c.JSON(consts.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// Admin 管理员权限中间件，需放在认证中间件之后
+func Admin(userService *service.UserService) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "User not authenticated",
+			})
+			c.Abort()
+			return
+		}
+
+		// 代入用户身份的token不能访问管理接口
+		if _, impersonated := c.Get("impersonation_id"); impersonated {
+			c.JSON(consts.StatusForbidden, map[string]string{
+				"error": "Admin privileges required",
+			})
+			c.Abort()
+			return
+		}
+
+		isAdmin, err := userService.IsAdmin(userID.(uint))
+		if err != nil || !isAdmin {
+			c.JSON(consts.StatusForbidden, map[string]string{
+				"error": "Admin privileges required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// ImpersonationChecker 代入会话的检查和审计，由service.ImpersonationService实现
+type ImpersonationChecker interface {
+	Check(impersonationID uint) (*model.Impersonation, error)
+	RecordRequest(impersonation *model.Impersonation, method, path string, status int, ip string)
+}
+
+// Impersonation 管理员代入用户身份的检查中间件，需放在认证中间件之后：代入会话被结束或到期后token立即失效，
+// blocked中的接口（如修改密码）不允许代入时调用，每项为路由路径（不区分方法）或"方法 路由路径"；
+// 请求在 X-Impersonated-By 头中标明管理员，处理后写入审计日志
+func Impersonation(impersonations ImpersonationChecker, blocked ...string) app.HandlerFunc {
+	paths := make(map[string]bool, len(blocked))
+	for _, path := range blocked {
+		paths[path] = true
+	}
+
+	return func(ctx context.Context, c *app.RequestContext) {
+		impersonationID := c.GetUint("impersonation_id")
+		if impersonationID == 0 {
+			c.Next(ctx)
+			return
+		}
+
+		impersonation, err := impersonations.Check(impersonationID)
+		if err != nil {
+			status := consts.StatusInternalServerError
+			if errors.Is(err, service.ErrImpersonationInactive) {
+				status = consts.StatusUnauthorized
+			}
+			c.JSON(status, map[string]string{
+				"error": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if paths[c.FullPath()] || paths[string(c.Method())+" "+c.FullPath()] {
+			c.JSON(consts.StatusForbidden, map[string]string{
+				"error": "Not allowed while impersonating",
+			})
+			c.Abort()
+			impersonations.RecordRequest(impersonation, string(c.Method()), string(c.Path()), consts.StatusForbidden, c.ClientIP())
+			return
+		}
+
+		c.Header("X-Impersonated-By", strconv.FormatUint(uint64(impersonation.AdminID), 10))
+		c.Next(ctx)
+		impersonations.RecordRequest(impersonation, string(c.Method()), string(c.Path()), c.Response.StatusCode(), c.ClientIP())
+	}
+}
+
+// SocketImpersonation WebSocket连接中每条消息（或推送）前重新检查代入会话，会话被结束或到期后关闭连接，
+// 通过检查的每条消息以"WS 路径"写入代入审计日志
+func SocketImpersonation(impersonations ImpersonationChecker) SocketCheck {
+	return func(c *app.RequestContext) func(ctx context.Context) error {
+		impersonationID := c.GetUint("impersonation_id")
+		path, ip := string(c.Path()), c.ClientIP()
+		return func(ctx context.Context) error {
+			if impersonationID == 0 {
+				return nil
+			}
+			impersonation, err := impersonations.Check(impersonationID)
+			if err != nil {
+				return err
+			}
+			impersonations.RecordRequest(impersonation, "WS", path, consts.StatusOK, ip)
+			return nil
+		}
+	}
+}
+
+// ServiceAuth 服务间调用认证中间件，与用户JWT相互独立：
+// 服务以自己的密钥签发短期token放在 X-Service-Token 头中，且只能访问授权了scope的接口
+func ServiceAuth(cfg config.InternalConfig, scope string) app.HandlerFunc {
+	services := make(map[string]config.ServiceIdentity, len(cfg.Services))
+	for _, identity := range cfg.Services {
+		services[identity.Name] = identity
+	}
+	secretFor := func(name string) (string, bool) {
+		identity, ok := services[name]
+		return identity.Secret, ok
+	}
+
+	return func(ctx context.Context, c *app.RequestContext) {
+		token := string(c.GetHeader("X-Service-Token"))
+		if token == "" {
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "Service token required",
+			})
+			c.Abort()
+			return
+		}
+
+		name, err := utils.ValidateServiceToken(token, secretFor, cfg.TokenMaxAge)
+		if err != nil {
+			hlog.Warnf("Rejected service token from %s: %v", c.ClientIP(), err)
+			c.JSON(consts.StatusUnauthorized, map[string]string{
+				"error": "Invalid service token",
+			})
+			c.Abort()
+			return
+		}
+
+		if !hasScope(services[name].Scopes, scope) {
+			c.JSON(consts.StatusForbidden, map[string]string{
+				"error": "Service not authorized for this endpoint",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("service_name", name)
+		c.Next(ctx)
+	}
+}
+
+// hasScope "*" 表示允许访问全部内部接口
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnly 只读模式中间件，开启后拒绝所有写请求，exempt 为不受限制的路由（如登录、关闭只读模式）
+func ReadOnly(systemService *service.SystemService, exempt ...string) app.HandlerFunc {
+	allowed := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		allowed[path] = true
+	}
+
+	return func(ctx context.Context, c *app.RequestContext) {
+		switch string(c.Method()) {
+		case consts.MethodGet, consts.MethodHead, consts.MethodOptions:
+			c.Next(ctx)
+			return
+		}
+
+		if systemService.IsReadOnly() && !allowed[c.FullPath()] {
+			rejectReadOnly(c)
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// Mutating 标记通过GET访问但会写入数据的路由（如流式聊天），只读模式下同样拒绝
+func Mutating(systemService *service.SystemService) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if systemService.IsReadOnly() {
+			rejectReadOnly(c)
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// SocketMutating 与Mutating相同，WebSocket连接中每条消息生成前检查只读模式
+func SocketMutating(systemService *service.SystemService) SocketCheck {
+	return func(c *app.RequestContext) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			if systemService.IsReadOnly() {
+				return ErrSocketReadOnly
+			}
+			return nil
+		}
+	}
+}
+
+func rejectReadOnly(c *app.RequestContext) {
+	c.Header("Retry-After", "120")
+	c.JSON(consts.StatusServiceUnavailable, map[string]string{
+		"error": "Service is in read-only mode",
+	})
+	c.Abort()
+}
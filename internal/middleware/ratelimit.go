@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/config"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitStore 保存令牌桶，Take取出一个令牌，返回是否允许、剩余令牌数和令牌不足时需等待的时间
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rule config.RateLimitRule) (bool, int, time.Duration, error)
+}
+
+// NewRateLimitStore rdb不为nil时在Redis中计数，多个实例共享限额，否则在内存中计数
+func NewRateLimitStore(rdb *redis.Client) RateLimitStore {
+	if rdb != nil {
+		return &redisRateLimitStore{rdb: rdb}
+	}
+	return &memoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+// RateLimit 令牌桶限流中间件，name区分不同的限额。放在认证中间件之后时按用户计数，否则按客户端IP计数；
+// 超过限额时返回429并在 Retry-After 头中给出等待秒数。存储出错时放行，不影响正常请求
+func RateLimit(store RateLimitStore, name string, rule config.RateLimitRule) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if rule.Limit <= 0 || rule.Period <= 0 {
+			c.Next(ctx)
+			return
+		}
+
+		subject := rateLimitSubject(c)
+		allowed, remaining, retryAfter, err := store.Take(ctx, "ratelimit:"+name+":"+subject, rule)
+		if err != nil {
+			hlog.Warnf("Rate limit check failed for %s: %v", subject, err)
+			c.Next(ctx)
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(rule.Burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.JSON(consts.StatusTooManyRequests, map[string]string{
+				"error": "Too many requests",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// SocketRateLimit 与RateLimit共用令牌桶，WebSocket连接中每条消息取出一个令牌，令牌不足时返回ErrSocketRateLimited
+func SocketRateLimit(store RateLimitStore, name string, rule config.RateLimitRule) SocketCheck {
+	return func(c *app.RequestContext) func(ctx context.Context) error {
+		subject := rateLimitSubject(c)
+		return func(ctx context.Context) error {
+			if rule.Limit <= 0 || rule.Period <= 0 {
+				return nil
+			}
+			allowed, _, _, err := store.Take(ctx, "ratelimit:"+name+":"+subject, rule)
+			if err != nil {
+				hlog.Warnf("Rate limit check failed for %s: %v", subject, err)
+				return nil
+			}
+			if !allowed {
+				return ErrSocketRateLimited
+			}
+			return nil
+		}
+	}
+}
+
+// rateLimitSubject 已认证时按用户计数，否则按客户端IP计数
+func rateLimitSubject(c *app.RequestContext) string {
+	if userID := c.GetUint("user_id"); userID != 0 {
+		return "user:" + strconv.FormatUint(uint64(userID), 10)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// refillRate 每纳秒补充的令牌数
+func refillRate(rule config.RateLimitRule) float64 {
+	return float64(rule.Limit) / float64(rule.Period)
+}
+
+// tokenBucket 内存中的令牌桶，记录所属规则的补充速率和容量用于清理
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  float64
+}
+
+// full 闲置到now时桶是否已补满
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+float64(now.Sub(b.last))*b.rate >= b.burst
+}
+
+// memoryRateLimitStore 单实例内存令牌桶，定期清理已补满的桶
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func (s *memoryRateLimitStore) Take(ctx context.Context, key string, rule config.RateLimitRule) (bool, int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+		s.lastSweep = now
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(rule.Burst), last: now, rate: refillRate(rule), burst: float64(rule.Burst)}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(bucket.burst, bucket.tokens+float64(now.Sub(bucket.last))*bucket.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, 0, time.Duration((1 - bucket.tokens) / bucket.rate), nil
+	}
+	bucket.tokens--
+	return true, int(bucket.tokens), 0, nil
+}
+
+// sweep 删除闲置到已补满的桶，删除后再次请求时按满桶处理，结果相同
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	for key, bucket := range s.buckets {
+		if bucket.full(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// takeTokenScript 在Redis中原子地补充并取出令牌，以Redis服务器时间计算，避免实例间时钟偏差。
+// ARGV: 每微秒补充的令牌数、桶容量；返回是否允许、剩余令牌数、需等待的微秒数
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate / 1000) + 1000)
+return {allowed, math.floor(tokens), wait}
+`)
+
+type redisRateLimitStore struct {
+	rdb *redis.Client
+}
+
+func (s *redisRateLimitStore) Take(ctx context.Context, key string, rule config.RateLimitRule) (bool, int, time.Duration, error) {
+	rate := refillRate(rule) * float64(time.Microsecond)
+	result, err := takeTokenScript.Run(ctx, s.rdb, []string{key}, strconv.FormatFloat(rate, 'g', -1, 64), rule.Burst).Int64Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	if len(result) != 3 {
+		return false, 0, 0, fmt.Errorf("unexpected rate limit result: %v", result)
+	}
+	return result[0] == 1, int(result[1]), time.Duration(result[2]) * time.Microsecond, nil
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/config"
+
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// 未认证的请求按客户端IP计数，轮换X-Forwarded-For不能绕过限额
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	clientIP, err := ClientIP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := config.RateLimitRule{Limit: 3, Period: time.Minute, Burst: 3}
+	limit := RateLimit(NewRateLimitStore(nil), "login", rule)
+
+	for i := 0; i < rule.Burst+2; i++ {
+		c := newClientIPContext("203.0.113.9", map[string]string{"X-Forwarded-For": "198.51.100." + strconv.Itoa(i)})
+		c.SetClientIPFunc(clientIP)
+		limit(context.Background(), c)
+
+		limited := c.Response.StatusCode() == consts.StatusTooManyRequests
+		if want := i >= rule.Burst; limited != want {
+			t.Fatalf("request %d: limited = %v, want %v", i+1, limited, want)
+		}
+	}
+}
+
+// 来自受信任代理的请求按转发头中的客户端IP分别计数
+func TestRateLimitTrustedProxy(t *testing.T) {
+	clientIP, err := ClientIP([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := config.RateLimitRule{Limit: 1, Period: time.Minute, Burst: 1}
+	limit := RateLimit(NewRateLimitStore(nil), "login", rule)
+
+	for i := 0; i < 3; i++ {
+		c := newClientIPContext("10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100." + strconv.Itoa(i)})
+		c.SetClientIPFunc(clientIP)
+		limit(context.Background(), c)
+		if c.Response.StatusCode() == consts.StatusTooManyRequests {
+			t.Fatalf("request from client %d was limited", i)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+var (
+	ErrSocketRateLimited = errors.New("too many requests")
+	ErrSocketReadOnly    = errors.New("service is in read-only mode")
+)
+
+// SocketCheck WebSocket连接中逐条消息的检查。中间件只在升级请求上执行一次，
+// 之后同一连接上的消息需要重新检查：升级前调用SocketCheck取出所需的请求信息，
+// 返回的函数在每条消息处理前调用，返回错误时连接以策略违规关闭
+type SocketCheck func(c *app.RequestContext) func(ctx context.Context) error
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/service"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// WebSocket中的消息与升级请求共用同一个令牌桶，升级后的每条消息继续扣减
+func TestSocketRateLimitSharesBucket(t *testing.T) {
+	rule := config.RateLimitRule{Limit: 3, Period: time.Hour, Burst: 3}
+	store := NewRateLimitStore(nil)
+
+	upgrade := app.NewContext(0)
+	upgrade.Set("user_id", uint(7))
+	RateLimit(store, "chat", rule)(context.Background(), upgrade)
+	if upgrade.Response.StatusCode() == consts.StatusTooManyRequests {
+		t.Fatal("upgrade request was limited")
+	}
+
+	check := SocketRateLimit(store, "chat", rule)(upgrade)
+	tests := []struct {
+		name string
+		want error
+	}{
+		{name: "second token", want: nil},
+		{name: "last token", want: nil},
+		{name: "bucket empty", want: ErrSocketRateLimited},
+	}
+	for _, tt := range tests {
+		if err := check(context.Background()); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: check() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSocketMutating(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		want     error
+	}{
+		{name: "writable", readOnly: false, want: nil},
+		{name: "read-only", readOnly: true, want: ErrSocketReadOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := SocketMutating(service.NewSystemService(tt.readOnly))(app.NewContext(0))
+			if err := check(context.Background()); !errors.Is(err, tt.want) {
+				t.Fatalf("check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
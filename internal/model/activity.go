@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	ActivityConversationCreated  = "conversation_created"
+	ActivityReplyCompleted       = "reply_completed"
+	ActivityConversationArchived = "conversation_archived"
+	ActivityTicketUpdated        = "ticket_updated"
+)
+
+// Activity 用户动态，按时间倒序组成活动流
+type Activity struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	UserID         uint      `json:"user_id" gorm:"not null;index:idx_activity_user_created"`
+	Type           string    `json:"type" gorm:"type:varchar(64);not null"`
+	ConversationID *uint     `json:"conversation_id,omitempty" gorm:"index"`
+	Summary        string    `json:"summary" gorm:"type:varchar(255)"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index:idx_activity_user_created"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// UserAPIKey 用户自带的模型服务API Key（BYOK），每个用户最多一个。
+// 使用自带Key的生成不受套餐额度限制、不扣减额度，用量单独累计
+type UserAPIKey struct {
+	ID              uint       `json:"id" gorm:"primarykey"`
+	UserID          uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	BaseURL         string     `json:"base_url" gorm:"type:varchar(255);not null"` // 为空表示使用服务端配置的服务
+	Model           string     `json:"model" gorm:"type:varchar(64);not null"`     // 为空表示使用服务端配置的模型
+	EncryptedKey    string     `json:"-" gorm:"type:text;not null"`                // AES-GCM加密后的Key
+	KeyHint         string     `json:"key_hint" gorm:"type:varchar(16)"`           // Key末4位，用于展示
+	LastValidatedAt *time.Time `json:"last_validated_at"`                          // 最近一次校验通过的时间
+	UsageMessages   int64      `json:"usage_messages" gorm:"default:0;not null"`   // 使用该Key生成的回复数
+	UsageTokens     int64      `json:"usage_tokens" gorm:"default:0;not null"`     // 使用该Key消耗的token数
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 附件的病毒扫描状态
+const (
+	ScanPending   = "pending"   // 隔离中，等待扫描
+	ScanClean     = "clean"     // 未发现威胁
+	ScanInfected  = "infected"  // 发现威胁，文件已删除
+	ScanUnscanned = "unscanned" // 未配置扫描服务，未经扫描
+)
+
+// Attachment 用户上传的文件。扫描完成前保存在隔离区，不能下载或使用
+type Attachment struct {
+	ID             uint           `json:"id" gorm:"primarykey"`
+	UserID         uint           `json:"user_id" gorm:"not null;index"`
+	ConversationID *uint          `json:"conversation_id" gorm:"index"`
+	MessageID      *uint          `json:"message_id" gorm:"index"` // 附带该文件发送的用户消息，一个文件只能随一条消息发送
+	Filename       string         `json:"filename" gorm:"type:varchar(255);not null"`
+	ContentType    string         `json:"content_type" gorm:"type:varchar(100);not null"`
+	Size           int64          `json:"size" gorm:"not null"`
+	SHA256         string         `json:"sha256" gorm:"type:varchar(64);not null;index"`
+	ObjectKey      string         `json:"-" gorm:"type:varchar(255)"` // 对象存储中的key，扫描通过前位于隔离区，发现威胁后清空
+	ScanStatus     string         `json:"scan_status" gorm:"type:varchar(16);not null;index"`
+	ScanSignature  string         `json:"scan_signature,omitempty" gorm:"type:varchar(255)"` // 命中的病毒特征名
+	ScannedAt      *time.Time     `json:"scanned_at"`
+	Width          int            `json:"width,omitempty"`   // 图片宽度（已按EXIF方向校正）
+	Height         int            `json:"height,omitempty"`  // 图片高度
+	Stripped       bool           `json:"metadata_stripped"` // 图片已重新编码，不含EXIF/GPS等元数据
+	CreatedAt      time.Time      `json:"created_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 图片中识别出的文字及其平均置信度（0-100），OCRAt为空表示尚未识别，识别后不含文字时OCRText为空
+	OCRText       string     `json:"ocr_text,omitempty" gorm:"type:mediumtext"`
+	OCRConfidence float64    `json:"ocr_confidence,omitempty"`
+	OCRAt         *time.Time `json:"ocr_at,omitempty"`
+
+	Variants []AttachmentVariant `json:"variants,omitempty" gorm:"foreignKey:AttachmentID"` // 图片的缩略图
+	URL      string              `json:"url,omitempty" gorm:"-"`                            // 下载地址，不入库
+}
+
+// AttachmentVariant 图片附件的缩略图，与原图保存在同一目录下
+type AttachmentVariant struct {
+	ID           uint      `json:"-" gorm:"primarykey"`
+	AttachmentID uint      `json:"-" gorm:"not null;uniqueIndex:idx_attachment_variant"`
+	Name         string    `json:"name" gorm:"type:varchar(32);not null;uniqueIndex:idx_attachment_variant"` // 如thumb_256
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type" gorm:"type:varchar(100);not null"`
+	ObjectKey    string    `json:"-" gorm:"type:varchar(255);not null"`
+	URL          string    `json:"url" gorm:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditLog 审计日志，记录账号安全相关的操作
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Action    string    `json:"action" gorm:"type:varchar(64);not null;index"`
+	Detail    string    `json:"detail" gorm:"type:text"`
+	IP        string    `json:"ip" gorm:"type:varchar(64)"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// ImpersonatorID 由管理员代入用户身份执行或与代入会话相关的记录对应的管理员，ImpersonationID为代入会话
+	ImpersonatorID  *uint `json:"impersonator_id,omitempty" gorm:"index"`
+	ImpersonationID *uint `json:"impersonation_id,omitempty" gorm:"index"`
+}
+
+// 代入会话的状态
+const (
+	ImpersonationPending  = "pending"  // 等待用户同意
+	ImpersonationApproved = "approved" // 用户已同意，等待管理员获取token
+	ImpersonationDenied   = "denied"
+	ImpersonationActive   = "active" // 已签发token，到期前有效
+	ImpersonationEnded    = "ended"  // 被管理员或用户提前结束
+)
+
+// Impersonation 管理员为排查问题代入用户身份的会话，需要用户同意时在同意后才能获取token，
+// 会话期间的每个请求都以impersonation.request写入审计日志
+type Impersonation struct {
+	ID              uint       `json:"id" gorm:"primarykey"`
+	AdminID         uint       `json:"admin_id" gorm:"not null;index"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	Reason          string     `json:"reason" gorm:"type:varchar(255);not null"`
+	Status          string     `json:"status" gorm:"type:varchar(16);not null;index"`
+	DurationSeconds int64      `json:"duration_seconds"`
+	ConsentRequired bool       `json:"consent_required"`
+	ConsentDeadline *time.Time `json:"consent_deadline,omitempty"` // 等待同意的截止时间，过期后不能再同意
+	RespondedAt     *time.Time `json:"responded_at,omitempty"`     // 用户同意或拒绝的时间
+	StartedAt       *time.Time `json:"started_at,omitempty"`       // 签发token的时间
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	EndedBy         *uint      `json:"ended_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// PromptAudit 合规审计用的模型调用记录，每轮模型调用一条（含工具调用的中间轮次），删除会话后保留
+type PromptAudit struct {
+	ID             uint   `json:"id" gorm:"primarykey"`
+	TraceID        string `json:"trace_id" gorm:"type:varchar(32);index"`
+	UserID         uint   `json:"user_id" gorm:"not null;index"`
+	ConversationID uint   `json:"conversation_id" gorm:"index"`
+	Model          string `json:"model" gorm:"type:varchar(128)"`
+	// Prompt 发送给模型的完整消息列表（JSON）
+	Prompt           string    `json:"prompt" gorm:"type:mediumtext"`
+	Response         string    `json:"response" gorm:"type:mediumtext"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Error            string    `json:"error" gorm:"type:varchar(255)"`
+	DurationMs       int64     `json:"duration_ms"`
+	CreatedAt        time.Time `json:"created_at" gorm:"index"`
+}
+
+// 安全事件的严重程度
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// 安全事件的来源和处理方式
+const (
+	IncidentSourceInput     = "user_input"
+	IncidentSourceRetrieval = "retrieval"
+
+	IncidentActionLogged  = "logged"
+	IncidentActionRefused = "refused"
+	IncidentActionDropped = "dropped"
+)
+
+// SecurityIncident 疑似提示词注入/越狱的检测记录，删除会话后保留
+type SecurityIncident struct {
+	ID             uint   `json:"id" gorm:"primarykey"`
+	TraceID        string `json:"trace_id" gorm:"type:varchar(32);index"`
+	UserID         uint   `json:"user_id" gorm:"not null;index"`
+	ConversationID uint   `json:"conversation_id" gorm:"index"`
+	Source         string `json:"source" gorm:"type:varchar(16);not null"`
+	Severity       string `json:"severity" gorm:"type:varchar(16);not null;index"`
+	// Score 0-1的风险评分，取规则和分类器评分中的较高者
+	Score float64 `json:"score"`
+	// Rules 命中的规则，逗号分隔；分类器判定时包含"classifier"
+	Rules string `json:"rules" gorm:"type:varchar(255)"`
+	// Excerpt 被检测内容的开头部分
+	Excerpt   string    `json:"excerpt" gorm:"type:text"`
+	Action    string    `json:"action" gorm:"type:varchar(16);not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
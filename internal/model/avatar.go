@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// AvatarGeneration 头像生成记录，用于按天限制每个用户的生成次数
+type AvatarGeneration struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index:idx_avatar_user_created"`
+	Prompt    string    `json:"prompt" gorm:"type:text"`
+	ObjectKey string    `json:"-" gorm:"type:varchar(255)"` // 生成成功后保存的对象，生成中为空
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_avatar_user_created"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+// 灰度发布状态
+const (
+	CanaryActive     = "active"
+	CanaryCompleted  = "completed"
+	CanaryRolledBack = "rolled_back"
+)
+
+// CanaryRollout 新模型的灰度发布，按比例将使用服务端模型的用户切到新模型，
+// 错误率或差评率超过阈值时自动回滚。同一时间只有一个进行中的灰度
+type CanaryRollout struct {
+	ID    uint   `json:"id" gorm:"primarykey"`
+	Model string `json:"model" gorm:"type:varchar(128);not null"`
+	// Percent 切到新模型的用户比例（0-100），同一用户始终落在同一侧
+	Percent int    `json:"percent" gorm:"not null"`
+	Status  string `json:"status" gorm:"type:varchar(16);not null;index"`
+	// MaxErrorRate、MaxNegativeRate 自动回滚的错误率和差评率阈值（0-1），0表示不按该项回滚
+	MaxErrorRate    float64 `json:"max_error_rate"`
+	MaxNegativeRate float64 `json:"max_negative_rate"`
+	// MinSamples 生成次数（差评率为评价数）达到该值后才判断是否回滚
+	MinSamples int   `json:"min_samples" gorm:"not null"`
+	Requests   int64 `json:"requests" gorm:"not null;default:0"`
+	Errors     int64 `json:"errors" gorm:"not null;default:0"`
+	// EndReason 回滚或结束的原因
+	EndReason string     `json:"end_reason" gorm:"type:varchar(255)"`
+	CreatedBy uint       `json:"created_by"`
+	EndedAt   *time.Time `json:"ended_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
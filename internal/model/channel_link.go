@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// 外部聊天平台
+const (
+	PlatformSlack    = "slack"
+	PlatformTelegram = "telegram"
+)
+
+// ChannelLink 外部平台频道与用户会话的映射，频道中的消息以该用户的身份继续同一会话
+type ChannelLink struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	Platform       string    `json:"platform" gorm:"type:varchar(20);not null;uniqueIndex:idx_platform_channel"`
+	ChannelID      string    `json:"channel_id" gorm:"type:varchar(100);not null;uniqueIndex:idx_platform_channel"` // Slack为 team_id:channel_id，Telegram为chat_id
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	ConversationID *uint     `json:"conversation_id"` // 频道当前对应的会话，为空或会话已删除时收到消息会新建
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	ConsentDocumentTerms   = "terms"
+	ConsentDocumentPrivacy = "privacy"
+)
+
+// UserConsent 用户接受法律条款的记录，每次接受新版本追加一条
+type UserConsent struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	Document   string    `json:"document" gorm:"type:varchar(32);not null"` // terms, privacy
+	Version    string    `json:"version" gorm:"type:varchar(64);not null"`
+	IP         string    `json:"ip" gorm:"type:varchar(64)"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// 额度流水类型
+const (
+	CreditPurchase   = "purchase"
+	CreditReward     = "reward"
+	CreditPromo      = "promo"
+	CreditGeneration = "generation"
+	CreditAdjustment = "adjustment"
+)
+
+// CreditTransaction 额度流水，Amount为正表示入账、为负表示扣减，users.credit_balance为流水汇总
+type CreditTransaction struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	Amount       int64     `json:"amount" gorm:"not null"`
+	BalanceAfter int64     `json:"balance_after" gorm:"not null"`
+	Type         string    `json:"type" gorm:"type:varchar(32);not null"`
+	Reference    string    `json:"reference" gorm:"type:varchar(128);index"` // 关联对象，如 message:123、promo:CODE、Stripe会话ID
+	CreatedAt    time.Time `json:"created_at"`
+
+	// IdempotencyKey 只入账一次的流水（如支付、注册奖励）为“类型:关联对象”，由唯一索引保证并发重试时不会重复入账；其他流水为空
+	IdempotencyKey *string `json:"-" gorm:"type:varchar(170);uniqueIndex"`
+}
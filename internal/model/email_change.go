@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// EmailChangeRequest 邮箱变更申请，确认前旧邮箱保持有效
+type EmailChangeRequest struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	NewEmail    string     `json:"new_email" gorm:"type:varchar(255);not null"`
+	TokenHash   string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// EmailDomainOverride 管理员对注册邮箱域名的单独设置，优先于一次性邮箱域名列表
+type EmailDomainOverride struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Domain    string    `json:"domain" gorm:"type:varchar(255);uniqueIndex;not null"` // 统一保存为小写
+	Allowed   bool      `json:"allowed"`                                              // true为放行列表中的域名，false为额外禁止
+	Note      string    `json:"note" gorm:"type:varchar(255)"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
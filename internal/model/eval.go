@@ -0,0 +1,76 @@
+package model
+
+import (
+	"time"
+)
+
+// 评测执行状态
+const (
+	EvalStatusRunning   = "running"
+	EvalStatusCompleted = "completed"
+	EvalStatusFailed    = "failed"
+)
+
+// EvalCase 离线评测用例，按套件分组，判分标准由服务层解析后返回
+type EvalCase struct {
+	ID     uint   `json:"id" gorm:"primarykey"`
+	Suite  string `json:"suite" gorm:"type:varchar(64);not null;index"`
+	Prompt string `json:"prompt" gorm:"type:text;not null"`
+	// Criteria 判分标准（JSON）：评审要点、必须包含和不得包含的内容等
+	Criteria  string    `json:"-" gorm:"type:text"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EvalRun 一次评测执行：以指定的模型和系统提示词版本回答套件中的全部用例并判分
+type EvalRun struct {
+	ID    uint   `json:"id" gorm:"primarykey"`
+	Suite string `json:"suite" gorm:"type:varchar(64);not null;index"`
+	Model string `json:"model" gorm:"type:varchar(128);not null"`
+	// PromptVersion 使用的系统提示词模板版本，为空时使用执行时的当前版本（未发布版本时为配置中的提示词）
+	PromptVersion *int   `json:"prompt_version"`
+	Scorer        string `json:"scorer" gorm:"type:varchar(16);not null"`
+	Status        string `json:"status" gorm:"type:varchar(16);not null"`
+	Total         int    `json:"total"`
+	Passed        int    `json:"passed"`
+	// Score 各用例得分的平均值（0-1）
+	Score      float64      `json:"score"`
+	Error      string       `json:"error" gorm:"type:varchar(255)"`
+	CreatedBy  uint         `json:"created_by"`
+	Results    []EvalResult `json:"results,omitempty" gorm:"foreignKey:RunID"`
+	CreatedAt  time.Time    `json:"created_at"`
+	FinishedAt *time.Time   `json:"finished_at"`
+}
+
+// EvalResult 评测执行中一个用例的回答和得分
+type EvalResult struct {
+	ID     uint    `json:"id" gorm:"primarykey"`
+	RunID  uint    `json:"run_id" gorm:"not null;index"`
+	CaseID uint    `json:"case_id" gorm:"not null"`
+	Answer string  `json:"answer" gorm:"type:text"`
+	Score  float64 `json:"score"`
+	Passed bool    `json:"passed"`
+	// Reason 判分说明：评审模型给出的理由或未通过的检查项
+	Reason     string    `json:"reason" gorm:"type:text"`
+	Error      string    `json:"error" gorm:"type:varchar(255)"`
+	Tokens     int64     `json:"tokens"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// EvalReport 两次评测执行的对比报告，用于判断提示词或模型变更是否带来回退
+type EvalReport struct {
+	ID             uint    `json:"id" gorm:"primarykey"`
+	BaseRunID      uint    `json:"base_run_id" gorm:"not null;index"`
+	CandidateRunID uint    `json:"candidate_run_id" gorm:"not null;index"`
+	BaseScore      float64 `json:"base_score"`
+	CandidateScore float64 `json:"candidate_score"`
+	Improved       int     `json:"improved"`
+	Regressed      int     `json:"regressed"`
+	Unchanged      int     `json:"unchanged"`
+	// Cases 各用例的得分对比（JSON），由服务层解析后返回
+	Cases     string    `json:"-" gorm:"type:mediumtext"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
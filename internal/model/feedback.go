@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+)
+
+// 回复评价
+const (
+	FeedbackUp   = "up"
+	FeedbackDown = "down"
+)
+
+// MessageFeedback 用户对AI回复的评价，每条回复只保留一次评价，再次评价时覆盖
+type MessageFeedback struct {
+	ID        uint   `json:"id" gorm:"primarykey"`
+	MessageID uint   `json:"message_id" gorm:"not null;uniqueIndex"`
+	UserID    uint   `json:"user_id" gorm:"not null;index"`
+	Rating    string `json:"rating" gorm:"type:varchar(8);not null"`
+	Comment   string `json:"comment" gorm:"type:varchar(1000)"`
+	// CanaryID 回复由灰度模型生成时为对应的灰度发布，用于计算差评率
+	CanaryID  *uint     `json:"-" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+)
+
+// 导出集成的服务方
+const (
+	IntegrationNotion = "notion"
+	IntegrationGoogle = "google"
+	// IntegrationGoogleCalendar 助手的日历工具使用的授权
+	IntegrationGoogleCalendar = "google_calendar"
+)
+
+// UserIntegration 用户通过OAuth授权的第三方集成（导出、日历），每个用户每个服务方最多一个，令牌加密保存
+type UserIntegration struct {
+	ID                    uint       `json:"id" gorm:"primarykey"`
+	UserID                uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_user_integration"`
+	Provider              string     `json:"provider" gorm:"type:varchar(32);not null;uniqueIndex:idx_user_integration"` // notion / google / google_calendar
+	AccountName           string     `json:"account_name" gorm:"type:varchar(255)"`                                      // 授权的工作区或账号名称，用于展示
+	EncryptedAccessToken  string     `json:"-" gorm:"type:text;not null"`
+	EncryptedRefreshToken string     `json:"-" gorm:"type:text"`
+	Scopes                string     `json:"scopes" gorm:"type:varchar(512)"` // 用户实际授予的权限范围，空格分隔
+	ExpiresAt             *time.Time `json:"-"`                               // 访问令牌过期时间，为空表示不过期
+	LastExportedAt        *time.Time `json:"last_exported_at"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// OAuthState 发起授权时生成的一次性state，只保存哈希。授权须由发起授权的用户登录后提交完成，且只能使用一次
+type OAuthState struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	StateHash string    `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Purpose   string    `json:"purpose" gorm:"type:varchar(64);not null"` // export:notion / export:google / calendar
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 日历修改记录的操作类型
+const CalendarActionCreateEvent = "create_event"
+
+// CalendarMutation 助手对用户日历的修改记录，失败的尝试同样记录，删除会话后保留
+type CalendarMutation struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	ConversationID uint      `json:"conversation_id" gorm:"index"`
+	Action         string    `json:"action" gorm:"type:varchar(32);not null"`
+	EventID        string    `json:"event_id" gorm:"type:varchar(255)"`
+	Summary        string    `json:"summary" gorm:"type:varchar(255)"`
+	StartAt        time.Time `json:"start_at"`
+	EndAt          time.Time `json:"end_at"`
+	Error          string    `json:"error" gorm:"type:varchar(255)"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
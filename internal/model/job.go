@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// 后台任务状态
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// Job 后台任务，由创建它的实例的任务队列执行，进度和结果写回该记录
+type Job struct {
+	ID     uint   `json:"id" gorm:"primarykey"`
+	UserID uint   `json:"user_id" gorm:"not null;index"`
+	Type   string `json:"type" gorm:"type:varchar(32);not null"`
+	Status string `json:"status" gorm:"type:varchar(16);not null;index"`
+	// Owner 执行任务的实例标识，LeaseExpiresAt之前由该实例定期续期，过期说明实例已退出
+	Owner          string     `json:"-" gorm:"type:varchar(32)"`
+	LeaseExpiresAt *time.Time `json:"-"`
+	// Progress 完成百分比（0-100），Message为当前进度说明
+	Progress   int        `json:"progress"`
+	Message    string     `json:"message" gorm:"type:varchar(255)"`
+	Result     string     `json:"result" gorm:"type:text"`
+	Error      string     `json:"error" gorm:"type:varchar(255)"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 知识库文档的处理状态
+const (
+	DocumentPending    = "pending"    // 等待提取
+	DocumentProcessing = "processing" // 提取和分块中
+	DocumentReady      = "ready"      // 可检索
+	DocumentFailed     = "failed"     // 提取失败，Error为原因
+)
+
+// 分块类型，表格单独分块
+const (
+	ChunkText  = "text"
+	ChunkTable = "table"
+)
+
+// 分块方式
+const (
+	SplitterRecursive = "recursive" // 依次按段落、行、句子、词切分
+	SplitterMarkdown  = "markdown"  // 按标题切分章节，每个分块带所在章节的标题
+	SplitterCode      = "code"      // 优先在函数、类型等顶层声明之间切分
+)
+
+// Collection 知识库，用户的文档按知识库组织。OrgID不为空时为组织知识库，由组织管理员维护，
+// 角色满足ReadRole的组织成员可以在会话中检索
+type Collection struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	UserID      uint           `json:"user_id" gorm:"not null;index"`
+	Name        string         `json:"name" gorm:"type:varchar(100);not null"`
+	Description string         `json:"description" gorm:"type:varchar(500)"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 分块设置，创建时未指定的使用服务端默认值，修改后已有文档需要重新索引才会按新设置分块
+	ChunkSize    int    `json:"chunk_size" gorm:"default:0;not null"`
+	ChunkOverlap int    `json:"chunk_overlap" gorm:"default:0;not null"`
+	Splitter     string `json:"splitter" gorm:"type:varchar(16)"`
+	// StaleDocuments 分块设置与当前设置不同、需要重新索引的文档数，不入库
+	StaleDocuments int64 `json:"stale_documents" gorm:"-"`
+
+	// OrgID 所属组织，为空时为个人知识库；ReadRole为可读取的最低组织角色（member为全体成员，admin为仅管理员）
+	OrgID    *uint  `json:"org_id" gorm:"index"`
+	ReadRole string `json:"read_role,omitempty" gorm:"type:varchar(20)"`
+}
+
+// Document 知识库中的文档，内容来自上传的附件或网页（AttachmentID为0），提取文本并分块后用于检索。
+// 提取方式和质量随文档保存，用于排查回答质量问题
+type Document struct {
+	ID           uint   `json:"id" gorm:"primarykey"`
+	UserID       uint   `json:"user_id" gorm:"not null;index"`
+	CollectionID uint   `json:"collection_id" gorm:"not null;index"`
+	AttachmentID uint   `json:"attachment_id" gorm:"not null;index"`
+	Title        string `json:"title" gorm:"type:varchar(255);not null"`
+	ContentType  string `json:"content_type" gorm:"type:varchar(100);not null"`
+	Size         int64  `json:"size" gorm:"not null"`
+	Status       string `json:"status" gorm:"type:varchar(16);not null;index"`
+	Error        string `json:"error,omitempty" gorm:"type:varchar(255)"`
+	// ExtractMethod 提取方式：text、pdf_text、ocr、mixed（部分页面OCR）、empty
+	ExtractMethod string `json:"extract_method" gorm:"type:varchar(16)"`
+	// Quality 提取质量评分（0-1），文本层按乱码比例，OCR页面按识别置信度
+	Quality  float64 `json:"quality"`
+	Pages    int     `json:"pages"`
+	OCRPages int     `json:"ocr_pages"`
+	Tables   int     `json:"tables"`
+	Chunks   int     `json:"chunks"`
+	// ChunkSettings 分块使用的设置（分块方式:大小:重叠），与知识库当前设置不同时需要重新索引
+	ChunkSettings string `json:"chunk_settings" gorm:"type:varchar(64)"`
+	// EmbeddingModel 分块向量使用的嵌入模型，为空表示未生成向量（只能关键词检索），与当前模型不同时需要重新索引
+	EmbeddingModel string `json:"embedding_model" gorm:"type:varchar(100)"`
+	// Extraction 各页的提取方式、字符数、表格数、乱码比例、OCR置信度及提取警告（JSON），列表中不返回
+	Extraction  string         `json:"extraction,omitempty" gorm:"type:mediumtext"`
+	ProcessedAt *time.Time     `json:"processed_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 网页文档的抓取信息：按ETag/Last-Modified条件请求，内容哈希未变化时不重新索引
+	SourceURL    string `json:"source_url,omitempty" gorm:"type:varchar(2048)"`
+	ETag         string `json:"etag,omitempty" gorm:"type:varchar(255)"`
+	LastModified string `json:"last_modified,omitempty" gorm:"type:varchar(64)"`
+	ContentHash  string `json:"content_hash,omitempty" gorm:"type:varchar(64)"`
+	// CrawlStatus 最近一次抓取的结果：changed、unchanged、error（CrawlError为原因）
+	CrawlStatus string `json:"crawl_status,omitempty" gorm:"type:varchar(16)"`
+	CrawlError  string `json:"crawl_error,omitempty" gorm:"type:varchar(255)"`
+	// CrawledAt 最近一次抓取时间，ChangedAt为最近一次内容变化时间，NextCrawlAt为下次定期抓取时间
+	CrawledAt   *time.Time `json:"crawled_at,omitempty"`
+	ChangedAt   *time.Time `json:"changed_at,omitempty"`
+	NextCrawlAt *time.Time `json:"next_crawl_at,omitempty" gorm:"index"`
+}
+
+// 网页文档的抓取结果
+const (
+	CrawlChanged   = "changed"
+	CrawlUnchanged = "unchanged"
+	CrawlError     = "error"
+)
+
+// DocumentChunk 文档分块，Page为所在页码（纯文本文件为1）
+type DocumentChunk struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	DocumentID   uint      `json:"document_id" gorm:"not null;index"`
+	CollectionID uint      `json:"collection_id" gorm:"not null;index"`
+	Seq          int       `json:"seq"`
+	Page         int       `json:"page"`
+	Kind         string    `json:"kind" gorm:"type:varchar(16);not null"`
+	Content      string    `json:"content" gorm:"type:text;not null"`
+	Embedding    []byte    `json:"-" gorm:"type:mediumblob"` // 内容的向量（float32小端序），未生成时为空
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ConversationCollection 会话绑定的知识库，生成回复时检索其中的文档
+type ConversationCollection struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	ConversationID uint      `json:"conversation_id" gorm:"not null;uniqueIndex:idx_conversation_collection"`
+	CollectionID   uint      `json:"collection_id" gorm:"not null;uniqueIndex:idx_conversation_collection;index"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+)
+
+// MCPServer 管理员注册的MCP服务，会话启用后其工具和资源可供AI调用
+type MCPServer struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	Name           string    `json:"name" gorm:"type:varchar(32);not null;uniqueIndex"` // 作为工具名前缀，如 github__search
+	URL            string    `json:"url" gorm:"type:varchar(500);not null"`
+	EncryptedToken string    `json:"-" gorm:"type:text"` // AES-GCM加密后的Bearer token，为空表示不认证
+	Enabled        bool      `json:"enabled" gorm:"not null"`
+	CreatedBy      uint      `json:"created_by" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ConversationTool 会话启用的MCP服务
+type ConversationTool struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	ConversationID uint      `json:"conversation_id" gorm:"not null;uniqueIndex:idx_conversation_server"`
+	ServerID       uint      `json:"server_id" gorm:"not null;uniqueIndex:idx_conversation_server;index"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ToolInvocation 工具调用审计记录，参数和结果截断保存
+type ToolInvocation struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	ConversationID uint      `json:"conversation_id" gorm:"not null;index"`
+	ServerID       uint      `json:"server_id" gorm:"not null;index"` // 内置工具为0
+	Tool           string    `json:"tool" gorm:"type:varchar(128);not null"`
+	Arguments      string    `json:"arguments" gorm:"type:text"`
+	Result         string    `json:"result" gorm:"type:text"`
+	Error          string    `json:"error" gorm:"type:varchar(255)"`
+	DurationMs     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
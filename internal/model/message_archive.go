@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// MessageArchive 移入冷存储的一批消息内容，对象为gzip压缩的JSON Lines。
+// 消息记录保留在原表中，content清空并以cold_archive_id指向所在批次
+type MessageArchive struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	ConversationID uint       `json:"conversation_id" gorm:"not null;index"`
+	ObjectKey      string     `json:"-" gorm:"type:varchar(255);not null"`
+	MessageCount   int        `json:"message_count"`
+	Bytes          int64      `json:"bytes"` // 压缩后的对象大小
+	FirstMessageAt time.Time  `json:"first_message_at"`
+	LastMessageAt  time.Time  `json:"last_message_at"`
+	RehydratedAt   *time.Time `json:"rehydrated_at" gorm:"index"` // 恢复时间，恢复后对象已删除
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+)
+
+// ContentEncodingZstd 消息内容以zstd压缩后保存在compressed_content中，content为空
+const ContentEncodingZstd = "zstd"
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ContentCompression 长消息内容的压缩配置，以gorm插件注册到数据库连接上（db.Use），保存消息时按连接上的配置压缩。
+// 未注册时不压缩新消息，已压缩的消息仍可读取
+type ContentCompression struct {
+	// Threshold 内容达到该字节数时压缩保存，0表示不压缩
+	Threshold int
+}
+
+const contentCompressionPlugin = "message_content_compression"
+
+func (ContentCompression) Name() string {
+	return contentCompressionPlugin
+}
+
+func (ContentCompression) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// contentCompression 数据库连接上注册的压缩配置
+func contentCompression(db *gorm.DB) ContentCompression {
+	c, _ := db.Config.Plugins[contentCompressionPlugin].(ContentCompression)
+	return c
+}
+
+// ContentColumns 以map更新消息内容时使用的列，按db上注册的配置压缩，不经过BeforeSave
+func ContentColumns(db *gorm.DB, content string) map[string]interface{} {
+	encoding, compressed := contentCompression(db).compress(content)
+	if encoding != "" {
+		content = ""
+	}
+	return map[string]interface{}{
+		"content":            content,
+		"content_encoding":   encoding,
+		"compressed_content": compressed,
+	}
+}
+
+// compress 内容达到阈值且压缩后更小时返回编码和压缩后的内容，否则返回空
+func (c ContentCompression) compress(content string) (string, []byte) {
+	if c.Threshold <= 0 || len(content) < c.Threshold {
+		return "", nil
+	}
+	compressed := zstdEncoder.EncodeAll([]byte(content), make([]byte, 0, len(content)/2))
+	if len(compressed) >= len(content) {
+		return "", nil
+	}
+	return ContentEncodingZstd, compressed
+}
+
+// BeforeSave 以结构体保存消息时按阈值压缩内容。以map更新时不处理，应使用ContentColumns
+func (m *Message) BeforeSave(tx *gorm.DB) error {
+	if _, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		return nil
+	}
+	m.ContentEncoding, m.CompressedContent = contentCompression(tx).compress(m.Content)
+	if m.ContentEncoding != "" {
+		m.plainContent = m.Content
+		m.Content = ""
+	}
+	return nil
+}
+
+// AfterSave 保存后恢复调用方结构体中的原文，之后的处理（推送、缓存等）不受压缩影响
+func (m *Message) AfterSave(tx *gorm.DB) error {
+	if m.ContentEncoding != "" {
+		m.Content = m.plainContent
+		m.plainContent = ""
+		m.CompressedContent = nil
+	}
+	return nil
+}
+
+// AfterFind 读取后解压内容，查询未选择压缩列时不处理
+func (m *Message) AfterFind(tx *gorm.DB) error {
+	if m.ContentEncoding == "" || len(m.CompressedContent) == 0 {
+		return nil
+	}
+	if m.ContentEncoding != ContentEncodingZstd {
+		return fmt.Errorf("message %d: unsupported content encoding %q", m.ID, m.ContentEncoding)
+	}
+	content, err := zstdDecoder.DecodeAll(m.CompressedContent, nil)
+	if err != nil {
+		return fmt.Errorf("message %d: decompress content: %w", m.ID, err)
+	}
+	m.Content = string(content)
+	m.CompressedContent = nil
+	return nil
+}
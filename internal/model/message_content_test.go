@@ -0,0 +1,97 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// newDryRunDB 只生成SQL、不连接数据库的连接，compression不为nil时注册压缩配置
+func newDryRunDB(t *testing.T, compression *ContentCompression) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compression != nil {
+		if err := db.Use(*compression); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestMessageContentCompression(t *testing.T) {
+	long := strings.Repeat("compressible content ", 100)
+	tests := []struct {
+		name           string
+		compression    *ContentCompression
+		content        string
+		wantCompressed bool
+	}{
+		{"not registered", nil, long, false},
+		{"disabled", &ContentCompression{Threshold: 0}, long, false},
+		{"below threshold", &ContentCompression{Threshold: 4096}, long, false},
+		{"at threshold", &ContentCompression{Threshold: len(long)}, long, true},
+		{"incompressible", &ContentCompression{Threshold: 1}, "x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDryRunDB(t, tt.compression)
+			msg := Message{ConversationID: 1, Role: "user", Content: tt.content}
+			stmt := db.Create(&msg).Statement
+			if stmt.Error != nil {
+				t.Fatal(stmt.Error)
+			}
+
+			var encoding string
+			var compressed []byte
+			for _, v := range stmt.Vars {
+				switch v := v.(type) {
+				case []byte:
+					compressed = v
+				case string:
+					if v == ContentEncodingZstd {
+						encoding = v
+					}
+				}
+			}
+			if got := encoding != "" && len(compressed) > 0; got != tt.wantCompressed {
+				t.Fatalf("compressed = %v, want %v", got, tt.wantCompressed)
+			}
+			// 保存后调用方的结构体仍是原文
+			if msg.Content != tt.content || msg.CompressedContent != nil {
+				t.Fatal("content not restored after save")
+			}
+
+			columns := ContentColumns(db, tt.content)
+			if got := columns["content_encoding"] == ContentEncodingZstd; got != tt.wantCompressed {
+				t.Fatalf("ContentColumns compressed = %v, want %v", got, tt.wantCompressed)
+			}
+			if !tt.wantCompressed {
+				return
+			}
+			if columns["content"] != "" {
+				t.Fatal("ContentColumns kept plain content")
+			}
+
+			read := Message{ContentEncoding: ContentEncodingZstd, CompressedContent: compressed}
+			if err := read.AfterFind(db); err != nil {
+				t.Fatal(err)
+			}
+			if read.Content != tt.content {
+				t.Fatal("decompressed content differs")
+			}
+		})
+	}
+}
+
+func TestMessageAfterFindCorrupt(t *testing.T) {
+	msg := Message{ID: 1, ContentEncoding: ContentEncodingZstd, CompressedContent: []byte("\xef\xbf\xbd not zstd")}
+	if err := msg.AfterFind(nil); err == nil {
+		t.Fatal("expected an error for corrupt compressed content")
+	}
+}
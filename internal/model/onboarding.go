@@ -0,0 +1,13 @@
+package model
+
+import (
+	"time"
+)
+
+// OnboardingStep 用户完成的新手引导步骤，每个用户每个步骤只记录一次
+type OnboardingStep struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_onboarding_user_step"`
+	Step        string    `json:"step" gorm:"type:varchar(32);not null;uniqueIndex:idx_onboarding_user_step"`
+	CompletedAt time.Time `json:"completed_at"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+// 组织成员角色
+const (
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization 组织，成员共享组织管理员注册的模型服务
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null"`
+	Region    string    `json:"region" gorm:"type:varchar(16)"` // 数据驻留区域，与创建者相同，只能添加同一区域的成员
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationMember 组织成员
+type OrganizationMember struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	OrgID     uint      `json:"org_id" gorm:"not null;uniqueIndex:idx_org_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_org_user;index"`
+	Role      string    `json:"role" gorm:"type:varchar(20);default:member;not null"` // admin / member
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ModelEndpoint 组织私有的模型服务（如自建vLLM、Azure OpenAI部署），Key加密存储
+type ModelEndpoint struct {
+	ID              uint       `json:"id" gorm:"primarykey"`
+	OrgID           uint       `json:"org_id" gorm:"not null;index"`
+	Name            string     `json:"name" gorm:"type:varchar(100);not null"`
+	Provider        string     `json:"provider" gorm:"type:varchar(20);default:openai;not null"` // openai（含vLLM等兼容服务）/ azure
+	APIVersion      string     `json:"api_version" gorm:"type:varchar(32)"`                      // Azure API版本
+	BaseURL         string     `json:"base_url" gorm:"type:varchar(255);not null"`
+	Model           string     `json:"model" gorm:"type:varchar(64);not null"` // Azure时为部署名
+	EncryptedKey    string     `json:"-" gorm:"type:text"`                     // AES-GCM加密后的Key，自建服务可以为空
+	KeyHint         string     `json:"key_hint" gorm:"type:varchar(16)"`       // Key末4位，用于展示
+	LastValidatedAt *time.Time `json:"last_validated_at"`
+	CreatedBy       uint       `json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+)
+
+// Plan 订阅套餐及其额度，数值类限制为0表示不限制
+type Plan struct {
+	ID                 uint      `json:"id" gorm:"primarykey"`
+	Code               string    `json:"code" gorm:"type:varchar(32);uniqueIndex;not null"`
+	Name               string    `json:"name" gorm:"not null"`
+	Level              int       `json:"level" gorm:"default:0;not null"` // 套餐等级，越大越高，兑换优惠码时只升级不降级
+	MessagesPerDay     int       `json:"messages_per_day" gorm:"default:0"`
+	TokensPerDay       int64     `json:"tokens_per_day" gorm:"default:0"` // 每日token上限（输入与输出之和）
+	MaxConversations   int       `json:"max_conversations" gorm:"default:0"`
+	AllowedModels      string    `json:"allowed_models" gorm:"type:varchar(512)"` // 逗号分隔的模型名，为空表示不限制
+	MaxDocumentStorage int64     `json:"max_document_storage" gorm:"default:0"`   // 文档存储上限（字节）
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// AllowsModel 套餐是否允许使用指定模型
+func (p *Plan) AllowsModel(name string) bool {
+	if strings.TrimSpace(p.AllowedModels) == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(p.AllowedModels, ",") {
+		if strings.TrimSpace(allowed) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DailyUsage 用户每日用量，按UTC日期统计，无痕会话同样计入，使用自带Key或组织模型服务的生成不计入。
+// 用于检查套餐的每日额度，明细见UsageRecord
+type DailyUsage struct {
+	UserID           uint      `json:"user_id" gorm:"primaryKey"`
+	Date             string    `json:"date" gorm:"type:char(10);primaryKey"` // YYYY-MM-DD
+	Messages         int64     `json:"messages" gorm:"default:0;not null"`
+	PromptTokens     int64     `json:"prompt_tokens" gorm:"default:0;not null"`
+	CompletionTokens int64     `json:"completion_tokens" gorm:"default:0;not null"`
+	TotalTokens      int64     `json:"total_tokens" gorm:"default:0;not null"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// UsageRecord 一次生成的token用量，按用户时区的日期记录，用于导出用量明细。
+// Cost按服务端配置的单价计算，使用自带Key或组织模型服务的生成不计费用
+type UsageRecord struct {
+	ID               uint      `json:"id" gorm:"primarykey"`
+	UserID           uint      `json:"user_id" gorm:"index:idx_usage_user_date;not null"`
+	Date             string    `json:"date" gorm:"type:char(10);index:idx_usage_user_date;not null"` // YYYY-MM-DD
+	MessageID        uint      `json:"message_id"`
+	Model            string    `json:"model" gorm:"type:varchar(100)"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+	Cost             float64   `json:"cost"`
+	Estimated        bool      `json:"estimated"` // 模型未返回用量，按tokenizer估算
+	CreatedAt        time.Time `json:"created_at"`
+}
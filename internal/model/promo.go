@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// PromoCode 优惠码，可赠送套餐升级和/或token额度
+type PromoCode struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	Code           string     `json:"code" gorm:"type:varchar(64);uniqueIndex;not null"` // 统一保存为大写
+	Plan           string     `json:"plan" gorm:"type:varchar(32)"`                      // 赠送的套餐，为空表示不升级套餐
+	PlanDays       int        `json:"plan_days" gorm:"default:0"`                        // 套餐有效天数，0表示长期有效
+	Credits        int64      `json:"credits" gorm:"default:0"`
+	MaxRedemptions int        `json:"max_redemptions" gorm:"default:0"` // 最多兑换次数，0表示不限制
+	Redemptions    int        `json:"redemptions" gorm:"default:0;not null"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	CreatedBy      uint       `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// PromoRedemption 优惠码兑换记录，每个用户每个优惠码只能兑换一次
+type PromoRedemption struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	PromoCodeID uint      `json:"promo_code_id" gorm:"not null;uniqueIndex:idx_promo_user"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_promo_user;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// PromptTemplate 提示词模板的一个版本，同名模板中已生效且未撤销的最高版本为当前版本
+type PromptTemplate struct {
+	ID      uint   `json:"id" gorm:"primarykey"`
+	Name    string `json:"name" gorm:"type:varchar(32);not null;uniqueIndex:idx_prompt_name_version"`
+	Version int    `json:"version" gorm:"not null;uniqueIndex:idx_prompt_name_version"`
+	Content string `json:"content" gorm:"type:text;not null"`
+	Note    string `json:"note" gorm:"type:varchar(255)"`
+	// AuthorID 发布该版本的管理员
+	AuthorID    uint      `json:"author_id" gorm:"not null"`
+	EffectiveAt time.Time `json:"effective_at" gorm:"not null"`
+	// RevokedAt 回滚时撤销，撤销后不再生效
+	RevokedAt *time.Time `json:"revoked_at"`
+	RevokedBy *uint      `json:"revoked_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// RefreshToken 刷新token，每次使用后轮换为同一家族（一次登录）中的新token。
+// 已轮换的token被再次使用时视为泄露，撤销整个家族
+type RefreshToken struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	FamilyID  string    `json:"family_id" gorm:"type:varchar(32);not null;index"`
+	TokenHash string    `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	// RotatedAt 使用并换发新token的时间，RevokedAt为登出、修改密码或检测到重复使用时撤销的时间
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
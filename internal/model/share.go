@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+// 分享链接撤销的原因
+const (
+	ShareRevokedManual   = "manual"    // 所有者撤销
+	ShareRevokedExpired  = "expired"   // 超过有效期
+	ShareRevokedMaxViews = "max_views" // 达到访问次数上限
+	ShareRevokedIdle     = "idle"      // 长时间无人访问
+	ShareRevokedDeleted  = "deleted"   // 会话已删除
+)
+
+// ConversationShare 会话的只读分享链接，可设置有效期和访问次数上限，撤销后不可恢复
+type ConversationShare struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	ConversationID uint       `json:"conversation_id" gorm:"not null;index"`
+	TokenHash      string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	TokenHint      string     `json:"token_hint" gorm:"type:varchar(16)"`  // token前8位，用于区分链接
+	ExpiresAt      *time.Time `json:"expires_at"`                          // 为空表示不过期
+	MaxViews       int        `json:"max_views" gorm:"default:0;not null"` // 0表示不限次数
+	ViewCount      int        `json:"view_count" gorm:"default:0;not null"`
+	LastViewedAt   *time.Time `json:"last_viewed_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" gorm:"index"`
+	RevokeReason   string     `json:"revoke_reason,omitempty" gorm:"type:varchar(16)"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// 访问统计，不入库：去重访客数（按IP和User-Agent的摘要近似）和识别为爬虫的访问次数，view_count包含爬虫访问
+	UniqueViewers int64 `json:"unique_viewers" gorm:"-"`
+	BotViews      int64 `json:"bot_views" gorm:"-"`
+}
+
+// ShareVisit 分享链接某一天的一个访客，visitor_hash为IP和User-Agent的摘要，不保存原始信息；
+// 爬虫和链接预览（如聊天软件展开链接）标记为bot，不计入去重访客数
+type ShareVisit struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	ShareID     uint      `json:"share_id" gorm:"not null;uniqueIndex:idx_share_visit"`
+	Date        string    `json:"date" gorm:"type:char(10);not null;uniqueIndex:idx_share_visit;index"` // YYYY-MM-DD（UTC）
+	VisitorHash string    `json:"-" gorm:"type:varchar(32);not null;uniqueIndex:idx_share_visit"`
+	Bot         bool      `json:"bot" gorm:"default:false;not null"`
+	Views       int       `json:"views" gorm:"default:1;not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
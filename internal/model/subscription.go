@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionCanceled = "canceled"
+)
+
+// Subscription 用户的付费订阅，与Stripe订阅同步
+type Subscription struct {
+	ID                   uint       `json:"id" gorm:"primarykey"`
+	UserID               uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Plan                 string     `json:"plan" gorm:"type:varchar(32);not null"`
+	Status               string     `json:"status" gorm:"type:varchar(32);not null"`
+	StripeCustomerID     string     `json:"-" gorm:"type:varchar(64);index"`
+	StripeSubscriptionID string     `json:"-" gorm:"type:varchar(64);index"`
+	CurrentPeriodEnd     *time.Time `json:"current_period_end"`
+	GraceUntil           *time.Time `json:"grace_until"` // 扣款失败后的宽限期截止时间，过期后降级为免费套餐
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// 工单状态
+const (
+	TicketStatusOpen       = "open"
+	TicketStatusInProgress = "in_progress"
+	TicketStatusResolved   = "resolved"
+	TicketStatusClosed     = "closed"
+)
+
+// 工单处理记录的动作
+const (
+	TicketActionCreated       = "created"
+	TicketActionAssigned      = "assigned"
+	TicketActionStatusChanged = "status_changed"
+)
+
+// SupportTicket 用户提交给人工客服的工单，可关联会话；用户同意时附带提交时的会话记录
+type SupportTicket struct {
+	ID             uint   `json:"id" gorm:"primarykey"`
+	UserID         uint   `json:"user_id" gorm:"not null;index"`
+	ConversationID *uint  `json:"conversation_id,omitempty" gorm:"index"`
+	Subject        string `json:"subject" gorm:"type:varchar(200);not null"`
+	Message        string `json:"message" gorm:"type:text;not null"`
+	// Transcript 提交时会话的markdown快照，会话之后被修改或删除不影响工单
+	Transcript string     `json:"transcript,omitempty" gorm:"type:mediumtext"`
+	Status     string     `json:"status" gorm:"type:varchar(16);not null;index"`
+	AssigneeID *uint      `json:"assignee_id,omitempty" gorm:"index"` // 负责处理的管理员
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// SupportTicketEvent 工单的处理记录，状态变更的备注会发送给用户
+type SupportTicketEvent struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	TicketID   uint      `json:"ticket_id" gorm:"not null;index"`
+	ActorID    uint      `json:"actor_id" gorm:"not null"`
+	Action     string    `json:"action" gorm:"type:varchar(32);not null"`
+	FromStatus string    `json:"from_status,omitempty" gorm:"type:varchar(16)"`
+	ToStatus   string    `json:"to_status,omitempty" gorm:"type:varchar(16)"`
+	AssigneeID *uint     `json:"assignee_id,omitempty"`
+	Note       string    `json:"note,omitempty" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
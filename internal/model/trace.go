@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// GenerationTrace 一次回复的生成过程，用于排查回复的来由，JSON字段按原样返回。删除会话后保留
+type GenerationTrace struct {
+	ID             uint   `json:"id" gorm:"primarykey"`
+	TraceID        string `json:"trace_id" gorm:"type:varchar(32);uniqueIndex"`
+	UserID         uint   `json:"user_id" gorm:"not null;index"`
+	ConversationID uint   `json:"conversation_id" gorm:"index"`
+	// MessageID 保存回复的助手消息，生成失败时为空
+	MessageID *uint  `json:"message_id" gorm:"index"`
+	Assistant string `json:"assistant" gorm:"type:varchar(64)"`
+	Query     string `json:"query" gorm:"type:text"`
+	// Context 提示词模板组装后发送给模型的消息（JSON）
+	Context string `json:"context" gorm:"type:mediumtext"`
+	// Retrieval 检索命中的文档（JSON）
+	Retrieval string `json:"retrieval" gorm:"type:mediumtext"`
+	// RetrievalDiagnostics 检索诊断：检索方式、扫描的分块数、各候选的关键词/向量/融合/重排得分及是否选中（JSON）
+	RetrievalDiagnostics string `json:"retrieval_diagnostics" gorm:"type:mediumtext"`
+	// ModelCalls 各轮模型调用的参数、用量和耗时（JSON）
+	ModelCalls string `json:"model_calls" gorm:"type:mediumtext"`
+	// ToolCalls 工具调用的参数、结果和耗时（JSON）
+	ToolCalls string `json:"tool_calls" gorm:"type:mediumtext"`
+	// Timings 各流水线节点的耗时（毫秒，JSON）
+	Timings    string    `json:"timings" gorm:"type:varchar(255)"`
+	Error      string    `json:"error" gorm:"type:varchar(255)"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
@@ -7,42 +7,140 @@ import (
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primarykey"`
-	Email     string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
-	Password  string         `json:"-" gorm:"not null"`
-	Nickname  string         `json:"nickname" gorm:"not null"`
-	Avatar    string         `json:"avatar"`
-	IsActive  bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                uint           `json:"id" gorm:"primarykey"`
+	Email             string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Username          *string        `json:"username" gorm:"type:varchar(32);uniqueIndex"` // 可选的唯一用户名，可用于登录和署名
+	Password          string         `json:"-" gorm:"not null"`
+	Nickname          string         `json:"nickname" gorm:"not null"`
+	Avatar            string         `json:"avatar"`
+	IsActive          bool           `json:"is_active" gorm:"default:true"`
+	Role              string         `json:"role" gorm:"type:varchar(20);default:user;not null"`    // 用户角色：user / admin
+	Plan              string         `json:"plan" gorm:"type:varchar(32);default:free;not null"`    // 订阅套餐编码，对应plans.code
+	PlanExpiresAt     *time.Time     `json:"plan_expires_at"`                                       // 套餐到期时间（如优惠码赠送），为空表示长期有效
+	CreditBalance     int64          `json:"credit_balance" gorm:"default:0;not null"`              // token额度余额
+	MaxOutputTokens   int            `json:"max_output_tokens" gorm:"default:0"`                    // 单次回复token上限，0表示使用服务端默认值
+	ConversationCount int64          `json:"conversation_count" gorm:"default:0;not null"`          // 当前会话数，由计数器维护并定期校正
+	MessageCount      int64          `json:"message_count" gorm:"default:0;not null"`               // 当前会话中已保存的消息数（不含无痕会话）
+	AutoArchiveDays   int            `json:"auto_archive_days" gorm:"default:0;not null"`           // 会话闲置多少天后自动归档，0使用服务端默认值，负数表示不自动归档
+	Timezone          string         `json:"timezone" gorm:"type:varchar(64);default:UTC;not null"` // IANA时区名，用于按用户本地日期统计用量
+	Language          string         `json:"language" gorm:"type:varchar(16)"`                      // 首选语言（BCP 47，如zh-CN），用作图片文字识别等的语言提示
+	Region            string         `json:"region" gorm:"type:varchar(16);index"`                  // 数据驻留区域，决定数据存储的部署和使用的模型服务，为空表示默认区域
+	EmailVerifiedAt   *time.Time     `json:"email_verified_at"`                                     // 邮箱确认时间，为空表示邮箱未经确认
+	VerifyPending     bool           `json:"verify_pending" gorm:"default:false;not null"`          // 注册后等待验证邮箱，验证前不能登录，与管理员停用（is_active）相互独立
+	Guest             bool           `json:"guest" gorm:"default:false;not null;index"`             // 未注册的访客，注册后会话转入新账号并删除访客
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// WelcomedAt 首次登录时创建欢迎会话的时间，为空表示尚未登录过
+	WelcomedAt *time.Time `json:"-"`
 
 	// 关联关系
 	Conversations []Conversation `json:"conversations,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// Location 用户所在时区，未设置或无法识别时为UTC
+func (u *User) Location() *time.Location {
+	return LoadLocation(u.Timezone)
+}
+
+// LoadLocation 按IANA时区名加载时区，失败时返回UTC
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Conversation struct {
-	ID        uint           `json:"id" gorm:"primarykey"`
-	UserID    uint           `json:"user_id" gorm:"not null;index"`
-	Title     string         `json:"title" gorm:"not null"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primarykey"`
+	UserID          uint           `json:"user_id" gorm:"not null;index;index:idx_conversations_user_last_message,priority:1;index:idx_conversations_user_created,priority:1;index:idx_conversations_user_updated,priority:1;index:idx_conversations_user_title,priority:1"`
+	Title           string         `json:"title" gorm:"type:varchar(255);not null;index:idx_conversations_user_title,priority:2"`
+	Incognito       bool           `json:"incognito" gorm:"default:false"`                                                    // 无痕会话：消息仅存Redis，创建后不可修改
+	LastMessageAt   time.Time      `json:"last_message_at" gorm:"index;index:idx_conversations_user_last_message,priority:2"` // 最后一条消息的时间，会话列表默认按它排序；修改标题不会改变它
+	AutoArchive     bool           `json:"auto_archive" gorm:"default:true;not null"`                                         // 是否允许闲置后自动归档
+	ArchivedAt      *time.Time     `json:"archived_at" gorm:"index"`                                                          // 归档时间，收到新消息时自动取消归档
+	ModelEndpointID *uint          `json:"model_endpoint_id" gorm:"index"`                                                    // 选用的组织模型服务，为空时使用默认模型
+	CreatedAt       time.Time      `json:"created_at" gorm:"index:idx_conversations_user_created,priority:2"`
+	UpdatedAt       time.Time      `json:"updated_at" gorm:"index:idx_conversations_user_updated,priority:2"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 知识库检索设置：RetrievalEnabled为false时生成回复不检索会话启用的知识库，
+	// SourceBudget为每次回复最多引用的分块数，0表示使用服务端默认值
+	RetrievalEnabled bool `json:"retrieval_enabled" gorm:"default:true;not null"`
+	SourceBudget     int  `json:"source_budget" gorm:"default:0;not null"`
+
+	// Model 选用的模型（AI_PROVIDERS中的模型名称），为空时使用默认模型，单条消息可另行指定
+	Model string `json:"model,omitempty" gorm:"type:varchar(100)"`
+
+	// 会话级的生成设置：SystemPrompt附加在助手的系统提示词之后、安全约束之前；Temperature为空时使用模型默认值；
+	// MaxTokens为单次回复的输出上限，0表示使用用户或服务端的设置
+	SystemPrompt string   `json:"system_prompt,omitempty" gorm:"type:text"`
+	Temperature  *float32 `json:"temperature,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty" gorm:"default:0;not null"`
+
+	// Assistant 生成回复使用的助手（流水线）名称，为空时使用默认助手
+	Assistant string `json:"assistant,omitempty" gorm:"type:varchar(64)"`
 
 	// 关联关系
-	User     User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	Messages []Message `json:"messages,omitempty" gorm:"foreignKey:ConversationID"`
+	User     User              `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Messages []Message         `json:"messages,omitempty" gorm:"foreignKey:ConversationID"`
+	Tags     []ConversationTag `json:"tags,omitempty" gorm:"foreignKey:ConversationID"`
+}
+
+// ConversationTag 用户给会话加的标签，会话列表可按标签筛选
+type ConversationTag struct {
+	ID             uint      `json:"-" gorm:"primarykey"`
+	ConversationID uint      `json:"-" gorm:"not null;uniqueIndex:idx_conversation_tag"`
+	UserID         uint      `json:"-" gorm:"not null;index:idx_conversation_tags_user_name"`
+	Name           string    `json:"name" gorm:"type:varchar(50);not null;uniqueIndex:idx_conversation_tag;index:idx_conversation_tags_user_name"`
+	CreatedAt      time.Time `json:"-"`
 }
 
+// RoleSummary 自动汇总较早消息生成的摘要消息
+const RoleSummary = "summary"
+
+// RoleTool 生成回复过程中模型调用工具的结果，content为返回给模型的结果，只用于展示，不作为后续上下文
+const RoleTool = "tool"
+
 type Message struct {
-	ID             uint           `json:"id" gorm:"primarykey"`
-	ConversationID uint           `json:"conversation_id" gorm:"not null;index"`
-	Role           string         `json:"role" gorm:"not null"` // user, assistant
-	Content        string         `json:"content" gorm:"type:text;not null"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                uint           `json:"id" gorm:"primarykey"`
+	ConversationID    uint           `json:"conversation_id" gorm:"not null;index;index:idx_messages_conversation_created,priority:1"`
+	Role              string         `json:"role" gorm:"not null"` // user, assistant, summary, tool
+	Content           string         `json:"content" gorm:"type:text;not null"`
+	ContentEncoding   string         `json:"-" gorm:"type:varchar(16)"` // 为zstd时内容压缩保存在compressed_content中，content列为空，读取时自动解压
+	CompressedContent []byte         `json:"-" gorm:"type:mediumblob"`
+	Compacted         bool           `json:"compacted" gorm:"default:false;not null;index"`      // 已汇总进摘要消息，仍可查看但不再作为上下文
+	PromptVersions    string         `json:"prompt_versions,omitempty" gorm:"type:varchar(255)"` // 生成回复使用的提示词模板版本，如"system:3,guardrail:1"
+	ColdArchiveID     *uint          `json:"cold_archive_id,omitempty" gorm:"index"`             // 内容已移入冷存储的批次，恢复前content为空
+	CanaryID          *uint          `json:"-" gorm:"index"`                                     // 由灰度模型生成的回复对应的灰度发布
+	MergedFromID      *uint          `json:"merged_from_id,omitempty" gorm:"index"`              // 合并会话时并入的消息原属的会话
+	RedactedAt        *time.Time     `json:"redacted_at,omitempty" gorm:"index"`                 // 内容被用户涂抹的时间，涂抹后content为空，不再作为上下文或被导出
+	SecretTypes       string         `json:"secret_types,omitempty" gorm:"type:varchar(255)"`    // 检测到并已替换为占位的凭据类型，逗号分隔，如"aws_access_key,private_key"
+	AttachmentText    string         `json:"attachment_text,omitempty" gorm:"type:mediumtext"`   // 从消息附带的图片中识别出的文字，发送给模型时附在内容之后
+	SourcesUsed       int            `json:"sources_used,omitempty" gorm:"default:0"`            // 生成回复时作为参考资料提供给模型的知识库分块数
+	Cancelled         bool           `json:"cancelled,omitempty" gorm:"default:false;not null"`  // 生成被用户中止，content为中止前已生成的部分
+	Model             string         `json:"model,omitempty" gorm:"type:varchar(100)"`           // 生成回复的模型，选用的模型服务出错改用默认模型时为默认模型
+	ToolCallID        string         `json:"tool_call_id,omitempty" gorm:"type:varchar(64)"`     // tool消息对应的模型工具调用ID
+	ToolName          string         `json:"tool_name,omitempty" gorm:"type:varchar(64)"`        // tool消息调用的工具名
+	ToolArguments     string         `json:"tool_arguments,omitempty" gorm:"type:text"`          // tool消息的调用参数（JSON）
+	CreatedAt         time.Time      `json:"created_at" gorm:"index:idx_messages_conversation_created,priority:2"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// 关联关系
 	Conversation Conversation `json:"conversation,omitempty" gorm:"foreignKey:ConversationID"`
-}
\ No newline at end of file
+	Attachments  []Attachment `json:"attachments,omitempty" gorm:"foreignKey:MessageID"`
+
+	// plainContent 保存期间暂存压缩前的原文
+	plainContent string
+}
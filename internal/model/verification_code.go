@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+// 验证码用途
+const (
+	VerificationEmail         = "email_verification" // 注册后确认邮箱
+	VerificationPasswordReset = "password_reset"     // 忘记密码时重置密码
+)
+
+// VerificationCode 发送到邮箱的一次性验证码，只保存摘要。同一用户同一用途只保留最新的一个未使用的验证码，
+// 过期、已使用或校验次数达到上限后失效
+type VerificationCode struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_verification_user_purpose"`
+	Purpose   string     `json:"purpose" gorm:"type:varchar(32);not null;index:idx_verification_user_purpose"`
+	Email     string     `json:"email" gorm:"type:varchar(255);not null"` // 发送到的邮箱，邮箱修改后验证码失效
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);not null"`
+	Attempts  int        `json:"attempts" gorm:"default:0;not null"` // 已校验的次数
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// ConversationWebhook 会话级webhook，会话中每条AI回复完成后向URL推送消息内容
+type ConversationWebhook struct {
+	ID              uint       `json:"id" gorm:"primarykey"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	ConversationID  uint       `json:"conversation_id" gorm:"not null;index"`
+	URL             string     `json:"url" gorm:"type:varchar(500);not null"`
+	Secret          string     `json:"-" gorm:"type:varchar(64);not null"` // 签名密钥，只在创建时返回
+	LastStatus      int        `json:"last_status"`                        // 最近一次推送的HTTP状态码，0表示未推送或请求失败
+	LastError       string     `json:"last_error" gorm:"type:varchar(255)"`
+	LastDeliveredAt *time.Time `json:"last_delivered_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
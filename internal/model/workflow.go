@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+)
+
+// 工作流执行状态
+const (
+	WorkflowStatusRunning   = "running"
+	WorkflowStatusCompleted = "completed"
+	WorkflowStatusFailed    = "failed"
+)
+
+// Workflow 用户保存的工作流定义，可反复在会话中执行
+type Workflow struct {
+	ID          uint   `json:"id" gorm:"primarykey"`
+	UserID      uint   `json:"user_id" gorm:"not null;index"`
+	Name        string `json:"name" gorm:"type:varchar(100);not null"`
+	Description string `json:"description" gorm:"type:varchar(500)"`
+	// Definition 角色、步骤和停止条件（JSON），由服务层解析后返回
+	Definition string    `json:"-" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WorkflowRun 一次多智能体工作流执行，最终答案作为助手消息保存到会话
+type WorkflowRun struct {
+	ID             uint `json:"id" gorm:"primarykey"`
+	UserID         uint `json:"user_id" gorm:"not null;index"`
+	ConversationID uint `json:"conversation_id" gorm:"not null;index"`
+	// WorkflowID 执行的已保存工作流，临时定义的执行为空
+	WorkflowID *uint  `json:"workflow_id" gorm:"index"`
+	Status     string `json:"status" gorm:"type:varchar(16);not null"`
+	Input      string `json:"input" gorm:"type:text"`
+	// Definition 本次执行的步骤定义（JSON）
+	Definition string `json:"definition" gorm:"type:text"`
+	Output     string `json:"output" gorm:"type:text"`
+	Error      string `json:"error" gorm:"type:varchar(255)"`
+	// MessageID 保存最终答案的助手消息
+	MessageID   *uint             `json:"message_id"`
+	TotalTokens int64             `json:"total_tokens"`
+	Steps       []WorkflowStepRun `json:"steps,omitempty" gorm:"foreignKey:RunID"`
+	CreatedAt   time.Time         `json:"created_at"`
+	FinishedAt  *time.Time        `json:"finished_at"`
+}
+
+// WorkflowStepRun 工作流中一个步骤的输出
+type WorkflowStepRun struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	RunID      uint      `json:"run_id" gorm:"not null;index"`
+	Name       string    `json:"name" gorm:"type:varchar(32);not null"`
+	Agent      string    `json:"agent" gorm:"type:varchar(32);not null"`
+	Output     string    `json:"output" gorm:"type:text"`
+	Error      string    `json:"error" gorm:"type:varchar(255)"`
+	Tokens     int64     `json:"tokens"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
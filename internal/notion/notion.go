@@ -0,0 +1,256 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	notionAPIBase = "https://api.notion.com/v1"
+	notionVersion = "2022-06-28"
+	// maxBlocksPerRequest 创建页面和追加子块时每次请求最多携带的块数
+	maxBlocksPerRequest = 100
+	// maxTextLength 单个rich_text对象的最大字符数
+	maxTextLength = 2000
+)
+
+// ErrUnauthorized 授权已失效（用户撤销或移除了集成），需要重新授权
+var ErrUnauthorized = errors.New("notion authorization is no longer valid")
+
+// Client Notion API的最小封装，只包含OAuth授权和创建页面
+type Client struct {
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+}
+
+func NewClient(clientID, clientSecret string) *Client {
+	return &Client{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// AuthURL 用户授权页面地址
+func (c *Client) AuthURL(redirectURI, state string) string {
+	query := url.Values{
+		"client_id":     {c.clientID},
+		"response_type": {"code"},
+		"owner":         {"user"},
+		"redirect_uri":  {redirectURI},
+		"state":         {state},
+	}
+	return notionAPIBase + "/oauth/authorize?" + query.Encode()
+}
+
+// Token 授权码换取的访问令牌，Notion的令牌不过期
+type Token struct {
+	AccessToken   string `json:"access_token"`
+	WorkspaceName string `json:"workspace_name"`
+}
+
+// ExchangeCode 用授权码换取访问令牌
+func (c *Client) ExchangeCode(ctx context.Context, code, redirectURI string) (*Token, error) {
+	var token Token
+	err := c.call(ctx, http.MethodPost, "/oauth/token", "", map[string]string{
+		"grant_type":   "authorization_code",
+		"code":         code,
+		"redirect_uri": redirectURI,
+	}, &token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreatePage 在parentPageID下创建子页面，内容由markdown转换为块，返回新页面的地址
+func (c *Client) CreatePage(ctx context.Context, accessToken, parentPageID, title, markdown string) (string, error) {
+	blocks := Blocks(markdown)
+	first := blocks
+	if len(first) > maxBlocksPerRequest {
+		first = first[:maxBlocksPerRequest]
+	}
+
+	var page struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	err := c.call(ctx, http.MethodPost, "/pages", accessToken, map[string]interface{}{
+		"parent": map[string]string{"page_id": parentPageID},
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"title": richText(title)},
+		},
+		"children": first,
+	}, &page)
+	if err != nil {
+		return "", err
+	}
+
+	// 超出单次上限的块分批追加到页面末尾
+	for rest := blocks[len(first):]; len(rest) > 0; {
+		n := len(rest)
+		if n > maxBlocksPerRequest {
+			n = maxBlocksPerRequest
+		}
+		if err := c.call(ctx, http.MethodPatch, "/blocks/"+url.PathEscape(page.ID)+"/children", accessToken,
+			map[string]interface{}{"children": rest[:n]}, nil); err != nil {
+			return page.URL, err
+		}
+		rest = rest[n:]
+	}
+	return page.URL, nil
+}
+
+func (c *Client) call(ctx context.Context, method, path, accessToken string, params interface{}, out interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, notionAPIBase+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// 换取令牌使用客户端凭证，其余接口使用用户的访问令牌
+	if accessToken == "" {
+		req.SetBasicAuth(c.clientID, c.clientSecret)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	req.Header.Set("Notion-Version", notionVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("notion request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		if result.Message == "" {
+			result.Message = result.Error
+		}
+		return fmt.Errorf("notion error (%d): %s", resp.StatusCode, result.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// codeLanguages Notion代码块支持的语言中常见的部分，其余按纯文本显示
+var codeLanguages = map[string]string{
+	"bash": "bash", "sh": "shell", "shell": "shell", "c": "c", "cpp": "c++", "c++": "c++",
+	"css": "css", "go": "go", "html": "html", "java": "java", "javascript": "javascript",
+	"js": "javascript", "json": "json", "markdown": "markdown", "md": "markdown",
+	"python": "python", "py": "python", "rust": "rust", "sql": "sql",
+	"typescript": "typescript", "ts": "typescript", "yaml": "yaml", "yml": "yaml",
+}
+
+// Blocks 将markdown按行转换为Notion块：标题、列表、代码块和分隔线，其余为段落，行内格式保留原文
+func Blocks(markdown string) []map[string]interface{} {
+	var blocks []map[string]interface{}
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, textBlock("paragraph", strings.Join(paragraph, "\n")))
+			paragraph = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			flush()
+			language := codeLanguages[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(trimmed, "```")))]
+			if language == "" {
+				language = "plain text"
+			}
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, map[string]interface{}{
+				"object": "block",
+				"type":   "code",
+				"code": map[string]interface{}{
+					"rich_text": richText(strings.Join(code, "\n")),
+					"language":  language,
+				},
+			})
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flush()
+		case trimmed == "---" || trimmed == "***":
+			flush()
+			blocks = append(blocks, map[string]interface{}{"object": "block", "type": "divider", "divider": map[string]interface{}{}})
+		case strings.HasPrefix(trimmed, "### "):
+			flush()
+			blocks = append(blocks, textBlock("heading_3", trimmed[4:]))
+		case strings.HasPrefix(trimmed, "## "):
+			flush()
+			blocks = append(blocks, textBlock("heading_2", trimmed[3:]))
+		case strings.HasPrefix(trimmed, "# "):
+			flush()
+			blocks = append(blocks, textBlock("heading_1", trimmed[2:]))
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			flush()
+			blocks = append(blocks, textBlock("bulleted_list_item", trimmed[2:]))
+		case strings.HasPrefix(trimmed, "> "):
+			flush()
+			blocks = append(blocks, textBlock("quote", trimmed[2:]))
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func textBlock(blockType, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"object":  "block",
+		"type":    blockType,
+		blockType: map[string]interface{}{"rich_text": richText(text)},
+	}
+}
+
+// richText 按单个对象的长度上限切分文本
+func richText(text string) []map[string]interface{} {
+	runes := []rune(text)
+	parts := make([]map[string]interface{}, 0, len(runes)/maxTextLength+1)
+	for len(runes) > 0 {
+		n := len(runes)
+		if n > maxTextLength {
+			n = maxTextLength
+		}
+		parts = append(parts, map[string]interface{}{
+			"type": "text",
+			"text": map[string]string{"content": string(runes[:n])},
+		})
+		runes = runes[n:]
+	}
+	return parts
+}
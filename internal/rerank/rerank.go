@@ -0,0 +1,106 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Client 重排模型接口的最小封装，兼容Cohere/Jina风格的/rerank接口
+// （请求query、documents、top_n，返回各文档的index和relevance_score），
+// 硅基流动、Jina、Cohere及自部署的TEI、Xinference等均提供该接口
+type Client struct {
+	url        string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// New url为完整的接口地址（如https://api.jina.ai/v1/rerank），不以/rerank结尾时自动追加
+func New(url, apiKey, model string, timeout time.Duration) *Client {
+	url = strings.TrimRight(url, "/")
+	if !strings.HasSuffix(url, "/rerank") {
+		url += "/rerank"
+	}
+	return &Client{
+		url:        url,
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Model 使用的重排模型
+func (c *Client) Model() string {
+	return c.model
+}
+
+// Result 文档在输入中的序号及相关度
+type Result struct {
+	Index int     `json:"index"`
+	Score float64 `json:"relevance_score"`
+}
+
+// Rerank 按与query的相关度对documents排序，返回相关度最高的topN个（按相关度降序）
+func (c *Client) Rerank(ctx context.Context, query string, documents []string, topN int) ([]Result, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"model":            c.model,
+		"query":            query,
+		"documents":        documents,
+		"top_n":            topN,
+		"return_documents": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Message string `json:"message"`
+			Detail  string `json:"detail"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		if result.Message == "" {
+			result.Message = result.Detail
+		}
+		return nil, fmt.Errorf("rerank error (%d): %s", resp.StatusCode, result.Message)
+	}
+
+	var result struct {
+		Results []Result `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid rerank response: %w", err)
+	}
+	valid := result.Results[:0]
+	for _, r := range result.Results {
+		if r.Index >= 0 && r.Index < len(documents) {
+			valid = append(valid, r)
+		}
+	}
+	sort.SliceStable(valid, func(i, j int) bool { return valid[i].Score > valid[j].Score })
+	return valid, nil
+}
@@ -0,0 +1,153 @@
+package secrets
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Source 密钥来源，返回以环境变量名为键的密钥。目前只有 VaultSource 一种实现
+type Source interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// ChangeFunc 密钥轮换后的回调
+type ChangeFunc func(oldValue, newValue string)
+
+// Manager 从外部密钥来源加载密钥并写入进程环境变量，配置仍统一经 config.Load 读取。
+// 定期刷新时只更新发生变化的密钥，需要重建连接的组件通过OnChange处理轮换
+type Manager struct {
+	source  Source
+	timeout time.Duration
+
+	mu       sync.Mutex
+	values   map[string]string
+	handlers map[string][]ChangeFunc
+	onUse    map[string]bool
+}
+
+func NewManager(source Source, timeout time.Duration) *Manager {
+	return &Manager{
+		source:   source,
+		timeout:  timeout,
+		values:   make(map[string]string),
+		handlers: make(map[string][]ChangeFunc),
+		onUse:    make(map[string]bool),
+	}
+}
+
+// Load 加载全部密钥，启动时在 config.Load 之前调用
+func (m *Manager) Load() error {
+	_, err := m.refresh()
+	return err
+}
+
+// OnChange 注册密钥轮换回调
+func (m *Manager) OnChange(key string, fn ChangeFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[key] = append(m.handlers[key], fn)
+}
+
+// ReadOnUse 标记每次使用时都重新读取配置的密钥，轮换后无需回调即可生效。
+// 既没有回调也没有标记的密钥只在启动时读取，轮换后会记录警告提示重启
+func (m *Manager) ReadOnUse(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		m.onUse[key] = true
+	}
+}
+
+// Value 最近一次从密钥来源读取的值，来源中没有该密钥时返回空
+func (m *Manager) Value(key string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[key]
+}
+
+// Start 定期刷新密钥，返回停止函数
+func (m *Manager) Start(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				changed, err := m.refresh()
+				if err != nil {
+					log.Printf("Failed to refresh secrets: %v", err)
+					continue
+				}
+				if len(changed) > 0 {
+					log.Printf("Rotated secrets: %v", changed)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// refresh 拉取密钥并写入环境变量，返回发生变化的键（不含值）
+func (m *Manager) refresh() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	values, err := m.source.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type change struct {
+		key, oldValue, newValue string
+	}
+	var changes []change
+
+	m.mu.Lock()
+	for key, value := range values {
+		oldValue, loaded := m.values[key]
+		if loaded && oldValue == value {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		m.values[key] = value
+		// 首次加载不算轮换
+		if loaded {
+			changes = append(changes, change{key: key, oldValue: oldValue, newValue: value})
+		}
+	}
+	handlers := make(map[string][]ChangeFunc, len(m.handlers))
+	for key, fns := range m.handlers {
+		handlers[key] = fns
+	}
+	onUse := make(map[string]bool, len(m.onUse))
+	for key := range m.onUse {
+		onUse[key] = true
+	}
+	m.mu.Unlock()
+
+	changed := make([]string, 0, len(changes))
+	for _, c := range changes {
+		changed = append(changed, c.key)
+		if len(handlers[c.key]) == 0 && !onUse[c.key] {
+			log.Printf("Secret %s rotated but is only read at startup, restart to apply", c.key)
+		}
+		for _, fn := range handlers[c.key] {
+			fn(c.oldValue, c.newValue)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,83 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type staticSource struct {
+	values map[string]string
+}
+
+func (s *staticSource) Fetch(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string, len(s.values))
+	for key, value := range s.values {
+		values[key] = value
+	}
+	return values, nil
+}
+
+func TestManagerRefresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		initial     string
+		rotated     string
+		wantChanged []string
+		wantCalls   [][2]string
+	}{
+		{
+			name:        "unchanged value is not a rotation",
+			initial:     "one",
+			rotated:     "one",
+			wantChanged: []string{},
+		},
+		{
+			name:        "rotation calls handler with old and new value",
+			initial:     "one",
+			rotated:     "two",
+			wantChanged: []string{"SECRETS_TEST_KEY"},
+			wantCalls:   [][2]string{{"one", "two"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SECRETS_TEST_KEY", "")
+			source := &staticSource{values: map[string]string{"SECRETS_TEST_KEY": tt.initial}}
+			m := NewManager(source, time.Second)
+
+			var calls [][2]string
+			m.OnChange("SECRETS_TEST_KEY", func(oldValue, newValue string) {
+				calls = append(calls, [2]string{oldValue, newValue})
+			})
+
+			if err := m.Load(); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if len(calls) != 0 {
+				t.Fatalf("initial load called handler: %v", calls)
+			}
+			if got := os.Getenv("SECRETS_TEST_KEY"); got != tt.initial {
+				t.Fatalf("env after load = %q, want %q", got, tt.initial)
+			}
+
+			source.values["SECRETS_TEST_KEY"] = tt.rotated
+			changed, err := m.refresh()
+			if err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if got := os.Getenv("SECRETS_TEST_KEY"); got != tt.rotated {
+				t.Errorf("env after refresh = %q, want %q", got, tt.rotated)
+			}
+		})
+	}
+}
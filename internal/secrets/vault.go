@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// VaultSource 从HashiCorp Vault的KV引擎读取密钥，密钥的键应为对应的环境变量名（如 JWT_SECRET）
+type VaultSource struct {
+	addr      string
+	path      string
+	token     string
+	tokenFile string
+	namespace string
+	client    *http.Client
+}
+
+// NewVaultSource path为KV的API路径（KV v2如 secret/data/ai-chat），
+// tokenFile非空时每次读取前重新读取文件，配合Vault Agent自动续期
+func NewVaultSource(addr, path, token, tokenFile, namespace string) *VaultSource {
+	return &VaultSource{
+		addr:      strings.TrimRight(addr, "/"),
+		path:      strings.Trim(path, "/"),
+		token:     token,
+		tokenFile: tokenFile,
+		namespace: namespace,
+		client:    &http.Client{},
+	}
+}
+
+type vaultResponse struct {
+	Data map[string]json.RawMessage `json:"data"`
+}
+
+func (v *VaultSource) Fetch(ctx context.Context) (map[string]string, error) {
+	token := v.token
+	if v.tokenFile != "" {
+		data, err := os.ReadFile(v.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+v.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	// KV v2的密钥在 data.data 中，KV v1直接在 data 中
+	fields := result.Data
+	if nested, ok := result.Data["data"]; ok {
+		fields = nil
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return nil, fmt.Errorf("failed to decode vault secret: %w", err)
+		}
+	}
+
+	values := make(map[string]string, len(fields))
+	for key, raw := range fields {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("vault secret %s is not a string", key)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type ActivityService struct {
+	db *gorm.DB
+}
+
+func NewActivityService(db *gorm.DB) *ActivityService {
+	return &ActivityService{db: db}
+}
+
+// Record 记录一条用户动态，写入失败只打印日志
+func (s *ActivityService) Record(userID uint, activityType string, conversationID *uint, summary string) {
+	activity := model.Activity{
+		UserID:         userID,
+		Type:           activityType,
+		ConversationID: conversationID,
+		Summary:        summary,
+	}
+	if err := s.db.Create(&activity).Error; err != nil {
+		log.Printf("Failed to record activity %s for user %d: %v", activityType, userID, err)
+	}
+}
+
+// GetActivities 分页获取用户动态，最新的在前
+func (s *ActivityService) GetActivities(userID uint, page, pageSize int) ([]model.Activity, int64, error) {
+	var activities []model.Activity
+	var total int64
+
+	query := s.db.Where("user_id = ?", userID)
+
+	// 获取总数
+	if err := query.Model(&model.Activity{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 分页查询
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&activities).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return activities, total, nil
+}
+
+// Subscribe 订阅会话、消息和工单事件生成用户动态，自动归档和工单状态变更也会出现在动态中提醒用户
+func (s *ActivityService) Subscribe(bus events.Bus) {
+	bus.Subscribe(events.ConversationCreated, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.ConversationPayload)
+		if !ok {
+			return nil
+		}
+		s.Record(event.UserID, model.ActivityConversationCreated, &payload.ConversationID, payload.Title)
+		return nil
+	})
+	bus.Subscribe(events.ConversationArchived, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.ConversationPayload)
+		if !ok {
+			return nil
+		}
+		s.Record(event.UserID, model.ActivityConversationArchived, &payload.ConversationID, payload.Title)
+		return nil
+	})
+	bus.Subscribe(events.MessageCreated, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.MessagePayload)
+		if !ok || payload.Role != "assistant" {
+			return nil
+		}
+		s.Record(event.UserID, model.ActivityReplyCompleted, &payload.ConversationID, payload.ConversationTitle)
+		return nil
+	})
+	bus.Subscribe(events.SupportTicketUpdated, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.SupportTicketPayload)
+		if !ok {
+			return nil
+		}
+		s.Record(event.UserID, model.ActivityTicketUpdated, nil, fmt.Sprintf("#%d %s: %s", payload.TicketID, payload.Subject, payload.Status))
+		return nil
+	})
+}
@@ -2,93 +2,537 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/tokenizer"
 
 	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
-	"ai-chat-backend/internal/config"
+)
+
+const (
+	// finishReasonLength 模型因达到max_tokens而停止生成时返回的结束原因
+	finishReasonLength = "length"
+	// minInputTokens 输出预留配置过大时仍允许的最小消息token数
+	minInputTokens = 1000
 )
 
 type AIService struct {
-	model *openai.ChatModel
+	// mu 保护model和rotatedKey，服务端API Key轮换时替换
+	mu              sync.RWMutex
+	model           *openai.ChatModel
+	rotatedKey      string
+	endpoint        Endpoint
+	timeout         time.Duration
+	maxOutputTokens int
+	contextWindow   int
+	// region 区域模型服务所属的区域，服务端默认模型为空
+	region string
+	// regions 各区域的模型服务，为空时不按区域路由；defaultRegion为未设置区域的用户所属区域
+	regions       map[string]*AIService
+	defaultRegion string
+	// models 按模型名称索引的可选用模型服务（AI_PROVIDERS），provider为所属服务的名称
+	models   map[string]*AIService
+	provider string
+	// fallback 选用的模型服务出错时是否改用默认模型重试
+	fallback bool
 }
 
-func NewAIService(cfg *config.Config) (*AIService, error) {
-	ctx := context.Background()
-	model, err := openai.NewChatModel(ctx, &openai.ChatModelConfig{
-		BaseURL: cfg.AI.BaseURL,
-		APIKey:  cfg.AI.APIKey,
-		Timeout: cfg.AI.Timeout,
-		Model:   cfg.AI.Model,
-	})
+var ErrModelNotFound = errors.New("model is not available")
+
+// ModelInfo 用户可选用的模型，Provider为AI_PROVIDERS中的服务名称，默认模型为空
+type ModelInfo struct {
+	Model    string `json:"model"`
+	Provider string `json:"provider,omitempty"`
+	Default  bool   `json:"default"`
+}
+
+// GenerationResult 生成结束后的汇总信息，流式生成时在ResponseStream读到io.EOF后才完整
+type GenerationResult struct {
+	FinishReason string
+	// Usage 模型返回的token用量，模型未返回时为nil
+	Usage *schema.TokenUsage
+}
+
+// Truncated 是否因输出上限被截断
+func (r *GenerationResult) Truncated() bool {
+	return r.FinishReason == finishReasonLength
+}
+
+// TotalTokens 本次生成消耗的token数，模型未返回用量时由tokenizer估算
+func (r *GenerationResult) TotalTokens(messages []*schema.Message, content string) int64 {
+	if r.Usage != nil && r.Usage.TotalTokens > 0 {
+		return int64(r.Usage.TotalTokens)
+	}
+	return int64(tokenizer.CountMessages(messages) + tokenizer.Count(content))
+}
+
+// tokenBreakdown 本次生成的输入和输出token数，模型未返回用量时由tokenizer估算，合计与TotalTokens一致
+func (r *GenerationResult) tokenBreakdown(messages []*schema.Message, content string) (prompt, completion int64, estimated bool) {
+	if r.Usage != nil && r.Usage.TotalTokens > 0 {
+		return int64(r.Usage.PromptTokens), int64(r.Usage.TotalTokens - r.Usage.PromptTokens), false
+	}
+	return int64(tokenizer.CountMessages(messages)), int64(tokenizer.Count(content)), true
+}
+
+// 模型服务类型
+const (
+	ProviderOpenAI = "openai" // OpenAI及兼容接口的服务（如vLLM）
+	ProviderAzure  = "azure"  // Azure OpenAI，请求路径包含部署名和api-version
+
+	// 使用OpenAI兼容接口的服务，未配置地址时使用providerBaseURLs中的默认地址
+	ProviderOllama   = "ollama"
+	ProviderDeepSeek = "deepseek"
+)
+
+// providerBaseURLs 未配置地址时各服务类型的默认地址
+var providerBaseURLs = map[string]string{
+	ProviderOllama:   "http://localhost:11434/v1",
+	ProviderDeepSeek: "https://api.deepseek.com/v1",
+}
+
+// Endpoint 模型服务的连接参数
+type Endpoint struct {
+	Provider string
+	BaseURL  string
+	APIKey   string
+	Model    string
+	// Deployment Azure部署名，为空时与Model相同
+	Deployment string
+	// APIVersion Azure API版本
+	APIVersion string
+	// tokenSource 设置后使用Azure AD令牌认证，忽略APIKey
+	tokenSource *azureADTokenSource
+	// userSupplied 服务地址由用户提供（BYOK、组织模型服务），请求不能访问内网地址
+	userSupplied bool
+}
+
+// newChatModel 按服务类型创建模型客户端
+func newChatModel(endpoint Endpoint, timeout time.Duration) (*openai.ChatModel, error) {
+	cfg := &openai.ChatModelConfig{
+		BaseURL: endpoint.BaseURL,
+		APIKey:  endpoint.APIKey,
+		Timeout: timeout,
+		Model:   endpoint.Model,
+	}
+	if endpoint.userSupplied {
+		cfg.HTTPClient = newGuardedHTTPClient(timeout)
+	}
+	if endpoint.Provider == ProviderAzure {
+		deployment := endpoint.Deployment
+		if deployment == "" {
+			deployment = endpoint.Model
+		}
+		cfg.ByAzure = true
+		cfg.APIVersion = endpoint.APIVersion
+		// 请求路径为 /openai/deployments/{deployment}/chat/completions
+		cfg.AzureModelMapperFunc = func(string) string { return deployment }
+		if endpoint.tokenSource != nil {
+			cfg.HTTPClient = &http.Client{
+				Timeout:   timeout,
+				Transport: &azureADTransport{base: http.DefaultTransport, source: endpoint.tokenSource},
+			}
+		}
+	}
+
+	model, err := openai.NewChatModel(context.Background(), cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OpenAI model: %w", err)
 	}
-
-	return &AIService{
-		model: model,
-	}, nil
+	return model, nil
 }
 
-// GenerateResponse 生成AI回复
-func (s *AIService) GenerateResponse(ctx context.Context, messages []*schema.Message) (string, error) {
-	resp, err := s.model.Generate(ctx, messages)
+func NewAIService(cfg *config.Config) (*AIService, error) {
+	endpoint := Endpoint{
+		Provider:   cfg.AI.Provider,
+		BaseURL:    cfg.AI.BaseURL,
+		APIKey:     cfg.AI.APIKey,
+		Model:      cfg.AI.Model,
+		Deployment: cfg.AI.AzureDeployment,
+		APIVersion: cfg.AI.AzureAPIVersion,
+	}
+	// 未配置API Key但配置了服务主体时使用Azure AD认证
+	if endpoint.Provider == ProviderAzure && endpoint.APIKey == "" && cfg.AI.AzureTenantID != "" {
+		endpoint.tokenSource = newAzureADTokenSource(cfg.AI.AzureTenantID, cfg.AI.AzureClientID, cfg.AI.AzureClientSecret, cfg.AI.Timeout)
+	}
+
+	model, err := newChatModel(endpoint, cfg.AI.Timeout)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %w", err)
+		return nil, err
+	}
+
+	// 未配置时按模型名称推断上下文窗口
+	window := cfg.AI.ContextWindow
+	if window <= 0 {
+		window = contextWindow(cfg.AI.Model)
+	}
+
+	s := &AIService{
+		model:           model,
+		endpoint:        endpoint,
+		timeout:         cfg.AI.Timeout,
+		maxOutputTokens: cfg.AI.MaxOutputTokens,
+		contextWindow:   window,
+		fallback:        cfg.AI.Fallback,
+	}
+	if err := s.initRegions(cfg.Region); err != nil {
+		return nil, err
+	}
+	if err := s.initProviders(cfg.AI.Providers); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// initProviders 为AI_PROVIDERS中每个服务提供的模型创建模型服务，模型名称不能重复，也不能与默认模型相同
+func (s *AIService) initProviders(providers map[string]config.AIProvider) error {
+	if len(providers) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s.models = make(map[string]*AIService)
+	for _, name := range names {
+		provider := providers[name]
+		upper := strings.ToUpper(name)
+		baseURL := provider.BaseURL
+		if baseURL == "" {
+			baseURL = providerBaseURLs[provider.Type]
+		}
+		if baseURL == "" {
+			return fmt.Errorf("model provider %q: AI_PROVIDER_%s_BASE_URL is required", name, upper)
+		}
+		if len(provider.Models) == 0 {
+			return fmt.Errorf("model provider %q: AI_PROVIDER_%s_MODELS is required", name, upper)
+		}
+		apiKey := provider.APIKey
+		if apiKey == "" && provider.Type == ProviderOllama {
+			// Ollama不校验Key，客户端要求非空
+			apiKey = ProviderOllama
+		}
+		for _, modelName := range provider.Models {
+			if _, ok := s.models[modelName]; ok || modelName == s.ModelName() {
+				return fmt.Errorf("model provider %q: model %q is already served by another provider", name, modelName)
+			}
+			ai, err := s.WithEndpoint(Endpoint{
+				Provider:   provider.Type,
+				BaseURL:    baseURL,
+				APIKey:     apiKey,
+				Model:      modelName,
+				APIVersion: provider.AzureAPIVersion,
+			})
+			if err != nil {
+				return fmt.Errorf("model provider %q: %w", name, err)
+			}
+			ai.region = provider.Region
+			ai.provider = name
+			s.models[modelName] = ai
+		}
 	}
+	return nil
+}
 
-	if resp == nil || resp.Content == "" {
-		return "", fmt.Errorf("no response generated")
+// ForModel 返回区域中可选用的名为name的模型服务，name为空或为区域的默认模型时返回区域的服务。
+// 配置了数据区域时只能选用该区域的模型服务，其他模型返回ErrModelNotFound
+func (s *AIService) ForModel(region, name string) (*AIService, error) {
+	base, err := s.ForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" || name == base.ModelName() {
+		return base, nil
+	}
+	ai, ok := s.models[name]
+	if !ok || (len(s.regions) > 0 && ai.region != base.region) {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, name)
 	}
+	return ai, nil
+}
 
-	return resp.Content, nil
+// Models 区域中可选用的模型，默认模型在前，其余按名称排序
+func (s *AIService) Models(region string) ([]ModelInfo, error) {
+	base, err := s.ForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	models := []ModelInfo{{Model: base.ModelName(), Default: true}}
+	names := make([]string, 0, len(s.models))
+	for name, ai := range s.models {
+		if len(s.regions) > 0 && ai.region != base.region {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		models = append(models, ModelInfo{Model: name, Provider: s.models[name].provider})
+	}
+	return models, nil
 }
 
-// StreamResponse 流式生成AI回复
-func (s *AIService) StreamResponse(ctx context.Context, messages []*schema.Message) (<-chan string, <-chan error) {
-	respChan := make(chan string, 10) // 减小缓冲区以确保实时性
-	errorChan := make(chan error, 1)
+// Fallback 选用的模型服务出错时是否改用默认模型重试
+func (s *AIService) Fallback() bool {
+	return s.fallback
+}
 
-	go func() {
-		defer close(respChan)
-		defer close(errorChan)
+// initRegions 创建各区域的模型服务，配置了区域时默认区域必须是其中之一
+func (s *AIService) initRegions(cfg config.RegionConfig) error {
+	if len(cfg.Providers) == 0 {
+		return nil
+	}
+	if _, ok := cfg.Providers[cfg.Default]; !ok {
+		return fmt.Errorf("default data region %q has no model provider configured", cfg.Default)
+	}
 
-		log.Printf("Starting stream for %d messages", len(messages))
-		stream, err := s.model.Stream(ctx, messages)
+	s.regions = make(map[string]*AIService, len(cfg.Providers))
+	s.defaultRegion = cfg.Default
+	for region, provider := range cfg.Providers {
+		if provider.BaseURL == "" {
+			return fmt.Errorf("data region %q: REGION_%s_AI_BASE_URL is required", region, strings.ToUpper(region))
+		}
+		regional, err := s.WithEndpoint(Endpoint{
+			Provider:   provider.Provider,
+			BaseURL:    provider.BaseURL,
+			APIKey:     provider.APIKey,
+			Model:      provider.Model,
+			Deployment: provider.AzureDeployment,
+			APIVersion: provider.AzureAPIVersion,
+		})
 		if err != nil {
-			log.Printf("Failed to create stream: %v", err)
-			errorChan <- fmt.Errorf("failed to create stream: %w", err)
-			return
+			return fmt.Errorf("data region %q: %w", region, err)
+		}
+		regional.region = region
+		s.regions[region] = regional
+	}
+	return nil
+}
+
+// ForRegion 返回区域使用的模型服务，region为空时为默认区域。
+// 未配置区域时所有用户使用服务端模型；配置了区域但该区域没有模型服务时返回ErrRegionUnavailable，
+// 不会退回到其他区域的服务
+func (s *AIService) ForRegion(region string) (*AIService, error) {
+	if len(s.regions) == 0 {
+		return s, nil
+	}
+	if region == "" {
+		region = s.defaultRegion
+	}
+	regional, ok := s.regions[region]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRegionUnavailable, region)
+	}
+	return regional, nil
+}
+
+// Region 区域模型服务所属的区域，服务端默认模型为空
+func (s *AIService) Region() string {
+	return s.region
+}
+
+// WithEndpoint 使用其他模型服务创建AIService，输出上限等沿用当前配置。
+// 未指定BaseURL时视为与当前相同的服务，只替换Key（及模型）
+func (s *AIService) WithEndpoint(endpoint Endpoint) (*AIService, error) {
+	if endpoint.BaseURL == "" {
+		endpoint.Provider = s.endpoint.Provider
+		endpoint.BaseURL = s.endpoint.BaseURL
+		endpoint.APIVersion = s.endpoint.APIVersion
+		if endpoint.Model == "" {
+			endpoint.Deployment = s.endpoint.Deployment
 		}
-		defer stream.Close()
+	}
+	if endpoint.Model == "" {
+		endpoint.Model = s.endpoint.Model
+	}
+	if endpoint.Provider == "" {
+		endpoint.Provider = ProviderOpenAI
+	}
 
-		log.Printf("Stream created successfully, starting to receive chunks")
-		for {
-			chunk, err := stream.Recv()
-			if err != nil {
-				if err == io.EOF {
-					log.Printf("Stream ended normally")
-				} else {
-					log.Printf("Stream error: %v", err)
-					errorChan <- err
-				}
-				break
-			}
+	model, err := newChatModel(endpoint, s.timeout)
+	if err != nil {
+		return nil, err
+	}
 
-			if chunk != nil && chunk.Content != "" {
-			select {
-				case respChan <- chunk.Content:
-					// 成功发送
-				case <-ctx.Done():
-					log.Printf("Context cancelled")
-					return
-				}
-			}
+	return &AIService{
+		model:           model,
+		endpoint:        endpoint,
+		timeout:         s.timeout,
+		maxOutputTokens: s.maxOutputTokens,
+		contextWindow:   contextWindow(endpoint.Model),
+	}, nil
+}
+
+// WithUserEndpoint 使用用户提供的模型服务（BYOK、组织模型服务）创建AIService。
+// 指定了BaseURL时必须是公网的https地址，请求在建立连接前再次拒绝内网地址，防止借此访问内部网络
+func (s *AIService) WithUserEndpoint(endpoint Endpoint) (*AIService, error) {
+	if endpoint.BaseURL != "" {
+		if err := checkEndpointURL(endpoint.BaseURL); err != nil {
+			return nil, err
 		}
-		log.Printf("Stream processing completed")
-	}()
+		endpoint.userSupplied = true
+	}
+	return s.WithEndpoint(endpoint)
+}
+
+// SetAPIKey 轮换服务端API Key，进行中的请求继续使用原客户端完成
+func (s *AIService) SetAPIKey(apiKey string) error {
+	endpoint := s.endpoint
+	endpoint.APIKey = apiKey
+	model, err := newChatModel(endpoint, s.timeout)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.model = model
+	s.rotatedKey = apiKey
+	s.mu.Unlock()
+	return nil
+}
+
+// apiKey 当前的API Key，轮换后为新Key
+func (s *AIService) apiKey() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.rotatedKey != "" {
+		return s.rotatedKey
+	}
+	return s.endpoint.APIKey
+}
+
+func (s *AIService) chatModel() *openai.ChatModel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.model
+}
+
+// modelCallbackContext 以模型组件的身份触发context上挂载的回调。模型在流水线的Lambda节点内调用，
+// 不重新指定组件时回调收到的是Lambda节点的RunInfo，按组件分发的模型回调不会执行
+func modelCallbackContext(ctx context.Context, chatModel *openai.ChatModel, name string) context.Context {
+	return callbacks.ReuseHandlers(ctx, &callbacks.RunInfo{
+		Name:      name,
+		Type:      chatModel.GetType(),
+		Component: components.ComponentOfChatModel,
+	})
+}
+
+// Ping 发送一次最小的生成请求，用于校验服务地址、Key和模型是否可用
+func (s *AIService) Ping(ctx context.Context) error {
+	_, err := s.chatModel().Generate(ctx, []*schema.Message{schema.UserMessage("ping")}, model.WithMaxTokens(1))
+	return err
+}
+
+// ModelName 当前使用的模型名称
+func (s *AIService) ModelName() string {
+	return s.endpoint.Model
+}
+
+// Provider 当前使用的服务类型
+func (s *AIService) Provider() string {
+	return s.endpoint.Provider
+}
+
+// BaseURL 当前使用的服务地址
+func (s *AIService) BaseURL() string {
+	return s.endpoint.BaseURL
+}
+
+// MaxInputTokens 单条用户消息允许的最大token数：与组装上下文时相同，上下文窗口扣除本次回复的输出上限
+func (s *AIService) MaxInputTokens(maxOutputTokens int) int {
+	limit := s.InputBudget(maxOutputTokens)
+	if limit < minInputTokens {
+		return minInputTokens
+	}
+	return limit
+}
+
+// InputBudget 发送给模型的上下文可用的token数：上下文窗口扣除本次回复的输出上限，
+// 未配置输出上限时预留minOutputReserve
+func (s *AIService) InputBudget(maxOutputTokens int) int {
+	reserve := s.clampMaxTokens(maxOutputTokens)
+	if reserve <= 0 {
+		reserve = minOutputReserve
+	}
+	return s.contextWindow - reserve
+}
+
+// clampMaxTokens 将用户级输出上限限制在服务端配置范围内，limit<=0表示使用服务端上限
+func (s *AIService) clampMaxTokens(limit int) int {
+	if limit <= 0 || (s.maxOutputTokens > 0 && limit > s.maxOutputTokens) {
+		return s.maxOutputTokens
+	}
+	return limit
+}
+
+// options 构造本次生成的模型参数，tools不为空时允许模型调用工具
+func (s *AIService) options(maxOutputTokens int, tools []*schema.ToolInfo) []model.Option {
+	var opts []model.Option
+	if limit := s.clampMaxTokens(maxOutputTokens); limit > 0 {
+		opts = append(opts, model.WithMaxTokens(limit))
+	}
+	if len(tools) > 0 {
+		opts = append(opts, model.WithTools(tools))
+	}
+	return opts
+}
+
+// GenerateResponse 生成AI回复，返回内容以及结束原因、用量等信息
+func (s *AIService) GenerateResponse(ctx context.Context, messages []*schema.Message, maxOutputTokens int) (string, *GenerationResult, error) {
+	resp, result, err := s.GenerateWithTools(ctx, messages, maxOutputTokens, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.Content == "" {
+		return "", nil, fmt.Errorf("no response generated")
+	}
+	return resp.Content, result, nil
+}
 
-	return respChan, errorChan
-}
\ No newline at end of file
+// GenerateWithTools 生成AI回复，模型可能返回工具调用而不是内容，由调用方执行工具后继续生成。
+// extra为附加的模型参数（如会话的采样温度）
+func (s *AIService) GenerateWithTools(ctx context.Context, messages []*schema.Message, maxOutputTokens int, tools []*schema.ToolInfo, extra ...model.Option) (*schema.Message, *GenerationResult, error) {
+	chatModel := s.chatModel()
+	resp, err := chatModel.Generate(modelCallbackContext(ctx, chatModel, s.endpoint.Model), messages, append(s.options(maxOutputTokens, tools), extra...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate response: %w", err)
+	}
+
+	if resp == nil || (resp.Content == "" && len(resp.ToolCalls) == 0) {
+		return nil, nil, fmt.Errorf("no response generated")
+	}
+
+	result := &GenerationResult{}
+	if resp.ResponseMeta != nil {
+		result.FinishReason = resp.ResponseMeta.FinishReason
+		result.Usage = resp.ResponseMeta.Usage
+	}
+	return resp, result, nil
+}
+
+// Stream 流式生成AI回复，调用方必须Close返回的ResponseStream
+func (s *AIService) Stream(ctx context.Context, messages []*schema.Message, maxOutputTokens int) (*ResponseStream, error) {
+	return s.StreamWithTools(ctx, messages, maxOutputTokens, nil)
+}
+
+// StreamWithTools 流式生成AI回复，工具调用通过Chunk.ToolCalls增量返回，extra为附加的模型参数
+func (s *AIService) StreamWithTools(ctx context.Context, messages []*schema.Message, maxOutputTokens int, tools []*schema.ToolInfo, extra ...model.Option) (*ResponseStream, error) {
+	chatModel := s.chatModel()
+	reader, err := chatModel.Stream(modelCallbackContext(ctx, chatModel, s.endpoint.Model), messages, append(s.options(maxOutputTokens, tools), extra...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream: %w", err)
+	}
+	return newResponseStream(reader), nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	callbackutils "github.com/cloudwego/eino/utils/callbacks"
+)
+
+// openAIReply 模拟OpenAI接口，以reply作为回复，流式请求按SSE返回
+func openAIReply(reply string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id":"1","object":"chat.completion","model":"test-model","choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`, reply)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"test-model\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":%q}}]}\n\n", reply)
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"test-model\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+// newTestAIService 连接到handler模拟的模型服务的AIService
+func newTestAIService(t *testing.T, handler http.Handler) *AIService {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	endpoint := Endpoint{Provider: ProviderOpenAI, BaseURL: srv.URL, APIKey: "test", Model: "test-model"}
+	chatModel, err := newChatModel(endpoint, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AIService{model: chatModel, endpoint: endpoint, timeout: 5 * time.Second, contextWindow: 8192}
+}
+
+// lambdaContext 模拟流水线Lambda节点内的context，回调按Lambda组件挂载
+func lambdaContext(observed chan<- string) context.Context {
+	handler := callbackutils.NewHandlerHelper().ChatModel(&callbackutils.ModelCallbackHandler{
+		OnEnd: func(ctx context.Context, info *callbacks.RunInfo, output *einomodel.CallbackOutput) context.Context {
+			observed <- output.Message.Content
+			return ctx
+		},
+		OnEndWithStreamOutput: func(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[*einomodel.CallbackOutput]) context.Context {
+			go func() {
+				defer output.Close()
+				var content string
+				for {
+					chunk, err := output.Recv()
+					if err != nil {
+						break
+					}
+					if chunk.Message != nil {
+						content += chunk.Message.Content
+					}
+				}
+				observed <- content
+			}()
+			return ctx
+		},
+	}).Handler()
+	return callbacks.InitCallbacks(context.Background(), &callbacks.RunInfo{Name: "generate", Component: compose.ComponentOfLambda}, handler)
+}
+
+func waitObserved(t *testing.T, observed <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-observed:
+		if got != want {
+			t.Fatalf("observed content = %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("model call was not observed")
+	}
+}
+
+func TestModelCallbacksInsideLambda(t *testing.T) {
+	ai := newTestAIService(t, openAIReply("hello"))
+	messages := []*schema.Message{schema.UserMessage("hi")}
+
+	t.Run("generate", func(t *testing.T) {
+		observed := make(chan string, 1)
+		content, _, err := ai.GenerateResponse(lambdaContext(observed), messages, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != "hello" {
+			t.Fatalf("content = %q, want hello", content)
+		}
+		waitObserved(t, observed, "hello")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		observed := make(chan string, 1)
+		ctx := lambdaContext(observed)
+		stream, err := ai.Stream(ctx, messages, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		for {
+			if _, err := stream.Next(ctx); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+		waitObserved(t, observed, "hello")
+	})
+}
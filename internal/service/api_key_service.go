@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrBYOKDisabled   = errors.New("bring-your-own-key is not enabled")
+	ErrAPIKeyNotFound = errors.New("api key not configured")
+	ErrAPIKeyInvalid  = errors.New("api key validation failed")
+)
+
+// apiKeyValidateTimeout 保存或校验Key时请求模型服务的超时时间
+const apiKeyValidateTimeout = 15 * time.Second
+
+type SetAPIKeyRequest struct {
+	APIKey  string `json:"api_key" validate:"required,max=512"`
+	BaseURL string `json:"base_url" validate:"omitempty,url,max=255"`
+	Model   string `json:"model" validate:"omitempty,max=64"`
+}
+
+// APIKeyService 管理用户自带的API Key（BYOK），Key加密存储，解密只发生在创建模型客户端时
+type APIKeyService struct {
+	db        *gorm.DB
+	aiService *AIService
+	box       *utils.SecretBox
+}
+
+// NewAPIKeyService 创建BYOK服务，encryptionKey为空时不启用
+func NewAPIKeyService(db *gorm.DB, aiService *AIService, encryptionKey string) (*APIKeyService, error) {
+	s := &APIKeyService{db: db, aiService: aiService}
+	if encryptionKey != "" {
+		box, err := utils.NewSecretBox(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		s.box = box
+	}
+	return s, nil
+}
+
+// Enabled 是否启用BYOK
+func (s *APIKeyService) Enabled() bool {
+	return s.box != nil
+}
+
+// Get 获取用户的Key信息（不含Key本身）
+func (s *APIKeyService) Get(userID uint) (*model.UserAPIKey, error) {
+	var key model.UserAPIKey
+	err := s.db.Where("user_id = ?", userID).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Set 校验并保存用户的Key，已有时覆盖
+func (s *APIKeyService) Set(ctx context.Context, userID uint, req *SetAPIKeyRequest) (*model.UserAPIKey, error) {
+	if !s.Enabled() {
+		return nil, ErrBYOKDisabled
+	}
+
+	ai, err := s.aiService.WithUserEndpoint(Endpoint{BaseURL: req.BaseURL, APIKey: req.APIKey, Model: req.Model})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ping(ctx, ai); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := s.box.Encrypt(req.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := model.UserAPIKey{
+		UserID:          userID,
+		BaseURL:         req.BaseURL,
+		Model:           req.Model,
+		EncryptedKey:    encrypted,
+		KeyHint:         keyHint(req.APIKey),
+		LastValidatedAt: &now,
+	}
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"base_url", "model", "encrypted_key", "key_hint", "last_validated_at", "updated_at"}),
+	}).Create(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(userID)
+}
+
+// Delete 删除用户的Key，之后的生成恢复使用服务端模型
+func (s *APIKeyService) Delete(userID uint) error {
+	return s.db.Where("user_id = ?", userID).Delete(&model.UserAPIKey{}).Error
+}
+
+// Validate 重新校验已保存的Key
+func (s *APIKeyService) Validate(ctx context.Context, userID uint) (*model.UserAPIKey, error) {
+	key, err := s.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	ai, err := s.client(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ping(ctx, ai); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.db.Model(key).UpdateColumn("last_validated_at", now).Error; err != nil {
+		return nil, err
+	}
+	key.LastValidatedAt = &now
+	return key, nil
+}
+
+// ForUser 返回使用用户自带Key的AIService，用户未配置或未启用BYOK时返回nil
+func (s *APIKeyService) ForUser(userID uint) (*AIService, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+	key, err := s.Get(userID)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.client(key)
+}
+
+// RecordUsage 累计使用用户自带Key的用量，失败只打印日志
+func (s *APIKeyService) RecordUsage(userID uint, tokens int64) {
+	err := s.db.Model(&model.UserAPIKey{}).Where("user_id = ?", userID).UpdateColumns(map[string]interface{}{
+		"usage_messages": gorm.Expr("usage_messages + ?", 1),
+		"usage_tokens":   gorm.Expr("usage_tokens + ?", tokens),
+		"last_used_at":   time.Now(),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to record api key usage for user %d: %v", userID, err)
+	}
+}
+
+func (s *APIKeyService) client(key *model.UserAPIKey) (*AIService, error) {
+	plaintext, err := s.box.Decrypt(key.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt api key: %w", err)
+	}
+	// 未指定服务地址时使用用户所在区域的服务地址
+	base := s.aiService
+	if key.BaseURL == "" {
+		region, err := userRegion(s.db, key.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if base, err = s.aiService.ForRegion(region); err != nil {
+			return nil, err
+		}
+	}
+	return base.WithUserEndpoint(Endpoint{BaseURL: key.BaseURL, APIKey: plaintext, Model: key.Model})
+}
+
+// ping 校验Key是否可用。上游的错误信息只写日志，不返回给客户端，避免借校验读取任意地址的响应
+func (s *APIKeyService) ping(ctx context.Context, ai *AIService) error {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyValidateTimeout)
+	defer cancel()
+	if err := ai.Ping(ctx); err != nil {
+		log.Printf("API key validation against %s failed: %v", ai.BaseURL(), err)
+		return ErrAPIKeyInvalid
+	}
+	return nil
+}
+
+// keyHint 只保留Key的末4位用于展示
+func keyHint(apiKey string) string {
+	if len(apiKey) <= 4 {
+		return "****"
+	}
+	return "****" + apiKey[len(apiKey)-4:]
+}
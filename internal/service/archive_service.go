@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// archiveBatch 每批归档的会话数
+const archiveBatch = 500
+
+// ArchiveService 自动归档长时间没有新消息的会话。
+// 闲置天数由用户的auto_archive_days决定，0使用服务端默认值，负数表示不自动归档；
+// 会话的auto_archive为false时不会被归档
+type ArchiveService struct {
+	db          *gorm.DB
+	bus         events.Bus
+	defaultDays int
+}
+
+func NewArchiveService(db *gorm.DB, bus events.Bus, defaultDays int) *ArchiveService {
+	return &ArchiveService{db: db, bus: bus, defaultDays: defaultDays}
+}
+
+// ArchiveIdle 归档所有已超过闲置期限的会话，返回归档数量
+func (s *ArchiveService) ArchiveIdle() (int64, error) {
+	var archived int64
+	for {
+		now := time.Now().UTC()
+		var conversations []struct {
+			ID     uint
+			UserID uint
+			Title  string
+			// Cutoff 按用户设置计算的闲置截止时间，更新时重新比较
+			Cutoff time.Time
+		}
+		err := s.db.Table("conversations AS c").
+			Select("c.id, c.user_id, c.title, DATE_SUB(?, INTERVAL IF(u.auto_archive_days = 0, ?, u.auto_archive_days) DAY) AS cutoff", now, s.defaultDays).
+			Joins("JOIN users u ON u.id = c.user_id").
+			Where("c.deleted_at IS NULL AND c.archived_at IS NULL AND c.auto_archive = ?", true).
+			Where("u.auto_archive_days > 0 OR (u.auto_archive_days = 0 AND ? > 0)", s.defaultDays).
+			Where("c.last_message_at < DATE_SUB(?, INTERVAL IF(u.auto_archive_days = 0, ?, u.auto_archive_days) DAY)", now, s.defaultDays).
+			Order("c.id ASC").Limit(archiveBatch).
+			Scan(&conversations).Error
+		if err != nil {
+			return archived, err
+		}
+		if len(conversations) == 0 {
+			return archived, nil
+		}
+
+		for _, conversation := range conversations {
+			// 条件更新时重新检查闲置条件，查询之后刚收到新消息或关闭了自动归档的会话不归档
+			result := s.db.Model(&model.Conversation{}).
+				Where("id = ? AND archived_at IS NULL AND auto_archive = ? AND last_message_at < ?", conversation.ID, true, conversation.Cutoff).
+				UpdateColumn("archived_at", now)
+			if result.Error != nil {
+				return archived, result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			archived++
+			s.bus.Publish(context.Background(), events.New(events.ConversationArchived, conversation.UserID, events.ConversationPayload{
+				ConversationID: conversation.ID,
+				Title:          conversation.Title,
+			}))
+		}
+
+		if len(conversations) < archiveBatch {
+			return archived, nil
+		}
+	}
+}
+
+// Start 按间隔定期归档闲置会话，paused返回true时跳过本轮（如只读模式），返回停止函数
+func (s *ArchiveService) Start(interval time.Duration, paused func() bool) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				archived, err := s.ArchiveIdle()
+				if err != nil {
+					log.Printf("Failed to archive idle conversations: %v", err)
+					continue
+				}
+				if archived > 0 {
+					log.Printf("Archived %d idle conversations", archived)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
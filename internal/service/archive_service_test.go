@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+)
+
+func TestArchiveIdle(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{AutoArchiveDays: 7})
+	s := NewArchiveService(db, events.NewMemoryBus(), 30)
+
+	tests := []struct {
+		name          string
+		lastMessageAt time.Time
+		want          bool
+	}{
+		{"idle past the user's period", time.Now().AddDate(0, 0, -8), true},
+		{"recently active", time.Now().AddDate(0, 0, -6), false},
+	}
+	conversations := make([]model.Conversation, len(tests))
+	for i, tt := range tests {
+		conversations[i] = model.Conversation{UserID: user.ID, Title: tt.name, LastMessageAt: tt.lastMessageAt}
+		if err := db.Create(&conversations[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.ArchiveIdle(); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		var conversation model.Conversation
+		if err := db.First(&conversation, conversations[i].ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got := conversation.ArchivedAt != nil; got != tt.want {
+			t.Errorf("%s: archived = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
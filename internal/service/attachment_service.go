@@ -0,0 +1,607 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ai-chat-backend/internal/clamav"
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/extract"
+	"ai-chat-backend/internal/imaging"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/storage"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// attachmentScanJobType 附件扫描任务的类型
+const attachmentScanJobType = "attachment_scan"
+
+var (
+	ErrAttachmentUnavailable = errors.New("file uploads are not configured")
+	ErrAttachmentNotFound    = errors.New("attachment not found")
+	ErrAttachmentTooLarge    = errors.New("file is too large")
+	ErrAttachmentEmpty       = errors.New("file is empty")
+	ErrAttachmentPending     = errors.New("attachment is still being scanned")
+	ErrAttachmentInfected    = errors.New("attachment was rejected by the malware scan")
+	ErrVariantNotFound       = errors.New("attachment variant not found")
+)
+
+// AttachmentService 用户上传的文件。配置了ClamAV时文件先保存在隔离区，由后台任务扫描：
+// 未发现威胁时移出隔离区，发现威胁时删除文件并写入审计日志。扫描完成前不能下载。
+// 图片在可用时（未配置扫描时上传后立即，否则扫描通过后）去掉元数据并生成缩略图，随消息发送时识别其中的文字
+type AttachmentService struct {
+	db         *gorm.DB
+	store      storage.Store
+	storageCfg config.StorageConfig
+	cfg        config.UploadConfig
+	scanner    *clamav.Client
+	jobService *JobService
+	extractor  *extract.Extractor
+	bus        events.Bus
+}
+
+// NewAttachmentService store为nil时不开放上传，未配置CLAMAV_ADDR时不扫描
+func NewAttachmentService(db *gorm.DB, store storage.Store, storageCfg config.StorageConfig, cfg config.UploadConfig, jobService *JobService, extractor *extract.Extractor, bus events.Bus) *AttachmentService {
+	s := &AttachmentService{
+		db:         db,
+		store:      store,
+		storageCfg: storageCfg,
+		cfg:        cfg,
+		jobService: jobService,
+		extractor:  extractor,
+		bus:        bus,
+	}
+	if cfg.ClamAVAddr != "" {
+		s.scanner = clamav.New(cfg.ClamAVAddr, cfg.ScanTimeout)
+	}
+	return s
+}
+
+// UploadRequest 上传的文件，ConversationID不为空时文件关联到该会话
+type UploadRequest struct {
+	ConversationID *uint
+	Filename       string
+	ContentType    string
+	Data           []byte
+	IP             string
+}
+
+// Upload 保存上传的文件。需要扫描时返回的附件状态为pending，扫描结果通过任务进度和附件状态获取
+func (s *AttachmentService) Upload(ctx context.Context, userID uint, req *UploadRequest) (*model.Attachment, error) {
+	if s.store == nil {
+		return nil, ErrAttachmentUnavailable
+	}
+	if len(req.Data) == 0 {
+		return nil, ErrAttachmentEmpty
+	}
+	if int64(len(req.Data)) > s.cfg.MaxSize {
+		return nil, ErrAttachmentTooLarge
+	}
+	if req.ConversationID != nil {
+		var conversation model.Conversation
+		if err := s.db.Select("id").Where("id = ? AND user_id = ?", *req.ConversationID, userID).First(&conversation).Error; err != nil {
+			return nil, conversationError(err)
+		}
+	}
+
+	token, err := utils.GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(req.Data)
+	attachment := model.Attachment{
+		UserID:         userID,
+		ConversationID: req.ConversationID,
+		Filename:       cleanFilename(req.Filename),
+		ContentType:    detectContentType(req.ContentType, req.Data),
+		Size:           int64(len(req.Data)),
+		SHA256:         hex.EncodeToString(sum[:]),
+		ObjectKey:      attachmentKey(userID, token),
+		ScanStatus:     model.ScanUnscanned,
+	}
+	// 扫描前不解码图片，隔离区中保存原始内容
+	data := req.Data
+	var variants []imageVariant
+	if s.scanner != nil {
+		attachment.ObjectKey = quarantineKey(userID, token)
+		attachment.ScanStatus = model.ScanPending
+	} else {
+		data, variants = s.processImage(&attachment, data)
+	}
+
+	if err := s.putFiles(ctx, attachment.ObjectKey, data, variants); err != nil {
+		return nil, err
+	}
+	attachment.Variants = variantModels(variants)
+	if err := s.db.Create(&attachment).Error; err != nil {
+		s.deleteObjects(&attachment)
+		return nil, err
+	}
+
+	if s.scanner != nil {
+		// 队列已满时保持隔离，由定期重新扫描处理
+		if err := s.enqueueScan(&attachment, req.IP); err != nil {
+			log.Printf("Failed to queue scan for attachment %d: %v", attachment.ID, err)
+		}
+	}
+	s.setURLs(&attachment)
+	return &attachment, nil
+}
+
+// Get 获取附件信息，可下载时包含原图和缩略图的下载地址
+func (s *AttachmentService) Get(userID, attachmentID uint) (*model.Attachment, error) {
+	var attachment model.Attachment
+	if err := s.db.Preload("Variants").Where("id = ? AND user_id = ?", attachmentID, userID).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	s.setURLs(&attachment)
+	return &attachment, nil
+}
+
+// AttachmentFile 要下载的文件，URL不为空时重定向到限时下载地址，否则返回Data
+type AttachmentFile struct {
+	Filename    string
+	ContentType string
+	URL         string
+	Data        []byte
+}
+
+// Download 获取可下载的附件，variant不为空时下载对应的缩略图。存储支持时返回限时下载地址，否则返回文件内容
+func (s *AttachmentService) Download(ctx context.Context, userID, attachmentID uint, variant string) (*AttachmentFile, error) {
+	attachment, err := s.Get(userID, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachmentUsable(attachment); err != nil {
+		return nil, err
+	}
+
+	key := attachment.ObjectKey
+	file := AttachmentFile{Filename: attachment.Filename, ContentType: attachment.ContentType}
+	if variant != "" {
+		found := false
+		for _, v := range attachment.Variants {
+			if v.Name == variant {
+				key, found = v.ObjectKey, true
+				file.Filename = variantFilename(attachment.Filename, v.Name, v.ContentType)
+				file.ContentType = v.ContentType
+				break
+			}
+		}
+		if !found {
+			return nil, ErrVariantNotFound
+		}
+	}
+
+	file.URL, err = storage.SignedDownload(s.store, s.storageCfg, key, storage.DownloadOptions{
+		ContentType: file.ContentType,
+		Filename:    file.Filename,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if file.URL != "" {
+		return &file, nil
+	}
+	file.Data, err = s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Read 读取可用附件的内容，供服务内部处理（如知识库提取）
+func (s *AttachmentService) Read(ctx context.Context, userID, attachmentID uint) (*model.Attachment, []byte, error) {
+	attachment, err := s.Get(userID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := attachmentUsable(attachment); err != nil {
+		return nil, nil, err
+	}
+	data, err := s.store.Get(ctx, attachment.ObjectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, data, nil
+}
+
+// Delete 删除附件、缩略图及其文件
+func (s *AttachmentService) Delete(userID, attachmentID uint) error {
+	attachment, err := s.Get(userID, attachmentID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attachment_id = ?", attachment.ID).Delete(&model.AttachmentVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(attachment).Error
+	}); err != nil {
+		return err
+	}
+	s.deleteObjects(attachment)
+	return nil
+}
+
+// minOCRSize 宽或高小于此像素数的图片（图标、表情等）不识别文字
+const minOCRSize = 32
+
+// RecognizeText 识别可用图片附件中的文字，languages为tesseract语言参数，为空时使用配置的语言。
+// 结果保存在附件上，已识别过的直接返回；字符过少或置信度过低时视为不含文字，返回空字符串
+func (s *AttachmentService) RecognizeText(ctx context.Context, attachment *model.Attachment, languages string) (string, error) {
+	if attachment.OCRAt != nil {
+		return attachment.OCRText, nil
+	}
+	if !s.cfg.OCR || s.extractor == nil || !imaging.Supported(attachment.ContentType) ||
+		(attachment.Width > 0 && attachment.Width < minOCRSize) || (attachment.Height > 0 && attachment.Height < minOCRSize) {
+		return "", nil
+	}
+	_, data, err := s.Read(ctx, attachment.UserID, attachment.ID)
+	if err != nil {
+		return "", err
+	}
+	text, confidence, err := s.extractor.OCR(ctx, data, languages)
+	if errors.Is(err, extract.ErrToolMissing) {
+		// 未安装tesseract时不记录结果，安装后仍可识别
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) < s.cfg.OCRMinChars || confidence < s.cfg.OCRConfidence {
+		text = ""
+	}
+
+	now := time.Now()
+	if err := s.db.Model(attachment).Updates(map[string]interface{}{
+		"ocr_text":       text,
+		"ocr_confidence": confidence,
+		"ocr_at":         now,
+	}).Error; err != nil {
+		return "", err
+	}
+	attachment.OCRText, attachment.OCRConfidence, attachment.OCRAt = text, confidence, &now
+	return text, nil
+}
+
+// attachmentUsable 只有扫描通过或未配置扫描的附件可以下载和使用
+func attachmentUsable(attachment *model.Attachment) error {
+	switch attachment.ScanStatus {
+	case model.ScanPending:
+		return ErrAttachmentPending
+	case model.ScanInfected:
+		return ErrAttachmentInfected
+	}
+	return nil
+}
+
+// enqueueScan 将附件加入扫描任务队列
+func (s *AttachmentService) enqueueScan(attachment *model.Attachment, ip string) error {
+	_, err := s.jobService.Enqueue(attachment.UserID, attachmentScanJobType, func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		progress(0, "Scanning "+attachment.Filename)
+		status, err := s.scan(ctx, attachment.ID, ip)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"attachment_id": attachment.ID, "scan_status": status}, nil
+	})
+	return err
+}
+
+// scan 扫描隔离区中的附件，返回扫描后的状态。扫描失败时附件保持隔离，之后重新扫描
+func (s *AttachmentService) scan(ctx context.Context, attachmentID uint, ip string) (string, error) {
+	var attachment model.Attachment
+	if err := s.db.Where("id = ? AND scan_status = ?", attachmentID, model.ScanPending).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 已被删除或已由其他任务扫描
+			return "", ErrAttachmentNotFound
+		}
+		return "", err
+	}
+
+	data, err := s.store.Get(ctx, attachment.ObjectKey)
+	if err != nil {
+		return "", err
+	}
+	scanCtx, cancel := context.WithTimeout(ctx, s.cfg.ScanTimeout)
+	defer cancel()
+	result, err := s.scanner.Scan(scanCtx, data)
+	if err != nil {
+		return "", fmt.Errorf("scan attachment %d: %w", attachment.ID, err)
+	}
+
+	now := time.Now()
+	if result.Infected {
+		if err := s.db.Model(&attachment).Updates(map[string]interface{}{
+			"scan_status":    model.ScanInfected,
+			"scan_signature": result.Signature,
+			"scanned_at":     now,
+			"object_key":     "",
+		}).Error; err != nil {
+			return "", err
+		}
+		s.deleteObject(attachment.ObjectKey)
+		log.Printf("Rejected attachment %d from user %d: %s", attachment.ID, attachment.UserID, result.Signature)
+		s.bus.Publish(context.Background(), events.New(events.AttachmentInfected, attachment.UserID, events.AccountPayload{
+			IP: ip,
+			Detail: fmt.Sprintf("attachment_id=%d filename=%q sha256=%s signature=%s",
+				attachment.ID, attachment.Filename, attachment.SHA256, result.Signature),
+		}))
+		return model.ScanInfected, nil
+	}
+
+	// 移出隔离区：先处理图片并写入正式位置再更新记录，最后删除隔离区中的文件
+	quarantined := attachment.ObjectKey
+	attachment.ObjectKey = attachmentKey(attachment.UserID, path.Base(quarantined))
+	data, variants := s.processImage(&attachment, data)
+	if err := s.putFiles(ctx, attachment.ObjectKey, data, variants); err != nil {
+		return "", err
+	}
+	attachment.Variants = variantModels(variants)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Attachment{}).Where("id = ? AND scan_status = ?", attachment.ID, model.ScanPending).Updates(map[string]interface{}{
+			"scan_status":  model.ScanClean,
+			"scanned_at":   now,
+			"object_key":   attachment.ObjectKey,
+			"content_type": attachment.ContentType,
+			"size":         attachment.Size,
+			"width":        attachment.Width,
+			"height":       attachment.Height,
+			"stripped":     attachment.Stripped,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAttachmentNotFound
+		}
+		for i := range attachment.Variants {
+			attachment.Variants[i].AttachmentID = attachment.ID
+		}
+		if len(attachment.Variants) > 0 {
+			return tx.Create(&attachment.Variants).Error
+		}
+		return nil
+	})
+	if errors.Is(err, ErrAttachmentNotFound) {
+		// 已由其他任务处理，正式位置的文件内容相同，不删除
+		return "", err
+	}
+	if err != nil {
+		s.deleteObjects(&attachment)
+		return "", err
+	}
+	s.deleteObject(quarantined)
+	return model.ScanClean, nil
+}
+
+// imageVariant 待保存的缩略图及其内容
+type imageVariant struct {
+	model.AttachmentVariant
+	data []byte
+}
+
+// processImage 处理图片附件：重新编码以去掉EXIF/GPS等元数据并生成缩略图，同时更新附件的类型、大小和尺寸。
+// 返回要保存的原图内容和缩略图，不是图片或无法解码时原样返回
+func (s *AttachmentService) processImage(attachment *model.Attachment, data []byte) ([]byte, []imageVariant) {
+	if !imaging.Supported(attachment.ContentType) || (!s.cfg.StripMetadata && len(s.cfg.ThumbnailSizes) == 0) {
+		return data, nil
+	}
+	img, err := imaging.Decode(data)
+	if err != nil {
+		log.Printf("Failed to decode image %q from user %d: %v", attachment.Filename, attachment.UserID, err)
+		return data, nil
+	}
+	bounds := img.Bounds()
+	attachment.Width, attachment.Height = bounds.Dx(), bounds.Dy()
+
+	// GIF不含EXIF，重新编码会丢失动画，保留原文件
+	if s.cfg.StripMetadata && img.Format != "gif" {
+		encoded, contentType, err := imaging.Encode(img)
+		if err != nil {
+			log.Printf("Failed to re-encode image %q from user %d: %v", attachment.Filename, attachment.UserID, err)
+		} else {
+			data = encoded
+			attachment.ContentType = contentType
+			attachment.Size = int64(len(data))
+			attachment.Stripped = true
+		}
+	}
+
+	var variants []imageVariant
+	for _, size := range s.cfg.ThumbnailSizes {
+		thumb := imaging.Thumbnail(img, size)
+		if thumb == nil {
+			continue
+		}
+		encoded, contentType, err := imaging.Encode(thumb)
+		if err != nil {
+			log.Printf("Failed to encode %dpx thumbnail of %q: %v", size, attachment.Filename, err)
+			continue
+		}
+		b := thumb.Bounds()
+		variants = append(variants, imageVariant{
+			AttachmentVariant: model.AttachmentVariant{
+				Name:        fmt.Sprintf("thumb_%d", size),
+				Width:       b.Dx(),
+				Height:      b.Dy(),
+				Size:        int64(len(encoded)),
+				ContentType: contentType,
+			},
+			data: encoded,
+		})
+	}
+	return data, variants
+}
+
+// putFiles 保存文件和缩略图，缩略图的key为原文件的key加上名称后缀。失败时删除已保存的文件
+func (s *AttachmentService) putFiles(ctx context.Context, key string, data []byte, variants []imageVariant) error {
+	if err := s.store.Put(ctx, key, data); err != nil {
+		return err
+	}
+	for i := range variants {
+		variants[i].ObjectKey = key + "_" + variants[i].Name
+		if err := s.store.Put(ctx, variants[i].ObjectKey, variants[i].data); err != nil {
+			s.deleteObject(key)
+			for _, v := range variants[:i] {
+				s.deleteObject(v.ObjectKey)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func variantModels(variants []imageVariant) []model.AttachmentVariant {
+	var models []model.AttachmentVariant
+	for _, v := range variants {
+		models = append(models, v.AttachmentVariant)
+	}
+	return models
+}
+
+// setURLs 填充可下载附件及其缩略图的下载地址
+func (s *AttachmentService) setURLs(attachment *model.Attachment) {
+	if attachmentUsable(attachment) != nil {
+		return
+	}
+	attachment.URL = fmt.Sprintf("%s/%d/download", strings.TrimRight(s.cfg.URLPrefix, "/"), attachment.ID)
+	for i := range attachment.Variants {
+		attachment.Variants[i].URL = attachment.URL + "?variant=" + url.QueryEscape(attachment.Variants[i].Name)
+	}
+}
+
+// RescanPending 将隔离超过一个间隔仍未完成扫描的附件重新加入队列，返回加入的数量
+func (s *AttachmentService) RescanPending() (int, error) {
+	var attachments []model.Attachment
+	if err := s.db.Where("scan_status = ? AND created_at < ?", model.ScanPending, time.Now().Add(-s.cfg.RescanInterval)).
+		Order("id ASC").Limit(100).Find(&attachments).Error; err != nil {
+		return 0, err
+	}
+	queued := 0
+	for i := range attachments {
+		if err := s.enqueueScan(&attachments[i], ""); err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// Start 按间隔重新扫描仍在隔离区的附件，paused返回true时跳过本轮（如只读模式），返回停止函数
+func (s *AttachmentService) Start(paused func() bool) func() {
+	if s.scanner == nil || s.store == nil || s.cfg.RescanInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.cfg.RescanInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				queued, err := s.RescanPending()
+				if err != nil {
+					log.Printf("Failed to queue pending attachment scans: %v", err)
+					continue
+				}
+				if queued > 0 {
+					log.Printf("Queued %d pending attachment scans", queued)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// deleteObjects 删除附件及其缩略图的文件
+func (s *AttachmentService) deleteObjects(attachment *model.Attachment) {
+	if attachment.ObjectKey != "" {
+		s.deleteObject(attachment.ObjectKey)
+	}
+	for _, v := range attachment.Variants {
+		s.deleteObject(v.ObjectKey)
+	}
+}
+
+func (s *AttachmentService) deleteObject(key string) {
+	if err := s.store.Delete(context.Background(), key); err != nil {
+		log.Printf("Failed to delete attachment object %s: %v", key, err)
+	}
+}
+
+func attachmentKey(userID uint, name string) string {
+	return fmt.Sprintf("attachments/%d/%s", userID, name)
+}
+
+// quarantineKey 隔离区中的key，与正式位置分开，便于对存储单独设置访问策略
+func quarantineKey(userID uint, name string) string {
+	return fmt.Sprintf("quarantine/attachments/%d/%s", userID, name)
+}
+
+// cleanFilename 只保留文件名部分，去掉路径和控制字符
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[len(runes)-255:])
+	}
+	return name
+}
+
+// variantFilename 缩略图的文件名，如photo.jpg的thumb_256为photo_thumb_256.jpg
+func variantFilename(filename, name, contentType string) string {
+	ext := ".png"
+	if contentType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return strings.TrimSuffix(filename, path.Ext(filename)) + "_" + name + ext
+}
+
+// detectContentType 以内容判断类型，无法判断时使用客户端声明的类型
+func detectContentType(declared string, data []byte) string {
+	detected := http.DetectContentType(data)
+	if detected == "application/octet-stream" && declared != "" && len(declared) <= 100 {
+		return declared
+	}
+	return detected
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var ErrGenerationTraceNotFound = errors.New("generation trace not found")
+
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record 记录审计日志，写入失败只打印日志，不影响业务流程
+func (s *AuditService) Record(userID uint, action, ip, detail string) {
+	entry := model.AuditLog{
+		UserID: userID,
+		Action: action,
+		IP:     ip,
+		Detail: detail,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit log %s for user %d: %v", action, userID, err)
+	}
+}
+
+// RecordImpersonation 记录与代入会话相关的审计日志，记录属于被代入的用户并标明操作的管理员
+func (s *AuditService) RecordImpersonation(impersonation *model.Impersonation, action, ip, detail string) {
+	entry := model.AuditLog{
+		UserID:          impersonation.UserID,
+		Action:          action,
+		IP:              ip,
+		Detail:          detail,
+		ImpersonatorID:  &impersonation.AdminID,
+		ImpersonationID: &impersonation.ID,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit log %s for impersonation %d: %v", action, impersonation.ID, err)
+	}
+}
+
+// Subscribe 订阅账号安全相关事件并写入审计日志，action为事件类型
+func (s *AuditService) Subscribe(bus events.Bus) {
+	handler := func(ctx context.Context, event events.Event) error {
+		payload, _ := event.Payload.(events.AccountPayload)
+		s.Record(event.UserID, event.Type, payload.IP, payload.Detail)
+		return nil
+	}
+	bus.Subscribe(events.UserEmailChangeRequested, handler)
+	bus.Subscribe(events.UserEmailChanged, handler)
+	bus.Subscribe(events.UserEmailVerified, handler)
+	bus.Subscribe(events.UserPasswordReset, handler)
+	bus.Subscribe(events.UserPlanChanged, handler)
+	bus.Subscribe(events.MessageDeleted, handler)
+	bus.Subscribe(events.MessageRedacted, handler)
+	bus.Subscribe(events.AttachmentInfected, handler)
+}
+
+// ListPromptAudits 按时间倒序获取模型调用审计记录，userID/conversationID为0时不过滤
+func (s *AuditService) ListPromptAudits(userID, conversationID uint, page, pageSize int) ([]model.PromptAudit, int64, error) {
+	query := s.db.Model(&model.PromptAudit{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if conversationID != 0 {
+		query = query.Where("conversation_id = ?", conversationID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var audits []model.PromptAudit
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&audits).Error; err != nil {
+		return nil, 0, err
+	}
+	return audits, total, nil
+}
+
+// GetGenerationTrace 按追踪ID获取生成过程，追踪ID见日志的[trace ...]和提示词审计记录
+func (s *AuditService) GetGenerationTrace(traceID string) (*model.GenerationTrace, error) {
+	var trace model.GenerationTrace
+	err := s.db.Where("trace_id = ?", traceID).First(&trace).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGenerationTraceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &trace, nil
+}
+
+// SecurityIncidentFilter 安全事件的筛选条件，零值字段不过滤
+type SecurityIncidentFilter struct {
+	UserID   uint
+	Severity string
+	Source   string
+}
+
+// IncidentCount 按某个维度统计的安全事件数
+type IncidentCount struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// UserIncidentCount 用户的安全事件数
+type UserIncidentCount struct {
+	UserID uint  `json:"user_id"`
+	Count  int64 `json:"count"`
+}
+
+// SecurityIncidentSummary 一段时间内安全事件的汇总，供管理后台展示
+type SecurityIncidentSummary struct {
+	Since      time.Time           `json:"since"`
+	Total      int64               `json:"total"`
+	BySeverity []IncidentCount     `json:"by_severity"`
+	BySource   []IncidentCount     `json:"by_source"`
+	ByAction   []IncidentCount     `json:"by_action"`
+	TopUsers   []UserIncidentCount `json:"top_users"`
+}
+
+// securityIncidentTopUsers 汇总中列出的事件最多的用户数
+const securityIncidentTopUsers = 10
+
+// ListSecurityIncidents 按时间倒序获取疑似提示词注入/越狱的安全事件
+func (s *AuditService) ListSecurityIncidents(filter SecurityIncidentFilter, page, pageSize int) ([]model.SecurityIncident, int64, error) {
+	query := s.db.Model(&model.SecurityIncident{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var incidents []model.SecurityIncident
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&incidents).Error; err != nil {
+		return nil, 0, err
+	}
+	return incidents, total, nil
+}
+
+// SummarizeSecurityIncidents 统计since之后的安全事件：按严重程度、来源、处理方式计数，以及事件最多的用户
+func (s *AuditService) SummarizeSecurityIncidents(since time.Time) (*SecurityIncidentSummary, error) {
+	summary := &SecurityIncidentSummary{Since: since}
+	recent := func() *gorm.DB {
+		return s.db.Model(&model.SecurityIncident{}).Where("created_at >= ?", since)
+	}
+
+	if err := recent().Count(&summary.Total).Error; err != nil {
+		return nil, err
+	}
+	for column, counts := range map[string]*[]IncidentCount{
+		"severity": &summary.BySeverity,
+		"source":   &summary.BySource,
+		"action":   &summary.ByAction,
+	} {
+		*counts = []IncidentCount{}
+		err := recent().Select(column + " AS `key`, COUNT(*) AS count").Group(column).Order("count DESC").Scan(counts).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	summary.TopUsers = []UserIncidentCount{}
+	err := recent().Select("user_id, COUNT(*) AS count").Group("user_id").
+		Order("count DESC").Limit(securityIncidentTopUsers).Scan(&summary.TopUsers).Error
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
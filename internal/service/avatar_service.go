@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/storage"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// avatarPrompt 包装用户的描述，引导模型生成适合作为头像的图片
+const avatarPrompt = "A square profile picture avatar with a single centered subject and a simple background, no text or watermarks. Description: %s"
+
+var (
+	ErrAvatarUnavailable   = errors.New("avatar generation is not configured")
+	ErrAvatarQuotaExceeded = errors.New("daily avatar generation limit reached")
+	ErrAvatarNotFound      = errors.New("avatar not found")
+)
+
+// avatarTypes 允许保存的图片类型及扩展名
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+}
+
+// AvatarService 由图像模型按描述生成头像，图片保存在对象存储中
+type AvatarService struct {
+	db          *gorm.DB
+	aiService   *AIService
+	userService *UserService
+	store       storage.Store
+	storageCfg  config.StorageConfig
+	cfg         config.AvatarConfig
+}
+
+// NewAvatarService store为nil或未配置图像模型时不开放头像生成
+func NewAvatarService(db *gorm.DB, aiService *AIService, userService *UserService, store storage.Store, storageCfg config.StorageConfig, cfg config.AvatarConfig) *AvatarService {
+	return &AvatarService{
+		db:          db,
+		aiService:   aiService,
+		userService: userService,
+		store:       store,
+		storageCfg:  storageCfg,
+		cfg:         cfg,
+	}
+}
+
+type GenerateAvatarRequest struct {
+	Prompt string `json:"prompt" validate:"required,max=1000"`
+}
+
+// AvatarResult 生成结果，Remaining为当天剩余的生成次数
+type AvatarResult struct {
+	Avatar    string `json:"avatar"`
+	Remaining int    `json:"remaining"`
+}
+
+// Generate 按描述生成头像并设为用户头像，生成失败不计入当天次数
+func (s *AvatarService) Generate(ctx context.Context, userID uint, req *GenerateAvatarRequest) (*AvatarResult, error) {
+	if s.store == nil || s.cfg.ImageModel == "" {
+		return nil, ErrAvatarUnavailable
+	}
+
+	generation, used, err := s.reserve(userID, req.Prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.generate(ctx, userID, generation)
+	if err != nil {
+		if delErr := s.db.Delete(generation).Error; delErr != nil {
+			log.Printf("Failed to release avatar generation %d: %v", generation.ID, delErr)
+		}
+		return nil, err
+	}
+
+	return &AvatarResult{Avatar: url, Remaining: s.cfg.DailyLimit - used}, nil
+}
+
+// reserve 检查并占用当天的一次生成次数，锁定用户行使并发请求依次计数。返回占用后当天已用的次数
+func (s *AvatarService) reserve(userID uint, prompt string) (*model.AvatarGeneration, int, error) {
+	generation := &model.AvatarGeneration{UserID: userID, Prompt: prompt}
+	var used int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+
+		// 按UTC的当天计数，与套餐的每日额度一致，切换时区不能重置次数
+		now := time.Now().UTC()
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		if err := tx.Model(&model.AvatarGeneration{}).
+			Where("user_id = ? AND created_at >= ?", userID, dayStart).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(s.cfg.DailyLimit) {
+			return ErrAvatarQuotaExceeded
+		}
+		used++
+		return tx.Create(generation).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return generation, int(used), nil
+}
+
+// generate 调用用户所在区域的图像模型，保存图片并更新用户头像，返回头像地址
+func (s *AvatarService) generate(ctx context.Context, userID uint, generation *model.AvatarGeneration) (string, error) {
+	region, err := userRegion(s.db, userID)
+	if err != nil {
+		return "", err
+	}
+	ai, err := s.aiService.ForRegion(region)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ai.GenerateImage(ctx, s.cfg.ImageModel, fmt.Sprintf(avatarPrompt, generation.Prompt), s.cfg.ImageSize)
+	if err != nil {
+		return "", err
+	}
+	ext, ok := avatarTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", errors.New("image model returned an unsupported image type")
+	}
+
+	token, err := utils.GenerateToken(16)
+	if err != nil {
+		return "", err
+	}
+	name := token + ext
+	key := avatarKey(userID, name)
+	if err := s.store.Put(ctx, key, data); err != nil {
+		return "", err
+	}
+	if err := s.db.Model(generation).Update("object_key", key).Error; err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/%d/%s", strings.TrimRight(s.cfg.URLPrefix, "/"), userID, name)
+	if err := s.userService.UpdateProfile(userID, &UpdateProfileRequest{Avatar: url}); err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+// Get 读取生成的头像，返回图片数据和类型
+func (s *AvatarService) Get(ctx context.Context, userID uint, name string) ([]byte, string, error) {
+	if s.store == nil {
+		return nil, "", ErrAvatarNotFound
+	}
+	// 文件名只由随机串和扩展名组成
+	if strings.ContainsAny(name, "/\\") || strings.Contains(name, "..") {
+		return nil, "", ErrAvatarNotFound
+	}
+	data, err := s.store.Get(ctx, avatarKey(userID, name))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, "", ErrAvatarNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, http.DetectContentType(data), nil
+}
+
+// DownloadURL 存储支持时生成头像的限时下载地址，返回空字符串表示需由Get读取后返回
+func (s *AvatarService) DownloadURL(userID uint, name string) (string, error) {
+	if s.store == nil || strings.ContainsAny(name, "/\\") || strings.Contains(name, "..") {
+		return "", ErrAvatarNotFound
+	}
+	key := avatarKey(userID, name)
+	if _, ok := s.store.(storage.Signer); !ok || s.storageCfg.SignedURLTTL <= 0 {
+		return "", nil
+	}
+	// 只为生成成功的头像签发地址
+	var count int64
+	if err := s.db.Model(&model.AvatarGeneration{}).Where("user_id = ? AND object_key = ?", userID, key).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", ErrAvatarNotFound
+	}
+	return storage.SignedDownload(s.store, s.storageCfg, key, storage.DownloadOptions{Filename: name})
+}
+
+// avatarKey 头像在对象存储中的key
+func avatarKey(userID uint, name string) string {
+	return fmt.Sprintf("avatars/%d/%s", userID, name)
+}
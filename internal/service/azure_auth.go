@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// azureADScope Azure OpenAI（Cognitive Services）的访问令牌范围
+	azureADScope = "https://cognitiveservices.azure.com/.default"
+	// azureADRefreshBefore 令牌到期前提前刷新的时间
+	azureADRefreshBefore = 5 * time.Minute
+)
+
+// azureADTokenSource 通过客户端凭据（服务主体）获取Azure AD访问令牌，并缓存到接近过期
+type azureADTokenSource struct {
+	tenantID     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newAzureADTokenSource(tenantID, clientID, clientSecret string, timeout time.Duration) *azureADTokenSource {
+	return &azureADTokenSource{
+		tenantID:     tenantID,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: timeout},
+	}
+}
+
+// Token 返回有效的访问令牌，必要时重新获取
+func (s *azureADTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expiresAt) > azureADRefreshBefore {
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+		"scope":         {azureADScope},
+	}
+	endpoint := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(s.tenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request azure ad token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode azure ad token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("azure ad token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+
+	s.token = body.AccessToken
+	s.expiresAt = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// azureADTransport 用Azure AD令牌替换请求中的api-key认证头
+type azureADTransport struct {
+	base   http.RoundTripper
+	source *azureADTokenSource
+}
+
+func (t *azureADTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del("api-key")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
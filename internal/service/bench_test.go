@@ -0,0 +1,76 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+)
+
+func BenchmarkToSchemaMessages(b *testing.B) {
+	history := make([]model.Message, 20)
+	for i := range history {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history[i] = model.Message{Role: role, Content: strings.Repeat("消息内容 content ", 40)}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		toSchemaMessages(history)
+	}
+}
+
+// newRepoBench 在临时用户下准备50个会话，最后一个会话有500条消息
+func newRepoBench(b *testing.B) (*ChatService, *model.User, uint) {
+	db := newTestDB(b)
+	user := createTestUser(b, db, model.User{})
+
+	var conversationID uint
+	for i := 0; i < 50; i++ {
+		conversation := model.Conversation{UserID: user.ID, Title: fmt.Sprintf("bench %d", i)}
+		if err := db.Create(&conversation).Error; err != nil {
+			b.Fatal(err)
+		}
+		conversationID = conversation.ID
+	}
+	messages := make([]model.Message, 500)
+	for i := range messages {
+		messages[i] = model.Message{ConversationID: conversationID, Role: "user", Content: strings.Repeat("x", 200)}
+	}
+	if err := db.CreateInBatches(messages, 100).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	chat := NewChatService(db, nil, nil, NewPlanService(db), NewCreditService(db), nil, nil, nil, nil, events.NewMemoryBus())
+	return chat, user, conversationID
+}
+
+func BenchmarkGetMessages(b *testing.B) {
+	chat, user, conversationID := newRepoBench(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := chat.GetMessages(user.ID, conversationID, MessageListOptions{}, 1, 50); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetConversations(b *testing.B) {
+	chat, user, _ := newRepoBench(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := chat.GetConversations(user.ID, ConversationListOptions{}, 1, 20); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
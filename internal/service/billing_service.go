@@ -0,0 +1,438 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/billing"
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// invoiceListLimit 发票列表返回的最大条数
+	invoiceListLimit = 24
+	// creditsPrice 额度包在价格配置中的键
+	creditsPrice = "credits"
+)
+
+var (
+	ErrBillingDisabled = errors.New("billing is not enabled")
+	ErrPlanNotForSale  = errors.New("plan is not available for purchase")
+)
+
+type CheckoutRequest struct {
+	Plan string `json:"plan" validate:"required"`
+}
+
+type CreditCheckoutRequest struct {
+	Packs int `json:"packs" validate:"required,min=1,max=100"`
+}
+
+type BillingService struct {
+	db            *gorm.DB
+	client        *billing.Client
+	creditService *CreditService
+	cfg           config.BillingConfig
+	packSize      int64
+	appURL        string
+	bus           events.Bus
+
+	// webhookSecret 可随密钥轮换替换，因此不直接读 cfg
+	mu            sync.RWMutex
+	webhookSecret string
+}
+
+// NewBillingService 创建计费服务，未配置Stripe密钥时所有计费接口返回ErrBillingDisabled
+func NewBillingService(db *gorm.DB, creditService *CreditService, bus events.Bus) *BillingService {
+	cfg := config.Load()
+	s := &BillingService{
+		db:            db,
+		creditService: creditService,
+		cfg:           cfg.Billing,
+		packSize:      cfg.Credits.PackSize,
+		appURL:        cfg.App.FrontendURL,
+		bus:           bus,
+		webhookSecret: cfg.Billing.StripeWebhookSecret,
+	}
+	if cfg.Billing.StripeSecretKey != "" {
+		s.client = billing.NewClient(cfg.Billing.StripeSecretKey)
+	}
+	return s
+}
+
+// SetStripeSecretKey 密钥轮换后替换Stripe API密钥。启动时未配置密钥的计费保持关闭，需重启才能启用
+func (s *BillingService) SetStripeSecretKey(secretKey string) {
+	if s.client == nil || secretKey == "" {
+		return
+	}
+	s.client.SetSecretKey(secretKey)
+}
+
+// SetWebhookSecret 密钥轮换后替换webhook签名密钥
+func (s *BillingService) SetWebhookSecret(secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookSecret = secret
+}
+
+func (s *BillingService) currentWebhookSecret() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.webhookSecret
+}
+
+// CreateCheckout 为用户创建订阅结账会话，返回Stripe结账页地址
+func (s *BillingService) CreateCheckout(ctx context.Context, userID uint, req *CheckoutRequest) (string, error) {
+	if s.client == nil {
+		return "", ErrBillingDisabled
+	}
+
+	priceID := s.cfg.PriceIDs[req.Plan]
+	if priceID == "" || req.Plan == creditsPrice {
+		return "", ErrPlanNotForSale
+	}
+
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return "", err
+	}
+
+	var sub model.Subscription
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(&sub).Error; err != nil {
+		return "", err
+	}
+
+	session, err := s.client.CreateCheckoutSession(ctx, &billing.CheckoutParams{
+		Mode:          "subscription",
+		PriceID:       priceID,
+		CustomerID:    sub.StripeCustomerID,
+		CustomerEmail: user.Email,
+		ReferenceID:   strconv.FormatUint(uint64(userID), 10),
+		Metadata:      map[string]string{"plan": req.Plan},
+		SuccessURL:    s.appURL + "/billing/success",
+		CancelURL:     s.appURL + "/billing/cancel",
+	})
+	if err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// CreateCreditCheckout 创建额度包的一次性购买结账会话
+func (s *BillingService) CreateCreditCheckout(ctx context.Context, userID uint, req *CreditCheckoutRequest) (string, error) {
+	if s.client == nil {
+		return "", ErrBillingDisabled
+	}
+
+	priceID := s.cfg.PriceIDs[creditsPrice]
+	if priceID == "" {
+		return "", ErrPlanNotForSale
+	}
+
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return "", err
+	}
+
+	var sub model.Subscription
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(&sub).Error; err != nil {
+		return "", err
+	}
+
+	credits := int64(req.Packs) * s.packSize
+	session, err := s.client.CreateCheckoutSession(ctx, &billing.CheckoutParams{
+		Mode:          "payment",
+		PriceID:       priceID,
+		Quantity:      req.Packs,
+		CustomerID:    sub.StripeCustomerID,
+		CustomerEmail: user.Email,
+		ReferenceID:   strconv.FormatUint(uint64(userID), 10),
+		Metadata:      map[string]string{"credits": strconv.FormatInt(credits, 10)},
+		SuccessURL:    s.appURL + "/billing/success",
+		CancelURL:     s.appURL + "/billing/cancel",
+	})
+	if err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// GetInvoices 获取用户的Stripe发票
+func (s *BillingService) GetInvoices(ctx context.Context, userID uint) ([]billing.Invoice, error) {
+	if s.client == nil {
+		return nil, ErrBillingDisabled
+	}
+
+	var sub model.Subscription
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(&sub).Error; err != nil {
+		return nil, err
+	}
+	if sub.StripeCustomerID == "" {
+		return []billing.Invoice{}, nil
+	}
+
+	return s.client.ListInvoices(ctx, sub.StripeCustomerID, invoiceListLimit)
+}
+
+// HandleWebhook 校验并处理Stripe webhook事件，同步订阅状态和用户套餐
+func (s *BillingService) HandleWebhook(payload []byte, signature string) error {
+	secret := s.currentWebhookSecret()
+	if s.client == nil || secret == "" {
+		return ErrBillingDisabled
+	}
+
+	event, err := billing.ParseWebhook(payload, signature, secret)
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case "checkout.session.completed":
+		var session billing.CheckoutSession
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return err
+		}
+		return s.handleCheckoutCompleted(&session)
+	case "customer.subscription.updated", "customer.subscription.deleted":
+		var subscription billing.Subscription
+		if err := json.Unmarshal(event.Data.Object, &subscription); err != nil {
+			return err
+		}
+		return s.handleSubscriptionChanged(&subscription)
+	case "invoice.payment_failed":
+		var invoice billing.Invoice
+		if err := json.Unmarshal(event.Data.Object, &invoice); err != nil {
+			return err
+		}
+		return s.handlePaymentFailed(&invoice)
+	case "invoice.paid":
+		var invoice billing.Invoice
+		if err := json.Unmarshal(event.Data.Object, &invoice); err != nil {
+			return err
+		}
+		return s.handleInvoicePaid(&invoice)
+	}
+	return nil
+}
+
+func (s *BillingService) handleCheckoutCompleted(session *billing.CheckoutSession) error {
+	userID, err := strconv.ParseUint(session.ClientReferenceID, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid client reference id %q", session.ClientReferenceID)
+	}
+	// 额度包购买，以会话ID去重
+	if credits := session.Metadata["credits"]; credits != "" {
+		amount, err := strconv.ParseInt(credits, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid credits metadata %q", credits)
+		}
+		_, err = s.creditService.Credit(uint(userID), amount, model.CreditPurchase, session.ID)
+		return err
+	}
+
+	plan := session.Metadata["plan"]
+	if plan == "" {
+		return errors.New("checkout session has no plan")
+	}
+
+	sub := model.Subscription{UserID: uint(userID)}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).FirstOrInit(&sub).Error; err != nil {
+			return err
+		}
+		sub.Plan = plan
+		sub.Status = model.SubscriptionActive
+		sub.StripeCustomerID = session.Customer
+		sub.StripeSubscriptionID = session.Subscription
+		sub.GraceUntil = nil
+		if err := tx.Save(&sub).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"plan":            plan,
+			"plan_expires_at": nil,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.publishPlanChanged(sub.UserID, plan, "checkout completed")
+	return nil
+}
+
+func (s *BillingService) handleSubscriptionChanged(stripeSub *billing.Subscription) error {
+	var sub model.Subscription
+	if err := s.db.Where("stripe_subscription_id = ?", stripeSub.ID).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 结账完成事件可能晚于订阅事件到达，由结账事件建立关联
+			return nil
+		}
+		return err
+	}
+
+	plan := sub.Plan
+	if p := s.planForPrice(stripeSub.PriceID()); p != "" {
+		plan = p
+	}
+
+	updates := map[string]interface{}{
+		"status": stripeSub.Status,
+		"plan":   plan,
+	}
+	if stripeSub.CurrentPeriodEnd > 0 {
+		updates["current_period_end"] = time.Unix(stripeSub.CurrentPeriodEnd, 0)
+	}
+
+	userPlan := plan
+	switch stripeSub.Status {
+	case model.SubscriptionCanceled, "unpaid", "incomplete_expired":
+		userPlan = model.PlanFree
+		updates["grace_until"] = nil
+	case model.SubscriptionPastDue:
+		// 宽限期内保留当前套餐，由扣款失败事件设置宽限期
+		userPlan = ""
+	default:
+		updates["grace_until"] = nil
+	}
+
+	return s.applyPlan(&sub, updates, userPlan, "subscription "+stripeSub.Status)
+}
+
+func (s *BillingService) handlePaymentFailed(invoice *billing.Invoice) error {
+	var sub model.Subscription
+	if err := s.db.Where("stripe_subscription_id = ?", invoice.Subscription).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	updates := map[string]interface{}{"status": model.SubscriptionPastDue}
+	// 重复的扣款失败不延长宽限期
+	if sub.GraceUntil == nil {
+		updates["grace_until"] = time.Now().Add(s.cfg.GracePeriod)
+	}
+	return s.db.Model(&sub).Updates(updates).Error
+}
+
+func (s *BillingService) handleInvoicePaid(invoice *billing.Invoice) error {
+	var sub model.Subscription
+	if err := s.db.Where("stripe_subscription_id = ?", invoice.Subscription).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"status":      model.SubscriptionActive,
+		"grace_until": nil,
+	}
+	return s.applyPlan(&sub, updates, sub.Plan, "invoice paid")
+}
+
+// applyPlan 更新订阅记录并同步用户套餐，userPlan为空时不修改用户套餐
+func (s *BillingService) applyPlan(sub *model.Subscription, updates map[string]interface{}, userPlan, reason string) error {
+	var user model.User
+	if err := s.db.Select("plan").Where("id = ?", sub.UserID).First(&user).Error; err != nil {
+		return err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(sub).Updates(updates).Error; err != nil {
+			return err
+		}
+		if userPlan == "" || userPlan == user.Plan {
+			return nil
+		}
+		return tx.Model(&model.User{}).Where("id = ?", sub.UserID).Updates(map[string]interface{}{
+			"plan":            userPlan,
+			"plan_expires_at": nil,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if userPlan != "" && userPlan != user.Plan {
+		s.publishPlanChanged(sub.UserID, userPlan, reason)
+	}
+	return nil
+}
+
+// ExpireGracePeriods 将宽限期已过仍未付款的订阅降级为免费套餐，返回降级数量
+func (s *BillingService) ExpireGracePeriods() (int, error) {
+	var subs []model.Subscription
+	if err := s.db.Where("grace_until IS NOT NULL AND grace_until < ?", time.Now()).Find(&subs).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range subs {
+		updates := map[string]interface{}{
+			"status":      "unpaid",
+			"grace_until": nil,
+		}
+		if err := s.applyPlan(&subs[i], updates, model.PlanFree, "grace period expired"); err != nil {
+			return i, err
+		}
+	}
+	return len(subs), nil
+}
+
+// Start 按间隔检查过期的宽限期，paused返回true时跳过本轮，返回停止函数
+func (s *BillingService) Start(interval time.Duration, paused func() bool) func() {
+	if s.client == nil || interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				expired, err := s.ExpireGracePeriods()
+				if err != nil {
+					log.Printf("Failed to expire billing grace periods: %v", err)
+				}
+				if expired > 0 {
+					log.Printf("Downgraded %d subscriptions after grace period", expired)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (s *BillingService) planForPrice(priceID string) string {
+	for plan, id := range s.cfg.PriceIDs {
+		if id != "" && id == priceID {
+			return plan
+		}
+	}
+	return ""
+}
+
+func (s *BillingService) publishPlanChanged(userID uint, plan, reason string) {
+	s.bus.Publish(context.Background(), events.New(events.UserPlanChanged, userID, events.AccountPayload{
+		Detail: fmt.Sprintf("plan=%s reason=%s", plan, reason),
+	}))
+}
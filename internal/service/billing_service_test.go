@@ -0,0 +1,37 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"ai-chat-backend/internal/billing"
+	"ai-chat-backend/internal/config"
+)
+
+func TestHandleWebhookRequiresSecret(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"client_reference_id":"1"}}}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		want      error
+	}{
+		{name: "no webhook secret", secret: "", signature: "", want: ErrBillingDisabled},
+		{name: "unsigned", secret: "whsec_test", signature: "", want: billing.ErrInvalidSignature},
+		{name: "wrong signature", secret: "whsec_test", signature: "t=1,v1=deadbeef", want: billing.ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &BillingService{
+				client: billing.NewClient("sk_test"),
+				cfg:    config.BillingConfig{StripeSecretKey: "sk_test"},
+			}
+			// 经由轮换入口设置，验证webhook使用轮换后的密钥
+			s.SetWebhookSecret(tt.secret)
+			if err := s.HandleWebhook(payload, tt.signature); !errors.Is(err, tt.want) {
+				t.Fatalf("HandleWebhook() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
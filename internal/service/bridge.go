@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// bridgeUpdateInterval 向外部平台更新流式回复的最小间隔，避免触发平台限流
+const bridgeUpdateInterval = time.Second
+
+// bridgePlaceholder 回复生成前先发送的占位消息
+const bridgePlaceholder = "…"
+
+// bridgeReply 将流式回复节流后写入外部平台的一条可编辑消息。
+// 中途更新失败只记录日志，不中断生成，最终内容在Flush时再次写入
+type bridgeReply struct {
+	update    func(text string) error
+	maxLength int
+
+	buf  strings.Builder
+	sent string
+	last time.Time
+}
+
+func newBridgeReply(maxLength int, update func(text string) error) *bridgeReply {
+	return &bridgeReply{
+		update:    update,
+		maxLength: maxLength,
+		last:      time.Now(),
+	}
+}
+
+// Write 追加一个增量片段，距上次更新超过间隔时更新消息
+func (r *bridgeReply) Write(chunk string) error {
+	r.buf.WriteString(chunk)
+	if time.Since(r.last) < bridgeUpdateInterval {
+		return nil
+	}
+	if err := r.flush(); err != nil {
+		log.Printf("Failed to update bridged reply: %v", err)
+	}
+	return nil
+}
+
+// Flush 写入完整内容，生成结束时调用
+func (r *bridgeReply) Flush() error {
+	return r.flush()
+}
+
+func (r *bridgeReply) flush() error {
+	text := r.text()
+	if text == "" || text == r.sent {
+		return nil
+	}
+	r.last = time.Now()
+	if err := r.update(text); err != nil {
+		return err
+	}
+	r.sent = text
+	return nil
+}
+
+// text 超过平台单条消息长度时截断
+func (r *bridgeReply) text() string {
+	text := r.buf.String()
+	if utf8.RuneCountInString(text) <= r.maxLength {
+		return text
+	}
+	return string([]rune(text)[:r.maxLength-1]) + "…"
+}
+
+// keyedMutex 按键串行处理，同一频道的消息依次生成回复，保证会话顺序
+type keyedMutex struct {
+	locks sync.Map
+}
+
+func (m *keyedMutex) Lock(key string) func() {
+	value, _ := m.locks.LoadOrStore(key, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// BridgeMessage 以频道关联用户的身份发送外部平台的消息并流式生成回复，
+// 频道尚无会话或会话已删除时以title新建会话
+func (s *ChatService) BridgeMessage(ctx context.Context, link *model.ChannelLink, title, content string, callback func(string) error) error {
+	if link.ConversationID != nil {
+		_, err := s.GetConversation(link.UserID, *link.ConversationID)
+		if err == nil {
+			_, _, err = s.StreamChat(ctx, link.UserID, *link.ConversationID, &SendMessageRequest{Content: content}, callback, nil)
+			return err
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	conversation, err := s.CreateConversation(link.UserID, &CreateConversationRequest{Title: title})
+	if err != nil {
+		return err
+	}
+	if err := s.db.Model(link).Update("conversation_id", conversation.ID).Error; err != nil {
+		return err
+	}
+	_, _, err = s.StreamChat(ctx, link.UserID, conversation.ID, &SendMessageRequest{Content: content}, callback, nil)
+	return err
+}
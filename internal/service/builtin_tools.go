@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 内置工具名
+const (
+	toolCalculator  = "calculator"
+	toolCurrentTime = "current_time"
+	toolWebSearch   = "web_search"
+)
+
+const (
+	// maxExpressionLength 计算器表达式的最大长度
+	maxExpressionLength = 500
+	// maxSearchResponseSize 搜索接口响应的大小上限
+	maxSearchResponseSize = 1 << 20
+)
+
+var (
+	calculatorSchema  = json.RawMessage(`{"type":"object","properties":{"expression":{"type":"string","description":"Arithmetic expression, e.g. (3 + 4.5) * 2^10 / sqrt(16). Supports + - * / % ^, parentheses, pi, e and the functions sqrt, abs, ln, log, exp, sin, cos, tan, floor, ceil, round"}},"required":["expression"]}`)
+	currentTimeSchema = json.RawMessage(`{"type":"object","properties":{"timezone":{"type":"string","description":"IANA time zone such as Asia/Shanghai; defaults to the user's time zone"}}}`)
+	webSearchSchema   = json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"Search query"}},"required":["query"]}`)
+)
+
+// BuiltinToolService 服务端内置的通用工具（计算器、当前时间、网页搜索），注册为ToolService的内置工具提供者，
+// 非无痕会话均可使用
+type BuiltinToolService struct {
+	db         *gorm.DB
+	cfg        config.ToolsConfig
+	enabled    map[string]bool
+	httpClient *http.Client
+}
+
+func NewBuiltinToolService(db *gorm.DB, cfg config.ToolsConfig) *BuiltinToolService {
+	enabled := make(map[string]bool)
+	for _, name := range strings.Split(cfg.Builtin, ",") {
+		enabled[strings.TrimSpace(name)] = true
+	}
+	// 未配置搜索接口时不提供网页搜索
+	if cfg.SearchURL == "" {
+		delete(enabled, toolWebSearch)
+	}
+	return &BuiltinToolService{
+		db:         db,
+		cfg:        cfg,
+		enabled:    enabled,
+		httpClient: &http.Client{Timeout: mcpRequestTimeout},
+	}
+}
+
+// localTools 按配置提供内置工具
+func (s *BuiltinToolService) localTools(ctx context.Context, userID, conversationID uint) []localTool {
+	var tools []localTool
+	if s.enabled[toolCalculator] {
+		tools = append(tools, localTool{
+			name:        toolCalculator,
+			description: "Evaluate an arithmetic expression exactly. Use this instead of calculating in your head.",
+			params:      calculatorSchema,
+			run: func(ctx context.Context, arguments string) (string, error) {
+				return calculate(arguments)
+			},
+		})
+	}
+	if s.enabled[toolCurrentTime] {
+		tools = append(tools, localTool{
+			name:        toolCurrentTime,
+			description: "Get the current date, time and weekday, in the user's time zone unless another is given.",
+			params:      currentTimeSchema,
+			run: func(ctx context.Context, arguments string) (string, error) {
+				return s.currentTime(userID, arguments)
+			},
+		})
+	}
+	if s.enabled[toolWebSearch] {
+		tools = append(tools, localTool{
+			name:        toolWebSearch,
+			description: "Search the web for recent or factual information. Returns titles, URLs and snippets; cite the URLs you use.",
+			params:      webSearchSchema,
+			run:         s.webSearch,
+		})
+	}
+	return tools
+}
+
+func calculate(arguments string) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || strings.TrimSpace(args.Expression) == "" {
+		return "", fmt.Errorf("invalid arguments: expression is required")
+	}
+	if len(args.Expression) > maxExpressionLength {
+		return "", fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	value, err := evaluateExpression(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+// currentTime 未指定时区时使用用户设置的时区
+func (s *BuiltinToolService) currentTime(userID uint, arguments string) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+
+	var loc *time.Location
+	if args.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(args.Timezone); err != nil {
+			return "", fmt.Errorf("unknown time zone %q", args.Timezone)
+		}
+	} else {
+		var user model.User
+		if err := s.db.Select("id", "timezone").Where("id = ?", userID).First(&user).Error; err != nil {
+			return "", err
+		}
+		loc = user.Location()
+	}
+	now := time.Now().In(loc)
+	return fmt.Sprintf("%s %s (%s, UTC%s)", now.Format("2006-01-02 15:04:05"), now.Weekday(), loc, now.Format("-07:00")), nil
+}
+
+// webSearch 调用SearXNG兼容的搜索接口（q、format=json参数，返回results数组）
+func (s *BuiltinToolService) webSearch(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("invalid arguments: query is required")
+	}
+
+	endpoint, err := url.Parse(s.cfg.SearchURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid search url: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("q", args.Query)
+	query.Set("format", "json")
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.cfg.SearchAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.SearchAPIKey)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("search request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("search returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSearchResponseSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid search response: %w", err)
+	}
+	if len(body.Results) == 0 {
+		return "No results found.", nil
+	}
+
+	var b strings.Builder
+	for i, result := range body.Results {
+		if i == s.cfg.SearchResults {
+			break
+		}
+		fmt.Fprintf(&b, "%d. %s\n%s\n%s\n\n", i+1, result.Title, result.URL, strings.TrimSpace(result.Content))
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// expressionFuncs 计算器支持的函数，log为常用对数，ln为自然对数
+var expressionFuncs = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"exp":   math.Exp,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+var expressionConsts = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// exprParser 计算器表达式的递归下降解析器，^为右结合的乘方，优先级高于一元负号（-2^2 = -4）
+type exprParser struct {
+	input string
+	pos   int
+}
+
+func evaluateExpression(expression string) (float64, error) {
+	p := &exprParser{input: expression}
+	value, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != 0 {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("result is not a finite number")
+	}
+	return value, nil
+}
+
+// peek 跳过空白后返回下一个字符，已到末尾时返回0
+func (p *exprParser) peek() byte {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *exprParser) parseSum() (float64, error) {
+	value, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return value, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			value += right
+		} else {
+			value -= right
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (float64, error) {
+	value, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return value, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case op == '*':
+			value *= right
+		case right == 0:
+			return 0, errors.New("division by zero")
+		case op == '/':
+			value /= right
+		default:
+			value = math.Mod(value, right)
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		value, err := p.parseUnary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return 0, errors.New("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		value, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing ) at position %d", p.pos+1)
+		}
+		p.pos++
+		return value, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return p.parseIdentifier()
+	}
+	return 0, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func (p *exprParser) parseNumber() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	// 科学计数法，如1.5e3
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		next := p.pos + 1
+		if next < len(p.input) && (p.input[next] == '+' || p.input[next] == '-') {
+			next++
+		}
+		if next < len(p.input) && p.input[next] >= '0' && p.input[next] <= '9' {
+			p.pos = next
+			for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+				p.pos++
+			}
+		}
+	}
+	value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+	}
+	return value, nil
+}
+
+func (p *exprParser) parseIdentifier() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= 'a' && p.input[p.pos] <= 'z' || p.input[p.pos] >= 'A' && p.input[p.pos] <= 'Z') {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+	if value, ok := expressionConsts[name]; ok {
+		return value, nil
+	}
+	fn, ok := expressionFuncs[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown function or constant %q", name)
+	}
+	if p.peek() != '(' {
+		return 0, fmt.Errorf("missing ( after %s", name)
+	}
+	argument, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	return fn(argument), nil
+}
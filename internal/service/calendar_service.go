@@ -0,0 +1,423 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/gcal"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// calendarToolPrefix 日历工具名前缀，与MCP工具的命名方式相同
+	calendarToolPrefix = "calendar" + toolNameSeparator
+	// calendarDefaultRange 未指定结束时间时列出的时间范围
+	calendarDefaultRange = 7 * 24 * time.Hour
+	// calendarMaxEvents 单次最多列出的日程数
+	calendarMaxEvents = 50
+	// calendarTimeLayout 返回给模型的时间格式，带星期和时区偏移
+	calendarTimeLayout = "Mon 2006-01-02 15:04 -07:00"
+)
+
+// 授权时可选的日历权限
+const (
+	CalendarAccessRead      = "read"
+	CalendarAccessReadWrite = "read_write"
+)
+
+var ErrCalendarAccessNotGranted = errors.New("calendar access was not granted")
+
+var (
+	listEventsSchema = json.RawMessage(`{"type":"object","properties":{` +
+		`"time_min":{"type":"string","description":"Start of the range, RFC 3339 with offset. Defaults to now."},` +
+		`"time_max":{"type":"string","description":"End of the range, RFC 3339 with offset. Defaults to 7 days after time_min."},` +
+		`"max_results":{"type":"integer","description":"Maximum number of events to return, up to 50. Defaults to 20."}}}`)
+	createEventSchema = json.RawMessage(`{"type":"object","properties":{` +
+		`"summary":{"type":"string","description":"Event title"},` +
+		`"start":{"type":"string","description":"Start time, RFC 3339 with offset"},` +
+		`"end":{"type":"string","description":"End time, RFC 3339 with offset"},` +
+		`"description":{"type":"string"},` +
+		`"location":{"type":"string"}},` +
+		`"required":["summary","start","end"]}`)
+)
+
+// CalendarService 管理用户的Google日历授权，并为助手提供读取和创建日程的工具。
+// 只读授权时只提供读取工具，每次创建日程都写入修改记录
+type CalendarService struct {
+	db          *gorm.DB
+	box         *utils.SecretBox
+	client      *gcal.Client
+	callbackURL string
+}
+
+// NewCalendarService 未配置加密密钥或Google OAuth客户端时不开放日历工具
+func NewCalendarService(db *gorm.DB, cfg *config.Config) (*CalendarService, error) {
+	s := &CalendarService{
+		db:          db,
+		callbackURL: cfg.Calendar.CallbackURL,
+	}
+	if cfg.App.EncryptionKey == "" || cfg.Export.GoogleClientID == "" {
+		return s, nil
+	}
+	box, err := utils.NewSecretBox(cfg.App.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	s.box = box
+	s.client = gcal.NewClient(cfg.Export.GoogleClientID, cfg.Export.GoogleClientSecret)
+	return s, nil
+}
+
+type AuthorizeCalendarRequest struct {
+	Access string `json:"access" validate:"required,oneof=read read_write"`
+}
+
+// CalendarStatus 用户的日历授权状态
+type CalendarStatus struct {
+	Connected   bool       `json:"connected"`
+	CanWrite    bool       `json:"can_write"`
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+}
+
+// Status 获取用户的日历授权状态
+func (s *CalendarService) Status(userID uint) (*CalendarStatus, error) {
+	if s.client == nil {
+		return nil, ErrIntegrationDisabled
+	}
+	integration, err := s.integration(userID)
+	if errors.Is(err, ErrIntegrationNotConnected) {
+		return &CalendarStatus{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CalendarStatus{
+		Connected:   true,
+		CanWrite:    hasScope(integration.Scopes, gcal.ScopeEvents),
+		ConnectedAt: &integration.UpdatedAt,
+	}, nil
+}
+
+// AuthorizeURL 生成Google的授权地址，按用户选择只申请只读或读写日程的权限
+func (s *CalendarService) AuthorizeURL(userID uint, req *AuthorizeCalendarRequest) (string, error) {
+	if s.client == nil {
+		return "", ErrIntegrationDisabled
+	}
+	scope := gcal.ScopeReadOnly
+	if req.Access == CalendarAccessReadWrite {
+		scope = gcal.ScopeEvents
+	}
+	state, err := newOAuthState(s.db, "calendar", userID)
+	if err != nil {
+		return "", err
+	}
+	return s.client.AuthURL(s.callbackURL, state, scope), nil
+}
+
+// Connect 完成授权：校验state由该用户发起，按用户实际授予的权限保存授权，重复授权时覆盖（可借此升级或降级权限）
+func (s *CalendarService) Connect(ctx context.Context, userID uint, req *ConnectIntegrationRequest) error {
+	if s.client == nil {
+		return ErrIntegrationDisabled
+	}
+	if err := consumeOAuthState(s.db, "calendar", req.State, userID); err != nil {
+		return err
+	}
+
+	token, err := s.client.ExchangeCode(ctx, req.Code, s.callbackURL)
+	if err != nil {
+		return err
+	}
+	// 用户可以在授权页取消勾选部分权限
+	if !hasScope(token.Scope, gcal.ScopeReadOnly) && !hasScope(token.Scope, gcal.ScopeEvents) {
+		return ErrCalendarAccessNotGranted
+	}
+
+	integration := model.UserIntegration{
+		UserID:    userID,
+		Provider:  model.IntegrationGoogleCalendar,
+		Scopes:    token.Scope,
+		ExpiresAt: &token.ExpiresAt,
+	}
+	if integration.EncryptedAccessToken, err = s.box.Encrypt(token.AccessToken); err != nil {
+		return err
+	}
+	if token.RefreshToken != "" {
+		if integration.EncryptedRefreshToken, err = s.box.Encrypt(token.RefreshToken); err != nil {
+			return err
+		}
+	}
+	return saveIntegration(s.db, &integration)
+}
+
+// Disconnect 删除日历授权，并尝试在Google一侧撤销。修改记录保留
+func (s *CalendarService) Disconnect(ctx context.Context, userID uint) error {
+	if s.client == nil {
+		return ErrIntegrationDisabled
+	}
+	integration, err := s.integration(userID)
+	if err != nil {
+		return err
+	}
+
+	// 撤销失败不影响删除，用户仍可在Google账号设置中撤销
+	encrypted := integration.EncryptedRefreshToken
+	if encrypted == "" {
+		encrypted = integration.EncryptedAccessToken
+	}
+	if token, err := s.box.Decrypt(encrypted); err == nil {
+		if err := s.client.Revoke(ctx, token); err != nil {
+			log.Printf("Failed to revoke calendar token for user %d: %v", userID, err)
+		}
+	}
+	return s.db.Delete(integration).Error
+}
+
+// ListMutations 分页获取助手对用户日历的修改记录
+func (s *CalendarService) ListMutations(userID uint, page, pageSize int) ([]model.CalendarMutation, int64, error) {
+	query := s.db.Model(&model.CalendarMutation{}).Where("user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var mutations []model.CalendarMutation
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&mutations).Error
+	return mutations, total, err
+}
+
+func (s *CalendarService) integration(userID uint) (*model.UserIntegration, error) {
+	var integration model.UserIntegration
+	err := s.db.Where("user_id = ? AND provider = ?", userID, model.IntegrationGoogleCalendar).First(&integration).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrIntegrationNotConnected
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &integration, nil
+}
+
+// localTools 已授权的用户可使用日历工具，只读授权时不提供创建日程
+func (s *CalendarService) localTools(ctx context.Context, userID, conversationID uint) []localTool {
+	if s.client == nil {
+		return nil
+	}
+	integration, err := s.integration(userID)
+	if err != nil {
+		if !errors.Is(err, ErrIntegrationNotConnected) {
+			log.Printf("Failed to load calendar integration for user %d: %v", userID, err)
+		}
+		return nil
+	}
+	var user model.User
+	if err := s.db.Select("id", "timezone").Where("id = ?", userID).First(&user).Error; err != nil {
+		log.Printf("Failed to load timezone for user %d: %v", userID, err)
+		return nil
+	}
+	loc := user.Location()
+
+	tools := []localTool{{
+		name: calendarToolPrefix + "list_events",
+		description: fmt.Sprintf("List events on the user's primary Google Calendar, ordered by start time. "+
+			"The user's time zone is %s and the current time there is %s.", loc, time.Now().In(loc).Format(calendarTimeLayout)),
+		params: listEventsSchema,
+		run: func(ctx context.Context, arguments string) (string, error) {
+			return s.listEvents(ctx, integration, loc, arguments)
+		},
+	}}
+	if hasScope(integration.Scopes, gcal.ScopeEvents) {
+		tools = append(tools, localTool{
+			name: calendarToolPrefix + "create_event",
+			description: "Create an event on the user's primary Google Calendar. Only call this when the user explicitly " +
+				"asks to add an event; if the title, date or time is ambiguous, ask the user first instead of guessing.",
+			params: createEventSchema,
+			run: func(ctx context.Context, arguments string) (string, error) {
+				return s.createEvent(ctx, integration, conversationID, loc, arguments)
+			},
+		})
+	}
+	return tools
+}
+
+func (s *CalendarService) listEvents(ctx context.Context, integration *model.UserIntegration, loc *time.Location, arguments string) (string, error) {
+	var args struct {
+		TimeMin    string `json:"time_min"`
+		TimeMax    string `json:"time_max"`
+		MaxResults int    `json:"max_results"`
+	}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+
+	timeMin := time.Now()
+	if args.TimeMin != "" {
+		parsed, err := time.Parse(time.RFC3339, args.TimeMin)
+		if err != nil {
+			return "", fmt.Errorf("invalid arguments: time_min must be RFC 3339")
+		}
+		timeMin = parsed
+	}
+	timeMax := timeMin.Add(calendarDefaultRange)
+	if args.TimeMax != "" {
+		parsed, err := time.Parse(time.RFC3339, args.TimeMax)
+		if err != nil {
+			return "", fmt.Errorf("invalid arguments: time_max must be RFC 3339")
+		}
+		timeMax = parsed
+	}
+	if !timeMax.After(timeMin) {
+		return "", fmt.Errorf("invalid arguments: time_max must be after time_min")
+	}
+	if args.MaxResults <= 0 {
+		args.MaxResults = 20
+	}
+	if args.MaxResults > calendarMaxEvents {
+		args.MaxResults = calendarMaxEvents
+	}
+
+	accessToken, err := s.accessToken(ctx, integration)
+	if err != nil {
+		return "", err
+	}
+	events, err := s.client.ListEvents(ctx, accessToken, timeMin, timeMax, args.MaxResults)
+	if errors.Is(err, gcal.ErrUnauthorized) {
+		return "", ErrIntegrationExpired
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(events) == 0 {
+		return fmt.Sprintf("No events between %s and %s.",
+			timeMin.In(loc).Format(calendarTimeLayout), timeMax.In(loc).Format(calendarTimeLayout)), nil
+	}
+	var b strings.Builder
+	for _, event := range events {
+		fmt.Fprintf(&b, "- %s: %s to %s", event.Summary, formatEventTime(event.Start, loc), formatEventTime(event.End, loc))
+		if event.Location != "" {
+			fmt.Fprintf(&b, " at %s", event.Location)
+		}
+		b.WriteString("\n")
+		if event.Description != "" {
+			fmt.Fprintf(&b, "  %s\n", truncateRunes(strings.ReplaceAll(event.Description, "\n", " "), 300))
+		}
+	}
+	return b.String(), nil
+}
+
+func (s *CalendarService) createEvent(ctx context.Context, integration *model.UserIntegration, conversationID uint, loc *time.Location, arguments string) (string, error) {
+	var args struct {
+		Summary     string `json:"summary"`
+		Start       string `json:"start"`
+		End         string `json:"end"`
+		Description string `json:"description"`
+		Location    string `json:"location"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(args.Summary) == "" {
+		return "", fmt.Errorf("invalid arguments: summary is required")
+	}
+	start, err := time.Parse(time.RFC3339, args.Start)
+	if err != nil {
+		return "", fmt.Errorf("invalid arguments: start must be RFC 3339")
+	}
+	end, err := time.Parse(time.RFC3339, args.End)
+	if err != nil {
+		return "", fmt.Errorf("invalid arguments: end must be RFC 3339")
+	}
+	if !end.After(start) {
+		return "", fmt.Errorf("invalid arguments: end must be after start")
+	}
+
+	mutation := model.CalendarMutation{
+		UserID:         integration.UserID,
+		ConversationID: conversationID,
+		Action:         model.CalendarActionCreateEvent,
+		Summary:        truncateRunes(args.Summary, 200),
+		StartAt:        start,
+		EndAt:          end,
+	}
+	created, err := s.insertEvent(ctx, integration, &gcal.Event{
+		Summary:     args.Summary,
+		Description: args.Description,
+		Location:    args.Location,
+		Start:       gcal.EventTime{DateTime: start.Format(time.RFC3339), TimeZone: loc.String()},
+		End:         gcal.EventTime{DateTime: end.Format(time.RFC3339), TimeZone: loc.String()},
+	})
+	if err != nil {
+		mutation.Error = truncateRunes(err.Error(), 255)
+	} else {
+		mutation.EventID = created.ID
+	}
+	if dbErr := s.db.Create(&mutation).Error; dbErr != nil {
+		log.Printf("Failed to record calendar mutation for user %d: %v", integration.UserID, dbErr)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Created event %q from %s to %s: %s", created.Summary,
+		start.In(loc).Format(calendarTimeLayout), end.In(loc).Format(calendarTimeLayout), created.HTMLLink), nil
+}
+
+func (s *CalendarService) insertEvent(ctx context.Context, integration *model.UserIntegration, event *gcal.Event) (*gcal.Event, error) {
+	accessToken, err := s.accessToken(ctx, integration)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.client.CreateEvent(ctx, accessToken, event)
+	if errors.Is(err, gcal.ErrUnauthorized) {
+		return nil, ErrIntegrationExpired
+	}
+	return created, err
+}
+
+// accessToken 解密访问令牌，即将过期时先刷新并保存
+func (s *CalendarService) accessToken(ctx context.Context, integration *model.UserIntegration) (string, error) {
+	return integrationAccessToken(ctx, s.db, s.box, integration, func(ctx context.Context, refreshToken string) (string, time.Time, error) {
+		token, err := s.client.Refresh(ctx, refreshToken)
+		if errors.Is(err, gcal.ErrUnauthorized) {
+			return "", time.Time{}, ErrIntegrationExpired
+		}
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return token.AccessToken, token.ExpiresAt, nil
+	})
+}
+
+// formatEventTime 按用户时区格式化日程时间，全天日程只有日期
+func formatEventTime(t gcal.EventTime, loc *time.Location) string {
+	if t.DateTime == "" {
+		return t.Date + " (all day)"
+	}
+	parsed, err := time.Parse(time.RFC3339, t.DateTime)
+	if err != nil {
+		return t.DateTime
+	}
+	return parsed.In(loc).Format(calendarTimeLayout)
+}
+
+// hasScope 判断空格分隔的权限范围中是否包含scope
+func hasScope(scopes, scope string) bool {
+	for _, granted := range strings.Fields(scopes) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
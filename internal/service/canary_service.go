@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/metrics"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// defaultCanaryMinSamples 未指定时判断回滚所需的最少样本数
+	defaultCanaryMinSamples = 50
+	// canaryPingTimeout 创建灰度时校验模型可用的超时时间
+	canaryPingTimeout = 15 * time.Second
+)
+
+var (
+	ErrCanaryNotFound         = errors.New("canary rollout not found")
+	ErrCanaryInProgress       = errors.New("another canary rollout is in progress")
+	ErrCanaryEnded            = errors.New("canary rollout has already ended")
+	ErrCanaryModelUnavailable = errors.New("canary model is not available")
+)
+
+type CreateCanaryRequest struct {
+	Model   string `json:"model" validate:"required,max=128"`
+	Percent int    `json:"percent" validate:"min=1,max=100"`
+	// MaxErrorRate、MaxNegativeRate 自动回滚阈值（0-1），0表示不按该项回滚
+	MaxErrorRate    float64 `json:"max_error_rate" validate:"min=0,max=1"`
+	MaxNegativeRate float64 `json:"max_negative_rate" validate:"min=0,max=1"`
+	// MinSamples 为0时使用默认值
+	MinSamples int `json:"min_samples" validate:"min=0,max=1000000"`
+}
+
+type UpdateCanaryRequest struct {
+	Percent int `json:"percent" validate:"min=1,max=100"`
+}
+
+type EndCanaryRequest struct {
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+// CanaryStats 灰度发布及当前的错误率、差评率
+type CanaryStats struct {
+	*model.CanaryRollout
+	ErrorRate    float64 `json:"error_rate"`
+	Ratings      int64   `json:"ratings"`
+	Negative     int64   `json:"negative"`
+	NegativeRate float64 `json:"negative_rate"`
+}
+
+// CanaryService 新模型的灰度发布：按用户比例将服务端模型切到新模型，统计灰度的错误率和差评率，
+// 超过阈值时自动回滚。进行中的灰度缓存在各实例内存中，定期及管理操作后刷新
+type CanaryService struct {
+	db     *gorm.DB
+	ai     *AIService
+	bus    events.Bus
+	active atomic.Pointer[model.CanaryRollout]
+}
+
+func NewCanaryService(db *gorm.DB, aiService *AIService, bus events.Bus) *CanaryService {
+	return &CanaryService{db: db, ai: aiService, bus: bus}
+}
+
+// Refresh 重新加载进行中的灰度
+func (s *CanaryService) Refresh() error {
+	var rollout model.CanaryRollout
+	err := s.db.Where("status = ?", model.CanaryActive).Order("id DESC").First(&rollout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.active.Store(nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.active.Store(&rollout)
+	return nil
+}
+
+// Start 定期刷新进行中的灰度并检查是否需要回滚，只读模式下暂停，返回停止函数
+func (s *CanaryService) Start(interval time.Duration, paused func() bool) func() {
+	if err := s.Refresh(); err != nil {
+		log.Printf("Failed to load canary rollout: %v", err)
+	}
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				if err := s.Evaluate(); err != nil {
+					log.Printf("Failed to evaluate canary rollout: %v", err)
+				}
+				if err := s.Refresh(); err != nil {
+					log.Printf("Failed to refresh canary rollout: %v", err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// inCanary 用户是否落在灰度范围内，按灰度ID和用户ID分桶，调整比例时已在灰度中的用户保持不变
+func inCanary(rollout *model.CanaryRollout, userID uint) bool {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%d", rollout.ID, userID)
+	return int(h.Sum32()%100) < rollout.Percent
+}
+
+// route 返回用户应使用的灰度模型服务及灰度ID，没有进行中的灰度或用户不在范围内时返回nil
+func (s *CanaryService) route(userID uint, base *AIService) (*AIService, *uint, error) {
+	if s == nil {
+		return nil, nil, nil
+	}
+	rollout := s.active.Load()
+	if rollout == nil || !inCanary(rollout, userID) {
+		return nil, nil, nil
+	}
+	ai, err := base.WithEndpoint(Endpoint{Model: rollout.Model})
+	if err != nil {
+		return nil, nil, err
+	}
+	id := rollout.ID
+	return ai, &id, nil
+}
+
+// record 记录灰度期间一次服务端模型生成的结果。输入被拒绝和客户端取消不计为错误
+func (s *CanaryService) record(canaryID *uint, modelName string, err error) {
+	if s == nil || s.active.Load() == nil {
+		return
+	}
+	if errors.Is(err, ErrInputRejected) || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	variant, status := "baseline", "ok"
+	if canaryID != nil {
+		variant = "canary"
+	}
+	if err != nil {
+		status = "error"
+	}
+	metrics.CanaryGenerations.Inc(variant, modelName, status)
+
+	if canaryID == nil {
+		return
+	}
+	updates := map[string]interface{}{"requests": gorm.Expr("requests + 1")}
+	if err != nil {
+		updates["errors"] = gorm.Expr("errors + 1")
+	}
+	if dbErr := s.db.Model(&model.CanaryRollout{}).Where("id = ? AND status = ?", *canaryID, model.CanaryActive).
+		Updates(updates).Error; dbErr != nil {
+		log.Printf("Failed to record canary %d generation: %v", *canaryID, dbErr)
+	}
+}
+
+// Evaluate 检查进行中的灰度，样本数足够且错误率或差评率超过阈值时自动回滚
+func (s *CanaryService) Evaluate() error {
+	var rollout model.CanaryRollout
+	err := s.db.Where("status = ?", model.CanaryActive).Order("id DESC").First(&rollout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	stats, err := s.stats(&rollout)
+	if err != nil {
+		return err
+	}
+	var reason string
+	switch {
+	case rollout.MaxErrorRate > 0 && rollout.Requests >= int64(rollout.MinSamples) && stats.ErrorRate > rollout.MaxErrorRate:
+		reason = fmt.Sprintf("error rate %.4f exceeded %.4f over %d generations", stats.ErrorRate, rollout.MaxErrorRate, rollout.Requests)
+	case rollout.MaxNegativeRate > 0 && stats.Ratings >= int64(rollout.MinSamples) && stats.NegativeRate > rollout.MaxNegativeRate:
+		reason = fmt.Sprintf("negative feedback rate %.4f exceeded %.4f over %d ratings", stats.NegativeRate, rollout.MaxNegativeRate, stats.Ratings)
+	default:
+		return nil
+	}
+
+	log.Printf("Rolling back canary %d (%s): %s", rollout.ID, rollout.Model, reason)
+	_, err = s.end(0, rollout.ID, model.CanaryRolledBack, reason)
+	return err
+}
+
+// stats 计算灰度的错误率和差评率
+func (s *CanaryService) stats(rollout *model.CanaryRollout) (*CanaryStats, error) {
+	stats := &CanaryStats{CanaryRollout: rollout}
+	if rollout.Requests > 0 {
+		stats.ErrorRate = float64(rollout.Errors) / float64(rollout.Requests)
+	}
+
+	var counts struct {
+		Ratings  int64
+		Negative int64
+	}
+	if err := s.db.Model(&model.MessageFeedback{}).
+		Select("COUNT(*) AS ratings, COALESCE(SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END), 0) AS negative", model.FeedbackDown).
+		Where("canary_id = ?", rollout.ID).Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	stats.Ratings = counts.Ratings
+	stats.Negative = counts.Negative
+	if counts.Ratings > 0 {
+		stats.NegativeRate = float64(counts.Negative) / float64(counts.Ratings)
+	}
+	return stats, nil
+}
+
+// List 分页获取灰度发布记录（管理员）
+func (s *CanaryService) List(page, pageSize int) ([]model.CanaryRollout, int64, error) {
+	var total int64
+	if err := s.db.Model(&model.CanaryRollout{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rollouts []model.CanaryRollout
+	err := s.db.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rollouts).Error
+	return rollouts, total, err
+}
+
+// Get 获取灰度发布及当前指标（管理员）
+func (s *CanaryService) Get(id uint) (*CanaryStats, error) {
+	var rollout model.CanaryRollout
+	if err := s.db.First(&rollout, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCanaryNotFound
+		}
+		return nil, err
+	}
+	return s.stats(&rollout)
+}
+
+// Create 开始灰度发布（管理员），先以最小请求校验模型可用
+func (s *CanaryService) Create(ctx context.Context, adminID uint, req *CreateCanaryRequest) (*model.CanaryRollout, error) {
+	ai, err := s.ai.WithEndpoint(Endpoint{Model: req.Model})
+	if err != nil {
+		return nil, err
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, canaryPingTimeout)
+	defer cancel()
+	if err := ai.Ping(pingCtx); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCanaryModelUnavailable, err)
+	}
+
+	rollout := model.CanaryRollout{
+		Model:           req.Model,
+		Percent:         req.Percent,
+		Status:          model.CanaryActive,
+		MaxErrorRate:    req.MaxErrorRate,
+		MaxNegativeRate: req.MaxNegativeRate,
+		MinSamples:      req.MinSamples,
+		CreatedBy:       adminID,
+	}
+	if rollout.MinSamples == 0 {
+		rollout.MinSamples = defaultCanaryMinSamples
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var active []model.CanaryRollout
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("status = ?", model.CanaryActive).Find(&active).Error; err != nil {
+			return err
+		}
+		if len(active) > 0 {
+			return ErrCanaryInProgress
+		}
+		return tx.Create(&rollout).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.refresh()
+	return &rollout, nil
+}
+
+// UpdatePercent 调整灰度比例（管理员）
+func (s *CanaryService) UpdatePercent(id uint, req *UpdateCanaryRequest) (*model.CanaryRollout, error) {
+	result := s.db.Model(&model.CanaryRollout{}).Where("id = ? AND status = ?", id, model.CanaryActive).
+		Update("percent", req.Percent)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrCanaryEnded
+	}
+
+	s.refresh()
+	var rollout model.CanaryRollout
+	if err := s.db.First(&rollout, id).Error; err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// Complete 结束灰度（管理员），通常在将服务端模型切换为新模型后调用
+func (s *CanaryService) Complete(adminID, id uint, req *EndCanaryRequest) (*model.CanaryRollout, error) {
+	return s.end(adminID, id, model.CanaryCompleted, req.Reason)
+}
+
+// Rollback 手动回滚灰度（管理员），所有用户回到服务端模型
+func (s *CanaryService) Rollback(adminID, id uint, req *EndCanaryRequest) (*model.CanaryRollout, error) {
+	return s.end(adminID, id, model.CanaryRolledBack, req.Reason)
+}
+
+// end 结束进行中的灰度，回滚时发布事件。actorID为0表示自动回滚
+func (s *CanaryService) end(actorID, id uint, status, reason string) (*model.CanaryRollout, error) {
+	now := time.Now()
+	result := s.db.Model(&model.CanaryRollout{}).Where("id = ? AND status = ?", id, model.CanaryActive).
+		Updates(map[string]interface{}{"status": status, "end_reason": reason, "ended_at": &now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrCanaryEnded
+	}
+
+	s.refresh()
+	var rollout model.CanaryRollout
+	if err := s.db.First(&rollout, id).Error; err != nil {
+		return nil, err
+	}
+	if status == model.CanaryRolledBack {
+		s.bus.Publish(context.Background(), events.New(events.CanaryRolledBack, actorID, events.CanaryPayload{
+			RolloutID: rollout.ID,
+			Model:     rollout.Model,
+			Reason:    reason,
+		}))
+	}
+	return &rollout, nil
+}
+
+// refresh 管理操作后立即刷新本实例的缓存，其他实例在下次定期刷新时生效
+func (s *CanaryService) refresh() {
+	if err := s.Refresh(); err != nil {
+		log.Printf("Failed to refresh canary rollout: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"ai-chat-backend/internal/model"
+)
+
+// 压缩保存的长消息content列为空，关键词筛选和搜索需解压后比较
+func TestSearchCompressedMessages(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{})
+	conversation := model.Conversation{UserID: user.ID, Title: "search"}
+	if err := db.Create(&conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 200) + "NeedleKeyword"
+	messages := []model.Message{
+		{ConversationID: conversation.ID, Role: "user", Content: "short needlekeyword message"},
+		{ConversationID: conversation.ID, Role: "assistant", Content: long},
+		{ConversationID: conversation.ID, Role: "assistant", Content: strings.Repeat("unrelated text ", 400)},
+	}
+	for i := range messages {
+		if err := db.Create(&messages[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored model.Message
+	if err := db.Select("id", "content", "content_encoding").First(&stored, messages[1].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ContentEncoding != model.ContentEncodingZstd || stored.Content != "" {
+		t.Fatalf("long message not compressed: encoding %q", stored.ContentEncoding)
+	}
+
+	s := &ChatService{db: db}
+	tests := []struct {
+		name    string
+		keyword string
+		want    []uint
+	}{
+		{"plain and compressed", "needlekeyword", []uint{messages[0].ID, messages[1].ID}},
+		{"compressed only", "NeedleKeyword", []uint{messages[0].ID, messages[1].ID}},
+		{"no match", "absent", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, total, err := s.GetMessages(user.ID, conversation.ID, MessageListOptions{Contains: tt.keyword}, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != int64(len(tt.want)) || !sameMessageIDs(listed, tt.want) {
+				t.Fatalf("GetMessages = %v (total %d), want %v", messageIDs(listed), total, tt.want)
+			}
+			if len(listed) == 2 && listed[1].Content != long {
+				t.Fatal("compressed message returned without its content")
+			}
+
+			found, err := s.SearchMessages(user.ID, tt.keyword, conversation.ID, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 搜索结果按时间倒序
+			want := append([]uint(nil), tt.want...)
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+			if !sameMessageIDs(found, want) {
+				t.Fatalf("SearchMessages = %v, want %v", messageIDs(found), want)
+			}
+		})
+	}
+
+	// 分页按匹配的消息计算
+	listed, total, err := s.GetMessages(user.ID, conversation.ID, MessageListOptions{Contains: "needlekeyword"}, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || !sameMessageIDs(listed, []uint{messages[1].ID}) {
+		t.Fatalf("page 2 = %v (total %d)", messageIDs(listed), total)
+	}
+}
+
+func messageIDs(messages []model.Message) []uint {
+	ids := make([]uint, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func sameMessageIDs(messages []model.Message, want []uint) bool {
+	if len(messages) != len(want) {
+		return false
+	}
+	for i, msg := range messages {
+		if msg.ID != want[i] {
+			return false
+		}
+	}
+	return true
+}
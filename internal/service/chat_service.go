@@ -2,49 +2,276 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
+	"ai-chat-backend/internal/cache"
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
 	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/tokenizer"
 
+	"github.com/cloudwego/eino/callbacks"
+	einomodel "github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
+// historyLimit 组装AI上下文时读取的历史消息条数
+const historyLimit = 20
+
+// likeEscaper 转义LIKE模式中的通配符，使关键词按字面匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// messagePreviewLength 会话列表消息预览的最大字符数
+const messagePreviewLength = 100
+
+// messageMatchBatch 按关键词筛选消息时每批读取的候选数
+const messageMatchBatch = 500
+
+var (
+	ErrIncognitoUnavailable    = errors.New("incognito mode is not available")
+	ErrConversationNotFound    = errors.New("conversation not found")
+	ErrMergeSameConversation   = errors.New("cannot merge a conversation into itself")
+	ErrMergeIncognito          = errors.New("incognito conversations cannot be merged")
+	ErrIncognitoMessage        = errors.New("messages in incognito conversations cannot be deleted individually")
+	ErrInvalidDeleteMode       = errors.New("mode must be delete or redact")
+	ErrInvalidConversationSort = errors.New("sort must be last_message_at, created_at, updated_at or title and order must be asc or desc")
+	ErrInvalidMessageFilter    = errors.New("role must be user, assistant, tool or summary and from must not be after to")
+)
+
+// 单条消息的删除方式
+const (
+	MessageDeleteSoft   = "delete" // 软删除，消息从会话中消失
+	MessageDeleteRedact = "redact" // 涂抹，保留消息记录但清空内容，会话中可显示占位
+)
+
 type ChatService struct {
-	db        *gorm.DB
-	aiService *AIService
+	db            *gorm.DB
+	aiService     *AIService
+	planService   *PlanService
+	creditService *CreditService
+	apiKeyService *APIKeyService
+	orgService    *OrgService
+	toolService   *ToolService
+	promptService *PromptService
+	bus           events.Bus
+	incognito     *incognitoStore
+	// history 活跃会话最近上下文的Redis缓存，nil时每次从数据库读取
+	history *cache.HistoryCache
+	// activeStreams 当前进行中的流式生成数，用于诊断
+	activeStreams atomic.Int64
+	// compactThreshold 未压缩消息超过该数量时自动汇总，compactKeep为汇总后保留的最近消息数
+	compactThreshold int
+	compactKeep      int
+	// compacting 正在压缩的会话ID
+	compacting sync.Map
+	// generations 进行中的流式生成，用于按会话取消
+	generations *generationRegistry
+	// pipelines 按助手名称编译的生成流水线，callbacks在每次生成时挂载
+	pipelinesMu sync.RWMutex
+	pipelines   map[string]*chatPipeline
+	callbacks   []callbacks.Handler
+	// generationTraces 是否保存每次生成的追踪记录
+	generationTraces bool
+	// detector 提示词注入/越狱检测，nil时不检测
+	detector *jailbreakDetector
+	// secrets 用户消息中的凭据检测，nil时不检测
+	secrets *secretDetector
+	// sanitizer 检索文档放入提示词前的处理
+	sanitizer *contentSanitizer
+	// deduper 合并重复提交的用户消息，nil时不合并
+	deduper *messageDeduper
+	// streamCfg 流式生成的用量事件间隔和计价
+	streamCfg config.StreamConfig
+	// slo 统计首token延迟，nil时只记录指标
+	slo *SLOService
+	// canary 新模型灰度发布，nil时不灰度
+	canary *CanaryService
+	// attachmentService 消息附带的文件，nil时消息不能附带文件
+	attachmentService *AttachmentService
+	// autoTitle 首轮问答后是否自动生成会话标题
+	autoTitle bool
+	// quotaWarningRatio 剩余消息数不超过每日上限的该比例时提醒
+	quotaWarningRatio float64
 }
 
-func NewChatService(db *gorm.DB, aiService *AIService) *ChatService {
-	return &ChatService{
-		db:        db,
-		aiService: aiService,
+// NewChatService 创建聊天服务，rdb为nil时不支持无痕会话，apiKeyService/orgService为nil时不支持用户自带Key和组织模型服务，
+// toolService为nil时不提供MCP工具，promptService为nil时不使用版本化的提示词模板
+func NewChatService(db *gorm.DB, rdb *redis.Client, aiService *AIService, planService *PlanService, creditService *CreditService, apiKeyService *APIKeyService, orgService *OrgService, toolService *ToolService, promptService *PromptService, bus events.Bus) *ChatService {
+	s := &ChatService{
+		db:            db,
+		aiService:     aiService,
+		planService:   planService,
+		creditService: creditService,
+		apiKeyService: apiKeyService,
+		orgService:    orgService,
+		toolService:   toolService,
+		promptService: promptService,
+		bus:           bus,
+		pipelines:     make(map[string]*chatPipeline),
+		generations:   newGenerationRegistry(),
 	}
+	cfg := config.Load()
+	if rdb != nil {
+		s.incognito = newIncognitoStore(rdb, cfg.Chat.IncognitoTTL)
+		if cfg.Chat.HistoryCacheTTL > 0 {
+			s.history = cache.NewHistoryCache(rdb, historyLimit, cfg.Chat.HistoryCacheTTL)
+		}
+	}
+	s.compactThreshold = cfg.Chat.CompactThreshold
+	s.compactKeep = cfg.Chat.CompactKeep
+	if s.compactKeep >= s.compactThreshold {
+		s.compactThreshold = 0
+	}
+	s.generationTraces = cfg.Chat.GenerationTraces
+	s.autoTitle = cfg.Chat.AutoTitle
+	s.quotaWarningRatio = cfg.Chat.QuotaWarningRatio
+	s.streamCfg = cfg.Stream
+	s.detector = newJailbreakDetector(db, aiService, cfg.Chat)
+	s.secrets = newSecretDetector(cfg.Chat)
+	s.sanitizer = newContentSanitizer(cfg.Chat)
+	if cfg.Chat.DedupeWindow > 0 {
+		s.deduper = newMessageDeduper(cfg.Chat.DedupeWindow)
+	}
+	s.UseCallbacks(newObserver(db, cfg.Chat.PromptAudit))
+	if err := s.RegisterAssistant(context.Background(), &Assistant{
+		Name:           defaultAssistant,
+		SystemPrompt:   cfg.Chat.SystemPrompt,
+		PromptTemplate: PromptSystem,
+	}); err != nil {
+		log.Fatalf("Failed to build chat pipeline: %v", err)
+	}
+	return s
 }
 
 type CreateConversationRequest struct {
-	Title string `json:"title" validate:"required,max=100"`
+	Title     string `json:"title" validate:"required,max=100"`
+	Incognito bool   `json:"incognito"`
+	// Model 会话选用的模型，为空时使用默认模型
+	Model string `json:"model" validate:"max=100"`
+	// SystemPrompt 会话的系统提示词，附加在助手的系统提示词之后
+	SystemPrompt string `json:"system_prompt" validate:"max=4000"`
+	// Temperature 采样温度，为空时使用模型默认值
+	Temperature *float32 `json:"temperature" validate:"omitempty,min=0,max=2"`
+	// MaxTokens 单次回复的输出上限，0表示使用用户或服务端的设置，不能超过服务端上限
+	MaxTokens int `json:"max_tokens" validate:"min=0"`
+	// Assistant 生成回复使用的助手，为空时使用默认助手，未注册的助手返回ErrAssistantNotFound
+	Assistant string `json:"assistant" validate:"max=64"`
+}
+
+// UpdateConversationRequest 修改会话，未提供的字段保持不变。system_prompt、model为空字符串时清除，
+// temperature为负数（如-1）时恢复模型默认值，max_tokens为0时使用用户或服务端的设置
+type UpdateConversationRequest struct {
+	Title        *string  `json:"title" validate:"omitempty,min=1,max=100"`
+	SystemPrompt *string  `json:"system_prompt" validate:"omitempty,max=4000"`
+	Model        *string  `json:"model" validate:"omitempty,max=100"`
+	Temperature  *float32 `json:"temperature" validate:"omitempty,min=-1,max=2"`
+	MaxTokens    *int     `json:"max_tokens" validate:"omitempty,min=0"`
 }
 
 type SendMessageRequest struct {
-	Content string `json:"content" validate:"required,max=4000"`
+	// Content 最大长度取决于模型上下文窗口，由CheckMessageLength校验
+	Content string `json:"content" validate:"required"`
+	// AttachmentIDs 随消息发送的已上传文件，其中图片的文字识别后一并发给模型
+	AttachmentIDs []uint `json:"attachment_ids" validate:"max=10"`
+	// Retrieval、SourceBudget 仅对本条消息覆盖会话的知识库检索设置，未提供时使用会话设置
+	Retrieval    *bool `json:"retrieval"`
+	SourceBudget *int  `json:"source_budget" validate:"omitempty,min=0,max=20"`
+	// Model 仅对本条消息选用的模型，未提供时使用会话选用的模型
+	Model string `json:"model" validate:"max=100"`
+	// AutoTitle 为false时本条消息不触发自动生成会话标题，未提供时按CHAT_AUTO_TITLE配置
+	AutoTitle *bool `json:"auto_title"`
 }
 
-// GetConversations 获取用户的会话列表
-func (s *ChatService) GetConversations(userID uint, page, pageSize int) ([]model.Conversation, int64, error) {
+// ConversationTagsRequest 会话的全部标签，替换原有标签，为空时清除
+type ConversationTagsRequest struct {
+	Tags []string `json:"tags" validate:"max=10,dive,max=50"`
+}
+
+// RetrievalSettingsRequest 会话的知识库检索设置，未提供的字段保持不变
+type RetrievalSettingsRequest struct {
+	Enabled      *bool `json:"enabled"`
+	SourceBudget *int  `json:"source_budget" validate:"omitempty,min=0,max=20"`
+}
+
+// conversationSortColumns 会话列表允许的排序字段，均有(user_id, 字段)联合索引
+var conversationSortColumns = map[string]string{
+	"last_message_at": "last_message_at",
+	"created_at":      "created_at",
+	"updated_at":      "updated_at",
+	"title":           "title",
+}
+
+// ConversationListOptions 会话列表的排序和筛选条件，零值为按最后消息时间倒序返回未归档的会话
+type ConversationListOptions struct {
+	Archived bool
+	// Sort 排序字段：last_message_at（默认）、created_at、updated_at、title
+	Sort string
+	// Order asc或desc，默认desc
+	Order string
+	// Query 只返回标题包含该关键词的会话
+	Query string
+	// AssistantID 只返回执行过该已保存工作流（自定义助手）的会话
+	AssistantID uint
+	// Tag 只返回带有该标签的会话
+	Tag string
+}
+
+// GetConversations 获取用户的会话列表，Archived为true时只返回已归档的会话，否则只返回未归档的。
+// 排序字段或方向不在允许范围内时返回ErrInvalidConversationSort
+func (s *ChatService) GetConversations(userID uint, opts ConversationListOptions, page, pageSize int) ([]model.Conversation, int64, error) {
+	sort := opts.Sort
+	if sort == "" {
+		sort = "last_message_at"
+	}
+	column, ok := conversationSortColumns[sort]
+	if !ok {
+		return nil, 0, ErrInvalidConversationSort
+	}
+	order := strings.ToLower(opts.Order)
+	if order == "" {
+		order = "desc"
+	}
+	if order != "asc" && order != "desc" {
+		return nil, 0, ErrInvalidConversationSort
+	}
+
 	var conversations []model.Conversation
 	var total int64
 
 	query := s.db.Where("user_id = ?", userID)
+	if opts.Archived {
+		query = query.Where("archived_at IS NOT NULL")
+	} else {
+		query = query.Where("archived_at IS NULL")
+	}
+	if opts.Query != "" {
+		query = query.Where("title LIKE ?", "%"+likeEscaper.Replace(opts.Query)+"%")
+	}
+	if opts.AssistantID != 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM workflow_runs WHERE workflow_runs.conversation_id = conversations.id AND workflow_runs.workflow_id = ?)", opts.AssistantID)
+	}
+	if opts.Tag != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM conversation_tags WHERE conversation_tags.conversation_id = conversations.id AND conversation_tags.name = ?)", normalizeTag(opts.Tag))
+	}
 
 	// 获取总数
 	if err := query.Model(&model.Conversation{}).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	// 分页查询
+	// 分页查询，以id作为相同排序值时的次序保证翻页稳定
 	offset := (page - 1) * pageSize
-	if err := query.Order("updated_at DESC").Offset(offset).Limit(pageSize).Find(&conversations).Error; err != nil {
+	if err := query.Preload("Tags").Order(column + " " + order + ", id " + order).Offset(offset).Limit(pageSize).Find(&conversations).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -53,34 +280,296 @@ func (s *ChatService) GetConversations(userID uint, page, pageSize int) ([]model
 
 // CreateConversation 创建新会话
 func (s *ChatService) CreateConversation(userID uint, req *CreateConversationRequest) (*model.Conversation, error) {
+	if req.Incognito && s.incognito == nil {
+		return nil, ErrIncognitoUnavailable
+	}
+
+	if err := s.planService.CheckConversation(userID); err != nil {
+		return nil, err
+	}
+	if err := s.checkModel(userID, req.Model); err != nil {
+		return nil, err
+	}
+	if req.Assistant != "" && !s.hasAssistant(req.Assistant) {
+		return nil, ErrAssistantNotFound
+	}
+	if err := s.checkSystemPrompt(userID, 0, req.SystemPrompt); err != nil {
+		return nil, err
+	}
+
 	conversation := model.Conversation{
-		UserID: userID,
-		Title:  req.Title,
+		UserID:        userID,
+		Title:         req.Title,
+		Incognito:     req.Incognito,
+		LastMessageAt: time.Now(),
+		Model:         req.Model,
+		SystemPrompt:  req.SystemPrompt,
+		Temperature:   req.Temperature,
+		MaxTokens:     req.MaxTokens,
+		Assistant:     req.Assistant,
 	}
 
-	if err := s.db.Create(&conversation).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+		return incrementUserCounter(tx, userID, "conversation_count", 1)
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	s.publishConversationEvent(&conversation, events.ConversationCreated)
+
 	return &conversation, nil
 }
 
 // GetConversation 获取会话详情
 func (s *ChatService) GetConversation(userID, conversationID uint) (*model.Conversation, error) {
+	var conversation model.Conversation
+	if err := s.db.Preload("Tags").Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// UpdateConversation 修改会话的标题、系统提示词、模型和生成参数，只有标题变化时推送重命名事件
+func (s *ChatService) UpdateConversation(userID, conversationID uint, req *UpdateConversationRequest) (*model.Conversation, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	renamed := false
+	if req.Title != nil && *req.Title != conversation.Title {
+		updates["title"] = *req.Title
+		conversation.Title = *req.Title
+		renamed = true
+	}
+	if req.SystemPrompt != nil {
+		if err := s.checkSystemPrompt(userID, conversationID, *req.SystemPrompt); err != nil {
+			return nil, err
+		}
+		updates["system_prompt"] = *req.SystemPrompt
+		conversation.SystemPrompt = *req.SystemPrompt
+	}
+	if req.Model != nil {
+		if err := s.checkModel(userID, *req.Model); err != nil {
+			return nil, err
+		}
+		updates["model"] = *req.Model
+		conversation.Model = *req.Model
+	}
+	if req.Temperature != nil {
+		if *req.Temperature < 0 {
+			conversation.Temperature = nil
+		} else {
+			conversation.Temperature = req.Temperature
+		}
+		updates["temperature"] = conversation.Temperature
+	}
+	if req.MaxTokens != nil {
+		updates["max_tokens"] = *req.MaxTokens
+		conversation.MaxTokens = *req.MaxTokens
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(&conversation).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if renamed {
+		s.publishConversationEvent(&conversation, events.ConversationRenamed)
+	}
+	return &conversation, nil
+}
+
+// checkModel 检查用户可以选用该服务端模型，为空时使用默认模型
+func (s *ChatService) checkModel(userID uint, name string) error {
+	if name == "" {
+		return nil
+	}
+	region, err := userRegion(s.db, userID)
+	if err != nil {
+		return err
+	}
+	_, err = s.aiService.ForModel(region, name)
+	return err
+}
+
+// checkSystemPrompt 会话的系统提示词与用户消息一样经过注入检测，达到拒绝阈值时返回ErrInputRejected
+func (s *ChatService) checkSystemPrompt(userID, conversationID uint, prompt string) error {
+	if s.detector == nil || prompt == "" {
+		return nil
+	}
+	ctx := withGeneration(context.Background(), &generationInfo{UserID: userID, ConversationID: conversationID})
+	return s.detector.inspectInput(ctx, prompt)
+}
+
+// SetAutoArchive 设置会话是否允许自动归档，关闭时同时取消已有的归档
+func (s *ChatService) SetAutoArchive(userID, conversationID uint, enabled bool) error {
+	updates := map[string]interface{}{"auto_archive": enabled}
+	if !enabled {
+		updates["archived_at"] = nil
+	}
+	result := s.db.Model(&model.Conversation{}).Where("id = ? AND user_id = ?", conversationID, userID).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+// SetRetrieval 设置会话是否检索启用的知识库及每次回复最多引用的分块数
+func (s *ChatService) SetRetrieval(userID, conversationID uint, req *RetrievalSettingsRequest) (*model.Conversation, error) {
 	var conversation model.Conversation
 	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
 		return nil, err
 	}
+	updates := map[string]interface{}{}
+	if req.Enabled != nil {
+		updates["retrieval_enabled"] = *req.Enabled
+		conversation.RetrievalEnabled = *req.Enabled
+	}
+	if req.SourceBudget != nil {
+		updates["source_budget"] = *req.SourceBudget
+		conversation.SourceBudget = *req.SourceBudget
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(&conversation).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
 	return &conversation, nil
 }
 
-// UpdateConversation 更新会话
-func (s *ChatService) UpdateConversation(userID, conversationID uint, title string) error {
-	return s.db.Model(&model.Conversation{}).Where("id = ? AND user_id = ?", conversationID, userID).Update("title", title).Error
+// normalizeTag 标签去掉首尾空白并转为小写，筛选和保存时使用相同的形式
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// SetTags 以tags替换会话的全部标签，重复的标签只保存一次，返回保存后的标签
+func (s *ChatService) SetTags(userID, conversationID uint, tags []string) ([]model.ConversationTag, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+
+	saved := make([]model.ConversationTag, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		name := normalizeTag(tag)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		saved = append(saved, model.ConversationTag{ConversationID: conversationID, UserID: userID, Name: name})
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", conversationID).Delete(&model.ConversationTag{}).Error; err != nil {
+			return err
+		}
+		if len(saved) == 0 {
+			return nil
+		}
+		return tx.Create(&saved).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// retrievalFor 本条消息的检索设置：消息的覆盖优先于会话设置
+func retrievalFor(conversation *model.Conversation, req *SendMessageRequest) retrievalOptions {
+	opts := retrievalOptions{Enabled: conversation.RetrievalEnabled, Budget: conversation.SourceBudget}
+	if req.Retrieval != nil {
+		opts.Enabled = *req.Retrieval
+	}
+	if req.SourceBudget != nil {
+		opts.Budget = *req.SourceBudget
+	}
+	return opts
+}
+
+// modelFor 本条消息选用的模型：消息指定的优先于会话选用的，都为空时使用默认模型
+func modelFor(conversation *model.Conversation, req *SendMessageRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return conversation.Model
+}
+
+// SetModel 为会话选用模型（AI_PROVIDERS中的模型名称），name为空时恢复默认模型
+func (s *ChatService) SetModel(userID, conversationID uint, name string) error {
+	region, err := userRegion(s.db, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.aiService.ForModel(region, name); err != nil {
+		return err
+	}
+	result := s.db.Model(&model.Conversation{}).Where("id = ? AND user_id = ?", conversationID, userID).Update("model", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+// Models 用户可选用的服务端模型，使用自带Key或组织模型服务的会话不受影响
+func (s *ChatService) Models(userID uint) ([]ModelInfo, error) {
+	region, err := userRegion(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.aiService.Models(region)
+}
+
+// SetModelEndpoint 为会话选用组织的模型服务，endpointID为nil时恢复默认模型
+func (s *ChatService) SetModelEndpoint(userID, conversationID uint, endpointID *uint) error {
+	if endpointID != nil {
+		if s.orgService == nil {
+			return ErrModelEndpointNotFound
+		}
+		if _, err := s.orgService.EndpointForUser(userID, *endpointID); err != nil {
+			return err
+		}
+	}
+	result := s.db.Model(&model.Conversation{}).Where("id = ? AND user_id = ?", conversationID, userID).
+		Update("model_endpoint_id", endpointID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
 }
 
 // DeleteConversation 删除会话
 func (s *ChatService) DeleteConversation(userID, conversationID uint) error {
+	// 验证会话是否属于用户
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return err
+	}
+
 	// 删除会话及其所有消息
 	tx := s.db.Begin()
 	defer func() {
@@ -90,7 +579,13 @@ func (s *ChatService) DeleteConversation(userID, conversationID uint) error {
 	}()
 
 	// 删除消息
-	if err := tx.Where("conversation_id = ?", conversationID).Delete(&model.Message{}).Error; err != nil {
+	result := tx.Where("conversation_id = ?", conversationID).Delete(&model.Message{})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+
+	if err := tx.Where("conversation_id = ?", conversationID).Delete(&model.ConversationTag{}).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -101,21 +596,286 @@ func (s *ChatService) DeleteConversation(userID, conversationID uint) error {
 		return err
 	}
 
-	return tx.Commit().Error
+	// 更新用户计数
+	if err := incrementUserCounter(tx, userID, "conversation_count", -1); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := incrementUserCounter(tx, userID, "message_count", -result.RowsAffected); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	s.publishConversationEvent(&conversation, events.ConversationDeleted)
+	invalidateHistory(s.history, conversationID)
+
+	// 清理无痕会话的缓存消息
+	if conversation.Incognito && s.incognito != nil {
+		return s.incognito.Delete(context.Background(), conversationID)
+	}
+	return nil
+}
+
+// MergeConversationsRequest 将source会话并入target会话
+type MergeConversationsRequest struct {
+	TargetID uint `json:"target_id" validate:"required"`
+	SourceID uint `json:"source_id" validate:"required"`
+}
+
+// MergeConversations 将source会话的消息并入target会话并删除source，返回合并后的会话和并入的消息数。
+// 消息保留原创建时间，在target中按时间交错排列，并以merged_from_id标注原属的会话（多次合并时保留最初的会话）
+func (s *ChatService) MergeConversations(userID uint, req *MergeConversationsRequest) (*model.Conversation, int64, error) {
+	if req.TargetID == req.SourceID {
+		return nil, 0, ErrMergeSameConversation
+	}
+
+	// 两个会话都必须属于用户
+	var conversations []model.Conversation
+	if err := s.db.Where("id IN ? AND user_id = ?", []uint{req.TargetID, req.SourceID}, userID).Find(&conversations).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(conversations) != 2 {
+		return nil, 0, ErrConversationNotFound
+	}
+	target, source := conversations[0], conversations[1]
+	if target.ID != req.TargetID {
+		target, source = source, target
+	}
+	if target.Incognito || source.Incognito {
+		return nil, 0, ErrMergeIncognito
+	}
+
+	var moved int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Message{}).Where("conversation_id = ?", source.ID).Updates(map[string]interface{}{
+			"conversation_id": target.ID,
+			"merged_from_id":  gorm.Expr("COALESCE(merged_from_id, ?)", source.ID),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+
+		// 冷存储批次随消息转移，否则会作为已删除会话的内容被清理
+		if err := tx.Model(&model.MessageArchive{}).Where("conversation_id = ?", source.ID).
+			Update("conversation_id", target.ID).Error; err != nil {
+			return err
+		}
+		if source.LastMessageAt.After(target.LastMessageAt) {
+			if err := touchConversation(tx, target.ID, source.LastMessageAt); err != nil {
+				return err
+			}
+			target.LastMessageAt = source.LastMessageAt
+			target.ArchivedAt = nil
+		}
+		if err := tx.Where("conversation_id = ?", source.ID).Delete(&model.ConversationTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&source).Error; err != nil {
+			return err
+		}
+		return incrementUserCounter(tx, userID, "conversation_count", -1)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.publishConversationEvent(&source, events.ConversationDeleted)
+	invalidateHistory(s.history, source.ID, target.ID)
+	s.bus.Publish(context.Background(), events.New(events.ConversationMerged, userID, events.ConversationMergedPayload{
+		ConversationID: target.ID,
+		Title:          target.Title,
+		SourceID:       source.ID,
+		MessageCount:   moved,
+	}))
+	return &target, moved, nil
+}
+
+// DeleteMessage 删除或涂抹会话中的单条消息（如误粘贴的密钥），两种方式的消息都不再作为上下文、不参与摘要和导出。
+// 操作写入审计日志（不含消息内容）；已移入冷存储的消息不再恢复其内容
+func (s *ChatService) DeleteMessage(userID, conversationID, messageID uint, mode, ip string) error {
+	if mode != MessageDeleteSoft && mode != MessageDeleteRedact {
+		return ErrInvalidDeleteMode
+	}
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrConversationNotFound
+		}
+		return err
+	}
+	if conversation.Incognito {
+		return ErrIncognitoMessage
+	}
+
+	var message model.Message
+	if err := s.db.Where("id = ? AND conversation_id = ?", messageID, conversationID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMessageNotFound
+		}
+		return err
+	}
+
+	eventType := events.MessageDeleted
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if mode == MessageDeleteRedact {
+			eventType = events.MessageRedacted
+			// 清空cold_archive_id，恢复冷存储时不会写回原内容
+			return tx.Model(&message).Updates(map[string]interface{}{
+				"content":            "",
+				"content_encoding":   "",
+				"compressed_content": nil,
+				"redacted_at":        time.Now(),
+				"cold_archive_id":    nil,
+			}).Error
+		}
+		if err := tx.Delete(&message).Error; err != nil {
+			return err
+		}
+		return incrementUserCounter(tx, userID, "message_count", -1)
+	})
+	if err != nil {
+		return err
+	}
+	invalidateHistory(s.history, conversationID)
+
+	s.bus.Publish(context.Background(), events.New(eventType, userID, events.AccountPayload{
+		IP:     ip,
+		Detail: fmt.Sprintf("conversation_id=%d message_id=%d role=%s", conversationID, messageID, message.Role),
+	}))
+	return nil
+}
+
+// messageFilterRoles 消息列表允许筛选的角色
+var messageFilterRoles = map[string]bool{
+	"user":            true,
+	"assistant":       true,
+	model.RoleTool:    true,
+	model.RoleSummary: true,
+}
+
+// MessageListOptions 消息列表的筛选条件，零值返回全部消息
+type MessageListOptions struct {
+	// Roles 只返回这些角色的消息
+	Roles []string
+	// From/To 只返回创建时间在[From, To]之间的消息，为nil时不限制
+	From *time.Time
+	To   *time.Time
+	// Contains 只返回内容包含该关键词的消息
+	Contains string
+}
+
+// filtered 是否设置了任何筛选条件
+func (o MessageListOptions) filtered() bool {
+	return len(o.Roles) > 0 || o.From != nil || o.To != nil || o.Contains != ""
+}
+
+// validate 角色不在允许范围内或From晚于To时返回ErrInvalidMessageFilter
+func (o MessageListOptions) validate() error {
+	for _, role := range o.Roles {
+		if !messageFilterRoles[role] {
+			return ErrInvalidMessageFilter
+		}
+	}
+	if o.From != nil && o.To != nil && o.From.After(*o.To) {
+		return ErrInvalidMessageFilter
+	}
+	return nil
+}
+
+// apply 把筛选条件加到消息查询上
+func (o MessageListOptions) apply(query *gorm.DB) *gorm.DB {
+	if len(o.Roles) > 0 {
+		query = query.Where("role IN ?", o.Roles)
+	}
+	if o.From != nil {
+		query = query.Where("created_at >= ?", *o.From)
+	}
+	if o.To != nil {
+		query = query.Where("created_at <= ?", *o.To)
+	}
+	if o.Contains != "" {
+		query = query.Where(containsCondition(""), "%"+likeEscaper.Replace(o.Contains)+"%")
+	}
+	return query
+}
+
+// containsCondition 内容包含关键词的LIKE条件，prefix为消息列的表名前缀。压缩保存的消息content列为空，一并作为候选，解压后由matchMessageIDs筛选
+func containsCondition(prefix string) string {
+	return "(" + prefix + "content LIKE ? OR " + prefix + "content_encoding <> '')"
+}
+
+// containsFold 不区分大小写的包含判断，与LIKE在默认排序规则下的行为一致
+func containsFold(content, keyword string) bool {
+	return strings.Contains(strings.ToLower(content), strings.ToLower(keyword))
+}
+
+// matchMessageIDs 按query的顺序分批读取候选消息，返回内容包含keyword的消息ID，limit<=0时返回全部。
+// 未压缩的候选已由LIKE匹配，压缩的候选解压后比较；prefix为联表查询时消息列的表名前缀
+func matchMessageIDs(query *gorm.DB, prefix, keyword string, limit int) ([]uint, error) {
+	var ids []uint
+	for offset := 0; ; offset += messageMatchBatch {
+		var candidates []model.Message
+		if err := query.Session(&gorm.Session{}).Select(prefix+"id", prefix+"content_encoding", prefix+"compressed_content").
+			Offset(offset).Limit(messageMatchBatch).Find(&candidates).Error; err != nil {
+			return nil, err
+		}
+		for i := range candidates {
+			if candidates[i].ContentEncoding == "" || containsFold(candidates[i].Content, keyword) {
+				ids = append(ids, candidates[i].ID)
+				if limit > 0 && len(ids) >= limit {
+					return ids, nil
+				}
+			}
+		}
+		if len(candidates) < messageMatchBatch {
+			return ids, nil
+		}
+	}
 }
 
-// GetMessages 获取会话消息
-func (s *ChatService) GetMessages(userID, conversationID uint, page, pageSize int) ([]model.Message, int64, error) {
+// match 按相同的条件筛选无痕会话的消息
+func (o MessageListOptions) match(msg *model.Message) bool {
+	if len(o.Roles) > 0 && !slices.Contains(o.Roles, msg.Role) {
+		return false
+	}
+	if o.From != nil && msg.CreatedAt.Before(*o.From) {
+		return false
+	}
+	if o.To != nil && msg.CreatedAt.After(*o.To) {
+		return false
+	}
+	return o.Contains == "" || containsFold(msg.Content, o.Contains)
+}
+
+// GetMessages 获取会话消息，按创建时间正序分页。角色不在允许范围内或From晚于To时返回ErrInvalidMessageFilter
+func (s *ChatService) GetMessages(userID, conversationID uint, opts MessageListOptions, page, pageSize int) ([]model.Message, int64, error) {
+	if err := opts.validate(); err != nil {
+		return nil, 0, err
+	}
+
 	// 验证会话是否属于用户
 	var conversation model.Conversation
 	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
 		return nil, 0, err
 	}
 
+	if conversation.Incognito {
+		return s.getIncognitoMessages(context.Background(), conversationID, opts, page, pageSize)
+	}
+
 	var messages []model.Message
 	var total int64
 
-	query := s.db.Where("conversation_id = ?", conversationID)
+	query := opts.apply(s.db.Where("conversation_id = ?", conversationID))
+	if opts.Contains != "" {
+		return s.getMatchingMessages(query, opts.Contains, page, pageSize)
+	}
 
 	// 获取总数
 	if err := query.Model(&model.Message{}).Count(&total).Error; err != nil {
@@ -124,38 +884,206 @@ func (s *ChatService) GetMessages(userID, conversationID uint, page, pageSize in
 
 	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := query.Order("created_at ASC").Offset(offset).Limit(pageSize).Find(&messages).Error; err != nil {
+	if err := query.Preload("Attachments").Order("created_at ASC, id ASC").Offset(offset).Limit(pageSize).Find(&messages).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return messages, total, nil
 }
 
-// SendMessage 发送消息并获取AI回复
-func (s *ChatService) SendMessage(ctx context.Context, userID, conversationID uint, req *SendMessageRequest) (*model.Message, *model.Message, error) {
-	// 验证会话是否属于用户
-	var conversation model.Conversation
-	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
-		return nil, nil, err
+// getMatchingMessages 按关键词筛选时，压缩的消息需解压后比较，先筛出全部匹配的ID再分页读取
+func (s *ChatService) getMatchingMessages(query *gorm.DB, keyword string, page, pageSize int) ([]model.Message, int64, error) {
+	ids, err := matchMessageIDs(query.Model(&model.Message{}).Order("created_at ASC, id ASC"), "", keyword, 0)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// 保存用户消息
-	userMessage := model.Message{
-		ConversationID: conversationID,
-		Role:           "user",
-		Content:        req.Content,
+	total := int64(len(ids))
+	offset := int64((page - 1) * pageSize)
+	if offset >= total {
+		return []model.Message{}, total, nil
 	}
-	if err := s.db.Create(&userMessage).Error; err != nil {
-		return nil, nil, err
+
+	var messages []model.Message
+	ids = ids[offset:min(offset+int64(pageSize), total)]
+	if err := s.db.Preload("Attachments").Where("id IN ?", ids).Order("created_at ASC, id ASC").Find(&messages).Error; err != nil {
+		return nil, 0, err
 	}
+	return messages, total, nil
+}
 
-	// 获取历史消息用于AI上下文
+// SearchMessages 按关键词搜索用户的消息（无痕会话的消息不落库，不在搜索范围内），按时间倒序返回。
+// conversationID为0时搜索全部会话
+func (s *ChatService) SearchMessages(userID uint, keyword string, conversationID uint, limit int) ([]model.Message, error) {
+	escaped := likeEscaper.Replace(keyword)
+	query := s.db.Model(&model.Message{}).
+		Joins("JOIN conversations ON conversations.id = messages.conversation_id AND conversations.deleted_at IS NULL").
+		Where("conversations.user_id = ? AND messages.role IN ?", userID, []string{"user", "assistant"}).
+		Where(containsCondition("messages."), "%"+escaped+"%")
+	if conversationID != 0 {
+		query = query.Where("messages.conversation_id = ?", conversationID)
+	}
+
+	ids, err := matchMessageIDs(query.Order("messages.id DESC"), "messages.", keyword, limit)
+	if err != nil || len(ids) == 0 {
+		return []model.Message{}, err
+	}
+
+	var messages []model.Message
+	err = s.db.Where("id IN ?", ids).Order("id DESC").Find(&messages).Error
+	return messages, err
+}
+
+// getIncognitoMessages 从Redis分页读取无痕会话消息，有筛选条件时读取全部消息后在内存中筛选
+func (s *ChatService) getIncognitoMessages(ctx context.Context, conversationID uint, opts MessageListOptions, page, pageSize int) ([]model.Message, int64, error) {
+	if s.incognito == nil {
+		return nil, 0, ErrIncognitoUnavailable
+	}
+
+	start := int64((page - 1) * pageSize)
+	if opts.filtered() {
+		all, err := s.incognito.Range(ctx, conversationID, 0, -1)
+		if err != nil {
+			return nil, 0, err
+		}
+		matched := make([]model.Message, 0, len(all))
+		for i := range all {
+			if opts.match(&all[i]) {
+				matched = append(matched, all[i])
+			}
+		}
+		total := int64(len(matched))
+		if start >= total {
+			return []model.Message{}, total, nil
+		}
+		return matched[start:min(start+int64(pageSize), total)], total, nil
+	}
+
+	total, err := s.incognito.Count(ctx, conversationID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	messages, err := s.incognito.Range(ctx, conversationID, start, start+int64(pageSize)-1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return messages, total, nil
+}
+
+// saveMessage 保存消息，无痕会话的消息写入Redis
+func (s *ChatService) saveMessage(ctx context.Context, conversation *model.Conversation, msg *model.Message) error {
+	if conversation.Incognito {
+		if s.incognito == nil {
+			return ErrIncognitoUnavailable
+		}
+		if err := s.incognito.Append(ctx, msg); err != nil {
+			return err
+		}
+		// 无痕会话的消息不落库，但会话本身在列表中仍按活跃时间排序
+		return touchConversation(s.db, conversation.ID, msg.CreatedAt)
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		if err := touchConversation(tx, conversation.ID, msg.CreatedAt); err != nil {
+			return err
+		}
+		return incrementUserCounter(tx, conversation.UserID, "message_count", 1)
+	})
+	if err != nil {
+		return err
+	}
+	s.appendHistory(ctx, msg)
+
+	s.bus.Publish(ctx, events.New(events.MessageCreated, conversation.UserID, events.MessagePayload{
+		ConversationID:    conversation.ID,
+		ConversationTitle: conversation.Title,
+		MessageID:         msg.ID,
+		Role:              msg.Role,
+		ContentLength:     len(msg.Content),
+		Preview:           messagePreview(msg.Content),
+	}))
+	return nil
+}
+
+// messagePreview 截取消息开头用于会话列表预览
+func messagePreview(content string) string {
+	content = strings.TrimSpace(content)
+	if utf8.RuneCountInString(content) <= messagePreviewLength {
+		return content
+	}
+	return string([]rune(content)[:messagePreviewLength]) + "…"
+}
+
+// touchConversation 更新会话的最后活跃时间并取消归档，不更新updated_at
+func touchConversation(tx *gorm.DB, conversationID uint, at time.Time) error {
+	return tx.Model(&model.Conversation{}).Where("id = ?", conversationID).
+		UpdateColumns(map[string]interface{}{
+			"last_message_at": at,
+			"archived_at":     nil,
+		}).Error
+}
+
+// saveUserMessage 保存用户消息并计入当天用量，使用自带Key时不计入套餐用量
+func (s *ChatService) saveUserMessage(ctx context.Context, conversation *model.Conversation, msg *model.Message, gen *generator) error {
+	if err := s.saveMessage(ctx, conversation, msg); err != nil {
+		return err
+	}
+	if gen.byok {
+		return nil
+	}
+	if err := s.planService.RecordMessage(conversation.UserID); err != nil {
+		log.Printf("Failed to record message usage for user %d: %v", conversation.UserID, err)
+	}
+	return nil
+}
+
+// loadHistory 获取历史消息用于AI上下文
+func (s *ChatService) loadHistory(ctx context.Context, conversation *model.Conversation) ([]model.Message, error) {
+	if conversation.Incognito {
+		if s.incognito == nil {
+			return nil, ErrIncognitoUnavailable
+		}
+		// 与数据库分支一致取最近的historyLimit条，而不是最早的
+		return s.incognito.Range(ctx, conversation.ID, -historyLimit, -1)
+	}
+
+	// 活跃会话优先从缓存读取
+	var version string
+	cacheable := s.history != nil
+	if cacheable {
+		cached, cachedVersion, err := s.history.Get(ctx, conversation.ID)
+		if err != nil {
+			log.Printf("Failed to read history cache for conversation %d: %v", conversation.ID, err)
+			cacheable = false
+		} else if cached != nil {
+			return cached, nil
+		}
+		version = cachedVersion
+	}
+
+	// 取最近的未压缩消息（含摘要），再按时间正序排列；已移入冷存储或被涂抹的消息以及工具调用结果不进入上下文
 	var historyMessages []model.Message
-	if err := s.db.Where("conversation_id = ?", conversationID).Order("created_at ASC").Limit(20).Find(&historyMessages).Error; err != nil {
-		return nil, nil, err
+	if err := s.db.Where("conversation_id = ? AND role <> ? AND compacted = ? AND cold_archive_id IS NULL AND redacted_at IS NULL", conversation.ID, model.RoleTool, false).
+		Order("created_at DESC, id DESC").Limit(historyLimit).Find(&historyMessages).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(historyMessages)-1; i < j; i, j = i+1, j-1 {
+		historyMessages[i], historyMessages[j] = historyMessages[j], historyMessages[i]
+	}
+	if cacheable {
+		if err := s.history.Set(ctx, conversation.ID, version, historyMessages); err != nil {
+			log.Printf("Failed to cache history for conversation %d: %v", conversation.ID, err)
+		}
 	}
+	return historyMessages, nil
+}
 
-	// 转换为AI模型格式
+// toSchemaMessages 将历史消息转换为AI模型上下文
+func toSchemaMessages(historyMessages []model.Message) []*schema.Message {
 	aiMessages := make([]*schema.Message, len(historyMessages))
 	for i, msg := range historyMessages {
 		var role schema.RoleType
@@ -166,117 +1094,490 @@ func (s *ChatService) SendMessage(ctx context.Context, userID, conversationID ui
 			role = schema.Assistant
 		case "system":
 			role = schema.System
+		case model.RoleSummary:
+			aiMessages[i] = schema.SystemMessage(summaryPrefix + msg.Content)
+			continue
 		default:
 			role = schema.User
 		}
+		content := msg.Content
+		if msg.AttachmentText != "" {
+			content += "\n\n" + msg.AttachmentText
+		}
 		aiMessages[i] = &schema.Message{
 			Role:    role,
-			Content: msg.Content,
+			Content: content,
+		}
+	}
+	return aiMessages
+}
+
+// publishConversationEvent 发布会话事件，无痕会话不发布
+func (s *ChatService) publishConversationEvent(conversation *model.Conversation, eventType string) {
+	if conversation.Incognito {
+		return
+	}
+	s.bus.Publish(context.Background(), events.New(eventType, conversation.UserID, events.ConversationPayload{
+		ConversationID: conversation.ID,
+		Title:          conversation.Title,
+	}))
+}
+
+// CheckMessageLength 检查用户消息是否超过本次生成所用模型允许的token数，流式接口需在开始推送前调用。
+// modelName为消息指定的服务端模型，为空时使用会话选用的模型
+func (s *ChatService) CheckMessageLength(userID, conversationID uint, modelName, content string) error {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return err
+	}
+	return s.checkMessageLength(userID, &conversation, modelName, content)
+}
+
+// checkMessageLength 按与生成时相同的优先级（组织模型服务、自带Key、消息或会话选用的模型）确定模型，
+// 以tokenizer估算消息的token数，与该模型的上下文窗口扣除输出上限后的部分比较
+func (s *ChatService) checkMessageLength(userID uint, conversation *model.Conversation, modelName, content string) error {
+	gen, err := s.selectGenerator(userID, conversation, modelFor(conversation, &SendMessageRequest{Model: modelName}))
+	if err != nil {
+		return err
+	}
+	limit := gen.ai.MaxInputTokens(s.maxOutputTokens(userID, conversation))
+	if length := tokenizer.Count(content); length > limit {
+		return &MessageTooLongError{Length: length, Limit: limit}
+	}
+	return nil
+}
+
+// CheckSecrets 配置为拒绝含凭据的消息时检查消息内容，流式接口需在开始推送前调用
+func (s *ChatService) CheckSecrets(content string) error {
+	return s.secrets.check(content)
+}
+
+// newUserMessage 构造待保存的用户消息，其中的凭据替换为占位并记录类型，替换后的内容才会发给模型
+func (s *ChatService) newUserMessage(conversationID uint, content string) model.Message {
+	content, types := s.secrets.redact(content)
+	return model.Message{
+		ConversationID: conversationID,
+		Role:           "user",
+		Content:        content,
+		SecretTypes:    strings.Join(types, ","),
+	}
+}
+
+// generator 本次生成使用的模型
+type generator struct {
+	ai *AIService
+	// byok 使用用户自带的Key或组织的模型服务：不检查套餐额度、不扣减额度
+	byok bool
+	// endpointID 使用的组织模型服务
+	endpointID *uint
+	// region 用户所属的数据区域，辅助的模型调用（如注入检测分类）使用该区域的服务
+	region string
+	// canaryID 使用灰度模型时对应的灰度发布，baseModel为被替换的服务端模型，套餐按该模型检查
+	canaryID  *uint
+	baseModel string
+	// fallback 使用选用的模型时，模型服务出错后改用的默认模型，为nil时不重试
+	fallback *AIService
+	// temperature 会话设置的采样温度，为nil时使用模型默认值，改用默认模型后同样适用
+	temperature *float32
+}
+
+// options 会话级的模型参数，附加在服务端参数之后
+func (g *generator) options() []einomodel.Option {
+	if g.temperature == nil {
+		return nil
+	}
+	return []einomodel.Option{einomodel.WithTemperature(*g.temperature)}
+}
+
+// fallBack 选用的模型服务出错时改用默认模型，返回是否应重试；之后的生成都使用默认模型
+func (g *generator) fallBack(ctx context.Context, err error) bool {
+	if g.fallback == nil || ctx.Err() != nil {
+		return false
+	}
+	log.Printf("Model %s failed, falling back to %s: %v", g.ai.ModelName(), g.fallback.ModelName(), err)
+	g.ai, g.fallback = g.fallback, nil
+	return true
+}
+
+// resolveGenerator 选择本次生成使用的模型，并带上会话的采样温度
+func (s *ChatService) resolveGenerator(userID uint, conversation *model.Conversation, modelName string) (*generator, error) {
+	gen, err := s.selectGenerator(userID, conversation, modelName)
+	if err != nil {
+		return nil, err
+	}
+	gen.temperature = conversation.Temperature
+	return gen, nil
+}
+
+// selectGenerator 按优先级选择模型：会话选用的组织模型服务、用户自带Key、服务端模型（用户所在区域的模型服务）。
+// modelName为选用的服务端模型（消息或会话指定），为空时使用默认模型并参与灰度；使用组织模型服务和自带Key时忽略
+func (s *ChatService) selectGenerator(userID uint, conversation *model.Conversation, modelName string) (*generator, error) {
+	region, err := userRegion(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.ModelEndpointID != nil && s.orgService != nil {
+		endpoint, err := s.orgService.EndpointForUser(userID, *conversation.ModelEndpointID)
+		if err != nil {
+			return nil, err
+		}
+		ai, err := s.orgService.Client(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return &generator{ai: ai, byok: true, endpointID: &endpoint.ID, region: region}, nil
+	}
+	if s.apiKeyService != nil {
+		ai, err := s.apiKeyService.ForUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		if ai != nil {
+			return &generator{ai: ai, byok: true, region: region}, nil
+		}
+	}
+	ai, err := s.aiService.ForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := s.aiService.ForModel(region, modelName)
+	if err != nil {
+		return nil, err
+	}
+	if selected != ai {
+		gen := &generator{ai: selected, region: region}
+		if s.aiService.Fallback() {
+			gen.fallback = ai
 		}
+		return gen, nil
+	}
+	// 灰度范围内的用户使用区域服务上的新模型
+	canaryAI, canaryID, err := s.canary.route(userID, ai)
+	if err != nil {
+		return nil, err
+	}
+	if canaryAI != nil {
+		return &generator{ai: canaryAI, region: region, canaryID: canaryID, baseModel: ai.ModelName()}, nil
+	}
+	return &generator{ai: ai, region: region}, nil
+}
+
+// recordOutcome 记录服务端模型的生成结果，用于灰度发布的错误率统计
+func (s *ChatService) recordOutcome(gen *generator, err error) {
+	if gen.byok {
+		return
+	}
+	s.canary.record(gen.canaryID, gen.ai.ModelName(), err)
+}
+
+// checkEntitlements 生成前检查套餐额度和额度余额
+func (s *ChatService) checkEntitlements(userID uint, gen *generator) error {
+	if gen.byok {
+		return nil
+	}
+	modelName := gen.ai.ModelName()
+	if gen.canaryID != nil {
+		modelName = gen.baseModel
+	}
+	if err := s.planService.CheckMessage(userID, modelName); err != nil {
+		return err
+	}
+	return s.creditService.CheckBalance(userID)
+}
+
+// CheckQuota 流式生成开始前检查本次生成是否超出套餐额度或余额，使SSE开始前能以HTTP状态码返回。
+// 生成时仍会再次检查
+func (s *ChatService) CheckQuota(userID, conversationID uint, modelName string) error {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return err
+	}
+	gen, err := s.selectGenerator(userID, &conversation, modelFor(&conversation, &SendMessageRequest{Model: modelName}))
+	if err != nil {
+		return err
+	}
+	return s.checkEntitlements(userID, gen)
+}
+
+// generationUsage 本次生成的用量，费用按配置的单价计算
+func (s *ChatService) generationUsage(result *GenerationResult, messages []*schema.Message, content string) StreamUsage {
+	prompt, completion, estimated := result.tokenBreakdown(messages, content)
+	return newUsageMeter(s.streamCfg, nil).usage(prompt, completion, estimated)
+}
+
+// recordGeneration 记录用量明细并按实际用量扣减额度，使用自带Key时只累计用量，组织模型服务由组织自行计费。
+// 只有服务端模型的用量计入套餐的每日token数
+func (s *ChatService) recordGeneration(userID uint, gen *generator, usage StreamUsage, assistantMessage *model.Message) {
+	if gen.endpointID != nil || gen.byok {
+		usage.Cost = 0
+	}
+	s.planService.RecordUsage(userID, assistantMessage.ID, gen.ai.ModelName(), usage)
+	if !gen.byok {
+		if err := s.planService.RecordTokens(userID, usage); err != nil {
+			log.Printf("Failed to record token usage for user %d: %v", userID, err)
+		}
+	}
+	if gen.endpointID != nil {
+		return
+	}
+	if gen.byok {
+		s.apiKeyService.RecordUsage(userID, usage.TotalTokens)
+		return
+	}
+	s.creditService.DebitGeneration(userID, usage.TotalTokens, fmt.Sprintf("message:%d", assistantMessage.ID))
+}
+
+// maxOutputTokens 本次回复的输出上限：会话和用户设置中较小的一个，0表示使用服务端默认值
+func (s *ChatService) maxOutputTokens(userID uint, conversation *model.Conversation) int {
+	limit := conversation.MaxTokens
+	var user model.User
+	if err := s.db.Select("max_output_tokens").Where("id = ?", userID).First(&user).Error; err != nil {
+		return limit
+	}
+	if user.MaxOutputTokens > 0 && (limit <= 0 || user.MaxOutputTokens < limit) {
+		limit = user.MaxOutputTokens
+	}
+	return limit
+}
+
+// ActiveStreams 当前进行中的流式生成数
+func (s *ChatService) ActiveStreams() int64 {
+	return s.activeStreams.Load()
+}
+
+// SendMessage 发送消息并获取AI回复，truncated表示回复因输出上限被截断
+func (s *ChatService) SendMessage(ctx context.Context, userID, conversationID uint, req *SendMessageRequest) (*model.Message, *model.Message, bool, error) {
+	// 验证会话是否属于用户
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := s.checkMessageLength(userID, &conversation, req.Model, req.Content); err != nil {
+		return nil, nil, false, err
+	}
+	if err := s.CheckSecrets(req.Content); err != nil {
+		return nil, nil, false, err
+	}
+
+	attachments, attachmentText, err := s.messageAttachments(ctx, userID, &conversation, req.AttachmentIDs)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	userMessage, assistantMessage, truncated, duplicate, err := s.deduplicate(ctx, &conversation, req, func() (*model.Message, *model.Message, bool, error) {
+		return s.sendMessage(ctx, userID, &conversation, req.Content, attachments, attachmentText, retrievalFor(&conversation, req), modelFor(&conversation, req))
+	})
+	if err == nil && !duplicate && assistantMessage != nil && s.autoTitleEnabled(req) {
+		s.maybeGenerateTitle(&conversation, userMessage.Content, assistantMessage.Content)
+	}
+	return userMessage, assistantMessage, truncated, err
+}
+
+// sendMessage 保存用户消息并生成回复
+func (s *ChatService) sendMessage(ctx context.Context, userID uint, conversation *model.Conversation, content string, attachments []model.Attachment, attachmentText string, retrieval retrievalOptions, modelName string) (*model.Message, *model.Message, bool, error) {
+	gen, err := s.resolveGenerator(userID, conversation, modelName)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// 检查套餐额度和余额
+	if err := s.checkEntitlements(userID, gen); err != nil {
+		return nil, nil, false, err
+	}
+
+	// 保存用户消息，凭据已替换为占位
+	userMessage := s.newUserMessage(conversation.ID, content)
+	userMessage.AttachmentText = attachmentText
+	if err := s.saveUserMessage(ctx, conversation, &userMessage, gen); err != nil {
+		return nil, nil, false, err
+	}
+	s.linkAttachments(conversation, &userMessage, attachments)
+
+	// 获取历史消息用于AI上下文
+	historyMessages, err := s.loadHistory(ctx, conversation)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// 会话启用的工具
+	tools, err := s.toolsFor(ctx, userID, conversation)
+	if err != nil {
+		return &userMessage, nil, false, err
 	}
 
-	// 获取AI回复
-	aiResponse, err := s.aiService.GenerateResponse(ctx, aiMessages)
+	// 经流水线获取AI回复，模型调用工具时执行后继续生成
+	output, err := s.runPipeline(ctx, assistantFor(conversation), &pipelineInput{
+		UserID:          userID,
+		Conversation:    conversation,
+		History:         toSchemaMessages(historyMessages),
+		Query:           userMessage.Content,
+		Generator:       gen,
+		Tools:           tools,
+		MaxOutputTokens: s.maxOutputTokens(userID, conversation),
+		Retrieval:       retrieval,
+	})
+	s.recordOutcome(gen, err)
 	if err != nil {
-		return &userMessage, nil, err
+		return &userMessage, nil, false, err
 	}
+	aiResponse := output.Content
 
 	// 保存AI回复
 	assistantMessage := model.Message{
-		ConversationID: conversationID,
+		ConversationID: conversation.ID,
 		Role:           "assistant",
 		Content:        aiResponse,
+		PromptVersions: output.PromptVersions,
+		CanaryID:       gen.canaryID,
+		SourcesUsed:    output.SourcesUsed,
+		Model:          gen.ai.ModelName(),
 	}
-	if err := s.db.Create(&assistantMessage).Error; err != nil {
-		return &userMessage, nil, err
+	if err := s.saveMessage(ctx, conversation, &assistantMessage); err != nil {
+		return &userMessage, nil, false, err
 	}
+	s.attachTrace(output.TraceID, assistantMessage.ID)
 
-	// 更新会话的更新时间
-	s.db.Model(&conversation).Update("updated_at", assistantMessage.CreatedAt)
+	// 按实际用量扣减额度
+	s.recordGeneration(userID, gen, s.generationUsage(output.Result, output.Messages, aiResponse), &assistantMessage)
+	s.maybeCompact(conversation)
 
-	return &userMessage, &assistantMessage, nil
+	return &userMessage, &assistantMessage, output.Result.Truncated(), nil
 }
 
-// StreamChat 流式聊天
-func (s *ChatService) StreamChat(ctx context.Context, userID, conversationID uint, content string, callback func(string) error) (*model.Message, error) {
+// StreamChat 流式聊天，onUsage不为nil时按配置的间隔推送预估用量，结束后返回是否截断和最终用量
+func (s *ChatService) StreamChat(ctx context.Context, userID, conversationID uint, req *SendMessageRequest, callback func(string) error, onUsage func(StreamUsage) error) (*model.Message, *StreamResult, error) {
+	s.activeStreams.Add(1)
+	defer s.activeStreams.Add(-1)
+
 	// 验证会话是否属于用户
 	var conversation model.Conversation
 	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// 保存用户消息
-	userMessage := model.Message{
-		ConversationID: conversationID,
-		Role:           "user",
-		Content:        content,
+	if err := s.checkMessageLength(userID, &conversation, req.Model, req.Content); err != nil {
+		return nil, nil, err
 	}
-	if err := s.db.Create(&userMessage).Error; err != nil {
-		return nil, err
+	if err := s.CheckSecrets(req.Content); err != nil {
+		return nil, nil, err
 	}
-
-	// 获取历史消息
-	var historyMessages []model.Message
-	if err := s.db.Where("conversation_id = ?", conversationID).Order("created_at ASC").Limit(20).Find(&historyMessages).Error; err != nil {
-		return nil, err
+	attachments, attachmentText, err := s.messageAttachments(ctx, userID, &conversation, req.AttachmentIDs)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// 转换为AI模型格式
-	aiMessages := make([]*schema.Message, len(historyMessages))
-	for i, msg := range historyMessages {
-		var role schema.RoleType
-		switch msg.Role {
-		case "user":
-			role = schema.User
-		case "assistant":
-			role = schema.Assistant
-		case "system":
-			role = schema.System
-		default:
-			role = schema.User
+	// 登记本次生成，CancelGeneration取消时保存已生成的部分
+	ctx, done := s.generations.begin(ctx, userID, conversation.ID)
+	defer done()
+
+	meter := newUsageMeter(s.streamCfg, onUsage)
+	userMessage, assistantMessage, truncated, duplicate, err := s.deduplicate(ctx, &conversation, req, func() (*model.Message, *model.Message, bool, error) {
+		return s.streamChat(ctx, userID, &conversation, req.Content, attachments, attachmentText, retrievalFor(&conversation, req), modelFor(&conversation, req), callback, meter)
+	})
+	cancelled := generationCancelled(ctx)
+	if err != nil {
+		if cancelled {
+			err = ErrGenerationCancelled
 		}
-		aiMessages[i] = &schema.Message{
-			Role:    role,
-			Content: msg.Content,
+		return userMessage, nil, err
+	}
+	// 重复的请求一次推送原回复的全部内容
+	if duplicate && assistantMessage != nil {
+		if err := callback(assistantMessage.Content); err != nil {
+			return userMessage, nil, err
+		}
+	}
+	result := &StreamResult{Truncated: truncated, Usage: meter.final, Cancelled: cancelled}
+	if assistantMessage != nil {
+		result.SourcesUsed = assistantMessage.SourcesUsed
+		if !duplicate && !cancelled && s.autoTitleEnabled(req) {
+			s.maybeGenerateTitle(&conversation, userMessage.Content, assistantMessage.Content)
 		}
 	}
+	return userMessage, result, nil
+}
 
-	// 流式获取AI回复
-	respChan, errorChan := s.aiService.StreamResponse(ctx, aiMessages)
-	var fullResponse string
+// streamChat 保存用户消息并流式生成回复
+func (s *ChatService) streamChat(ctx context.Context, userID uint, conversation *model.Conversation, content string, attachments []model.Attachment, attachmentText string, retrieval retrievalOptions, modelName string, callback func(string) error, meter *usageMeter) (*model.Message, *model.Message, bool, error) {
+	gen, err := s.resolveGenerator(userID, conversation, modelName)
+	if err != nil {
+		return nil, nil, false, err
+	}
 
-	for {
-		select {
-		case chunk, ok := <-respChan:
-			if !ok {
-				// 通道关闭，流式响应结束
-				goto StreamEnd
-			}
-			fullResponse += chunk
-			if err := callback(chunk); err != nil {
-				return &userMessage, err
-			}
-		case err := <-errorChan:
-			if err != nil {
-				return &userMessage, err
-			}
-		}
+	// 检查套餐额度和余额
+	if err := s.checkEntitlements(userID, gen); err != nil {
+		return nil, nil, false, err
 	}
 
-StreamEnd:
+	// 保存用户消息，凭据已替换为占位
+	userMessage := s.newUserMessage(conversation.ID, content)
+	userMessage.AttachmentText = attachmentText
+	if err := s.saveUserMessage(ctx, conversation, &userMessage, gen); err != nil {
+		return nil, nil, false, err
+	}
+	s.linkAttachments(conversation, &userMessage, attachments)
+
+	// 获取历史消息
+	historyMessages, err := s.loadHistory(ctx, conversation)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// 会话启用的工具
+	tools, err := s.toolsFor(ctx, userID, conversation)
+	if err != nil {
+		return &userMessage, nil, false, err
+	}
+
+	// 记录已推送的内容，生成被取消时保存为回复
+	var partial strings.Builder
+	collect := func(chunk string) error {
+		partial.WriteString(chunk)
+		return callback(chunk)
+	}
+
+	// 经流水线流式获取AI回复，模型调用工具时执行后继续生成
+	output, err := s.runPipeline(ctx, assistantFor(conversation), &pipelineInput{
+		UserID:          userID,
+		Conversation:    conversation,
+		History:         toSchemaMessages(historyMessages),
+		Query:           userMessage.Content,
+		Generator:       gen,
+		Tools:           tools,
+		MaxOutputTokens: s.maxOutputTokens(userID, conversation),
+		Callback:        collect,
+		Meter:           meter,
+		Retrieval:       retrieval,
+	})
+	if err != nil && generationCancelled(ctx) {
+		return s.saveCancelled(ctx, userID, conversation, &userMessage, gen, partial.String(), meter)
+	}
+	s.recordOutcome(gen, err)
+	if err != nil {
+		return &userMessage, nil, false, err
+	}
+	meter.finish(output.Result.Usage)
+	fullResponse := output.Content
 
 	// 保存完整的AI回复
 	assistantMessage := model.Message{
-		ConversationID: conversationID,
+		ConversationID: conversation.ID,
 		Role:           "assistant",
 		Content:        fullResponse,
+		PromptVersions: output.PromptVersions,
+		CanaryID:       gen.canaryID,
+		SourcesUsed:    output.SourcesUsed,
+		Model:          gen.ai.ModelName(),
 	}
-	if err := s.db.Create(&assistantMessage).Error; err != nil {
-		return &userMessage, fmt.Errorf("failed to save assistant message: %w", err)
+	if err := s.saveMessage(ctx, conversation, &assistantMessage); err != nil {
+		return &userMessage, nil, false, fmt.Errorf("failed to save assistant message: %w", err)
 	}
+	s.attachTrace(output.TraceID, assistantMessage.ID)
 
-	// 更新会话的更新时间
-	s.db.Model(&conversation).Update("updated_at", assistantMessage.CreatedAt)
+	// 按实际用量扣减额度
+	s.recordGeneration(userID, gen, s.generationUsage(output.Result, output.Messages, assistantMessage.Content), &assistantMessage)
+	s.maybeCompact(conversation)
 
-	return &userMessage, nil
-}
\ No newline at end of file
+	return &userMessage, &assistantMessage, output.Result.Truncated(), nil
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"ai-chat-backend/internal/extract"
+	"ai-chat-backend/internal/model"
+)
+
+// recursiveSeparators 递归切分依次使用的分隔符：段落、行、句子、词，都不适用时按字符切分
+var recursiveSeparators = []string{"\n\n", "\n", "。", ". ", "！", "？", "; ", "；", " "}
+
+// markdownSeparators 章节内先在代码块和列表项之间切分，再按段落、行、句子切分
+var markdownSeparators = append([]string{"\n```", "\n- ", "\n* "}, recursiveSeparators...)
+
+// codeSeparators 代码先在空行分隔的顶层声明之间切分，再在缩进的块之间、行之间切分
+var codeSeparators = []string{
+	"\n\n\n", "\nfunc ", "\ntype ", "\nclass ", "\ndef ", "\nasync def ", "\nfunction ", "\nexport ",
+	"\npublic ", "\nprivate ", "\nprotected ", "\nfn ", "\nimpl ", "\n\n", "\n", " ",
+}
+
+// markdownHeading Markdown标题行，分组为表示级别的#
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+\S`)
+
+// chunk 切分出的文档块
+type chunk struct {
+	Page    int
+	Kind    string
+	Content string
+}
+
+// chunker 将提取出的内容块按splitter切分为不超过size个字符的分块，相邻分块重叠overlap个字符
+type chunker struct {
+	size     int
+	overlap  int
+	splitter string
+}
+
+func newChunker(size, overlap int, splitter string) chunker {
+	if size <= 0 {
+		size = 1000
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	switch splitter {
+	case model.SplitterMarkdown, model.SplitterCode:
+	default:
+		splitter = model.SplitterRecursive
+	}
+	return chunker{size: size, overlap: overlap, splitter: splitter}
+}
+
+// settings 分块设置的摘要，记录在文档上用于判断是否需要重新索引
+func (c chunker) settings() string {
+	return fmt.Sprintf("%s:%d:%d", c.splitter, c.size, c.overlap)
+}
+
+// separators 分块方式对应的分隔符
+func (c chunker) separators() []string {
+	switch c.splitter {
+	case model.SplitterMarkdown:
+		return markdownSeparators
+	case model.SplitterCode:
+		return codeSeparators
+	}
+	return recursiveSeparators
+}
+
+// chunkBlocks 逐块切分：正文递归切分，表格按行切分且每个分块都带表头
+func (c chunker) chunkBlocks(blocks []extract.Block) []chunk {
+	var chunks []chunk
+	for _, block := range blocks {
+		var contents []string
+		kind := model.ChunkText
+		if block.Kind == extract.KindTable {
+			kind = model.ChunkTable
+			contents = c.splitTable(block.Text)
+		} else {
+			contents = c.split(block.Text)
+		}
+		for _, content := range contents {
+			chunks = append(chunks, chunk{Page: block.Page, Kind: kind, Content: content})
+		}
+	}
+	return chunks
+}
+
+// split 先按分隔符递归切分为不超过size的片段，再合并为分块
+func (c chunker) split(text string) []string {
+	if c.splitter == model.SplitterMarkdown {
+		return c.splitMarkdown(text)
+	}
+	return c.merge(c.pieces(text, c.separators()), c.overlap)
+}
+
+// splitMarkdown 按标题切分章节（忽略代码块中的#），章节分别切分，每个分块以所在章节的各级标题开头
+func (c chunker) splitMarkdown(text string) []string {
+	var chunks []string
+	var headings, body []string
+	emit := func() {
+		content := strings.TrimSpace(strings.Join(body, "\n"))
+		body = nil
+		if content == "" {
+			return
+		}
+		trail := strings.Join(headings, "\n")
+		if trail == "" {
+			chunks = append(chunks, c.merge(c.pieces(content, markdownSeparators), c.overlap)...)
+			return
+		}
+		// 标题计入分块长度，标题过长时正文至少保留size的一半
+		budget := max(c.size-utf8.RuneCountInString(trail)-2, c.size/2)
+		inner := chunker{size: budget, overlap: min(c.overlap, budget/2), splitter: c.splitter}
+		for _, content := range inner.merge(inner.pieces(content, markdownSeparators), inner.overlap) {
+			chunks = append(chunks, trail+"\n\n"+content)
+		}
+	}
+
+	fenced := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		match := markdownHeading.FindStringSubmatch(trimmed)
+		if fenced || match == nil {
+			body = append(body, line)
+			continue
+		}
+		emit()
+		level := len(match[1])
+		for len(headings) > 0 && headingLevel(headings[len(headings)-1]) >= level {
+			headings = headings[:len(headings)-1]
+		}
+		headings = append(headings, trimmed)
+	}
+	emit()
+	return chunks
+}
+
+// headingLevel 标题行的级别（#的个数）
+func headingLevel(heading string) int {
+	return len(heading) - len(strings.TrimLeft(heading, "#"))
+}
+
+// pieces 文本超过size时按第一个出现的分隔符切分（保留分隔符），片段仍过长时使用下一级分隔符
+func (c chunker) pieces(text string, separators []string) []string {
+	if utf8.RuneCountInString(text) <= c.size {
+		return []string{text}
+	}
+	if len(separators) == 0 {
+		runes := []rune(text)
+		var pieces []string
+		for i := 0; i < len(runes); i += c.size {
+			pieces = append(pieces, string(runes[i:min(i+c.size, len(runes))]))
+		}
+		return pieces
+	}
+	if !strings.Contains(text, separators[0]) {
+		return c.pieces(text, separators[1:])
+	}
+	var pieces []string
+	for _, part := range splitKeep(text, separators[0]) {
+		if part != "" {
+			pieces = append(pieces, c.pieces(part, separators[1:])...)
+		}
+	}
+	return pieces
+}
+
+// merge 依次合并片段，超过size时输出分块，下一分块以上一分块末尾不超过overlap个字符的片段开头
+func (c chunker) merge(pieces []string, overlap int) []string {
+	var chunks []string
+	var current []string
+	length := 0
+	emit := func() {
+		if content := strings.TrimSpace(strings.Join(current, "")); content != "" {
+			chunks = append(chunks, content)
+		}
+	}
+	for _, piece := range pieces {
+		n := utf8.RuneCountInString(piece)
+		if length+n > c.size && len(current) > 0 {
+			emit()
+			for len(current) > 0 && (length > overlap || length+n > c.size) {
+				length -= utf8.RuneCountInString(current[0])
+				current = current[1:]
+			}
+		}
+		current = append(current, piece)
+		length += n
+	}
+	if len(current) > 0 {
+		emit()
+	}
+	return chunks
+}
+
+// splitTable 表格不超过size时作为一个分块，否则按行切分，每个分块以表头（前两行）开头，不重叠
+func (c chunker) splitTable(table string) []string {
+	if utf8.RuneCountInString(table) <= c.size {
+		return []string{table}
+	}
+	lines := strings.SplitAfter(table, "\n")
+	if len(lines) <= 2 {
+		return c.split(table)
+	}
+	header := strings.Join(lines[:2], "")
+	inner := chunker{size: max(c.size-utf8.RuneCountInString(header), 1), splitter: c.splitter}
+	var chunks []string
+	for _, rows := range inner.merge(inner.rowPieces(lines[2:]), 0) {
+		chunks = append(chunks, header+rows)
+	}
+	return chunks
+}
+
+// rowPieces 表格行作为片段，单行过长时按字符切分
+func (c chunker) rowPieces(rows []string) []string {
+	var pieces []string
+	for _, row := range rows {
+		pieces = append(pieces, c.pieces(row, nil)...)
+	}
+	return pieces
+}
+
+// splitKeep 按分隔符切分并保留分隔符。以换行开头的关键字分隔符（如"\nfunc "）在关键字之前切分，
+// 换行留在前一片段末尾，其余分隔符留在前一片段末尾
+func splitKeep(text, separator string) []string {
+	if !strings.HasPrefix(separator, "\n") || strings.TrimSpace(separator) == "" {
+		return strings.SplitAfter(text, separator)
+	}
+	parts := strings.Split(text, separator)
+	for i := range parts {
+		if i > 0 {
+			parts[i] = separator[1:] + parts[i]
+		}
+		if i < len(parts)-1 {
+			parts[i] += "\n"
+		}
+	}
+	return parts
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/cache"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/storage"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrColdStorageDisabled = errors.New("cold storage is not configured")
+
+// errConversationActive 归档期间会话收到了新消息，放弃本批次
+var errConversationActive = errors.New("conversation became active during archiving")
+
+const (
+	// coldStorageBatch 每个归档对象最多包含的消息数
+	coldStorageBatch = 1000
+	// coldStorageConversations 每次任务最多处理的会话数
+	coldStorageConversations = 100
+)
+
+// coldMessage 归档对象中的一条消息，只移出内容，其余字段保留在消息记录中
+type coldMessage struct {
+	ID      uint   `json:"id"`
+	Content string `json:"content"`
+}
+
+// ColdStorageService 将早于阈值的消息内容移入对象存储，用户打开旧会话时按需恢复
+type ColdStorageService struct {
+	db      *gorm.DB
+	store   storage.Store
+	days    int
+	history *cache.HistoryCache
+}
+
+// NewColdStorageService store为nil时不归档，已归档的消息也无法恢复
+func NewColdStorageService(db *gorm.DB, store storage.Store, days int) *ColdStorageService {
+	return &ColdStorageService{db: db, store: store, days: days}
+}
+
+// UseHistoryCache 归档和恢复消息后使会话的上下文缓存失效
+func (s *ColdStorageService) UseHistoryCache(history *cache.HistoryCache) {
+	s.history = history
+}
+
+// Start 按interval定期归档，interval<=0、未配置对象存储或阈值时不启动，paused返回true时跳过本轮。返回停止函数
+func (s *ColdStorageService) Start(interval time.Duration, paused func() bool) func() {
+	if interval <= 0 || s.store == nil || s.days <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				archived, err := s.ArchiveOld(context.Background())
+				if err != nil {
+					log.Printf("Failed to move messages to cold storage: %v", err)
+					continue
+				}
+				if archived > 0 {
+					log.Printf("Moved %d messages to cold storage", archived)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// ArchiveOld 将空闲会话中早于阈值的消息内容按会话分批写入对象存储，返回移出的消息数。
+// 只归档最后一条消息也早于阈值的会话：已归档的消息不作为上下文，活跃会话归档后会丢失前文。
+// 最近恢复过的会话在下一个阈值周期内不再归档；同时清理已删除会话的归档对象
+func (s *ColdStorageService) ArchiveOld(ctx context.Context) (int, error) {
+	if s.store == nil || s.days <= 0 {
+		return 0, nil
+	}
+	if err := s.purgeDeleted(ctx); err != nil {
+		log.Printf("Failed to purge cold storage of deleted conversations: %v", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -s.days)
+	var conversationIDs []uint
+	err := s.db.Model(&model.Message{}).Distinct("messages.conversation_id").
+		Joins("JOIN conversations ON conversations.id = messages.conversation_id AND conversations.deleted_at IS NULL AND conversations.incognito = ? AND conversations.last_message_at < ?", false, cutoff).
+		Where("messages.created_at < ? AND messages.cold_archive_id IS NULL AND (messages.content <> '' OR messages.content_encoding <> '')", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM message_archives WHERE message_archives.conversation_id = messages.conversation_id AND message_archives.rehydrated_at > ?)", cutoff).
+		Limit(coldStorageConversations).Pluck("messages.conversation_id", &conversationIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, conversationID := range conversationIDs {
+		for {
+			n, err := s.archiveBatch(ctx, conversationID, cutoff)
+			if err != nil {
+				return total, fmt.Errorf("conversation %d: %w", conversationID, err)
+			}
+			total += n
+			if n < coldStorageBatch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// archiveBatch 归档会话中一批早于cutoff的消息：先写入对象，再在事务中清空内容并记录批次
+func (s *ColdStorageService) archiveBatch(ctx context.Context, conversationID uint, cutoff time.Time) (int, error) {
+	var messages []model.Message
+	if err := s.db.Select("id", "content", "content_encoding", "compressed_content", "created_at").
+		Where("conversation_id = ? AND created_at < ? AND cold_archive_id IS NULL AND (content <> '' OR content_encoding <> '')", conversationID, cutoff).
+		Order("id ASC").Limit(coldStorageBatch).Find(&messages).Error; err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	ids := make([]uint, len(messages))
+	archive := model.MessageArchive{
+		ConversationID: conversationID,
+		MessageCount:   len(messages),
+		FirstMessageAt: messages[0].CreatedAt,
+		LastMessageAt:  messages[0].CreatedAt,
+	}
+	for i, msg := range messages {
+		ids[i] = msg.ID
+		if msg.CreatedAt.Before(archive.FirstMessageAt) {
+			archive.FirstMessageAt = msg.CreatedAt
+		}
+		if msg.CreatedAt.After(archive.LastMessageAt) {
+			archive.LastMessageAt = msg.CreatedAt
+		}
+		if err := encoder.Encode(coldMessage{ID: msg.ID, Content: msg.Content}); err != nil {
+			return 0, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+
+	token, err := utils.GenerateToken(8)
+	if err != nil {
+		return 0, err
+	}
+	archive.ObjectKey = fmt.Sprintf("messages/%d/%s.jsonl.gz", conversationID, token)
+	archive.Bytes = int64(buf.Len())
+	if err := s.store.Put(ctx, archive.ObjectKey, buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定会话并重新确认空闲，期间收到新消息的会话不归档
+		var conversation model.Conversation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "last_message_at").
+			Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+			return err
+		}
+		if !conversation.LastMessageAt.Before(cutoff) {
+			return errConversationActive
+		}
+		if err := tx.Create(&archive).Error; err != nil {
+			return err
+		}
+		// 不更新updated_at：内容没有变化，增量同步的客户端保留已有的内容
+		result := tx.Model(&model.Message{}).Where("id IN ? AND cold_archive_id IS NULL", ids).
+			UpdateColumns(map[string]interface{}{"content": "", "content_encoding": "", "compressed_content": nil, "cold_archive_id": archive.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(ids)) {
+			return errors.New("messages changed during archiving")
+		}
+		return nil
+	})
+	if err != nil {
+		s.deleteObject(ctx, archive.ObjectKey)
+		if errors.Is(err, errConversationActive) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	invalidateHistory(s.history, conversationID)
+	return len(messages), nil
+}
+
+// Rehydrate 恢复会话中已移入冷存储的消息内容，返回恢复的消息数
+func (s *ColdStorageService) Rehydrate(ctx context.Context, userID, conversationID uint) (int, error) {
+	var conversation model.Conversation
+	if err := s.db.Select("id").Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return 0, conversationError(err)
+	}
+
+	var archives []model.MessageArchive
+	if err := s.db.Where("conversation_id = ? AND rehydrated_at IS NULL", conversationID).Order("id ASC").Find(&archives).Error; err != nil {
+		return 0, err
+	}
+	if len(archives) == 0 {
+		return 0, nil
+	}
+	if s.store == nil {
+		return 0, ErrColdStorageDisabled
+	}
+
+	total := 0
+	for i := range archives {
+		n, err := s.rehydrateArchive(ctx, &archives[i])
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// ReadArchived 只读取会话中仍在冷存储的消息内容（消息ID到内容），不写回数据库也不删除对象，
+// 用于匿名访问等不应改变会话存储状态的场景
+func (s *ColdStorageService) ReadArchived(ctx context.Context, conversationID uint) (map[uint]string, error) {
+	var archives []model.MessageArchive
+	if err := s.db.Where("conversation_id = ? AND rehydrated_at IS NULL", conversationID).Order("id ASC").Find(&archives).Error; err != nil {
+		return nil, err
+	}
+	if len(archives) == 0 {
+		return nil, nil
+	}
+	if s.store == nil {
+		return nil, ErrColdStorageDisabled
+	}
+
+	contents := make(map[uint]string)
+	for i := range archives {
+		messages, err := s.readArchive(ctx, &archives[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range messages {
+			contents[msg.ID] = msg.Content
+		}
+	}
+	return contents, nil
+}
+
+// readArchive 读取并解析归档对象
+func (s *ColdStorageService) readArchive(ctx context.Context, archive *model.MessageArchive) ([]coldMessage, error) {
+	data, err := s.store.Get(ctx, archive.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %d: %w", archive.ID, err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive %d: %w", archive.ID, err)
+	}
+	var messages []coldMessage
+	scanner := bufio.NewScanner(gz)
+	// 单条消息可能很长
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg coldMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("invalid archive %d: %w", archive.ID, err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid archive %d: %w", archive.ID, err)
+	}
+	return messages, nil
+}
+
+func (s *ColdStorageService) rehydrateArchive(ctx context.Context, archive *model.MessageArchive) (int, error) {
+	messages, err := s.readArchive(ctx, archive)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 更新updated_at，增量同步的客户端能取回恢复的内容
+		for _, msg := range messages {
+			columns := model.ContentColumns(tx, msg.Content)
+			columns["cold_archive_id"] = nil
+			if err := tx.Model(&model.Message{}).Where("id = ? AND cold_archive_id = ?", msg.ID, archive.ID).
+				Updates(columns).Error; err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		archive.RehydratedAt = &now
+		return tx.Model(archive).Update("rehydrated_at", now).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	invalidateHistory(s.history, archive.ConversationID)
+	s.deleteObject(ctx, archive.ObjectKey)
+	return len(messages), nil
+}
+
+// purgeDeleted 删除已删除会话的归档对象
+func (s *ColdStorageService) purgeDeleted(ctx context.Context) error {
+	var archives []model.MessageArchive
+	if err := s.db.Joins("JOIN conversations ON conversations.id = message_archives.conversation_id").
+		Where("message_archives.rehydrated_at IS NULL AND conversations.deleted_at IS NOT NULL").
+		Limit(coldStorageConversations).Find(&archives).Error; err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		if err := s.store.Delete(ctx, archive.ObjectKey); err != nil {
+			return err
+		}
+		if err := s.db.Delete(&archive).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ColdStorageService) deleteObject(ctx context.Context, key string) {
+	if err := s.store.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete cold storage object %s: %v", key, err)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/storage"
+)
+
+// 只归档空闲会话：仍有新消息的会话保留旧消息的内容，作为上下文不会缺失
+func TestArchiveOldSkipsActiveConversations(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{})
+	s := NewColdStorageService(db, storage.NewFileStore(t.TempDir()), 30)
+
+	old := time.Now().AddDate(0, 0, -60)
+	idle := model.Conversation{UserID: user.ID, Title: "idle", LastMessageAt: old}
+	active := model.Conversation{UserID: user.ID, Title: "active", LastMessageAt: time.Now()}
+	for _, conversation := range []*model.Conversation{&idle, &active} {
+		if err := db.Create(conversation).Error; err != nil {
+			t.Fatal(err)
+		}
+		msg := model.Message{ConversationID: conversation.ID, Role: "user", Content: "old message", CreatedAt: old}
+		if err := db.Create(&msg).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	recent := model.Message{ConversationID: active.ID, Role: "user", Content: "recent message"}
+	if err := db.Create(&recent).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ArchiveOld(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		conversation model.Conversation
+		archived     int64
+	}{
+		{idle, 1},
+		{active, 0},
+	}
+	for _, tt := range tests {
+		var archived int64
+		db.Model(&model.Message{}).Where("conversation_id = ? AND cold_archive_id IS NOT NULL", tt.conversation.ID).Count(&archived)
+		if archived != tt.archived {
+			t.Errorf("%s conversation: %d archived messages, want %d", tt.conversation.Title, archived, tt.archived)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/schema"
+	"gorm.io/gorm"
+)
+
+// summaryPrompt 压缩历史消息时使用的系统提示
+const summaryPrompt = "Summarize the following conversation so that it can replace the original messages as context for continuing it. " +
+	"Keep facts, decisions, open questions, names and code identifiers. Reply in the language of the conversation and output only the summary."
+
+// summaryPrefix 摘要作为上下文发送给模型时的前缀
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// maybeCompact 会话中未压缩的消息超过阈值时，将较早的消息汇总为一条摘要消息并标记为已压缩。
+// 原消息仍可在消息列表中查看，但不再参与上下文组装。在后台执行，同一会话同时只有一个压缩任务
+func (s *ChatService) maybeCompact(conversation *model.Conversation) {
+	if conversation.Incognito || s.compactThreshold <= 0 {
+		return
+	}
+	if _, running := s.compacting.LoadOrStore(conversation.ID, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer s.compacting.Delete(conversation.ID)
+		if err := s.compact(context.Background(), conversation); err != nil {
+			log.Printf("Failed to compact conversation %d: %v", conversation.ID, err)
+		}
+	}()
+}
+
+func (s *ChatService) compact(ctx context.Context, conversation *model.Conversation) error {
+	var messages []model.Message
+	if err := s.db.Where("conversation_id = ? AND role <> ? AND compacted = ? AND cold_archive_id IS NULL AND redacted_at IS NULL", conversation.ID, model.RoleTool, false).
+		Order("created_at ASC, id ASC").Find(&messages).Error; err != nil {
+		return err
+	}
+	if len(messages) <= s.compactThreshold {
+		return nil
+	}
+
+	older := messages[:len(messages)-s.compactKeep]
+	var transcript strings.Builder
+	for _, msg := range older {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+	// 摘要包含会话内容，与会话的回复使用同一模型服务（组织模型服务、自带Key或用户所在区域的服务端模型）
+	gen, err := s.resolveGenerator(conversation.UserID, conversation, conversation.Model)
+	if err != nil {
+		return err
+	}
+	summary, _, err := gen.ai.GenerateResponse(ctx, []*schema.Message{
+		schema.SystemMessage(summaryPrompt),
+		schema.UserMessage(transcript.String()),
+	}, 0)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint, len(older))
+	for i, msg := range older {
+		ids[i] = msg.ID
+	}
+	summaryMessage := model.Message{
+		ConversationID: conversation.ID,
+		Role:           model.RoleSummary,
+		Content:        summary,
+		// 摘要排在被压缩的消息之后、保留的消息之前
+		CreatedAt: older[len(older)-1].CreatedAt,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&summaryMessage).Error; err != nil {
+			return err
+		}
+		// 同时更新updated_at，使增量同步能感知压缩状态变化
+		if err := tx.Model(&model.Message{}).Where("id IN ?", ids).Update("compacted", true).Error; err != nil {
+			return err
+		}
+		return incrementUserCounter(tx, conversation.UserID, "message_count", 1)
+	})
+	if err != nil {
+		return err
+	}
+	invalidateHistory(s.history, conversation.ID)
+	return nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"ai-chat-backend/internal/model"
+)
+
+// keyRecorder 记录模型请求使用的API Key
+type keyRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *keyRecorder) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.keys = append(r.keys, req.Header.Get("Authorization"))
+		r.mu.Unlock()
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (r *keyRecorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.keys) == 0 {
+		return ""
+	}
+	return r.keys[len(r.keys)-1]
+}
+
+// newBYOKChatService 服务端模型和用户自带Key指向同一个模拟服务，按请求的Key区分
+func newBYOKChatService(t *testing.T, reply string) (*ChatService, *model.User, *keyRecorder) {
+	t.Helper()
+	db := newTestDB(t)
+	recorder := &keyRecorder{}
+	ai := newTestAIService(t, recorder.wrap(openAIReply(reply)))
+
+	apiKeys, err := NewAPIKeyService(db, ai, "test-encryption-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, db, model.User{})
+	if _, err := apiKeys.Set(context.Background(), user.ID, &SetAPIKeyRequest{APIKey: "user-key"}); err != nil {
+		t.Fatal(err)
+	}
+	return &ChatService{db: db, aiService: ai, apiKeyService: apiKeys}, user, recorder
+}
+
+// 压缩会话历史时使用会话的模型服务，自带Key的会话内容不发送给服务端模型
+func TestCompactUsesConversationGenerator(t *testing.T) {
+	s, user, recorder := newBYOKChatService(t, "summary of the conversation")
+	s.compactThreshold, s.compactKeep = 3, 1
+
+	conversation := model.Conversation{UserID: user.ID, Title: "compact"}
+	if err := s.db.Create(&conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		msg := model.Message{ConversationID: conversation.ID, Role: "user", Content: fmt.Sprintf("message %d", i)}
+		if err := s.db.Create(&msg).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.compact(context.Background(), &conversation); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorder.last(); got != "Bearer user-key" {
+		t.Fatalf("summary generated with %q, want the user's key", got)
+	}
+
+	var summaries int64
+	s.db.Model(&model.Message{}).Where("conversation_id = ? AND role = ?", conversation.ID, model.RoleSummary).Count(&summaries)
+	if summaries != 1 {
+		t.Fatalf("%d summary messages, want 1", summaries)
+	}
+}
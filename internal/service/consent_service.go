@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type ConsentService struct {
+	db *gorm.DB
+}
+
+func NewConsentService(db *gorm.DB) *ConsentService {
+	return &ConsentService{db: db}
+}
+
+type AcceptConsentRequest struct {
+	TermsVersion   string `json:"terms_version" validate:"required"`
+	PrivacyVersion string `json:"privacy_version" validate:"required"`
+}
+
+// ConsentStatus 用户条款接受状态
+type ConsentStatus struct {
+	TermsVersion           string     `json:"terms_version"`
+	PrivacyVersion         string     `json:"privacy_version"`
+	AcceptedTermsVersion   string     `json:"accepted_terms_version"`
+	AcceptedPrivacyVersion string     `json:"accepted_privacy_version"`
+	AcceptedAt             *time.Time `json:"accepted_at"`
+	RequiresAcceptance     bool       `json:"requires_acceptance"`
+}
+
+// GetStatus 获取用户对当前条款版本的接受状态
+func (s *ConsentService) GetStatus(userID uint) (*ConsentStatus, error) {
+	cfg := config.Load()
+	status := &ConsentStatus{
+		TermsVersion:   cfg.Legal.TermsVersion,
+		PrivacyVersion: cfg.Legal.PrivacyVersion,
+	}
+
+	terms, err := s.latest(userID, model.ConsentDocumentTerms)
+	if err != nil {
+		return nil, err
+	}
+	if terms != nil {
+		status.AcceptedTermsVersion = terms.Version
+		status.AcceptedAt = &terms.AcceptedAt
+	}
+
+	privacy, err := s.latest(userID, model.ConsentDocumentPrivacy)
+	if err != nil {
+		return nil, err
+	}
+	if privacy != nil {
+		status.AcceptedPrivacyVersion = privacy.Version
+		if status.AcceptedAt == nil || privacy.AcceptedAt.After(*status.AcceptedAt) {
+			status.AcceptedAt = &privacy.AcceptedAt
+		}
+	}
+
+	status.RequiresAcceptance = (status.TermsVersion != "" && status.TermsVersion != status.AcceptedTermsVersion) ||
+		(status.PrivacyVersion != "" && status.PrivacyVersion != status.AcceptedPrivacyVersion)
+
+	return status, nil
+}
+
+// Accept 记录用户接受当前版本的服务条款和隐私政策
+func (s *ConsentService) Accept(userID uint, ip string, req *AcceptConsentRequest) error {
+	cfg := config.Load()
+	if req.TermsVersion != cfg.Legal.TermsVersion || req.PrivacyVersion != cfg.Legal.PrivacyVersion {
+		return errors.New("consent version is outdated")
+	}
+
+	now := time.Now()
+	consents := []model.UserConsent{
+		{UserID: userID, Document: model.ConsentDocumentTerms, Version: req.TermsVersion, IP: ip, AcceptedAt: now},
+		{UserID: userID, Document: model.ConsentDocumentPrivacy, Version: req.PrivacyVersion, IP: ip, AcceptedAt: now},
+	}
+	return s.db.Create(&consents).Error
+}
+
+// AcceptCurrent 按当前配置的版本记录接受，用于注册时一并同意条款
+func (s *ConsentService) AcceptCurrent(userID uint, ip string) error {
+	cfg := config.Load()
+	return s.Accept(userID, ip, &AcceptConsentRequest{
+		TermsVersion:   cfg.Legal.TermsVersion,
+		PrivacyVersion: cfg.Legal.PrivacyVersion,
+	})
+}
+
+// RequiresAcceptance 用户是否需要（重新）接受条款
+func (s *ConsentService) RequiresAcceptance(userID uint) (bool, error) {
+	cfg := config.Load()
+	if cfg.Legal.TermsVersion == "" && cfg.Legal.PrivacyVersion == "" {
+		return false, nil
+	}
+
+	status, err := s.GetStatus(userID)
+	if err != nil {
+		return false, err
+	}
+	return status.RequiresAcceptance, nil
+}
+
+func (s *ConsentService) latest(userID uint, document string) (*model.UserConsent, error) {
+	var consent model.UserConsent
+	err := s.db.Where("user_id = ? AND document = ?", userID, document).Order("accepted_at DESC").First(&consent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// counterReconcileBatch 每批校正的用户数，避免长时间锁表
+const counterReconcileBatch = 500
+
+// incrementUserCounter 原子地调整用户计数字段，不更新updated_at
+func incrementUserCounter(tx *gorm.DB, userID uint, column string, delta int64) error {
+	return tx.Model(&model.User{}).Where("id = ?", userID).
+		UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+// CounterService 按实际数据校正用户的会话/消息计数。
+// 计数在写入时原子递增，进程崩溃或手动改库可能导致偏差，由定期校正兜底
+type CounterService struct {
+	db *gorm.DB
+}
+
+func NewCounterService(db *gorm.DB) *CounterService {
+	return &CounterService{db: db}
+}
+
+// Reconcile 重新统计所有用户的计数，返回被修正的用户数
+func (s *CounterService) Reconcile() (int64, error) {
+	var corrected int64
+	var lastID uint
+	for {
+		var ids []uint
+		if err := s.db.Model(&model.User{}).Where("id > ?", lastID).Order("id ASC").
+			Limit(counterReconcileBatch).Pluck("id", &ids).Error; err != nil {
+			return corrected, err
+		}
+		if len(ids) == 0 {
+			return corrected, nil
+		}
+
+		result := s.db.Exec(`UPDATE users SET
+			conversation_count = (SELECT COUNT(*) FROM conversations c
+				WHERE c.user_id = users.id AND c.deleted_at IS NULL),
+			message_count = (SELECT COUNT(*) FROM messages m JOIN conversations c ON c.id = m.conversation_id
+				WHERE c.user_id = users.id AND c.deleted_at IS NULL AND m.deleted_at IS NULL)
+			WHERE id IN ?`, ids)
+		if result.Error != nil {
+			return corrected, result.Error
+		}
+		// MySQL只统计值发生变化的行
+		corrected += result.RowsAffected
+		lastID = ids[len(ids)-1]
+	}
+}
+
+// Start 按间隔定期校正计数，paused返回true时跳过本轮（如只读模式），返回停止函数
+func (s *CounterService) Start(interval time.Duration, paused func() bool) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				corrected, err := s.Reconcile()
+				if err != nil {
+					log.Printf("Failed to reconcile user counters: %v", err)
+					continue
+				}
+				if corrected > 0 {
+					log.Printf("Reconciled counters for %d users", corrected)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"ai-chat-backend/internal/extract"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// documentCrawlJobType 网页文档重新抓取任务的类型
+	documentCrawlJobType = "document_crawl"
+	// crawlCheckInterval 检查到期网页文档的间隔，crawlBatchSize为每次最多加入队列的文档数
+	crawlCheckInterval = 5 * time.Minute
+	crawlBatchSize     = 100
+	// maxCrawlRedirects 抓取时最多跟随的重定向次数
+	maxCrawlRedirects = 5
+	crawlUserAgent    = "ai-chat-backend-crawler/1.0"
+)
+
+var (
+	ErrDocumentNotCrawlable = errors.New("document was not added from a URL")
+	ErrCrawlTooLarge        = errors.New("page exceeds the maximum crawl size")
+)
+
+// crawledPage 抓取到的网页，notModified表示服务端按ETag/Last-Modified返回了304
+type crawledPage struct {
+	data         []byte
+	contentType  string
+	etag         string
+	lastModified string
+	hash         string
+	notModified  bool
+}
+
+// newCrawlClient 抓取网页的HTTP客户端，与webhook一样在建立连接前拒绝内网地址，重定向后的地址同样检查
+func newCrawlClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: denyPrivateAddress,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxCrawlRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to unsupported scheme")
+			}
+			return nil
+		},
+	}
+}
+
+// addURLDocument 将网页加入知识库，抓取和提取在后台进行，之后每隔CrawlInterval重新抓取
+func (s *KnowledgeService) addURLDocument(userID, collectionID uint, rawURL string) (*model.Document, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrDocumentUnsupported
+	}
+	document := model.Document{
+		UserID:       userID,
+		CollectionID: collectionID,
+		Title:        truncateRunes(parsed.String(), 255),
+		SourceURL:    parsed.String(),
+		Status:       model.DocumentPending,
+		NextCrawlAt:  s.nextCrawl(time.Now()),
+	}
+	if err := s.db.Create(&document).Error; err != nil {
+		return nil, err
+	}
+	if err := s.enqueueIngest(&document); err != nil {
+		s.db.Delete(&document)
+		return nil, err
+	}
+	return &document, nil
+}
+
+// RecrawlDocument 立即重新抓取网页文档，内容未变化时不重新索引
+func (s *KnowledgeService) RecrawlDocument(userID, documentID uint) error {
+	document, err := s.document(userID, documentID, true)
+	if err != nil {
+		return err
+	}
+	if document.SourceURL == "" {
+		return ErrDocumentNotCrawlable
+	}
+	return s.enqueueCrawl(document.UserID, document.ID)
+}
+
+// Start 定期将到期的网页文档加入重新抓取队列，返回停止函数。paused返回true时（如只读维护）跳过
+func (s *KnowledgeService) Start(paused func() bool) func() {
+	if s.cfg.CrawlInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(crawlCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				queued, err := s.RecrawlDue()
+				if err != nil {
+					log.Printf("Failed to queue document crawls: %v", err)
+					continue
+				}
+				if queued > 0 {
+					log.Printf("Queued %d document crawls", queued)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// RecrawlDue 将到期的网页文档加入重新抓取队列。先以条件更新推迟下次抓取时间认领文档，多实例部署时不会重复抓取
+func (s *KnowledgeService) RecrawlDue() (int, error) {
+	now := time.Now()
+	var documents []model.Document
+	if err := s.db.Select("id", "user_id", "next_crawl_at").
+		Where("source_url <> '' AND status IN ? AND next_crawl_at <= ?", []string{model.DocumentReady, model.DocumentFailed}, now).
+		Order("next_crawl_at ASC").Limit(crawlBatchSize).Find(&documents).Error; err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, document := range documents {
+		claim := s.db.Model(&model.Document{}).Where("id = ? AND next_crawl_at = ?", document.ID, document.NextCrawlAt).
+			Update("next_crawl_at", s.nextCrawl(now))
+		if claim.Error != nil {
+			return queued, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		if err := s.enqueueCrawl(document.UserID, document.ID); err != nil {
+			// 队列已满时恢复抓取时间，下次检查时再加入
+			s.db.Model(&model.Document{}).Where("id = ?", document.ID).Update("next_crawl_at", document.NextCrawlAt)
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// enqueueCrawl 将网页文档加入重新抓取任务队列
+func (s *KnowledgeService) enqueueCrawl(userID, documentID uint) error {
+	_, err := s.jobService.Enqueue(userID, documentCrawlJobType, func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		progress(0, "Fetching")
+		changed, result, err := s.crawl(ctx, documentID, progress)
+		if err != nil {
+			return nil, err
+		}
+		output := map[string]interface{}{
+			"document_id": documentID,
+			"changed":     changed,
+		}
+		if result != nil {
+			output["chunks"] = result.chunks
+		}
+		return output, nil
+	})
+	return err
+}
+
+// crawl 重新抓取网页文档：按ETag/Last-Modified条件请求，返回304或内容哈希相同时只更新抓取时间，
+// 否则重新提取和分块。重新索引期间和失败时文档保留原有分块，仍可检索
+func (s *KnowledgeService) crawl(ctx context.Context, documentID uint, progress JobProgress) (bool, *ingestResult, error) {
+	var document model.Document
+	if err := s.db.Omit("extraction").First(&document, documentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	if document.SourceURL == "" || document.Status == model.DocumentPending || document.Status == model.DocumentProcessing {
+		return false, nil, nil
+	}
+
+	ready := document.Status == model.DocumentReady
+	page, err := s.fetch(ctx, &document, ready)
+	if err != nil {
+		s.crawlFailed(document.ID, err)
+		return false, nil, err
+	}
+	now := time.Now()
+	if ready && (page.notModified || page.hash == document.ContentHash) {
+		updates := map[string]interface{}{
+			"crawl_status":  model.CrawlUnchanged,
+			"crawl_error":   "",
+			"crawled_at":    now,
+			"next_crawl_at": s.nextCrawl(now),
+		}
+		if !page.notModified {
+			updates["etag"] = page.etag
+			updates["last_modified"] = page.lastModified
+		}
+		return false, nil, s.db.Model(&document).Updates(updates).Error
+	}
+
+	result, err := s.index(ctx, &document, page.contentType, page.data, page.updates(now, s.nextCrawl(now)), progress)
+	if err != nil {
+		if !ready {
+			s.fail(document.ID, result, err)
+		}
+		s.crawlFailed(document.ID, err)
+		return false, result, err
+	}
+	return true, result, nil
+}
+
+// fetch 抓取网页，conditional为true时带上次的ETag/Last-Modified发起条件请求。内容超过CrawlMaxSize或类型不支持时返回错误，
+// 抓取的内容计入套餐的文档存储额度
+func (s *KnowledgeService) fetch(ctx context.Context, document *model.Document, conditional bool) (*crawledPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, document.SourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
+	if conditional {
+		if document.ETag != "" {
+			req.Header.Set("If-None-Match", document.ETag)
+		}
+		if document.LastModified != "" {
+			req.Header.Set("If-Modified-Since", document.LastModified)
+		}
+	}
+
+	resp, err := s.crawler.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return &crawledPage{notModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch failed: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s.cfg.CrawlMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+	if int64(len(data)) > s.cfg.CrawlMaxSize {
+		return nil, ErrCrawlTooLarge
+	}
+
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if !extract.Supported(contentType) {
+		return nil, ErrDocumentUnsupported
+	}
+
+	var used int64
+	if err := s.db.Model(&model.Document{}).Where("user_id = ? AND id <> ?", document.UserID, document.ID).
+		Select("COALESCE(SUM(size), 0)").Scan(&used).Error; err != nil {
+		return nil, err
+	}
+	if err := s.planService.CheckDocumentStorage(document.UserID, used, int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	return &crawledPage{
+		data:         data,
+		contentType:  contentType,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		hash:         hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// updates 抓取成功并重新索引后更新的文档字段，网页有<title>时作为文档标题
+func (p *crawledPage) updates(now time.Time, next *time.Time) map[string]interface{} {
+	updates := map[string]interface{}{
+		"content_type":  p.contentType,
+		"size":          len(p.data),
+		"etag":          p.etag,
+		"last_modified": p.lastModified,
+		"content_hash":  p.hash,
+		"crawl_status":  model.CrawlChanged,
+		"crawl_error":   "",
+		"crawled_at":    now,
+		"changed_at":    now,
+		"next_crawl_at": next,
+	}
+	if p.contentType == "text/html" || p.contentType == "application/xhtml+xml" {
+		if title := extract.HTMLTitle(p.data); title != "" {
+			updates["title"] = truncateRunes(title, 255)
+		}
+	}
+	return updates
+}
+
+// crawlFailed 记录抓取失败，下次定期抓取时重试
+func (s *KnowledgeService) crawlFailed(documentID uint, cause error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"crawl_status":  model.CrawlError,
+		"crawl_error":   truncateRunes(cause.Error(), 250),
+		"crawled_at":    now,
+		"next_crawl_at": s.nextCrawl(now),
+	}
+	if err := s.db.Model(&model.Document{}).Where("id = ?", documentID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record crawl failure of document %d: %v", documentID, err)
+	}
+}
+
+// nextCrawl 下次定期抓取时间，未开启定期抓取时为nil
+func (s *KnowledgeService) nextCrawl(now time.Time) *time.Time {
+	if s.cfg.CrawlInterval <= 0 {
+		return nil
+	}
+	next := now.Add(s.cfg.CrawlInterval)
+	return &next
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var ErrInsufficientCredits = errors.New("insufficient credits")
+
+type AdjustCreditsRequest struct {
+	Amount int64  `json:"amount" validate:"required"`
+	Reason string `json:"reason" validate:"required,max=100"`
+}
+
+type CreditService struct {
+	db  *gorm.DB
+	cfg config.CreditsConfig
+}
+
+func NewCreditService(db *gorm.DB) *CreditService {
+	return &CreditService{
+		db:  db,
+		cfg: config.Load().Credits,
+	}
+}
+
+// applyCredit 在事务中调整余额并写入流水，amount为负表示扣减
+func applyCredit(tx *gorm.DB, userID uint, amount int64, txType, reference string) (*model.CreditTransaction, error) {
+	return applyCreditEntry(tx, userID, amount, txType, reference, nil)
+}
+
+// applyCreditEntry 同applyCredit，idempotencyKey非空时与已有流水重复会返回唯一索引冲突
+func applyCreditEntry(tx *gorm.DB, userID uint, amount int64, txType, reference string, idempotencyKey *string) (*model.CreditTransaction, error) {
+	if err := incrementUserCounter(tx, userID, "credit_balance", amount); err != nil {
+		return nil, err
+	}
+
+	// 同一事务内更新后读取，行锁保证余额与流水一致
+	var user model.User
+	if err := tx.Select("credit_balance").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	entry := model.CreditTransaction{
+		UserID:         userID,
+		Amount:         amount,
+		BalanceAfter:   user.CreditBalance,
+		Type:           txType,
+		Reference:      reference,
+		IdempotencyKey: idempotencyKey,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Enabled 是否启用额度扣减
+func (s *CreditService) Enabled() bool {
+	return s.cfg.Enabled
+}
+
+// Credit 入账，reference非空时同类型同引用只入账一次（如webhook重试），已入账时返回nil。
+// 由唯一索引判断重复，并发的重试中只有一个能提交，其余事务回滚（余额不变）
+func (s *CreditService) Credit(userID uint, amount int64, txType, reference string) (*model.CreditTransaction, error) {
+	var idempotencyKey *string
+	if reference != "" {
+		key := txType + ":" + reference
+		idempotencyKey = &key
+	}
+	var entry *model.CreditTransaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = applyCreditEntry(tx, userID, amount, txType, reference, idempotencyKey)
+		return err
+	})
+	if idempotencyKey != nil && isDuplicateKey(err) {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// isDuplicateKey 是否为MySQL唯一索引冲突
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// DebitGeneration 按本次生成的token用量扣减额度，未启用时不扣减；余额允许扣为负数，下次生成前拦截
+func (s *CreditService) DebitGeneration(userID uint, tokens int64, reference string) {
+	if !s.cfg.Enabled || tokens <= 0 {
+		return
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		_, err := applyCredit(tx, userID, -tokens, model.CreditGeneration, reference)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to debit %d credits for user %d: %v", tokens, userID, err)
+	}
+}
+
+// CheckBalance 生成前检查余额，未启用时总是通过
+func (s *CreditService) CheckBalance(userID uint) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	balance, err := s.Balance(userID)
+	if err != nil {
+		return err
+	}
+	if balance <= 0 {
+		return ErrInsufficientCredits
+	}
+	return nil
+}
+
+// Balance 获取额度余额
+func (s *CreditService) Balance(userID uint) (int64, error) {
+	var user model.User
+	if err := s.db.Select("credit_balance").Where("id = ?", userID).First(&user).Error; err != nil {
+		return 0, err
+	}
+	return user.CreditBalance, nil
+}
+
+// GetTransactions 分页获取额度流水
+func (s *CreditService) GetTransactions(userID uint, page, pageSize int) ([]model.CreditTransaction, int64, error) {
+	var transactions []model.CreditTransaction
+	var total int64
+
+	query := s.db.Where("user_id = ?", userID)
+
+	if err := query.Model(&model.CreditTransaction{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&transactions).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return transactions, total, nil
+}
+
+// Adjust 管理员调整额度
+func (s *CreditService) Adjust(adminID, userID uint, req *AdjustCreditsRequest) (*model.CreditTransaction, error) {
+	var entry *model.CreditTransaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = applyCredit(tx, userID, req.Amount, model.CreditAdjustment, fmt.Sprintf("admin:%d %s", adminID, req.Reason))
+		return err
+	})
+	return entry, err
+}
+
+// Subscribe 新用户注册时发放注册奖励
+func (s *CreditService) Subscribe(bus events.Bus) {
+	if s.cfg.SignupBonus <= 0 {
+		return
+	}
+	bus.Subscribe(events.UserRegistered, func(ctx context.Context, event events.Event) error {
+		_, err := s.Credit(event.UserID, s.cfg.SignupBonus, model.CreditReward, fmt.Sprintf("signup:%d", event.UserID))
+		return err
+	})
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"ai-chat-backend/internal/model"
+)
+
+// 同一关联对象并发入账（如webhook重复投递）时只入账一次
+func TestCreditIdempotentUnderConcurrency(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{})
+	s := NewCreditService(db)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Credit(user.ID, 100, model.CreditPurchase, "cs_test_concurrent"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	var entries int64
+	db.Model(&model.CreditTransaction{}).Where("user_id = ?", user.ID).Count(&entries)
+	if entries != 1 {
+		t.Errorf("%d transactions, want 1", entries)
+	}
+	balance, err := s.Balance(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 100 {
+		t.Errorf("balance = %d, want 100", balance)
+	}
+
+	// 没有关联对象的入账不做去重
+	for i := 0; i < 2; i++ {
+		if _, err := s.Credit(user.ID, 1, model.CreditReward, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&model.CreditTransaction{}).Where("user_id = ?", user.ID).Count(&entries)
+	if entries != 3 {
+		t.Errorf("%d transactions, want 3", entries)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/metrics"
+	"ai-chat-backend/internal/model"
+)
+
+// messageDeduper 合并窗口期内发往同一会话的相同用户消息（重复点击、多个标签页），只生成一次回复
+type messageDeduper struct {
+	window time.Duration
+	calls  sync.Map
+}
+
+// dedupeCall 一次生成，完成后在窗口期内保留结果，重复的请求直接返回
+type dedupeCall struct {
+	key       string
+	done      chan struct{}
+	user      *model.Message
+	assistant *model.Message
+	truncated bool
+	err       error
+}
+
+func newMessageDeduper(window time.Duration) *messageDeduper {
+	return &messageDeduper{window: window}
+}
+
+// begin 登记一次生成，相同的生成正在进行或刚完成时返回它，leader为false
+func (d *messageDeduper) begin(conversationID uint, content string) (*dedupeCall, bool) {
+	sum := sha256.Sum256([]byte(content))
+	call := &dedupeCall{
+		key:  fmt.Sprintf("%d:%s", conversationID, hex.EncodeToString(sum[:])),
+		done: make(chan struct{}),
+	}
+	actual, loaded := d.calls.LoadOrStore(call.key, call)
+	return actual.(*dedupeCall), !loaded
+}
+
+// finish 记录结果并唤醒等待的请求。失败的生成立即移除，不影响用户重试
+func (d *messageDeduper) finish(call *dedupeCall, user, assistant *model.Message, truncated bool, err error) {
+	call.user, call.assistant, call.truncated, call.err = user, assistant, truncated, err
+	close(call.done)
+	if err != nil {
+		d.calls.CompareAndDelete(call.key, call)
+		return
+	}
+	time.AfterFunc(d.window, func() { d.calls.CompareAndDelete(call.key, call) })
+}
+
+// wait 等待生成完成
+func (c *dedupeCall) wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deduplicate 在窗口期内合并重复的用户消息：相同内容的生成正在进行或刚完成时返回其结果，duplicate为true；
+// 否则调用generate。其他实例上刚完成的相同消息按会话最后一轮对话判断；附带文件的消息不合并（文件只能随一条消息发送）
+func (s *ChatService) deduplicate(ctx context.Context, conversation *model.Conversation, req *SendMessageRequest,
+	generate func() (*model.Message, *model.Message, bool, error)) (*model.Message, *model.Message, bool, bool, error) {
+	if s.deduper == nil || len(req.AttachmentIDs) > 0 {
+		user, assistant, truncated, err := generate()
+		return user, assistant, truncated, false, err
+	}
+
+	call, leader := s.deduper.begin(conversation.ID, req.Content)
+	if !leader {
+		if err := call.wait(ctx); err != nil {
+			return nil, nil, false, true, err
+		}
+		metrics.DuplicateMessages.Inc("inflight")
+		return call.user, call.assistant, call.truncated, true, call.err
+	}
+
+	user, assistant, err := s.recentDuplicate(ctx, conversation, req.Content)
+	if err != nil {
+		s.deduper.finish(call, nil, nil, false, err)
+		return nil, nil, false, false, err
+	}
+	if user != nil {
+		metrics.DuplicateMessages.Inc("recent")
+		s.deduper.finish(call, user, assistant, false, nil)
+		return user, assistant, false, true, nil
+	}
+
+	user, assistant, truncated, err := generate()
+	s.deduper.finish(call, user, assistant, truncated, err)
+	return user, assistant, truncated, false, err
+}
+
+// recentDuplicate 会话的最后一轮对话是窗口期内内容相同的用户消息及其回复时返回这两条消息
+func (s *ChatService) recentDuplicate(ctx context.Context, conversation *model.Conversation, content string) (*model.Message, *model.Message, error) {
+	var recent []model.Message
+	if conversation.Incognito {
+		if s.incognito == nil {
+			return nil, nil, nil
+		}
+		messages, err := s.incognito.Range(ctx, conversation.ID, -2, -1)
+		if err != nil {
+			return nil, nil, err
+		}
+		recent = messages
+	} else {
+		if err := s.db.Where("conversation_id = ? AND role <> ?", conversation.ID, model.RoleTool).
+			Order("id DESC").Limit(2).Find(&recent).Error; err != nil {
+			return nil, nil, err
+		}
+		if len(recent) == 2 {
+			recent[0], recent[1] = recent[1], recent[0]
+		}
+	}
+
+	if len(recent) != 2 {
+		return nil, nil, nil
+	}
+	user, assistant := &recent[0], &recent[1]
+	if user.Role != "user" || assistant.Role != "assistant" || user.Content != content ||
+		time.Since(user.CreatedAt) > s.deduper.window {
+		return nil, nil, nil
+	}
+	return user, assistant, nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"runtime"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RuntimeStats 运行时诊断信息
+type RuntimeStats struct {
+	Uptime        string        `json:"uptime"`
+	Goroutines    int           `json:"goroutines"`
+	ActiveStreams int64         `json:"active_streams"`
+	Memory        MemoryStats   `json:"memory"`
+	DBPool        DBPoolStats   `json:"db_pool"`
+	GC            GCStats       `json:"gc"`
+	ReadOnly      bool          `json:"read_only"`
+	GoVersion     string        `json:"go_version"`
+	CollectedAt   time.Time     `json:"collected_at"`
+	CollectTime   time.Duration `json:"collect_time_ns"`
+}
+
+type MemoryStats struct {
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
+	StackInuse  uint64 `json:"stack_inuse"`
+	Sys         uint64 `json:"sys"`
+}
+
+type GCStats struct {
+	NumGC        uint32  `json:"num_gc"`
+	PauseTotalMs float64 `json:"pause_total_ms"`
+	LastPauseMs  float64 `json:"last_pause_ms"`
+}
+
+type DBPoolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+}
+
+// DiagnosticsService 汇总运行时、数据库连接池和业务状态，供线上排查问题
+type DiagnosticsService struct {
+	db            *gorm.DB
+	chatService   *ChatService
+	systemService *SystemService
+	startedAt     time.Time
+}
+
+func NewDiagnosticsService(db *gorm.DB, chatService *ChatService, systemService *SystemService) *DiagnosticsService {
+	return &DiagnosticsService{
+		db:            db,
+		chatService:   chatService,
+		systemService: systemService,
+		startedAt:     time.Now(),
+	}
+}
+
+// Stats 采集当前的诊断信息，ReadMemStats会短暂暂停所有goroutine，不宜高频调用
+func (s *DiagnosticsService) Stats() (*RuntimeStats, error) {
+	start := time.Now()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	pool := sqlDB.Stats()
+
+	var lastPause uint64
+	if mem.NumGC > 0 {
+		lastPause = mem.PauseNs[(mem.NumGC+255)%256]
+	}
+
+	return &RuntimeStats{
+		Uptime:        time.Since(s.startedAt).Round(time.Second).String(),
+		Goroutines:    runtime.NumGoroutine(),
+		ActiveStreams: s.chatService.ActiveStreams(),
+		Memory: MemoryStats{
+			HeapAlloc:   mem.HeapAlloc,
+			HeapInuse:   mem.HeapInuse,
+			HeapObjects: mem.HeapObjects,
+			StackInuse:  mem.StackInuse,
+			Sys:         mem.Sys,
+		},
+		DBPool: DBPoolStats{
+			MaxOpenConnections: pool.MaxOpenConnections,
+			OpenConnections:    pool.OpenConnections,
+			InUse:              pool.InUse,
+			Idle:               pool.Idle,
+			WaitCount:          pool.WaitCount,
+			WaitDuration:       pool.WaitDuration.String(),
+		},
+		GC: GCStats{
+			NumGC:        mem.NumGC,
+			PauseTotalMs: float64(mem.PauseTotalNs) / 1e6,
+			LastPauseMs:  float64(lastPause) / 1e6,
+		},
+		ReadOnly:    s.systemService.IsReadOnly(),
+		GoVersion:   runtime.Version(),
+		CollectedAt: start,
+		CollectTime: time.Since(start),
+	}, nil
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/metrics"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// maxDomainListSize 远程域名列表的大小上限
+const maxDomainListSize = 16 << 20
+
+var (
+	ErrDisposableEmail        = errors.New("disposable email addresses are not allowed")
+	ErrInvalidEmailDomain     = errors.New("invalid email domain")
+	ErrDomainOverrideNotFound = errors.New("email domain override not found")
+)
+
+// EmailBlocklist 一次性邮箱域名列表，从文件或远程地址加载并定期刷新。
+// 子域名同样被拦截，管理员可对单个域名设置放行或禁止，优先于列表
+type EmailBlocklist struct {
+	db     *gorm.DB
+	source string
+	client *http.Client
+
+	mu       sync.RWMutex
+	domains  map[string]struct{}
+	loadedAt time.Time
+	lastErr  error
+}
+
+// NewEmailBlocklist source为文件路径或http(s)地址，为空时只使用管理员的设置
+func NewEmailBlocklist(db *gorm.DB, source string) *EmailBlocklist {
+	return &EmailBlocklist{
+		db:      db,
+		source:  source,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		domains: make(map[string]struct{}),
+	}
+}
+
+// BlocklistStatus 域名列表的加载状态
+type BlocklistStatus struct {
+	Source    string                      `json:"source"`
+	Domains   int                         `json:"domains"`
+	LoadedAt  *time.Time                  `json:"loaded_at"`
+	LastError string                      `json:"last_error,omitempty"`
+	Overrides []model.EmailDomainOverride `json:"overrides"`
+}
+
+type SetDomainOverrideRequest struct {
+	Allowed bool   `json:"allowed"`
+	Note    string `json:"note" validate:"max=255"`
+}
+
+// Load 重新加载域名列表，失败时保留之前的列表
+func (b *EmailBlocklist) Load(ctx context.Context) error {
+	if b.source == "" {
+		return nil
+	}
+	domains, err := b.fetch(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastErr = err
+	if err != nil {
+		return err
+	}
+	b.domains = domains
+	b.loadedAt = time.Now()
+	return nil
+}
+
+// Start 按interval定期重新加载域名列表，返回停止函数
+func (b *EmailBlocklist) Start(interval time.Duration) func() {
+	if interval <= 0 || b.source == "" {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := b.Load(context.Background()); err != nil {
+					log.Printf("Failed to refresh disposable email domains: %v", err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (b *EmailBlocklist) fetch(ctx context.Context) (map[string]struct{}, error) {
+	var r io.Reader
+	if strings.HasPrefix(b.source, "http://") || strings.HasPrefix(b.source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("domain list returned %d", resp.StatusCode)
+		}
+		r = io.LimitReader(resp.Body, maxDomainListSize)
+	} else {
+		f, err := os.Open(b.source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// 每行一个域名，忽略空行和#开头的注释
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if domain, err := normalizeDomain(line); err == nil {
+			domains[domain] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("domain list is empty")
+	}
+	return domains, nil
+}
+
+// normalizeDomain 统一为小写，去掉开头的"*."、"@"和末尾的"."
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "*.")
+	domain = strings.TrimPrefix(domain, "@")
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || len(domain) > 255 || strings.ContainsAny(domain, "@/ \t") || !strings.Contains(domain, ".") {
+		return "", ErrInvalidEmailDomain
+	}
+	return domain, nil
+}
+
+// Check 邮箱域名（含上级域名）在列表中且未被管理员放行时返回ErrDisposableEmail，action用于统计
+func (b *EmailBlocklist) Check(email, action string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil
+	}
+	domain, err := normalizeDomain(email[at+1:])
+	if err != nil {
+		return nil
+	}
+
+	// a.b.example.com 依次匹配 a.b.example.com、b.example.com、example.com
+	var candidates []string
+	for d := domain; strings.Contains(d, "."); d = d[strings.Index(d, ".")+1:] {
+		candidates = append(candidates, d)
+	}
+
+	var overrides []model.EmailDomainOverride
+	if err := b.db.Where("domain IN ?", candidates).Find(&overrides).Error; err != nil {
+		return err
+	}
+	// 最具体的设置优先
+	for _, candidate := range candidates {
+		for _, override := range overrides {
+			if override.Domain != candidate {
+				continue
+			}
+			if override.Allowed {
+				return nil
+			}
+			metrics.DisposableEmailBlocked.Inc(action)
+			return ErrDisposableEmail
+		}
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, candidate := range candidates {
+		if _, ok := b.domains[candidate]; ok {
+			metrics.DisposableEmailBlocked.Inc(action)
+			return ErrDisposableEmail
+		}
+	}
+	return nil
+}
+
+// Status 获取域名列表的加载状态和管理员的设置
+func (b *EmailBlocklist) Status() (*BlocklistStatus, error) {
+	var overrides []model.EmailDomainOverride
+	if err := b.db.Order("domain ASC").Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	status := &BlocklistStatus{
+		Source:    b.source,
+		Domains:   len(b.domains),
+		Overrides: overrides,
+	}
+	if !b.loadedAt.IsZero() {
+		loadedAt := b.loadedAt
+		status.LoadedAt = &loadedAt
+	}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	return status, nil
+}
+
+// SetOverride 设置单个域名放行或禁止，已有设置时覆盖
+func (b *EmailBlocklist) SetOverride(adminID uint, domain string, req *SetDomainOverrideRequest) (*model.EmailDomainOverride, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var override model.EmailDomainOverride
+	err = b.db.Where("domain = ?", domain).First(&override).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	override.Domain = domain
+	override.Allowed = req.Allowed
+	override.Note = req.Note
+	override.CreatedBy = adminID
+	if err := b.db.Save(&override).Error; err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// DeleteOverride 删除域名的设置，恢复按列表判断
+func (b *EmailBlocklist) DeleteOverride(domain string) error {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+	result := b.db.Where("domain = ?", domain).Delete(&model.EmailDomainOverride{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDomainOverrideNotFound
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrEndpointURL 用户提供的模型服务地址不是公网的https地址
+var ErrEndpointURL = errors.New("base_url must be an https URL on a public host")
+
+// checkEndpointURL 校验用户提供的模型服务地址（BYOK、组织模型服务）：必须为https，主机不能是localhost或内网IP。
+// 域名解析出的地址在建立连接时再由denyPrivateAddress检查
+func checkEndpointURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return ErrEndpointURL
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrEndpointURL
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		return ErrEndpointURL
+	}
+	return nil
+}
+
+// newGuardedHTTPClient 请求用户提供地址的HTTP客户端：与webhook一样在建立连接前拒绝内网地址，且不跟随重定向
+func newGuardedHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: denyPrivateAddress,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
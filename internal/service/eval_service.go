@@ -0,0 +1,688 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/schema"
+	"gorm.io/gorm"
+)
+
+// 评测判分方式
+const (
+	// EvalScorerHeuristic 按用例的检查项判分，得分为通过的检查项比例
+	EvalScorerHeuristic = "heuristic"
+	// EvalScorerJudge 由服务端模型按评审要点打分，未设置评审要点的用例按检查项判分
+	EvalScorerJudge = "judge"
+)
+
+// evalRunJobType 执行评测的后台任务类型
+const evalRunJobType = "eval_run"
+
+const (
+	// evalPassScore 得分不低于该值且检查项全部通过时视为通过
+	evalPassScore = 0.7
+	// evalScoreTolerance 对比报告中得分变化不超过该值视为不变
+	evalScoreTolerance = 0.05
+	// evalCasesProgress 全部用例完成时的任务进度，剩余部分为汇总得分
+	evalCasesProgress = 95
+	// evalJudgeMaxTokens 评审模型的输出上限
+	evalJudgeMaxTokens = 512
+)
+
+// 对比报告中用例的得分变化
+const (
+	evalChangeImproved  = "improved"
+	evalChangeRegressed = "regressed"
+	evalChangeUnchanged = "unchanged"
+	// evalChangeMissing 用例只出现在其中一次执行中
+	evalChangeMissing = "missing"
+)
+
+// evalJudgePrompt 评审模型的系统提示词
+const evalJudgePrompt = "You are an impartial judge grading an AI assistant's answer to a question. " +
+	"Score how well the answer meets the grading criteria on a scale from 0 to 10, where 0 means it fails every criterion " +
+	"and 10 means it fully meets all of them. Judge only against the criteria, not the style of the answer. " +
+	`Reply with a single JSON object and nothing else: {"score": <integer 0-10>, "reason": "<one or two sentences>"}`
+
+var (
+	ErrEvalCaseInvalid    = errors.New("invalid evaluation case")
+	ErrEvalCaseNotFound   = errors.New("evaluation case not found")
+	ErrEvalRunInvalid     = errors.New("invalid evaluation run")
+	ErrEvalRunNotFound    = errors.New("evaluation run not found")
+	ErrEvalReportNotFound = errors.New("evaluation report not found")
+)
+
+// EvalCriteria 用例的判分标准，至少设置一项
+type EvalCriteria struct {
+	// Rubric 评审要点，评审模型按此打分
+	Rubric string `json:"rubric,omitempty" validate:"max=2000"`
+	// MustInclude 回答必须包含的内容，MustExclude为不得包含的内容，均不区分大小写
+	MustInclude []string `json:"must_include,omitempty" validate:"max=20,dive,required,max=200"`
+	MustExclude []string `json:"must_exclude,omitempty" validate:"max=20,dive,required,max=200"`
+	// MaxLength 回答的最大字符数，0表示不限制
+	MaxLength int `json:"max_length,omitempty" validate:"min=0"`
+}
+
+// checks 启发式判分的检查项数量
+func (c *EvalCriteria) checks() int {
+	n := len(c.MustInclude) + len(c.MustExclude)
+	if c.MaxLength > 0 {
+		n++
+	}
+	return n
+}
+
+type SaveEvalCaseRequest struct {
+	Suite  string `json:"suite" validate:"required,max=64"`
+	Prompt string `json:"prompt" validate:"required,max=8000"`
+	EvalCriteria
+}
+
+// EvalCase 评测用例及解析后的判分标准
+type EvalCase struct {
+	*model.EvalCase
+	EvalCriteria
+}
+
+type StartEvalRunRequest struct {
+	Suite string `json:"suite" validate:"required,max=64"`
+	// Model 被评测的模型，使用服务端配置的模型服务，为空时使用服务端配置的模型
+	Model string `json:"model" validate:"max=128"`
+	// PromptVersion 系统提示词模板版本，可以是已撤销或未生效的版本，为空时使用当前版本
+	PromptVersion *int   `json:"prompt_version" validate:"omitempty,min=1"`
+	Scorer        string `json:"scorer" validate:"required,oneof=heuristic judge"`
+}
+
+// EvalRunStarted 已创建的评测执行及执行它的后台任务
+type EvalRunStarted struct {
+	Run *model.EvalRun `json:"run"`
+	Job *model.Job     `json:"job"`
+}
+
+// EvalRunSummary 评测任务的结果
+type EvalRunSummary struct {
+	RunID  uint    `json:"run_id"`
+	Total  int     `json:"total"`
+	Passed int     `json:"passed"`
+	Score  float64 `json:"score"`
+}
+
+type CreateEvalReportRequest struct {
+	BaseRunID      uint `json:"base_run_id" validate:"required"`
+	CandidateRunID uint `json:"candidate_run_id" validate:"required"`
+}
+
+// EvalCaseComparison 对比报告中一个用例的得分，未出现在某次执行中时对应得分为nil
+type EvalCaseComparison struct {
+	CaseID          uint     `json:"case_id"`
+	Prompt          string   `json:"prompt"`
+	BaseScore       *float64 `json:"base_score"`
+	CandidateScore  *float64 `json:"candidate_score"`
+	BasePassed      bool     `json:"base_passed"`
+	CandidatePassed bool     `json:"candidate_passed"`
+	Delta           float64  `json:"delta"`
+	Change          string   `json:"change"`
+}
+
+// EvalReport 对比报告及各用例的得分对比
+type EvalReport struct {
+	*model.EvalReport
+	Cases []EvalCaseComparison `json:"cases"`
+}
+
+// evalPrompts 评测执行使用的系统提示词和安全约束，开始执行时确定
+type evalPrompts struct {
+	system    string
+	guardrail string
+}
+
+// EvalService 离线评测：维护评测用例，以指定的模型和系统提示词版本执行并判分，对比两次执行的结果
+type EvalService struct {
+	db            *gorm.DB
+	aiService     *AIService
+	promptService *PromptService
+	jobService    *JobService
+	// systemPrompt 未发布系统提示词模板时使用的配置提示词，与默认助手一致
+	systemPrompt string
+}
+
+func NewEvalService(db *gorm.DB, aiService *AIService, promptService *PromptService, jobService *JobService) *EvalService {
+	return &EvalService{
+		db:            db,
+		aiService:     aiService,
+		promptService: promptService,
+		jobService:    jobService,
+		systemPrompt:  literalPrompt(config.Load().Chat.SystemPrompt),
+	}
+}
+
+// ListCases 获取评测用例，suite不为空时只返回该套件的用例
+func (s *EvalService) ListCases(suite string, page, pageSize int) ([]EvalCase, int64, error) {
+	query := s.db.Model(&model.EvalCase{})
+	if suite != "" {
+		query = query.Where("suite = ?", suite)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var cases []model.EvalCase
+	offset := (page - 1) * pageSize
+	if err := query.Order("suite, id").Offset(offset).Limit(pageSize).Find(&cases).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]EvalCase, len(cases))
+	for i := range cases {
+		result[i] = evalCase(&cases[i])
+	}
+	return result, total, nil
+}
+
+// CreateCase 添加评测用例
+func (s *EvalService) CreateCase(adminID uint, req *SaveEvalCaseRequest) (*EvalCase, error) {
+	criteria, err := validateEvalCriteria(&req.EvalCriteria)
+	if err != nil {
+		return nil, err
+	}
+	record := &model.EvalCase{
+		Suite:     req.Suite,
+		Prompt:    req.Prompt,
+		Criteria:  criteria,
+		CreatedBy: adminID,
+	}
+	if err := s.db.Create(record).Error; err != nil {
+		return nil, err
+	}
+	return &EvalCase{EvalCase: record, EvalCriteria: req.EvalCriteria}, nil
+}
+
+// UpdateCase 替换评测用例的内容，已有的执行结果不受影响
+func (s *EvalService) UpdateCase(caseID uint, req *SaveEvalCaseRequest) (*EvalCase, error) {
+	var record model.EvalCase
+	err := s.db.First(&record, caseID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEvalCaseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	criteria, err := validateEvalCriteria(&req.EvalCriteria)
+	if err != nil {
+		return nil, err
+	}
+	record.Suite = req.Suite
+	record.Prompt = req.Prompt
+	record.Criteria = criteria
+	if err := s.db.Model(&record).Select("suite", "prompt", "criteria").Updates(&record).Error; err != nil {
+		return nil, err
+	}
+	return &EvalCase{EvalCase: &record, EvalCriteria: req.EvalCriteria}, nil
+}
+
+// DeleteCase 删除评测用例，已有的执行结果保留
+func (s *EvalService) DeleteCase(caseID uint) error {
+	result := s.db.Delete(&model.EvalCase{}, caseID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEvalCaseNotFound
+	}
+	return nil
+}
+
+// validateEvalCriteria 去除检查项两端的空白并序列化，至少需要一项判分标准
+func validateEvalCriteria(criteria *EvalCriteria) (string, error) {
+	criteria.Rubric = strings.TrimSpace(criteria.Rubric)
+	for _, list := range [][]string{criteria.MustInclude, criteria.MustExclude} {
+		for i := range list {
+			list[i] = strings.TrimSpace(list[i])
+			if list[i] == "" {
+				return "", fmt.Errorf("%w: empty check", ErrEvalCaseInvalid)
+			}
+		}
+	}
+	if criteria.Rubric == "" && criteria.checks() == 0 {
+		return "", fmt.Errorf("%w: a rubric or at least one check is required", ErrEvalCaseInvalid)
+	}
+	data, err := json.Marshal(criteria)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// evalCase 解析保存的判分标准，判分标准由服务写入，解析失败时仅记录日志
+func evalCase(c *model.EvalCase) EvalCase {
+	result := EvalCase{EvalCase: c}
+	if err := json.Unmarshal([]byte(c.Criteria), &result.EvalCriteria); err != nil {
+		log.Printf("Failed to parse criteria of evaluation case %d: %v", c.ID, err)
+	}
+	return result
+}
+
+// StartRun 创建评测执行并在后台任务中执行。系统提示词在此时确定：指定版本时使用该版本，
+// 否则使用当前版本并记录其版本号；安全约束始终使用当前版本
+func (s *EvalService) StartRun(adminID uint, req *StartEvalRunRequest) (*EvalRunStarted, error) {
+	var count int64
+	if err := s.db.Model(&model.EvalCase{}).Where("suite = ?", req.Suite).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%w: suite %q has no cases", ErrEvalRunInvalid, req.Suite)
+	}
+
+	target := s.aiService
+	if req.Model != "" && req.Model != s.aiService.ModelName() {
+		var err error
+		if target, err = s.aiService.WithEndpoint(Endpoint{Model: req.Model}); err != nil {
+			return nil, err
+		}
+	}
+
+	run := &model.EvalRun{
+		Suite:     req.Suite,
+		Model:     target.ModelName(),
+		Scorer:    req.Scorer,
+		Status:    model.EvalStatusRunning,
+		CreatedBy: adminID,
+	}
+	prompts, err := s.prompts(req.PromptVersion, run)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		return nil, err
+	}
+
+	job, err := s.jobService.Enqueue(adminID, evalRunJobType, func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		return s.execute(ctx, run, target, prompts, progress)
+	})
+	if err != nil {
+		s.finishRun(run, err)
+		return nil, err
+	}
+	return &EvalRunStarted{Run: run, Job: job}, nil
+}
+
+// prompts 确定评测使用的提示词，并将系统提示词的版本记录到run
+func (s *EvalService) prompts(version *int, run *model.EvalRun) (*evalPrompts, error) {
+	prompts := &evalPrompts{system: s.systemPrompt}
+	if s.promptService == nil {
+		if version != nil {
+			return nil, fmt.Errorf("%w: prompt templates are not enabled", ErrEvalRunInvalid)
+		}
+		return prompts, nil
+	}
+
+	var system *model.PromptTemplate
+	var err error
+	if version != nil {
+		system, err = s.promptService.Version(PromptSystem, *version)
+		if errors.Is(err, ErrPromptTemplateNotFound) {
+			return nil, fmt.Errorf("%w: system prompt version %d not found", ErrEvalRunInvalid, *version)
+		}
+	} else {
+		system, err = s.promptService.Active(PromptSystem)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if system != nil {
+		prompts.system = system.Content
+		run.PromptVersion = &system.Version
+	}
+
+	guardrail, err := s.promptService.Active(PromptGuardrail)
+	if err != nil {
+		return nil, err
+	}
+	if guardrail != nil {
+		prompts.guardrail = guardrail.Content
+	}
+	return prompts, nil
+}
+
+// execute 依次回答套件中的用例并判分，单个用例生成或评审失败时记录错误并计为0分
+func (s *EvalService) execute(ctx context.Context, run *model.EvalRun, target *AIService, prompts *evalPrompts, progress JobProgress) (interface{}, error) {
+	var cases []model.EvalCase
+	if err := s.db.Where("suite = ?", run.Suite).Order("id").Find(&cases).Error; err != nil {
+		s.finishRun(run, err)
+		return nil, err
+	}
+
+	progress(0, "started")
+	var total float64
+	for i := range cases {
+		if err := ctx.Err(); err != nil {
+			s.finishRun(run, err)
+			return nil, err
+		}
+		result := s.evaluate(ctx, run.Scorer, target, prompts, evalCase(&cases[i]))
+		result.RunID = run.ID
+		if err := s.db.Create(result).Error; err != nil {
+			s.finishRun(run, err)
+			return nil, err
+		}
+
+		run.Total++
+		total += result.Score
+		if result.Passed {
+			run.Passed++
+		}
+		progress((i+1)*evalCasesProgress/len(cases), fmt.Sprintf("%d/%d cases evaluated", i+1, len(cases)))
+	}
+
+	if run.Total > 0 {
+		run.Score = total / float64(run.Total)
+	}
+	s.finishRun(run, nil)
+	return EvalRunSummary{RunID: run.ID, Total: run.Total, Passed: run.Passed, Score: run.Score}, nil
+}
+
+// finishRun 保存评测执行的最终状态
+func (s *EvalService) finishRun(run *model.EvalRun, err error) {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = model.EvalStatusCompleted
+	if err != nil {
+		run.Status = model.EvalStatusFailed
+		run.Error = truncateRunes(err.Error(), 255)
+	}
+	if err := s.db.Model(run).Select("status", "total", "passed", "score", "error", "finished_at").Updates(run).Error; err != nil {
+		log.Printf("Failed to update evaluation run %d: %v", run.ID, err)
+	}
+}
+
+// evaluate 以目标模型回答一个用例并判分
+func (s *EvalService) evaluate(ctx context.Context, scorer string, target *AIService, prompts *evalPrompts, c EvalCase) *model.EvalResult {
+	result := &model.EvalResult{CaseID: c.ID}
+	fail := func(err error) *model.EvalResult {
+		result.Score = 0
+		result.Passed = false
+		result.Error = truncateRunes(err.Error(), 255)
+		return result
+	}
+
+	judged := scorer == EvalScorerJudge && c.Rubric != ""
+	if !judged && c.checks() == 0 {
+		return fail(errors.New("case has no heuristic checks"))
+	}
+
+	messages, err := prompts.messages(ctx, c.Prompt)
+	if err != nil {
+		return fail(err)
+	}
+	start := time.Now()
+	answer, gen, err := target.GenerateResponse(ctx, messages, 0)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		return fail(err)
+	}
+	result.Answer = answer
+	result.Tokens = gen.TotalTokens(messages, answer)
+
+	score, failures := heuristicScore(&c.EvalCriteria, answer)
+	if judged {
+		judgeScore, reason, err := s.judge(ctx, c.Prompt, c.Rubric, answer)
+		if err != nil {
+			return fail(fmt.Errorf("judge failed: %w", err))
+		}
+		score = judgeScore
+		result.Reason = reason
+	}
+
+	result.Score = score
+	result.Passed = score >= evalPassScore && len(failures) == 0
+	if len(failures) > 0 {
+		result.Reason = strings.TrimSpace(result.Reason + "\n" + strings.Join(failures, "; "))
+	}
+	return result
+}
+
+// messages 组装用例的模型输入：系统提示词、安全约束和用例问题
+func (p *evalPrompts) messages(ctx context.Context, query string) ([]*schema.Message, error) {
+	var messages []*schema.Message
+	for _, text := range []string{p.system, p.guardrail} {
+		if text == "" {
+			continue
+		}
+		rendered, err := renderPrompt(ctx, text, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render system prompt: %w", err)
+		}
+		messages = append(messages, rendered...)
+	}
+	return append(messages, schema.UserMessage(query)), nil
+}
+
+// heuristicScore 按检查项判分，返回通过的比例和未通过的检查项
+func heuristicScore(criteria *EvalCriteria, answer string) (float64, []string) {
+	checks := criteria.checks()
+	if checks == 0 {
+		return 0, nil
+	}
+	lower := strings.ToLower(answer)
+	var failures []string
+	for _, text := range criteria.MustInclude {
+		if !strings.Contains(lower, strings.ToLower(text)) {
+			failures = append(failures, fmt.Sprintf("missing %q", text))
+		}
+	}
+	for _, text := range criteria.MustExclude {
+		if strings.Contains(lower, strings.ToLower(text)) {
+			failures = append(failures, fmt.Sprintf("contains %q", text))
+		}
+	}
+	if criteria.MaxLength > 0 && utf8.RuneCountInString(answer) > criteria.MaxLength {
+		failures = append(failures, fmt.Sprintf("longer than %d characters", criteria.MaxLength))
+	}
+	return float64(checks-len(failures)) / float64(checks), failures
+}
+
+// judge 由服务端模型按评审要点为回答打分，返回0-1的得分和理由。
+// 始终使用服务端配置的模型，使不同被评测模型的得分可比
+func (s *EvalService) judge(ctx context.Context, question, rubric, answer string) (float64, string, error) {
+	messages := []*schema.Message{
+		schema.SystemMessage(evalJudgePrompt),
+		schema.UserMessage(fmt.Sprintf("Question:\n%s\n\nGrading criteria:\n%s\n\nAnswer:\n%s", question, rubric, answer)),
+	}
+	content, _, err := s.aiService.GenerateResponse(ctx, messages, evalJudgeMaxTokens)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// 模型可能在JSON前后附带说明或代码块标记
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return 0, "", fmt.Errorf("unexpected judge response: %s", truncateRunes(content, 100))
+	}
+	var verdict struct {
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &verdict); err != nil {
+		return 0, "", fmt.Errorf("unexpected judge response: %w", err)
+	}
+	if verdict.Score < 0 || verdict.Score > 10 {
+		return 0, "", fmt.Errorf("judge score %v out of range", verdict.Score)
+	}
+	return verdict.Score / 10, verdict.Reason, nil
+}
+
+// ListRuns 获取评测执行记录，不含各用例结果
+func (s *EvalService) ListRuns(suite string, page, pageSize int) ([]model.EvalRun, int64, error) {
+	query := s.db.Model(&model.EvalRun{})
+	if suite != "" {
+		query = query.Where("suite = ?", suite)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []model.EvalRun
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// GetRun 获取评测执行记录及各用例的回答和得分
+func (s *EvalService) GetRun(runID uint) (*model.EvalRun, error) {
+	var run model.EvalRun
+	err := s.db.Preload("Results", func(db *gorm.DB) *gorm.DB { return db.Order("case_id") }).First(&run, runID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEvalRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// CreateReport 对比同一套件的两次已完成执行并保存报告，得分变化超过容差的用例计为提升或回退
+func (s *EvalService) CreateReport(adminID uint, req *CreateEvalReportRequest) (*EvalReport, error) {
+	base, err := s.GetRun(req.BaseRunID)
+	if err != nil {
+		return nil, err
+	}
+	candidate, err := s.GetRun(req.CandidateRunID)
+	if err != nil {
+		return nil, err
+	}
+	if base.Status != model.EvalStatusCompleted || candidate.Status != model.EvalStatusCompleted {
+		return nil, fmt.Errorf("%w: both runs must be completed", ErrEvalRunInvalid)
+	}
+	if base.Suite != candidate.Suite {
+		return nil, fmt.Errorf("%w: runs evaluated different suites", ErrEvalRunInvalid)
+	}
+
+	report := &model.EvalReport{
+		BaseRunID:      base.ID,
+		CandidateRunID: candidate.ID,
+		BaseScore:      base.Score,
+		CandidateScore: candidate.Score,
+		CreatedBy:      adminID,
+	}
+	comparisons := make(map[uint]*EvalCaseComparison)
+	comparison := func(caseID uint) *EvalCaseComparison {
+		if c, ok := comparisons[caseID]; ok {
+			return c
+		}
+		c := &EvalCaseComparison{CaseID: caseID}
+		comparisons[caseID] = c
+		return c
+	}
+	for i := range base.Results {
+		result := &base.Results[i]
+		c := comparison(result.CaseID)
+		c.BaseScore = &result.Score
+		c.BasePassed = result.Passed
+	}
+	for i := range candidate.Results {
+		result := &candidate.Results[i]
+		c := comparison(result.CaseID)
+		c.CandidateScore = &result.Score
+		c.CandidatePassed = result.Passed
+	}
+
+	caseIDs := make([]uint, 0, len(comparisons))
+	for id := range comparisons {
+		caseIDs = append(caseIDs, id)
+	}
+	sort.Slice(caseIDs, func(i, j int) bool { return caseIDs[i] < caseIDs[j] })
+	// 用例可能已被删除，此时问题为空
+	var cases []model.EvalCase
+	if err := s.db.Select("id", "prompt").Where("id IN ?", caseIDs).Find(&cases).Error; err != nil {
+		return nil, err
+	}
+	prompts := make(map[uint]string, len(cases))
+	for _, c := range cases {
+		prompts[c.ID] = c.Prompt
+	}
+
+	result := make([]EvalCaseComparison, 0, len(caseIDs))
+	for _, id := range caseIDs {
+		c := comparisons[id]
+		c.Prompt = prompts[id]
+		switch {
+		case c.BaseScore == nil || c.CandidateScore == nil:
+			c.Change = evalChangeMissing
+		default:
+			c.Delta = *c.CandidateScore - *c.BaseScore
+			switch {
+			case c.Delta > evalScoreTolerance:
+				c.Change = evalChangeImproved
+				report.Improved++
+			case c.Delta < -evalScoreTolerance:
+				c.Change = evalChangeRegressed
+				report.Regressed++
+			default:
+				c.Change = evalChangeUnchanged
+				report.Unchanged++
+			}
+		}
+		result = append(result, *c)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	report.Cases = string(data)
+	if err := s.db.Create(report).Error; err != nil {
+		return nil, err
+	}
+	return &EvalReport{EvalReport: report, Cases: result}, nil
+}
+
+// ListReports 获取对比报告，不含各用例的对比
+func (s *EvalService) ListReports(page, pageSize int) ([]model.EvalReport, int64, error) {
+	query := s.db.Model(&model.EvalReport{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var reports []model.EvalReport
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&reports).Error; err != nil {
+		return nil, 0, err
+	}
+	return reports, total, nil
+}
+
+// GetReport 获取对比报告及各用例的对比
+func (s *EvalService) GetReport(reportID uint) (*EvalReport, error) {
+	var report model.EvalReport
+	err := s.db.First(&report, reportID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEvalReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &EvalReport{EvalReport: &report}
+	if err := json.Unmarshal([]byte(report.Cases), &result.Cases); err != nil {
+		log.Printf("Failed to parse cases of evaluation report %d: %v", report.ID, err)
+	}
+	return result, nil
+}
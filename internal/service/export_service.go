@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/gdocs"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/notion"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// oauthStateTTL 授权链接的有效期
+	oauthStateTTL = 10 * time.Minute
+	// tokenRefreshMargin 访问令牌剩余有效期不足该值时提前刷新
+	tokenRefreshMargin = time.Minute
+)
+
+var (
+	ErrIntegrationDisabled     = errors.New("integration is not configured")
+	ErrIntegrationNotConnected = errors.New("integration is not connected")
+	ErrIntegrationExpired      = errors.New("integration authorization has expired, please reconnect")
+	ErrExportTargetRequired    = errors.New("parent_page_id is required for notion export")
+	ErrIncognitoExport         = errors.New("incognito conversations cannot be exported")
+	ErrInvalidOAuthState       = errors.New("invalid or expired authorization, please authorize again")
+)
+
+// ConnectIntegrationRequest 服务方回调带回的授权码和state，由前端在登录状态下提交完成授权
+type ConnectIntegrationRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// ExportService 将会话导出为markdown，并推送到用户授权的Notion页面或Google文档
+type ExportService struct {
+	db          *gorm.DB
+	coldStorage *ColdStorageService
+	box         *utils.SecretBox
+	callbackURL string
+	notion      *notion.Client
+	google      *gdocs.Client
+}
+
+// NewExportService 未配置加密密钥时只能下载markdown，不开放第三方集成
+func NewExportService(db *gorm.DB, coldStorage *ColdStorageService, cfg *config.Config) (*ExportService, error) {
+	s := &ExportService{
+		db:          db,
+		coldStorage: coldStorage,
+		callbackURL: strings.TrimRight(cfg.Export.CallbackURL, "/"),
+	}
+	if cfg.App.EncryptionKey == "" {
+		return s, nil
+	}
+	box, err := utils.NewSecretBox(cfg.App.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	s.box = box
+	if cfg.Export.NotionClientID != "" {
+		s.notion = notion.NewClient(cfg.Export.NotionClientID, cfg.Export.NotionClientSecret)
+	}
+	if cfg.Export.GoogleClientID != "" {
+		s.google = gdocs.NewClient(cfg.Export.GoogleClientID, cfg.Export.GoogleClientSecret)
+	}
+	return s, nil
+}
+
+// ExportRequest 推送目标，Notion需要指定父页面，Google文档可选指定文件夹
+type ExportRequest struct {
+	ParentPageID string `json:"parent_page_id" validate:"max=64"`
+	FolderID     string `json:"folder_id" validate:"max=128"`
+}
+
+// ExportResult 推送生成的页面或文档地址
+type ExportResult struct {
+	Provider string `json:"provider"`
+	URL      string `json:"url"`
+}
+
+// Markdown 渲染会话的markdown，返回会话标题。已移入冷存储的消息先恢复
+func (s *ExportService) Markdown(ctx context.Context, userID, conversationID uint) (string, string, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return "", "", conversationError(err)
+	}
+	// 无痕会话不应离开本服务
+	if conversation.Incognito {
+		return "", "", ErrIncognitoExport
+	}
+	if _, err := s.coldStorage.Rehydrate(ctx, userID, conversationID); err != nil {
+		return "", "", err
+	}
+
+	// 摘要消息是已有消息的重复，不导出；被涂抹的消息和工具调用结果同样不导出
+	var messages []model.Message
+	if err := s.db.Where("conversation_id = ? AND role NOT IN ? AND redacted_at IS NULL", conversationID, []string{model.RoleSummary, model.RoleTool}).
+		Order("id ASC").Find(&messages).Error; err != nil {
+		return "", "", err
+	}
+	return conversation.Title, renderMarkdown(&conversation, messages), nil
+}
+
+func renderMarkdown(conversation *model.Conversation, messages []model.Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", conversation.Title)
+	fmt.Fprintf(&b, "_Exported %s_\n", time.Now().UTC().Format("2006-01-02 15:04 UTC"))
+	for _, message := range messages {
+		role := "User"
+		if message.Role == "assistant" {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&b, "\n---\n\n**%s** · %s\n\n%s\n", role, message.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"), message.Content)
+	}
+	return b.String()
+}
+
+// AuthorizeURL 生成服务方的授权地址
+func (s *ExportService) AuthorizeURL(userID uint, provider string) (string, error) {
+	if err := s.checkProvider(provider); err != nil {
+		return "", err
+	}
+	state, err := newOAuthState(s.db, "export:"+provider, userID)
+	if err != nil {
+		return "", err
+	}
+	if provider == model.IntegrationNotion {
+		return s.notion.AuthURL(s.redirectURI(provider), state), nil
+	}
+	return s.google.AuthURL(s.redirectURI(provider), state), nil
+}
+
+func (s *ExportService) redirectURI(provider string) string {
+	return s.callbackURL + "/" + provider + "/callback"
+}
+
+// newOAuthState 生成一次性的OAuth state，随机值只以哈希落库并记录发起授权的用户。
+// purpose区分用途，防止一处的state用于另一处
+func newOAuthState(db *gorm.DB, purpose string, userID uint) (string, error) {
+	state, err := utils.GenerateToken(24)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	// 顺带清理该用户已过期未使用的state
+	if err := db.Where("user_id = ? AND expires_at < ?", userID, now).Delete(&model.OAuthState{}).Error; err != nil {
+		return "", err
+	}
+	record := model.OAuthState{
+		StateHash: utils.HashToken(state),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(oauthStateTTL),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// consumeOAuthState 校验state由userID为同一用途发起且未过期，校验通过即删除，同一state只能使用一次。
+// 只接受发起授权的用户本人提交：他人发来的带有对方state的授权链接无法把授权关联到对方账号
+func consumeOAuthState(db *gorm.DB, purpose, state string, userID uint) error {
+	result := db.Where("state_hash = ? AND user_id = ? AND purpose = ? AND expires_at > ?", utils.HashToken(state), userID, purpose, time.Now()).
+		Delete(&model.OAuthState{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidOAuthState
+	}
+	return nil
+}
+
+// Connect 完成授权：校验state由该用户发起，用授权码换取令牌并加密保存，重复授权时覆盖原有令牌
+func (s *ExportService) Connect(ctx context.Context, userID uint, provider string, req *ConnectIntegrationRequest) error {
+	if err := s.checkProvider(provider); err != nil {
+		return err
+	}
+	if err := consumeOAuthState(s.db, "export:"+provider, req.State, userID); err != nil {
+		return err
+	}
+
+	integration := model.UserIntegration{UserID: userID, Provider: provider}
+	var accessToken, refreshToken string
+	switch provider {
+	case model.IntegrationNotion:
+		token, err := s.notion.ExchangeCode(ctx, req.Code, s.redirectURI(provider))
+		if err != nil {
+			return err
+		}
+		accessToken = token.AccessToken
+		integration.AccountName = token.WorkspaceName
+	case model.IntegrationGoogle:
+		token, err := s.google.ExchangeCode(ctx, req.Code, s.redirectURI(provider))
+		if err != nil {
+			return err
+		}
+		accessToken, refreshToken = token.AccessToken, token.RefreshToken
+		integration.ExpiresAt = &token.ExpiresAt
+	}
+
+	var err error
+	if integration.EncryptedAccessToken, err = s.box.Encrypt(accessToken); err != nil {
+		return err
+	}
+	if refreshToken != "" {
+		if integration.EncryptedRefreshToken, err = s.box.Encrypt(refreshToken); err != nil {
+			return err
+		}
+	}
+
+	return saveIntegration(s.db, &integration)
+}
+
+// saveIntegration 保存集成授权，已有同一服务方的授权时覆盖
+func saveIntegration(db *gorm.DB, integration *model.UserIntegration) error {
+	var existing model.UserIntegration
+	err := db.Where("user_id = ? AND provider = ?", integration.UserID, integration.Provider).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(integration).Error
+	}
+	if err != nil {
+		return err
+	}
+	return db.Model(&existing).Updates(map[string]interface{}{
+		"account_name":            integration.AccountName,
+		"encrypted_access_token":  integration.EncryptedAccessToken,
+		"encrypted_refresh_token": integration.EncryptedRefreshToken,
+		"scopes":                  integration.Scopes,
+		"expires_at":              integration.ExpiresAt,
+	}).Error
+}
+
+// exportProviders 导出使用的集成，日历授权由CalendarService单独管理
+var exportProviders = []string{model.IntegrationNotion, model.IntegrationGoogle}
+
+// ListIntegrations 获取用户已授权的导出集成（不含令牌）
+func (s *ExportService) ListIntegrations(userID uint) ([]model.UserIntegration, error) {
+	var integrations []model.UserIntegration
+	err := s.db.Where("user_id = ? AND provider IN ?", userID, exportProviders).Order("id").Find(&integrations).Error
+	return integrations, err
+}
+
+// Disconnect 删除用户的导出集成授权，服务方一侧的授权需用户自行撤销
+func (s *ExportService) Disconnect(userID uint, provider string) error {
+	result := s.db.Where("user_id = ? AND provider = ? AND provider IN ?", userID, provider, exportProviders).
+		Delete(&model.UserIntegration{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIntegrationNotConnected
+	}
+	return nil
+}
+
+// Push 将会话的markdown推送到用户授权的服务方，返回新页面或文档的地址
+func (s *ExportService) Push(ctx context.Context, userID, conversationID uint, provider string, req *ExportRequest) (*ExportResult, error) {
+	if err := s.checkProvider(provider); err != nil {
+		return nil, err
+	}
+	if provider == model.IntegrationNotion && req.ParentPageID == "" {
+		return nil, ErrExportTargetRequired
+	}
+
+	var integration model.UserIntegration
+	err := s.db.Where("user_id = ? AND provider = ?", userID, provider).First(&integration).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrIntegrationNotConnected
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	title, markdown, err := s.Markdown(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.accessToken(ctx, &integration)
+	if err != nil {
+		return nil, err
+	}
+
+	var url string
+	switch provider {
+	case model.IntegrationNotion:
+		url, err = s.notion.CreatePage(ctx, accessToken, req.ParentPageID, title, markdown)
+	case model.IntegrationGoogle:
+		url, err = s.google.CreateDocument(ctx, accessToken, req.FolderID, title, markdown)
+	}
+	if errors.Is(err, notion.ErrUnauthorized) || errors.Is(err, gdocs.ErrUnauthorized) {
+		return nil, ErrIntegrationExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.db.Model(&integration).Update("last_exported_at", time.Now())
+	return &ExportResult{Provider: provider, URL: url}, nil
+}
+
+// accessToken 解密访问令牌，Google令牌即将过期时先刷新并保存
+func (s *ExportService) accessToken(ctx context.Context, integration *model.UserIntegration) (string, error) {
+	return integrationAccessToken(ctx, s.db, s.box, integration, func(ctx context.Context, refreshToken string) (string, time.Time, error) {
+		token, err := s.google.Refresh(ctx, refreshToken)
+		if errors.Is(err, gdocs.ErrUnauthorized) {
+			return "", time.Time{}, ErrIntegrationExpired
+		}
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return token.AccessToken, token.ExpiresAt, nil
+	})
+}
+
+// integrationAccessToken 解密集成的访问令牌，即将过期时用refresh换取新令牌并加密保存
+func integrationAccessToken(ctx context.Context, db *gorm.DB, box *utils.SecretBox, integration *model.UserIntegration,
+	refresh func(ctx context.Context, refreshToken string) (string, time.Time, error)) (string, error) {
+	if integration.ExpiresAt == nil || time.Until(*integration.ExpiresAt) > tokenRefreshMargin {
+		return box.Decrypt(integration.EncryptedAccessToken)
+	}
+	if integration.EncryptedRefreshToken == "" {
+		return "", ErrIntegrationExpired
+	}
+
+	refreshToken, err := box.Decrypt(integration.EncryptedRefreshToken)
+	if err != nil {
+		return "", err
+	}
+	accessToken, expiresAt, err := refresh(ctx, refreshToken)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := box.Encrypt(accessToken)
+	if err != nil {
+		return "", err
+	}
+	if err := db.Model(integration).Updates(map[string]interface{}{
+		"encrypted_access_token": encrypted,
+		"expires_at":             expiresAt,
+	}).Error; err != nil {
+		return "", err
+	}
+	return accessToken, nil
+}
+
+func (s *ExportService) checkProvider(provider string) error {
+	switch provider {
+	case model.IntegrationNotion:
+		if s.notion == nil {
+			return ErrIntegrationDisabled
+		}
+	case model.IntegrationGoogle:
+		if s.google == nil {
+			return ErrIntegrationDisabled
+		}
+	default:
+		return ErrIntegrationDisabled
+	}
+	return nil
+}
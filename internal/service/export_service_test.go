@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+)
+
+func TestConsumeOAuthState(t *testing.T) {
+	db := newTestDB(t)
+	owner := createTestUser(t, db, model.User{})
+	other := createTestUser(t, db, model.User{})
+
+	tests := []struct {
+		name    string
+		purpose string
+		userID  uint
+		expired bool
+		reuse   bool
+		want    error
+	}{
+		{name: "owner completes", purpose: "calendar", userID: owner.ID, want: nil},
+		{name: "another user cannot use the state", purpose: "calendar", userID: other.ID, want: ErrInvalidOAuthState},
+		{name: "other purpose", purpose: "export:notion", userID: owner.ID, want: ErrInvalidOAuthState},
+		{name: "expired", purpose: "calendar", userID: owner.ID, expired: true, want: ErrInvalidOAuthState},
+		{name: "single use", purpose: "calendar", userID: owner.ID, reuse: true, want: ErrInvalidOAuthState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := newOAuthState(db, "calendar", owner.ID)
+			if err != nil {
+				t.Fatalf("newOAuthState: %v", err)
+			}
+			if tt.expired {
+				db.Model(&model.OAuthState{}).Where("state_hash = ?", utils.HashToken(state)).
+					Update("expires_at", time.Now().Add(-time.Minute))
+			}
+			if tt.reuse {
+				if err := consumeOAuthState(db, "calendar", state, owner.ID); err != nil {
+					t.Fatalf("first use: %v", err)
+				}
+			}
+
+			if err := consumeOAuthState(db, tt.purpose, state, tt.userID); !errors.Is(err, tt.want) {
+				t.Fatalf("consumeOAuthState() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMessageNotFound  = errors.New("message not found")
+	ErrFeedbackNotFound = errors.New("feedback not found")
+)
+
+type RateMessageRequest struct {
+	Rating  string `json:"rating" validate:"required,oneof=up down"`
+	Comment string `json:"comment" validate:"max=1000"`
+}
+
+// FeedbackService 用户对AI回复的评价，灰度模型生成的回复的差评率用于判断是否回滚
+type FeedbackService struct {
+	db *gorm.DB
+}
+
+func NewFeedbackService(db *gorm.DB) *FeedbackService {
+	return &FeedbackService{db: db}
+}
+
+// assistantMessage 获取用户会话中的AI回复
+func (s *FeedbackService) assistantMessage(userID, conversationID, messageID uint) (*model.Message, error) {
+	var message model.Message
+	err := s.db.Joins("JOIN conversations ON conversations.id = messages.conversation_id AND conversations.deleted_at IS NULL").
+		Where("messages.id = ? AND messages.conversation_id = ? AND messages.role = ? AND conversations.user_id = ?",
+			messageID, conversationID, "assistant", userID).
+		First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// Rate 评价AI回复，已评价时覆盖原评价
+func (s *FeedbackService) Rate(userID, conversationID, messageID uint, req *RateMessageRequest) (*model.MessageFeedback, error) {
+	message, err := s.assistantMessage(userID, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	feedback := model.MessageFeedback{
+		MessageID: message.ID,
+		UserID:    userID,
+		Rating:    req.Rating,
+		Comment:   req.Comment,
+		CanaryID:  message.CanaryID,
+	}
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "comment", "updated_at"}),
+	}).Create(&feedback).Error
+	if err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// Remove 撤销对AI回复的评价
+func (s *FeedbackService) Remove(userID, conversationID, messageID uint) error {
+	if _, err := s.assistantMessage(userID, conversationID, messageID); err != nil {
+		return err
+	}
+	result := s.db.Where("message_id = ? AND user_id = ?", messageID, userID).Delete(&model.MessageFeedback{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedbackNotFound
+	}
+	return nil
+}
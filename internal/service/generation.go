@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"ai-chat-backend/internal/model"
+)
+
+var (
+	ErrNoActiveGeneration  = errors.New("no reply is being generated in this conversation")
+	ErrGenerationCancelled = errors.New("generation cancelled")
+)
+
+// activeGeneration 一次进行中的流式生成
+type activeGeneration struct {
+	userID uint
+	cancel context.CancelCauseFunc
+}
+
+// generationRegistry 按会话登记进行中的流式生成，取消时以ErrGenerationCancelled结束其context。
+// 登记只在本实例内有效，多实例部署时取消请求需与生成请求到达同一实例
+type generationRegistry struct {
+	mu     sync.Mutex
+	active map[uint]map[*activeGeneration]struct{}
+}
+
+func newGenerationRegistry() *generationRegistry {
+	return &generationRegistry{active: make(map[uint]map[*activeGeneration]struct{})}
+}
+
+// begin 登记会话的一次生成，返回可被取消的context和生成结束时调用的注销函数
+func (r *generationRegistry) begin(ctx context.Context, userID, conversationID uint) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	gen := &activeGeneration{userID: userID, cancel: cancel}
+
+	r.mu.Lock()
+	if r.active[conversationID] == nil {
+		r.active[conversationID] = make(map[*activeGeneration]struct{})
+	}
+	r.active[conversationID][gen] = struct{}{}
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.active[conversationID], gen)
+		if len(r.active[conversationID]) == 0 {
+			delete(r.active, conversationID)
+		}
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel 取消用户在会话中进行中的全部生成，没有进行中的生成时返回ErrNoActiveGeneration
+func (r *generationRegistry) cancel(userID, conversationID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancelled := 0
+	for gen := range r.active[conversationID] {
+		if gen.userID != userID {
+			continue
+		}
+		gen.cancel(ErrGenerationCancelled)
+		cancelled++
+	}
+	if cancelled == 0 {
+		return ErrNoActiveGeneration
+	}
+	return nil
+}
+
+// generationCancelled 生成是否被CancelGeneration取消，客户端断开等其他原因结束的context返回false
+func generationCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrGenerationCancelled)
+}
+
+// CancelGeneration 中止会话中进行中的流式生成：关闭模型的流式输出，已生成的部分作为回复保存，
+// 已消耗的token按预估用量计费
+func (s *ChatService) CancelGeneration(userID, conversationID uint) error {
+	return s.generations.cancel(userID, conversationID)
+}
+
+// saveCancelled 生成被取消后保存已推送的部分回复，并按预估用量扣减额度。
+// 取消前尚未输出内容时不保存回复，仅计入发送给模型的上下文
+func (s *ChatService) saveCancelled(ctx context.Context, userID uint, conversation *model.Conversation, userMessage *model.Message, gen *generator, partial string, meter *usageMeter) (*model.Message, *model.Message, bool, error) {
+	// 原context已取消，保存时不再受其影响
+	ctx = context.WithoutCancel(ctx)
+	meter.finish(nil)
+
+	charged := userMessage
+	var assistantMessage *model.Message
+	if partial != "" {
+		assistantMessage = &model.Message{
+			ConversationID: conversation.ID,
+			Role:           "assistant",
+			Content:        partial,
+			CanaryID:       gen.canaryID,
+			Cancelled:      true,
+			Model:          gen.ai.ModelName(),
+		}
+		if err := s.saveMessage(ctx, conversation, assistantMessage); err != nil {
+			return userMessage, nil, false, fmt.Errorf("failed to save cancelled reply: %w", err)
+		}
+		charged = assistantMessage
+	}
+	s.recordGeneration(userID, gen, *meter.final, charged)
+	return userMessage, assistantMessage, false, nil
+}
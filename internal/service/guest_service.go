@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// guestCleanupBatch 每批删除的过期访客数
+const guestCleanupBatch = 200
+
+// guestBlockFactor 同一IP的签发请求达到上限的该倍数时视为滥用并封禁
+const guestBlockFactor = 3
+
+var (
+	ErrGuestUnavailable    = errors.New("guest access is not available")
+	ErrGuestTokenLimit     = errors.New("too many guest sessions from this address")
+	ErrGuestBlocked        = errors.New("guest access from this address is temporarily blocked")
+	ErrGuestClientRejected = errors.New("guest access requires a User-Agent header")
+	ErrGuestQuotaExceeded  = errors.New("free message quota used up, please register to continue")
+	ErrGuestTokenInvalid   = errors.New("invalid guest token")
+)
+
+// GuestService 访客试用：未注册时按IP签发访客token，在统计周期内可发送少量免费消息。
+// 访客对应一个guest标记的用户，注册时携带访客token即可将其会话转入新账号。
+// 额度和签发次数记录在Redis中，同时按IP和访客计数，换IP或重新签发都不能重置额度
+type GuestService struct {
+	db  *gorm.DB
+	rdb *redis.Client
+	cfg config.GuestConfig
+}
+
+// NewGuestService rdb为nil或未配置额度时不开放访客试用
+func NewGuestService(db *gorm.DB, rdb *redis.Client, cfg config.GuestConfig) *GuestService {
+	return &GuestService{db: db, rdb: rdb, cfg: cfg}
+}
+
+// GuestQuota 访客的免费消息额度
+type GuestQuota struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+}
+
+// GuestSession 新签发的访客token
+type GuestSession struct {
+	Token string     `json:"token"`
+	User  model.User `json:"user"`
+	Quota GuestQuota `json:"quota"`
+}
+
+// Enabled 是否开放访客试用
+func (s *GuestService) Enabled() bool {
+	return s.rdb != nil && s.cfg.MessageQuota > 0
+}
+
+func (s *GuestService) ipKey(ip, name string) string {
+	return fmt.Sprintf("guest:ip:%s:%s", ip, name)
+}
+
+func (s *GuestService) userKey(userID uint) string {
+	return fmt.Sprintf("guest:user:%d:messages", userID)
+}
+
+// Create 为IP签发访客token并创建访客用户
+func (s *GuestService) Create(ctx context.Context, ip, userAgent string) (*GuestSession, error) {
+	if !s.Enabled() {
+		return nil, ErrGuestUnavailable
+	}
+	if err := s.checkClient(ctx, ip, userAgent); err != nil {
+		return nil, err
+	}
+
+	issued, err := s.incr(ctx, s.ipKey(ip, "tokens"))
+	if err != nil {
+		return nil, err
+	}
+	if issued > int64(s.cfg.TokensPerIP) {
+		// 反复请求新token通常是在绕过额度，封禁一段时间
+		if issued >= int64(guestBlockFactor*s.cfg.TokensPerIP) {
+			if err := s.rdb.Set(ctx, s.ipKey(ip, "blocked"), 1, s.cfg.BlockDuration).Err(); err != nil {
+				return nil, err
+			}
+			log.Printf("Blocked guest access from %s after %d token requests", ip, issued)
+		}
+		return nil, ErrGuestTokenLimit
+	}
+
+	// 该IP的额度已用完时不再签发
+	used, err := s.count(ctx, s.ipKey(ip, "messages"))
+	if err != nil {
+		return nil, err
+	}
+	if used >= int64(s.cfg.MessageQuota) {
+		return nil, ErrGuestQuotaExceeded
+	}
+
+	user, err := s.createUser()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateGuestJWT(user.ID, config.Load().JWT.Secret, s.cfg.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GuestSession{
+		Token: token,
+		User:  *user,
+		Quota: GuestQuota{Limit: s.cfg.MessageQuota, Remaining: s.cfg.MessageQuota - int(used)},
+	}, nil
+}
+
+// createUser 创建访客用户，邮箱和密码为随机值，不能用于登录
+func (s *GuestService) createUser() (*model.User, error) {
+	suffix, err := utils.GenerateToken(12)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := utils.HashPassword(secret)
+	if err != nil {
+		return nil, err
+	}
+	region, err := normalizeRegion("", config.Load().Region)
+	if err != nil {
+		return nil, err
+	}
+
+	user := model.User{
+		Email:    "guest-" + suffix + "@guest.invalid",
+		Password: hashedPassword,
+		Nickname: "Guest",
+		IsActive: true,
+		Region:   region,
+		Guest:    true,
+	}
+	if err := s.db.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ConsumeMessage 访客发送消息前扣减一次额度，IP和访客的计数都不能超过额度
+func (s *GuestService) ConsumeMessage(ctx context.Context, userID uint, ip, userAgent string) (*GuestQuota, error) {
+	if !s.Enabled() {
+		return nil, ErrGuestUnavailable
+	}
+	if err := s.checkClient(ctx, ip, userAgent); err != nil {
+		return nil, err
+	}
+
+	byIP, err := s.incr(ctx, s.ipKey(ip, "messages"))
+	if err != nil {
+		return nil, err
+	}
+	byUser, err := s.incr(ctx, s.userKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	used := max(byIP, byUser)
+	if used > int64(s.cfg.MessageQuota) {
+		return nil, ErrGuestQuotaExceeded
+	}
+	return &GuestQuota{Limit: s.cfg.MessageQuota, Remaining: s.cfg.MessageQuota - int(used)}, nil
+}
+
+// checkClient 拒绝被封禁的IP和不带User-Agent的请求（多为脚本）
+func (s *GuestService) checkClient(ctx context.Context, ip, userAgent string) error {
+	if strings.TrimSpace(userAgent) == "" {
+		return ErrGuestClientRejected
+	}
+	blocked, err := s.rdb.Exists(ctx, s.ipKey(ip, "blocked")).Result()
+	if err != nil {
+		return err
+	}
+	if blocked > 0 {
+		return ErrGuestBlocked
+	}
+	return nil
+}
+
+// incr 计数加一，第一次计数时设置统计周期
+func (s *GuestService) incr(ctx context.Context, key string) (int64, error) {
+	n, err := s.rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := s.rdb.Expire(ctx, key, s.cfg.Window).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (s *GuestService) count(ctx context.Context, key string) (int64, error) {
+	n, err := s.rdb.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// DeleteExpired 删除token已过期且未注册的访客及其会话和消息，返回删除的访客数
+func (s *GuestService) DeleteExpired() (int64, error) {
+	var deleted int64
+	cutoff := time.Now().Add(-s.cfg.TokenTTL)
+	for {
+		var guestIDs []uint
+		if err := s.db.Model(&model.User{}).Where("guest = ? AND created_at < ?", true, cutoff).
+			Order("id ASC").Limit(guestCleanupBatch).Pluck("id", &guestIDs).Error; err != nil {
+			return deleted, err
+		}
+		if len(guestIDs) == 0 {
+			return deleted, nil
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			conversations := tx.Model(&model.Conversation{}).Select("id").Where("user_id IN ?", guestIDs)
+			if err := tx.Where("conversation_id IN (?)", conversations).Delete(&model.Message{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id IN ?", guestIDs).Delete(&model.Conversation{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("id IN ? AND guest = ?", guestIDs, true).Delete(&model.User{}).Error
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int64(len(guestIDs))
+
+		if len(guestIDs) < guestCleanupBatch {
+			return deleted, nil
+		}
+	}
+}
+
+// Start 按间隔定期删除过期访客，paused返回true时跳过本轮（如只读模式），返回停止函数
+func (s *GuestService) Start(interval time.Duration, paused func() bool) func() {
+	if interval <= 0 || !s.Enabled() {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				deleted, err := s.DeleteExpired()
+				if err != nil {
+					log.Printf("Failed to delete expired guests: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					log.Printf("Deleted %d expired guests", deleted)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// claimGuest 注册时将访客的会话和计数转入新用户并删除访客，需在创建用户的事务中调用
+func claimGuest(tx *gorm.DB, token string, userID uint) error {
+	guestID, err := guestIDFromToken(token)
+	if err != nil {
+		return err
+	}
+
+	var guest model.User
+	if err := tx.Where("id = ? AND guest = ?", guestID, true).First(&guest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGuestTokenInvalid
+		}
+		return err
+	}
+
+	if err := tx.Model(&model.Conversation{}).Where("user_id = ?", guest.ID).Update("user_id", userID).Error; err != nil {
+		return err
+	}
+	if err := incrementUserCounter(tx, userID, "conversation_count", guest.ConversationCount); err != nil {
+		return err
+	}
+	if err := incrementUserCounter(tx, userID, "message_count", guest.MessageCount); err != nil {
+		return err
+	}
+	return tx.Delete(&guest).Error
+}
+
+// guestIDFromToken 验证访客token，密钥轮换期间同时接受旧密钥签发的token
+func guestIDFromToken(token string) (uint, error) {
+	cfg := config.Load()
+	claims, err := utils.ValidateJWT(token, cfg.JWT.Secret)
+	if err != nil && cfg.JWT.PreviousSecret != "" {
+		claims, err = utils.ValidateJWT(token, cfg.JWT.PreviousSecret)
+	}
+	if err != nil || !claims.Guest {
+		return 0, ErrGuestTokenInvalid
+	}
+	return claims.UserID, nil
+}
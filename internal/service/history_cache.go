@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"ai-chat-backend/internal/cache"
+	"ai-chat-backend/internal/model"
+)
+
+// HistoryCache 会话上下文缓存，未配置Redis或CHAT_HISTORY_CACHE_TTL为0时为nil。
+// 其他修改消息的服务（如冷存储）需要在修改后使缓存失效
+func (s *ChatService) HistoryCache() *cache.HistoryCache {
+	return s.history
+}
+
+// appendHistory 新消息写入缓存，追加失败时使缓存失效，避免之后读到缺少该消息的上下文
+func (s *ChatService) appendHistory(ctx context.Context, msg *model.Message) {
+	if s.history == nil {
+		return
+	}
+	if err := s.history.Append(ctx, msg); err != nil {
+		log.Printf("Failed to append message %d to history cache: %v", msg.ID, err)
+		invalidateHistory(s.history, msg.ConversationID)
+	}
+}
+
+// invalidateHistory 消息被压缩、删除、涂抹、移动或移入冷存储后使会话的上下文缓存失效，history为nil时不处理
+func invalidateHistory(history *cache.HistoryCache, conversationIDs ...uint) {
+	if history == nil || len(conversationIDs) == 0 {
+		return
+	}
+	if err := history.Invalidate(context.Background(), conversationIDs...); err != nil {
+		log.Printf("Failed to invalidate history cache for conversations %v: %v", conversationIDs, err)
+	}
+}
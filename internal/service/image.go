@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// imageTimeout 图像生成明显慢于文本生成，单独设置超时
+	imageTimeout = 2 * time.Minute
+	// maxImageSize 图像模型返回或下载的图片大小上限
+	maxImageSize = 10 << 20
+)
+
+var imageClient = &http.Client{Timeout: imageTimeout}
+
+// GenerateImage 调用图像模型（OpenAI兼容的/images/generations接口）按提示词生成一张图片，返回图片数据。
+// Azure时imageModel为部署名
+func (s *AIService) GenerateImage(ctx context.Context, imageModel, prompt, size string) ([]byte, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":  imageModel,
+		"prompt": prompt,
+		"n":      1,
+		"size":   size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := strings.TrimRight(s.endpoint.BaseURL, "/") + "/images/generations"
+	if s.endpoint.Provider == ProviderAzure {
+		endpoint = fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s",
+			strings.TrimRight(s.endpoint.BaseURL, "/"), url.PathEscape(imageModel), url.QueryEscape(s.endpoint.APIVersion))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case s.endpoint.tokenSource != nil:
+		token, err := s.endpoint.tokenSource.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case s.endpoint.Provider == ProviderAzure:
+		req.Header.Set("api-key", s.apiKey())
+	default:
+		req.Header.Set("Authorization", "Bearer "+s.apiKey())
+	}
+
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("image generation failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data []struct {
+			B64JSON string `json:"b64_json"`
+			URL     string `json:"url"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 2*maxImageSize)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("image generation returned %d: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != nil {
+			return nil, fmt.Errorf("image generation returned %d: %s", resp.StatusCode, result.Error.Message)
+		}
+		return nil, fmt.Errorf("image generation returned %d", resp.StatusCode)
+	}
+	if len(result.Data) == 0 {
+		return nil, errors.New("image generation returned no image")
+	}
+
+	// gpt-image等模型只返回base64，dall-e默认返回有时效的地址
+	if result.Data[0].B64JSON != "" {
+		return base64.StdEncoding.DecodeString(result.Data[0].B64JSON)
+	}
+	if result.Data[0].URL != "" {
+		return downloadImage(ctx, result.Data[0].URL)
+	}
+	return nil, errors.New("image generation returned no image")
+}
+
+func downloadImage(ctx context.Context, imageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download generated image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download generated image: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, errors.New("generated image is too large")
+	}
+	return data, nil
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 代入会话的审计操作
+const (
+	auditImpersonationRequested = "impersonation.requested"
+	auditImpersonationApproved  = "impersonation.approved"
+	auditImpersonationDenied    = "impersonation.denied"
+	auditImpersonationStarted   = "impersonation.started"
+	auditImpersonationEnded     = "impersonation.ended"
+	auditImpersonationRequest   = "impersonation.request"
+)
+
+// defaultImpersonationDuration 未指定时长时的代入时长，不超过配置的最长时间
+const defaultImpersonationDuration = 30 * time.Minute
+
+var (
+	ErrImpersonationNotFound   = errors.New("impersonation not found")
+	ErrImpersonationNotAllowed = errors.New("admins cannot be impersonated")
+	ErrImpersonationState      = errors.New("impersonation is not in a valid state for this operation")
+	ErrImpersonationInactive   = errors.New("impersonation session has ended")
+)
+
+type CreateImpersonationRequest struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+	// DurationMinutes 代入时长（分钟），0表示默认30分钟，超过IMPERSONATION_MAX_DURATION时按上限
+	DurationMinutes int `json:"duration_minutes" validate:"omitempty,min=1,max=1440"`
+}
+
+// ImpersonationGrant 代入会话及签发的token，需要用户同意且尚未同意时Token为空
+type ImpersonationGrant struct {
+	Impersonation *model.Impersonation `json:"impersonation"`
+	Token         string               `json:"token,omitempty"`
+	ExpiresIn     int64                `json:"expires_in,omitempty"`
+}
+
+// ImpersonationDetail 代入会话及会话期间的审计记录
+type ImpersonationDetail struct {
+	Impersonation *model.Impersonation `json:"impersonation"`
+	AuditLogs     []model.AuditLog     `json:"audit_logs"`
+}
+
+// ImpersonationService 管理员代入用户身份排查问题：按配置先征得用户同意，签发限时token，
+// 会话的创建、同意、签发、结束以及会话期间的每个请求都写入审计日志并标明管理员
+type ImpersonationService struct {
+	db           *gorm.DB
+	cfg          config.ImpersonationConfig
+	jwt          config.JWTConfig
+	auditService *AuditService
+}
+
+func NewImpersonationService(db *gorm.DB, cfg *config.Config, auditService *AuditService) *ImpersonationService {
+	return &ImpersonationService{
+		db:           db,
+		cfg:          cfg.Impersonation,
+		jwt:          cfg.JWT,
+		auditService: auditService,
+	}
+}
+
+// Create 创建代入会话，需要用户同意时等待同意，否则直接签发token。不能代入管理员或自己
+func (s *ImpersonationService) Create(adminID, userID uint, req *CreateImpersonationRequest, ip string) (*ImpersonationGrant, error) {
+	var user model.User
+	if err := s.db.Select("id", "role").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.Role == model.RoleAdmin || userID == adminID {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	duration := defaultImpersonationDuration
+	if req.DurationMinutes > 0 {
+		duration = time.Duration(req.DurationMinutes) * time.Minute
+	}
+	if s.cfg.MaxDuration > 0 && duration > s.cfg.MaxDuration {
+		duration = s.cfg.MaxDuration
+	}
+
+	impersonation := &model.Impersonation{
+		AdminID:         adminID,
+		UserID:          userID,
+		Reason:          req.Reason,
+		Status:          model.ImpersonationApproved,
+		DurationSeconds: int64(duration / time.Second),
+		ConsentRequired: s.cfg.RequireConsent,
+	}
+	if s.cfg.RequireConsent {
+		deadline := time.Now().Add(s.cfg.ConsentTimeout)
+		impersonation.Status = model.ImpersonationPending
+		impersonation.ConsentDeadline = &deadline
+	}
+	if err := s.db.Create(impersonation).Error; err != nil {
+		return nil, err
+	}
+	s.auditService.RecordImpersonation(impersonation, auditImpersonationRequested, ip,
+		fmt.Sprintf("reason=%s duration=%s consent_required=%t", req.Reason, duration, impersonation.ConsentRequired))
+
+	if s.cfg.RequireConsent {
+		return &ImpersonationGrant{Impersonation: impersonation}, nil
+	}
+	return s.IssueToken(adminID, impersonation.ID, ip)
+}
+
+// IssueToken 为用户已同意的代入会话签发token，每个会话只签发一次，有效期从签发时开始计算
+func (s *ImpersonationService) IssueToken(adminID, impersonationID uint, ip string) (*ImpersonationGrant, error) {
+	impersonation, err := s.get(impersonationID)
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.AdminID != adminID {
+		return nil, ErrImpersonationNotFound
+	}
+
+	now := time.Now()
+	duration := time.Duration(impersonation.DurationSeconds) * time.Second
+	expiresAt := now.Add(duration)
+	result := s.db.Model(impersonation).Where("status = ?", model.ImpersonationApproved).Updates(map[string]interface{}{
+		"status":     model.ImpersonationActive,
+		"started_at": now,
+		"expires_at": expiresAt,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrImpersonationState
+	}
+	impersonation.Status = model.ImpersonationActive
+	impersonation.StartedAt = &now
+	impersonation.ExpiresAt = &expiresAt
+
+	token, err := utils.GenerateImpersonationJWT(impersonation.UserID, adminID, impersonation.ID, s.jwt.Secret, duration)
+	if err != nil {
+		return nil, err
+	}
+	s.auditService.RecordImpersonation(impersonation, auditImpersonationStarted, ip, fmt.Sprintf("expires_at=%s", expiresAt.UTC().Format(time.RFC3339)))
+	return &ImpersonationGrant{Impersonation: impersonation, Token: token, ExpiresIn: impersonation.DurationSeconds}, nil
+}
+
+// Respond 用户同意或拒绝等待中的代入请求，超过同意截止时间后不能再同意
+func (s *ImpersonationService) Respond(userID, impersonationID uint, approve bool, ip string) (*model.Impersonation, error) {
+	impersonation, err := s.get(impersonationID)
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.UserID != userID {
+		return nil, ErrImpersonationNotFound
+	}
+	now := time.Now()
+	if impersonation.ConsentDeadline != nil && now.After(*impersonation.ConsentDeadline) {
+		return nil, ErrImpersonationState
+	}
+
+	status, action := model.ImpersonationDenied, auditImpersonationDenied
+	if approve {
+		status, action = model.ImpersonationApproved, auditImpersonationApproved
+	}
+	result := s.db.Model(impersonation).Where("status = ?", model.ImpersonationPending).Updates(map[string]interface{}{
+		"status":       status,
+		"responded_at": now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrImpersonationState
+	}
+	impersonation.Status = status
+	impersonation.RespondedAt = &now
+	s.auditService.RecordImpersonation(impersonation, action, ip, "")
+	return impersonation, nil
+}
+
+// End 结束代入会话，管理员和被代入的用户都可以结束，已签发的token随即失效
+func (s *ImpersonationService) End(actorID, impersonationID uint, ip string) error {
+	impersonation, err := s.get(impersonationID)
+	if err != nil {
+		return err
+	}
+	if impersonation.AdminID != actorID && impersonation.UserID != actorID {
+		return ErrImpersonationNotFound
+	}
+
+	now := time.Now()
+	result := s.db.Model(impersonation).
+		Where("status IN ?", []string{model.ImpersonationPending, model.ImpersonationApproved, model.ImpersonationActive}).
+		Updates(map[string]interface{}{
+			"status":   model.ImpersonationEnded,
+			"ended_at": now,
+			"ended_by": actorID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrImpersonationState
+	}
+	s.auditService.RecordImpersonation(impersonation, auditImpersonationEnded, ip, fmt.Sprintf("ended_by=%d", actorID))
+	return nil
+}
+
+// Check 检查代入token对应的会话仍然有效，会话被结束或已到期时返回ErrImpersonationInactive
+func (s *ImpersonationService) Check(impersonationID uint) (*model.Impersonation, error) {
+	impersonation, err := s.get(impersonationID)
+	if errors.Is(err, ErrImpersonationNotFound) {
+		return nil, ErrImpersonationInactive
+	}
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.Status != model.ImpersonationActive || impersonation.ExpiresAt == nil || time.Now().After(*impersonation.ExpiresAt) {
+		return nil, ErrImpersonationInactive
+	}
+	return impersonation, nil
+}
+
+// RecordRequest 记录代入期间的一个请求
+func (s *ImpersonationService) RecordRequest(impersonation *model.Impersonation, method, path string, status int, ip string) {
+	s.auditService.RecordImpersonation(impersonation, auditImpersonationRequest, ip, fmt.Sprintf("%s %s status=%d", method, path, status))
+}
+
+// ListForUser 用户账号上的代入会话，按创建时间倒序
+func (s *ImpersonationService) ListForUser(userID uint) ([]model.Impersonation, error) {
+	var impersonations []model.Impersonation
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Limit(100).Find(&impersonations).Error
+	return impersonations, err
+}
+
+// List 管理员查看代入会话，userID/adminID为0时不过滤
+func (s *ImpersonationService) List(userID, adminID uint, page, pageSize int) ([]model.Impersonation, int64, error) {
+	query := s.db.Model(&model.Impersonation{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if adminID != 0 {
+		query = query.Where("admin_id = ?", adminID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var impersonations []model.Impersonation
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&impersonations).Error; err != nil {
+		return nil, 0, err
+	}
+	return impersonations, total, nil
+}
+
+// Detail 代入会话及其全部审计记录（含会话期间的请求），按时间正序
+func (s *ImpersonationService) Detail(impersonationID uint) (*ImpersonationDetail, error) {
+	impersonation, err := s.get(impersonationID)
+	if err != nil {
+		return nil, err
+	}
+	detail := &ImpersonationDetail{Impersonation: impersonation, AuditLogs: []model.AuditLog{}}
+	if err := s.db.Where("impersonation_id = ?", impersonationID).Order("id ASC").Find(&detail.AuditLogs).Error; err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+func (s *ImpersonationService) get(impersonationID uint) (*model.Impersonation, error) {
+	var impersonation model.Impersonation
+	err := s.db.Where("id = ?", impersonationID).First(&impersonation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImpersonationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
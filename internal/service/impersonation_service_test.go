@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+)
+
+// 代入会话被结束或到期后token立即失效
+func TestImpersonationCheck(t *testing.T) {
+	db := newTestDB(t)
+	admin := createTestUser(t, db, model.User{Role: "admin"})
+	user := createTestUser(t, db, model.User{})
+	svc := NewImpersonationService(db, &config.Config{}, NewAuditService(db))
+
+	tests := []struct {
+		name    string
+		status  string
+		expires time.Duration
+		end     bool
+		want    error
+	}{
+		{name: "active", status: model.ImpersonationActive, expires: time.Hour, want: nil},
+		{name: "expired", status: model.ImpersonationActive, expires: -time.Minute, want: ErrImpersonationInactive},
+		{name: "ended by user", status: model.ImpersonationActive, expires: time.Hour, end: true, want: ErrImpersonationInactive},
+		{name: "ended before check", status: model.ImpersonationEnded, expires: time.Hour, want: ErrImpersonationInactive},
+		{name: "not issued", status: model.ImpersonationApproved, expires: time.Hour, want: ErrImpersonationInactive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiresAt := time.Now().Add(tt.expires)
+			impersonation := model.Impersonation{
+				AdminID:   admin.ID,
+				UserID:    user.ID,
+				Reason:    "support ticket",
+				Status:    tt.status,
+				ExpiresAt: &expiresAt,
+			}
+			if err := db.Create(&impersonation).Error; err != nil {
+				t.Fatalf("create impersonation: %v", err)
+			}
+			if tt.end {
+				if err := svc.End(user.ID, impersonation.ID, "127.0.0.1"); err != nil {
+					t.Fatalf("End: %v", err)
+				}
+			}
+
+			if _, err := svc.Check(impersonation.ID); !errors.Is(err, tt.want) {
+				t.Fatalf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := svc.Check(0); !errors.Is(err, ErrImpersonationInactive) {
+		t.Fatalf("Check(missing) = %v, want %v", err, ErrImpersonationInactive)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incognitoStore 无痕会话的消息存储，消息只保存在Redis中并在TTL后过期
+type incognitoStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func newIncognitoStore(rdb *redis.Client, ttl time.Duration) *incognitoStore {
+	return &incognitoStore{rdb: rdb, ttl: ttl}
+}
+
+func (s *incognitoStore) messagesKey(conversationID uint) string {
+	return fmt.Sprintf("incognito:conversation:%d:messages", conversationID)
+}
+
+func (s *incognitoStore) seqKey(conversationID uint) string {
+	return fmt.Sprintf("incognito:conversation:%d:seq", conversationID)
+}
+
+// Append 追加一条消息并刷新过期时间
+func (s *incognitoStore) Append(ctx context.Context, msg *model.Message) error {
+	id, err := s.rdb.Incr(ctx, s.seqKey(msg.ConversationID)).Result()
+	if err != nil {
+		return err
+	}
+	msg.ID = uint(id)
+	now := time.Now()
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.RPush(ctx, s.messagesKey(msg.ConversationID), data)
+	pipe.Expire(ctx, s.messagesKey(msg.ConversationID), s.ttl)
+	pipe.Expire(ctx, s.seqKey(msg.ConversationID), s.ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Range 按时间顺序读取[start, stop]范围内的消息，stop为-1表示到末尾
+func (s *incognitoStore) Range(ctx context.Context, conversationID uint, start, stop int64) ([]model.Message, error) {
+	items, err := s.rdb.LRange(ctx, s.messagesKey(conversationID), start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]model.Message, 0, len(items))
+	for _, item := range items {
+		var msg model.Message
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// Count 获取消息数量
+func (s *incognitoStore) Count(ctx context.Context, conversationID uint) (int64, error) {
+	return s.rdb.LLen(ctx, s.messagesKey(conversationID)).Result()
+}
+
+// Delete 删除会话的全部消息
+func (s *incognitoStore) Delete(ctx context.Context, conversationID uint) error {
+	return s.rdb.Del(ctx, s.messagesKey(conversationID), s.seqKey(conversationID)).Err()
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+// 无痕会话超过historyLimit条消息后，上下文取最近的消息而不是最早的
+func TestLoadHistoryIncognito(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	store := newIncognitoStore(rdb, time.Minute)
+	conversation := &model.Conversation{ID: uint(time.Now().UnixNano() % 1e9), Incognito: true}
+	t.Cleanup(func() {
+		rdb.Del(ctx, store.messagesKey(conversation.ID), store.seqKey(conversation.ID))
+	})
+
+	total := historyLimit + 5
+	for i := 0; i < total; i++ {
+		msg := &model.Message{ConversationID: conversation.ID, Role: model.RoleUser, Content: fmt.Sprintf("message %d", i)}
+		if err := store.Append(ctx, msg); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	s := &ChatService{incognito: store}
+	history, err := s.loadHistory(ctx, conversation)
+	if err != nil {
+		t.Fatalf("loadHistory: %v", err)
+	}
+	if len(history) != historyLimit {
+		t.Fatalf("len(history) = %d, want %d", len(history), historyLimit)
+	}
+	if first, want := history[0].Content, fmt.Sprintf("message %d", total-historyLimit); first != want {
+		t.Fatalf("first message = %q, want %q", first, want)
+	}
+	if last, want := history[len(history)-1].Content, fmt.Sprintf("message %d", total-1); last != want {
+		t.Fatalf("last message = %q, want %q", last, want)
+	}
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// jobEventBufferSize 每个监听者待发送进度的缓冲数，写满时丢弃中间进度，最终状态可通过查询获取
+const jobEventBufferSize = 16
+
+const (
+	// jobLease 任务租约时长，实例退出后超过该时间未续期的任务视为中断
+	jobLease = time.Minute
+	// jobLeaseRenewInterval 续期本实例任务租约的间隔
+	jobLeaseRenewInterval = jobLease / 3
+)
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobQueueFull = errors.New("too many pending jobs, please retry later")
+)
+
+// JobProgress 任务执行中报告进度，progress为完成百分比
+type JobProgress func(progress int, message string)
+
+// JobFunc 任务的执行函数，返回值以JSON保存为任务结果
+type JobFunc func(ctx context.Context, progress JobProgress) (interface{}, error)
+
+// JobEvent 推送给监听者的任务状态变化
+type JobEvent struct {
+	JobID    uint            `json:"job_id"`
+	Status   string          `json:"status"`
+	Progress int             `json:"progress"`
+	Message  string          `json:"message,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Finished 任务是否已结束
+func (e JobEvent) Finished() bool {
+	return e.Status == model.JobStatusSucceeded || e.Status == model.JobStatusFailed
+}
+
+// JobEventOf 由任务记录生成事件，用于首次推送当前状态
+func JobEventOf(job *model.Job) JobEvent {
+	event := JobEvent{
+		JobID:    job.ID,
+		Status:   job.Status,
+		Progress: job.Progress,
+		Message:  job.Message,
+		Error:    job.Error,
+	}
+	if job.Result != "" {
+		event.Result = json.RawMessage(job.Result)
+	}
+	return event
+}
+
+type queuedJob struct {
+	job *model.Job
+	fn  JobFunc
+}
+
+// JobService 进程内的后台任务队列：任务记录落库，由固定数量的worker执行，进度推送给本实例上的监听者。
+// 未完成的任务由本实例定期续租，租约过期（所属实例已退出）的任务标记为失败
+type JobService struct {
+	db      *gorm.DB
+	workers int
+	queue   chan queuedJob
+	// owner 本实例的标识，写入创建的任务
+	owner string
+
+	mu        sync.Mutex
+	listeners map[uint]map[chan JobEvent]struct{}
+}
+
+func NewJobService(db *gorm.DB, workers, queueSize int) *JobService {
+	if workers < 1 {
+		workers = 1
+	}
+	owner, err := utils.GenerateToken(8)
+	if err != nil {
+		owner = fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return &JobService{
+		db:        db,
+		workers:   workers,
+		queue:     make(chan queuedJob, queueSize),
+		owner:     owner,
+		listeners: make(map[uint]map[chan JobEvent]struct{}),
+	}
+}
+
+// Start 启动worker和租约续期，返回停止函数，停止时取消正在执行的任务。
+// 启动时和每次续期时将租约已过期的任务（所属实例已退出）标记为失败，其他实例正在执行的任务不受影响
+func (s *JobService) Start() func() {
+	s.failExpired()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(jobLeaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.renewLeases()
+				s.failExpired()
+			}
+		}
+	}()
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case item := <-s.queue:
+					s.run(ctx, item)
+				}
+			}
+		}()
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// renewLeases 续期本实例未完成任务的租约
+func (s *JobService) renewLeases() {
+	if err := s.db.Model(&model.Job{}).
+		Where("owner = ? AND status IN ?", s.owner, []string{model.JobStatusQueued, model.JobStatusRunning}).
+		Update("lease_expires_at", time.Now().Add(jobLease)).Error; err != nil {
+		log.Printf("Failed to renew job leases: %v", err)
+	}
+}
+
+// failExpired 将租约已过期的未完成任务标记为失败。没有租约的是升级前创建的任务，同样视为中断
+func (s *JobService) failExpired() {
+	now := time.Now()
+	if err := s.db.Model(&model.Job{}).
+		Where("status IN ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)",
+			[]string{model.JobStatusQueued, model.JobStatusRunning}, now).
+		Updates(map[string]interface{}{
+			"status":      model.JobStatusFailed,
+			"error":       "interrupted by server restart",
+			"finished_at": now,
+		}).Error; err != nil {
+		log.Printf("Failed to mark interrupted jobs: %v", err)
+	}
+}
+
+// Enqueue 创建任务并加入队列，队列已满时返回ErrJobQueueFull
+func (s *JobService) Enqueue(userID uint, jobType string, fn JobFunc) (*model.Job, error) {
+	leaseExpiresAt := time.Now().Add(jobLease)
+	job := &model.Job{
+		UserID:         userID,
+		Type:           jobType,
+		Status:         model.JobStatusQueued,
+		Owner:          s.owner,
+		LeaseExpiresAt: &leaseExpiresAt,
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.queue <- queuedJob{job: job, fn: fn}:
+		return job, nil
+	default:
+		s.finish(job, nil, ErrJobQueueFull)
+		return nil, ErrJobQueueFull
+	}
+}
+
+func (s *JobService) run(ctx context.Context, item queuedJob) {
+	job := item.job
+	now := time.Now()
+	job.Status = model.JobStatusRunning
+	job.StartedAt = &now
+	if err := s.db.Model(job).Select("status", "started_at").Updates(job).Error; err != nil {
+		log.Printf("Failed to start job %d: %v", job.ID, err)
+	}
+	s.publish(JobEventOf(job))
+
+	progress := func(progress int, message string) {
+		if progress < 0 {
+			progress = 0
+		} else if progress > 100 {
+			progress = 100
+		}
+		job.Progress = progress
+		job.Message = truncateRunes(message, 255)
+		if err := s.db.Model(job).Select("progress", "message").Updates(job).Error; err != nil {
+			log.Printf("Failed to update progress of job %d: %v", job.ID, err)
+		}
+		s.publish(JobEventOf(job))
+	}
+
+	result, err := s.execute(ctx, item.fn, progress)
+	s.finish(job, result, err)
+}
+
+// execute 执行任务函数，panic视为失败
+func (s *JobService) execute(ctx context.Context, fn JobFunc, progress JobProgress) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx, progress)
+}
+
+func (s *JobService) finish(job *model.Job, result interface{}, err error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = model.JobStatusFailed
+		job.Error = truncateRunes(err.Error(), 255)
+	} else {
+		job.Status = model.JobStatusSucceeded
+		job.Progress = 100
+		if result != nil {
+			data, marshalErr := json.Marshal(result)
+			if marshalErr != nil {
+				log.Printf("Failed to encode result of job %d: %v", job.ID, marshalErr)
+			}
+			job.Result = string(data)
+		}
+	}
+	if dbErr := s.db.Model(job).Select("status", "progress", "result", "error", "finished_at").Updates(job).Error; dbErr != nil {
+		log.Printf("Failed to finish job %d: %v", job.ID, dbErr)
+	}
+	s.publish(JobEventOf(job))
+}
+
+// Get 获取用户的任务
+func (s *JobService) Get(userID, jobID uint) (*model.Job, error) {
+	var job model.Job
+	err := s.db.Where("id = ? AND user_id = ?", jobID, userID).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Listen 监听任务在本实例上的状态变化，返回事件通道和取消函数。任务结束后通道关闭
+func (s *JobService) Listen(jobID uint) (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, jobEventBufferSize)
+
+	s.mu.Lock()
+	if s.listeners[jobID] == nil {
+		s.listeners[jobID] = make(map[chan JobEvent]struct{})
+	}
+	s.listeners[jobID][ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.removeLocked(jobID, ch)
+	}
+}
+
+// publish 投递给任务的全部监听者，不阻塞任务执行；缓冲已满时丢弃本次进度，但最终状态一定送达
+func (s *JobService) publish(event JobEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.listeners[event.JobID] {
+		if event.Finished() {
+			// 腾出位置保证最终状态送达
+			select {
+			case ch <- event:
+			default:
+				<-ch
+				ch <- event
+			}
+			s.removeLocked(event.JobID, ch)
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// removeLocked 移除并关闭监听通道，重复调用无副作用
+func (s *JobService) removeLocked(jobID uint, ch chan JobEvent) {
+	channels := s.listeners[jobID]
+	if _, ok := channels[ch]; !ok {
+		return
+	}
+	delete(channels, ch)
+	close(ch)
+	if len(channels) == 0 {
+		delete(s.listeners, jobID)
+	}
+}
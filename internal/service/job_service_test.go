@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+// 启动时只中断租约已过期的任务，其他实例正在执行的任务不受影响
+func TestJobStartFailsOnlyExpiredLeases(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{})
+	s := NewJobService(db, 1, 1)
+
+	live := time.Now().Add(jobLease)
+	expired := time.Now().Add(-time.Second)
+	jobs := map[string]*model.Job{
+		"live":    {UserID: user.ID, Type: "test", Status: model.JobStatusRunning, Owner: "other", LeaseExpiresAt: &live},
+		"expired": {UserID: user.ID, Type: "test", Status: model.JobStatusRunning, Owner: "other", LeaseExpiresAt: &expired},
+		"legacy":  {UserID: user.ID, Type: "test", Status: model.JobStatusQueued},
+	}
+	for _, job := range jobs {
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Start()()
+
+	want := map[string]string{
+		"live":    model.JobStatusRunning,
+		"expired": model.JobStatusFailed,
+		"legacy":  model.JobStatusFailed,
+	}
+	for name, job := range jobs {
+		got, err := s.Get(user.ID, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != want[name] {
+			t.Errorf("%s job status = %s, want %s", name, got.Status, want[name])
+		}
+	}
+}
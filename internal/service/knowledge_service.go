@@ -0,0 +1,601 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/extract"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/rerank"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"gorm.io/gorm"
+)
+
+// documentIngestJobType 知识库文档提取任务的类型
+const documentIngestJobType = "document_ingest"
+
+var (
+	ErrCollectionNotFound  = errors.New("collection not found")
+	ErrDocumentNotFound    = errors.New("document not found")
+	ErrDocumentUnsupported = errors.New("unsupported document type, only PDF and text files can be added")
+	ErrInvalidChunking     = errors.New("chunk overlap must be smaller than chunk size")
+)
+
+// KnowledgeService 知识库：用户将上传的附件或网页加入知识库后，由后台任务提取文本（PDF文本层、OCR和表格）并按知识库的分块设置分块，
+// 配置了嵌入模型时同时生成分块向量，网页定期重新抓取。生成回复时对会话绑定的知识库做关键词和向量混合检索
+type KnowledgeService struct {
+	db                *gorm.DB
+	attachmentService *AttachmentService
+	planService       *PlanService
+	jobService        *JobService
+	extractor         *extract.Extractor
+	embedder          embedding.Embedder
+	reranker          *rerank.Client
+	crawler           *http.Client
+	cfg               config.RAGConfig
+	// onboarding 记录新手引导步骤，nil时不记录
+	onboarding *OnboardingService
+}
+
+func NewKnowledgeService(db *gorm.DB, attachmentService *AttachmentService, planService *PlanService, jobService *JobService, extractor *extract.Extractor, cfg config.RAGConfig) *KnowledgeService {
+	return &KnowledgeService{
+		db:                db,
+		attachmentService: attachmentService,
+		planService:       planService,
+		jobService:        jobService,
+		extractor:         extractor,
+		embedder:          newEmbedder(cfg),
+		reranker:          newReranker(cfg),
+		crawler:           newCrawlClient(cfg.CrawlTimeout),
+		cfg:               cfg,
+	}
+}
+
+// UseOnboarding 加入文档时记录新手引导步骤，启动时设置
+func (s *KnowledgeService) UseOnboarding(onboarding *OnboardingService) {
+	s.onboarding = onboarding
+}
+
+// NewExtractor 文本提取器，知识库提取和附件图片的文字识别共用
+func NewExtractor(cfg config.RAGConfig) *extract.Extractor {
+	return extract.New(extract.Config{
+		PDFToText: cfg.PDFToText,
+		PDFToPPM:  cfg.PDFToPPM,
+		Tesseract: cfg.Tesseract,
+		Languages: cfg.OCRLanguages,
+		MinChars:  cfg.OCRMinChars,
+		DPI:       cfg.OCRDPI,
+		MaxPages:  cfg.MaxPages,
+		Timeout:   cfg.ExtractTimeout,
+	})
+}
+
+// CollectionRequest 创建知识库请求，未指定的分块设置使用服务端默认值。
+// 指定OrgID时创建组织知识库（需为组织管理员），ReadRole默认为member
+type CollectionRequest struct {
+	Name         string `json:"name" validate:"required,max=100"`
+	Description  string `json:"description" validate:"max=500"`
+	ChunkSize    *int   `json:"chunk_size" validate:"omitempty,min=100,max=8000"`
+	ChunkOverlap *int   `json:"chunk_overlap" validate:"omitempty,min=0"`
+	Splitter     string `json:"splitter" validate:"omitempty,oneof=recursive markdown code"`
+	OrgID        *uint  `json:"org_id"`
+	ReadRole     string `json:"read_role" validate:"omitempty,oneof=admin member"`
+}
+
+// UpdateCollectionRequest 更新知识库请求，未提供的字段保持不变。分块设置修改后需要重新索引
+type UpdateCollectionRequest struct {
+	Name         *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description  *string `json:"description" validate:"omitempty,max=500"`
+	ChunkSize    *int    `json:"chunk_size" validate:"omitempty,min=100,max=8000"`
+	ChunkOverlap *int    `json:"chunk_overlap" validate:"omitempty,min=0"`
+	Splitter     *string `json:"splitter" validate:"omitempty,oneof=recursive markdown code"`
+	// ReadRole 只对组织知识库有效
+	ReadRole *string `json:"read_role" validate:"omitempty,oneof=admin member"`
+}
+
+// AddDocumentRequest 将已上传的附件或网页加入知识库，二者选一
+type AddDocumentRequest struct {
+	AttachmentID uint   `json:"attachment_id" validate:"required_without=URL"`
+	URL          string `json:"url" validate:"omitempty,url,startswith=https://|startswith=http://,max=2048"`
+}
+
+// ListCollections 获取用户的个人知识库和有权读取的组织知识库，及其需要重新索引的文档数
+func (s *KnowledgeService) ListCollections(userID uint) ([]model.Collection, error) {
+	var collections []model.Collection
+	if err := s.db.Where(collectionReadable, readableArgs(userID)...).Order("id ASC").Find(&collections).Error; err != nil {
+		return nil, err
+	}
+	for i := range collections {
+		if err := s.countStale(&collections[i]); err != nil {
+			return nil, err
+		}
+	}
+	return collections, nil
+}
+
+// CreateCollection 创建知识库，分块设置在创建时确定，之后修改服务端默认值不影响已有知识库
+func (s *KnowledgeService) CreateCollection(userID uint, req *CollectionRequest) (*model.Collection, error) {
+	defaults := newChunker(s.cfg.ChunkSize, s.cfg.ChunkOverlap, s.cfg.Splitter)
+	collection := model.Collection{
+		UserID:       userID,
+		Name:         req.Name,
+		Description:  req.Description,
+		ChunkSize:    defaults.size,
+		ChunkOverlap: defaults.overlap,
+		Splitter:     defaults.splitter,
+	}
+	if req.ChunkSize != nil {
+		collection.ChunkSize = *req.ChunkSize
+		collection.ChunkOverlap = min(collection.ChunkOverlap, collection.ChunkSize/2)
+	}
+	if req.ChunkOverlap != nil {
+		collection.ChunkOverlap = *req.ChunkOverlap
+	}
+	if req.Splitter != "" {
+		collection.Splitter = req.Splitter
+	}
+	if collection.ChunkOverlap >= collection.ChunkSize {
+		return nil, ErrInvalidChunking
+	}
+	if req.OrgID != nil {
+		if err := s.requireOrgAdmin(*req.OrgID, userID); err != nil {
+			return nil, err
+		}
+		collection.OrgID = req.OrgID
+		collection.ReadRole = req.ReadRole
+		if collection.ReadRole == "" {
+			collection.ReadRole = model.OrgRoleMember
+		}
+	}
+	if err := s.db.Create(&collection).Error; err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// UpdateCollection 更新知识库的名称、描述和分块设置。已有文档不会自动重新分块，
+// 返回的stale_documents为需要重新索引的文档数
+func (s *KnowledgeService) UpdateCollection(userID, collectionID uint, req *UpdateCollectionRequest) (*model.Collection, error) {
+	collection, err := s.collection(userID, collectionID, true)
+	if err != nil {
+		return nil, err
+	}
+	current := s.chunkerFor(collection)
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+		collection.Name = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+		collection.Description = *req.Description
+	}
+	if req.ReadRole != nil && collection.OrgID != nil {
+		updates["read_role"] = *req.ReadRole
+		collection.ReadRole = *req.ReadRole
+	}
+	size, overlap, splitter := current.size, current.overlap, current.splitter
+	if req.ChunkSize != nil {
+		size = *req.ChunkSize
+	}
+	if req.ChunkOverlap != nil {
+		overlap = *req.ChunkOverlap
+	}
+	if req.Splitter != nil {
+		splitter = *req.Splitter
+	}
+	if overlap >= size {
+		return nil, ErrInvalidChunking
+	}
+	if size != collection.ChunkSize || overlap != collection.ChunkOverlap || splitter != collection.Splitter {
+		updates["chunk_size"] = size
+		updates["chunk_overlap"] = overlap
+		updates["splitter"] = splitter
+		collection.ChunkSize, collection.ChunkOverlap, collection.Splitter = size, overlap, splitter
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(collection).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := s.countStale(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// ReindexCollection 按知识库当前的分块设置重新提取和分块：默认只处理分块设置或嵌入模型已过期的文档，
+// all为true时处理全部文档（如提取失败的文档）。正在处理的文档跳过，返回加入队列的文档数
+func (s *KnowledgeService) ReindexCollection(userID, collectionID uint, all bool) (int, error) {
+	collection, err := s.collection(userID, collectionID, true)
+	if err != nil {
+		return 0, err
+	}
+	query := s.staleDocuments(collection)
+	if all {
+		query = s.db.Model(&model.Document{}).Where("collection_id = ? AND status NOT IN ?", collection.ID,
+			[]string{model.DocumentPending, model.DocumentProcessing})
+	}
+	var documents []model.Document
+	if err := query.Omit("extraction").Order("id ASC").Find(&documents).Error; err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for i := range documents {
+		document := &documents[i]
+		status := document.Status
+		if err := s.db.Model(document).Update("status", model.DocumentPending).Error; err != nil {
+			return queued, err
+		}
+		if err := s.enqueueIngest(document); err != nil {
+			// 队列已满时恢复原状态，稍后可再次重新索引
+			s.db.Model(document).Update("status", status)
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// DeleteCollection 删除知识库及其中的文档和分块，附件本身保留
+func (s *KnowledgeService) DeleteCollection(userID, collectionID uint) error {
+	collection, err := s.collection(userID, collectionID, true)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&model.ConversationCollection{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&model.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&model.Document{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(collection).Error
+	})
+}
+
+// ListDocuments 获取知识库中的文档，不含各页的提取报告
+func (s *KnowledgeService) ListDocuments(userID, collectionID uint) ([]model.Document, error) {
+	if _, err := s.collection(userID, collectionID, false); err != nil {
+		return nil, err
+	}
+	var documents []model.Document
+	err := s.db.Omit("extraction").Where("collection_id = ?", collectionID).Order("id ASC").Find(&documents).Error
+	return documents, err
+}
+
+// AddDocument 将扫描通过的附件或网页加入知识库，计入套餐的文档存储额度，返回等待提取的文档
+func (s *KnowledgeService) AddDocument(userID, collectionID uint, req *AddDocumentRequest) (*model.Document, error) {
+	if _, err := s.collection(userID, collectionID, true); err != nil {
+		return nil, err
+	}
+	if req.URL != "" {
+		document, err := s.addURLDocument(userID, collectionID, req.URL)
+		if err == nil {
+			s.onboarding.complete(userID, OnboardingFirstDocument)
+		}
+		return document, err
+	}
+	attachment, err := s.attachmentService.Get(userID, req.AttachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachmentUsable(attachment); err != nil {
+		return nil, err
+	}
+	if !extract.Supported(attachment.ContentType) {
+		return nil, ErrDocumentUnsupported
+	}
+
+	var used int64
+	if err := s.db.Model(&model.Document{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").Scan(&used).Error; err != nil {
+		return nil, err
+	}
+	if err := s.planService.CheckDocumentStorage(userID, used, attachment.Size); err != nil {
+		return nil, err
+	}
+
+	document := model.Document{
+		UserID:       userID,
+		CollectionID: collectionID,
+		AttachmentID: attachment.ID,
+		Title:        attachment.Filename,
+		ContentType:  attachment.ContentType,
+		Size:         attachment.Size,
+		Status:       model.DocumentPending,
+	}
+	if err := s.db.Create(&document).Error; err != nil {
+		return nil, err
+	}
+	if err := s.enqueueIngest(&document); err != nil {
+		s.db.Delete(&document)
+		return nil, err
+	}
+	s.onboarding.complete(userID, OnboardingFirstDocument)
+	return &document, nil
+}
+
+// GetDocument 获取有权读取的知识库中的文档及其提取报告
+func (s *KnowledgeService) GetDocument(userID, documentID uint) (*model.Document, error) {
+	return s.document(userID, documentID, false)
+}
+
+// DocumentChunks 获取文档的分块，用于排查检索结果
+func (s *KnowledgeService) DocumentChunks(userID, documentID uint) ([]model.DocumentChunk, error) {
+	document, err := s.GetDocument(userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []model.DocumentChunk
+	err = s.db.Where("document_id = ?", document.ID).Order("seq ASC").Find(&chunks).Error
+	return chunks, err
+}
+
+// DeleteDocument 从知识库中删除文档及其分块
+func (s *KnowledgeService) DeleteDocument(userID, documentID uint) error {
+	document, err := s.document(userID, documentID, true)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", document.ID).Delete(&model.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(document).Error
+	})
+}
+
+// chunkerFor 知识库的分块设置，未设置（创建于支持分块设置之前）时使用服务端默认值
+func (s *KnowledgeService) chunkerFor(collection *model.Collection) chunker {
+	if collection.ChunkSize <= 0 {
+		return newChunker(s.cfg.ChunkSize, s.cfg.ChunkOverlap, s.cfg.Splitter)
+	}
+	splitter := collection.Splitter
+	if splitter == "" {
+		splitter = s.cfg.Splitter
+	}
+	return newChunker(collection.ChunkSize, collection.ChunkOverlap, splitter)
+}
+
+// countStale 统计需要重新索引的文档数
+func (s *KnowledgeService) countStale(collection *model.Collection) error {
+	return s.staleDocuments(collection).Count(&collection.StaleDocuments).Error
+}
+
+// staleDocuments 已按其他分块设置分块，或配置了嵌入模型但未用该模型生成向量的文档
+func (s *KnowledgeService) staleDocuments(collection *model.Collection) *gorm.DB {
+	query := s.db.Model(&model.Document{}).Where("collection_id = ? AND status = ?", collection.ID, model.DocumentReady)
+	settings := s.chunkerFor(collection).settings()
+	if s.embedder != nil {
+		return query.Where("(chunk_settings <> ? OR embedding_model <> ?)", settings, s.cfg.EmbeddingModel)
+	}
+	return query.Where("chunk_settings <> ?", settings)
+}
+
+// collection 获取用户有权读取的知识库，write为true时还要求有权维护（个人知识库的创建者或组织管理员）
+func (s *KnowledgeService) collection(userID, collectionID uint, write bool) (*model.Collection, error) {
+	var collection model.Collection
+	if err := s.db.Where("id = ?", collectionID).Where(collectionReadable, readableArgs(userID)...).
+		First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCollectionNotFound
+		}
+		return nil, err
+	}
+	if write && collection.OrgID != nil {
+		if err := s.requireOrgAdmin(*collection.OrgID, userID); err != nil {
+			return nil, err
+		}
+	}
+	return &collection, nil
+}
+
+// document 获取文档，权限与所在知识库相同
+func (s *KnowledgeService) document(userID, documentID uint, write bool) (*model.Document, error) {
+	var document model.Document
+	if err := s.db.First(&document, documentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+	if _, err := s.collection(userID, document.CollectionID, write); err != nil {
+		if errors.Is(err, ErrCollectionNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+	return &document, nil
+}
+
+// collectionReadable 用户可读取的知识库：个人知识库只有创建者可读取，组织知识库为角色满足read_role的成员（管理员可读取全部）。
+// 检索时按该条件实时过滤，成员被移出组织或角色变更后立即生效
+const collectionReadable = `((collections.org_id IS NULL AND collections.user_id = ?) OR EXISTS (
+	SELECT 1 FROM organization_members m
+	WHERE m.org_id = collections.org_id AND m.user_id = ? AND (m.role = ? OR collections.read_role = ?)))`
+
+func readableArgs(userID uint) []interface{} {
+	return []interface{}{userID, userID, model.OrgRoleAdmin, model.OrgRoleMember}
+}
+
+// requireOrgAdmin 维护组织知识库需要组织管理员角色，非成员返回ErrOrgNotFound
+func (s *KnowledgeService) requireOrgAdmin(orgID, userID uint) error {
+	var member model.OrganizationMember
+	if err := s.db.Where("org_id = ? AND user_id = ?", orgID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrgNotFound
+		}
+		return err
+	}
+	if member.Role != model.OrgRoleAdmin {
+		return ErrOrgForbidden
+	}
+	return nil
+}
+
+// enqueueIngest 将文档加入提取任务队列
+func (s *KnowledgeService) enqueueIngest(document *model.Document) error {
+	_, err := s.jobService.Enqueue(document.UserID, documentIngestJobType, func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		progress(0, "Extracting "+document.Title)
+		result, err := s.ingest(ctx, document.ID, progress)
+		if err != nil {
+			s.fail(document.ID, result, err)
+			return nil, err
+		}
+		return map[string]interface{}{
+			"document_id":    document.ID,
+			"extract_method": result.Method,
+			"quality":        result.Quality,
+			"chunks":         result.chunks,
+		}, nil
+	})
+	return err
+}
+
+// ingestResult 提取结果及分块数
+type ingestResult struct {
+	*extract.Result
+	chunks int
+}
+
+// ingest 读取文档内容（网页文档重新抓取），提取文本并替换其分块。提取失败时返回的结果可能包含提取报告
+func (s *KnowledgeService) ingest(ctx context.Context, documentID uint, progress JobProgress) (*ingestResult, error) {
+	var document model.Document
+	if err := s.db.Omit("extraction").First(&document, documentID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&document).Update("status", model.DocumentProcessing).Error; err != nil {
+		return nil, err
+	}
+
+	if document.SourceURL != "" {
+		page, err := s.fetch(ctx, &document, false)
+		if err != nil {
+			s.crawlFailed(document.ID, err)
+			return nil, err
+		}
+		now := time.Now()
+		return s.index(ctx, &document, page.contentType, page.data, page.updates(now, s.nextCrawl(now)), progress)
+	}
+	_, data, err := s.attachmentService.Read(ctx, document.UserID, document.AttachmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.index(ctx, &document, document.ContentType, data, nil, progress)
+}
+
+// index 提取文本，按知识库的分块设置分块并生成向量，在事务中替换文档的分块，extra为一并更新的文档字段
+func (s *KnowledgeService) index(ctx context.Context, document *model.Document, contentType string, data []byte, extra map[string]interface{}, progress JobProgress) (*ingestResult, error) {
+	var collection model.Collection
+	if err := s.db.First(&collection, document.CollectionID).Error; err != nil {
+		return nil, err
+	}
+	chunking := s.chunkerFor(&collection)
+
+	extracted, err := s.extractor.Extract(ctx, contentType, data)
+	if err != nil {
+		if extracted != nil {
+			return &ingestResult{Result: extracted}, err
+		}
+		return nil, err
+	}
+	progress(80, "Chunking")
+
+	chunks := chunking.chunkBlocks(extracted.Blocks)
+	rows := make([]model.DocumentChunk, len(chunks))
+	for i, c := range chunks {
+		rows[i] = model.DocumentChunk{
+			DocumentID:   document.ID,
+			CollectionID: document.CollectionID,
+			Seq:          i,
+			Page:         c.Page,
+			Kind:         c.Kind,
+			Content:      c.Content,
+		}
+	}
+	result := &ingestResult{Result: extracted, chunks: len(rows)}
+
+	// 向量生成失败不影响入库，文档只能通过关键词检索，重新索引时再生成
+	embeddingModel := ""
+	if s.embedder != nil && len(rows) > 0 {
+		progress(90, "Embedding")
+		if err := s.embedChunks(ctx, rows); err != nil {
+			log.Printf("Failed to embed chunks of document %d: %v", document.ID, err)
+		} else {
+			embeddingModel = s.cfg.EmbeddingModel
+		}
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", document.ID).Delete(&model.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.CreateInBatches(rows, 100).Error; err != nil {
+				return err
+			}
+		}
+		updates := extractionUpdates(&extracted.Report)
+		for k, v := range extra {
+			updates[k] = v
+		}
+		updates["status"] = model.DocumentReady
+		updates["error"] = ""
+		updates["chunks"] = len(rows)
+		updates["chunk_settings"] = chunking.settings()
+		updates["embedding_model"] = embeddingModel
+		updates["processed_at"] = now
+		return tx.Model(document).Updates(updates).Error
+	})
+	if err != nil {
+		return result, err
+	}
+	log.Printf("Ingested document %d (%s, quality %.2f, %d chunks)", document.ID, extracted.Method, extracted.Quality, len(rows))
+	return result, nil
+}
+
+// fail 记录提取失败，有提取报告时一并保存以便排查
+func (s *KnowledgeService) fail(documentID uint, result *ingestResult, cause error) {
+	updates := map[string]interface{}{
+		"status":       model.DocumentFailed,
+		"error":        truncateRunes(cause.Error(), 250),
+		"processed_at": time.Now(),
+	}
+	if result != nil && result.Result != nil {
+		for k, v := range extractionUpdates(&result.Report) {
+			updates[k] = v
+		}
+	}
+	if err := s.db.Model(&model.Document{}).Where("id = ?", documentID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to mark document %d as failed: %v", documentID, err)
+	}
+}
+
+// extractionUpdates 提取报告对应的文档字段
+func extractionUpdates(report *extract.Report) map[string]interface{} {
+	extraction, err := json.Marshal(report)
+	if err != nil {
+		extraction = []byte(fmt.Sprintf(`{"error":%q}`, err.Error()))
+	}
+	return map[string]interface{}{
+		"extract_method": report.Method,
+		"quality":        report.Quality,
+		"pages":          len(report.Pages),
+		"ocr_pages":      report.OCRPages(),
+		"tables":         report.Tables(),
+		"extraction":     string(extraction),
+	}
+}
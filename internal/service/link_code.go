@@ -0,0 +1,46 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newLinkCode 生成外部频道的绑定码：用户ID和过期时间以平台密钥签名，无需落库。
+// 绑定码只能在目标频道内使用，以此证明用户能在该频道发言
+func newLinkCode(secret, platform string, userID uint, ttl time.Duration) (string, time.Time) {
+	expiresAt := time.Now().Add(ttl)
+	data := fmt.Sprintf("%d_%d", userID, expiresAt.Unix())
+	return data + "_" + signLinkCode(secret, platform, data), expiresAt
+}
+
+func signLinkCode(secret, platform, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(platform + "-link:" + data))
+	return hex.EncodeToString(mac.Sum(nil))[:20]
+}
+
+// parseLinkCode 校验绑定码的签名和有效期并返回用户ID
+func parseLinkCode(secret, platform, code string) (uint, error) {
+	parts := strings.Split(code, "_")
+	if len(parts) != 3 {
+		return 0, errInvalidLinkCode
+	}
+	data := parts[0] + "_" + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(signLinkCode(secret, platform, data))) {
+		return 0, errInvalidLinkCode
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return 0, errInvalidLinkCode
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, errInvalidLinkCode
+	}
+	return uint(userID), nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+func TestLinkCode(t *testing.T) {
+	const secret = "signing-secret"
+	code, expiresAt := newLinkCode(secret, model.PlatformSlack, 42, time.Minute)
+	if time.Until(expiresAt) <= 0 {
+		t.Fatalf("expiresAt = %v, want in the future", expiresAt)
+	}
+	expired, _ := newLinkCode(secret, model.PlatformSlack, 42, -time.Minute)
+	parts := strings.Split(code, "_")
+	forged := "7_" + parts[1] + "_" + parts[2]
+
+	tests := []struct {
+		name     string
+		secret   string
+		platform string
+		code     string
+		wantUser uint
+		wantErr  bool
+	}{
+		{name: "valid", secret: secret, platform: model.PlatformSlack, code: code, wantUser: 42},
+		{name: "expired", secret: secret, platform: model.PlatformSlack, code: expired, wantErr: true},
+		{name: "other user", secret: secret, platform: model.PlatformSlack, code: forged, wantErr: true},
+		{name: "other platform", secret: secret, platform: model.PlatformTelegram, code: code, wantErr: true},
+		{name: "other secret", secret: "other", platform: model.PlatformSlack, code: code, wantErr: true},
+		{name: "malformed", secret: secret, platform: model.PlatformSlack, code: "42", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, err := parseLinkCode(tt.secret, tt.platform, tt.code)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidLinkCode) {
+					t.Fatalf("parseLinkCode() error = %v, want errInvalidLinkCode", err)
+				}
+				return
+			}
+			if err != nil || userID != tt.wantUser {
+				t.Fatalf("parseLinkCode() = %d, %v, want %d", userID, err, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestParseSlackLinkCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantCode string
+		wantOK   bool
+	}{
+		{text: "link 1_2_abc", wantCode: "1_2_abc", wantOK: true},
+		{text: "<@U0BOT> link 1_2_abc", wantCode: "1_2_abc", wantOK: true},
+		{text: "  LINK   1_2_abc ", wantCode: "1_2_abc", wantOK: true},
+		{text: "link", wantOK: false},
+		{text: "please link 1_2_abc", wantOK: false},
+		{text: "link 1_2_abc now", wantOK: false},
+		{text: "hello", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			code, ok := parseSlackLinkCommand(tt.text)
+			if ok != tt.wantOK || code != tt.wantCode {
+				t.Fatalf("parseSlackLinkCommand(%q) = %q, %v", tt.text, code, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ai-chat-backend/internal/mcp"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// mcpResourceLimit 资源列表中最多列出的最近会话数
+	mcpResourceLimit = 50
+	// mcpTranscriptLimit 读取会话资源时最多返回的消息数
+	mcpTranscriptLimit = 500
+	// conversationURIPrefix 会话资源的URI前缀
+	conversationURIPrefix = "conversation://"
+)
+
+var errMCPReadOnly = errors.New("service is in read-only mode")
+
+type mcpUserKey struct{}
+
+// MCPService 以MCP服务端的形式提供聊天数据，供外部智能体框架读取会话历史、搜索消息和发送消息。
+// 以请求用户的身份访问，只能访问自己的会话
+type MCPService struct {
+	chatService   *ChatService
+	systemService *SystemService
+	server        *mcp.Server
+}
+
+func NewMCPService(chatService *ChatService, systemService *SystemService) *MCPService {
+	s := &MCPService{
+		chatService:   chatService,
+		systemService: systemService,
+		server: mcp.NewServer("ai-chat-backend", "1.0.0",
+			"Chat history of the current user. Use list_conversations or search_messages to find conversations, "+
+				"get_messages to read them, and send_message to continue a conversation with the assistant."),
+	}
+
+	s.server.AddTool("list_conversations", "List the user's conversations, most recently active first.",
+		`{"type":"object","properties":{"archived":{"type":"boolean","description":"List archived conversations instead"},"page":{"type":"integer","minimum":1},"page_size":{"type":"integer","minimum":1,"maximum":100}}}`,
+		s.listConversations)
+	s.server.AddTool("get_messages", "Read the messages of a conversation in chronological order.",
+		`{"type":"object","properties":{"conversation_id":{"type":"integer"},"page":{"type":"integer","minimum":1},"page_size":{"type":"integer","minimum":1,"maximum":100}},"required":["conversation_id"]}`,
+		s.getMessages)
+	s.server.AddTool("search_messages", "Search the user's messages by keyword, newest first.",
+		`{"type":"object","properties":{"query":{"type":"string"},"conversation_id":{"type":"integer","description":"Only search this conversation"},"limit":{"type":"integer","minimum":1,"maximum":50}},"required":["query"]}`,
+		s.searchMessages)
+	s.server.AddTool("create_conversation", "Create a new conversation.",
+		`{"type":"object","properties":{"title":{"type":"string","maxLength":100}},"required":["title"]}`,
+		s.createConversation)
+	s.server.AddTool("send_message", "Send a user message to a conversation and return the assistant's reply.",
+		`{"type":"object","properties":{"conversation_id":{"type":"integer"},"content":{"type":"string"}},"required":["conversation_id","content"]}`,
+		s.sendMessage)
+
+	s.server.SetResources(s, mcp.ResourceTemplate{
+		URITemplate: conversationURIPrefix + "{id}",
+		Name:        "Conversation transcript",
+		MimeType:    "text/plain",
+	})
+	return s
+}
+
+// Handle 以userID的身份处理一条MCP消息，返回nil表示无需响应
+func (s *MCPService) Handle(ctx context.Context, userID uint, body []byte) []byte {
+	return s.server.Handle(context.WithValue(ctx, mcpUserKey{}, userID), body)
+}
+
+func mcpUser(ctx context.Context) uint {
+	userID, _ := ctx.Value(mcpUserKey{}).(uint)
+	return userID
+}
+
+// decodeArguments 解析工具参数，格式错误时返回ErrInvalidParams
+func decodeArguments(arguments json.RawMessage, out interface{}) error {
+	if err := json.Unmarshal(arguments, out); err != nil {
+		return fmt.Errorf("%w: %v", mcp.ErrInvalidParams, err)
+	}
+	return nil
+}
+
+// clampPage 与REST接口相同的分页参数规则
+func clampPage(page, pageSize, defaultSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = defaultSize
+	}
+	return page, pageSize
+}
+
+func toolJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// conversationError 会话不存在时返回面向调用方的错误
+func conversationError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrConversationNotFound
+	}
+	return err
+}
+
+func (s *MCPService) listConversations(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Archived bool `json:"archived"`
+		Page     int  `json:"page"`
+		PageSize int  `json:"page_size"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	page, pageSize := clampPage(args.Page, args.PageSize, 20)
+
+	conversations, total, err := s.chatService.GetConversations(mcpUser(ctx), ConversationListOptions{Archived: args.Archived}, page, pageSize)
+	if err != nil {
+		return "", err
+	}
+	return toolJSON(map[string]interface{}{
+		"conversations": conversations,
+		"total":         total,
+		"page":          page,
+	})
+}
+
+func (s *MCPService) getMessages(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		ConversationID uint `json:"conversation_id"`
+		Page           int  `json:"page"`
+		PageSize       int  `json:"page_size"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	page, pageSize := clampPage(args.Page, args.PageSize, 50)
+
+	messages, total, err := s.chatService.GetMessages(mcpUser(ctx), args.ConversationID, MessageListOptions{}, page, pageSize)
+	if err != nil {
+		return "", conversationError(err)
+	}
+	return toolJSON(map[string]interface{}{
+		"messages": messages,
+		"total":    total,
+		"page":     page,
+	})
+}
+
+func (s *MCPService) searchMessages(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query          string `json:"query"`
+		ConversationID uint   `json:"conversation_id"`
+		Limit          int    `json:"limit"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("%w: query is required", mcp.ErrInvalidParams)
+	}
+	if args.Limit < 1 || args.Limit > 50 {
+		args.Limit = 20
+	}
+
+	messages, err := s.chatService.SearchMessages(mcpUser(ctx), args.Query, args.ConversationID, args.Limit)
+	if err != nil {
+		return "", err
+	}
+	return toolJSON(map[string]interface{}{"messages": messages})
+}
+
+func (s *MCPService) createConversation(ctx context.Context, arguments json.RawMessage) (string, error) {
+	if s.systemService.IsReadOnly() {
+		return "", errMCPReadOnly
+	}
+	var args struct {
+		Title string `json:"title"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	title := strings.TrimSpace(args.Title)
+	if title == "" || len([]rune(title)) > 100 {
+		return "", fmt.Errorf("%w: title must be 1-100 characters", mcp.ErrInvalidParams)
+	}
+
+	conversation, err := s.chatService.CreateConversation(mcpUser(ctx), &CreateConversationRequest{Title: title})
+	if err != nil {
+		return "", err
+	}
+	return toolJSON(conversation)
+}
+
+func (s *MCPService) sendMessage(ctx context.Context, arguments json.RawMessage) (string, error) {
+	if s.systemService.IsReadOnly() {
+		return "", errMCPReadOnly
+	}
+	var args struct {
+		ConversationID uint   `json:"conversation_id"`
+		Content        string `json:"content"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Content) == "" {
+		return "", fmt.Errorf("%w: content is required", mcp.ErrInvalidParams)
+	}
+
+	userMessage, assistantMessage, truncated, err := s.chatService.SendMessage(ctx, mcpUser(ctx), args.ConversationID,
+		&SendMessageRequest{Content: args.Content})
+	if err != nil {
+		return "", conversationError(err)
+	}
+	return toolJSON(map[string]interface{}{
+		"user_message":      userMessage,
+		"assistant_message": assistantMessage,
+		"truncated":         truncated,
+	})
+}
+
+// ListResources 最近活跃的会话，每个会话是一个资源
+func (s *MCPService) ListResources(ctx context.Context) ([]mcp.Resource, error) {
+	conversations, _, err := s.chatService.GetConversations(mcpUser(ctx), ConversationListOptions{}, 1, mcpResourceLimit)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]mcp.Resource, len(conversations))
+	for i, conversation := range conversations {
+		resources[i] = mcp.Resource{
+			URI:      conversationURIPrefix + strconv.FormatUint(uint64(conversation.ID), 10),
+			Name:     conversation.Title,
+			MimeType: "text/plain",
+		}
+	}
+	return resources, nil
+}
+
+// ReadResource 以纯文本返回会话记录，每条消息以角色开头
+func (s *MCPService) ReadResource(ctx context.Context, uri string) (*mcp.Content, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(uri, conversationURIPrefix), 10, 32)
+	if !strings.HasPrefix(uri, conversationURIPrefix) || err != nil {
+		return nil, mcp.ErrResourceNotFound
+	}
+
+	userID := mcpUser(ctx)
+	conversation, err := s.chatService.GetConversation(userID, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, mcp.ErrResourceNotFound
+		}
+		return nil, err
+	}
+	messages, _, err := s.chatService.GetMessages(userID, uint(id), MessageListOptions{}, 1, mcpTranscriptLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.Content{MimeType: "text/plain", Text: transcript(conversation, messages)}, nil
+}
+
+func transcript(conversation *model.Conversation, messages []model.Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", conversation.Title)
+	for _, msg := range messages {
+		if msg.RedactedAt != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "\n[%s] %s:\n%s\n", msg.CreatedAt.UTC().Format("2006-01-02 15:04:05"), msg.Role, msg.Content)
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"ai-chat-backend/internal/extract"
+	"ai-chat-backend/internal/model"
+)
+
+var (
+	ErrAttachmentInUse        = errors.New("attachment was already sent with another message")
+	ErrAttachmentConversation = errors.New("attachment belongs to another conversation")
+)
+
+// UseAttachments 允许消息附带已上传的文件，图片中的文字识别后随消息发给模型
+func (s *ChatService) UseAttachments(attachmentService *AttachmentService) {
+	s.attachmentService = attachmentService
+}
+
+// messageAttachments 校验消息附带的文件：属于用户、可以使用、未随其他消息发送且未关联到其他会话。
+// 识别其中图片的文字（以用户的首选语言为提示），返回附件和发给模型的识别文本
+func (s *ChatService) messageAttachments(ctx context.Context, userID uint, conversation *model.Conversation, ids []uint) ([]model.Attachment, string, error) {
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+	if s.attachmentService == nil {
+		return nil, "", ErrAttachmentUnavailable
+	}
+
+	attachments := make([]model.Attachment, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		attachment, err := s.attachmentService.Get(userID, id)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := attachmentUsable(attachment); err != nil {
+			return nil, "", err
+		}
+		if attachment.MessageID != nil {
+			return nil, "", ErrAttachmentInUse
+		}
+		if attachment.ConversationID != nil && *attachment.ConversationID != conversation.ID {
+			return nil, "", ErrAttachmentConversation
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	languages := ""
+	var user model.User
+	if err := s.db.Select("language").Where("id = ?", userID).First(&user).Error; err == nil {
+		languages = extract.LanguageHint(user.Language)
+	}
+
+	var texts []string
+	for i := range attachments {
+		text, err := s.attachmentService.RecognizeText(ctx, &attachments[i], languages)
+		if err != nil {
+			// 识别失败不影响发送，消息不带该图片的文字
+			log.Printf("Failed to recognize text in attachment %d: %v", attachments[i].ID, err)
+			continue
+		}
+		if text != "" {
+			texts = append(texts, s.sanitizer.attachmentText(attachments[i].Filename, text))
+		}
+	}
+	return attachments, strings.Join(texts, "\n\n"), nil
+}
+
+// linkAttachments 将附件关联到已保存的用户消息，无痕会话的消息不落库，不关联
+func (s *ChatService) linkAttachments(conversation *model.Conversation, message *model.Message, attachments []model.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+	message.Attachments = attachments
+	if conversation.Incognito {
+		return
+	}
+	ids := make([]uint, len(attachments))
+	for i := range attachments {
+		ids[i] = attachments[i].ID
+		attachments[i].MessageID = &message.ID
+	}
+	if err := s.db.Model(&model.Attachment{}).Where("id IN ? AND message_id IS NULL", ids).
+		Update("message_id", message.ID).Error; err != nil {
+		log.Printf("Failed to link attachments to message %d: %v", message.ID, err)
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// maxMessageContext 跳转到消息时前后各最多返回的消息数
+const maxMessageContext = 50
+
+var ErrInvalidMessageContext = errors.New("before and after must be between 0 and 50")
+
+// MessageContext 一条消息及其前后的消息，按创建时间正序排列，用于从搜索结果跳转到消息所在位置
+type MessageContext struct {
+	MessageID uint            `json:"message_id"`
+	Messages  []model.Message `json:"messages"`
+	// Offset 该消息在会话消息列表中的位置（从0开始），客户端可据此计算所在的页
+	Offset        int64 `json:"offset"`
+	HasMoreBefore bool  `json:"has_more_before"`
+	HasMoreAfter  bool  `json:"has_more_after"`
+}
+
+// GetMessageContext 获取会话中的一条消息及其之前before条、之后after条消息，排序与GetMessages一致
+func (s *ChatService) GetMessageContext(userID, conversationID, messageID uint, before, after int) (*MessageContext, error) {
+	if before < 0 || before > maxMessageContext || after < 0 || after > maxMessageContext {
+		return nil, ErrInvalidMessageContext
+	}
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	if conversation.Incognito {
+		return s.incognitoMessageContext(context.Background(), conversationID, messageID, before, after)
+	}
+
+	var target model.Message
+	if err := s.db.Preload("Attachments").Where("id = ? AND conversation_id = ?", messageID, conversationID).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	earlier := s.db.Where("conversation_id = ? AND (created_at < ? OR (created_at = ? AND id < ?))",
+		conversationID, target.CreatedAt, target.CreatedAt, target.ID)
+	later := s.db.Where("conversation_id = ? AND (created_at > ? OR (created_at = ? AND id > ?))",
+		conversationID, target.CreatedAt, target.CreatedAt, target.ID)
+
+	result := &MessageContext{MessageID: target.ID}
+	if err := earlier.Model(&model.Message{}).Count(&result.Offset).Error; err != nil {
+		return nil, err
+	}
+
+	// 多取一条判断是否还有更多
+	var previous, next []model.Message
+	if err := earlier.Preload("Attachments").Order("created_at DESC, id DESC").Limit(before + 1).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	if err := later.Preload("Attachments").Order("created_at ASC, id ASC").Limit(after + 1).Find(&next).Error; err != nil {
+		return nil, err
+	}
+
+	if len(previous) > before {
+		previous = previous[:before]
+		result.HasMoreBefore = true
+	}
+	if len(next) > after {
+		next = next[:after]
+		result.HasMoreAfter = true
+	}
+
+	result.Messages = make([]model.Message, 0, len(previous)+1+len(next))
+	for i := len(previous) - 1; i >= 0; i-- {
+		result.Messages = append(result.Messages, previous[i])
+	}
+	result.Messages = append(result.Messages, target)
+	result.Messages = append(result.Messages, next...)
+	return result, nil
+}
+
+// incognitoMessageContext 无痕会话的消息按追加顺序保存在Redis中，读取全部消息后定位
+func (s *ChatService) incognitoMessageContext(ctx context.Context, conversationID, messageID uint, before, after int) (*MessageContext, error) {
+	if s.incognito == nil {
+		return nil, ErrIncognitoUnavailable
+	}
+	messages, err := s.incognito.Range(ctx, conversationID, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range messages {
+		if messages[i].ID != messageID {
+			continue
+		}
+		start := max(i-before, 0)
+		end := min(i+after+1, len(messages))
+		return &MessageContext{
+			MessageID:     messageID,
+			Messages:      messages[start:end],
+			Offset:        int64(i),
+			HasMoreBefore: start > 0,
+			HasMoreAfter:  end < len(messages),
+		}, nil
+	}
+	return nil, ErrMessageNotFound
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/tokenizer"
+)
+
+func TestMaxInputTokens(t *testing.T) {
+	ai := &AIService{contextWindow: 8192, maxOutputTokens: 2048}
+	tests := []struct {
+		name      string
+		ai        *AIService
+		maxOutput int
+		want      int
+	}{
+		{name: "server output limit", ai: ai, maxOutput: 0, want: 6144},
+		{name: "lower user output limit", ai: ai, maxOutput: 512, want: 7680},
+		{name: "user limit above server limit", ai: ai, maxOutput: 4096, want: 6144},
+		{name: "no output limit reserves default", ai: &AIService{contextWindow: 8192}, maxOutput: 0, want: 8192 - minOutputReserve},
+		{name: "oversized reserve keeps minimum", ai: &AIService{contextWindow: 4096, maxOutputTokens: 4000}, maxOutput: 0, want: minInputTokens},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ai.MaxInputTokens(tt.maxOutput); got != tt.want {
+				t.Fatalf("MaxInputTokens(%d) = %d, want %d", tt.maxOutput, got, tt.want)
+			}
+		})
+	}
+}
+
+// 消息长度按本次生成选用的模型检查，超长错误中的上限为该模型的token数
+func TestCheckMessageLength(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{})
+	large := &AIService{endpoint: Endpoint{Model: "qwen-plus"}, contextWindow: 131072, maxOutputTokens: 1024}
+	base := &AIService{
+		endpoint:        Endpoint{Model: "gpt-4"},
+		contextWindow:   8192,
+		maxOutputTokens: 1024,
+		models:          map[string]*AIService{"qwen-plus": large},
+	}
+	s := &ChatService{db: db, aiService: base}
+
+	content := strings.Repeat("上下文窗口按模型确定。", 1000)
+	length := tokenizer.Count(content)
+	if length <= 7168 || length > 130048 {
+		t.Fatalf("test content has %d tokens, want between the two model limits", length)
+	}
+
+	tests := []struct {
+		name              string
+		conversationModel string
+		modelName         string
+		wantLimit         int
+	}{
+		{name: "default model", wantLimit: 7168},
+		{name: "model chosen for the message", modelName: "qwen-plus"},
+		{name: "model chosen for the conversation", conversationModel: "qwen-plus"},
+		{name: "message overrides conversation", conversationModel: "qwen-plus", modelName: "gpt-4", wantLimit: 7168},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conversation := &model.Conversation{UserID: user.ID, Model: tt.conversationModel}
+			err := s.checkMessageLength(user.ID, conversation, tt.modelName, content)
+			if tt.wantLimit == 0 {
+				if err != nil {
+					t.Fatalf("checkMessageLength() = %v, want nil", err)
+				}
+				return
+			}
+			var tooLong *MessageTooLongError
+			if !errors.As(err, &tooLong) {
+				t.Fatalf("checkMessageLength() = %v, want MessageTooLongError", err)
+			}
+			if tooLong.Length != length || tooLong.Limit != tt.wantLimit {
+				t.Fatalf("error = %d/%d tokens, want %d/%d", tooLong.Length, tooLong.Limit, length, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// messageStreamBatchSize 流式输出消息时每次从数据库读取的消息数
+const messageStreamBatchSize = 200
+
+// StreamMessages 按创建时间正序逐条读取会话中符合筛选条件的全部消息并交给fn，不分页，用于长会话的流式输出。
+// 会话不存在、筛选条件无效等错误在第一次调用fn之前返回；fn返回错误或ctx取消时停止读取
+func (s *ChatService) StreamMessages(ctx context.Context, userID, conversationID uint, opts MessageListOptions, fn func(*model.Message) error) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrConversationNotFound
+		}
+		return err
+	}
+	if conversation.Incognito {
+		return s.streamIncognitoMessages(ctx, conversationID, opts, fn)
+	}
+
+	// 按(created_at, id)游标分批读取，避免长会话的OFFSET越翻越慢，每批预加载附件
+	var last *model.Message
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		query := opts.apply(s.db.Where("conversation_id = ?", conversationID))
+		if last != nil {
+			query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))", last.CreatedAt, last.CreatedAt, last.ID)
+		}
+		var batch []model.Message
+		if err := query.Preload("Attachments").Order("created_at ASC, id ASC").Limit(messageStreamBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < messageStreamBatchSize {
+			return nil
+		}
+		last = &batch[len(batch)-1]
+	}
+}
+
+// streamIncognitoMessages 无痕会话的消息保存在Redis中，读取全部消息后筛选输出
+func (s *ChatService) streamIncognitoMessages(ctx context.Context, conversationID uint, opts MessageListOptions, fn func(*model.Message) error) error {
+	if s.incognito == nil {
+		return ErrIncognitoUnavailable
+	}
+	messages, err := s.incognito.Range(ctx, conversationID, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		if !opts.match(&messages[i]) {
+			continue
+		}
+		if err := fn(&messages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
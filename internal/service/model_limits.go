@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"ai-chat-backend/internal/tokenizer"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// defaultContextWindow 未知模型的上下文窗口（token数），取常见模型的保守值
+const defaultContextWindow = 8192
+
+// minOutputReserve 未配置输出上限时为回复预留的token数
+const minOutputReserve = 1024
+
+// modelContextWindows 已知模型的上下文窗口（token数），按名称前缀匹配，较长的前缀优先
+var modelContextWindows = map[string]int{
+	"deepseek-v3":   65536,
+	"deepseek-r1":   65536,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"qwen-max":      32768,
+	"qwen-plus":     131072,
+	"qwen-turbo":    131072,
+}
+
+// contextWindow 按模型名称查找上下文窗口
+func contextWindow(modelName string) int {
+	name := strings.ToLower(modelName)
+	best, window := 0, defaultContextWindow
+	for prefix, size := range modelContextWindows {
+		if strings.HasPrefix(name, prefix) && len(prefix) > best {
+			best, window = len(prefix), size
+		}
+	}
+	return window
+}
+
+// trimContext 上下文超过budget时从最早的历史消息开始丢弃，保留开头的系统提示词、参考资料、摘要
+// 和最后一条（本次的）用户消息；丢弃后历史以用户消息开头，不留下缺少提问的回复。返回裁剪后的上下文和丢弃的消息数
+func trimContext(messages []*schema.Message, budget int) ([]*schema.Message, int) {
+	total := tokenizer.CountMessages(messages)
+	if total <= budget || len(messages) < 2 {
+		return messages, 0
+	}
+
+	head := 0
+	for head < len(messages)-1 && messages[head].Role == schema.System {
+		head++
+	}
+	last := len(messages) - 1
+	start := head
+	for start < last && total > budget {
+		total -= tokenizer.CountMessage(messages[start])
+		start++
+	}
+	for start < last && messages[start].Role != schema.User {
+		start++
+	}
+	if start == head {
+		return messages, 0
+	}
+
+	trimmed := make([]*schema.Message, 0, head+len(messages)-start)
+	trimmed = append(trimmed, messages[:head]...)
+	trimmed = append(trimmed, messages[start:]...)
+	return trimmed, start - head
+}
+
+// MessageTooLongError 用户消息超过本次生成所用模型允许的长度
+type MessageTooLongError struct {
+	Length int // 消息的token数（tokenizer估算）
+	Limit  int // 允许的最大token数
+}
+
+func (e *MessageTooLongError) Error() string {
+	return fmt.Sprintf("message too long: %d tokens, limit is %d", e.Length, e.Limit)
+}
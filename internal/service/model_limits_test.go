@@ -0,0 +1,63 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"ai-chat-backend/internal/tokenizer"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestTrimContext(t *testing.T) {
+	system := schema.SystemMessage("You are a helpful assistant.")
+	turn := func(question string) []*schema.Message {
+		return []*schema.Message{
+			schema.UserMessage(strings.Repeat(question+" ", 20)),
+			schema.AssistantMessage(strings.Repeat("answer ", 40), nil),
+		}
+	}
+	var history []*schema.Message
+	for _, question := range []string{"first", "second", "third"} {
+		history = append(history, turn(question)...)
+	}
+	latest := schema.UserMessage("latest question")
+	messages := append(append([]*schema.Message{system}, history...), latest)
+	full := tokenizer.CountMessages(messages)
+	lastTurn := tokenizer.CountMessages([]*schema.Message{system, history[4], history[5], latest})
+
+	tests := []struct {
+		name        string
+		budget      int
+		wantDropped int
+	}{
+		{name: "fits", budget: full, wantDropped: 0},
+		{name: "drops oldest turn", budget: full - 1, wantDropped: 2},
+		{name: "keeps only the last turn", budget: lastTurn, wantDropped: 4},
+		{name: "latest message over budget", budget: 10, wantDropped: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trimmed, dropped := trimContext(messages, tt.budget)
+			if dropped != tt.wantDropped {
+				t.Fatalf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+			if len(trimmed) != len(messages)-dropped {
+				t.Fatalf("len(trimmed) = %d, want %d", len(trimmed), len(messages)-dropped)
+			}
+			if trimmed[0] != system {
+				t.Fatalf("first message = %q, want the system prompt", trimmed[0].Content)
+			}
+			if trimmed[len(trimmed)-1] != latest {
+				t.Fatalf("last message = %q, want the latest user message", trimmed[len(trimmed)-1].Content)
+			}
+			// 历史以提问开头，不留下缺少提问的回复
+			if len(trimmed) > 2 && trimmed[1].Role != schema.User {
+				t.Fatalf("history starts with a %s message", trimmed[1].Role)
+			}
+			if dropped < 6 && tokenizer.CountMessages(trimmed) > tt.budget {
+				t.Fatalf("trimmed context has %d tokens, budget is %d", tokenizer.CountMessages(trimmed), tt.budget)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/metrics"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"github.com/cloudwego/eino/callbacks"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	callbackutils "github.com/cloudwego/eino/utils/callbacks"
+	"gorm.io/gorm"
+)
+
+// generationInfo 一次生成的标识，经context传递给回调
+type generationInfo struct {
+	// TraceID 同一次生成中各轮模型调用和工具调用共用，用于关联日志和审计记录
+	TraceID        string
+	UserID         uint
+	ConversationID uint
+	Incognito      bool
+	// Region 用户所属的数据区域
+	Region string
+	// trace 开启生成追踪时记录本次生成过程
+	trace *generationTrace
+}
+
+type generationKey struct{}
+
+type callStartKey struct{}
+
+// callStart 模型或工具调用开始时记录的信息，结束回调中计算耗时
+type callStart struct {
+	at        time.Time
+	model     string
+	messages  []*schema.Message
+	config    *einomodel.Config
+	tools     []*schema.ToolInfo
+	arguments string
+	// trace 模型调用开始时登记的生成追踪，调用结束时经done释放，保存追踪时不必等待超时
+	trace *generationTrace
+	done  sync.Once
+}
+
+// finished 释放模型调用在追踪中的登记，可重复调用
+func (s *callStart) finished() {
+	s.done.Do(s.trace.modelDone)
+}
+
+func withGeneration(ctx context.Context, info *generationInfo) context.Context {
+	if info.TraceID == "" {
+		info.TraceID, _ = utils.GenerateToken(8)
+	}
+	return context.WithValue(ctx, generationKey{}, info)
+}
+
+func generationFrom(ctx context.Context) *generationInfo {
+	info, _ := ctx.Value(generationKey{}).(*generationInfo)
+	if info == nil {
+		return &generationInfo{TraceID: "-"}
+	}
+	return info
+}
+
+// observer 挂载到生成流水线的回调，统一记录模型和工具调用的指标、追踪日志，并按配置写入合规审计
+type observer struct {
+	db          *gorm.DB
+	promptAudit bool
+}
+
+func newObserver(db *gorm.DB, promptAudit bool) callbacks.Handler {
+	o := &observer{db: db, promptAudit: promptAudit}
+	return callbackutils.NewHandlerHelper().
+		ChatModel(&callbackutils.ModelCallbackHandler{
+			OnStart:               o.modelStart,
+			OnEnd:                 o.modelEnd,
+			OnEndWithStreamOutput: o.modelStreamEnd,
+			OnError:               o.modelError,
+		}).
+		Tool(&callbackutils.ToolCallbackHandler{
+			OnStart: o.toolStart,
+			OnEnd:   o.toolEnd,
+			OnError: o.toolError,
+		}).
+		Handler()
+}
+
+func (o *observer) modelStart(ctx context.Context, info *callbacks.RunInfo, input *einomodel.CallbackInput) context.Context {
+	start := &callStart{at: time.Now(), model: info.Name, messages: input.Messages, config: input.Config, tools: input.Tools}
+	if input.Config != nil && input.Config.Model != "" {
+		start.model = input.Config.Model
+	}
+	start.trace = generationFrom(ctx).trace
+	start.trace.modelStarted()
+	return context.WithValue(ctx, callStartKey{}, start)
+}
+
+func (o *observer) modelEnd(ctx context.Context, info *callbacks.RunInfo, output *einomodel.CallbackOutput) context.Context {
+	var content string
+	if output.Message != nil {
+		content = output.Message.Content
+	}
+	o.finishModel(ctx, content, output.TokenUsage, nil)
+	return ctx
+}
+
+// modelStreamEnd 流式调用在回调收到的副本读完后才算结束，用量在最后一个片段中返回
+func (o *observer) modelStreamEnd(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[*einomodel.CallbackOutput]) context.Context {
+	go func() {
+		defer output.Close()
+		var content strings.Builder
+		var usage *einomodel.TokenUsage
+		for {
+			chunk, err := output.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				o.finishModel(ctx, content.String(), usage, err)
+				return
+			}
+			if chunk.Message != nil {
+				content.WriteString(chunk.Message.Content)
+			}
+			if chunk.TokenUsage != nil {
+				usage = chunk.TokenUsage
+			}
+		}
+		o.finishModel(ctx, content.String(), usage, nil)
+	}()
+	return ctx
+}
+
+func (o *observer) modelError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	o.finishModel(ctx, "", nil, err)
+	return ctx
+}
+
+func (o *observer) finishModel(ctx context.Context, content string, usage *einomodel.TokenUsage, err error) {
+	start, _ := ctx.Value(callStartKey{}).(*callStart)
+	if start == nil {
+		return
+	}
+	defer start.finished()
+	gen := generationFrom(ctx)
+	duration := time.Since(start.at)
+
+	metrics.ModelCallDuration.Add(uint64(duration.Milliseconds()), start.model)
+	if usage != nil {
+		metrics.ModelTokens.Add(uint64(usage.PromptTokens), start.model, "prompt")
+		metrics.ModelTokens.Add(uint64(usage.CompletionTokens), start.model, "completion")
+	}
+	if err != nil {
+		metrics.ModelCalls.Inc(start.model, "error")
+		log.Printf("[trace %s] model %s failed after %dms: %v", gen.TraceID, start.model, duration.Milliseconds(), err)
+	} else {
+		metrics.ModelCalls.Inc(start.model, "ok")
+		log.Printf("[trace %s] model %s: %d messages, %dms", gen.TraceID, start.model, len(start.messages), duration.Milliseconds())
+	}
+	gen.trace.modelFinished(start, content, usage, err)
+
+	// 无痕会话不落库
+	if !o.promptAudit || gen.UserID == 0 || gen.Incognito {
+		return
+	}
+	prompt, _ := json.Marshal(start.messages)
+	audit := model.PromptAudit{
+		TraceID:        gen.TraceID,
+		UserID:         gen.UserID,
+		ConversationID: gen.ConversationID,
+		Model:          start.model,
+		Prompt:         string(prompt),
+		Response:       content,
+		DurationMs:     duration.Milliseconds(),
+	}
+	if usage != nil {
+		audit.PromptTokens = usage.PromptTokens
+		audit.CompletionTokens = usage.CompletionTokens
+	}
+	if err != nil {
+		audit.Error = truncateRunes(err.Error(), 255)
+	}
+	if dbErr := o.db.Create(&audit).Error; dbErr != nil {
+		log.Printf("Failed to record prompt audit for trace %s: %v", gen.TraceID, dbErr)
+	}
+}
+
+func (o *observer) toolStart(ctx context.Context, info *callbacks.RunInfo, input *tool.CallbackInput) context.Context {
+	return context.WithValue(ctx, callStartKey{}, &callStart{at: time.Now(), arguments: input.ArgumentsInJSON})
+}
+
+func (o *observer) toolEnd(ctx context.Context, info *callbacks.RunInfo, output *tool.CallbackOutput) context.Context {
+	o.finishTool(ctx, info.Name, output.Response, nil)
+	return ctx
+}
+
+func (o *observer) toolError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	o.finishTool(ctx, info.Name, "", err)
+	return ctx
+}
+
+func (o *observer) finishTool(ctx context.Context, name, result string, err error) {
+	start, _ := ctx.Value(callStartKey{}).(*callStart)
+	if start == nil {
+		return
+	}
+	gen := generationFrom(ctx)
+	duration := time.Since(start.at).Milliseconds()
+	gen.trace.toolFinished(name, start, result, err)
+
+	if err != nil {
+		metrics.ToolCalls.Inc(name, "error")
+		log.Printf("[trace %s] tool %s failed after %dms: %v", gen.TraceID, name, duration, err)
+		return
+	}
+	metrics.ToolCalls.Inc(name, "ok")
+	log.Printf("[trace %s] tool %s: %dms", gen.TraceID, name, duration)
+}
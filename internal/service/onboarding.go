@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 新手引导步骤
+const (
+	OnboardingFirstMessage     = "first_message"     // 发送第一条消息
+	OnboardingFirstDocument    = "first_document"    // 向知识库加入第一个文档
+	OnboardingAssistantCreated = "assistant_created" // 保存第一个自定义工作流（由自定义角色组成的助手）
+)
+
+// onboardingSteps 新手引导的步骤，按建议的引导顺序排列。exists按已有数据判断步骤是否已完成，
+// 用于补记功能上线前或事件丢失时已完成的步骤
+var onboardingSteps = []struct {
+	name   string
+	exists func(db *gorm.DB, userID uint) (bool, error)
+}{
+	{OnboardingFirstMessage, func(db *gorm.DB, userID uint) (bool, error) {
+		var count int64
+		err := db.Unscoped().Model(&model.Message{}).
+			Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+			Where("conversations.user_id = ? AND messages.role = ?", userID, "user").Limit(1).Count(&count).Error
+		return count > 0, err
+	}},
+	{OnboardingFirstDocument, func(db *gorm.DB, userID uint) (bool, error) {
+		var count int64
+		err := db.Unscoped().Model(&model.Document{}).Where("user_id = ?", userID).Limit(1).Count(&count).Error
+		return count > 0, err
+	}},
+	{OnboardingAssistantCreated, func(db *gorm.DB, userID uint) (bool, error) {
+		var count int64
+		err := db.Unscoped().Model(&model.Workflow{}).Where("user_id = ?", userID).Limit(1).Count(&count).Error
+		return count > 0, err
+	}},
+}
+
+// OnboardingStepStatus 一个新手引导步骤及其完成时间
+type OnboardingStepStatus struct {
+	Name        string     `json:"name"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// OnboardingStatus 新手引导进度，前端据此显示清单和下一步提示
+type OnboardingStatus struct {
+	Percent   int                    `json:"percent"`
+	Completed bool                   `json:"completed"`
+	NextStep  string                 `json:"next_step,omitempty"`
+	Steps     []OnboardingStepStatus `json:"steps"`
+}
+
+// OnboardingService 在服务端记录新手引导步骤，步骤完成时发布事件供通知等订阅
+type OnboardingService struct {
+	db  *gorm.DB
+	bus events.Bus
+}
+
+func NewOnboardingService(db *gorm.DB, bus events.Bus) *OnboardingService {
+	return &OnboardingService{
+		db:  db,
+		bus: bus,
+	}
+}
+
+// Subscribe 用户发送第一条消息时完成对应步骤
+func (s *OnboardingService) Subscribe(bus events.Bus) {
+	bus.Subscribe(events.MessageCreated, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.MessagePayload)
+		if !ok || payload.Role != "user" {
+			return nil
+		}
+		return s.Complete(event.UserID, OnboardingFirstMessage)
+	})
+}
+
+// Complete 记录用户完成了步骤，首次完成时发布步骤完成事件，全部完成时再发布引导完成事件
+func (s *OnboardingService) Complete(userID uint, step string) error {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.OnboardingStep{
+		UserID:      userID,
+		Step:        step,
+		CompletedAt: time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	status, err := s.Status(userID)
+	if err != nil {
+		return err
+	}
+	s.bus.Publish(context.Background(), events.New(events.UserOnboardingStepCompleted, userID, events.OnboardingPayload{
+		Step:    step,
+		Percent: status.Percent,
+	}))
+	if status.Completed {
+		s.bus.Publish(context.Background(), events.New(events.UserOnboardingCompleted, userID, events.OnboardingPayload{
+			Percent: status.Percent,
+		}))
+	}
+	return nil
+}
+
+// complete 在其他服务中记录步骤，失败时只记录日志，不影响原操作
+func (s *OnboardingService) complete(userID uint, step string) {
+	if s == nil {
+		return
+	}
+	if err := s.Complete(userID, step); err != nil {
+		log.Printf("Failed to record onboarding step %s for user %d: %v", step, userID, err)
+	}
+}
+
+// Status 获取用户的新手引导进度，未记录的步骤按已有数据补记（补记不发布事件）
+func (s *OnboardingService) Status(userID uint) (*OnboardingStatus, error) {
+	var records []model.OnboardingStep
+	if err := s.db.Where("user_id = ?", userID).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	completed := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		completed[record.Step] = record.CompletedAt
+	}
+
+	status := &OnboardingStatus{Steps: make([]OnboardingStepStatus, len(onboardingSteps))}
+	done := 0
+	for i, step := range onboardingSteps {
+		at, ok := completed[step.name]
+		if !ok {
+			exists, err := step.exists(s.db, userID)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				at, ok = time.Now(), true
+				if err := s.backfill(userID, step.name, at); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		status.Steps[i] = OnboardingStepStatus{Name: step.name, Completed: ok}
+		if ok {
+			status.Steps[i].CompletedAt = &at
+			done++
+		} else if status.NextStep == "" {
+			status.NextStep = step.name
+		}
+	}
+	status.Percent = done * 100 / len(onboardingSteps)
+	status.Completed = done == len(onboardingSteps)
+	return status, nil
+}
+
+func (s *OnboardingService) backfill(userID uint, step string, at time.Time) error {
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.OnboardingStep{
+		UserID:      userID,
+		Step:        step,
+		CompletedAt: at,
+	}).Error
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrgNotFound           = errors.New("organization not found")
+	ErrOrgForbidden          = errors.New("organization admin role required")
+	ErrOrgMemberExists       = errors.New("user is already a member")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrModelEndpointNotFound = errors.New("model endpoint not found")
+	ErrModelEndpointInvalid  = errors.New("model endpoint validation failed")
+)
+
+type CreateOrgRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type AddOrgMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"omitempty,oneof=admin member"`
+}
+
+type CreateModelEndpointRequest struct {
+	Name       string `json:"name" validate:"required,max=100"`
+	Provider   string `json:"provider" validate:"omitempty,oneof=openai azure"`
+	BaseURL    string `json:"base_url" validate:"required,url,max=255"`
+	Model      string `json:"model" validate:"required,max=64"`
+	APIKey     string `json:"api_key" validate:"required_if=Provider azure,max=512"`
+	APIVersion string `json:"api_version" validate:"required_if=Provider azure,max=32"`
+}
+
+// OrgService 管理组织、成员以及组织私有的模型服务。
+// 非成员访问组织时统一返回ErrOrgNotFound，不暴露组织是否存在
+type OrgService struct {
+	db        *gorm.DB
+	aiService *AIService
+	box       *utils.SecretBox
+}
+
+// NewOrgService 创建组织服务，encryptionKey为空时不能注册带Key的模型服务
+func NewOrgService(db *gorm.DB, aiService *AIService, encryptionKey string) (*OrgService, error) {
+	s := &OrgService{db: db, aiService: aiService}
+	if encryptionKey != "" {
+		box, err := utils.NewSecretBox(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		s.box = box
+	}
+	return s, nil
+}
+
+// CreateOrg 创建组织，创建者成为管理员
+func (s *OrgService) CreateOrg(userID uint, req *CreateOrgRequest) (*model.Organization, error) {
+	region, err := userRegion(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	org := model.Organization{Name: req.Name, Region: region, CreatedBy: userID}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.OrganizationMember{OrgID: org.ID, UserID: userID, Role: model.OrgRoleAdmin}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// ListOrgs 获取用户所在的组织
+func (s *OrgService) ListOrgs(userID uint) ([]model.Organization, error) {
+	var orgs []model.Organization
+	err := s.db.Joins("JOIN organization_members m ON m.org_id = organizations.id").
+		Where("m.user_id = ?", userID).Order("organizations.id ASC").Find(&orgs).Error
+	return orgs, err
+}
+
+// AddMember 按邮箱添加成员（组织管理员）
+func (s *OrgService) AddMember(adminID, orgID uint, req *AddOrgMemberRequest) (*model.OrganizationMember, error) {
+	if err := s.requireAdmin(orgID, adminID); err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	if err := s.db.Select("id", "region").Where("email = ?", req.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	// 组织的模型服务和成员数据需在同一区域
+	var org model.Organization
+	if err := s.db.Select("id", "region").First(&org, orgID).Error; err != nil {
+		return nil, err
+	}
+	cfg := config.Load()
+	if orgRegion := effectiveRegion(org.Region, cfg.Region); effectiveRegion(user.Region, cfg.Region) != orgRegion {
+		return nil, fmt.Errorf("%w: organization data resides in region %q", ErrRegionMismatch, orgRegion)
+	}
+
+	var count int64
+	if err := s.db.Model(&model.OrganizationMember{}).Where("org_id = ? AND user_id = ?", orgID, user.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOrgMemberExists
+	}
+
+	role := req.Role
+	if role == "" {
+		role = model.OrgRoleMember
+	}
+	member := model.OrganizationMember{OrgID: orgID, UserID: user.ID, Role: role}
+	if err := s.db.Create(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RemoveMember 移除成员（组织管理员），成员会话中选用的组织模型服务同时失效
+func (s *OrgService) RemoveMember(adminID, orgID, userID uint) error {
+	if err := s.requireAdmin(orgID, adminID); err != nil {
+		return err
+	}
+	return s.db.Where("org_id = ? AND user_id = ?", orgID, userID).Delete(&model.OrganizationMember{}).Error
+}
+
+// ListEndpoints 获取组织的模型服务（组织成员）
+func (s *OrgService) ListEndpoints(userID, orgID uint) ([]model.ModelEndpoint, error) {
+	if _, err := s.membership(orgID, userID); err != nil {
+		return nil, err
+	}
+	var endpoints []model.ModelEndpoint
+	err := s.db.Where("org_id = ?", orgID).Order("id ASC").Find(&endpoints).Error
+	return endpoints, err
+}
+
+// CreateEndpoint 校验并注册模型服务（组织管理员）
+func (s *OrgService) CreateEndpoint(ctx context.Context, userID, orgID uint, req *CreateModelEndpointRequest) (*model.ModelEndpoint, error) {
+	if err := s.requireAdmin(orgID, userID); err != nil {
+		return nil, err
+	}
+	if req.APIKey != "" && s.box == nil {
+		return nil, ErrBYOKDisabled
+	}
+
+	provider := req.Provider
+	if provider == "" {
+		provider = ProviderOpenAI
+	}
+	ai, err := s.aiService.WithUserEndpoint(Endpoint{
+		Provider:   provider,
+		BaseURL:    req.BaseURL,
+		APIKey:     req.APIKey,
+		Model:      req.Model,
+		APIVersion: req.APIVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, apiKeyValidateTimeout)
+	defer cancel()
+	if err := ai.Ping(pingCtx); err != nil {
+		// 上游的错误信息只写日志，不返回给客户端
+		log.Printf("Model endpoint validation against %s failed: %v", req.BaseURL, err)
+		return nil, ErrModelEndpointInvalid
+	}
+
+	now := time.Now()
+	endpoint := model.ModelEndpoint{
+		OrgID:           orgID,
+		Name:            req.Name,
+		Provider:        provider,
+		APIVersion:      req.APIVersion,
+		BaseURL:         req.BaseURL,
+		Model:           req.Model,
+		LastValidatedAt: &now,
+		CreatedBy:       userID,
+	}
+	if req.APIKey != "" {
+		encrypted, err := s.box.Encrypt(req.APIKey)
+		if err != nil {
+			return nil, err
+		}
+		endpoint.EncryptedKey = encrypted
+		endpoint.KeyHint = keyHint(req.APIKey)
+	}
+	if err := s.db.Create(&endpoint).Error; err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// DeleteEndpoint 删除模型服务（组织管理员），选用它的会话恢复使用默认模型
+func (s *OrgService) DeleteEndpoint(userID, orgID, endpointID uint) error {
+	if err := s.requireAdmin(orgID, userID); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND org_id = ?", endpointID, orgID).Delete(&model.ModelEndpoint{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrModelEndpointNotFound
+		}
+		return tx.Model(&model.Conversation{}).Where("model_endpoint_id = ?", endpointID).
+			UpdateColumn("model_endpoint_id", nil).Error
+	})
+}
+
+// EndpointForUser 获取用户有权使用的模型服务，用户不在该组织时返回ErrModelEndpointNotFound
+func (s *OrgService) EndpointForUser(userID, endpointID uint) (*model.ModelEndpoint, error) {
+	var endpoint model.ModelEndpoint
+	err := s.db.Joins("JOIN organization_members m ON m.org_id = model_endpoints.org_id AND m.user_id = ?", userID).
+		Where("model_endpoints.id = ?", endpointID).First(&endpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrModelEndpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// Client 创建使用该模型服务的AIService
+func (s *OrgService) Client(endpoint *model.ModelEndpoint) (*AIService, error) {
+	var apiKey string
+	if endpoint.EncryptedKey != "" {
+		if s.box == nil {
+			return nil, ErrBYOKDisabled
+		}
+		plaintext, err := s.box.Decrypt(endpoint.EncryptedKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt endpoint key: %w", err)
+		}
+		apiKey = plaintext
+	}
+	return s.aiService.WithUserEndpoint(Endpoint{
+		Provider:   endpoint.Provider,
+		BaseURL:    endpoint.BaseURL,
+		APIKey:     apiKey,
+		Model:      endpoint.Model,
+		APIVersion: endpoint.APIVersion,
+	})
+}
+
+func (s *OrgService) membership(orgID, userID uint) (*model.OrganizationMember, error) {
+	var member model.OrganizationMember
+	err := s.db.Where("org_id = ? AND user_id = ?", orgID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (s *OrgService) requireAdmin(orgID, userID uint) error {
+	member, err := s.membership(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role != model.OrgRoleAdmin {
+		return ErrOrgForbidden
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ai-chat-backend/internal/model"
+)
+
+// 已保存的组织模型服务地址在每次使用时同样检查
+func TestOrgClientRejectsPrivateBaseURL(t *testing.T) {
+	ai := &AIService{endpoint: Endpoint{Provider: ProviderOpenAI, BaseURL: "https://api.openai.com/v1", Model: "gpt-4o-mini"}}
+	s := &OrgService{aiService: ai}
+
+	tests := []struct {
+		baseURL string
+		wantErr bool
+	}{
+		{baseURL: "https://llm.example.com/v1"},
+		{baseURL: "https://10.0.0.5/v1", wantErr: true},
+		{baseURL: "http://llm.example.com/v1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			_, err := s.Client(&model.ModelEndpoint{Provider: ProviderOpenAI, BaseURL: tt.baseURL, Model: "gpt-4o-mini"})
+			if tt.wantErr != errors.Is(err, ErrEndpointURL) || (!tt.wantErr && err != nil) {
+				t.Fatalf("Client() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateEndpointRejectsPrivateBaseURL(t *testing.T) {
+	db := newTestDB(t)
+	ai := &AIService{endpoint: Endpoint{Provider: ProviderOpenAI, BaseURL: "https://api.openai.com/v1", Model: "gpt-4o-mini"}}
+	s, err := NewOrgService(db, ai, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := createTestUser(t, db, model.User{IsActive: true})
+	org, err := s.CreateOrg(owner.ID, &CreateOrgRequest{Name: "acme"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	for _, baseURL := range []string{
+		"http://api.openai.com/v1",
+		"https://127.0.0.1:8080/v1",
+		"https://169.254.169.254/latest",
+		"https://localhost/v1",
+	} {
+		t.Run(baseURL, func(t *testing.T) {
+			_, err := s.CreateEndpoint(context.Background(), owner.ID, org.ID, &CreateModelEndpointRequest{
+				Name:    "internal",
+				BaseURL: baseURL,
+				Model:   "gpt-4o-mini",
+			})
+			if !errors.Is(err, ErrEndpointURL) {
+				t.Fatalf("CreateEndpoint() error = %v, want ErrEndpointURL", err)
+			}
+		})
+	}
+}
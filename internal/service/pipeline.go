@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/metrics"
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// defaultAssistant 默认助手名称，会话未指定助手时使用
+const defaultAssistant = "default"
+
+// 流水线节点名称，用于回调中区分节点
+const (
+	nodeDetect      = "detect"
+	nodeRetrieve    = "retrieve"
+	nodePrompt      = "prompt"
+	nodeModel       = "model"
+	nodePostProcess = "postprocess"
+)
+
+var (
+	ErrAssistantInvalid  = errors.New("invalid assistant configuration")
+	ErrAssistantNotFound = errors.New("assistant not found")
+)
+
+// Assistant 助手配置，决定生成流水线中检索、提示词和后处理节点使用的组件
+type Assistant struct {
+	Name string
+	// SystemPrompt 系统提示词，可使用{date}、{query}变量，其余花括号按字面保留，为空时不添加系统消息
+	SystemPrompt string
+	// PromptTemplate 版本化的系统提示词模板名称，已发布版本时替代SystemPrompt
+	PromptTemplate string
+	// Retriever 检索组件，检索结果经注入检测和清理后作为参考资料放在系统提示词之后，nil时跳过检索
+	Retriever retriever.Retriever
+	// PostProcess 回复后处理，nil时原样返回
+	PostProcess func(ctx context.Context, content string) (string, error)
+}
+
+// pipelineInput 流水线输入，除历史消息外还携带本次生成使用的模型、工具和输出方式
+type pipelineInput struct {
+	UserID          uint
+	Conversation    *model.Conversation
+	History         []*schema.Message
+	Query           string
+	Generator       *generator
+	Tools           *toolset
+	MaxOutputTokens int
+	// Callback 不为nil时流式生成，内容片段通过Callback推送
+	Callback func(string) error
+	// Meter 流式生成时累计用量，可为nil
+	Meter *usageMeter
+	// Retrieval 本次生成的知识库检索设置
+	Retrieval retrievalOptions
+}
+
+// retrievalOptions 检索设置，由会话设置和消息的覆盖决定。Budget为最多引用的文档数，0表示使用检索组件的默认值
+type retrievalOptions struct {
+	Enabled bool
+	Budget  int
+}
+
+// pipelineOutput 流水线输出，Messages为发送给模型的完整上下文（含工具调用），用于计算用量。
+// TraceID 在开启生成追踪时为追踪记录的ID，回复保存后通过attachTrace关联；PromptVersions为使用的模板版本，
+// SourcesUsed为作为参考资料提供给模型的文档数
+type pipelineOutput struct {
+	Content        string
+	Result         *GenerationResult
+	Messages       []*schema.Message
+	TraceID        string
+	PromptVersions string
+	SourcesUsed    int
+}
+
+// pipelineState 单次运行的局部状态，检索节点写入，模型节点读取
+type pipelineState struct {
+	input          *pipelineInput
+	promptVersions string
+	sourcesUsed    int
+}
+
+// chatPipeline 编译后的生成流水线：注入检测 → 检索 → 提示词模板 → 模型（含工具调用循环） → 后处理
+type chatPipeline struct {
+	runnable compose.Runnable[*pipelineInput, *pipelineOutput]
+}
+
+// buildPipeline 按助手配置组装并编译流水线，节点之间的类型在编译时校验
+func (s *ChatService) buildPipeline(ctx context.Context, assistant *Assistant) (*chatPipeline, error) {
+	// 系统提示词可能来自版本化模板，由检索节点渲染
+	templates := []schema.MessagesTemplate{
+		schema.MessagesPlaceholder("system", true),
+		schema.MessagesPlaceholder("context", true),
+		schema.MessagesPlaceholder("history", false),
+	}
+
+	chain := compose.NewChain[*pipelineInput, *pipelineOutput](
+		compose.WithGenLocalState(func(ctx context.Context) *pipelineState {
+			return &pipelineState{}
+		}),
+	)
+	chain.
+		AppendLambda(compose.InvokableLambda(s.detectNode), compose.WithNodeName(nodeDetect)).
+		AppendLambda(compose.InvokableLambda(s.retrieveNode(assistant)), compose.WithNodeName(nodeRetrieve)).
+		AppendChatTemplate(prompt.FromMessages(schema.FString, templates...), compose.WithNodeName(nodePrompt)).
+		AppendLambda(compose.InvokableLambda(s.modelNode), compose.WithNodeName(nodeModel)).
+		AppendLambda(compose.InvokableLambda(postProcessNode(assistant.PostProcess)), compose.WithNodeName(nodePostProcess))
+
+	runnable, err := chain.Compile(ctx, compose.WithGraphName("chat:"+assistant.Name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAssistantInvalid, err)
+	}
+	return &chatPipeline{runnable: runnable}, nil
+}
+
+// detectNode 检测用户输入中疑似提示词注入/越狱的内容，达到拒绝阈值时终止生成
+func (s *ChatService) detectNode(ctx context.Context, input *pipelineInput) (*pipelineInput, error) {
+	if s.detector == nil {
+		return input, nil
+	}
+	start := time.Now()
+	defer generationFrom(ctx).trace.timing(nodeDetect, start)
+	if err := s.detector.inspectInput(ctx, input.Query); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+// retrieveNode 保存本次运行的输入，渲染系统提示词，检索参考资料并生成模板变量
+func (s *ChatService) retrieveNode(assistant *Assistant) func(ctx context.Context, input *pipelineInput) (map[string]any, error) {
+	r := assistant.Retriever
+	return func(ctx context.Context, input *pipelineInput) (map[string]any, error) {
+		system, versions, err := s.systemMessages(ctx, assistant, input.Conversation, input.Query)
+		if err != nil {
+			return nil, err
+		}
+		if err := compose.ProcessState(ctx, func(_ context.Context, state *pipelineState) error {
+			state.input = input
+			state.promptVersions = versions
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		vars := map[string]any{
+			"system":  system,
+			"history": input.History,
+		}
+		if r == nil || !input.Retrieval.Enabled || strings.TrimSpace(input.Query) == "" {
+			return vars, nil
+		}
+
+		trace := generationFrom(ctx).trace
+		start := time.Now()
+		var opts []retriever.Option
+		if input.Retrieval.Budget > 0 {
+			opts = append(opts, retriever.WithTopK(input.Retrieval.Budget))
+		}
+		docs, err := r.Retrieve(ctx, input.Query, opts...)
+		trace.timing(nodeRetrieve, start)
+		if err != nil {
+			return nil, fmt.Errorf("retrieval failed: %w", err)
+		}
+		trace.setRetrieval(docs)
+		docs = s.detector.filterDocuments(ctx, docs)
+		reference, used := s.sanitizer.referenceMessage(docs, input.Retrieval.Budget)
+		if reference != nil {
+			vars["context"] = []*schema.Message{reference}
+		}
+		if err := compose.ProcessState(ctx, func(_ context.Context, state *pipelineState) error {
+			state.sourcesUsed = used
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return vars, nil
+	}
+}
+
+// systemMessages 渲染系统提示词和安全约束，返回使用的模板版本。
+// 系统提示词优先使用助手的版本化模板，未发布版本时使用助手配置；会话的系统提示词原样放在两者之间，不作为模板渲染
+func (s *ChatService) systemMessages(ctx context.Context, assistant *Assistant, conversation *model.Conversation, query string) ([]*schema.Message, string, error) {
+	content := literalPrompt(assistant.SystemPrompt)
+	var guardrail string
+	var used []*model.PromptTemplate
+	if s.promptService != nil {
+		if assistant.PromptTemplate != "" {
+			template, err := s.promptService.Active(assistant.PromptTemplate)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to load prompt template: %w", err)
+			}
+			if template != nil {
+				content = template.Content
+				used = append(used, template)
+			}
+		}
+		template, err := s.promptService.Active(PromptGuardrail)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load guardrail template: %w", err)
+		}
+		if template != nil {
+			guardrail = template.Content
+			used = append(used, template)
+		}
+	}
+
+	var messages []*schema.Message
+	render := func(text string) error {
+		if text == "" {
+			return nil
+		}
+		rendered, err := renderPrompt(ctx, text, query)
+		if err != nil {
+			return fmt.Errorf("failed to render system prompt: %w", err)
+		}
+		messages = append(messages, rendered...)
+		return nil
+	}
+	if err := render(content); err != nil {
+		return nil, "", err
+	}
+	if conversation != nil && conversation.SystemPrompt != "" {
+		messages = append(messages, schema.SystemMessage(conversation.SystemPrompt))
+	}
+	if err := render(guardrail); err != nil {
+		return nil, "", err
+	}
+	return messages, promptVersionsLabel(used), nil
+}
+
+// modelNode 调用模型生成回复，模型请求调用工具时执行后继续生成
+func (s *ChatService) modelNode(ctx context.Context, messages []*schema.Message) (*pipelineOutput, error) {
+	var input *pipelineInput
+	var promptVersions string
+	var sourcesUsed int
+	if err := compose.ProcessState(ctx, func(_ context.Context, state *pipelineState) error {
+		input = state.input
+		promptVersions = state.promptVersions
+		sourcesUsed = state.sourcesUsed
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// 历史较长时丢弃最早的消息，使上下文和回复不超过模型的上下文窗口
+	messages, dropped := trimContext(messages, input.Generator.ai.InputBudget(input.MaxOutputTokens))
+	if dropped > 0 {
+		metrics.ContextTrimmedMessages.Add(uint64(dropped), input.Generator.ai.ModelName())
+	}
+
+	trace := generationFrom(ctx).trace
+	trace.setContext(messages)
+	start := time.Now()
+	defer trace.timing(nodeModel, start)
+
+	var (
+		content string
+		result  *GenerationResult
+		err     error
+	)
+	if input.Callback != nil {
+		content, result, messages, err = s.stream(ctx, input.Generator, input.Tools, messages, input.MaxOutputTokens, input.Callback, input.Meter)
+	} else {
+		content, result, messages, err = s.generate(ctx, input.Generator, input.Tools, messages, input.MaxOutputTokens)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pipelineOutput{Content: content, Result: result, Messages: messages, PromptVersions: promptVersions, SourcesUsed: sourcesUsed}, nil
+}
+
+// postProcessNode 对最终回复做后处理，流式生成时已推送的内容不受影响，只影响保存的回复
+func postProcessNode(fn func(ctx context.Context, content string) (string, error)) func(ctx context.Context, output *pipelineOutput) (*pipelineOutput, error) {
+	return func(ctx context.Context, output *pipelineOutput) (*pipelineOutput, error) {
+		if fn == nil {
+			return output, nil
+		}
+		content, err := fn(ctx, output.Content)
+		if err != nil {
+			return nil, fmt.Errorf("post-process failed: %w", err)
+		}
+		output.Content = content
+		return output, nil
+	}
+}
+
+// RegisterAssistant 注册或替换助手，编译失败时保留原配置
+func (s *ChatService) RegisterAssistant(ctx context.Context, assistant *Assistant) error {
+	if assistant.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrAssistantInvalid)
+	}
+	pipeline, err := s.buildPipeline(ctx, assistant)
+	if err != nil {
+		return err
+	}
+
+	s.pipelinesMu.Lock()
+	defer s.pipelinesMu.Unlock()
+	s.pipelines[assistant.Name] = pipeline
+	return nil
+}
+
+// hasAssistant 判断助手是否已注册
+func (s *ChatService) hasAssistant(name string) bool {
+	s.pipelinesMu.RLock()
+	defer s.pipelinesMu.RUnlock()
+	_, ok := s.pipelines[name]
+	return ok
+}
+
+// assistantFor 会话选用的助手，未选用时为默认助手
+func assistantFor(conversation *model.Conversation) string {
+	if conversation.Assistant == "" {
+		return defaultAssistant
+	}
+	return conversation.Assistant
+}
+
+// UseCallbacks 添加在每次生成时挂载到流水线各节点的回调
+func (s *ChatService) UseCallbacks(handlers ...callbacks.Handler) {
+	s.pipelinesMu.Lock()
+	defer s.pipelinesMu.Unlock()
+	s.callbacks = append(s.callbacks, handlers...)
+}
+
+// UseSLO 统计流式生成的首token延迟，启动时设置
+func (s *ChatService) UseSLO(slo *SLOService) {
+	s.slo = slo
+}
+
+// UseCanary 按进行中的灰度发布为部分用户切换模型，启动时设置
+func (s *ChatService) UseCanary(canary *CanaryService) {
+	s.canary = canary
+}
+
+// runPipeline 使用name对应的助手生成回复，未注册时使用默认助手
+func (s *ChatService) runPipeline(ctx context.Context, name string, input *pipelineInput) (*pipelineOutput, error) {
+	s.pipelinesMu.RLock()
+	pipeline, ok := s.pipelines[name]
+	if !ok {
+		name = defaultAssistant
+		pipeline = s.pipelines[name]
+	}
+	s.pipelinesMu.RUnlock()
+
+	gen := &generationInfo{
+		UserID:         input.UserID,
+		ConversationID: input.Conversation.ID,
+		Incognito:      input.Conversation.Incognito,
+		Region:         input.Generator.region,
+	}
+	// 无痕会话不保存生成过程
+	if s.generationTraces && !gen.Incognito {
+		gen.trace = newGenerationTrace()
+	}
+	ctx = withGeneration(ctx, gen)
+
+	output, err := pipeline.runnable.Invoke(ctx, input, s.callbackOptions()...)
+	s.saveTrace(gen, name, input, err)
+	if err == nil && gen.trace != nil {
+		output.TraceID = gen.TraceID
+	}
+	return output, err
+}
+
+// callbackOptions 运行Eino编排时挂载已添加的回调
+func (s *ChatService) callbackOptions() []compose.Option {
+	s.pipelinesMu.RLock()
+	defer s.pipelinesMu.RUnlock()
+	if len(s.callbacks) == 0 {
+		return nil
+	}
+	return []compose.Option{compose.WithCallbacks(s.callbacks...)}
+}
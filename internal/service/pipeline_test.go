@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+func TestLiteralPromptRendersBraces(t *testing.T) {
+	date := time.Now().Format("2006-01-02")
+	tests := []struct {
+		name   string
+		prompt string
+		want   string
+	}{
+		{name: "plain", prompt: "You are helpful.", want: "You are helpful."},
+		{name: "json example", prompt: `Reply as {"answer": "..."}`, want: `Reply as {"answer": "..."}`},
+		{name: "escaped braces kept literally", prompt: "{{name}}", want: "{{name}}"},
+		{name: "unknown variable", prompt: "Hello {user}", want: "Hello {user}"},
+		{name: "variables", prompt: "Today is {date}. Question: {query}", want: "Today is " + date + ". Question: what {is} this"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := renderPrompt(context.Background(), literalPrompt(tt.prompt), "what {is} this")
+			if err != nil {
+				t.Fatalf("renderPrompt() error = %v", err)
+			}
+			if len(messages) != 1 || messages[0].Content != tt.want {
+				t.Fatalf("renderPrompt() = %v, want %q", messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssistantFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		assistant string
+		want      string
+	}{
+		{name: "unset uses default", assistant: "", want: defaultAssistant},
+		{name: "configured", assistant: "support", want: "support"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := assistantFor(&model.Conversation{Assistant: tt.assistant}); got != tt.want {
+				t.Fatalf("assistantFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMessageLimitReached      = errors.New("daily message limit reached for current plan")
+	ErrTokenLimitReached        = errors.New("daily token limit reached for current plan")
+	ErrConversationLimitReached = errors.New("conversation limit reached for current plan")
+	ErrModelNotAllowed          = errors.New("model is not available on current plan")
+	ErrStorageLimitReached      = errors.New("document storage limit reached for current plan")
+)
+
+// defaultPlans 内置套餐，仅在数据库中不存在时创建，已有套餐的额度以数据库为准
+var defaultPlans = []model.Plan{
+	{Code: model.PlanFree, Name: "Free", MessagesPerDay: 50, TokensPerDay: 200000, MaxConversations: 20, MaxDocumentStorage: 10 << 20},
+	{Code: model.PlanPro, Name: "Pro", Level: 10, MessagesPerDay: 1000, TokensPerDay: 5000000, MaxDocumentStorage: 1 << 30},
+	{Code: model.PlanEnterprise, Name: "Enterprise", Level: 20},
+}
+
+type PlanService struct {
+	db *gorm.DB
+}
+
+func NewPlanService(db *gorm.DB) *PlanService {
+	return &PlanService{db: db}
+}
+
+// PlanUsage 用户当前套餐及用量
+type PlanUsage struct {
+	Plan              *model.Plan `json:"plan"`
+	MessagesToday     int64       `json:"messages_today"`
+	TokensToday       int64       `json:"tokens_today"`
+	ConversationCount int64       `json:"conversation_count"`
+}
+
+// EnsureDefaults 创建缺失的内置套餐
+func (s *PlanService) EnsureDefaults() error {
+	for _, plan := range defaultPlans {
+		if err := s.db.Where("code = ?", plan.Code).FirstOrCreate(&plan).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUserPlan 获取用户的套餐，套餐不存在或已到期时回退到免费套餐
+func (s *PlanService) GetUserPlan(userID uint) (*model.Plan, error) {
+	var user model.User
+	if err := s.db.Select("plan", "plan_expires_at").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	code := user.Plan
+	if user.PlanExpiresAt != nil && user.PlanExpiresAt.Before(time.Now()) {
+		code = model.PlanFree
+	}
+
+	var plan model.Plan
+	err := s.db.Where("code = ?", code).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && code != model.PlanFree {
+		err = s.db.Where("code = ?", model.PlanFree).First(&plan).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// GetUsage 获取用户套餐及当前用量
+func (s *PlanService) GetUsage(userID uint) (*PlanUsage, error) {
+	plan, err := s.GetUserPlan(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	today, _, err := s.usageToday(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	if err := s.db.Select("conversation_count").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &PlanUsage{
+		Plan:              plan,
+		MessagesToday:     today.Messages,
+		TokensToday:       today.TotalTokens,
+		ConversationCount: user.ConversationCount,
+	}, nil
+}
+
+// CheckConversation 检查用户是否还能创建会话
+func (s *PlanService) CheckConversation(userID uint) error {
+	plan, err := s.GetUserPlan(userID)
+	if err != nil {
+		return err
+	}
+	if plan.MaxConversations <= 0 {
+		return nil
+	}
+
+	var user model.User
+	if err := s.db.Select("conversation_count").Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	if user.ConversationCount >= int64(plan.MaxConversations) {
+		return ErrConversationLimitReached
+	}
+	return nil
+}
+
+// CheckMessage 检查用户是否可以使用该模型以及今天的消息数和token数是否已达到套餐上限，
+// 达到上限时返回*QuotaExceededError。token在生成后才计入，达到上限前的最后一次生成可能超出上限
+func (s *PlanService) CheckMessage(userID uint, modelName string) error {
+	plan, err := s.GetUserPlan(userID)
+	if err != nil {
+		return err
+	}
+	if !plan.AllowsModel(modelName) {
+		return ErrModelNotAllowed
+	}
+	if plan.MessagesPerDay <= 0 && plan.TokensPerDay <= 0 {
+		return nil
+	}
+
+	today, now, err := s.usageToday(userID)
+	if err != nil {
+		return err
+	}
+	if plan.MessagesPerDay > 0 && today.Messages >= int64(plan.MessagesPerDay) {
+		return &QuotaExceededError{Quota: QuotaMessages, Limit: int64(plan.MessagesPerDay), Used: today.Messages, ResetAt: nextMidnight(now), err: ErrMessageLimitReached}
+	}
+	if plan.TokensPerDay > 0 && today.TotalTokens >= plan.TokensPerDay {
+		return &QuotaExceededError{Quota: QuotaTokens, Limit: plan.TokensPerDay, Used: today.TotalTokens, ResetAt: nextMidnight(now), err: ErrTokenLimitReached}
+	}
+	return nil
+}
+
+// CheckDocumentStorage 检查上传size字节后是否超过文档存储上限，used为已使用的字节数
+func (s *PlanService) CheckDocumentStorage(userID uint, used, size int64) error {
+	plan, err := s.GetUserPlan(userID)
+	if err != nil {
+		return err
+	}
+	if plan.MaxDocumentStorage > 0 && used+size > plan.MaxDocumentStorage {
+		return ErrStorageLimitReached
+	}
+	return nil
+}
+
+// RecordMessage 累加用户当天（UTC日期）的消息数
+func (s *PlanService) RecordMessage(userID uint) error {
+	usage := model.DailyUsage{
+		UserID:   userID,
+		Date:     quotaDate(time.Now()),
+		Messages: 1,
+	}
+	return s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"messages":   gorm.Expr("messages + ?", 1),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&usage).Error
+}
+
+// usageToday 用户当天的用量（没有记录时为零值）及UTC的当前时间
+func (s *PlanService) usageToday(userID uint) (*model.DailyUsage, time.Time, error) {
+	now := time.Now().UTC()
+	date := quotaDate(now)
+	usage := model.DailyUsage{UserID: userID, Date: date}
+	err := s.db.Where("user_id = ? AND date = ?", userID, date).First(&usage).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, now, err
+	}
+	return &usage, now, nil
+}
+
+// quotaDate 每日额度计数的日期（UTC）。不按用户可修改的时区计算，否则切换时区即可提前进入新的一天、重置额度
+func quotaDate(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+// localDate 用户时区的当天日期，用于按用户的日期统计用量明细
+func (s *PlanService) localDate(userID uint) (string, error) {
+	now, err := s.userNow(userID)
+	if err != nil {
+		return "", err
+	}
+	return now.Format("2006-01-02"), nil
+}
+
+// userNow 用户时区的当前时间
+func (s *PlanService) userNow(userID uint) (time.Time, error) {
+	var user model.User
+	if err := s.db.Select("timezone").Where("id = ?", userID).First(&user).Error; err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().In(user.Location()), nil
+}
+
+// nextMidnight 每日额度的重置时间，即now所在时区的下一个午夜
+func nextMidnight(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+func TestQuotaDateIgnoresTimezone(t *testing.T) {
+	instant := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+	zones := []string{"UTC", "Asia/Shanghai", "America/Los_Angeles", "Pacific/Kiritimati"}
+
+	for _, name := range zones {
+		t.Run(name, func(t *testing.T) {
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				t.Skipf("时区数据不可用: %v", err)
+			}
+			now := instant.In(loc)
+			if got := quotaDate(now); got != "2026-03-01" {
+				t.Errorf("quotaDate = %s, want 2026-03-01", got)
+			}
+			if got, want := nextMidnight(now.UTC()), time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+				t.Errorf("nextMidnight = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit, used   int64
+		wantRemaining int64
+	}{
+		{name: "unlimited", limit: 0, used: 42, wantRemaining: 0},
+		{name: "within limit", limit: 10, used: 3, wantRemaining: 7},
+		{name: "at limit", limit: 10, used: 10, wantRemaining: 0},
+		{name: "over limit", limit: 10, used: 15, wantRemaining: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quota := dailyQuota(QuotaMessages, tt.limit, tt.used)
+			if quota.Remaining != tt.wantRemaining || quota.Used != tt.used || quota.Limit != tt.limit {
+				t.Errorf("dailyQuota = %+v, want remaining %d", quota, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestCheckMessageQuota(t *testing.T) {
+	db := newTestDB(t)
+	s := NewPlanService(db)
+
+	plan := model.Plan{
+		Code:           fmt.Sprintf("quota-%d", time.Now().UnixNano()),
+		Name:           "quota test",
+		MessagesPerDay: 3,
+		TokensPerDay:   100,
+		AllowedModels:  "allowed-model",
+	}
+	if err := db.Create(&plan).Error; err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		model    string
+		messages int64
+		tokens   int64
+		want     error
+	}{
+		{name: "under both limits", model: "allowed-model", messages: 2, tokens: 99, want: nil},
+		{name: "model not allowed", model: "other-model", want: ErrModelNotAllowed},
+		{name: "message limit reached", model: "allowed-model", messages: 3, want: ErrMessageLimitReached},
+		{name: "token limit reached", model: "allowed-model", messages: 1, tokens: 100, want: ErrTokenLimitReached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, db, model.User{Plan: plan.Code})
+			usage := model.DailyUsage{UserID: user.ID, Date: quotaDate(time.Now()), Messages: tt.messages, TotalTokens: tt.tokens}
+			if err := db.Create(&usage).Error; err != nil {
+				t.Fatalf("create usage: %v", err)
+			}
+
+			err := s.CheckMessage(user.ID, tt.model)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CheckMessage() error = %v, want %v", err, tt.want)
+			}
+			var exceeded *QuotaExceededError
+			if errors.As(err, &exceeded) && !exceeded.ResetAt.Equal(nextMidnight(time.Now().UTC())) {
+				t.Errorf("ResetAt = %s, want next UTC midnight", exceeded.ResetAt)
+			}
+		})
+	}
+}
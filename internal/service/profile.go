@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+)
+
+// 资料完善步骤
+const (
+	ProfileStepNickname      = "nickname"
+	ProfileStepAvatar        = "avatar"
+	ProfileStepEmailVerified = "email_verified"
+)
+
+// profileSteps 计入资料完成度的步骤，按建议的引导顺序排列。两步验证上线后在此加入
+var profileSteps = []struct {
+	name string
+	done func(user *model.User) bool
+}{
+	{ProfileStepNickname, func(user *model.User) bool { return user.Nickname != "" }},
+	{ProfileStepAvatar, func(user *model.User) bool { return user.Avatar != "" }},
+	{ProfileStepEmailVerified, func(user *model.User) bool { return user.EmailVerifiedAt != nil }},
+}
+
+// ProfileStep 一个资料完善步骤及其完成状态
+type ProfileStep struct {
+	Name      string `json:"name"`
+	Completed bool   `json:"completed"`
+}
+
+// ProfileCompletion 资料完成度，前端据此提示下一步引导
+type ProfileCompletion struct {
+	Percent   int           `json:"percent"`
+	Completed bool          `json:"completed"`
+	NextStep  string        `json:"next_step,omitempty"`
+	Steps     []ProfileStep `json:"steps"`
+}
+
+// ProfileCompletionOf 计算用户的资料完成度
+func ProfileCompletionOf(user *model.User) *ProfileCompletion {
+	completion := &ProfileCompletion{Steps: make([]ProfileStep, len(profileSteps))}
+	done := 0
+	for i, step := range profileSteps {
+		completed := step.done(user)
+		completion.Steps[i] = ProfileStep{Name: step.name, Completed: completed}
+		if completed {
+			done++
+		} else if completion.NextStep == "" {
+			completion.NextStep = step.name
+		}
+	}
+	completion.Percent = done * 100 / len(profileSteps)
+	completion.Completed = done == len(profileSteps)
+	return completion
+}
+
+// publishProfileProgress 为资料更新后新完成的步骤发布事件，全部完成时再发布资料完成事件
+func (s *UserService) publishProfileProgress(userID uint, before, after *ProfileCompletion) {
+	for i, step := range after.Steps {
+		if step.Completed && !before.Steps[i].Completed {
+			s.bus.Publish(context.Background(), events.New(events.UserProfileStepCompleted, userID, events.ProfilePayload{
+				Step:    step.Name,
+				Percent: after.Percent,
+			}))
+		}
+	}
+	if after.Completed && !before.Completed {
+		s.bus.Publish(context.Background(), events.New(events.UserProfileCompleted, userID, events.ProfilePayload{
+			Percent: after.Percent,
+		}))
+	}
+}
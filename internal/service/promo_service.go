@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPromoInvalid   = errors.New("invalid promo code")
+	ErrPromoExpired   = errors.New("promo code has expired")
+	ErrPromoExhausted = errors.New("promo code has reached its usage limit")
+	ErrPromoRedeemed  = errors.New("promo code has already been redeemed")
+	// ErrPromoPlanNotApplicable 优惠码的套餐会使用户降级或失去当前套餐的剩余时间
+	ErrPromoPlanNotApplicable = errors.New("promo plan would not upgrade or extend the current plan")
+)
+
+type CreatePromoCodeRequest struct {
+	Code           string     `json:"code" validate:"omitempty,alphanum,min=4,max=64"`
+	Plan           string     `json:"plan" validate:"required_without=Credits"`
+	PlanDays       int        `json:"plan_days" validate:"min=0"`
+	Credits        int64      `json:"credits" validate:"required_without=Plan,min=0"`
+	MaxRedemptions int        `json:"max_redemptions" validate:"min=0"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+type RedeemPromoRequest struct {
+	Code string `json:"code" validate:"required,max=64"`
+}
+
+// RedeemResult 兑换结果
+type RedeemResult struct {
+	Plan          string     `json:"plan,omitempty"`
+	PlanExpiresAt *time.Time `json:"plan_expires_at,omitempty"`
+	Credits       int64      `json:"credits,omitempty"`
+}
+
+type PromoService struct {
+	db  *gorm.DB
+	bus events.Bus
+}
+
+func NewPromoService(db *gorm.DB, bus events.Bus) *PromoService {
+	return &PromoService{db: db, bus: bus}
+}
+
+// CreateCode 创建优惠码，未指定code时随机生成
+func (s *PromoService) CreateCode(adminID uint, req *CreatePromoCodeRequest) (*model.PromoCode, error) {
+	code := strings.ToUpper(req.Code)
+	if code == "" {
+		token, err := utils.GenerateToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code = strings.ToUpper(token)
+	}
+
+	var existing int64
+	if err := s.db.Model(&model.PromoCode{}).Where("code = ?", code).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, errors.New("promo code already exists")
+	}
+
+	if req.Plan != "" {
+		var count int64
+		if err := s.db.Model(&model.Plan{}).Where("code = ?", req.Plan).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("plan %q does not exist", req.Plan)
+		}
+	}
+
+	promo := model.PromoCode{
+		Code:           code,
+		Plan:           req.Plan,
+		PlanDays:       req.PlanDays,
+		Credits:        req.Credits,
+		MaxRedemptions: req.MaxRedemptions,
+		ExpiresAt:      req.ExpiresAt,
+		CreatedBy:      adminID,
+	}
+	if err := s.db.Create(&promo).Error; err != nil {
+		return nil, err
+	}
+	return &promo, nil
+}
+
+// ListCodes 分页获取优惠码
+func (s *PromoService) ListCodes(page, pageSize int) ([]model.PromoCode, int64, error) {
+	var codes []model.PromoCode
+	var total int64
+
+	if err := s.db.Model(&model.PromoCode{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := s.db.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&codes).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return codes, total, nil
+}
+
+// Redeem 兑换优惠码，在同一事务中锁定优惠码、记录兑换并发放权益
+func (s *PromoService) Redeem(userID uint, req *RedeemPromoRequest) (*RedeemResult, error) {
+	var result RedeemResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var promo model.PromoCode
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code = ?", strings.ToUpper(strings.TrimSpace(req.Code))).First(&promo).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPromoInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if promo.ExpiresAt != nil && promo.ExpiresAt.Before(now) {
+			return ErrPromoExpired
+		}
+		if promo.MaxRedemptions > 0 && promo.Redemptions >= promo.MaxRedemptions {
+			return ErrPromoExhausted
+		}
+
+		var redeemed int64
+		if err := tx.Model(&model.PromoRedemption{}).Where("promo_code_id = ? AND user_id = ?", promo.ID, userID).Count(&redeemed).Error; err != nil {
+			return err
+		}
+		if redeemed > 0 {
+			return ErrPromoRedeemed
+		}
+
+		if err := tx.Create(&model.PromoRedemption{PromoCodeID: promo.ID, UserID: userID}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&promo).UpdateColumn("redemptions", gorm.Expr("redemptions + ?", 1)).Error; err != nil {
+			return err
+		}
+
+		if promo.Plan != "" {
+			expiresAt, ok, err := redeemPlan(tx, userID, &promo, now)
+			if err != nil {
+				return err
+			}
+			// 同时赠送额度的优惠码只发放额度，否则不消耗优惠码
+			if !ok && promo.Credits == 0 {
+				return ErrPromoPlanNotApplicable
+			}
+			if ok {
+				if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+					"plan":            promo.Plan,
+					"plan_expires_at": expiresAt,
+				}).Error; err != nil {
+					return err
+				}
+				result.Plan = promo.Plan
+				result.PlanExpiresAt = expiresAt
+			}
+		}
+
+		if promo.Credits > 0 {
+			if _, err := applyCredit(tx, userID, promo.Credits, model.CreditPromo, "promo:"+promo.Code); err != nil {
+				return err
+			}
+			result.Credits = promo.Credits
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Plan != "" {
+		s.bus.Publish(context.Background(), events.New(events.UserPlanChanged, userID, events.AccountPayload{
+			Detail: fmt.Sprintf("plan=%s reason=promo code %s", result.Plan, strings.ToUpper(req.Code)),
+		}))
+	}
+	return &result, nil
+}
+
+// redeemPlan 锁定用户当前的套餐，计算兑换优惠码后的到期时间，ok为false时不修改套餐
+func redeemPlan(tx *gorm.DB, userID uint, promo *model.PromoCode, now time.Time) (*time.Time, bool, error) {
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "plan", "plan_expires_at").
+		Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, false, err
+	}
+
+	// 已到期的套餐按免费套餐计
+	code, currentExpiresAt := user.Plan, user.PlanExpiresAt
+	if currentExpiresAt != nil && !currentExpiresAt.After(now) {
+		code, currentExpiresAt = model.PlanFree, nil
+	}
+
+	var plans []model.Plan
+	if err := tx.Where("code IN ?", []string{code, promo.Plan}).Find(&plans).Error; err != nil {
+		return nil, false, err
+	}
+	current := model.Plan{Code: code}
+	var granted *model.Plan
+	for i := range plans {
+		if plans[i].Code == code {
+			current = plans[i]
+		}
+		if plans[i].Code == promo.Plan {
+			granted = &plans[i]
+		}
+	}
+	if granted == nil {
+		return nil, false, fmt.Errorf("plan %q does not exist", promo.Plan)
+	}
+
+	expiresAt, ok := promoPlanExpiry(&current, currentExpiresAt, granted, promo.PlanDays, now)
+	return expiresAt, ok, nil
+}
+
+// promoPlanExpiry 兑换套餐优惠码后的到期时间（nil为长期有效）：只升级不降级，同一套餐从当前到期时间起延长。
+// current为用户当前有效的套餐，currentExpiresAt为其到期时间；降级、同级或会失去当前套餐剩余时间时ok为false
+func promoPlanExpiry(current *model.Plan, currentExpiresAt *time.Time, granted *model.Plan, days int, now time.Time) (*time.Time, bool) {
+	var expiresAt *time.Time
+	if days > 0 {
+		t := now.AddDate(0, 0, days)
+		expiresAt = &t
+	}
+
+	switch {
+	case granted.Code == current.Code:
+		// 长期有效的套餐无可延长
+		if currentExpiresAt == nil {
+			return nil, false
+		}
+		if days == 0 {
+			return nil, true
+		}
+		t := currentExpiresAt.AddDate(0, 0, days)
+		return &t, true
+	case granted.Level > current.Level:
+		// 赠送的套餐到期后回落到免费套餐，早于当前付费或赠送套餐的到期时间时会失去剩余时间
+		if current.Code != model.PlanFree && expiresAt != nil && (currentExpiresAt == nil || expiresAt.Before(*currentExpiresAt)) {
+			return nil, false
+		}
+		return expiresAt, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+func TestPromoPlanExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) *time.Time {
+		t := now.AddDate(0, 0, days)
+		return &t
+	}
+	free := &model.Plan{Code: model.PlanFree}
+	pro := &model.Plan{Code: model.PlanPro, Level: 10}
+	enterprise := &model.Plan{Code: model.PlanEnterprise, Level: 20}
+	team := &model.Plan{Code: "team", Level: 10}
+
+	tests := []struct {
+		name             string
+		current          *model.Plan
+		currentExpiresAt *time.Time
+		granted          *model.Plan
+		days             int
+		want             *time.Time
+		wantOK           bool
+	}{
+		{"free to pro for 30 days", free, nil, pro, 30, at(30), true},
+		{"free to permanent pro", free, nil, pro, 0, nil, true},
+		{"extend same plan from expiry", pro, at(10), pro, 30, at(40), true},
+		{"same plan made permanent", pro, at(10), pro, 0, nil, true},
+		{"permanent plan cannot be extended", pro, nil, pro, 30, nil, false},
+		{"downgrade refused", enterprise, nil, pro, 30, nil, false},
+		{"downgrade of promo plan refused", enterprise, at(5), pro, 30, nil, false},
+		{"same level other plan refused", pro, at(10), team, 30, nil, false},
+		{"shorter upgrade over paid plan refused", pro, nil, enterprise, 7, nil, false},
+		{"shorter upgrade over promo plan refused", pro, at(30), enterprise, 7, nil, false},
+		{"longer upgrade over promo plan", pro, at(30), enterprise, 60, at(60), true},
+		{"permanent upgrade over paid plan", pro, nil, enterprise, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := promoPlanExpiry(tt.current, tt.currentExpiresAt, tt.granted, tt.days, now)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Fatalf("expires at = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 兑换只赠送套餐且会降级的优惠码时返回错误，优惠码不计为已兑换
+func TestRedeemDoesNotDowngrade(t *testing.T) {
+	db := newTestDB(t)
+	if err := NewPlanService(db).EnsureDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, db, model.User{Plan: model.PlanEnterprise})
+	promo := model.PromoCode{Code: fmt.Sprintf("DOWN%d", time.Now().UnixNano()), Plan: model.PlanPro, PlanDays: 30}
+	if err := db.Create(&promo).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewPromoService(db, nil)
+	if _, err := s.Redeem(user.ID, &RedeemPromoRequest{Code: promo.Code}); !errors.Is(err, ErrPromoPlanNotApplicable) {
+		t.Fatalf("err = %v, want ErrPromoPlanNotApplicable", err)
+	}
+
+	var reloaded model.User
+	if err := db.First(&reloaded, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Plan != model.PlanEnterprise || reloaded.PlanExpiresAt != nil {
+		t.Fatalf("plan changed to %s (expires %v)", reloaded.Plan, reloaded.PlanExpiresAt)
+	}
+	var redemptions int64
+	db.Model(&model.PromoRedemption{}).Where("promo_code_id = ?", promo.ID).Count(&redemptions)
+	if redemptions != 0 {
+		t.Fatalf("promo recorded %d redemptions", redemptions)
+	}
+}
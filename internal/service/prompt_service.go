@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 版本化的提示词模板
+const (
+	// PromptSystem 系统提示词，替代助手配置中的系统提示词
+	PromptSystem = "system"
+	// PromptGuardrail 安全约束，作为系统消息放在系统提示词之后，对所有助手生效
+	PromptGuardrail = "guardrail"
+)
+
+// promptCacheTTL 当前版本的缓存时间，其他实例发布或回滚后最迟在该时间后生效
+const promptCacheTTL = 10 * time.Second
+
+var promptTemplateNames = []string{PromptSystem, PromptGuardrail, PromptWelcome}
+
+var (
+	ErrPromptTemplateInvalid  = errors.New("invalid prompt template")
+	ErrPromptTemplateNotFound = errors.New("prompt template version not found")
+)
+
+type CreatePromptVersionRequest struct {
+	// Content FString模板，可使用{date}、{query}变量
+	Content string `json:"content" validate:"required,max=20000"`
+	Note    string `json:"note" validate:"max=255"`
+	// EffectiveAt 生效时间，为空时立即生效
+	EffectiveAt *time.Time `json:"effective_at"`
+}
+
+type RollbackPromptRequest struct {
+	// Version 回滚到的版本，撤销其后的全部版本；为空时只撤销当前版本
+	Version *int `json:"version"`
+}
+
+// PromptTemplateInfo 模板及其当前版本，Active为nil时使用助手配置中的提示词
+type PromptTemplateInfo struct {
+	Name   string                `json:"name"`
+	Active *model.PromptTemplate `json:"active"`
+}
+
+type promptCacheEntry struct {
+	template  *model.PromptTemplate
+	fetchedAt time.Time
+}
+
+// PromptService 提示词模板版本管理：发布新版本、定时生效和回滚，生成时按名称获取当前版本
+type PromptService struct {
+	db *gorm.DB
+
+	mu    sync.Mutex
+	cache map[string]promptCacheEntry
+}
+
+func NewPromptService(db *gorm.DB) *PromptService {
+	return &PromptService{
+		db:    db,
+		cache: make(map[string]promptCacheEntry),
+	}
+}
+
+func validPromptName(name string) bool {
+	for _, n := range promptTemplateNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ListTemplates 获取全部模板的当前版本
+func (s *PromptService) ListTemplates() ([]PromptTemplateInfo, error) {
+	infos := make([]PromptTemplateInfo, 0, len(promptTemplateNames))
+	for _, name := range promptTemplateNames {
+		active, err := s.loadActive(name)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, PromptTemplateInfo{Name: name, Active: active})
+	}
+	return infos, nil
+}
+
+// ListVersions 按版本倒序获取模板的全部版本
+func (s *PromptService) ListVersions(name string) ([]model.PromptTemplate, error) {
+	if !validPromptName(name) {
+		return nil, fmt.Errorf("%w: unknown template %q", ErrPromptTemplateInvalid, name)
+	}
+	var versions []model.PromptTemplate
+	if err := s.db.Where("name = ?", name).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// CreateVersion 发布模板的新版本，版本号递增，发布前以示例变量渲染一次校验模板语法
+func (s *PromptService) CreateVersion(authorID uint, name string, req *CreatePromptVersionRequest) (*model.PromptTemplate, error) {
+	if !validPromptName(name) {
+		return nil, fmt.Errorf("%w: unknown template %q", ErrPromptTemplateInvalid, name)
+	}
+	var err error
+	if name == PromptWelcome {
+		_, err = renderWelcome(context.Background(), req.Content, &model.User{Nickname: "nickname"})
+	} else {
+		_, err = renderPrompt(context.Background(), req.Content, "query")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPromptTemplateInvalid, err)
+	}
+
+	template := &model.PromptTemplate{
+		Name:        name,
+		Content:     req.Content,
+		Note:        req.Note,
+		AuthorID:    authorID,
+		EffectiveAt: time.Now(),
+	}
+	if req.EffectiveAt != nil {
+		template.EffectiveAt = *req.EffectiveAt
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var latest model.PromptTemplate
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("name = ?", name).Order("version DESC").First(&latest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		template.Version = latest.Version + 1
+		return tx.Create(template).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(name)
+	return template, nil
+}
+
+// Rollback 撤销模板的版本并立即生效：指定版本时撤销其后的全部版本（含未到生效时间的），
+// 否则撤销当前版本。返回回滚后的当前版本，为nil时使用助手配置中的提示词
+func (s *PromptService) Rollback(adminID uint, name string, req *RollbackPromptRequest) (*model.PromptTemplate, error) {
+	if !validPromptName(name) {
+		return nil, fmt.Errorf("%w: unknown template %q", ErrPromptTemplateInvalid, name)
+	}
+
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&model.PromptTemplate{}).Where("name = ? AND revoked_at IS NULL", name)
+		if req.Version != nil {
+			var target model.PromptTemplate
+			err := tx.Where("name = ? AND version = ? AND revoked_at IS NULL AND effective_at <= ?", name, *req.Version, now).First(&target).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPromptTemplateNotFound
+			}
+			if err != nil {
+				return err
+			}
+			query = query.Where("version > ?", target.Version)
+		} else {
+			current, err := activePromptQuery(tx, name, now)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPromptTemplateNotFound
+			}
+			if err != nil {
+				return err
+			}
+			query = query.Where("id = ?", current.ID)
+		}
+		return query.Updates(map[string]interface{}{"revoked_at": now, "revoked_by": adminID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(name)
+	return s.loadActive(name)
+}
+
+// Active 获取模板的当前版本，未发布任何版本时返回nil
+func (s *PromptService) Active(name string) (*model.PromptTemplate, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[name]
+	s.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < promptCacheTTL {
+		return entry.template, nil
+	}
+
+	template, err := s.loadActive(name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.cache[name] = promptCacheEntry{template: template, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return template, nil
+}
+
+// Version 获取模板的指定版本，不论是否已生效或已撤销
+func (s *PromptService) Version(name string, version int) (*model.PromptTemplate, error) {
+	var template model.PromptTemplate
+	err := s.db.Where("name = ? AND version = ?", name, version).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPromptTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (s *PromptService) loadActive(name string) (*model.PromptTemplate, error) {
+	template, err := activePromptQuery(s.db, name, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (s *PromptService) invalidate(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, name)
+}
+
+// activePromptQuery 已生效且未撤销的最高版本
+func activePromptQuery(db *gorm.DB, name string, now time.Time) (*model.PromptTemplate, error) {
+	var template model.PromptTemplate
+	err := db.Where("name = ? AND revoked_at IS NULL AND effective_at <= ?", name, now).
+		Order("version DESC").First(&template).Error
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// renderPrompt 以FString渲染提示词模板
+func renderPrompt(ctx context.Context, content, query string) ([]*schema.Message, error) {
+	return schema.SystemMessage(content).Format(ctx, map[string]any{
+		"date":  time.Now().Format("2006-01-02"),
+		"query": query,
+	}, schema.FString)
+}
+
+// literalPromptReplacer 在同一位置优先匹配变量，其余花括号转义
+var literalPromptReplacer = strings.NewReplacer("{date}", "{date}", "{query}", "{query}", "{", "{{", "}", "}}")
+
+// literalPrompt 将配置中的系统提示词转为FString模板：保留{date}、{query}变量，其余花括号按字面输出
+func literalPrompt(content string) string {
+	return literalPromptReplacer.Replace(content)
+}
+
+// promptVersionsLabel 记录在消息上的模板版本，如"system:3,guardrail:1"
+func promptVersionsLabel(templates []*model.PromptTemplate) string {
+	labels := make([]string, 0, len(templates))
+	for _, template := range templates {
+		labels = append(labels, fmt.Sprintf("%s:%d", template.Name, template.Version))
+	}
+	return strings.Join(labels, ",")
+}
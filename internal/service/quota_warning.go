@@ -0,0 +1,93 @@
+package service
+
+import (
+	"log"
+	"time"
+)
+
+// 接近上限时提醒的额度类型
+const (
+	QuotaMessages = "messages" // 套餐每日消息数
+	QuotaTokens   = "tokens"   // 套餐每日token数
+	QuotaCredits  = "credits"  // 额度余额（token）
+)
+
+// QuotaWarning 接近额度上限时返回给客户端的剩余额度，客户端可在请求被拒绝前提醒用户
+type QuotaWarning struct {
+	Quota     string `json:"quota"`
+	Limit     int64  `json:"limit,omitempty"`
+	Remaining int64  `json:"remaining"`
+	// ResetAt 每日额度的重置时间（UTC午夜），额度余额不会重置
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+// DailyQuotaWarnings 当天剩余消息数或token数不超过每日上限的ratio时返回提醒，套餐不限制时不提醒
+func (s *PlanService) DailyQuotaWarnings(userID uint, ratio float64) ([]QuotaWarning, error) {
+	if ratio <= 0 {
+		return nil, nil
+	}
+	plan, err := s.GetUserPlan(userID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.MessagesPerDay <= 0 && plan.TokensPerDay <= 0 {
+		return nil, nil
+	}
+	today, now, err := s.usageToday(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resetAt := nextMidnight(now)
+	var warnings []QuotaWarning
+	for _, quota := range []struct {
+		name  string
+		limit int64
+		used  int64
+	}{
+		{QuotaMessages, int64(plan.MessagesPerDay), today.Messages},
+		{QuotaTokens, plan.TokensPerDay, today.TotalTokens},
+	} {
+		if quota.limit <= 0 {
+			continue
+		}
+		remaining := max(quota.limit-quota.used, 0)
+		if float64(remaining) > float64(quota.limit)*ratio {
+			continue
+		}
+		warnings = append(warnings, QuotaWarning{Quota: quota.name, Limit: quota.limit, Remaining: remaining, ResetAt: &resetAt})
+	}
+	return warnings, nil
+}
+
+// BalanceWarning 额度余额不超过CREDITS_WARNING_BALANCE时返回提醒，未启用额度时返回nil
+func (s *CreditService) BalanceWarning(userID uint) (*QuotaWarning, error) {
+	if !s.cfg.Enabled || s.cfg.WarningBalance <= 0 {
+		return nil, nil
+	}
+	balance, err := s.Balance(userID)
+	if err != nil {
+		return nil, err
+	}
+	if balance > s.cfg.WarningBalance {
+		return nil, nil
+	}
+	if balance < 0 {
+		balance = 0
+	}
+	return &QuotaWarning{Quota: QuotaCredits, Remaining: balance}, nil
+}
+
+// QuotaWarnings 生成回复后检查用户是否接近每日消息数、token数或额度余额的上限，查询失败只打印日志
+func (s *ChatService) QuotaWarnings(userID uint) []QuotaWarning {
+	warnings, err := s.planService.DailyQuotaWarnings(userID, s.quotaWarningRatio)
+	if err != nil {
+		log.Printf("Failed to check daily quota for user %d: %v", userID, err)
+	}
+	if warning, err := s.creditService.BalanceWarning(userID); err != nil {
+		log.Printf("Failed to check credit balance for user %d: %v", userID, err)
+	} else if warning != nil {
+		warnings = append(warnings, *warning)
+	}
+	return warnings
+}
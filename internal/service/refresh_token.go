@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// refreshReuseGrace 刷新token轮换后的该时间内再次使用只拒绝、不撤销家族，
+// 避免多个标签页同时刷新时误判为泄露
+const refreshReuseGrace = 30 * time.Second
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, please log in again")
+)
+
+// RefreshRequest 刷新或登出请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// issueTokens 签发访问token和刷新token，familyID为空时开始新的家族（新登录）
+func (s *UserService) issueTokens(tx *gorm.DB, user *model.User, familyID string) (*LoginResponse, error) {
+	cfg := config.Load()
+	token, err := utils.GenerateJWT(user.ID, cfg.JWT.Secret, cfg.JWT.Expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		if familyID, err = utils.GenerateToken(16); err != nil {
+			return nil, err
+		}
+	}
+	refresh, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	record := model.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refresh),
+		ExpiresAt: now.Add(cfg.JWT.RefreshExpiration),
+	}
+	// 顺带清理该用户已过期的刷新token
+	if err := tx.Where("user_id = ? AND expires_at < ?", user.ID, now).Delete(&model.RefreshToken{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:            token,
+		ExpiresIn:        int64(cfg.JWT.Expiration / time.Second),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: record.ExpiresAt,
+		User:             *user,
+	}, nil
+}
+
+// Refresh 以刷新token换取新的访问token，刷新token同时轮换，旧token失效。
+// 已轮换的token在宽限期后被再次使用时撤销整个家族，该次登录的所有设备需重新登录
+func (s *UserService) Refresh(req *RefreshRequest) (*LoginResponse, error) {
+	var current model.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if current.RevokedAt != nil || now.After(current.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if current.RotatedAt != nil {
+		if now.Sub(*current.RotatedAt) < refreshReuseGrace {
+			return nil, ErrRefreshTokenInvalid
+		}
+		if err := s.revokeFamily(current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	var resp *LoginResponse
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 条件更新认领，同一token并发刷新时只有一个成功
+		claim := tx.Model(&model.RefreshToken{}).Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", current.ID).
+			Update("rotated_at", now)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return ErrRefreshTokenInvalid
+		}
+
+		var user model.User
+		if err := tx.Where("id = ? AND is_active = ?", current.UserID, true).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+		var err error
+		resp, err = s.issueTokens(tx, &user, current.FamilyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Logout 撤销刷新token所属的家族，该次登录不能再刷新；已签发的访问token在过期前仍然有效。
+// token无效或已撤销时同样视为成功
+func (s *UserService) Logout(req *RefreshRequest) error {
+	var current model.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.revokeFamily(current.FamilyID)
+}
+
+func (s *UserService) revokeFamily(familyID string) error {
+	return s.db.Model(&model.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeUserTokens 撤销用户的全部刷新token，如修改密码后其他设备需重新登录
+func revokeUserTokens(tx *gorm.DB, userID uint) error {
+	return tx.Model(&model.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+)
+
+// loginTokens 为用户开始一个新的刷新token家族，返回其中的刷新token
+func loginTokens(t *testing.T, s *UserService, user *model.User) string {
+	t.Helper()
+	resp, err := s.issueTokens(s.db, user, "")
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	return resp.RefreshToken
+}
+
+func refresh(s *UserService, token string) (string, error) {
+	resp, err := s.Refresh(&RefreshRequest{RefreshToken: token})
+	if err != nil {
+		return "", err
+	}
+	return resp.RefreshToken, nil
+}
+
+func TestRefreshRotation(t *testing.T) {
+	s, _ := newTestUserService(t)
+	user := createTestUser(t, s.db, model.User{IsActive: true})
+
+	t.Run("reuse within grace window is rejected without revoking", func(t *testing.T) {
+		first := loginTokens(t, s, user)
+		second, err := refresh(s, first)
+		if err != nil {
+			t.Fatalf("first refresh: %v", err)
+		}
+		if _, err := refresh(s, first); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Fatalf("reuse = %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+		if _, err := refresh(s, second); err != nil {
+			t.Fatalf("rotated token after concurrent reuse: %v", err)
+		}
+	})
+
+	t.Run("reuse after grace window revokes the family", func(t *testing.T) {
+		first := loginTokens(t, s, user)
+		other := loginTokens(t, s, user)
+		second, err := refresh(s, first)
+		if err != nil {
+			t.Fatalf("first refresh: %v", err)
+		}
+		s.db.Model(&model.RefreshToken{}).Where("token_hash = ?", utils.HashToken(first)).
+			Update("rotated_at", time.Now().Add(-refreshReuseGrace-time.Second))
+
+		if _, err := refresh(s, first); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("reuse = %v, want %v", err, ErrRefreshTokenReused)
+		}
+		if _, err := refresh(s, second); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Fatalf("latest token in revoked family = %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+		// 其他登录（家族）不受影响
+		if _, err := refresh(s, other); err != nil {
+			t.Fatalf("token from another login: %v", err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		token := loginTokens(t, s, user)
+		s.db.Model(&model.RefreshToken{}).Where("token_hash = ?", utils.HashToken(token)).
+			Update("expires_at", time.Now().Add(-time.Minute))
+		if _, err := refresh(s, token); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Fatalf("expired token = %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+	})
+
+	t.Run("logout revokes the family", func(t *testing.T) {
+		first := loginTokens(t, s, user)
+		second, err := refresh(s, first)
+		if err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		if err := s.Logout(&RefreshRequest{RefreshToken: first}); err != nil {
+			t.Fatalf("Logout: %v", err)
+		}
+		if _, err := refresh(s, second); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Fatalf("after logout = %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+	})
+}
+
+// 修改密码撤销用户全部登录的刷新token，旧密码错误时不撤销
+func TestChangePasswordRevokesRefreshTokens(t *testing.T) {
+	s, _ := newTestUserService(t)
+	hashed, err := utils.HashPassword("old-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, s.db, model.User{IsActive: true, Password: hashed})
+	laptop := loginTokens(t, s, user)
+	phone := loginTokens(t, s, user)
+
+	if err := s.ChangePassword(user.ID, "wrong-password", "new-password"); err == nil {
+		t.Fatal("ChangePassword with wrong old password succeeded")
+	}
+	if laptop, err = refresh(s, laptop); err != nil {
+		t.Fatalf("refresh after failed password change: %v", err)
+	}
+
+	if err := s.ChangePassword(user.ID, "old-password", "new-password"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	for name, token := range map[string]string{"laptop": laptop, "phone": phone} {
+		if _, err := refresh(s, token); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Fatalf("%s token after password change = %v, want %v", name, err, ErrRefreshTokenInvalid)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRegionInvalid     = errors.New("unknown data region")
+	ErrRegionUnavailable = errors.New("no model provider configured for data region")
+	ErrRegionMismatch    = errors.New("data region mismatch")
+)
+
+// RegionMismatchError 用户的数据不在本部署的区域，客户端应改为访问Region对应的部署
+type RegionMismatchError struct {
+	Region string
+}
+
+func (e *RegionMismatchError) Error() string {
+	return fmt.Sprintf("%s: user data resides in region %q", ErrRegionMismatch, e.Region)
+}
+
+func (e *RegionMismatchError) Unwrap() error {
+	return ErrRegionMismatch
+}
+
+// effectiveRegion 用户所属的区域，未设置时为默认区域
+func effectiveRegion(region string, cfg config.RegionConfig) string {
+	if region == "" {
+		return cfg.Default
+	}
+	return region
+}
+
+// knownRegion 区域是否为配置中的区域：本部署的区域、默认区域或配置了模型服务的区域
+func knownRegion(region string, cfg config.RegionConfig) bool {
+	if region == cfg.Current || region == cfg.Default {
+		return true
+	}
+	_, ok := cfg.Providers[region]
+	return ok
+}
+
+// normalizeRegion 校验注册或创建时指定的区域，为空时使用本部署的区域（单区域部署时为默认区域）
+func normalizeRegion(region string, cfg config.RegionConfig) (string, error) {
+	region = strings.ToLower(strings.TrimSpace(region))
+	if region == "" {
+		if cfg.Current != "" {
+			return cfg.Current, nil
+		}
+		return cfg.Default, nil
+	}
+	if !knownRegion(region, cfg) {
+		return "", fmt.Errorf("%w: %s", ErrRegionInvalid, region)
+	}
+	// 数据只能写入所在区域的部署
+	if cfg.Current != "" && region != cfg.Current {
+		return "", &RegionMismatchError{Region: region}
+	}
+	return region, nil
+}
+
+// userRegion 查询用户所属的区域，未设置时为默认区域
+func userRegion(db *gorm.DB, userID uint) (string, error) {
+	var user model.User
+	if err := db.Select("id", "region").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return effectiveRegion(user.Region, config.Load().Region), nil
+}
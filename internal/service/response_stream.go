@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Chunk 流式生成中的一个增量片段
+type Chunk struct {
+	Content string
+	// ToolCalls 模型请求的工具调用增量，同一调用的参数可能分散在多个片段中
+	ToolCalls []schema.ToolCall
+	// FinishReason 结束原因，只在最后的片段中出现
+	FinishReason string
+	// Usage token用量，通常只在最后一个片段中出现
+	Usage *schema.TokenUsage
+}
+
+// ResponseStream 流式生成的统一读取接口，SSE、WebSocket等消费方都通过它逐个读取片段。
+// 由调用方在自己的goroutine中拉取，不存在后台生产者，停止读取后Close即可释放底层连接
+type ResponseStream struct {
+	reader *schema.StreamReader[*schema.Message]
+	result GenerationResult
+	closed bool
+}
+
+func newResponseStream(reader *schema.StreamReader[*schema.Message]) *ResponseStream {
+	return &ResponseStream{reader: reader}
+}
+
+// Next 返回下一个非空片段，生成结束时返回io.EOF，ctx取消时返回ctx的错误
+func (s *ResponseStream) Next(ctx context.Context) (Chunk, error) {
+	for {
+		if s.closed {
+			return Chunk{}, io.EOF
+		}
+		if err := ctx.Err(); err != nil {
+			return Chunk{}, err
+		}
+
+		msg, err := s.reader.Recv()
+		if err != nil {
+			return Chunk{}, err
+		}
+		if msg == nil {
+			continue
+		}
+
+		chunk := Chunk{
+			Content:   msg.Content,
+			ToolCalls: msg.ToolCalls,
+		}
+		if msg.ResponseMeta != nil {
+			chunk.FinishReason = msg.ResponseMeta.FinishReason
+			chunk.Usage = msg.ResponseMeta.Usage
+			if chunk.FinishReason != "" {
+				s.result.FinishReason = chunk.FinishReason
+			}
+			if chunk.Usage != nil {
+				s.result.Usage = chunk.Usage
+			}
+		}
+
+		if chunk.Content == "" && len(chunk.ToolCalls) == 0 && chunk.FinishReason == "" && chunk.Usage == nil {
+			continue
+		}
+		return chunk, nil
+	}
+}
+
+// Result 生成的汇总信息，在Next返回io.EOF后完整
+func (s *ResponseStream) Result() *GenerationResult {
+	return &s.result
+}
+
+// Close 关闭底层流，可重复调用
+func (s *ResponseStream) Close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.reader.Close()
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestResponseStreamNext(t *testing.T) {
+	usage := &schema.TokenUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+	toolCall := schema.ToolCall{ID: "call_1", Function: schema.FunctionCall{Name: "search", Arguments: `{"q":`}}
+
+	tests := []struct {
+		name       string
+		messages   []*schema.Message
+		want       []Chunk
+		wantResult GenerationResult
+	}{
+		{
+			name:     "content chunks",
+			messages: []*schema.Message{{Content: "Hel"}, {Content: "lo"}},
+			want:     []Chunk{{Content: "Hel"}, {Content: "lo"}},
+		},
+		{
+			name:     "skips empty and nil messages",
+			messages: []*schema.Message{{}, nil, {Content: "hi"}, {}},
+			want:     []Chunk{{Content: "hi"}},
+		},
+		{
+			name:     "tool call deltas",
+			messages: []*schema.Message{{ToolCalls: []schema.ToolCall{toolCall}}},
+			want:     []Chunk{{ToolCalls: []schema.ToolCall{toolCall}}},
+		},
+		{
+			name: "finish reason and usage",
+			messages: []*schema.Message{
+				{Content: "done"},
+				{ResponseMeta: &schema.ResponseMeta{FinishReason: "stop", Usage: usage}},
+			},
+			want:       []Chunk{{Content: "done"}, {FinishReason: "stop", Usage: usage}},
+			wantResult: GenerationResult{FinishReason: "stop", Usage: usage},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := newResponseStream(schema.StreamReaderFromArray(tt.messages))
+			defer stream.Close()
+
+			var got []Chunk
+			for {
+				chunk, err := stream.Next(context.Background())
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				got = append(got, chunk)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks = %+v, want %+v", got, tt.want)
+			}
+			if result := stream.Result(); !reflect.DeepEqual(*result, tt.wantResult) {
+				t.Errorf("Result() = %+v, want %+v", *result, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestResponseStreamStops(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		close bool
+		want  error
+	}{
+		{name: "cancelled context", ctx: cancelled, want: context.Canceled},
+		{name: "closed stream", ctx: context.Background(), close: true, want: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := newResponseStream(schema.StreamReaderFromArray([]*schema.Message{{Content: "unread"}}))
+			if tt.close {
+				stream.Close()
+				// 重复关闭不应panic
+				stream.Close()
+			} else {
+				defer stream.Close()
+			}
+			if _, err := stream.Next(tt.ctx); !errors.Is(err, tt.want) {
+				t.Fatalf("Next() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,630 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/rerank"
+
+	einoopenai "github.com/cloudwego/eino-ext/libs/acl/openai"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 检索方式：未配置嵌入模型或向量检索失败时只使用关键词检索
+const (
+	retrievalKeyword = "keyword"
+	retrievalHybrid  = "hybrid"
+)
+
+const (
+	// BM25参数：词频饱和度和文档长度归一化程度
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// rrfK 倒数排名融合的平滑常数，越大排名靠后的结果权重衰减越慢
+	rrfK = 60
+	// embeddingBatchSize 生成分块向量时每次请求的分块数
+	embeddingBatchSize = 32
+	// rerankTimeout 重排请求的超时
+	rerankTimeout = 10 * time.Second
+)
+
+// retrievalCandidate 候选分块在各路检索中的排名（从1开始，0表示未被该路召回）和得分
+type retrievalCandidate struct {
+	ChunkID      uint     `json:"chunk_id"`
+	DocumentID   uint     `json:"document_id"`
+	Page         int      `json:"page"`
+	KeywordRank  int      `json:"keyword_rank,omitempty"`
+	KeywordScore float64  `json:"keyword_score,omitempty"`
+	VectorRank   int      `json:"vector_rank,omitempty"`
+	VectorScore  float64  `json:"vector_score,omitempty"`
+	FusedScore   float64  `json:"fused_score"`
+	RerankScore  *float64 `json:"rerank_score,omitempty"`
+	Selected     bool     `json:"selected"`
+}
+
+// retrievalDiagnostics 一次知识库检索的诊断信息，记录在生成追踪中用于排查回答质量
+type retrievalDiagnostics struct {
+	Query       string               `json:"query"`
+	Collections []uint               `json:"collections"`
+	Mode        string               `json:"mode"`
+	Reranker    string               `json:"reranker,omitempty"`
+	Scanned     int                  `json:"scanned"`
+	Candidates  []retrievalCandidate `json:"candidates"`
+	// Errors 向量检索或重排失败的原因，失败时退回关键词检索或融合排序
+	Errors    []string         `json:"errors,omitempty"`
+	TimingsMs map[string]int64 `json:"timings_ms"`
+}
+
+// SearchResult 检索到的分块，Score为重排得分（未重排时为融合得分）
+type SearchResult struct {
+	ChunkID    uint    `json:"chunk_id"`
+	DocumentID uint    `json:"document_id"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url,omitempty"`
+	Page       int     `json:"page"`
+	Kind       string  `json:"kind"`
+	Content    string  `json:"content"`
+	Score      float64 `json:"score"`
+}
+
+// SearchResponse 检索结果及诊断信息
+type SearchResponse struct {
+	Results     []SearchResult        `json:"results"`
+	Diagnostics *retrievalDiagnostics `json:"diagnostics"`
+}
+
+// scannedChunk 检索时扫描的分块
+type scannedChunk struct {
+	ID             uint
+	DocumentID     uint
+	Page           int
+	Kind           string
+	Content        string
+	Embedding      []byte
+	Title          string
+	SourceURL      string
+	EmbeddingModel string
+}
+
+// ranked 一路检索中的一个结果，index为分块在扫描结果中的序号
+type ranked struct {
+	index int
+	score float64
+}
+
+// newEmbedder 配置了嵌入模型时创建向量客户端（OpenAI兼容接口）
+func newEmbedder(cfg config.RAGConfig) embedding.Embedder {
+	if cfg.EmbeddingModel == "" {
+		return nil
+	}
+	embedder, err := einoopenai.NewEmbeddingClient(context.Background(), &einoopenai.EmbeddingConfig{
+		APIKey:  cfg.EmbeddingAPIKey,
+		BaseURL: cfg.EmbeddingBaseURL,
+		Model:   cfg.EmbeddingModel,
+	})
+	if err != nil {
+		log.Printf("Failed to create embedding client, vector search is disabled: %v", err)
+		return nil
+	}
+	return embedder
+}
+
+// newReranker 配置了重排接口时创建重排客户端
+func newReranker(cfg config.RAGConfig) *rerank.Client {
+	if cfg.RerankURL == "" {
+		return nil
+	}
+	return rerank.New(cfg.RerankURL, cfg.RerankAPIKey, cfg.RerankModel, rerankTimeout)
+}
+
+// SearchCollection 在知识库中检索，用于调试检索效果，topK为0时使用服务端默认值
+func (s *KnowledgeService) SearchCollection(ctx context.Context, userID, collectionID uint, query string, topK int) (*SearchResponse, error) {
+	collection, err := s.collection(userID, collectionID, false)
+	if err != nil {
+		return nil, err
+	}
+	results, diagnostics, err := s.search(ctx, []uint{collection.ID}, query, topK)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchResponse{Results: results, Diagnostics: diagnostics}, nil
+}
+
+// search 混合检索：关键词（BM25）和向量两路各召回Candidates个候选，以倒数排名融合，
+// 配置了重排模型时对融合后的候选重排，返回前topK个分块
+func (s *KnowledgeService) search(ctx context.Context, collectionIDs []uint, query string, topK int) ([]SearchResult, *retrievalDiagnostics, error) {
+	if topK <= 0 {
+		topK = s.cfg.TopK
+	}
+	limit := max(s.cfg.Candidates, topK)
+	diagnostics := &retrievalDiagnostics{
+		Query:       query,
+		Collections: collectionIDs,
+		Mode:        retrievalKeyword,
+		TimingsMs:   make(map[string]int64),
+	}
+
+	start := time.Now()
+	chunks, err := s.scanChunks(collectionIDs)
+	diagnostics.TimingsMs["scan"] = time.Since(start).Milliseconds()
+	if err != nil {
+		return nil, diagnostics, err
+	}
+	diagnostics.Scanned = len(chunks)
+	if len(chunks) == 0 {
+		return nil, diagnostics, nil
+	}
+
+	start = time.Now()
+	keyword := rankKeyword(query, chunks, limit)
+	diagnostics.TimingsMs["keyword"] = time.Since(start).Milliseconds()
+
+	var vector []ranked
+	if s.embedder != nil {
+		start = time.Now()
+		vector, err = s.rankVector(ctx, query, chunks, limit)
+		diagnostics.TimingsMs["vector"] = time.Since(start).Milliseconds()
+		if err != nil {
+			log.Printf("Vector search failed, falling back to keyword search: %v", err)
+			diagnostics.Errors = append(diagnostics.Errors, "vector: "+err.Error())
+		} else {
+			diagnostics.Mode = retrievalHybrid
+		}
+	}
+
+	candidates, indexes := s.fuse(chunks, keyword, vector, limit)
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	if s.reranker != nil && len(candidates) > 0 {
+		start = time.Now()
+		reranked, err := s.rerankCandidates(ctx, query, chunks, candidates, indexes, topK)
+		diagnostics.TimingsMs["rerank"] = time.Since(start).Milliseconds()
+		if err != nil {
+			log.Printf("Rerank failed, using fused ranking: %v", err)
+			diagnostics.Errors = append(diagnostics.Errors, "rerank: "+err.Error())
+		} else {
+			order = reranked
+			diagnostics.Reranker = s.reranker.Model()
+		}
+	}
+	if len(order) > topK {
+		order = order[:topK]
+	}
+
+	results := make([]SearchResult, len(order))
+	for i, n := range order {
+		candidates[n].Selected = true
+		chunk := chunks[indexes[n]]
+		score := candidates[n].FusedScore
+		if candidates[n].RerankScore != nil {
+			score = *candidates[n].RerankScore
+		}
+		results[i] = SearchResult{
+			ChunkID:    chunk.ID,
+			DocumentID: chunk.DocumentID,
+			Title:      chunk.Title,
+			URL:        chunk.SourceURL,
+			Page:       chunk.Page,
+			Kind:       chunk.Kind,
+			Content:    chunk.Content,
+			Score:      score,
+		}
+	}
+	diagnostics.Candidates = candidates
+	return results, diagnostics, nil
+}
+
+// scanChunks 读取知识库中可检索文档的分块，超过MaxScanChunks时只取最近加入的。未配置嵌入模型时不读取向量
+func (s *KnowledgeService) scanChunks(collectionIDs []uint) ([]scannedChunk, error) {
+	columns := "document_chunks.id, document_chunks.document_id, document_chunks.page, document_chunks.kind, document_chunks.content, documents.title, documents.source_url"
+	if s.embedder != nil {
+		columns += ", document_chunks.embedding, documents.embedding_model"
+	}
+	query := s.db.Table("document_chunks").Select(columns).
+		Joins("JOIN documents ON documents.id = document_chunks.document_id AND documents.deleted_at IS NULL").
+		Where("document_chunks.collection_id IN ? AND documents.status = ?", collectionIDs, model.DocumentReady).
+		Order("document_chunks.id DESC")
+	if s.cfg.MaxScanChunks > 0 {
+		query = query.Limit(s.cfg.MaxScanChunks)
+	}
+	var chunks []scannedChunk
+	err := query.Scan(&chunks).Error
+	return chunks, err
+}
+
+// rankKeyword 按BM25对分块打分，返回得分最高的limit个（不含不包含任何查询词的分块）
+func rankKeyword(query string, chunks []scannedChunk, limit int) []ranked {
+	terms := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		terms[term] = true
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	frequencies := make([]map[string]int, len(chunks))
+	lengths := make([]int, len(chunks))
+	documentFrequency := make(map[string]int)
+	total := 0
+	for i, chunk := range chunks {
+		tokens := tokenize(chunk.Content)
+		lengths[i] = len(tokens)
+		total += len(tokens)
+		tf := make(map[string]int)
+		for _, token := range tokens {
+			if terms[token] {
+				tf[token]++
+			}
+		}
+		for term := range tf {
+			documentFrequency[term]++
+		}
+		frequencies[i] = tf
+	}
+	n := float64(len(chunks))
+	average := math.Max(float64(total)/n, 1)
+
+	var results []ranked
+	for i, tf := range frequencies {
+		score := 0.0
+		for term, count := range tf {
+			df := float64(documentFrequency[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			f := float64(count)
+			score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/average))
+		}
+		if score > 0 {
+			results = append(results, ranked{index: i, score: score})
+		}
+	}
+	return topRanked(results, limit)
+}
+
+// tokenize 切分为检索词：字母数字按词（小写），中日韩文字按相邻两字（单字的片段按单字）
+func tokenize(text string) []string {
+	var tokens []string
+	var word, cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			tokens = append(tokens, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// rankVector 按与查询向量的余弦相似度对分块打分，跳过未生成向量或由其他嵌入模型生成向量的分块
+func (s *KnowledgeService) rankVector(ctx context.Context, query string, chunks []scannedChunk, limit int) ([]ranked, error) {
+	vectors, err := s.embedder.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return nil, errors.New("embedding service returned no vector")
+	}
+	q := vectors[0]
+	qNorm := 0.0
+	for _, v := range q {
+		qNorm += v * v
+	}
+	qNorm = math.Sqrt(qNorm)
+	if qNorm == 0 {
+		return nil, nil
+	}
+
+	var results []ranked
+	for i, chunk := range chunks {
+		if chunk.EmbeddingModel != s.cfg.EmbeddingModel || len(chunk.Embedding) != len(q)*4 {
+			continue
+		}
+		var dot, norm float64
+		for j := range q {
+			v := float64(math.Float32frombits(binary.LittleEndian.Uint32(chunk.Embedding[j*4:])))
+			dot += q[j] * v
+			norm += v * v
+		}
+		if norm == 0 {
+			continue
+		}
+		results = append(results, ranked{index: i, score: dot / (qNorm * math.Sqrt(norm))})
+	}
+	return topRanked(results, limit), nil
+}
+
+// fuse 以加权倒数排名融合两路结果，返回按融合得分降序的前limit个候选及其对应的分块序号
+func (s *KnowledgeService) fuse(chunks []scannedChunk, keyword, vector []ranked, limit int) ([]retrievalCandidate, []int) {
+	byIndex := make(map[int]*retrievalCandidate)
+	candidate := func(index int) *retrievalCandidate {
+		c, ok := byIndex[index]
+		if !ok {
+			chunk := chunks[index]
+			c = &retrievalCandidate{ChunkID: chunk.ID, DocumentID: chunk.DocumentID, Page: chunk.Page}
+			byIndex[index] = c
+		}
+		return c
+	}
+	for rank, r := range keyword {
+		c := candidate(r.index)
+		c.KeywordRank, c.KeywordScore = rank+1, round4(r.score)
+		c.FusedScore += s.cfg.KeywordWeight / float64(rrfK+rank+1)
+	}
+	for rank, r := range vector {
+		c := candidate(r.index)
+		c.VectorRank, c.VectorScore = rank+1, round4(r.score)
+		c.FusedScore += s.cfg.VectorWeight / float64(rrfK+rank+1)
+	}
+
+	indexes := make([]int, 0, len(byIndex))
+	for index := range byIndex {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		a, b := byIndex[indexes[i]], byIndex[indexes[j]]
+		if a.FusedScore != b.FusedScore {
+			return a.FusedScore > b.FusedScore
+		}
+		return a.ChunkID > b.ChunkID
+	})
+	if len(indexes) > limit {
+		indexes = indexes[:limit]
+	}
+	candidates := make([]retrievalCandidate, len(indexes))
+	for i, index := range indexes {
+		candidates[i] = *byIndex[index]
+		candidates[i].FusedScore = round4(candidates[i].FusedScore)
+	}
+	return candidates, indexes
+}
+
+// rerankCandidates 由重排模型对候选排序，记录各候选的重排得分，返回前topK个候选的序号
+func (s *KnowledgeService) rerankCandidates(ctx context.Context, query string, chunks []scannedChunk, candidates []retrievalCandidate, indexes []int, topK int) ([]int, error) {
+	documents := make([]string, len(indexes))
+	for i, index := range indexes {
+		documents[i] = chunks[index].Content
+	}
+	results, err := s.reranker.Rerank(ctx, query, documents, topK)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, len(results))
+	for i, r := range results {
+		score := round4(r.Score)
+		candidates[r.Index].RerankScore = &score
+		order[i] = r.Index
+	}
+	return order, nil
+}
+
+// embedChunks 为分块生成向量，失败时清除已生成的向量
+func (s *KnowledgeService) embedChunks(ctx context.Context, rows []model.DocumentChunk) error {
+	for start := 0; start < len(rows); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(rows))
+		texts := make([]string, end-start)
+		for i := range texts {
+			texts[i] = rows[start+i].Content
+		}
+		vectors, err := s.embedder.EmbedStrings(ctx, texts)
+		if err == nil && len(vectors) != len(texts) {
+			err = fmt.Errorf("embedding service returned %d vectors for %d chunks", len(vectors), len(texts))
+		}
+		if err != nil {
+			for i := range rows {
+				rows[i].Embedding = nil
+			}
+			return err
+		}
+		for i, vector := range vectors {
+			data := make([]byte, len(vector)*4)
+			for j, v := range vector {
+				binary.LittleEndian.PutUint32(data[j*4:], math.Float32bits(float32(v)))
+			}
+			rows[start+i].Embedding = data
+		}
+	}
+	return nil
+}
+
+// topRanked 按得分降序取前limit个
+func topRanked(results []ranked, limit int) []ranked {
+	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// SetConversationCollectionRequest 为会话启用或停用知识库
+type SetConversationCollectionRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ConversationCollectionStatus 用户的知识库及是否已在会话中启用
+type ConversationCollectionStatus struct {
+	CollectionID uint   `json:"collection_id"`
+	Name         string `json:"name"`
+	Enabled      bool   `json:"enabled"`
+}
+
+// Subscribe 会话删除后清理知识库启用记录
+func (s *KnowledgeService) Subscribe(bus events.Bus) {
+	bus.Subscribe(events.ConversationDeleted, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.ConversationPayload)
+		if !ok {
+			return nil
+		}
+		return s.db.Where("conversation_id = ?", payload.ConversationID).Delete(&model.ConversationCollection{}).Error
+	})
+}
+
+// ConversationCollections 获取用户有权读取的知识库及在会话中的启用状态
+func (s *KnowledgeService) ConversationCollections(userID, conversationID uint) ([]ConversationCollectionStatus, error) {
+	if err := s.ownedConversation(userID, conversationID); err != nil {
+		return nil, err
+	}
+	var collections []model.Collection
+	if err := s.db.Where(collectionReadable, readableArgs(userID)...).Order("id ASC").Find(&collections).Error; err != nil {
+		return nil, err
+	}
+	enabledIDs, err := s.conversationCollections(userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	enabled := make(map[uint]bool, len(enabledIDs))
+	for _, id := range enabledIDs {
+		enabled[id] = true
+	}
+
+	statuses := make([]ConversationCollectionStatus, len(collections))
+	for i, collection := range collections {
+		statuses[i] = ConversationCollectionStatus{CollectionID: collection.ID, Name: collection.Name, Enabled: enabled[collection.ID]}
+	}
+	return statuses, nil
+}
+
+// SetConversationCollection 为会话启用或停用知识库，启用后生成回复时检索该知识库
+func (s *KnowledgeService) SetConversationCollection(userID, conversationID, collectionID uint, req *SetConversationCollectionRequest) error {
+	if err := s.ownedConversation(userID, conversationID); err != nil {
+		return err
+	}
+	if !req.Enabled {
+		return s.db.Where("conversation_id = ? AND collection_id = ?", conversationID, collectionID).
+			Delete(&model.ConversationCollection{}).Error
+	}
+	if _, err := s.collection(userID, collectionID, false); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := s.db.Model(&model.ConversationCollection{}).
+		Where("conversation_id = ? AND collection_id = ?", conversationID, collectionID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return s.db.Create(&model.ConversationCollection{ConversationID: conversationID, CollectionID: collectionID}).Error
+}
+
+func (s *KnowledgeService) ownedConversation(userID, conversationID uint) error {
+	var count int64
+	if err := s.db.Model(&model.Conversation{}).Where("id = ? AND user_id = ?", conversationID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+// conversationCollections 会话启用的、用户当前有权读取的知识库。组织知识库在检索时按成员角色过滤，
+// 用户失去读取权限后即使会话仍绑定该知识库也不会再检索
+func (s *KnowledgeService) conversationCollections(userID, conversationID uint) ([]uint, error) {
+	var ids []uint
+	err := s.db.Model(&model.ConversationCollection{}).
+		Joins("JOIN collections ON collections.id = conversation_collections.collection_id AND collections.deleted_at IS NULL").
+		Where("conversation_collections.conversation_id = ?", conversationID).
+		Where(collectionReadable, readableArgs(userID)...).
+		Order("collections.id").Pluck("collections.id", &ids).Error
+	return ids, err
+}
+
+// knowledgeRetriever 生成回复时检索会话绑定的知识库，会话未绑定知识库时不检索
+type knowledgeRetriever struct {
+	knowledge *KnowledgeService
+}
+
+func (r *knowledgeRetriever) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	gen := generationFrom(ctx)
+	if gen.ConversationID == 0 {
+		return nil, nil
+	}
+	collectionIDs, err := r.knowledge.conversationCollections(gen.UserID, gen.ConversationID)
+	if err != nil || len(collectionIDs) == 0 {
+		return nil, err
+	}
+
+	options := retriever.GetCommonOptions(&retriever.Options{}, opts...)
+	topK := 0
+	if options.TopK != nil {
+		topK = *options.TopK
+	}
+	results, diagnostics, err := r.knowledge.search(ctx, collectionIDs, query, topK)
+	gen.trace.setDiagnostics(diagnostics)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*schema.Document, len(results))
+	for i, result := range results {
+		source := result.Title
+		if result.Page > 0 {
+			source = fmt.Sprintf("%s, page %d", result.Title, result.Page)
+		}
+		docs[i] = (&schema.Document{
+			ID:      fmt.Sprintf("chunk:%d", result.ChunkID),
+			Content: result.Content,
+			MetaData: map[string]any{
+				"source":      source,
+				"document_id": result.DocumentID,
+				"chunk_id":    result.ChunkID,
+			},
+		}).WithScore(result.Score)
+		if result.URL != "" {
+			docs[i].MetaData["url"] = result.URL
+		}
+	}
+	return docs, nil
+}
+
+// UseKnowledge 默认助手生成回复时检索会话启用的知识库，启动时设置
+func (s *ChatService) UseKnowledge(knowledge *KnowledgeService) error {
+	return s.RegisterAssistant(context.Background(), &Assistant{
+		Name:           defaultAssistant,
+		SystemPrompt:   config.Load().Chat.SystemPrompt,
+		PromptTemplate: PromptSystem,
+		Retriever:      &knowledgeRetriever{knowledge: knowledge},
+	})
+}
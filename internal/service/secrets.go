@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"ai-chat-backend/internal/config"
+)
+
+// 用户消息中凭据的处理方式
+const (
+	SecretDetectionOff   = "off"   // 不检测
+	SecretDetectionWarn  = "warn"  // 保存时替换为占位，响应中提示用户
+	SecretDetectionBlock = "block" // 拒绝消息
+)
+
+// SecretDetectedError 消息中含有凭据且配置为拒绝时返回
+type SecretDetectedError struct {
+	Types []string
+}
+
+func (e *SecretDetectedError) Error() string {
+	return fmt.Sprintf("message rejected: it appears to contain credentials (%s)", strings.Join(e.Types, ", "))
+}
+
+// secretRule 凭据的特征，name为替换占位和响应中使用的类型
+type secretRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// secretRules 按从具体到宽泛排列，前面的规则替换后后面的规则不会再匹配同一段内容
+var secretRules = []secretRule{
+	{"private_key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?(?:-----END (?:[A-Z]+ )*PRIVATE KEY(?: BLOCK)?-----|$)`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{"anthropic_api_key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_\-]{20,}`)},
+	{"openai_api_key", regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_\-]{20,}`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"stripe_key", regexp.MustCompile(`\b(?:sk|rk)_(?:live|test)_[0-9A-Za-z]{16,}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"connection_string", regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^\s:/@]+:[^\s/@]+@[^\s]+`)},
+	// 形如 password=xxx / api_key: "xxx" 的赋值，只替换值
+	{"credential", regexp.MustCompile(`(?i)\b((?:api[_-]?key|secret[_-]?key|access[_-]?token|auth[_-]?token|client[_-]?secret|password|passwd|pwd)["']?\s*[:=]\s*["']?)([^\s"',;\[][^\s"',;]{7,})`)},
+}
+
+// secretDetector 检测用户消息中的凭据，方法在接收者为nil（未开启检测）时不做任何事
+type secretDetector struct {
+	block bool
+}
+
+func newSecretDetector(cfg config.ChatConfig) *secretDetector {
+	switch cfg.SecretDetection {
+	case SecretDetectionOff:
+		return nil
+	case SecretDetectionBlock:
+		return &secretDetector{block: true}
+	case SecretDetectionWarn, "":
+		return &secretDetector{}
+	default:
+		log.Printf("Unknown CHAT_SECRET_DETECTION mode %q, credentials will be redacted", cfg.SecretDetection)
+		return &secretDetector{}
+	}
+}
+
+// check 配置为拒绝时，消息中含有凭据则返回SecretDetectedError
+func (d *secretDetector) check(content string) error {
+	if d == nil || !d.block {
+		return nil
+	}
+	if _, types := redactSecrets(content); len(types) > 0 {
+		return &SecretDetectedError{Types: types}
+	}
+	return nil
+}
+
+// redact 将消息中的凭据替换为占位，返回替换后的内容和检测到的类型
+func (d *secretDetector) redact(content string) (string, []string) {
+	if d == nil {
+		return content, nil
+	}
+	return redactSecrets(content)
+}
+
+// redactSecrets 按规则将凭据替换为"[REDACTED:<类型>]"
+func redactSecrets(content string) (string, []string) {
+	var types []string
+	for _, rule := range secretRules {
+		if !rule.pattern.MatchString(content) {
+			continue
+		}
+		placeholder := "[REDACTED:" + rule.name + "]"
+		if rule.pattern.NumSubexp() == 2 {
+			// 保留键名，只替换值
+			content = rule.pattern.ReplaceAllString(content, "${1}"+placeholder)
+		} else {
+			content = rule.pattern.ReplaceAllLiteralString(content, placeholder)
+		}
+		types = append(types, rule.name)
+	}
+	return content, types
+}
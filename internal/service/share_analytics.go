@@ -0,0 +1,165 @@
+package service
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// shareAnalyticsTopShares 分享统计中列出的去重访客最多的链接数
+const shareAnalyticsTopShares = 10
+
+// botUserAgent 爬虫、链接预览和命令行工具的User-Agent特征，匹配的访问不计入去重访客数
+var botUserAgent = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|preview|facebookexternalhit|embedly|whatsapp|telegram|skype|curl|wget|python-|go-http-client|java/|okhttp|headless|lighthouse|uptime|monitor`)
+
+// ShareViewer 访问分享链接的客户端，用于去重访客和识别爬虫
+type ShareViewer struct {
+	IP        string
+	UserAgent string
+}
+
+// Bot 是否为爬虫或链接预览，未带User-Agent的请求也视为爬虫
+func (v ShareViewer) Bot() bool {
+	return strings.TrimSpace(v.UserAgent) == "" || botUserAgent.MatchString(v.UserAgent)
+}
+
+// ShareDailyStats 某一天的分享访问统计
+type ShareDailyStats struct {
+	Date          string `json:"date"`
+	Views         int64  `json:"views"`
+	BotViews      int64  `json:"bot_views"`
+	UniqueViewers int64  `json:"unique_viewers"`
+}
+
+// TopShare 访客最多的分享链接
+type TopShare struct {
+	ShareID        uint  `json:"share_id"`
+	UserID         uint  `json:"user_id"`
+	ConversationID uint  `json:"conversation_id"`
+	Views          int64 `json:"views"`
+	UniqueViewers  int64 `json:"unique_viewers"`
+}
+
+// ShareAnalytics 一段时间内分享链接的汇总统计，Views不含爬虫访问，供管理后台展示
+type ShareAnalytics struct {
+	Since         time.Time         `json:"since"`
+	SharesCreated int64             `json:"shares_created"`
+	ActiveShares  int64             `json:"active_shares"`
+	Views         int64             `json:"views"`
+	BotViews      int64             `json:"bot_views"`
+	UniqueViewers int64             `json:"unique_viewers"`
+	Daily         []ShareDailyStats `json:"daily"`
+	TopShares     []TopShare        `json:"top_shares"`
+}
+
+// visitStats 按访问记录统计的访问次数、爬虫访问次数和去重访客数。
+// 访客摘要按链接加盐，不同链接的访客无法关联，去重按链接和访客摘要进行
+const visitStats = "COALESCE(SUM(CASE WHEN bot THEN 0 ELSE views END), 0) AS views, " +
+	"COALESCE(SUM(CASE WHEN bot THEN views ELSE 0 END), 0) AS bot_views, " +
+	"COUNT(DISTINCT CASE WHEN bot THEN NULL ELSE share_visits.share_id END, visitor_hash) AS unique_viewers"
+
+// recordVisit 记录一次访问：同一访客同一天只保留一条记录并累计次数。访客摘要以链接的token摘要加盐，
+// 不保存IP和User-Agent原文。写入失败只打印日志，不影响查看
+func (s *ShareService) recordVisit(share *model.ConversationShare, viewer ShareViewer, now time.Time) {
+	visit := model.ShareVisit{
+		ShareID:     share.ID,
+		Date:        now.UTC().Format("2006-01-02"),
+		VisitorHash: utils.HashToken(share.TokenHash + "\n" + viewer.IP + "\n" + viewer.UserAgent)[:32],
+		Bot:         viewer.Bot(),
+		Views:       1,
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"views":      gorm.Expr("views + ?", 1),
+			"updated_at": now,
+		}),
+	}).Create(&visit).Error
+	if err != nil {
+		log.Printf("Failed to record visit of share %d: %v", share.ID, err)
+	}
+}
+
+// fillVisitStats 填充链接的去重访客数和爬虫访问次数，统计范围为保留期内的访问记录
+func (s *ShareService) fillVisitStats(shares []model.ConversationShare) error {
+	if len(shares) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(shares))
+	for _, share := range shares {
+		ids = append(ids, share.ID)
+	}
+
+	var rows []struct {
+		ShareID       uint
+		BotViews      int64
+		UniqueViewers int64
+	}
+	if err := s.db.Model(&model.ShareVisit{}).Select("share_id, "+visitStats).
+		Where("share_id IN ?", ids).Group("share_id").Scan(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for i := range shares {
+			if shares[i].ID == row.ShareID {
+				shares[i].UniqueViewers = row.UniqueViewers
+				shares[i].BotViews = row.BotViews
+			}
+		}
+	}
+	return nil
+}
+
+// Analytics 统计since之后的分享链接：新建和当前有效的链接数、访问次数、去重访客数、按天的趋势及访客最多的链接
+func (s *ShareService) Analytics(since time.Time) (*ShareAnalytics, error) {
+	analytics := &ShareAnalytics{Since: since}
+	if err := s.db.Model(&model.ConversationShare{}).Where("created_at >= ?", since).Count(&analytics.SharesCreated).Error; err != nil {
+		return nil, err
+	}
+	if err := s.activeQuery(time.Now()).Model(&model.ConversationShare{}).Count(&analytics.ActiveShares).Error; err != nil {
+		return nil, err
+	}
+
+	recent := func() *gorm.DB {
+		return s.db.Model(&model.ShareVisit{}).Where("date >= ?", since.UTC().Format("2006-01-02"))
+	}
+	var totals struct {
+		Views         int64
+		BotViews      int64
+		UniqueViewers int64
+	}
+	if err := recent().Select(visitStats).Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	analytics.Views, analytics.BotViews, analytics.UniqueViewers = totals.Views, totals.BotViews, totals.UniqueViewers
+
+	analytics.Daily = []ShareDailyStats{}
+	if err := recent().Select("date, " + visitStats).Group("date").Order("date ASC").Scan(&analytics.Daily).Error; err != nil {
+		return nil, err
+	}
+	analytics.TopShares = []TopShare{}
+	err := recent().Select("share_visits.share_id, conversation_shares.user_id, conversation_shares.conversation_id, " + visitStats).
+		Joins("JOIN conversation_shares ON conversation_shares.id = share_visits.share_id").
+		Group("share_visits.share_id, conversation_shares.user_id, conversation_shares.conversation_id").
+		Order("unique_viewers DESC").Limit(shareAnalyticsTopShares).Scan(&analytics.TopShares).Error
+	if err != nil {
+		return nil, err
+	}
+	return analytics, nil
+}
+
+// PruneVisits 删除超过保留期的访问记录，返回删除的数量；保留期为0时不删除
+func (s *ShareService) PruneVisits() (int64, error) {
+	if s.cfg.AnalyticsRetention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-s.cfg.AnalyticsRetention).UTC().Format("2006-01-02")
+	result := s.db.Where("date < ?", cutoff).Delete(&model.ShareVisit{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"container/list"
+	"sync"
+)
+
+// sharedContent 分享页的会话内容，同一版本的内容在所有访问间共享，不可修改
+type sharedContent struct {
+	title    string
+	messages []SharedMessage
+}
+
+type shareCacheEntry struct {
+	key     string
+	content *sharedContent
+}
+
+// shareCache 按分享token摘要和会话内容版本缓存分享页内容的LRU，会话有新消息、涂抹或改名后版本变化，
+// 旧版本不再被访问，随后被淘汰
+type shareCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// newShareCache size为缓存的最大条目数，不大于0时返回nil，即不缓存
+func newShareCache(size int) *shareCache {
+	if size <= 0 {
+		return nil
+	}
+	return &shareCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *shareCache) get(key string) (*sharedContent, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*shareCacheEntry).content, true
+}
+
+func (c *shareCache) put(key string, content *sharedContent) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*shareCacheEntry).content = content
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&shareCacheEntry{key: key, content: content})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*shareCacheEntry).key)
+	}
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// maxSharesPerConversation 每个会话最多同时有效的分享链接数
+const maxSharesPerConversation = 10
+
+var (
+	ErrShareNotFound      = errors.New("share link not found")
+	ErrShareUnavailable   = errors.New("share link has expired or been revoked")
+	ErrShareLimitExceeded = errors.New("too many active share links for this conversation")
+	ErrShareIncognito     = errors.New("incognito conversations cannot be shared")
+)
+
+type CreateShareRequest struct {
+	// ExpiresIn 有效期（秒），0表示不过期
+	ExpiresIn int `json:"expires_in" validate:"min=0,max=31536000"`
+	// MaxViews 访问次数上限，0表示不限
+	MaxViews int `json:"max_views" validate:"min=0,max=1000000"`
+}
+
+// ShareCreated 创建结果，token和链接只在此时返回
+type ShareCreated struct {
+	*model.ConversationShare
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// SharedMessage 分享页展示的消息
+type SharedMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedConversation 通过分享链接查看的会话
+type SharedConversation struct {
+	Title     string          `json:"title"`
+	Messages  []SharedMessage `json:"messages"`
+	ExpiresAt *time.Time      `json:"expires_at"`
+	// ViewsRemaining 剩余访问次数，不限次数时为空
+	ViewsRemaining *int `json:"views_remaining"`
+	// ETag 分享链接和会话内容版本的摘要，内容未变化时不变
+	ETag string `json:"-"`
+}
+
+// ShareService 管理会话的只读分享链接。链接可设置有效期和访问次数上限，长时间无人访问时自动撤销；
+// 数据库中只保存token的摘要，访问时校验并计数，后台任务定期撤销已失效的链接
+type ShareService struct {
+	db          *gorm.DB
+	coldStorage *ColdStorageService
+	cfg         config.ShareConfig
+	frontendURL string
+	// cache 分享页内容的进程内缓存，nil时每次访问都从数据库读取消息
+	cache *shareCache
+}
+
+func NewShareService(db *gorm.DB, coldStorage *ColdStorageService, cfg config.ShareConfig, frontendURL string) *ShareService {
+	return &ShareService{
+		db:          db,
+		coldStorage: coldStorage,
+		cfg:         cfg,
+		frontendURL: strings.TrimRight(frontendURL, "/"),
+		cache:       newShareCache(cfg.CacheSize),
+	}
+}
+
+// Subscribe 会话删除时撤销其分享链接
+func (s *ShareService) Subscribe(bus events.Bus) {
+	bus.Subscribe(events.ConversationDeleted, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.ConversationPayload)
+		if !ok {
+			return nil
+		}
+		return s.db.Model(&model.ConversationShare{}).
+			Where("conversation_id = ? AND revoked_at IS NULL", payload.ConversationID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": model.ShareRevokedDeleted}).Error
+	})
+}
+
+// Create 为会话创建分享链接
+func (s *ShareService) Create(userID, conversationID uint, req *CreateShareRequest) (*ShareCreated, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, conversationError(err)
+	}
+	// 无痕会话的消息不落库，也不应离开本服务
+	if conversation.Incognito {
+		return nil, ErrShareIncognito
+	}
+
+	var count int64
+	if err := s.activeQuery(time.Now()).Model(&model.ConversationShare{}).
+		Where("conversation_id = ?", conversationID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= maxSharesPerConversation {
+		return nil, ErrShareLimitExceeded
+	}
+
+	token, err := utils.GenerateToken(24)
+	if err != nil {
+		return nil, err
+	}
+	share := model.ConversationShare{
+		UserID:         userID,
+		ConversationID: conversationID,
+		TokenHash:      utils.HashToken(token),
+		TokenHint:      token[:8],
+		MaxViews:       req.MaxViews,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		share.ExpiresAt = &expiresAt
+	}
+	if err := s.db.Create(&share).Error; err != nil {
+		return nil, err
+	}
+	return &ShareCreated{ConversationShare: &share, Token: token, URL: s.frontendURL + "/share/" + token}, nil
+}
+
+// List 获取会话当前有效的分享链接
+func (s *ShareService) List(userID, conversationID uint) ([]model.ConversationShare, error) {
+	var conversation model.Conversation
+	if err := s.db.Select("id").Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, conversationError(err)
+	}
+
+	shares := []model.ConversationShare{}
+	if err := s.activeQuery(time.Now()).Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Order("id").Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	if err := s.fillVisitStats(shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// Revoke 撤销分享链接
+func (s *ShareService) Revoke(userID, conversationID, shareID uint) error {
+	result := s.db.Model(&model.ConversationShare{}).
+		Where("id = ? AND conversation_id = ? AND user_id = ? AND revoked_at IS NULL", shareID, conversationID, userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": model.ShareRevokedManual})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// View 通过分享链接查看会话并计一次访问，链接已失效时返回ErrShareUnavailable。
+// 有效性检查和计数每次都执行，会话内容按版本缓存，热门链接不必每次读取全部消息。
+// 访问同时按访客记入分享统计，爬虫访问同样计数（限制访问次数的链接不能靠伪装User-Agent绕过），但单独统计
+func (s *ShareService) View(ctx context.Context, token string, viewer ShareViewer) (*SharedConversation, error) {
+	var share model.ConversationShare
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareNotFound
+		}
+		return nil, err
+	}
+
+	// 计数与有效性检查在同一条语句中完成，并发访问不会超过次数上限
+	now := time.Now()
+	result := s.activeQuery(now).Model(&model.ConversationShare{}).Where("id = ?", share.ID).
+		Updates(map[string]interface{}{"view_count": gorm.Expr("view_count + 1"), "last_viewed_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrShareUnavailable
+	}
+	s.recordVisit(&share, viewer, now)
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", share.ConversationID, share.UserID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareUnavailable
+		}
+		return nil, err
+	}
+	version, err := s.contentVersion(&conversation)
+	if err != nil {
+		return nil, err
+	}
+	key := share.TokenHash + ":" + version
+	content, ok := s.cache.get(key)
+	if !ok {
+		content, err = s.loadContent(ctx, &conversation)
+		if err != nil {
+			return nil, err
+		}
+		s.cache.put(key, content)
+	}
+
+	shared := &SharedConversation{
+		Title:     content.title,
+		Messages:  content.messages,
+		ExpiresAt: share.ExpiresAt,
+		ETag:      shareETag(key),
+	}
+	if share.MaxViews > 0 {
+		remaining := max(share.MaxViews-share.ViewCount-1, 0)
+		shared.ViewsRemaining = &remaining
+	}
+	return shared, nil
+}
+
+// contentVersion 会话内容的版本：会话更新时间以及消息数和最近的消息更新时间，
+// 新消息、删除、涂抹、归档和改名都会改变版本
+func (s *ShareService) contentVersion(conversation *model.Conversation) (string, error) {
+	var stats struct {
+		Count   int64
+		Updated *time.Time
+	}
+	if err := s.db.Model(&model.Message{}).Select("COUNT(*) AS count, MAX(updated_at) AS updated").
+		Where("conversation_id = ?", conversation.ID).Scan(&stats).Error; err != nil {
+		return "", err
+	}
+	updated := int64(0)
+	if stats.Updated != nil {
+		updated = stats.Updated.UnixNano()
+	}
+	return fmt.Sprintf("%d-%d-%d", conversation.UpdatedAt.UnixNano(), stats.Count, updated), nil
+}
+
+// loadContent 读取分享页展示的消息，摘要消息是已有消息的重复，被涂抹的消息不展示。
+// 按创建时间排列（合并的会话中消息ID与时间顺序不一致）；仍在冷存储中的内容只读取、不恢复，
+// 匿名访问不改变会话的存储状态
+func (s *ShareService) loadContent(ctx context.Context, conversation *model.Conversation) (*sharedContent, error) {
+	var messages []model.Message
+	if err := s.db.Where("conversation_id = ? AND role IN ? AND redacted_at IS NULL", conversation.ID, []string{"user", "assistant"}).
+		Order("created_at ASC, id ASC").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	archived, err := s.coldStorage.ReadArchived(ctx, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &sharedContent{title: conversation.Title, messages: make([]SharedMessage, 0, len(messages))}
+	for _, message := range messages {
+		if message.ColdArchiveID != nil {
+			message.Content = archived[message.ID]
+		}
+		content.messages = append(content.messages, SharedMessage{Role: message.Role, Content: message.Content, CreatedAt: message.CreatedAt})
+	}
+	return content, nil
+}
+
+// shareETag 由分享链接的token摘要和内容版本生成强ETag，不暴露token摘要本身
+func shareETag(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// activeQuery 未撤销、未过期、未达到访问次数上限且未闲置的链接
+func (s *ShareService) activeQuery(now time.Time) *gorm.DB {
+	query := s.db.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_views = 0 OR view_count < max_views)", now)
+	if s.cfg.IdleTimeout > 0 {
+		query = query.Where("COALESCE(last_viewed_at, created_at) > ?", now.Add(-s.cfg.IdleTimeout))
+	}
+	return query
+}
+
+// RevokeInactive 撤销已过期、达到访问次数上限和闲置的链接，返回撤销的数量
+func (s *ShareService) RevokeInactive() (int64, error) {
+	now := time.Now()
+	// 撤销原因及对应的条件
+	rules := map[string]*gorm.DB{
+		model.ShareRevokedExpired:  s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now),
+		model.ShareRevokedMaxViews: s.db.Where("max_views > 0 AND view_count >= max_views"),
+	}
+	if s.cfg.IdleTimeout > 0 {
+		rules[model.ShareRevokedIdle] = s.db.Where("COALESCE(last_viewed_at, created_at) <= ?", now.Add(-s.cfg.IdleTimeout))
+	}
+
+	var revoked int64
+	for reason, query := range rules {
+		result := query.Model(&model.ConversationShare{}).Where("revoked_at IS NULL").
+			Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+		if result.Error != nil {
+			return revoked, result.Error
+		}
+		revoked += result.RowsAffected
+	}
+	return revoked, nil
+}
+
+// Start 按间隔定期撤销失效的链接并清理超过保留期的访问记录，paused返回true时跳过本轮（如只读模式），返回停止函数
+func (s *ShareService) Start(paused func() bool) func() {
+	if s.cfg.RevokeInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.cfg.RevokeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if paused != nil && paused() {
+					continue
+				}
+				revoked, err := s.RevokeInactive()
+				if err != nil {
+					log.Printf("Failed to revoke inactive share links: %v", err)
+					continue
+				}
+				if revoked > 0 {
+					log.Printf("Revoked %d inactive share links", revoked)
+				}
+				pruned, err := s.PruneVisits()
+				if err != nil {
+					log.Printf("Failed to prune share visits: %v", err)
+					continue
+				}
+				if pruned > 0 {
+					log.Printf("Pruned %d share visits", pruned)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/storage"
+)
+
+// 分享页按创建时间排列消息，冷存储中的内容只读取展示，不恢复到数据库
+func TestShareViewReadsArchivedContentWithoutRehydrating(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{})
+	coldStorage := NewColdStorageService(db, storage.NewFileStore(t.TempDir()), 30)
+	s := NewShareService(db, coldStorage, config.ShareConfig{}, "https://example.com")
+
+	old := time.Now().AddDate(0, 0, -60)
+	conversation := model.Conversation{UserID: user.ID, Title: "shared", LastMessageAt: old}
+	if err := db.Create(&conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 合并进来的消息ID较大但创建时间较早
+	messages := []model.Message{
+		{ConversationID: conversation.ID, Role: "assistant", Content: "second", CreatedAt: old.Add(time.Minute)},
+		{ConversationID: conversation.ID, Role: "user", Content: "first", CreatedAt: old},
+	}
+	for i := range messages {
+		if err := db.Create(&messages[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := coldStorage.ArchiveOld(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := s.Create(user.ID, conversation.ID, &CreateShareRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := s.View(context.Background(), created.Token, ShareViewer{IP: "203.0.113.1", UserAgent: "Mozilla/5.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"first", "second"}
+	if len(shared.Messages) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(shared.Messages), len(want))
+	}
+	for i, content := range want {
+		if shared.Messages[i].Content != content {
+			t.Errorf("message %d = %q, want %q", i, shared.Messages[i].Content, content)
+		}
+	}
+
+	var archived int64
+	db.Model(&model.Message{}).Where("conversation_id = ? AND cold_archive_id IS NOT NULL", conversation.ID).Count(&archived)
+	if archived != int64(len(messages)) {
+		t.Errorf("%d messages still archived after viewing, want %d", archived, len(messages))
+	}
+}
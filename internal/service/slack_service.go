@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/slack"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// slackMaxMessageLength Slack单条消息的最大字符数
+	slackMaxMessageLength = 40000
+	// bridgeReplyTimeout 外部平台消息生成回复的最长时间
+	bridgeReplyTimeout = 5 * time.Minute
+	// slackLinkCodeTTL 绑定码有效期
+	slackLinkCodeTTL = 10 * time.Minute
+)
+
+var (
+	ErrSlackDisabled       = errors.New("slack integration is not enabled")
+	ErrChannelLinkNotFound = errors.New("channel link not found")
+)
+
+// SlackLinkCode 绑定码，用户在要关联的频道中发送Command完成关联
+type SlackLinkCode struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SlackService Slack机器人桥接：频道通过在频道内发送绑定码关联到用户（证明用户能在该频道发言），
+// 之后频道中的消息以关联用户的身份继续对应会话，回复先发送占位消息再随流式生成更新
+type SlackService struct {
+	db            *gorm.DB
+	chatService   *ChatService
+	client        *slack.Client
+	signingSecret string
+	channels      keyedMutex
+}
+
+// NewSlackService 未配置机器人token时所有接口返回ErrSlackDisabled
+func NewSlackService(db *gorm.DB, chatService *ChatService) *SlackService {
+	cfg := config.Load()
+	s := &SlackService{
+		db:            db,
+		chatService:   chatService,
+		signingSecret: cfg.Slack.SigningSecret,
+	}
+	if cfg.Slack.BotToken != "" && cfg.Slack.SigningSecret != "" {
+		s.client = slack.NewClient(cfg.Slack.BotToken)
+	}
+	return s
+}
+
+func slackChannelKey(teamID, channelID string) string {
+	return teamID + ":" + channelID
+}
+
+// ListLinks 获取用户关联的Slack频道
+func (s *SlackService) ListLinks(userID uint) ([]model.ChannelLink, error) {
+	var links []model.ChannelLink
+	err := s.db.Where("user_id = ? AND platform = ?", userID, model.PlatformSlack).Order("id").Find(&links).Error
+	return links, err
+}
+
+// LinkCode 为用户生成绑定码，绑定码无需落库，以签名密钥签名并带过期时间
+func (s *SlackService) LinkCode(userID uint) (*SlackLinkCode, error) {
+	if s.client == nil {
+		return nil, ErrSlackDisabled
+	}
+
+	code, expiresAt := newLinkCode(s.signingSecret, model.PlatformSlack, userID, slackLinkCodeTTL)
+	return &SlackLinkCode{
+		Code:      code,
+		Command:   "link " + code,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// UnlinkChannel 取消关联，已有会话保留
+func (s *SlackService) UnlinkChannel(userID, linkID uint) error {
+	result := s.db.Where("id = ? AND user_id = ? AND platform = ?", linkID, userID, model.PlatformSlack).
+		Delete(&model.ChannelLink{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrChannelLinkNotFound
+	}
+	return nil
+}
+
+// HandleEvent 校验并处理Events API推送，url_verification时返回challenge。
+// Slack要求3秒内响应，消息在后台生成回复
+func (s *SlackService) HandleEvent(payload []byte, timestamp, signature string) (string, error) {
+	if s.client == nil {
+		return "", ErrSlackDisabled
+	}
+
+	envelope, err := slack.ParseEnvelope(payload, timestamp, signature, s.signingSecret)
+	if err != nil {
+		return "", err
+	}
+
+	switch envelope.Type {
+	case "url_verification":
+		return envelope.Challenge, nil
+	case "event_callback":
+		event := envelope.Event
+		// 忽略机器人自身的消息以及编辑、删除等子类型事件
+		if event.Type != "message" || event.Subtype != "" || event.BotID != "" || event.Text == "" {
+			return "", nil
+		}
+		go s.reply(envelope.TeamID, event)
+	}
+	return "", nil
+}
+
+// reply 为频道消息生成回复，同一频道的消息依次处理
+func (s *SlackService) reply(teamID string, event slack.MessageEvent) {
+	key := slackChannelKey(teamID, event.Channel)
+	unlock := s.channels.Lock(key)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), bridgeReplyTimeout)
+	defer cancel()
+
+	if code, ok := parseSlackLinkCommand(event.Text); ok {
+		s.linkChannel(ctx, key, event, code)
+		return
+	}
+
+	var link model.ChannelLink
+	if err := s.db.Where("platform = ? AND channel_id = ?", model.PlatformSlack, key).First(&link).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to load slack channel link: %v", err)
+		}
+		return
+	}
+
+	ts, err := s.client.PostMessage(ctx, event.Channel, bridgePlaceholder, event.ThreadTS)
+	if err != nil {
+		log.Printf("Failed to post slack reply: %v", err)
+		return
+	}
+	reply := newBridgeReply(slackMaxMessageLength, func(text string) error {
+		return s.client.UpdateMessage(ctx, event.Channel, ts, text)
+	})
+
+	err = s.chatService.BridgeMessage(ctx, &link, "Slack "+event.Channel, event.Text, reply.Write)
+	if err == nil {
+		err = reply.Flush()
+	}
+	if err != nil {
+		log.Printf("Failed to reply in slack channel %s: %v", key, err)
+		s.client.UpdateMessage(ctx, event.Channel, ts, fmt.Sprintf("Failed to generate a reply: %v", err))
+	}
+}
+
+// linkChannel 校验频道内发送的绑定码并关联频道。已关联其他用户的频道需先由该用户取消关联
+func (s *SlackService) linkChannel(ctx context.Context, key string, event slack.MessageEvent, code string) {
+	send := func(text string) {
+		if _, err := s.client.PostMessage(ctx, event.Channel, text, event.ThreadTS); err != nil {
+			log.Printf("Failed to post slack message: %v", err)
+		}
+	}
+
+	userID, err := parseLinkCode(s.signingSecret, model.PlatformSlack, code)
+	if err != nil {
+		send("This link code has expired or is invalid. Please generate a new one in the app.")
+		return
+	}
+
+	var link model.ChannelLink
+	err = s.db.Where("platform = ? AND channel_id = ?", model.PlatformSlack, key).First(&link).Error
+	switch {
+	case err == nil && link.UserID == userID:
+		send("This channel is already connected to your account.")
+		return
+	case err == nil:
+		send("This channel is already connected to another account. It must be disconnected in the app first.")
+		return
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		log.Printf("Failed to load slack channel link: %v", err)
+		send("Failed to connect this channel, please try again later.")
+		return
+	}
+
+	if err := s.db.Create(&model.ChannelLink{
+		Platform:  model.PlatformSlack,
+		ChannelID: key,
+		UserID:    userID,
+	}).Error; err != nil {
+		log.Printf("Failed to link slack channel %s: %v", key, err)
+		send("Failed to connect this channel, please try again later.")
+		return
+	}
+	send("Connected. Messages in this channel will continue your conversation.")
+}
+
+// parseSlackLinkCommand 解析频道中的绑定命令 "link <code>"，允许以@机器人开头
+func parseSlackLinkCommand(text string) (string, bool) {
+	fields := strings.Fields(text)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "<@") {
+		fields = fields[1:]
+	}
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "link") {
+		return "", false
+	}
+	return fields[1], true
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/metrics"
+)
+
+const (
+	// sloMaxSamples 每个模型最多保留的样本数，超出时丢弃最早的样本
+	sloMaxSamples = 5000
+	// sloWebhookTimeout 告警推送的超时时间
+	sloWebhookTimeout = 10 * time.Second
+)
+
+// FirstTokenSLO 一个模型在滚动窗口内的首token延迟及SLO状态
+type FirstTokenSLO struct {
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Samples   int    `json:"samples"`
+	P50Ms     int64  `json:"p50_ms"`
+	P95Ms     int64  `json:"p95_ms"`
+	TargetMs  int64  `json:"target_ms"`
+	Breaching bool   `json:"breaching"`
+	// BreachedAt 本次超标开始的时间，未超标时为空
+	BreachedAt *time.Time `json:"breached_at"`
+}
+
+// SLOReport 管理后台展示的首token延迟SLO，Warnings为当前超标模型的说明
+type SLOReport struct {
+	Enabled       bool            `json:"enabled"`
+	WindowSeconds int64           `json:"window_seconds"`
+	MinSamples    int             `json:"min_samples"`
+	Models        []FirstTokenSLO `json:"models"`
+	Warnings      []string        `json:"warnings"`
+}
+
+type latencySample struct {
+	at time.Time
+	ms int64
+}
+
+// latencySeries 一个模型的延迟样本，按时间先后排列
+type latencySeries struct {
+	provider   string
+	model      string
+	samples    []latencySample
+	breachedAt *time.Time
+}
+
+// prune 丢弃窗口之前的样本
+func (l *latencySeries) prune(since time.Time) {
+	i := sort.Search(len(l.samples), func(i int) bool {
+		return !l.samples[i].at.Before(since)
+	})
+	l.samples = l.samples[i:]
+}
+
+// percentiles 计算p50和p95（最近秩法）
+func (l *latencySeries) percentiles() (int64, int64) {
+	if len(l.samples) == 0 {
+		return 0, 0
+	}
+	values := make([]int64, len(l.samples))
+	for i, sample := range l.samples {
+		values[i] = sample.ms
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := func(p float64) int64 {
+		return values[int(math.Ceil(p*float64(len(values))))-1]
+	}
+	return rank(0.50), rank(0.95)
+}
+
+// SLOService 按模型服务和模型统计流式生成的首token延迟，滚动窗口内的p95超过目标值时
+// 发布告警事件并推送到告警地址，恢复时再推送一次。样本只保存在本实例内存中
+type SLOService struct {
+	cfg    config.SLOConfig
+	bus    events.Bus
+	client *http.Client
+
+	mu     sync.Mutex
+	series map[string]*latencySeries
+}
+
+func NewSLOService(cfg config.SLOConfig, bus events.Bus) *SLOService {
+	return &SLOService{
+		cfg:    cfg,
+		bus:    bus,
+		client: &http.Client{Timeout: sloWebhookTimeout},
+		series: make(map[string]*latencySeries),
+	}
+}
+
+// enabled 是否评估SLO，指标始终记录
+func (s *SLOService) enabled() bool {
+	return s.cfg.FirstTokenP95 > 0 && s.cfg.Window > 0
+}
+
+// RecordFirstToken 记录一次流式调用的首token延迟，接收者为nil时只计入指标
+func (s *SLOService) RecordFirstToken(provider, model string, latency time.Duration) {
+	ms := latency.Milliseconds()
+	metrics.FirstTokens.Inc(provider, model)
+	metrics.FirstTokenDuration.Add(uint64(ms), provider, model)
+	if s == nil || !s.enabled() {
+		return
+	}
+
+	key := provider + "/" + model
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	series, ok := s.series[key]
+	if !ok {
+		series = &latencySeries{provider: provider, model: model}
+		s.series[key] = series
+	}
+	series.prune(now.Add(-s.cfg.Window))
+	if len(series.samples) >= sloMaxSamples {
+		series.samples = series.samples[1:]
+	}
+	series.samples = append(series.samples, latencySample{at: now, ms: ms})
+}
+
+// target 模型的目标值，依次查找 provider/model、model 的单独配置
+func (s *SLOService) target(provider, model string) time.Duration {
+	if target, ok := s.cfg.FirstTokenTargets[provider+"/"+model]; ok {
+		return target
+	}
+	if target, ok := s.cfg.FirstTokenTargets[model]; ok {
+		return target
+	}
+	return s.cfg.FirstTokenP95
+}
+
+// Start 按配置的间隔评估SLO，返回停止函数
+func (s *SLOService) Start() func() {
+	if !s.enabled() || s.cfg.EvalInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.cfg.EvalInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.Evaluate()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Evaluate 评估各模型窗口内的p95，开始超标或恢复时发布事件。样本数不足时保持原状态
+func (s *SLOService) Evaluate() {
+	now := time.Now()
+	var changed []events.Event
+
+	s.mu.Lock()
+	for key, series := range s.series {
+		series.prune(now.Add(-s.cfg.Window))
+		if len(series.samples) == 0 && series.breachedAt == nil {
+			delete(s.series, key)
+			continue
+		}
+		if len(series.samples) < s.cfg.MinSamples {
+			continue
+		}
+
+		_, p95 := series.percentiles()
+		target := s.target(series.provider, series.model)
+		breaching := p95 > target.Milliseconds()
+		if breaching == (series.breachedAt != nil) {
+			continue
+		}
+
+		eventType := events.SLORecovered
+		series.breachedAt = nil
+		if breaching {
+			eventType = events.SLOBreached
+			series.breachedAt = &now
+		}
+		log.Printf("First-token SLO %s for %s: p95=%dms target=%dms samples=%d",
+			eventType, key, p95, target.Milliseconds(), len(series.samples))
+		changed = append(changed, events.New(eventType, 0, events.SLOPayload{
+			Provider:   series.provider,
+			Model:      series.model,
+			P95Ms:      p95,
+			TargetMs:   target.Milliseconds(),
+			Samples:    len(series.samples),
+			WindowSecs: int64(s.cfg.Window.Seconds()),
+		}))
+	}
+	s.mu.Unlock()
+
+	for _, event := range changed {
+		s.bus.Publish(context.Background(), event)
+	}
+}
+
+// Report 当前各模型的首token延迟和SLO状态，按模型服务和模型排序
+func (s *SLOService) Report() *SLOReport {
+	report := &SLOReport{
+		Enabled:       s.enabled(),
+		WindowSeconds: int64(s.cfg.Window.Seconds()),
+		MinSamples:    s.cfg.MinSamples,
+		Models:        []FirstTokenSLO{},
+		Warnings:      []string{},
+	}
+	if !report.Enabled {
+		return report
+	}
+
+	since := time.Now().Add(-s.cfg.Window)
+	s.mu.Lock()
+	for _, series := range s.series {
+		series.prune(since)
+		p50, p95 := series.percentiles()
+		target := s.target(series.provider, series.model)
+		report.Models = append(report.Models, FirstTokenSLO{
+			Provider:   series.provider,
+			Model:      series.model,
+			Samples:    len(series.samples),
+			P50Ms:      p50,
+			P95Ms:      p95,
+			TargetMs:   target.Milliseconds(),
+			Breaching:  series.breachedAt != nil,
+			BreachedAt: series.breachedAt,
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(report.Models, func(i, j int) bool {
+		if report.Models[i].Provider != report.Models[j].Provider {
+			return report.Models[i].Provider < report.Models[j].Provider
+		}
+		return report.Models[i].Model < report.Models[j].Model
+	})
+	for _, m := range report.Models {
+		if m.Breaching {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s/%s first-token p95 %dms exceeds target %dms since %s",
+				m.Provider, m.Model, m.P95Ms, m.TargetMs, m.BreachedAt.Format(time.RFC3339)))
+		}
+	}
+	return report
+}
+
+// Subscribe 配置了告警地址时推送SLO事件
+func (s *SLOService) Subscribe(bus events.Bus) {
+	if s.cfg.AlertWebhookURL == "" {
+		return
+	}
+	bus.Subscribe(events.SLOBreached, s.alert)
+	bus.Subscribe(events.SLORecovered, s.alert)
+}
+
+// alert 推送告警事件，配置密钥时以 HMAC-SHA256(secret, timestamp + "." + body) 签名，与会话webhook相同
+func (s *SLOService) alert(ctx context.Context, event events.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.AlertWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.AlertWebhookSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(s.cfg.AlertWebhookSecret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("alert webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned %s", resp.Status)
+	}
+	return nil
+}
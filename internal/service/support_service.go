@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/mail"
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxOpenTickets 每个用户同时未解决的工单数上限
+const maxOpenTickets = 5
+
+var (
+	ErrTicketNotFound              = errors.New("ticket not found")
+	ErrTooManyOpenTickets          = errors.New("too many open tickets")
+	ErrInvalidAssignee             = errors.New("assignee must be an admin")
+	ErrTranscriptNeedsConversation = errors.New("conversation_id is required to attach a transcript")
+	ErrTicketStatusConflict        = errors.New("ticket already has this status")
+)
+
+// openTicketStatuses 未解决的工单状态
+var openTicketStatuses = []string{model.TicketStatusOpen, model.TicketStatusInProgress}
+
+// SupportService 用户提交的人工客服工单，管理员分配和处理，状态变更时通知用户
+type SupportService struct {
+	db            *gorm.DB
+	exportService *ExportService
+	mailer        mail.Sender
+	bus           events.Bus
+}
+
+func NewSupportService(db *gorm.DB, exportService *ExportService, mailer mail.Sender, bus events.Bus) *SupportService {
+	return &SupportService{
+		db:            db,
+		exportService: exportService,
+		mailer:        mailer,
+		bus:           bus,
+	}
+}
+
+type CreateTicketRequest struct {
+	ConversationID *uint  `json:"conversation_id"`
+	Subject        string `json:"subject" validate:"required,max=200"`
+	Message        string `json:"message" validate:"required,max=10000"`
+	// AttachTranscript 用户同意将会话记录附在工单中
+	AttachTranscript bool `json:"attach_transcript"`
+}
+
+type AssignTicketRequest struct {
+	// AssigneeID 为空表示取消分配
+	AssigneeID *uint `json:"assignee_id"`
+}
+
+type UpdateTicketStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=open in_progress resolved closed"`
+	// Note 发送给用户的说明
+	Note string `json:"note" validate:"max=2000"`
+}
+
+// TicketDetail 工单及其处理记录
+type TicketDetail struct {
+	*model.SupportTicket
+	Events []model.SupportTicketEvent `json:"events"`
+}
+
+// TicketFilter 管理员查询工单的条件，零值表示不过滤
+type TicketFilter struct {
+	Status     string
+	AssigneeID uint
+	UserID     uint
+}
+
+// CreateTicket 提交工单。关联的会话必须属于用户，只有用户同意时才附带会话记录
+func (s *SupportService) CreateTicket(ctx context.Context, userID uint, req *CreateTicketRequest) (*model.SupportTicket, error) {
+	if req.AttachTranscript && req.ConversationID == nil {
+		return nil, ErrTranscriptNeedsConversation
+	}
+
+	ticket := model.SupportTicket{
+		UserID:         userID,
+		ConversationID: req.ConversationID,
+		Subject:        req.Subject,
+		Message:        req.Message,
+		Status:         model.TicketStatusOpen,
+	}
+	if req.ConversationID != nil {
+		if req.AttachTranscript {
+			_, transcript, err := s.exportService.Markdown(ctx, userID, *req.ConversationID)
+			if err != nil {
+				return nil, err
+			}
+			ticket.Transcript = transcript
+		} else {
+			var count int64
+			if err := s.db.Model(&model.Conversation{}).Where("id = ? AND user_id = ?", *req.ConversationID, userID).
+				Count(&count).Error; err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				return nil, ErrConversationNotFound
+			}
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定用户行，并发提交时依次计数
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		var open int64
+		if err := tx.Model(&model.SupportTicket{}).Where("user_id = ? AND status IN ?", userID, openTicketStatuses).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open >= maxOpenTickets {
+			return ErrTooManyOpenTickets
+		}
+
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.SupportTicketEvent{
+			TicketID: ticket.ID,
+			ActorID:  userID,
+			Action:   model.TicketActionCreated,
+			ToStatus: ticket.Status,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ticket, nil
+}
+
+// ListTickets 分页获取用户自己的工单，不含会话记录
+func (s *SupportService) ListTickets(userID uint, page, pageSize int) ([]model.SupportTicket, int64, error) {
+	return s.list(s.db.Where("user_id = ?", userID), page, pageSize)
+}
+
+// GetTicket 获取用户自己的工单及处理记录
+func (s *SupportService) GetTicket(userID, ticketID uint) (*TicketDetail, error) {
+	return s.detail(s.db.Where("id = ? AND user_id = ?", ticketID, userID))
+}
+
+// AdminListTickets 分页获取工单（管理员），不含会话记录
+func (s *SupportService) AdminListTickets(filter *TicketFilter, page, pageSize int) ([]model.SupportTicket, int64, error) {
+	query := s.db
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.AssigneeID != 0 {
+		query = query.Where("assignee_id = ?", filter.AssigneeID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	return s.list(query, page, pageSize)
+}
+
+// AdminGetTicket 获取工单及处理记录（管理员）
+func (s *SupportService) AdminGetTicket(ticketID uint) (*TicketDetail, error) {
+	return s.detail(s.db.Where("id = ?", ticketID))
+}
+
+func (s *SupportService) list(query *gorm.DB, page, pageSize int) ([]model.SupportTicket, int64, error) {
+	query = query.Model(&model.SupportTicket{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tickets []model.SupportTicket
+	err := query.Omit("transcript").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&tickets).Error
+	return tickets, total, err
+}
+
+func (s *SupportService) detail(query *gorm.DB) (*TicketDetail, error) {
+	var ticket model.SupportTicket
+	if err := query.First(&ticket).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTicketNotFound
+		}
+		return nil, err
+	}
+
+	detail := &TicketDetail{SupportTicket: &ticket}
+	if err := s.db.Where("ticket_id = ?", ticket.ID).Order("id ASC").Find(&detail.Events).Error; err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// AssignTicket 将工单分配给管理员或取消分配（管理员）
+func (s *SupportService) AssignTicket(adminID, ticketID uint, req *AssignTicketRequest) (*model.SupportTicket, error) {
+	if req.AssigneeID != nil {
+		var count int64
+		if err := s.db.Model(&model.User{}).Where("id = ? AND role = ?", *req.AssigneeID, model.RoleAdmin).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrInvalidAssignee
+		}
+	}
+
+	var ticket model.SupportTicket
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", ticketID).First(&ticket).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTicketNotFound
+			}
+			return err
+		}
+		if err := tx.Model(&ticket).Update("assignee_id", req.AssigneeID).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.SupportTicketEvent{
+			TicketID:   ticket.ID,
+			ActorID:    adminID,
+			Action:     model.TicketActionAssigned,
+			AssigneeID: req.AssigneeID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	ticket.AssigneeID = req.AssigneeID
+	return &ticket, nil
+}
+
+// UpdateStatus 修改工单状态（管理员），之后邮件通知用户并发布事件
+func (s *SupportService) UpdateStatus(adminID, ticketID uint, req *UpdateTicketStatusRequest) (*model.SupportTicket, error) {
+	var ticket model.SupportTicket
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", ticketID).First(&ticket).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTicketNotFound
+			}
+			return err
+		}
+		if ticket.Status == req.Status {
+			return ErrTicketStatusConflict
+		}
+
+		fromStatus := ticket.Status
+		ticket.Status = req.Status
+		ticket.ResolvedAt = nil
+		if req.Status == model.TicketStatusResolved || req.Status == model.TicketStatusClosed {
+			now := time.Now()
+			ticket.ResolvedAt = &now
+		}
+		if err := tx.Model(&ticket).Select("status", "resolved_at").Updates(&ticket).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.SupportTicketEvent{
+			TicketID:   ticket.ID,
+			ActorID:    adminID,
+			Action:     model.TicketActionStatusChanged,
+			FromStatus: fromStatus,
+			ToStatus:   req.Status,
+			Note:       req.Note,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(&ticket, req.Note)
+	return &ticket, nil
+}
+
+// ticketStatusNames 通知中显示的状态名称
+var ticketStatusNames = map[string]string{
+	model.TicketStatusOpen:       "待处理",
+	model.TicketStatusInProgress: "处理中",
+	model.TicketStatusResolved:   "已解决",
+	model.TicketStatusClosed:     "已关闭",
+}
+
+// notify 工单状态变更后邮件通知用户，发送失败只记录日志
+func (s *SupportService) notify(ticket *model.SupportTicket, note string) {
+	s.bus.Publish(context.Background(), events.New(events.SupportTicketUpdated, ticket.UserID, events.SupportTicketPayload{
+		TicketID: ticket.ID,
+		Subject:  ticket.Subject,
+		Status:   ticket.Status,
+		Note:     note,
+	}))
+
+	var user model.User
+	if err := s.db.Select("id", "email").Where("id = ?", ticket.UserID).First(&user).Error; err != nil {
+		log.Printf("Failed to load user %d for ticket %d notification: %v", ticket.UserID, ticket.ID, err)
+		return
+	}
+	body := fmt.Sprintf("您的工单 #%d「%s」状态已更新为：%s。", ticket.ID, ticket.Subject, ticketStatusNames[ticket.Status])
+	if note != "" {
+		body += "\n\n客服留言：\n" + note
+	}
+	body += fmt.Sprintf("\n\n查看工单：%s/support/tickets/%d", config.Load().App.FrontendURL, ticket.ID)
+	if err := s.mailer.Send(user.Email, fmt.Sprintf("工单 #%d 状态更新", ticket.ID), body); err != nil {
+		log.Printf("Failed to send ticket %d notification: %v", ticket.ID, err)
+	}
+}
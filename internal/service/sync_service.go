@@ -0,0 +1,212 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("invalid sync cursor")
+
+// 变更时间：会话的最后消息时间、软删除时间同样视为变更
+const (
+	conversationChangedAt = "GREATEST(conversations.updated_at, conversations.last_message_at, COALESCE(conversations.deleted_at, conversations.updated_at))"
+	messageChangedAt      = "GREATEST(messages.updated_at, COALESCE(messages.deleted_at, messages.updated_at))"
+)
+
+// SyncResult 自游标以来的变更。Cursor用于下一次同步；HasMore为true时应立即用Cursor继续拉取
+type SyncResult struct {
+	Conversations          []model.Conversation `json:"conversations"`
+	Messages               []model.Message      `json:"messages"`
+	DeletedConversationIDs []uint               `json:"deleted_conversation_ids"`
+	DeletedMessageIDs      []uint               `json:"deleted_message_ids"`
+	Cursor                 string               `json:"cursor"`
+	HasMore                bool                 `json:"has_more"`
+}
+
+// 变更的种类，同一时间的变更按种类、ID排列
+const (
+	syncConversation = iota
+	syncMessage
+)
+
+// syncPosition 变更在同步顺序中的位置：按(变更时间, 种类, ID)排列，同一时间的大量变更也能逐页推进
+type syncPosition struct {
+	at   time.Time
+	kind int
+	id   uint
+}
+
+func (p syncPosition) before(other syncPosition) bool {
+	if !p.at.Equal(other.at) {
+		return p.at.Before(other.at)
+	}
+	if p.kind != other.kind {
+		return p.kind < other.kind
+	}
+	return p.id < other.id
+}
+
+// after 某种变更中位于游标之后的条件。kind为-1的游标（首次同步或旧格式）包含该时间的全部变更
+func (p syncPosition) after(changedAt, idColumn string, kind int) (string, []interface{}) {
+	switch {
+	case kind > p.kind:
+		return changedAt + " >= ?", []interface{}{p.at}
+	case kind == p.kind:
+		return "(" + changedAt + " > ? OR (" + changedAt + " = ? AND " + idColumn + " > ?))", []interface{}{p.at, p.at, p.id}
+	default:
+		return changedAt + " > ?", []interface{}{p.at}
+	}
+}
+
+// conversationChangedTime 与conversationChangedAt一致的变更时间
+func conversationChangedTime(c *model.Conversation) time.Time {
+	t := c.UpdatedAt
+	if c.LastMessageAt.After(t) {
+		t = c.LastMessageAt
+	}
+	if c.DeletedAt.Valid && c.DeletedAt.Time.After(t) {
+		t = c.DeletedAt.Time
+	}
+	return t
+}
+
+// messageChangedTime 与messageChangedAt一致的变更时间
+func messageChangedTime(m *model.Message) time.Time {
+	if m.DeletedAt.Valid && m.DeletedAt.Time.After(m.UpdatedAt) {
+		return m.DeletedAt.Time
+	}
+	return m.UpdatedAt
+}
+
+// SyncService 为离线客户端提供增量同步，按更新时间/删除时间找出变更，无需单独的变更日志
+type SyncService struct {
+	db *gorm.DB
+}
+
+func NewSyncService(db *gorm.DB) *SyncService {
+	return &SyncService{db: db}
+}
+
+// Changes 获取用户自cursor以来的会话和消息变更，cursor为空表示全量同步（不含已删除的记录）
+func (s *SyncService) Changes(userID uint, cursor string, limit int) (*SyncResult, error) {
+	since, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversations []model.Conversation
+	condition, args := since.after(conversationChangedAt, "conversations.id", syncConversation)
+	query := s.db.Unscoped().Where("conversations.user_id = ?", userID).Where(condition, args...)
+	if cursor == "" {
+		query = query.Where("conversations.deleted_at IS NULL")
+	}
+	if err := query.Order(conversationChangedAt + " ASC, conversations.id ASC").Limit(limit + 1).Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+
+	var messages []model.Message
+	condition, args = since.after(messageChangedAt, "messages.id", syncMessage)
+	query = s.db.Unscoped().Select("messages.*").
+		Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+		Where("conversations.user_id = ?", userID).Where(condition, args...)
+	if cursor == "" {
+		query = query.Where("messages.deleted_at IS NULL")
+	}
+	if err := query.Order(messageChangedAt + " ASC, messages.id ASC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	// 合并两类变更，按位置取前limit条
+	positions := make([]syncPosition, 0, len(conversations)+len(messages))
+	for i := range conversations {
+		positions = append(positions, syncPosition{conversationChangedTime(&conversations[i]), syncConversation, conversations[i].ID})
+	}
+	for i := range messages {
+		positions = append(positions, syncPosition{messageChangedTime(&messages[i]), syncMessage, messages[i].ID})
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].before(positions[j]) })
+
+	result := &SyncResult{
+		Conversations:          []model.Conversation{},
+		Messages:               []model.Message{},
+		DeletedConversationIDs: []uint{},
+		DeletedMessageIDs:      []uint{},
+		Cursor:                 formatCursor(since),
+	}
+	if len(positions) > limit {
+		result.HasMore = true
+		positions = positions[:limit]
+	}
+	if len(positions) == 0 {
+		return result, nil
+	}
+	upTo := positions[len(positions)-1]
+	// 下一页从最后一条之后开始，不会重复返回
+	result.Cursor = formatCursor(upTo)
+
+	for i := range conversations {
+		if upTo.before(syncPosition{conversationChangedTime(&conversations[i]), syncConversation, conversations[i].ID}) {
+			break
+		}
+		if conversations[i].DeletedAt.Valid {
+			result.DeletedConversationIDs = append(result.DeletedConversationIDs, conversations[i].ID)
+			continue
+		}
+		result.Conversations = append(result.Conversations, conversations[i])
+	}
+	for i := range messages {
+		if upTo.before(syncPosition{messageChangedTime(&messages[i]), syncMessage, messages[i].ID}) {
+			break
+		}
+		if messages[i].DeletedAt.Valid {
+			result.DeletedMessageIDs = append(result.DeletedMessageIDs, messages[i].ID)
+			continue
+		}
+		result.Messages = append(result.Messages, messages[i])
+	}
+	return result, nil
+}
+
+// 游标为“变更时间的Unix微秒数.种类.ID”；只有微秒数的旧游标包含该时间的全部变更
+func formatCursor(p syncPosition) string {
+	if p.kind < 0 {
+		return strconv.FormatInt(p.at.UnixMicro(), 10)
+	}
+	return fmt.Sprintf("%d.%d.%d", p.at.UnixMicro(), p.kind, p.id)
+}
+
+func parseCursor(cursor string) (syncPosition, error) {
+	if cursor == "" {
+		return syncPosition{at: time.Unix(0, 0).UTC(), kind: -1}, nil
+	}
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 1 && len(parts) != 3 {
+		return syncPosition{}, ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || micros < 0 {
+		return syncPosition{}, ErrInvalidCursor
+	}
+	p := syncPosition{at: time.UnixMicro(micros).UTC(), kind: -1}
+	if len(parts) == 1 {
+		return p, nil
+	}
+	kind, err := strconv.Atoi(parts[1])
+	if err != nil || (kind != syncConversation && kind != syncMessage) {
+		return syncPosition{}, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return syncPosition{}, ErrInvalidCursor
+	}
+	p.kind, p.id = kind, uint(id)
+	return p, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+func TestSyncCursorRoundTrip(t *testing.T) {
+	at := time.UnixMicro(1712345678901234).UTC()
+	tests := []struct {
+		name   string
+		cursor string
+		want   syncPosition
+	}{
+		{"initial", "", syncPosition{at: time.Unix(0, 0).UTC(), kind: -1}},
+		{"legacy time only", "1712345678901234", syncPosition{at: at, kind: -1}},
+		{"conversation", "1712345678901234.0.7", syncPosition{at: at, kind: syncConversation, id: 7}},
+		{"message", "1712345678901234.1.42", syncPosition{at: at, kind: syncMessage, id: 42}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCursor(tt.cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.at.Equal(tt.want.at) || got.kind != tt.want.kind || got.id != tt.want.id {
+				t.Fatalf("parseCursor = %+v, want %+v", got, tt.want)
+			}
+			if tt.cursor != "" && formatCursor(got) != tt.cursor {
+				t.Errorf("formatCursor = %s, want %s", formatCursor(got), tt.cursor)
+			}
+		})
+	}
+
+	for _, cursor := range []string{"abc", "-1", "1.2", "1.2.3", "1.0.x", "1.0.1.1"} {
+		if _, err := parseCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("parseCursor(%q) error = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+// 同一时刻的变更超过一页时游标仍然推进，逐页取完且不重复
+func TestSyncPagesThroughSameTimestamp(t *testing.T) {
+	db := newTestDB(t)
+	user := createTestUser(t, db, model.User{})
+	s := NewSyncService(db)
+
+	at := time.Now().UTC().Truncate(time.Millisecond)
+	conversation := model.Conversation{UserID: user.ID, Title: "sync", LastMessageAt: at}
+	if err := db.Create(&conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]model.Message, 7)
+	for i := range messages {
+		messages[i] = model.Message{ConversationID: conversation.ID, Role: "user", Content: "same time", CreatedAt: at, UpdatedAt: at}
+	}
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&model.Conversation{}).Where("id = ?", conversation.ID).UpdateColumn("updated_at", at)
+
+	seen := make(map[uint]bool)
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > 10 {
+			t.Fatal("sync did not finish")
+		}
+		result, err := s.Changes(user.ID, cursor, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range result.Messages {
+			if seen[msg.ID] {
+				t.Errorf("message %d returned twice", msg.ID)
+			}
+			seen[msg.ID] = true
+		}
+		cursor = result.Cursor
+		if !result.HasMore {
+			break
+		}
+	}
+	if len(seen) != len(messages) {
+		t.Errorf("synced %d messages, want %d", len(seen), len(messages))
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// ReadOnlyStatus 只读模式状态
+type ReadOnlyStatus struct {
+	Enabled   bool      `json:"enabled"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedBy uint      `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SetReadOnlyRequest struct {
+	Enabled *bool  `json:"enabled" validate:"required"`
+	Reason  string `json:"reason" validate:"max=255"`
+}
+
+// SystemService 维护进程级的运行状态。只读开关不落库：
+// 数据库维护期间可能无法写入，且开关只作用于当前实例，多实例部署需逐个切换或使用 SERVER_READ_ONLY 重启
+type SystemService struct {
+	mu       sync.RWMutex
+	readOnly ReadOnlyStatus
+}
+
+func NewSystemService(readOnly bool) *SystemService {
+	return &SystemService{
+		readOnly: ReadOnlyStatus{
+			Enabled:   readOnly,
+			UpdatedAt: time.Now(),
+		},
+	}
+}
+
+// IsReadOnly 是否处于只读模式
+func (s *SystemService) IsReadOnly() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readOnly.Enabled
+}
+
+// ReadOnlyStatus 获取只读模式状态
+func (s *SystemService) ReadOnlyStatus() ReadOnlyStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readOnly
+}
+
+// SetReadOnly 切换只读模式
+func (s *SystemService) SetReadOnly(userID uint, enabled bool, reason string) ReadOnlyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readOnly = ReadOnlyStatus{
+		Enabled:   enabled,
+		Reason:    reason,
+		UpdatedBy: userID,
+		UpdatedAt: time.Now(),
+	}
+	return s.readOnly
+}
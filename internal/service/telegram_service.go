@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/telegram"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// telegramMaxMessageLength Telegram单条消息的最大字符数
+	telegramMaxMessageLength = 4096
+	// telegramLinkCodeTTL 绑定码有效期
+	telegramLinkCodeTTL = 10 * time.Minute
+)
+
+var (
+	ErrTelegramDisabled      = errors.New("telegram integration is not enabled")
+	ErrInvalidTelegramSecret = errors.New("invalid telegram secret token")
+	errInvalidLinkCode       = errors.New("invalid or expired link code")
+)
+
+// TelegramLinkCode 绑定码，用户打开URL或向机器人发送 /start <code> 完成绑定
+type TelegramLinkCode struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TelegramService Telegram机器人桥接（webhook模式）：私聊通过绑定码关联到用户，
+// 之后的消息以该用户的身份继续对应会话，回复通过编辑消息流式更新
+type TelegramService struct {
+	db          *gorm.DB
+	chatService *ChatService
+	client      *telegram.Client
+	botUsername string
+	secret      string
+	chats       keyedMutex
+}
+
+// NewTelegramService 未配置机器人token和webhook密钥时所有接口返回ErrTelegramDisabled
+func NewTelegramService(db *gorm.DB, chatService *ChatService) *TelegramService {
+	cfg := config.Load()
+	s := &TelegramService{
+		db:          db,
+		chatService: chatService,
+		botUsername: cfg.Telegram.BotUsername,
+		secret:      cfg.Telegram.WebhookSecret,
+	}
+	if cfg.Telegram.BotToken != "" && cfg.Telegram.WebhookSecret != "" {
+		s.client = telegram.NewClient(cfg.Telegram.BotToken)
+	}
+	return s
+}
+
+// LinkCode 为用户生成绑定码，绑定码无需落库，以webhook密钥签名并带过期时间
+func (s *TelegramService) LinkCode(userID uint) (*TelegramLinkCode, error) {
+	if s.client == nil {
+		return nil, ErrTelegramDisabled
+	}
+
+	code, expiresAt := newLinkCode(s.secret, model.PlatformTelegram, userID, telegramLinkCodeTTL)
+	linkCode := &TelegramLinkCode{
+		Code:      code,
+		ExpiresAt: expiresAt,
+	}
+	if s.botUsername != "" {
+		linkCode.URL = fmt.Sprintf("https://t.me/%s?start=%s", s.botUsername, code)
+	}
+	return linkCode, nil
+}
+
+// ListLinks 获取用户绑定的Telegram聊天
+func (s *TelegramService) ListLinks(userID uint) ([]model.ChannelLink, error) {
+	var links []model.ChannelLink
+	err := s.db.Where("user_id = ? AND platform = ?", userID, model.PlatformTelegram).Order("id").Find(&links).Error
+	return links, err
+}
+
+// UnlinkChat 解除绑定，已有会话保留
+func (s *TelegramService) UnlinkChat(userID, linkID uint) error {
+	result := s.db.Where("id = ? AND user_id = ? AND platform = ?", linkID, userID, model.PlatformTelegram).
+		Delete(&model.ChannelLink{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrChannelLinkNotFound
+	}
+	return nil
+}
+
+// HandleUpdate 校验X-Telegram-Bot-Api-Secret-Token并处理更新，消息在后台生成回复
+func (s *TelegramService) HandleUpdate(payload []byte, secretToken string) error {
+	if s.client == nil {
+		return ErrTelegramDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(secretToken), []byte(s.secret)) != 1 {
+		return ErrInvalidTelegramSecret
+	}
+
+	var update telegram.Update
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return err
+	}
+	msg := update.Message
+	// 只处理私聊中用户发送的文本消息
+	if msg == nil || msg.Text == "" || msg.Chat.Type != "private" || msg.From == nil || msg.From.IsBot {
+		return nil
+	}
+
+	go s.handleMessage(msg)
+	return nil
+}
+
+// handleMessage 处理命令或为消息生成回复，同一聊天的消息依次处理
+func (s *TelegramService) handleMessage(msg *telegram.Message) {
+	chatID := msg.Chat.ID
+	key := strconv.FormatInt(chatID, 10)
+	unlock := s.chats.Lock(key)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), bridgeReplyTimeout)
+	defer cancel()
+
+	send := func(text string) {
+		if _, err := s.client.SendMessage(ctx, chatID, text); err != nil {
+			log.Printf("Failed to send telegram message: %v", err)
+		}
+	}
+
+	command, arg := parseTelegramCommand(msg.Text)
+	switch command {
+	case "/start":
+		if arg == "" {
+			send("Open the link from the app to connect this chat to your account.")
+			return
+		}
+		if err := s.link(key, arg); err != nil {
+			if errors.Is(err, errInvalidLinkCode) {
+				send("This link has expired or is invalid. Please generate a new one in the app.")
+				return
+			}
+			log.Printf("Failed to link telegram chat: %v", err)
+			send("Failed to connect this chat, please try again later.")
+			return
+		}
+		send("Connected. Send a message to start chatting, or /new to start a new conversation.")
+		return
+	}
+
+	var link model.ChannelLink
+	if err := s.db.Where("platform = ? AND channel_id = ?", model.PlatformTelegram, key).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			send("This chat is not connected yet. Open the link from the app to connect it.")
+			return
+		}
+		log.Printf("Failed to load telegram chat link: %v", err)
+		return
+	}
+
+	if command == "/new" {
+		if err := s.db.Model(&link).Update("conversation_id", nil).Error; err != nil {
+			log.Printf("Failed to reset telegram conversation: %v", err)
+			return
+		}
+		send("Started a new conversation.")
+		return
+	}
+
+	messageID, err := s.client.SendMessage(ctx, chatID, bridgePlaceholder)
+	if err != nil {
+		log.Printf("Failed to send telegram reply: %v", err)
+		return
+	}
+	reply := newBridgeReply(telegramMaxMessageLength, func(text string) error {
+		return s.client.EditMessageText(ctx, chatID, messageID, text)
+	})
+
+	err = s.chatService.BridgeMessage(ctx, &link, "Telegram", msg.Text, reply.Write)
+	if err == nil {
+		err = reply.Flush()
+	}
+	if err != nil {
+		log.Printf("Failed to reply in telegram chat %s: %v", key, err)
+		s.client.EditMessageText(ctx, chatID, messageID, fmt.Sprintf("Failed to generate a reply: %v", err))
+	}
+}
+
+// link 校验绑定码并将聊天关联到用户，聊天已关联其他用户时改为新用户并新建会话
+func (s *TelegramService) link(chatKey, code string) error {
+	userID, err := parseLinkCode(s.secret, model.PlatformTelegram, code)
+	if err != nil {
+		return err
+	}
+
+	var link model.ChannelLink
+	err = s.db.Where("platform = ? AND channel_id = ?", model.PlatformTelegram, chatKey).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.db.Create(&model.ChannelLink{
+			Platform:  model.PlatformTelegram,
+			ChannelID: chatKey,
+			UserID:    userID,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	if link.UserID == userID {
+		return nil
+	}
+	return s.db.Model(&link).Updates(map[string]interface{}{
+		"user_id":         userID,
+		"conversation_id": nil,
+	}).Error
+}
+
+// parseTelegramCommand 解析 /command@bot arg 形式的命令，非命令时返回空
+func parseTelegramCommand(text string) (string, string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", ""
+	}
+	command, arg, _ := strings.Cut(strings.TrimSpace(text), " ")
+	command, _, _ = strings.Cut(command, "@")
+	return command, strings.TrimSpace(arg)
+}
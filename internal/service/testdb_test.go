@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/database"
+	"ai-chat-backend/internal/model"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 依赖数据库的测试需要设置 TEST_DATABASE_DSN（MySQL，测试会自动迁移表结构），未设置时跳过
+var (
+	testDBOnce sync.Once
+	testDB     *gorm.DB
+	testDBErr  error
+	testSeq    atomic.Int64
+)
+
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	testDBOnce.Do(func() {
+		testDB, testDBErr = database.Init(config.DatabaseConfig{DSN: dsn, AutoMigrate: true, SchemaCheck: "off", CompressThreshold: 4096}, nil)
+	})
+	if testDBErr != nil {
+		t.Fatalf("open test database: %v", testDBErr)
+	}
+	return testDB
+}
+
+// uniqueEmail 生成测试间不冲突的邮箱，测试库可以重复使用
+func uniqueEmail(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d@example.com", prefix, time.Now().UnixNano(), testSeq.Add(1))
+}
+
+func createTestUser(t testing.TB, db *gorm.DB, user model.User) *model.User {
+	t.Helper()
+	if user.Email == "" {
+		user.Email = uniqueEmail("user")
+	}
+	if user.Nickname == "" {
+		user.Nickname = "tester"
+	}
+	if user.Password == "" {
+		user.Password = "x"
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return &user
+}
+
+// captureSender 记录发送的邮件，代替真实的邮件发送器
+type captureSender struct {
+	mu   sync.Mutex
+	sent []sentMail
+}
+
+type sentMail struct {
+	To, Subject, Body string
+}
+
+func (s *captureSender) Send(to, subject, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, sentMail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+func (s *captureSender) last() (sentMail, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sent) == 0 {
+		return sentMail{}, false
+	}
+	return s.sent[len(s.sent)-1], true
+}
+
+// 依赖Redis的测试需要设置 TEST_REDIS_ADDR，未设置时跳过
+func newTestRedis(t testing.TB) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// titlePrompt 根据首轮对话生成会话标题时使用的系统提示
+const titlePrompt = "Write a short title (at most 8 words) for the conversation below. " +
+	"Use the language of the conversation. Output only the title, without quotes or trailing punctuation."
+
+// maxTitleLength 与CreateConversationRequest.Title的长度限制一致
+const maxTitleLength = 100
+
+// titleMaxTokens 生成标题的最大输出token数
+const titleMaxTokens = 32
+
+// autoTitleEnabled 本条消息是否需要自动生成标题，请求未指定时使用配置
+func (s *ChatService) autoTitleEnabled(req *SendMessageRequest) bool {
+	if req.AutoTitle != nil {
+		return *req.AutoTitle && s.autoTitle
+	}
+	return s.autoTitle
+}
+
+// maybeGenerateTitle 会话完成首轮问答后，在后台调用模型根据问答内容生成标题。
+// 无痕会话不生成；生成期间用户已修改标题时不覆盖
+func (s *ChatService) maybeGenerateTitle(conversation *model.Conversation, userContent, reply string) {
+	if conversation.Incognito || strings.TrimSpace(reply) == "" {
+		return
+	}
+	var replies int64
+	if err := s.db.Model(&model.Message{}).
+		Where("conversation_id = ? AND role = ?", conversation.ID, "assistant").
+		Count(&replies).Error; err != nil || replies != 1 {
+		return
+	}
+
+	original := *conversation
+	go func() {
+		if err := s.generateTitle(context.Background(), &original, userContent, reply); err != nil {
+			log.Printf("Failed to generate title for conversation %d: %v", original.ID, err)
+		}
+	}()
+}
+
+func (s *ChatService) generateTitle(ctx context.Context, conversation *model.Conversation, userContent, reply string) error {
+	// 标题包含会话内容，与会话的回复使用同一模型服务（组织模型服务、自带Key或用户所在区域的服务端模型）
+	gen, err := s.resolveGenerator(conversation.UserID, conversation, conversation.Model)
+	if err != nil {
+		return err
+	}
+	output, _, err := gen.ai.GenerateResponse(ctx, []*schema.Message{
+		schema.SystemMessage(titlePrompt),
+		schema.UserMessage("user: " + userContent + "\n\nassistant: " + reply),
+	}, titleMaxTokens)
+	if err != nil {
+		return err
+	}
+	title := cleanTitle(output)
+	if title == "" || title == conversation.Title {
+		return nil
+	}
+
+	result := s.db.Model(&model.Conversation{}).
+		Where("id = ? AND title = ?", conversation.ID, conversation.Title).
+		Update("title", title)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	conversation.Title = title
+	s.publishConversationEvent(conversation, events.ConversationRenamed)
+	return nil
+}
+
+// cleanTitle 取模型输出的第一行，去掉引号、"Title:"前缀和结尾标点，并截断到标题长度上限
+func cleanTitle(output string) string {
+	title := strings.TrimSpace(output)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimSpace(title)
+	if len(title) > 6 && strings.EqualFold(title[:6], "title:") {
+		title = strings.TrimSpace(title[6:])
+	}
+	title = strings.Trim(title, "\"'`“”‘’「」*#")
+	title = strings.TrimRight(title, ".。!！?？,，;；:：")
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength])
+	}
+	return title
+}
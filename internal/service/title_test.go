@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"ai-chat-backend/internal/model"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"Trip planning", "Trip planning"},
+		{"  \"Trip planning.\"  ", "Trip planning"},
+		{"Title: Go generics\nmore text", "Go generics"},
+		{"「旅行计划」", "旅行计划"},
+		{"旅行计划。", "旅行计划"},
+		{"**Deploy notes**", "Deploy notes"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := cleanTitle(tt.output); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+// 自动标题与会话的回复使用同一模型服务，自带Key的会话内容不发送给服务端模型
+func TestGenerateTitleUsesConversationGenerator(t *testing.T) {
+	s, user, recorder := newBYOKChatService(t, "Trip planning")
+
+	conversation := model.Conversation{UserID: user.ID, Title: "New chat"}
+	if err := s.db.Create(&conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.generateTitle(context.Background(), &conversation, "plan a trip", "sure"); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorder.last(); got != "Bearer user-key" {
+		t.Fatalf("title generated with %q, want the user's key", got)
+	}
+
+	var reloaded model.Conversation
+	if err := s.db.First(&reloaded, conversation.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Title != "Trip planning" {
+		t.Fatalf("title = %q", reloaded.Title)
+	}
+}
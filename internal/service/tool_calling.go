@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// maxToolRounds 单次回复中模型连续调用工具的最大轮数，超过后不再提供工具，要求模型直接回答
+const maxToolRounds = 5
+
+// add 累加多轮生成的用量，结束原因以最后一轮为准
+func (r *GenerationResult) add(other *GenerationResult) {
+	r.FinishReason = other.FinishReason
+	if other.Usage == nil {
+		return
+	}
+	if r.Usage == nil {
+		r.Usage = &schema.TokenUsage{}
+	}
+	r.Usage.PromptTokens += other.Usage.PromptTokens
+	r.Usage.CompletionTokens += other.Usage.CompletionTokens
+	r.Usage.TotalTokens += other.Usage.TotalTokens
+}
+
+// toolsFor 获取会话启用的工具，未配置工具服务或未启用时返回nil
+func (s *ChatService) toolsFor(ctx context.Context, userID uint, conversation *model.Conversation) (*toolset, error) {
+	if s.toolService == nil {
+		return nil, nil
+	}
+	return s.toolService.forConversation(ctx, userID, conversation)
+}
+
+// toolsForServers 获取指定MCP服务的工具，未配置工具服务时返回nil
+func (s *ChatService) toolsForServers(ctx context.Context, userID, conversationID uint, serverIDs []uint) (*toolset, error) {
+	if s.toolService == nil {
+		return nil, nil
+	}
+	return s.toolService.forServers(ctx, userID, conversationID, serverIDs)
+}
+
+// roundTools 本轮提供给模型的工具，最后一轮不再提供
+func roundTools(tools *toolset, round int) []*schema.ToolInfo {
+	if tools == nil || round >= maxToolRounds {
+		return nil
+	}
+	return tools.infos
+}
+
+// runTools 执行模型请求的工具调用，将调用和结果追加到上下文，并将结果保存为会话的tool消息
+func (s *ChatService) runTools(ctx context.Context, tools *toolset, messages []*schema.Message, content string, calls []schema.ToolCall) []*schema.Message {
+	messages = append(messages, schema.AssistantMessage(content, calls))
+	for _, call := range calls {
+		result := tools.invoke(ctx, call)
+		messages = append(messages, schema.ToolMessage(result, call.ID))
+		s.saveToolMessage(ctx, tools.conversation, call, result)
+	}
+	return messages
+}
+
+// saveToolMessage 保存一次工具调用的结果，位于用户消息和最终回复之间。tool消息不计入消息数、不发布消息事件，
+// 无痕会话不保存；保存失败只打印日志，不影响生成
+func (s *ChatService) saveToolMessage(ctx context.Context, conversation *model.Conversation, call schema.ToolCall, result string) {
+	if conversation == nil || conversation.Incognito {
+		return
+	}
+	msg := model.Message{
+		ConversationID: conversation.ID,
+		Role:           model.RoleTool,
+		Content:        result,
+		ToolCallID:     truncateRunes(call.ID, 64),
+		ToolName:       call.Function.Name,
+		ToolArguments:  truncateRunes(call.Function.Arguments, toolAuditMaxLength),
+	}
+	if err := s.db.WithContext(context.WithoutCancel(ctx)).Create(&msg).Error; err != nil {
+		log.Printf("Failed to save tool message %s in conversation %d: %v", call.Function.Name, conversation.ID, err)
+	}
+}
+
+// generate 生成回复，模型请求调用工具时执行工具后继续生成，直到返回最终回复
+func (s *ChatService) generate(ctx context.Context, gen *generator, tools *toolset, messages []*schema.Message, maxOutputTokens int) (string, *GenerationResult, []*schema.Message, error) {
+	result := &GenerationResult{}
+	var content strings.Builder
+	for round := 0; ; round++ {
+		resp, roundResult, err := gen.ai.GenerateWithTools(ctx, messages, maxOutputTokens, roundTools(tools, round), gen.options()...)
+		if err != nil && gen.fallBack(ctx, err) {
+			resp, roundResult, err = gen.ai.GenerateWithTools(ctx, messages, maxOutputTokens, roundTools(tools, round), gen.options()...)
+		}
+		if err != nil {
+			return "", nil, messages, err
+		}
+		result.add(roundResult)
+		content.WriteString(resp.Content)
+
+		if len(resp.ToolCalls) == 0 || roundTools(tools, round) == nil {
+			break
+		}
+		messages = s.runTools(ctx, tools, messages, resp.Content, resp.ToolCalls)
+	}
+
+	if content.Len() == 0 {
+		return "", nil, messages, fmt.Errorf("no response generated")
+	}
+	return content.String(), result, messages, nil
+}
+
+// stream 流式生成回复，内容片段通过callback推送并由meter累计预估用量，工具调用在两轮生成之间执行
+func (s *ChatService) stream(ctx context.Context, gen *generator, tools *toolset, messages []*schema.Message, maxOutputTokens int, callback func(string) error, meter *usageMeter) (string, *GenerationResult, []*schema.Message, error) {
+	result := &GenerationResult{}
+	var fullResponse strings.Builder
+	for round := 0; ; round++ {
+		meter.addPrompt(messages)
+		content, calls, roundResult, err := s.streamRound(ctx, gen, messages, maxOutputTokens, roundTools(tools, round), callback, meter)
+		if err != nil {
+			return "", nil, messages, err
+		}
+		result.add(roundResult)
+		fullResponse.WriteString(content)
+
+		if len(calls) == 0 || roundTools(tools, round) == nil {
+			break
+		}
+		messages = s.runTools(ctx, tools, messages, content, calls)
+	}
+	return fullResponse.String(), result, messages, nil
+}
+
+// streamRound 一轮流式生成，返回本轮内容和合并后的工具调用
+func (s *ChatService) streamRound(ctx context.Context, gen *generator, messages []*schema.Message, maxOutputTokens int, tools []*schema.ToolInfo, callback func(string) error, meter *usageMeter) (string, []schema.ToolCall, *GenerationResult, error) {
+	start := time.Now()
+	stream, err := gen.ai.StreamWithTools(ctx, messages, maxOutputTokens, tools, gen.options()...)
+	// 只在建立流式连接失败时改用默认模型，已推送内容后出错不再重试
+	if err != nil && gen.fallBack(ctx, err) {
+		stream, err = gen.ai.StreamWithTools(ctx, messages, maxOutputTokens, tools, gen.options()...)
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var toolChunks []*schema.Message
+	firstToken := true
+	for {
+		chunk, err := stream.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, nil, err
+		}
+		// 首个内容或工具调用片段到达即为首token
+		if firstToken && (chunk.Content != "" || len(chunk.ToolCalls) > 0) {
+			firstToken = false
+			s.slo.RecordFirstToken(gen.ai.Provider(), gen.ai.ModelName(), time.Since(start))
+		}
+		if len(chunk.ToolCalls) > 0 {
+			toolChunks = append(toolChunks, &schema.Message{Role: schema.Assistant, ToolCalls: chunk.ToolCalls})
+		}
+		if chunk.Content == "" {
+			continue
+		}
+		content.WriteString(chunk.Content)
+		if err := callback(chunk.Content); err != nil {
+			return "", nil, nil, err
+		}
+		if err := meter.addChunk(chunk.Content); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	var calls []schema.ToolCall
+	if len(toolChunks) > 0 {
+		merged, err := schema.ConcatMessages(toolChunks)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to merge tool calls: %w", err)
+		}
+		calls = merged.ToolCalls
+		// 合并后的顺序不固定，按模型返回的序号排列
+		sort.SliceStable(calls, func(i, j int) bool {
+			return calls[i].Index != nil && calls[j].Index != nil && *calls[i].Index < *calls[j].Index
+		})
+	}
+	return content.String(), calls, stream.Result(), nil
+}
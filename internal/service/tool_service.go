@@ -0,0 +1,657 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/mcp"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+	"gorm.io/gorm"
+)
+
+const (
+	// mcpRequestTimeout 单次MCP请求（包括工具调用）的超时时间
+	mcpRequestTimeout = 30 * time.Second
+	// mcpCatalogTTL 缓存服务端工具和资源列表的时间
+	mcpCatalogTTL = 5 * time.Minute
+	// toolResultMaxLength 返回给模型的工具结果最大字符数
+	toolResultMaxLength = 16000
+	// toolAuditMaxLength 审计记录中参数和结果的最大字符数
+	toolAuditMaxLength = 2000
+	// maxResourcesInDescription 资源读取工具的说明中最多列出的资源数
+	maxResourcesInDescription = 20
+	// toolNameSeparator 工具名中服务名与工具名的分隔符
+	toolNameSeparator = "__"
+	// readResourceTool 服务端支持资源时额外提供的读取资源工具
+	readResourceTool = "read_resource"
+)
+
+var (
+	ErrMCPServerNotFound = errors.New("mcp server not found")
+	ErrMCPServerExists   = errors.New("mcp server name already exists")
+	ErrMCPServerInvalid  = errors.New("mcp server validation failed")
+)
+
+// invalidToolNameChars 模型接口要求工具名只包含字母、数字、下划线和连字符
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+type CreateMCPServerRequest struct {
+	Name  string `json:"name" validate:"required,alphanum,max=32"`
+	URL   string `json:"url" validate:"required,url,startswith=https://|startswith=http://,max=500"`
+	Token string `json:"token" validate:"omitempty,max=2048"`
+}
+
+type UpdateMCPServerRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type SetConversationToolRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// MCPServerInfo 管理员查看的服务信息，附带服务端当前提供的工具
+type MCPServerInfo struct {
+	*model.MCPServer
+	Tools []string `json:"tools,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// ConversationToolStatus 会话可用的MCP服务及是否已启用
+type ConversationToolStatus struct {
+	ServerID uint   `json:"server_id"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// mcpCatalog 服务端的客户端连接及缓存的工具、资源列表
+type mcpCatalog struct {
+	server    model.MCPServer
+	client    *mcp.Client
+	tools     []mcp.Tool
+	resources []mcp.Resource
+	// hasResources 服务端声明支持资源
+	hasResources bool
+	fetchedAt    time.Time
+}
+
+// ToolService 管理管理员注册的MCP服务，会话启用后其工具和资源以函数调用的形式提供给模型，
+// 每次调用都写入审计记录
+type ToolService struct {
+	db         *gorm.DB
+	box        *utils.SecretBox
+	httpClient *http.Client
+	// sanitizer 工具结果返回给模型前的处理
+	sanitizer *contentSanitizer
+
+	// providers 内置工具（如日历）的提供者
+	providers []toolProvider
+
+	mu       sync.Mutex
+	catalogs map[uint]*mcpCatalog
+}
+
+// localTool 服务端内置的工具，与MCP工具一起提供给模型，调用同样写入审计记录
+type localTool struct {
+	// name 完整的工具名，如 calendar__list_events
+	name        string
+	description string
+	params      json.RawMessage
+	run         func(ctx context.Context, arguments string) (string, error)
+}
+
+// toolProvider 按用户提供内置工具，用户未授权等情况下不返回工具
+type toolProvider interface {
+	localTools(ctx context.Context, userID, conversationID uint) []localTool
+}
+
+// AddProvider 注册内置工具的提供者
+func (s *ToolService) AddProvider(provider toolProvider) {
+	s.providers = append(s.providers, provider)
+}
+
+// NewToolService 创建工具服务，encryptionKey为空时不能注册带token的MCP服务
+func NewToolService(db *gorm.DB, encryptionKey string) (*ToolService, error) {
+	s := &ToolService{
+		db:         db,
+		httpClient: &http.Client{Timeout: mcpRequestTimeout},
+		catalogs:   make(map[uint]*mcpCatalog),
+		sanitizer:  newContentSanitizer(config.Load().Chat),
+	}
+	if encryptionKey != "" {
+		box, err := utils.NewSecretBox(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		s.box = box
+	}
+	return s, nil
+}
+
+// Subscribe 会话删除后清理启用记录，审计记录保留
+func (s *ToolService) Subscribe(bus events.Bus) {
+	bus.Subscribe(events.ConversationDeleted, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.ConversationPayload)
+		if !ok {
+			return nil
+		}
+		return s.db.Where("conversation_id = ?", payload.ConversationID).Delete(&model.ConversationTool{}).Error
+	})
+}
+
+// ListServers 获取全部MCP服务及其当前提供的工具
+func (s *ToolService) ListServers(ctx context.Context) ([]MCPServerInfo, error) {
+	var servers []model.MCPServer
+	if err := s.db.Order("id").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+
+	infos := make([]MCPServerInfo, len(servers))
+	for i := range servers {
+		infos[i].MCPServer = &servers[i]
+		catalog, err := s.catalog(ctx, &servers[i])
+		if err != nil {
+			infos[i].Error = err.Error()
+			continue
+		}
+		for _, tool := range catalog.tools {
+			infos[i].Tools = append(infos[i].Tools, tool.Name)
+		}
+	}
+	return infos, nil
+}
+
+// CreateServer 注册MCP服务，保存前完成初始化握手并获取工具列表以校验地址和token
+func (s *ToolService) CreateServer(ctx context.Context, adminID uint, req *CreateMCPServerRequest) (*MCPServerInfo, error) {
+	if req.Token != "" && s.box == nil {
+		return nil, ErrBYOKDisabled
+	}
+
+	var count int64
+	if err := s.db.Model(&model.MCPServer{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrMCPServerExists
+	}
+
+	client := mcp.NewClient(req.URL, req.Token, s.httpClient)
+	if _, err := client.Initialize(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMCPServerInvalid, err)
+	}
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMCPServerInvalid, err)
+	}
+
+	server := model.MCPServer{
+		Name:      req.Name,
+		URL:       req.URL,
+		Enabled:   true,
+		CreatedBy: adminID,
+	}
+	if req.Token != "" {
+		encrypted, err := s.box.Encrypt(req.Token)
+		if err != nil {
+			return nil, err
+		}
+		server.EncryptedToken = encrypted
+	}
+	if err := s.db.Create(&server).Error; err != nil {
+		return nil, err
+	}
+
+	info := &MCPServerInfo{MCPServer: &server}
+	for _, tool := range tools {
+		info.Tools = append(info.Tools, tool.Name)
+	}
+	return info, nil
+}
+
+// UpdateServer 启用或停用MCP服务，停用后所有会话都不再提供其工具
+func (s *ToolService) UpdateServer(serverID uint, req *UpdateMCPServerRequest) error {
+	result := s.db.Model(&model.MCPServer{}).Where("id = ?", serverID).Update("enabled", req.Enabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMCPServerNotFound
+	}
+	s.invalidate(serverID)
+	return nil
+}
+
+// DeleteServer 删除MCP服务及各会话的启用记录，审计记录保留
+func (s *ToolService) DeleteServer(serverID uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", serverID).Delete(&model.MCPServer{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMCPServerNotFound
+		}
+		return tx.Where("server_id = ?", serverID).Delete(&model.ConversationTool{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(serverID)
+	return nil
+}
+
+// ListInvocations 分页获取工具调用审计记录，conversationID为0时不按会话过滤
+func (s *ToolService) ListInvocations(conversationID uint, page, pageSize int) ([]model.ToolInvocation, int64, error) {
+	query := s.db.Model(&model.ToolInvocation{})
+	if conversationID != 0 {
+		query = query.Where("conversation_id = ?", conversationID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var invocations []model.ToolInvocation
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&invocations).Error
+	return invocations, total, err
+}
+
+// ConversationTools 获取会话可启用的MCP服务及启用状态
+func (s *ToolService) ConversationTools(userID, conversationID uint) ([]ConversationToolStatus, error) {
+	if _, err := s.ownedConversation(userID, conversationID); err != nil {
+		return nil, err
+	}
+
+	var servers []model.MCPServer
+	if err := s.db.Where("enabled = ?", true).Order("id").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	var enabledIDs []uint
+	if err := s.db.Model(&model.ConversationTool{}).Where("conversation_id = ?", conversationID).
+		Pluck("server_id", &enabledIDs).Error; err != nil {
+		return nil, err
+	}
+	enabled := make(map[uint]bool, len(enabledIDs))
+	for _, id := range enabledIDs {
+		enabled[id] = true
+	}
+
+	statuses := make([]ConversationToolStatus, len(servers))
+	for i, server := range servers {
+		statuses[i] = ConversationToolStatus{ServerID: server.ID, Name: server.Name, Enabled: enabled[server.ID]}
+	}
+	return statuses, nil
+}
+
+// SetConversationTool 为会话启用或停用MCP服务。无痕会话不保存工具调用记录，不允许启用
+func (s *ToolService) SetConversationTool(userID, conversationID, serverID uint, req *SetConversationToolRequest) error {
+	conversation, err := s.ownedConversation(userID, conversationID)
+	if err != nil {
+		return err
+	}
+
+	if !req.Enabled {
+		return s.db.Where("conversation_id = ? AND server_id = ?", conversationID, serverID).
+			Delete(&model.ConversationTool{}).Error
+	}
+	if conversation.Incognito {
+		return ErrConversationNotFound
+	}
+
+	var server model.MCPServer
+	if err := s.db.Where("id = ? AND enabled = ?", serverID, true).First(&server).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMCPServerNotFound
+		}
+		return err
+	}
+
+	var count int64
+	if err := s.db.Model(&model.ConversationTool{}).
+		Where("conversation_id = ? AND server_id = ?", conversationID, serverID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return s.db.Create(&model.ConversationTool{ConversationID: conversationID, ServerID: serverID}).Error
+}
+
+func (s *ToolService) ownedConversation(userID, conversationID uint) (*model.Conversation, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// catalog 获取服务端的客户端及工具列表，缓存过期或服务配置变更时重新获取
+func (s *ToolService) catalog(ctx context.Context, server *model.MCPServer) (*mcpCatalog, error) {
+	s.mu.Lock()
+	cached, ok := s.catalogs[server.ID]
+	s.mu.Unlock()
+	if ok && cached.server.UpdatedAt.Equal(server.UpdatedAt) && time.Since(cached.fetchedAt) < mcpCatalogTTL {
+		return cached, nil
+	}
+
+	catalog := &mcpCatalog{server: *server}
+	if ok && cached.server.UpdatedAt.Equal(server.UpdatedAt) {
+		// 复用已建立的会话
+		catalog.client = cached.client
+	} else {
+		token := ""
+		if server.EncryptedToken != "" {
+			if s.box == nil {
+				return nil, ErrBYOKDisabled
+			}
+			decrypted, err := s.box.Decrypt(server.EncryptedToken)
+			if err != nil {
+				return nil, err
+			}
+			token = decrypted
+		}
+		catalog.client = mcp.NewClient(server.URL, token, s.httpClient)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpRequestTimeout)
+	defer cancel()
+	info, err := catalog.client.Initialize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if catalog.tools, err = catalog.client.ListTools(ctx); err != nil {
+		return nil, err
+	}
+	if info.Capabilities.Resources != nil {
+		catalog.hasResources = true
+		if catalog.resources, err = catalog.client.ListResources(ctx); err != nil {
+			return nil, err
+		}
+	}
+	catalog.fetchedAt = time.Now()
+
+	s.mu.Lock()
+	s.catalogs[server.ID] = catalog
+	s.mu.Unlock()
+	return catalog, nil
+}
+
+func (s *ToolService) invalidate(serverID uint) {
+	s.mu.Lock()
+	delete(s.catalogs, serverID)
+	s.mu.Unlock()
+}
+
+// toolBinding 提供给模型的工具名对应的MCP服务和工具，内置工具只有local
+type toolBinding struct {
+	catalog *mcpCatalog
+	tool    string
+	// resource 为读取资源工具
+	resource bool
+	local    *localTool
+}
+
+// toolset 一次生成中可用的工具，调用结果以文本返回给模型
+type toolset struct {
+	service        *ToolService
+	userID         uint
+	conversationID uint
+	infos          []*schema.ToolInfo
+	bindings       map[string]toolBinding
+	// conversation 调用结果保存为tool消息的会话，工作流步骤的工具为nil，不保存
+	conversation *model.Conversation
+}
+
+// forConversation 获取会话启用的工具及用户可用的内置工具，都没有时返回nil。
+// 某个服务不可用时跳过并记录日志，不影响正常回复
+func (s *ToolService) forConversation(ctx context.Context, userID uint, conversation *model.Conversation) (*toolset, error) {
+	var servers []model.MCPServer
+	err := s.db.Joins("JOIN conversation_tools ON conversation_tools.server_id = mcp_servers.id").
+		Where("conversation_tools.conversation_id = ? AND mcp_servers.enabled = ?", conversation.ID, true).
+		Order("mcp_servers.id").Find(&servers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 无痕会话不保存工具调用记录，不提供内置工具
+	var local []localTool
+	if !conversation.Incognito {
+		for _, provider := range s.providers {
+			local = append(local, provider.localTools(ctx, userID, conversation.ID)...)
+		}
+	}
+	if len(servers) == 0 && len(local) == 0 {
+		return nil, nil
+	}
+	tools := s.buildToolset(ctx, userID, conversation.ID, servers, local)
+	if tools != nil {
+		tools.conversation = conversation
+	}
+	return tools, nil
+}
+
+// forServers 获取指定服务的工具（工作流步骤使用），忽略不存在或已停用的服务，均不可用时返回nil
+func (s *ToolService) forServers(ctx context.Context, userID, conversationID uint, serverIDs []uint) (*toolset, error) {
+	if len(serverIDs) == 0 {
+		return nil, nil
+	}
+	var servers []model.MCPServer
+	err := s.db.Where("id IN ? AND enabled = ?", serverIDs, true).Order("id").Find(&servers).Error
+	if err != nil || len(servers) == 0 {
+		return nil, err
+	}
+	return s.buildToolset(ctx, userID, conversationID, servers, nil), nil
+}
+
+// buildToolset 汇总内置工具和服务的工具，某个服务不可用时跳过并记录日志，没有可用工具时返回nil
+func (s *ToolService) buildToolset(ctx context.Context, userID, conversationID uint, servers []model.MCPServer, local []localTool) *toolset {
+	tools := &toolset{
+		service:        s,
+		userID:         userID,
+		conversationID: conversationID,
+		bindings:       make(map[string]toolBinding),
+	}
+	for i := range local {
+		tools.addLocal(&local[i])
+	}
+	for i := range servers {
+		catalog, err := s.catalog(ctx, &servers[i])
+		if err != nil {
+			log.Printf("MCP server %s unavailable: %v", servers[i].Name, err)
+			continue
+		}
+		for _, tool := range catalog.tools {
+			tools.add(catalog, tool.Name, tool.Description, tool.InputSchema, false)
+		}
+		if catalog.hasResources {
+			tools.add(catalog, readResourceTool, resourceToolDescription(catalog.resources), readResourceSchema, true)
+		}
+	}
+	if len(tools.infos) == 0 {
+		return nil
+	}
+	return tools
+}
+
+// readResourceSchema 读取资源工具的参数
+var readResourceSchema = json.RawMessage(`{"type":"object","properties":{"uri":{"type":"string","description":"URI of the resource to read"}},"required":["uri"]}`)
+
+func resourceToolDescription(resources []mcp.Resource) string {
+	var b strings.Builder
+	b.WriteString("Read a resource by URI.")
+	for i, resource := range resources {
+		if i == maxResourcesInDescription {
+			fmt.Fprintf(&b, "\n(%d more)", len(resources)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n- %s: %s", resource.URI, resource.Name)
+		if resource.Description != "" {
+			b.WriteString(" — " + resource.Description)
+		}
+	}
+	return b.String()
+}
+
+// add 以 服务名__工具名 注册工具，名称冲突或参数格式无法解析时跳过
+func (t *toolset) add(catalog *mcpCatalog, name, description string, inputSchema json.RawMessage, resource bool) {
+	fullName := invalidToolNameChars.ReplaceAllString(catalog.server.Name+toolNameSeparator+name, "_")
+	if len(fullName) > 64 {
+		fullName = fullName[:64]
+	}
+	if _, exists := t.bindings[fullName]; exists {
+		return
+	}
+
+	params := &openapi3.Schema{Type: openapi3.TypeObject}
+	if len(inputSchema) > 0 {
+		if err := json.Unmarshal(inputSchema, params); err != nil {
+			log.Printf("Skipping MCP tool %s: invalid input schema: %v", fullName, err)
+			return
+		}
+	}
+
+	t.infos = append(t.infos, &schema.ToolInfo{
+		Name:        fullName,
+		Desc:        description,
+		ParamsOneOf: schema.NewParamsOneOfByOpenAPIV3(params),
+	})
+	t.bindings[fullName] = toolBinding{catalog: catalog, tool: name, resource: resource}
+}
+
+// addLocal 注册内置工具，名称冲突或参数格式无法解析时跳过
+func (t *toolset) addLocal(local *localTool) {
+	if _, exists := t.bindings[local.name]; exists {
+		return
+	}
+	params := &openapi3.Schema{Type: openapi3.TypeObject}
+	if err := json.Unmarshal(local.params, params); err != nil {
+		log.Printf("Skipping tool %s: invalid input schema: %v", local.name, err)
+		return
+	}
+
+	t.infos = append(t.infos, &schema.ToolInfo{
+		Name:        local.name,
+		Desc:        local.description,
+		ParamsOneOf: schema.NewParamsOneOfByOpenAPIV3(params),
+	})
+	t.bindings[local.name] = toolBinding{tool: local.name, local: local}
+}
+
+// invoke 执行模型请求的工具调用并写入审计记录，失败时把错误作为结果返回给模型
+func (t *toolset) invoke(ctx context.Context, call schema.ToolCall) string {
+	binding, ok := t.bindings[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("Error: unknown tool %q", call.Function.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpRequestTimeout)
+	defer cancel()
+
+	toolType := "MCP"
+	if binding.local != nil {
+		toolType = "Local"
+	}
+	// 以工具组件的身份触发流水线回调
+	ctx = callbacks.ReuseHandlers(ctx, &callbacks.RunInfo{
+		Name:      call.Function.Name,
+		Type:      toolType,
+		Component: components.ComponentOfTool,
+	})
+	ctx = callbacks.OnStart(ctx, &tool.CallbackInput{ArgumentsInJSON: call.Function.Arguments})
+
+	start := time.Now()
+	output, err := t.call(ctx, binding, call.Function.Arguments)
+	if err != nil {
+		callbacks.OnError(ctx, err)
+	} else {
+		callbacks.OnEnd(ctx, &tool.CallbackOutput{Response: output})
+	}
+
+	invocation := model.ToolInvocation{
+		UserID:         t.userID,
+		ConversationID: t.conversationID,
+		Tool:           binding.tool,
+		Arguments:      truncateRunes(call.Function.Arguments, toolAuditMaxLength),
+		Result:         truncateRunes(output, toolAuditMaxLength),
+		DurationMs:     time.Since(start).Milliseconds(),
+	}
+	if binding.catalog != nil {
+		invocation.ServerID = binding.catalog.server.ID
+	}
+	if err != nil {
+		invocation.Error = truncateRunes(err.Error(), 255)
+	}
+	if dbErr := t.service.db.Create(&invocation).Error; dbErr != nil {
+		log.Printf("Failed to record tool invocation %s: %v", call.Function.Name, dbErr)
+	}
+
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	source := "tool:" + binding.tool
+	if binding.catalog != nil {
+		source = fmt.Sprintf("mcp:%s/%s", binding.catalog.server.Name, binding.tool)
+	}
+	return t.service.sanitizer.toolResult(source, truncateRunes(output, toolResultMaxLength))
+}
+
+func (t *toolset) call(ctx context.Context, binding toolBinding, arguments string) (string, error) {
+	if binding.local != nil {
+		if arguments != "" && !json.Valid([]byte(arguments)) {
+			return "", fmt.Errorf("invalid arguments: not a JSON object")
+		}
+		return binding.local.run(ctx, arguments)
+	}
+
+	client := binding.catalog.client
+	if binding.resource {
+		var params struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal([]byte(arguments), &params); err != nil || params.URI == "" {
+			return "", fmt.Errorf("invalid arguments: uri is required")
+		}
+		return client.ReadResource(ctx, params.URI)
+	}
+
+	if arguments != "" && !json.Valid([]byte(arguments)) {
+		return "", fmt.Errorf("invalid arguments: not a JSON object")
+	}
+	result, err := client.CallTool(ctx, binding.tool, json.RawMessage(arguments))
+	if err != nil {
+		return "", err
+	}
+	if result.IsError {
+		return result.Text(), fmt.Errorf("tool returned an error: %s", truncateRunes(result.Text(), 200))
+	}
+	return result.Text(), nil
+}
+
+// truncateRunes 按字符数截断
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit]) + "…"
+}
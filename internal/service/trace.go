@@ -0,0 +1,241 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// traceFlushTimeout 保存追踪前等待流式模型调用回调结束的最长时间
+const traceFlushTimeout = 5 * time.Second
+
+// traceDocument 检索命中的文档
+type traceDocument struct {
+	ID      string  `json:"id,omitempty"`
+	Source  string  `json:"source,omitempty"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score"`
+}
+
+// traceModelCall 一轮模型调用，参数为实际发送给模型服务的配置
+type traceModelCall struct {
+	Model            string   `json:"model"`
+	MaxTokens        int      `json:"max_tokens,omitempty"`
+	Temperature      float32  `json:"temperature,omitempty"`
+	TopP             float32  `json:"top_p,omitempty"`
+	Tools            []string `json:"tools,omitempty"`
+	Messages         int      `json:"messages"`
+	Response         string   `json:"response"`
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	Error            string   `json:"error,omitempty"`
+	DurationMs       int64    `json:"duration_ms"`
+}
+
+// traceToolCall 一次工具调用
+type traceToolCall struct {
+	Tool       string `json:"tool"`
+	Arguments  string `json:"arguments"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// generationTrace 一次生成过程的记录，由流水线节点和回调写入，流式回调可能在其他goroutine中结束。
+// 方法在接收者为nil（未开启追踪）时不做任何事
+type generationTrace struct {
+	start time.Time
+	// pending 尚未结束的模型调用，保存前等待
+	pending sync.WaitGroup
+
+	mu         sync.Mutex
+	context    []*schema.Message
+	retrieval  []traceDocument
+	modelCalls []traceModelCall
+	toolCalls  []traceToolCall
+	timings    map[string]int64
+	// diagnostics 知识库检索的诊断信息，未检索知识库时为nil
+	diagnostics *retrievalDiagnostics
+}
+
+func newGenerationTrace() *generationTrace {
+	return &generationTrace{start: time.Now(), timings: make(map[string]int64)}
+}
+
+func (t *generationTrace) setContext(messages []*schema.Message) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.context = messages
+}
+
+func (t *generationTrace) setRetrieval(docs []*schema.Document) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, doc := range docs {
+		source, _ := doc.MetaData["source"].(string)
+		t.retrieval = append(t.retrieval, traceDocument{ID: doc.ID, Source: source, Content: doc.Content, Score: doc.Score()})
+	}
+}
+
+func (t *generationTrace) setDiagnostics(diagnostics *retrievalDiagnostics) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.diagnostics = diagnostics
+}
+
+// timing 记录流水线节点的耗时
+func (t *generationTrace) timing(node string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timings[node] = time.Since(start).Milliseconds()
+}
+
+// modelStarted 模型调用开始，与modelDone成对调用
+func (t *generationTrace) modelStarted() {
+	if t == nil {
+		return
+	}
+	t.pending.Add(1)
+}
+
+// modelDone 模型调用的回调结束，无论成功、失败还是未记录结果
+func (t *generationTrace) modelDone() {
+	if t == nil {
+		return
+	}
+	t.pending.Done()
+}
+
+func (t *generationTrace) modelFinished(start *callStart, content string, usage *einomodel.TokenUsage, err error) {
+	if t == nil {
+		return
+	}
+
+	call := traceModelCall{
+		Model:      start.model,
+		Messages:   len(start.messages),
+		Response:   content,
+		DurationMs: time.Since(start.at).Milliseconds(),
+	}
+	if start.config != nil {
+		call.MaxTokens = start.config.MaxTokens
+		call.Temperature = start.config.Temperature
+		call.TopP = start.config.TopP
+	}
+	for _, info := range start.tools {
+		call.Tools = append(call.Tools, info.Name)
+	}
+	if usage != nil {
+		call.PromptTokens = usage.PromptTokens
+		call.CompletionTokens = usage.CompletionTokens
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.modelCalls = append(t.modelCalls, call)
+}
+
+func (t *generationTrace) toolFinished(name string, start *callStart, result string, err error) {
+	if t == nil {
+		return
+	}
+	call := traceToolCall{
+		Tool:       name,
+		Arguments:  truncateRunes(start.arguments, toolAuditMaxLength),
+		Result:     truncateRunes(result, toolAuditMaxLength),
+		DurationMs: time.Since(start.at).Milliseconds(),
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.toolCalls = append(t.toolCalls, call)
+}
+
+// wait 等待进行中的模型调用回调结束，超时后按已记录的内容保存
+func (t *generationTrace) wait() {
+	done := make(chan struct{})
+	go func() {
+		t.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(traceFlushTimeout):
+	}
+}
+
+// saveTrace 保存一次生成的追踪记录，写入失败只打印日志
+func (s *ChatService) saveTrace(gen *generationInfo, assistant string, input *pipelineInput, err error) {
+	trace := gen.trace
+	if trace == nil {
+		return
+	}
+	trace.wait()
+
+	trace.mu.Lock()
+	record := model.GenerationTrace{
+		TraceID:        gen.TraceID,
+		UserID:         gen.UserID,
+		ConversationID: gen.ConversationID,
+		Assistant:      assistant,
+		Query:          input.Query,
+		Context:        traceJSON(trace.context),
+		Retrieval:      traceJSON(trace.retrieval),
+		ModelCalls:     traceJSON(trace.modelCalls),
+		ToolCalls:      traceJSON(trace.toolCalls),
+		Timings:        traceJSON(trace.timings),
+		DurationMs:     time.Since(trace.start).Milliseconds(),
+	}
+	if trace.diagnostics != nil {
+		record.RetrievalDiagnostics = traceJSON(trace.diagnostics)
+	}
+	trace.mu.Unlock()
+	if err != nil {
+		record.Error = truncateRunes(err.Error(), 255)
+	}
+	if dbErr := s.db.Create(&record).Error; dbErr != nil {
+		log.Printf("Failed to save generation trace %s: %v", gen.TraceID, dbErr)
+	}
+}
+
+// attachTrace 回复保存后关联追踪记录与助手消息
+func (s *ChatService) attachTrace(traceID string, messageID uint) {
+	if traceID == "" {
+		return
+	}
+	if err := s.db.Model(&model.GenerationTrace{}).Where("trace_id = ?", traceID).Update("message_id", messageID).Error; err != nil {
+		log.Printf("Failed to attach message %d to generation trace %s: %v", messageID, traceID, err)
+	}
+}
+
+func traceJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
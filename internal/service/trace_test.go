@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 每种结束方式的模型调用都要释放追踪登记，保存追踪时不等待traceFlushTimeout
+func TestTraceWaitReleasedByModelCall(t *testing.T) {
+	ok := newTestAIService(t, openAIReply("hello"))
+	failing := newTestAIService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"unavailable"}}`, http.StatusServiceUnavailable)
+	}))
+	messages := []*schema.Message{schema.UserMessage("hi")}
+
+	tests := []struct {
+		name    string
+		call    func(ctx context.Context) error
+		wantErr bool
+	}{
+		{
+			name: "generate",
+			call: func(ctx context.Context) error {
+				_, _, err := ok.GenerateResponse(ctx, messages, 0)
+				return err
+			},
+		},
+		{
+			name: "generate error",
+			call: func(ctx context.Context) error {
+				_, _, err := failing.GenerateResponse(ctx, messages, 0)
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "stream",
+			call: func(ctx context.Context) error {
+				stream, err := ok.Stream(ctx, messages, 0)
+				if err != nil {
+					return err
+				}
+				defer stream.Close()
+				for {
+					if _, err := stream.Next(ctx); err == io.EOF {
+						return nil
+					} else if err != nil {
+						return err
+					}
+				}
+			},
+		},
+		{
+			name: "stream error",
+			call: func(ctx context.Context) error {
+				_, err := failing.Stream(ctx, messages, 0)
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "stream closed early",
+			call: func(ctx context.Context) error {
+				stream, err := ok.Stream(ctx, messages, 0)
+				if err != nil {
+					return err
+				}
+				stream.Close()
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &generationInfo{trace: newGenerationTrace()}
+			ctx := callbacks.InitCallbacks(withGeneration(context.Background(), gen),
+				&callbacks.RunInfo{Name: "generate", Component: compose.ComponentOfLambda}, newObserver(nil, false))
+
+			if err := tt.call(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			start := time.Now()
+			gen.trace.wait()
+			if elapsed := time.Since(start); elapsed >= traceFlushTimeout {
+				t.Fatalf("wait blocked for %v", elapsed)
+			}
+			if n := len(gen.trace.modelCalls); n != 1 {
+				t.Fatalf("recorded %d model calls, want 1", n)
+			}
+			if got := gen.trace.modelCalls[0].Error != ""; got != tt.wantErr {
+				t.Fatalf("model call error = %q, wantErr %v", gen.trace.modelCalls[0].Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 重复释放同一次模型调用不会使等待计数变为负数
+func TestCallStartFinishedOnce(t *testing.T) {
+	trace := newGenerationTrace()
+	trace.modelStarted()
+	start := &callStart{at: time.Now(), trace: trace}
+	start.finished()
+	start.finished()
+	trace.wait()
+}
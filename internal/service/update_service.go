@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"ai-chat-backend/internal/events"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// updateChannel 多实例部署时转发会话列表变更的Redis频道
+const updateChannel = "conversation-updates"
+
+// updateBufferSize 每个连接待发送变更的缓冲数，写满说明客户端过慢，断开后由客户端通过增量同步补齐
+const updateBufferSize = 64
+
+// ConversationUpdate 推送给客户端的会话列表变更
+type ConversationUpdate struct {
+	Type           string          `json:"type"`
+	ConversationID uint            `json:"conversation_id"`
+	Title          string          `json:"title,omitempty"`
+	LastMessage    *MessagePreview `json:"last_message,omitempty"`
+	OccurredAt     time.Time       `json:"occurred_at"`
+}
+
+// MessagePreview 会话列表中最新消息的预览
+type MessagePreview struct {
+	ID      uint   `json:"id"`
+	Role    string `json:"role"`
+	Preview string `json:"preview"`
+}
+
+// userUpdate Redis频道中转发的变更
+type userUpdate struct {
+	UserID uint               `json:"user_id"`
+	Update ConversationUpdate `json:"update"`
+}
+
+// UpdateService 将会话相关事件推送给用户当前打开的连接，使多标签页/多设备的会话列表保持一致。
+// 配置Redis时经Redis频道转发，连接在任一实例上都能收到
+type UpdateService struct {
+	rdb *redis.Client
+
+	mu          sync.Mutex
+	subscribers map[uint]map[chan ConversationUpdate]struct{}
+}
+
+func NewUpdateService(rdb *redis.Client) *UpdateService {
+	return &UpdateService{
+		rdb:         rdb,
+		subscribers: make(map[uint]map[chan ConversationUpdate]struct{}),
+	}
+}
+
+// Subscribe 订阅会话列表相关事件
+func (s *UpdateService) Subscribe(bus events.Bus) {
+	for _, eventType := range []string{
+		events.ConversationCreated,
+		events.ConversationRenamed,
+		events.ConversationDeleted,
+		events.ConversationArchived,
+		events.ConversationMerged,
+		events.MessageCreated,
+	} {
+		bus.Subscribe(eventType, s.handle)
+	}
+}
+
+func (s *UpdateService) handle(ctx context.Context, event events.Event) error {
+	update := ConversationUpdate{
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+	}
+	switch payload := event.Payload.(type) {
+	case events.ConversationPayload:
+		update.ConversationID = payload.ConversationID
+		update.Title = payload.Title
+	case events.ConversationMergedPayload:
+		update.ConversationID = payload.ConversationID
+		update.Title = payload.Title
+	case events.MessagePayload:
+		update.ConversationID = payload.ConversationID
+		update.Title = payload.ConversationTitle
+		update.LastMessage = &MessagePreview{
+			ID:      payload.MessageID,
+			Role:    payload.Role,
+			Preview: payload.Preview,
+		}
+	default:
+		return nil
+	}
+
+	if s.rdb == nil {
+		s.deliver(event.UserID, update)
+		return nil
+	}
+	data, err := json.Marshal(userUpdate{UserID: event.UserID, Update: update})
+	if err != nil {
+		return err
+	}
+	return s.rdb.Publish(ctx, updateChannel, data).Err()
+}
+
+// Start 订阅Redis频道并投递给本实例上的连接，未配置Redis时为空操作，返回停止函数
+func (s *UpdateService) Start() func() {
+	if s.rdb == nil {
+		return func() {}
+	}
+
+	pubsub := s.rdb.Subscribe(context.Background(), updateChannel)
+	go func() {
+		for msg := range pubsub.Channel() {
+			var forwarded userUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &forwarded); err != nil {
+				log.Printf("Failed to decode conversation update: %v", err)
+				continue
+			}
+			s.deliver(forwarded.UserID, forwarded.Update)
+		}
+	}()
+
+	return func() { pubsub.Close() }
+}
+
+// Listen 注册一个连接，返回变更通道和取消函数。通道被关闭表示连接积压过多，应断开让客户端重新同步
+func (s *UpdateService) Listen(userID uint) (<-chan ConversationUpdate, func()) {
+	ch := make(chan ConversationUpdate, updateBufferSize)
+
+	s.mu.Lock()
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[chan ConversationUpdate]struct{})
+	}
+	s.subscribers[userID][ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.removeLocked(userID, ch)
+	}
+}
+
+// deliver 投递给用户的全部连接，不阻塞事件处理
+func (s *UpdateService) deliver(userID uint, update ConversationUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers[userID] {
+		select {
+		case ch <- update:
+		default:
+			s.removeLocked(userID, ch)
+		}
+	}
+}
+
+// removeLocked 移除并关闭连接通道，重复调用无副作用
+func (s *UpdateService) removeLocked(userID uint, ch chan ConversationUpdate) {
+	channels := s.subscribers[userID]
+	if _, ok := channels[ch]; !ok {
+		return
+	}
+	delete(channels, ch)
+	close(ch)
+	if len(channels) == 0 {
+		delete(s.subscribers, userID)
+	}
+}
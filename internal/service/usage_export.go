@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/model"
+)
+
+// maxUsageExportDays 单次导出的最大天数
+const maxUsageExportDays = 366
+
+var ErrInvalidUsageRange = errors.New("invalid usage export range")
+
+// UsageExportRow 某一天某个模型的用量汇总
+type UsageExportRow struct {
+	Date             string
+	Model            string
+	Generations      int64
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	Cost             float64
+	// Estimated 当天该模型至少有一次生成的用量为估算值
+	Estimated bool
+}
+
+// add 累加另一次生成的用量，费用按各次生成的单价分别计算
+func (u *StreamUsage) add(other StreamUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.Cost += other.Cost
+	u.Estimated = u.Estimated || other.Estimated
+}
+
+// RecordUsage 记录一次生成的用量明细，日期按用户时区计算。写入失败只打印日志，不影响回复
+func (s *PlanService) RecordUsage(userID, messageID uint, modelName string, usage StreamUsage) {
+	date, err := s.localDate(userID)
+	if err != nil {
+		log.Printf("Failed to record usage for user %d: %v", userID, err)
+		return
+	}
+	record := model.UsageRecord{
+		UserID:           userID,
+		Date:             date,
+		MessageID:        messageID,
+		Model:            modelName,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		Cost:             usage.Cost,
+		Estimated:        usage.Estimated,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		log.Printf("Failed to record usage for user %d: %v", userID, err)
+	}
+}
+
+// ParseUsageRange 解析导出的起止日期（YYYY-MM-DD，均包含在内），未指定时导出最近30天
+func ParseUsageRange(from, to string) (string, string, error) {
+	end := time.Now()
+	if to != "" {
+		parsed, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return "", "", ErrInvalidUsageRange
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, 0, -29)
+	if from != "" {
+		parsed, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return "", "", ErrInvalidUsageRange
+		}
+		start = parsed
+	}
+	if start.After(end) || end.Sub(start) >= maxUsageExportDays*24*time.Hour {
+		return "", "", ErrInvalidUsageRange
+	}
+	return start.Format("2006-01-02"), end.Format("2006-01-02"), nil
+}
+
+// ExportUsage 按日期和模型汇总from至to（均包含在内）的用量，逐行交给fn，fn返回错误时停止
+func (s *PlanService) ExportUsage(userID uint, from, to string, fn func(UsageExportRow) error) error {
+	rows, err := s.db.Model(&model.UsageRecord{}).
+		Select("date, model, COUNT(*) AS generations, "+
+			"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, "+
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, "+
+			"COALESCE(SUM(total_tokens), 0) AS total_tokens, "+
+			"COALESCE(SUM(cost), 0) AS cost, "+
+			"MAX(estimated) AS estimated").
+		Where("user_id = ? AND date >= ? AND date <= ?", userID, from, to).
+		Group("date, model").Order("date ASC, model ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row UsageExportRow
+		if err := s.db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/tokenizer"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// StreamUsage 流式生成的token用量和费用，Estimated为true时由tokenizer估算
+type StreamUsage struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+	Estimated        bool    `json:"estimated"`
+}
+
+// StreamResult 流式生成结束后的汇总，Usage在重复请求直接返回原回复时为nil
+type StreamResult struct {
+	Truncated bool
+	Usage     *StreamUsage
+	// SourcesUsed 作为参考资料提供给模型的知识库分块数
+	SourcesUsed int
+	// Cancelled 生成被CancelGeneration中止，回复只包含中止前已生成的部分
+	Cancelled bool
+}
+
+// usageMeter 流式生成过程中累计预估用量，每every个片段通过emit推送一次
+type usageMeter struct {
+	every           int
+	promptPrice     float64
+	completionPrice float64
+	emit            func(StreamUsage) error
+
+	prompt     int64
+	completion int64
+	chunks     int
+	final      *StreamUsage
+}
+
+// newUsageMeter emit为nil或未配置间隔时只在结束时汇总用量
+func newUsageMeter(cfg config.StreamConfig, emit func(StreamUsage) error) *usageMeter {
+	return &usageMeter{
+		every:           cfg.UsageEvery,
+		promptPrice:     cfg.PromptPrice,
+		completionPrice: cfg.CompletionPrice,
+		emit:            emit,
+	}
+}
+
+// addPrompt 每轮生成前累计发送给模型的上下文，工具调用的多轮生成分别计入
+func (m *usageMeter) addPrompt(messages []*schema.Message) {
+	if m == nil {
+		return
+	}
+	m.prompt += int64(tokenizer.CountMessages(messages))
+}
+
+// addChunk 累计一个输出片段，达到间隔时推送预估用量
+func (m *usageMeter) addChunk(chunk string) error {
+	if m == nil {
+		return nil
+	}
+	m.completion += int64(tokenizer.Count(chunk))
+	m.chunks++
+	if m.emit == nil || m.every <= 0 || m.chunks%m.every != 0 {
+		return nil
+	}
+	return m.emit(m.usage(m.prompt, m.completion, true))
+}
+
+// finish 生成结束时记录最终用量，模型返回了用量时使用实际值
+func (m *usageMeter) finish(usage *schema.TokenUsage) {
+	if m == nil {
+		return
+	}
+	if usage != nil && usage.TotalTokens > 0 {
+		final := m.usage(int64(usage.PromptTokens), int64(usage.CompletionTokens), false)
+		m.final = &final
+		return
+	}
+	final := m.usage(m.prompt, m.completion, true)
+	m.final = &final
+}
+
+func (m *usageMeter) usage(prompt, completion int64, estimated bool) StreamUsage {
+	return StreamUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+		Cost:             (float64(prompt)*m.promptPrice + float64(completion)*m.completionPrice) / 1000,
+		Estimated:        estimated,
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"ai-chat-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxUsageHistoryDays 用量接口最多返回的天数
+const maxUsageHistoryDays = 90
+
+var ErrInvalidUsageDays = errors.New("days must be between 1 and 90")
+
+// QuotaExceededError 当天的消息数或token数达到套餐的每日上限，errors.Is可匹配ErrMessageLimitReached或ErrTokenLimitReached
+type QuotaExceededError struct {
+	Quota   string // QuotaMessages或QuotaTokens
+	Limit   int64
+	Used    int64
+	ResetAt time.Time // 下一个UTC午夜
+	err     error
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.err.Error()
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return e.err
+}
+
+// DailyQuota 一项每日额度的上限和当天用量，Limit为0表示不限制
+type DailyQuota struct {
+	Quota     string `json:"quota"`
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+}
+
+// UsageReport 用户当天的用量、套餐的每日额度以及最近几天的用量
+type UsageReport struct {
+	Today   model.DailyUsage   `json:"today"`
+	Quotas  []DailyQuota       `json:"quotas"`
+	ResetAt time.Time          `json:"reset_at"`
+	History []model.DailyUsage `json:"history"`
+}
+
+// RecordTokens 把一次生成的token数累加到用户当天（UTC日期）的用量，用于检查每日token上限
+func (s *PlanService) RecordTokens(userID uint, usage StreamUsage) error {
+	daily := model.DailyUsage{
+		UserID:           userID,
+		Date:             quotaDate(time.Now()),
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	return s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", usage.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", usage.CompletionTokens),
+			"total_tokens":      gorm.Expr("total_tokens + ?", usage.TotalTokens),
+			"updated_at":        time.Now(),
+		}),
+	}).Create(&daily).Error
+}
+
+// GetUsageReport 获取用户当天的用量和每日额度，以及包含今天在内最近days天的每日用量（按日期倒序，没有用量的日期不返回）
+func (s *PlanService) GetUsageReport(userID uint, days int) (*UsageReport, error) {
+	if days < 1 || days > maxUsageHistoryDays {
+		return nil, ErrInvalidUsageDays
+	}
+	plan, err := s.GetUserPlan(userID)
+	if err != nil {
+		return nil, err
+	}
+	today, now, err := s.usageToday(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UsageReport{
+		Today:   *today,
+		ResetAt: nextMidnight(now),
+		Quotas: []DailyQuota{
+			dailyQuota(QuotaMessages, int64(plan.MessagesPerDay), today.Messages),
+			dailyQuota(QuotaTokens, plan.TokensPerDay, today.TotalTokens),
+		},
+	}
+	since := now.AddDate(0, 0, 1-days).Format("2006-01-02")
+	if err := s.db.Where("user_id = ? AND date >= ?", userID, since).Order("date DESC").Find(&report.History).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func dailyQuota(name string, limit, used int64) DailyQuota {
+	quota := DailyQuota{Quota: name, Limit: limit, Used: used}
+	if limit > 0 {
+		quota.Remaining = max(limit-used, 0)
+	}
+	return quota
+}
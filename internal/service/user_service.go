@@ -1,41 +1,97 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/mail"
 	"ai-chat-backend/internal/model"
 	"ai-chat-backend/internal/utils"
 
 	"gorm.io/gorm"
 )
 
+// emailChangeTTL 邮箱变更确认链接的有效期
+const emailChangeTTL = 24 * time.Hour
+
+// usernamePattern 用户名只允许字母、数字和下划线，3-32位
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,32}$`)
+
 type UserService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	mailer    mail.Sender
+	blocklist *EmailBlocklist
+	bus       events.Bus
+	// welcome 首次登录时创建欢迎会话，nil时不创建
+	welcome *ChatService
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+// NewUserService blocklist为nil时不检查一次性邮箱
+func NewUserService(db *gorm.DB, mailer mail.Sender, blocklist *EmailBlocklist, bus events.Bus) *UserService {
+	return &UserService{
+		db:        db,
+		mailer:    mailer,
+		blocklist: blocklist,
+		bus:       bus,
+	}
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
-	Nickname string `json:"nickname" validate:"required,min=2,max=50"`
+	Email       string `json:"email" validate:"required,email"`
+	Username    string `json:"username"`
+	Password    string `json:"password" validate:"required,min=6"`
+	Nickname    string `json:"nickname" validate:"required,min=2,max=50"`
+	AcceptTerms bool   `json:"accept_terms"` // 注册时同意当前版本的服务条款和隐私政策
+	Region      string `json:"region"`       // 数据驻留区域，为空时使用本部署的区域
+	GuestToken  string `json:"guest_token"`  // 访客token，注册后访客的会话转入新账号
 }
 
+// LoginRequest 登录请求，邮箱和用户名二选一
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
+	Email    string `json:"email" validate:"required_without=Username,omitempty,email"`
+	Username string `json:"username" validate:"required_without=Email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
 type LoginResponse struct {
-	Token string     `json:"token"`
-	User  model.User `json:"user"`
+	Token string `json:"token"`
+	// ExpiresIn 访问token的有效秒数，过期前以RefreshToken换取新的访问token
+	ExpiresIn        int64      `json:"expires_in"`
+	RefreshToken     string     `json:"refresh_token"`
+	RefreshExpiresAt time.Time  `json:"refresh_expires_at"`
+	User             model.User `json:"user"`
+	// WelcomeConversationID 首次登录时创建的欢迎会话
+	WelcomeConversationID *uint `json:"welcome_conversation_id,omitempty"`
+	// VerificationRequired 注册后需验证邮箱，此时不签发token，输入验证码后登录
+	VerificationRequired bool `json:"verification_required,omitempty"`
+}
+
+// UseWelcome 首次登录时由chat创建欢迎会话，启动时设置
+func (s *UserService) UseWelcome(chat *ChatService) {
+	s.welcome = chat
 }
 
-// Register 用户注册
+// ProfileResponse 用户资料及附加状态
+type ProfileResponse struct {
+	*model.User
+	Consent    *ConsentStatus     `json:"consent"`
+	Completion *ProfileCompletion `json:"completion"`
+}
+
+// Register 用户注册。开启SIGNUP_REQUIRE_EMAIL_VERIFICATION时账号创建为未激活并发送验证码，
+// 返回的VerificationRequired为true且不签发token
 func (s *UserService) Register(req *RegisterRequest) (*LoginResponse, error) {
 	// 检查邮箱是否已存在
 	var existingUser model.User
@@ -43,6 +99,30 @@ func (s *UserService) Register(req *RegisterRequest) (*LoginResponse, error) {
 		return nil, errors.New("email already exists")
 	}
 
+	// 拒绝一次性邮箱
+	if s.blocklist != nil {
+		if err := s.blocklist.Check(req.Email, "register"); err != nil {
+			return nil, err
+		}
+	}
+
+	// 检查用户名
+	var username *string
+	if req.Username != "" {
+		normalized, err := s.checkUsername(req.Username)
+		if err != nil {
+			return nil, err
+		}
+		username = &normalized
+	}
+
+	// 检查区域
+	cfg := config.Load()
+	region, err := normalizeRegion(req.Region, cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+
 	// 加密密码
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
@@ -50,56 +130,89 @@ func (s *UserService) Register(req *RegisterRequest) (*LoginResponse, error) {
 	}
 
 	// 创建用户
+	verify := cfg.Signup.RequireEmailVerification
 	user := model.User{
-		Email:    req.Email,
-		Password: hashedPassword,
-		Nickname: req.Nickname,
-		IsActive: true,
+		Email:         req.Email,
+		Username:      username,
+		Password:      hashedPassword,
+		Nickname:      req.Nickname,
+		IsActive:      true,
+		VerifyPending: verify,
+		Region:        region,
 	}
 
-	if dbErr := s.db.Create(&user).Error; dbErr != nil {
-		return nil, dbErr
-	}
-
-	// 生成JWT token
-	cfg := config.Load()
-	token, err := utils.GenerateJWT(user.ID, cfg.JWT.Secret, cfg.JWT.Expiration)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if req.GuestToken == "" {
+			return nil
+		}
+		return claimGuest(tx, req.GuestToken, user.ID)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &LoginResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	s.bus.Publish(context.Background(), events.New(events.UserRegistered, user.ID, events.UserPayload{
+		Email:    user.Email,
+		Nickname: user.Nickname,
+	}))
+
+	if verify {
+		// 发送失败不影响注册，用户可重新发送验证码
+		if err := s.sendVerificationCode(&user, model.VerificationEmail); err != nil {
+			log.Printf("Failed to send verification code to user %d: %v", user.ID, err)
+		}
+		return &LoginResponse{User: user, VerificationRequired: true}, nil
+	}
+	return s.loginResponse(&user)
 }
 
-// Login 用户登录
+// Login 用户登录，支持邮箱或用户名。密码正确但注册后尚未验证邮箱时返回ErrEmailNotVerified
 func (s *UserService) Login(req *LoginRequest) (*LoginResponse, error) {
+	query := s.db.Where("is_active = ?", true)
+	if req.Email != "" {
+		query = query.Where("email = ?", req.Email)
+	} else {
+		query = query.Where("username = ?", strings.ToLower(req.Username))
+	}
+
 	var user model.User
-	if err := s.db.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
+	if err := query.First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid email or password")
+			return nil, errors.New("invalid account or password")
 		}
 		return nil, err
 	}
 
 	// 验证密码
 	if !utils.CheckPassword(req.Password, user.Password) {
-		return nil, errors.New("invalid email or password")
+		return nil, errors.New("invalid account or password")
+	}
+	if user.VerifyPending {
+		return nil, ErrEmailNotVerified
 	}
 
-	// 生成JWT token
-	cfg := config.Load()
-	token, err := utils.GenerateJWT(user.ID, cfg.JWT.Secret, cfg.JWT.Expiration)
+	return s.loginResponse(&user)
+}
+
+// loginResponse 签发访问token和刷新token，首次登录时创建欢迎会话。创建失败不影响登录，下次登录也不再重试
+func (s *UserService) loginResponse(user *model.User) (*LoginResponse, error) {
+	resp, err := s.issueTokens(s.db, user, "")
 	if err != nil {
 		return nil, err
 	}
-
-	return &LoginResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	if s.welcome == nil {
+		return resp, nil
+	}
+	conversation, err := s.welcome.SeedWelcome(context.Background(), user)
+	if err != nil {
+		log.Printf("Failed to create welcome conversation for user %d: %v", user.ID, err)
+	} else if conversation != nil {
+		resp.WelcomeConversationID = &conversation.ID
+	}
+	return resp, nil
 }
 
 // GetUserByID 根据ID获取用户
@@ -111,20 +224,111 @@ func (s *UserService) GetUserByID(userID uint) (*model.User, error) {
 	return &user, nil
 }
 
-// UpdateProfile 更新用户资料
-func (s *UserService) UpdateProfile(userID uint, nickname, avatar string) error {
+// CheckRegion 检查用户的数据是否属于本部署的区域，不属于时返回*RegionMismatchError。
+// 未配置本部署的区域（单区域部署）时不检查
+func (s *UserService) CheckRegion(userID uint) error {
+	cfg := config.Load()
+	if cfg.Region.Current == "" {
+		return nil
+	}
+	region, err := userRegion(s.db, userID)
+	if err != nil {
+		return err
+	}
+	if region != cfg.Region.Current {
+		return &RegionMismatchError{Region: region}
+	}
+	return nil
+}
+
+// IsAdmin 判断用户是否为管理员
+func (s *UserService) IsAdmin(userID uint) (bool, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return false, err
+	}
+	return user.Role == model.RoleAdmin, nil
+}
+
+// UpdateProfileRequest 更新用户资料请求，未提供的字段保持不变
+type UpdateProfileRequest struct {
+	Nickname        string `json:"nickname"`
+	Avatar          string `json:"avatar"`
+	Timezone        string `json:"timezone" validate:"omitempty,timezone"`
+	Language        string `json:"language" validate:"omitempty,bcp47_language_tag,max=16"`
+	AutoArchiveDays *int   `json:"auto_archive_days" validate:"omitempty,min=-1,max=3650"`
+}
+
+// UpdateProfile 更新用户资料，新完成的资料步骤发布事件
+func (s *UserService) UpdateProfile(userID uint, req *UpdateProfileRequest) error {
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	before := ProfileCompletionOf(&user)
+
 	updates := map[string]interface{}{
 		"updated_at": time.Now(),
 	}
 
-	if nickname != "" {
-		updates["nickname"] = nickname
+	if req.Nickname != "" {
+		updates["nickname"] = req.Nickname
+		user.Nickname = req.Nickname
+	}
+	if req.Avatar != "" {
+		updates["avatar"] = req.Avatar
+		user.Avatar = req.Avatar
+	}
+	if req.Timezone != "" {
+		updates["timezone"] = req.Timezone
+	}
+	if req.Language != "" {
+		updates["language"] = req.Language
+	}
+	if req.AutoArchiveDays != nil {
+		updates["auto_archive_days"] = *req.AutoArchiveDays
+	}
+
+	if err := s.db.Model(&model.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+		return err
+	}
+	s.publishProfileProgress(userID, before, ProfileCompletionOf(&user))
+	return nil
+}
+
+// checkUsername 校验用户名格式及是否可用，返回规范化（小写）后的用户名
+func (s *UserService) checkUsername(username string) (string, error) {
+	if !usernamePattern.MatchString(username) {
+		return "", errors.New("username must be 3-32 characters of letters, digits or underscores")
+	}
+
+	normalized := strings.ToLower(username)
+	available, err := s.IsUsernameAvailable(normalized)
+	if err != nil {
+		return "", err
 	}
-	if avatar != "" {
-		updates["avatar"] = avatar
+	if !available {
+		return "", errors.New("username already taken")
 	}
+	return normalized, nil
+}
 
-	return s.db.Model(&model.User{}).Where("id = ?", userID).Updates(updates).Error
+// IsUsernameAvailable 检查用户名是否可用
+func (s *UserService) IsUsernameAvailable(username string) (bool, error) {
+	var count int64
+	if err := s.db.Unscoped().Model(&model.User{}).Where("username = ?", strings.ToLower(username)).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// SetUsername 设置或修改用户名
+func (s *UserService) SetUsername(userID uint, username string) error {
+	normalized, err := s.checkUsername(username)
+	if err != nil {
+		return err
+	}
+	return s.db.Model(&model.User{}).Where("id = ?", userID).Update("username", normalized).Error
 }
 
 // ChangePassword 修改密码
@@ -145,5 +349,142 @@ func (s *UserService) ChangePassword(userID uint, oldPassword, newPassword strin
 		return err
 	}
 
-	return s.db.Model(&user).Update("password", hashedPassword).Error
-}
\ No newline at end of file
+	// 修改密码后撤销全部刷新token，其他设备的登录在访问token过期后失效
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		return revokeUserTokens(tx, userID)
+	})
+}
+
+// RequestEmailChange 申请修改邮箱：验证密码后向新邮箱发送确认链接，确认前旧邮箱保持有效
+func (s *UserService) RequestEmailChange(userID uint, ip string, req *ChangeEmailRequest) error {
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+
+	// 验证密码
+	if !utils.CheckPassword(req.Password, user.Password) {
+		return errors.New("invalid password")
+	}
+
+	if req.NewEmail == user.Email {
+		return errors.New("new email is the same as current email")
+	}
+
+	// 检查新邮箱是否已被使用
+	var count int64
+	if err := s.db.Model(&model.User{}).Where("email = ?", req.NewEmail).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("email already exists")
+	}
+	if s.blocklist != nil {
+		if err := s.blocklist.Check(req.NewEmail, "change_email"); err != nil {
+			return err
+		}
+	}
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+
+	changeRequest := model.EmailChangeRequest{
+		UserID:    userID,
+		NewEmail:  req.NewEmail,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(emailChangeTTL),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 之前未确认的申请作废
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", userID).Delete(&model.EmailChangeRequest{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&changeRequest).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg := config.Load()
+	link := fmt.Sprintf("%s/confirm-email?token=%s", cfg.App.FrontendURL, token)
+	if err := s.mailer.Send(req.NewEmail, "确认修改邮箱",
+		fmt.Sprintf("请在%d小时内打开以下链接确认将账号邮箱修改为本邮箱：\n%s", int(emailChangeTTL.Hours()), link)); err != nil {
+		return err
+	}
+	// 通知旧邮箱，防止账号被盗用
+	if err := s.mailer.Send(user.Email, "邮箱修改申请",
+		fmt.Sprintf("您的账号申请将邮箱修改为 %s，确认前当前邮箱仍然有效。如非本人操作，请立即修改密码。", req.NewEmail)); err != nil {
+		return err
+	}
+
+	s.bus.Publish(context.Background(), events.New(events.UserEmailChangeRequested, userID, events.AccountPayload{
+		IP:     ip,
+		Detail: "new_email=" + req.NewEmail,
+	}))
+	return nil
+}
+
+// ConfirmEmailChange 使用新邮箱收到的token确认修改邮箱
+func (s *UserService) ConfirmEmailChange(token, ip string) error {
+	var changeRequest model.EmailChangeRequest
+	if err := s.db.Where("token_hash = ? AND confirmed_at IS NULL", utils.HashToken(token)).First(&changeRequest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("invalid or expired token")
+		}
+		return err
+	}
+
+	if time.Now().After(changeRequest.ExpiresAt) {
+		return errors.New("invalid or expired token")
+	}
+
+	var (
+		oldEmail      string
+		before, after *ProfileCompletion
+	)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.Where("id = ?", changeRequest.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		oldEmail = user.Email
+		before = ProfileCompletionOf(&user)
+
+		var count int64
+		if err := tx.Model(&model.User{}).Where("email = ?", changeRequest.NewEmail).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("email already exists")
+		}
+
+		// 通过确认链接证明了对新邮箱的所有权
+		now := time.Now()
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"email":             changeRequest.NewEmail,
+			"email_verified_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		user.EmailVerifiedAt = &now
+		after = ProfileCompletionOf(&user)
+
+		return tx.Model(&changeRequest).Update("confirmed_at", &now).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.bus.Publish(context.Background(), events.New(events.UserEmailChanged, changeRequest.UserID, events.AccountPayload{
+		IP:     ip,
+		Detail: fmt.Sprintf("old_email=%s new_email=%s", oldEmail, changeRequest.NewEmail),
+	}))
+	s.publishProfileProgress(changeRequest.UserID, before, after)
+	return nil
+}
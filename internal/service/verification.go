@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// verificationResendInterval 同一用途的验证码两次发送的最小间隔，间隔内的请求不再发送
+const verificationResendInterval = time.Minute
+
+var (
+	ErrInvalidVerificationCode = errors.New("invalid or expired verification code")
+	ErrVerificationAttempts    = errors.New("too many incorrect attempts, request a new verification code")
+	ErrEmailNotVerified        = errors.New("email not verified")
+)
+
+// VerifyEmailRequest 使用注册后收到的验证码激活账号
+type VerifyEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// ResetPasswordRequest 使用忘记密码时收到的验证码设置新密码
+type ResetPasswordRequest struct {
+	Email       string `json:"email" validate:"required,email"`
+	Code        string `json:"code" validate:"required,len=6,numeric"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+// verificationMail 各用途验证码邮件的标题和正文，正文中的参数为验证码和有效分钟数
+var verificationMail = map[string][2]string{
+	model.VerificationEmail:         {"验证您的邮箱", "您的邮箱验证码为：%s\n请在%d分钟内输入验证码完成注册。如非本人操作，请忽略本邮件。"},
+	model.VerificationPasswordReset: {"重置密码", "您正在重置密码，验证码为：%s\n请在%d分钟内使用。如非本人操作，请忽略本邮件，您的密码不会被修改。"},
+}
+
+// ResendVerification 向待验证的账号重新发送注册验证码。邮箱不存在、不在待验证状态、账号已停用或发送失败时同样返回成功，不暴露邮箱是否已注册
+func (s *UserService) ResendVerification(email string) error {
+	var user model.User
+	err := s.db.Where("email = ? AND is_active = ? AND verify_pending = ?", email, true, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.sendVerificationCode(&user, model.VerificationEmail); err != nil {
+		log.Printf("Failed to send verification code to user %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+// VerifyEmail 校验注册验证码，通过后确认邮箱并解除待验证状态，返回登录结果。
+// 只处理未被停用的账号，不修改is_active，被管理员停用的账号无法借此恢复
+func (s *UserService) VerifyEmail(req *VerifyEmailRequest, ip string) (*LoginResponse, error) {
+	var user model.User
+	if err := s.db.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationCode
+		}
+		return nil, err
+	}
+	if err := s.useVerificationCode(&user, model.VerificationEmail, req.Code); err != nil {
+		return nil, err
+	}
+
+	before := ProfileCompletionOf(&user)
+	now := time.Now()
+	if err := s.db.Model(&user).Updates(map[string]interface{}{
+		"verify_pending":    false,
+		"email_verified_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	user.VerifyPending = false
+	user.EmailVerifiedAt = &now
+
+	s.bus.Publish(context.Background(), events.New(events.UserEmailVerified, user.ID, events.AccountPayload{
+		IP:     ip,
+		Detail: "email=" + user.Email,
+	}))
+	s.publishProfileProgress(user.ID, before, ProfileCompletionOf(&user))
+	return s.loginResponse(&user)
+}
+
+// ForgotPassword 向已激活账号的邮箱发送重置密码的验证码。邮箱不存在或发送失败时同样返回成功，不暴露邮箱是否已注册
+func (s *UserService) ForgotPassword(email string) error {
+	var user model.User
+	err := s.db.Where("email = ? AND is_active = ?", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.sendVerificationCode(&user, model.VerificationPasswordReset); err != nil {
+		log.Printf("Failed to send password reset code to user %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+// ResetPassword 校验重置密码的验证码并设置新密码，撤销全部刷新token。
+// 验证码发送到账号邮箱，重置成功同时确认了邮箱并解除待验证状态
+func (s *UserService) ResetPassword(req *ResetPasswordRequest, ip string) error {
+	var user model.User
+	if err := s.db.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidVerificationCode
+		}
+		return err
+	}
+	if err := s.useVerificationCode(&user, model.VerificationPasswordReset, req.Code); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"password": hashedPassword}
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if user.VerifyPending {
+			updates["verify_pending"] = false
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return revokeUserTokens(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.bus.Publish(context.Background(), events.New(events.UserPasswordReset, user.ID, events.AccountPayload{IP: ip}))
+	return nil
+}
+
+// sendVerificationCode 生成新的验证码并发送到用户邮箱，之前未使用的同用途验证码作废。
+// 距上次发送不足verificationResendInterval时不发送
+func (s *UserService) sendVerificationCode(user *model.User, purpose string) error {
+	var last model.VerificationCode
+	err := s.db.Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).Order("id DESC").First(&last).Error
+	if err == nil && time.Since(last.CreatedAt) < verificationResendInterval {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return err
+	}
+	cfg := config.Load().Signup
+	record := model.VerificationCode{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		CodeHash:  utils.HashToken(code),
+		ExpiresAt: time.Now().Add(cfg.CodeTTL),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).Delete(&model.VerificationCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	mail := verificationMail[purpose]
+	return s.mailer.Send(user.Email, mail[0], fmt.Sprintf(mail[1], code, int(cfg.CodeTTL.Minutes())))
+}
+
+// useVerificationCode 校验用户最新的同用途验证码，通过后标记为已使用。
+// 每次校验先占用一次尝试次数，达到VERIFICATION_CODE_MAX_ATTEMPTS后验证码失效，并发猜测也不会超出
+func (s *UserService) useVerificationCode(user *model.User, purpose, code string) error {
+	var record model.VerificationCode
+	err := s.db.Where("user_id = ? AND purpose = ? AND email = ? AND used_at IS NULL", user.ID, purpose, user.Email).
+		Order("id DESC").First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidVerificationCode
+	}
+	if err != nil {
+		return err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return ErrInvalidVerificationCode
+	}
+
+	maxAttempts := config.Load().Signup.CodeMaxAttempts
+	reserved := s.db.Model(&model.VerificationCode{}).Where("id = ? AND attempts < ?", record.ID, maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if reserved.Error != nil {
+		return reserved.Error
+	}
+	if reserved.RowsAffected == 0 {
+		return ErrVerificationAttempts
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(code)), []byte(record.CodeHash)) != 1 {
+		if record.Attempts+1 >= maxAttempts {
+			return ErrVerificationAttempts
+		}
+		return ErrInvalidVerificationCode
+	}
+
+	// 并发提交同一验证码时只有一个请求成功
+	result := s.db.Model(&model.VerificationCode{}).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidVerificationCode
+	}
+	return nil
+}
+
+// generateVerificationCode 生成6位数字验证码
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+)
+
+var mailCode = regexp.MustCompile(`\d{6}`)
+
+func newTestUserService(t *testing.T) (*UserService, *captureSender) {
+	t.Helper()
+	db := newTestDB(t)
+	mailer := &captureSender{}
+	bus := events.NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+	return NewUserService(db, mailer, nil, bus), mailer
+}
+
+func TestGenerateVerificationCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := generateVerificationCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 6 || !mailCode.MatchString(code) {
+			t.Fatalf("generateVerificationCode() = %q, want 6 digits", code)
+		}
+	}
+}
+
+func TestSignupRequiresVerification(t *testing.T) {
+	t.Setenv("SIGNUP_REQUIRE_EMAIL_VERIFICATION", "true")
+	s, mailer := newTestUserService(t)
+	email := uniqueEmail("signup")
+
+	resp, err := s.Register(&RegisterRequest{Email: email, Password: "secret123", Nickname: "tester"})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if !resp.VerificationRequired || resp.Token != "" {
+		t.Fatalf("Register() = %+v, want verification required without tokens", resp)
+	}
+	if !resp.User.IsActive || !resp.User.VerifyPending {
+		t.Fatalf("registered user is_active=%v verify_pending=%v, want true/true", resp.User.IsActive, resp.User.VerifyPending)
+	}
+
+	if _, err := s.Login(&LoginRequest{Email: email, Password: "secret123"}); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("Login() before verification error = %v, want ErrEmailNotVerified", err)
+	}
+
+	sent, ok := mailer.last()
+	if !ok || sent.To != email {
+		t.Fatalf("verification mail not sent to %s", email)
+	}
+	code := mailCode.FindString(sent.Body)
+	if _, err := s.VerifyEmail(&VerifyEmailRequest{Email: email, Code: code}, "127.0.0.1"); err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	if _, err := s.Login(&LoginRequest{Email: email, Password: "secret123"}); err != nil {
+		t.Fatalf("Login() after verification error = %v", err)
+	}
+}
+
+// 被管理员停用的账号（包括从未验证过邮箱的存量账号）不能通过验证流程恢复
+func TestVerificationDoesNotReactivate(t *testing.T) {
+	s, mailer := newTestUserService(t)
+	hashed, err := utils.HashPassword("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		user model.User
+	}{
+		{name: "legacy unverified", user: model.User{IsActive: false}},
+		{name: "deactivated while pending", user: model.User{IsActive: false, VerifyPending: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.user.Password = hashed
+			user := createTestUser(t, s.db, tt.user)
+			// gorm对零值使用列默认值，需显式停用
+			if err := s.db.Model(user).Update("is_active", false).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			before := len(mailer.sent)
+			if err := s.ResendVerification(user.Email); err != nil {
+				t.Fatalf("ResendVerification() error = %v", err)
+			}
+			if len(mailer.sent) != before {
+				t.Fatalf("ResendVerification() sent a code to a deactivated account")
+			}
+
+			// 即使存在有效的验证码也不能验证
+			if err := s.db.Create(&model.VerificationCode{
+				UserID:    user.ID,
+				Purpose:   model.VerificationEmail,
+				Email:     user.Email,
+				CodeHash:  utils.HashToken("123456"),
+				ExpiresAt: time.Now().Add(time.Hour),
+			}).Error; err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.VerifyEmail(&VerifyEmailRequest{Email: user.Email, Code: "123456"}, "127.0.0.1"); !errors.Is(err, ErrInvalidVerificationCode) {
+				t.Fatalf("VerifyEmail() error = %v, want ErrInvalidVerificationCode", err)
+			}
+			if _, err := s.Login(&LoginRequest{Email: user.Email, Password: "secret123"}); err == nil {
+				t.Fatalf("Login() succeeded for a deactivated account")
+			}
+
+			var reloaded model.User
+			if err := s.db.First(&reloaded, user.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if reloaded.IsActive {
+				t.Fatalf("account was reactivated")
+			}
+		})
+	}
+}
+
+func TestVerificationCodeAttempts(t *testing.T) {
+	t.Setenv("VERIFICATION_CODE_MAX_ATTEMPTS", "2")
+	s, _ := newTestUserService(t)
+	user := createTestUser(t, s.db, model.User{IsActive: true, VerifyPending: true})
+	if err := s.db.Create(&model.VerificationCode{
+		UserID:    user.ID,
+		Purpose:   model.VerificationEmail,
+		Email:     user.Email,
+		CodeHash:  utils.HashToken("123456"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		code string
+		want error
+	}{
+		{code: "000000", want: ErrInvalidVerificationCode},
+		{code: "000001", want: ErrVerificationAttempts},
+		{code: "123456", want: ErrVerificationAttempts},
+	}
+	for i, step := range steps {
+		err := s.useVerificationCode(user, model.VerificationEmail, step.code)
+		if !errors.Is(err, step.want) {
+			t.Fatalf("attempt %d: useVerificationCode() error = %v, want %v", i+1, err, step.want)
+		}
+	}
+}
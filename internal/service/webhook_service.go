@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+	"ai-chat-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxWebhooksPerConversation 每个会话最多可添加的webhook数
+	maxWebhooksPerConversation = 5
+	// webhookTimeout 单次推送的超时时间
+	webhookTimeout = 10 * time.Second
+	// webhookAttempts 推送失败（网络错误或5xx）时的最多尝试次数
+	webhookAttempts = 3
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookLimitExceeded = errors.New("too many webhooks for this conversation")
+	errWebhookAddress       = errors.New("webhook address is not allowed")
+)
+
+type CreateWebhookRequest struct {
+	URL string `json:"url" validate:"required,url,startswith=https://|startswith=http://,max=500"`
+}
+
+// WebhookCreated 创建结果，签名密钥只在此时返回
+type WebhookCreated struct {
+	*model.ConversationWebhook
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload 推送内容
+type WebhookPayload struct {
+	Event          string    `json:"event"`
+	ConversationID uint      `json:"conversation_id"`
+	Conversation   string    `json:"conversation_title"`
+	MessageID      uint      `json:"message_id"`
+	Role           string    `json:"role"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// WebhookService 管理会话级webhook，并在AI回复完成后推送消息，用于对接Slack等自动化流程。
+// 推送请求以 HMAC-SHA256 签名，且不允许访问内网地址
+type WebhookService struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: denyPrivateAddress,
+	}
+	return &WebhookService{
+		db: db,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// 不跟随重定向，避免被重定向到内网地址
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// denyPrivateAddress 在建立连接前检查解析后的地址，拒绝回环、内网和链路本地地址
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateIP(ip) {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+// isPrivateIP 回环、内网、链路本地（含云服务元数据地址）和组播地址
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast()
+}
+
+// Subscribe 订阅AI回复完成和会话删除事件
+func (s *WebhookService) Subscribe(bus events.Bus) {
+	bus.Subscribe(events.MessageCreated, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.MessagePayload)
+		if !ok || payload.Role != "assistant" {
+			return nil
+		}
+		return s.dispatch(ctx, payload.ConversationID, payload.MessageID)
+	})
+	bus.Subscribe(events.ConversationDeleted, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.ConversationPayload)
+		if !ok {
+			return nil
+		}
+		return s.db.Where("conversation_id = ?", payload.ConversationID).Delete(&model.ConversationWebhook{}).Error
+	})
+}
+
+// List 获取会话的webhook
+func (s *WebhookService) List(userID, conversationID uint) ([]model.ConversationWebhook, error) {
+	var webhooks []model.ConversationWebhook
+	err := s.db.Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// Create 为会话添加webhook，无痕会话不产生消息事件，不允许添加
+func (s *WebhookService) Create(userID, conversationID uint, req *CreateWebhookRequest) (*WebhookCreated, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	if conversation.Incognito {
+		return nil, ErrConversationNotFound
+	}
+
+	var count int64
+	if err := s.db.Model(&model.ConversationWebhook{}).Where("conversation_id = ?", conversationID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= maxWebhooksPerConversation {
+		return nil, ErrWebhookLimitExceeded
+	}
+
+	secret, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	webhook := model.ConversationWebhook{
+		UserID:         userID,
+		ConversationID: conversationID,
+		URL:            req.URL,
+		Secret:         secret,
+	}
+	if err := s.db.Create(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &WebhookCreated{ConversationWebhook: &webhook, Secret: secret}, nil
+}
+
+// Delete 删除webhook
+func (s *WebhookService) Delete(userID, conversationID, webhookID uint) error {
+	result := s.db.Where("id = ? AND conversation_id = ? AND user_id = ?", webhookID, conversationID, userID).
+		Delete(&model.ConversationWebhook{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// dispatch 将消息推送给会话的全部webhook
+func (s *WebhookService) dispatch(ctx context.Context, conversationID, messageID uint) error {
+	var webhooks []model.ConversationWebhook
+	if err := s.db.Where("conversation_id = ?", conversationID).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	var message model.Message
+	if err := s.db.First(&message, messageID).Error; err != nil {
+		return err
+	}
+	var conversation model.Conversation
+	if err := s.db.Select("title").First(&conversation, conversationID).Error; err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(WebhookPayload{
+		Event:          "message.completed",
+		ConversationID: conversationID,
+		Conversation:   conversation.Title,
+		MessageID:      message.ID,
+		Role:           message.Role,
+		Content:        message.Content,
+		CreatedAt:      message.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range webhooks {
+		s.deliver(ctx, &webhooks[i], body)
+	}
+	return nil
+}
+
+// deliver 推送一次消息并记录结果，网络错误或5xx时重试
+func (s *WebhookService) deliver(ctx context.Context, webhook *model.ConversationWebhook, body []byte) {
+	var status int
+	var deliverErr error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		status, deliverErr = s.post(ctx, webhook, body)
+		if deliverErr == nil && status < 500 {
+			break
+		}
+		if attempt < webhookAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+
+	lastError := ""
+	switch {
+	case deliverErr != nil:
+		lastError = deliverErr.Error()
+	case status >= 300:
+		lastError = http.StatusText(status)
+	}
+	if lastError != "" {
+		log.Printf("Webhook %d delivery failed: %s", webhook.ID, lastError)
+	}
+	if len(lastError) > 255 {
+		lastError = lastError[:255]
+	}
+
+	now := time.Now()
+	if err := s.db.Model(webhook).Updates(map[string]interface{}{
+		"last_status":       status,
+		"last_error":        lastError,
+		"last_delivered_at": &now,
+	}).Error; err != nil {
+		log.Printf("Failed to record webhook %d delivery: %v", webhook.ID, err)
+	}
+}
+
+// post 发送签名后的推送请求，签名为 HMAC-SHA256(secret, timestamp + "." + body)
+func (s *WebhookService) post(ctx context.Context, webhook *model.ConversationWebhook, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
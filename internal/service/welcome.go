@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"ai-chat-backend/internal/config"
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/schema"
+	"gorm.io/gorm"
+)
+
+// PromptWelcome 欢迎会话中引导消息的模板，已发布版本时替代CHAT_WELCOME_MESSAGE
+const PromptWelcome = "welcome"
+
+// defaultWelcomeMessage 未配置CHAT_WELCOME_MESSAGE且未发布welcome模板时使用的引导消息
+const defaultWelcomeMessage = "Hi {nickname}, welcome! I'm your AI assistant. Here is what I can help with:\n\n" +
+	"- Answer questions, explain concepts and brainstorm ideas\n" +
+	"- Write, summarize, translate and polish text\n" +
+	"- Read and explain code, and help you debug it\n" +
+	"- Search your knowledge base collections when you enable them for a conversation\n" +
+	"- Read text in images you attach to a message\n\n" +
+	"Start a new conversation any time, or just reply here to get started."
+
+// SeedWelcome 用户首次登录（含注册）时创建欢迎会话，其中包含一条介绍功能的助手消息，返回创建的会话。
+// 以users.welcomed_at认领，每个用户只创建一次；访客、已有会话的用户（如注册时转入了访客会话）或未开启时不创建，返回nil
+func (s *ChatService) SeedWelcome(ctx context.Context, user *model.User) (*model.Conversation, error) {
+	cfg := config.Load().Chat
+	if !cfg.WelcomeConversation || user.Guest || user.WelcomedAt != nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	claim := s.db.Model(&model.User{}).Where("id = ? AND welcomed_at IS NULL", user.ID).Update("welcomed_at", now)
+	if claim.Error != nil {
+		return nil, claim.Error
+	}
+	user.WelcomedAt = &now
+	if claim.RowsAffected == 0 {
+		return nil, nil
+	}
+	var existing int64
+	if err := s.db.Model(&model.Conversation{}).Where("user_id = ?", user.ID).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	content, versions := s.welcomeMessage(ctx, cfg, user)
+	conversation := model.Conversation{
+		UserID:        user.ID,
+		Title:         cfg.WelcomeTitle,
+		LastMessageAt: now,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+		return incrementUserCounter(tx, user.ID, "conversation_count", 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publishConversationEvent(&conversation, events.ConversationCreated)
+
+	message := &model.Message{
+		ConversationID: conversation.ID,
+		Role:           "assistant",
+		Content:        content,
+		PromptVersions: versions,
+		CreatedAt:      now,
+	}
+	if err := s.saveMessage(ctx, &conversation, message); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// welcomeMessage 渲染引导消息，优先使用已发布的welcome模板，返回内容及使用的模板版本。
+// 配置的模板无法渲染时使用内置的引导消息
+func (s *ChatService) welcomeMessage(ctx context.Context, cfg config.ChatConfig, user *model.User) (string, string) {
+	content := cfg.WelcomeMessage
+	versions := ""
+	if s.promptService != nil {
+		template, err := s.promptService.Active(PromptWelcome)
+		if err != nil {
+			log.Printf("Failed to load welcome template: %v", err)
+		} else if template != nil {
+			content = template.Content
+			versions = promptVersionsLabel([]*model.PromptTemplate{template})
+		}
+	}
+	if content == "" {
+		content = defaultWelcomeMessage
+	}
+
+	rendered, err := renderWelcome(ctx, content, user)
+	if err != nil {
+		log.Printf("Failed to render welcome message for user %d: %v", user.ID, err)
+		rendered, _ = renderWelcome(ctx, defaultWelcomeMessage, user)
+		versions = ""
+	}
+	return rendered, versions
+}
+
+// renderWelcome 以FString渲染引导消息，可使用{nickname}、{date}变量
+func renderWelcome(ctx context.Context, content string, user *model.User) (string, error) {
+	messages, err := schema.AssistantMessage(content, nil).Format(ctx, map[string]any{
+		"nickname": user.Nickname,
+		"date":     time.Now().In(user.Location()).Format("2006-01-02"),
+	}, schema.FString)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", fmt.Errorf("welcome template rendered no message")
+	}
+	return messages[0].Content, nil
+}
@@ -0,0 +1,767 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ai-chat-backend/internal/events"
+	"ai-chat-backend/internal/model"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"gorm.io/gorm"
+)
+
+// maxWorkflowSteps 单个工作流的最大步骤数
+const maxWorkflowSteps = 8
+
+// workflowRequestField 步骤输入中用户请求的字段名，不能用作步骤名
+const workflowRequestField = "request"
+
+// 自定义工作流的限制，maxWorkflowTimeout单位为秒
+const (
+	maxWorkflowAgents    = 8
+	maxAgentPromptLength = 4000
+	maxStepPromptLength  = 2000
+	maxStopPhraseLength  = 100
+	maxStepTools         = 8
+	maxWorkflowTimeout   = 30 * 60
+)
+
+// workflowRunJobType 异步执行已保存工作流的任务类型
+const workflowRunJobType = "workflow_run"
+
+// workflowStepsProgress 全部步骤完成时的任务进度，剩余部分为保存最终答案
+const workflowStepsProgress = 95
+
+var (
+	ErrWorkflowInvalid     = errors.New("invalid workflow")
+	ErrWorkflowNotFound    = errors.New("workflow not found")
+	ErrWorkflowRunNotFound = errors.New("workflow run not found")
+)
+
+var stepNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// WorkflowAgent 参与工作流的助手角色，除内置角色外可在工作流定义中自定义
+type WorkflowAgent struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	SystemPrompt string `json:"system_prompt"`
+}
+
+// workflowAgents 内置角色
+var workflowAgents = []WorkflowAgent{
+	{
+		Name:        "researcher",
+		Description: "Collects the facts, background and open questions relevant to the request",
+		SystemPrompt: "You are a researcher. Analyse the user's request and gather the relevant facts, background knowledge, " +
+			"constraints and open questions. Be thorough and factual, mark anything uncertain, and do not write the final answer.",
+	},
+	{
+		Name:        "critic",
+		Description: "Reviews earlier steps for errors, gaps and weak reasoning",
+		SystemPrompt: "You are a critic. Review the work of the previous steps for factual errors, gaps, weak reasoning and " +
+			"anything that does not address the user's request. List concrete problems and how to fix them.",
+	},
+	{
+		Name:        "writer",
+		Description: "Writes the final answer from the earlier steps",
+		SystemPrompt: "You are a writer. Using the work of the previous steps, write the final answer to the user's request. " +
+			"Address the critique, keep only what is correct, and reply in the language of the user's request.",
+	},
+}
+
+// findWorkflowAgent 按名称查找角色，自定义角色优先于内置角色
+func findWorkflowAgent(custom []WorkflowAgent, name string) *WorkflowAgent {
+	for i := range custom {
+		if custom[i].Name == name {
+			return &custom[i]
+		}
+	}
+	for i := range workflowAgents {
+		if workflowAgents[i].Name == name {
+			return &workflowAgents[i]
+		}
+	}
+	return nil
+}
+
+// WorkflowStep 工作流中的一个步骤，Inputs为需要读取其输出的前序步骤，为空时读取前面的全部步骤。
+// Prompt为附加到角色提示词后的本步说明，Tools为本步可调用的MCP服务，
+// 输出包含StopOn（不区分大小写）时提前结束，以本步输出作为最终答案
+type WorkflowStep struct {
+	Name   string   `json:"name"`
+	Agent  string   `json:"agent"`
+	Inputs []string `json:"inputs,omitempty"`
+	Prompt string   `json:"prompt,omitempty"`
+	Tools  []uint   `json:"tools,omitempty"`
+	StopOn string   `json:"stop_on,omitempty"`
+}
+
+// WorkflowStop 整个工作流的停止条件：累计token达到MaxTokens后不再执行后续步骤，
+// 以最近完成的步骤输出作为最终答案；超过TimeoutSeconds时执行失败。0表示不限制
+type WorkflowStop struct {
+	MaxTokens      int64 `json:"max_tokens,omitempty"`
+	TimeoutSeconds int   `json:"timeout_seconds,omitempty"`
+}
+
+// WorkflowDefinition 工作流定义：自定义角色、步骤和停止条件
+type WorkflowDefinition struct {
+	Agents []WorkflowAgent `json:"agents,omitempty"`
+	Steps  []WorkflowStep  `json:"steps"`
+	Stop   WorkflowStop    `json:"stop"`
+}
+
+// defaultWorkflow 未指定步骤时使用：研究 → 评审 → 撰写
+var defaultWorkflow = []WorkflowStep{
+	{Name: "research", Agent: "researcher"},
+	{Name: "critique", Agent: "critic"},
+	{Name: "answer", Agent: "writer"},
+}
+
+type RunWorkflowRequest struct {
+	Content string `json:"content" validate:"required"`
+	WorkflowDefinition
+}
+
+type SaveWorkflowRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	WorkflowDefinition
+}
+
+type RunSavedWorkflowRequest struct {
+	ConversationID uint   `json:"conversation_id" validate:"required"`
+	Content        string `json:"content" validate:"required"`
+}
+
+// SavedWorkflow 已保存的工作流及其解析后的定义
+type SavedWorkflow struct {
+	*model.Workflow
+	WorkflowDefinition
+}
+
+// WorkflowRunResult 异步执行完成后的任务结果
+type WorkflowRunResult struct {
+	RunID              uint `json:"run_id"`
+	AssistantMessageID uint `json:"assistant_message_id"`
+}
+
+// WorkflowService 多智能体工作流：多个角色按步骤依次或并行处理同一请求，
+// 每步输出单独保存，最后一步的输出作为助手回复保存到会话
+type WorkflowService struct {
+	db          *gorm.DB
+	chatService *ChatService
+	jobService  *JobService
+	// onboarding 记录新手引导步骤，nil时不记录
+	onboarding *OnboardingService
+}
+
+func NewWorkflowService(db *gorm.DB, chatService *ChatService, jobService *JobService) *WorkflowService {
+	return &WorkflowService{
+		db:          db,
+		chatService: chatService,
+		jobService:  jobService,
+	}
+}
+
+// UseOnboarding 保存工作流时记录新手引导步骤，启动时设置
+func (s *WorkflowService) UseOnboarding(onboarding *OnboardingService) {
+	s.onboarding = onboarding
+}
+
+// Subscribe 会话删除时清理执行记录
+func (s *WorkflowService) Subscribe(bus events.Bus) {
+	bus.Subscribe(events.ConversationDeleted, func(ctx context.Context, event events.Event) error {
+		payload, ok := event.Payload.(events.ConversationPayload)
+		if !ok {
+			return nil
+		}
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			runIDs := tx.Model(&model.WorkflowRun{}).Select("id").Where("conversation_id = ?", payload.ConversationID)
+			if err := tx.Where("run_id IN (?)", runIDs).Delete(&model.WorkflowStepRun{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("conversation_id = ?", payload.ConversationID).Delete(&model.WorkflowRun{}).Error
+		})
+	})
+}
+
+// Agents 内置的角色
+func (s *WorkflowService) Agents() []WorkflowAgent {
+	return workflowAgents
+}
+
+// validateDefinition 校验工作流定义并补全默认步骤和输入，最后一步为最终答案，其他步骤的输出必须被后续步骤使用
+func (s *WorkflowService) validateDefinition(def *WorkflowDefinition) (*WorkflowDefinition, error) {
+	if err := validateAgents(def.Agents); err != nil {
+		return nil, err
+	}
+	if def.Stop.MaxTokens < 0 || def.Stop.TimeoutSeconds < 0 || def.Stop.TimeoutSeconds > maxWorkflowTimeout {
+		return nil, fmt.Errorf("%w: stop conditions must be non-negative and the timeout at most %d seconds", ErrWorkflowInvalid, maxWorkflowTimeout)
+	}
+
+	steps := def.Steps
+	if len(steps) == 0 {
+		steps = defaultWorkflow
+	}
+	if len(steps) > maxWorkflowSteps {
+		return nil, fmt.Errorf("%w: at most %d steps", ErrWorkflowInvalid, maxWorkflowSteps)
+	}
+
+	resolved := make([]WorkflowStep, len(steps))
+	index := make(map[string]int, len(steps))
+	used := make(map[string]bool, len(steps))
+	var serverIDs []uint
+	for i, step := range steps {
+		if !stepNamePattern.MatchString(step.Name) || step.Name == workflowRequestField {
+			return nil, fmt.Errorf("%w: step name %q must be 1-32 characters of a-z, 0-9, _ or - and not %q", ErrWorkflowInvalid, step.Name, workflowRequestField)
+		}
+		if _, exists := index[step.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate step %q", ErrWorkflowInvalid, step.Name)
+		}
+		if findWorkflowAgent(def.Agents, step.Agent) == nil {
+			return nil, fmt.Errorf("%w: unknown agent %q", ErrWorkflowInvalid, step.Agent)
+		}
+		if utf8.RuneCountInString(step.Prompt) > maxStepPromptLength {
+			return nil, fmt.Errorf("%w: prompt of step %q exceeds %d characters", ErrWorkflowInvalid, step.Name, maxStepPromptLength)
+		}
+		if utf8.RuneCountInString(step.StopOn) > maxStopPhraseLength {
+			return nil, fmt.Errorf("%w: stop phrase of step %q exceeds %d characters", ErrWorkflowInvalid, step.Name, maxStopPhraseLength)
+		}
+		if len(step.Tools) > maxStepTools {
+			return nil, fmt.Errorf("%w: step %q can use at most %d tool servers", ErrWorkflowInvalid, step.Name, maxStepTools)
+		}
+		serverIDs = append(serverIDs, step.Tools...)
+
+		inputs := step.Inputs
+		if inputs == nil {
+			inputs = make([]string, i)
+			for j := 0; j < i; j++ {
+				inputs[j] = steps[j].Name
+			}
+		}
+		for _, input := range inputs {
+			if _, ok := index[input]; !ok {
+				return nil, fmt.Errorf("%w: step %q can only read earlier steps, not %q", ErrWorkflowInvalid, step.Name, input)
+			}
+			used[input] = true
+		}
+
+		index[step.Name] = i
+		resolved[i] = step
+		resolved[i].Inputs = inputs
+	}
+
+	for _, step := range resolved[:len(resolved)-1] {
+		if !used[step.Name] {
+			return nil, fmt.Errorf("%w: output of step %q is not used by any later step", ErrWorkflowInvalid, step.Name)
+		}
+	}
+	if err := s.checkServers(serverIDs); err != nil {
+		return nil, err
+	}
+	return &WorkflowDefinition{Agents: def.Agents, Steps: resolved, Stop: def.Stop}, nil
+}
+
+// validateAgents 校验自定义角色，名称不能与内置角色重复
+func validateAgents(agents []WorkflowAgent) error {
+	if len(agents) > maxWorkflowAgents {
+		return fmt.Errorf("%w: at most %d custom agents", ErrWorkflowInvalid, maxWorkflowAgents)
+	}
+	names := make(map[string]bool, len(agents))
+	for _, agent := range agents {
+		if !stepNamePattern.MatchString(agent.Name) {
+			return fmt.Errorf("%w: agent name %q must be 1-32 characters of a-z, 0-9, _ or -", ErrWorkflowInvalid, agent.Name)
+		}
+		if names[agent.Name] || findWorkflowAgent(nil, agent.Name) != nil {
+			return fmt.Errorf("%w: duplicate agent %q", ErrWorkflowInvalid, agent.Name)
+		}
+		names[agent.Name] = true
+		if strings.TrimSpace(agent.SystemPrompt) == "" || utf8.RuneCountInString(agent.SystemPrompt) > maxAgentPromptLength {
+			return fmt.Errorf("%w: system prompt of agent %q must be 1-%d characters", ErrWorkflowInvalid, agent.Name, maxAgentPromptLength)
+		}
+	}
+	return nil
+}
+
+// checkServers 步骤引用的MCP服务必须存在，停用的服务在执行时跳过
+func (s *WorkflowService) checkServers(serverIDs []uint) error {
+	if len(serverIDs) == 0 {
+		return nil
+	}
+	unique := make(map[uint]bool, len(serverIDs))
+	for _, id := range serverIDs {
+		unique[id] = true
+	}
+	var count int64
+	if err := s.db.Model(&model.MCPServer{}).Where("id IN ?", serverIDs).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != int64(len(unique)) {
+		return fmt.Errorf("%w: unknown tool server", ErrWorkflowInvalid)
+	}
+	return nil
+}
+
+// workflowExecution 一次执行中各步骤共享的数据，并行步骤同时写入用量和停止状态
+type workflowExecution struct {
+	run             *model.WorkflowRun
+	def             *WorkflowDefinition
+	userID          uint
+	gen             *generator
+	history         []*schema.Message
+	maxOutputTokens int
+	// onStep 每个步骤结束（完成或因停止条件跳过）后调用
+	onStep func(step string, done int)
+
+	mu         sync.Mutex
+	usage      StreamUsage
+	done       int
+	stopped    bool
+	stopOutput string
+}
+
+// Run 执行工作流，返回执行记录（含各步骤输出）、用户消息和保存最终答案的助手消息
+func (s *WorkflowService) Run(ctx context.Context, userID, conversationID uint, req *RunWorkflowRequest) (*model.WorkflowRun, *model.Message, *model.Message, error) {
+	def, err := s.validateDefinition(&req.WorkflowDefinition)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	conversation, err := s.workflowConversation(userID, conversationID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s.run(ctx, userID, conversation, nil, def, req.Content, nil)
+}
+
+// workflowConversation 获取可执行工作流的会话，无痕会话不保存执行记录因此不支持
+func (s *WorkflowService) workflowConversation(userID, conversationID uint) (*model.Conversation, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, conversationError(err)
+	}
+	if conversation.Incognito {
+		return nil, fmt.Errorf("%w: not available in incognito conversations", ErrWorkflowInvalid)
+	}
+	return &conversation, nil
+}
+
+func (s *WorkflowService) run(ctx context.Context, userID uint, conversation *model.Conversation, workflowID *uint, def *WorkflowDefinition, content string, onStep func(step string, done int)) (*model.WorkflowRun, *model.Message, *model.Message, error) {
+	chat := s.chatService
+	if err := chat.checkMessageLength(userID, conversation, "", content); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := chat.CheckSecrets(content); err != nil {
+		return nil, nil, nil, err
+	}
+	gen, err := chat.resolveGenerator(userID, conversation, conversation.Model)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := chat.checkEntitlements(userID, gen); err != nil {
+		return nil, nil, nil, err
+	}
+
+	userMessage := chat.newUserMessage(conversation.ID, content)
+	content = userMessage.Content
+	if err := chat.saveUserMessage(ctx, conversation, &userMessage, gen); err != nil {
+		return nil, nil, nil, err
+	}
+	historyMessages, err := chat.loadHistory(ctx, conversation)
+	if err != nil {
+		return nil, &userMessage, nil, err
+	}
+
+	definition, _ := json.Marshal(def)
+	run := &model.WorkflowRun{
+		UserID:         userID,
+		ConversationID: conversation.ID,
+		WorkflowID:     workflowID,
+		Status:         model.WorkflowStatusRunning,
+		Input:          content,
+		Definition:     string(definition),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		return nil, &userMessage, nil, err
+	}
+
+	exec := &workflowExecution{
+		run:             run,
+		def:             def,
+		userID:          userID,
+		gen:             gen,
+		history:         toSchemaMessages(historyMessages),
+		maxOutputTokens: chat.maxOutputTokens(userID, conversation),
+		onStep:          onStep,
+	}
+	output, err := s.execute(withGeneration(ctx, &generationInfo{
+		UserID:         userID,
+		ConversationID: conversation.ID,
+	}), exec, content)
+	if err != nil {
+		s.finish(run, exec, "", err)
+		// 失败前已完成的步骤同样消耗了token，计入用户消息
+		s.chargeFailed(userID, exec, &userMessage)
+		return run, &userMessage, nil, err
+	}
+
+	assistantMessage := model.Message{
+		ConversationID: conversation.ID,
+		Role:           "assistant",
+		Content:        output,
+	}
+	if err := chat.saveMessage(ctx, conversation, &assistantMessage); err != nil {
+		s.finish(run, exec, output, err)
+		s.chargeFailed(userID, exec, &userMessage)
+		return run, &userMessage, nil, err
+	}
+	run.MessageID = &assistantMessage.ID
+	s.finish(run, exec, output, nil)
+
+	chat.recordGeneration(userID, gen, exec.totalUsage(), &assistantMessage)
+	chat.maybeCompact(conversation)
+	return run, &userMessage, &assistantMessage, nil
+}
+
+// execute 将步骤编排为Eino Workflow：步骤之间按输入建立依赖，互不依赖的步骤并行执行。
+// 触发停止条件时以触发时的步骤输出作为最终答案
+func (s *WorkflowService) execute(ctx context.Context, exec *workflowExecution, request string) (string, error) {
+	steps := exec.def.Steps
+	wf := compose.NewWorkflow[string, string]()
+	for _, step := range steps {
+		node := wf.AddLambdaNode(step.Name, compose.InvokableLambda(s.stepNode(exec, step)), compose.WithNodeName(step.Agent))
+		node.AddInput(compose.START, compose.ToField(workflowRequestField))
+		for _, input := range step.Inputs {
+			node.AddInput(input, compose.ToField(input))
+		}
+	}
+	wf.End().AddInput(steps[len(steps)-1].Name)
+
+	runnable, err := wf.Compile(ctx, compose.WithGraphName("workflow"))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrWorkflowInvalid, err)
+	}
+
+	if exec.def.Stop.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(exec.def.Stop.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	output, err := runnable.Invoke(ctx, request, s.chatService.callbackOptions()...)
+	if err != nil {
+		return "", err
+	}
+
+	exec.mu.Lock()
+	defer exec.mu.Unlock()
+	if exec.stopped {
+		return exec.stopOutput, nil
+	}
+	return output, nil
+}
+
+// stepNode 一个步骤：以角色的系统提示词、会话历史和所读取步骤的输出生成，并保存本步输出。
+// 已触发停止条件时直接跳过
+func (s *WorkflowService) stepNode(exec *workflowExecution, step WorkflowStep) func(ctx context.Context, in map[string]any) (string, error) {
+	agent := findWorkflowAgent(exec.def.Agents, step.Agent)
+	systemPrompt := agent.SystemPrompt
+	if step.Prompt != "" {
+		systemPrompt += "\n\n" + step.Prompt
+	}
+	return func(ctx context.Context, in map[string]any) (string, error) {
+		if exec.isStopped() {
+			exec.stepDone(step.Name)
+			return "", nil
+		}
+
+		messages := make([]*schema.Message, 0, len(exec.history)+2)
+		messages = append(messages, schema.SystemMessage(systemPrompt))
+		messages = append(messages, exec.history...)
+		if len(step.Inputs) > 0 {
+			var b strings.Builder
+			b.WriteString("Work from the previous steps:")
+			for _, input := range step.Inputs {
+				output, _ := in[input].(string)
+				fmt.Fprintf(&b, "\n\n## %s\n%s", input, output)
+			}
+			messages = append(messages, schema.UserMessage(b.String()))
+		}
+
+		start := time.Now()
+		tools, err := s.chatService.toolsForServers(ctx, exec.userID, exec.run.ConversationID, step.Tools)
+		if err != nil {
+			return "", fmt.Errorf("step %s failed: %w", step.Name, err)
+		}
+		content, result, messages, err := s.chatService.generate(ctx, exec.gen, tools, messages, exec.maxOutputTokens)
+		stepRun := model.WorkflowStepRun{
+			RunID:      exec.run.ID,
+			Name:       step.Name,
+			Agent:      step.Agent,
+			Output:     content,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			stepRun.Error = truncateRunes(err.Error(), 255)
+		} else {
+			usage := s.chatService.generationUsage(result, messages, content)
+			stepRun.Tokens = usage.TotalTokens
+			exec.complete(step, usage, content)
+		}
+		if dbErr := s.db.Create(&stepRun).Error; dbErr != nil && err == nil {
+			err = dbErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("step %s failed: %w", step.Name, err)
+		}
+		exec.stepDone(step.Name)
+		return content, nil
+	}
+}
+
+func (e *workflowExecution) isStopped() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stopped
+}
+
+// complete 累计步骤用量并检查停止条件，先触发的步骤输出作为最终答案
+func (e *workflowExecution) complete(step WorkflowStep, usage StreamUsage, output string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.usage.add(usage)
+	if e.stopped {
+		return
+	}
+	matched := step.StopOn != "" && strings.Contains(strings.ToLower(output), strings.ToLower(step.StopOn))
+	if matched || (e.def.Stop.MaxTokens > 0 && e.usage.TotalTokens >= e.def.Stop.MaxTokens) {
+		e.stopped = true
+		e.stopOutput = output
+	}
+}
+
+// totalUsage 已完成步骤的累计用量
+func (e *workflowExecution) totalUsage() StreamUsage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.usage
+}
+
+func (e *workflowExecution) stepDone(step string) {
+	e.mu.Lock()
+	e.done++
+	done := e.done
+	e.mu.Unlock()
+	if e.onStep != nil {
+		e.onStep(step, done)
+	}
+}
+
+// chargeFailed 执行失败时按已完成步骤的用量计费，没有助手消息时计入用户消息
+func (s *WorkflowService) chargeFailed(userID uint, exec *workflowExecution, userMessage *model.Message) {
+	usage := exec.totalUsage()
+	if usage.TotalTokens <= 0 {
+		return
+	}
+	s.chatService.recordGeneration(userID, exec.gen, usage, userMessage)
+}
+
+// finish 更新执行记录的最终状态
+func (s *WorkflowService) finish(run *model.WorkflowRun, exec *workflowExecution, output string, err error) {
+	now := time.Now()
+	run.Status = model.WorkflowStatusCompleted
+	run.Output = output
+	run.TotalTokens = exec.totalUsage().TotalTokens
+	run.FinishedAt = &now
+	if err != nil {
+		run.Status = model.WorkflowStatusFailed
+		run.Error = truncateRunes(err.Error(), 255)
+	}
+	if err := s.db.Model(run).Select("status", "output", "error", "message_id", "total_tokens", "finished_at").Updates(run).Error; err != nil {
+		log.Printf("Failed to update workflow run %d: %v", run.ID, err)
+	}
+	if err := s.db.Where("run_id = ?", run.ID).Order("id").Find(&run.Steps).Error; err != nil {
+		log.Printf("Failed to load steps of workflow run %d: %v", run.ID, err)
+	}
+}
+
+// GetRun 获取执行记录及各步骤输出
+func (s *WorkflowService) GetRun(userID, conversationID, runID uint) (*model.WorkflowRun, error) {
+	var run model.WorkflowRun
+	err := s.db.Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ? AND conversation_id = ? AND user_id = ?", runID, conversationID, userID).First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWorkflowRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListRuns 获取会话的执行记录，不含步骤输出
+func (s *WorkflowService) ListRuns(userID, conversationID uint, page, pageSize int) ([]model.WorkflowRun, int64, error) {
+	query := s.db.Model(&model.WorkflowRun{}).Where("conversation_id = ? AND user_id = ?", conversationID, userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []model.WorkflowRun
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// ListWorkflows 获取用户保存的工作流
+func (s *WorkflowService) ListWorkflows(userID uint, page, pageSize int) ([]SavedWorkflow, int64, error) {
+	query := s.db.Model(&model.Workflow{}).Where("user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var workflows []model.Workflow
+	offset := (page - 1) * pageSize
+	if err := query.Order("updated_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&workflows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	saved := make([]SavedWorkflow, len(workflows))
+	for i := range workflows {
+		saved[i] = savedWorkflow(&workflows[i])
+	}
+	return saved, total, nil
+}
+
+// GetWorkflow 获取用户保存的工作流
+func (s *WorkflowService) GetWorkflow(userID, workflowID uint) (*SavedWorkflow, error) {
+	workflow, err := s.ownedWorkflow(userID, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	saved := savedWorkflow(workflow)
+	return &saved, nil
+}
+
+// CreateWorkflow 校验并保存工作流，保存的是补全默认值后的定义
+func (s *WorkflowService) CreateWorkflow(userID uint, req *SaveWorkflowRequest) (*SavedWorkflow, error) {
+	def, err := s.validateDefinition(&req.WorkflowDefinition)
+	if err != nil {
+		return nil, err
+	}
+	definition, _ := json.Marshal(def)
+	workflow := &model.Workflow{
+		UserID:      userID,
+		Name:        req.Name,
+		Description: req.Description,
+		Definition:  string(definition),
+	}
+	if err := s.db.Create(workflow).Error; err != nil {
+		return nil, err
+	}
+	s.onboarding.complete(userID, OnboardingAssistantCreated)
+	return &SavedWorkflow{Workflow: workflow, WorkflowDefinition: *def}, nil
+}
+
+// UpdateWorkflow 替换工作流的名称、描述和定义，已有的执行记录不受影响
+func (s *WorkflowService) UpdateWorkflow(userID, workflowID uint, req *SaveWorkflowRequest) (*SavedWorkflow, error) {
+	workflow, err := s.ownedWorkflow(userID, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	def, err := s.validateDefinition(&req.WorkflowDefinition)
+	if err != nil {
+		return nil, err
+	}
+	definition, _ := json.Marshal(def)
+	workflow.Name = req.Name
+	workflow.Description = req.Description
+	workflow.Definition = string(definition)
+	if err := s.db.Model(workflow).Select("name", "description", "definition").Updates(workflow).Error; err != nil {
+		return nil, err
+	}
+	return &SavedWorkflow{Workflow: workflow, WorkflowDefinition: *def}, nil
+}
+
+// DeleteWorkflow 删除保存的工作流，执行记录保留
+func (s *WorkflowService) DeleteWorkflow(userID, workflowID uint) error {
+	result := s.db.Where("id = ? AND user_id = ?", workflowID, userID).Delete(&model.Workflow{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWorkflowNotFound
+	}
+	return nil
+}
+
+// RunWorkflow 在会话中异步执行保存的工作流，返回后台任务。每完成一个步骤更新任务进度，
+// 任务结果为执行记录和助手消息的ID
+func (s *WorkflowService) RunWorkflow(userID, workflowID uint, req *RunSavedWorkflowRequest) (*model.Job, error) {
+	workflow, err := s.ownedWorkflow(userID, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	saved := savedWorkflow(workflow)
+	// 工作流保存后引用的服务或角色可能已变化，执行前重新校验
+	def, err := s.validateDefinition(&saved.WorkflowDefinition)
+	if err != nil {
+		return nil, err
+	}
+	conversation, err := s.workflowConversation(userID, req.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.chatService.checkMessageLength(userID, conversation, "", req.Content); err != nil {
+		return nil, err
+	}
+
+	return s.jobService.Enqueue(userID, workflowRunJobType, func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		progress(0, "started")
+		onStep := func(step string, done int) {
+			progress(done*workflowStepsProgress/len(def.Steps), fmt.Sprintf("step %s finished", step))
+		}
+		run, _, assistantMessage, err := s.run(ctx, userID, conversation, &workflow.ID, def, req.Content, onStep)
+		if err != nil {
+			if run != nil {
+				return nil, fmt.Errorf("workflow run %d failed: %w", run.ID, err)
+			}
+			return nil, err
+		}
+		return WorkflowRunResult{RunID: run.ID, AssistantMessageID: assistantMessage.ID}, nil
+	})
+}
+
+func (s *WorkflowService) ownedWorkflow(userID, workflowID uint) (*model.Workflow, error) {
+	var workflow model.Workflow
+	err := s.db.Where("id = ? AND user_id = ?", workflowID, userID).First(&workflow).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// savedWorkflow 解析保存的定义，定义由服务写入，解析失败时仅记录日志
+func savedWorkflow(workflow *model.Workflow) SavedWorkflow {
+	saved := SavedWorkflow{Workflow: workflow}
+	if err := json.Unmarshal([]byte(workflow.Definition), &saved.WorkflowDefinition); err != nil {
+		log.Printf("Failed to parse definition of workflow %d: %v", workflow.ID, err)
+	}
+	return saved
+}
@@ -0,0 +1,154 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	slackAPIBase = "https://slack.com/api"
+	// signatureTolerance 请求签名时间戳允许的最大偏差，防止重放
+	signatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid slack signature")
+
+// Client Slack Web API的最小封装，只包含发送/更新消息和事件验签
+type Client struct {
+	botToken   string
+	httpClient *http.Client
+}
+
+func NewClient(botToken string) *Client {
+	return &Client{
+		botToken:   botToken,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Envelope Events API推送的请求体
+type Envelope struct {
+	Type      string       `json:"type"` // url_verification / event_callback
+	Challenge string       `json:"challenge"`
+	TeamID    string       `json:"team_id"`
+	EventID   string       `json:"event_id"`
+	Event     MessageEvent `json:"event"`
+}
+
+// MessageEvent 频道消息事件，只解析桥接需要的字段
+type MessageEvent struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype"`
+	Channel  string `json:"channel"`
+	User     string `json:"user"`
+	BotID    string `json:"bot_id"`
+	Text     string `json:"text"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts"`
+}
+
+// PostMessage 发送消息，threadTS非空时回复到该消息串，返回新消息的ts
+func (c *Client) PostMessage(ctx context.Context, channel, text, threadTS string) (string, error) {
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	params := map[string]string{
+		"channel": channel,
+		"text":    text,
+	}
+	if threadTS != "" {
+		params["thread_ts"] = threadTS
+	}
+	err := c.call(ctx, "chat.postMessage", params, &resp)
+	return resp.TS, err
+}
+
+// UpdateMessage 更新已发送的消息
+func (c *Client) UpdateMessage(ctx context.Context, channel, ts, text string) error {
+	return c.call(ctx, "chat.update", map[string]string{
+		"channel": channel,
+		"ts":      ts,
+		"text":    text,
+	}, nil)
+}
+
+func (c *Client) call(ctx context.Context, method string, params map[string]string, out interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slackAPIBase+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.botToken)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Slack Web API出错时仍返回200，通过ok字段判断
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("slack error (%d): %w", resp.StatusCode, err)
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("slack error: %s", result.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// VerifySignature 校验X-Slack-Signature头，签名为 v0=HMAC-SHA256(secret, "v0:" + timestamp + ":" + body)
+func VerifySignature(payload []byte, timestamp, signature, secret string) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(payload)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ParseEnvelope 校验签名并解析事件
+func ParseEnvelope(payload []byte, timestamp, signature, secret string) (*Envelope, error) {
+	if err := VerifySignature(payload, timestamp, signature, secret); err != nil {
+		return nil, err
+	}
+	var envelope Envelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
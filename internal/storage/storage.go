@@ -0,0 +1,138 @@
+// Package storage 对象存储，用于保存归档等较大且很少读取的数据
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ai-chat-backend/internal/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// Store 按key读写对象，key以"/"分隔层级
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+}
+
+// Signer 可生成限时下载地址的存储，客户端凭地址直接从存储下载，不经过API服务
+type Signer interface {
+	SignedURL(key string, ttl time.Duration, opts DownloadOptions) (string, error)
+}
+
+// DownloadOptions 下载时存储返回的响应头
+type DownloadOptions struct {
+	// ContentType 为空时使用对象保存时的类型
+	ContentType string
+	// Disposition inline或attachment，为空时不设置
+	Disposition string
+	// Filename attachment时建议的文件名
+	Filename string
+}
+
+// contentDisposition 构造Content-Disposition响应头
+func (o DownloadOptions) contentDisposition() string {
+	if o.Disposition == "" {
+		return ""
+	}
+	if o.Filename == "" {
+		return o.Disposition
+	}
+	return fmt.Sprintf("%s; filename=%q", o.Disposition, o.Filename)
+}
+
+// SignedDownload 存储支持限时下载地址且配置了有效期时生成地址，返回空字符串表示需由API服务读取后返回。
+// opts.Disposition为空时使用配置的Content-Disposition
+func SignedDownload(store Store, cfg config.StorageConfig, key string, opts DownloadOptions) (string, error) {
+	signer, ok := store.(Signer)
+	if !ok || cfg.SignedURLTTL <= 0 {
+		return "", nil
+	}
+	if opts.Disposition == "" {
+		opts.Disposition = cfg.ContentDisposition
+	}
+	return signer.SignedURL(key, cfg.SignedURLTTL, opts)
+}
+
+// New 按配置创建对象存储，未配置时返回nil
+func New(cfg config.StorageConfig) (Store, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "fs":
+		return NewFileStore(cfg.Dir), nil
+	case "s3":
+		if cfg.S3Bucket == "" {
+			return nil, errors.New("S3_BUCKET is required for the s3 storage backend")
+		}
+		store := NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+		store.publicEndpoint = strings.TrimRight(cfg.S3PublicEndpoint, "/")
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+}
+
+// FileStore 以本地目录保存对象，适合单实例部署或挂载共享存储。不支持限时下载地址，对象由API服务读取后返回
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，读取时不会读到不完整的对象
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
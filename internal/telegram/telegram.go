@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const telegramAPIBase = "https://api.telegram.org"
+
+// Client Telegram Bot API的最小封装，只包含发送和编辑消息
+type Client struct {
+	botToken   string
+	httpClient *http.Client
+}
+
+func NewClient(botToken string) *Client {
+	return &Client{
+		botToken:   botToken,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Update webhook推送的更新，只解析文本消息
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	Text      string `json:"text"`
+	Chat      struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"` // private / group / supergroup / channel
+	} `json:"chat"`
+	From *struct {
+		ID    int64 `json:"id"`
+		IsBot bool  `json:"is_bot"`
+	} `json:"from"`
+}
+
+// SendMessage 发送文本消息，返回消息ID
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) (int64, error) {
+	var message Message
+	err := c.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}, &message)
+	return message.MessageID, err
+}
+
+// EditMessageText 编辑已发送的消息
+func (c *Client) EditMessageText(ctx context.Context, chatID, messageID int64, text string) error {
+	return c.call(ctx, "editMessageText", map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}, nil)
+}
+
+func (c *Client) call(ctx context.Context, method string, params map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/bot%s/%s", telegramAPIBase, c.botToken, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// 错误信息中的URL包含token，不原样返回
+		return fmt.Errorf("telegram %s request failed", method)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram error (%d): %w", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram error (%d): %s", resp.StatusCode, result.Description)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, out)
+}
@@ -0,0 +1,142 @@
+// Package tokenizer 估算文本和对话消息的token数，规则参照OpenAI cl100k/o200k等BPE分词器的切分方式：
+// 先把文本切成单词、数字、标点、空白和中日韩文字等片段，再按各类片段的平均长度估算。
+// 不依赖具体模型的词表，结果略偏保守，用于裁剪上下文和在模型未返回用量时估算用量
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// MessageOverhead 每条消息除内容外的格式开销（角色、分隔标记）
+	MessageOverhead = 3
+	// ReplyOverhead 每次请求为回复预置的开销
+	ReplyOverhead = 3
+)
+
+// 片段类型
+const (
+	classNone = iota
+	classLetter
+	classDigit
+	classSpace
+	classPunct
+	classCJK
+	classOther
+)
+
+// 各类片段平均每个token对应的长度
+const (
+	bytesPerLetterToken = 5 // 英文等字母文字按UTF-8字节数，常见单词为1个token
+	digitsPerToken      = 3 // 数字每1-3位切为一个token
+	punctsPerToken      = 2 // 连续的ASCII标点（如"..."、"```"）常合并
+)
+
+// Count 估算文本的token数
+func Count(text string) int {
+	total := 0
+	class, length := classNone, 0
+	var next rune
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		next = 0
+		if i < len(text) {
+			next, _ = utf8.DecodeRuneInString(text[i:])
+		}
+
+		c := classify(r)
+		if c != class || c == classOther {
+			total += pieceTokens(class, length)
+			class, length = c, 0
+		}
+		switch c {
+		case classLetter:
+			length += size
+		case classSpace:
+			// 单个空格与之后的单词合为一个token
+			if length == 0 && r == ' ' && classify(next) == classLetter {
+				class = classNone
+				continue
+			}
+			length++
+		case classOther:
+			length = size
+		default:
+			length++
+		}
+	}
+	return total + pieceTokens(class, length)
+}
+
+// CountMessages 估算一次请求中全部消息的token数，含格式开销和工具调用的名称与参数
+func CountMessages(messages []*schema.Message) int {
+	total := ReplyOverhead
+	for _, msg := range messages {
+		total += CountMessage(msg)
+	}
+	return total
+}
+
+// CountMessage 估算单条消息的token数，含格式开销
+func CountMessage(msg *schema.Message) int {
+	total := MessageOverhead + Count(msg.Content)
+	for _, call := range msg.ToolCalls {
+		total += Count(call.Function.Name) + Count(call.Function.Arguments)
+	}
+	return total
+}
+
+func classify(r rune) int {
+	switch {
+	case r == 0:
+		return classNone
+	case r < utf8.RuneSelf && (r == '\'' || unicode.IsLetter(r)):
+		return classLetter
+	case r < utf8.RuneSelf && unicode.IsDigit(r):
+		return classDigit
+	case unicode.IsSpace(r):
+		return classSpace
+	case r < utf8.RuneSelf:
+		return classPunct
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+		return classCJK
+	case unicode.IsLetter(r) || unicode.IsMark(r):
+		return classLetter
+	case unicode.IsDigit(r):
+		return classDigit
+	default:
+		return classOther
+	}
+}
+
+// pieceTokens 一个片段的token数，length对字母文字和其他符号为字节数，其余为字符数
+func pieceTokens(class, length int) int {
+	if length == 0 {
+		return 0
+	}
+	switch class {
+	case classLetter:
+		return ceilDiv(length, bytesPerLetterToken)
+	case classDigit:
+		return ceilDiv(length, digitsPerToken)
+	case classSpace:
+		// 连续空白（缩进、换行）通常合为一个token
+		return 1
+	case classPunct:
+		return ceilDiv(length, punctsPerToken)
+	case classCJK:
+		// 常用汉字多为1个token，生僻字为2-3个，平均按4/3估算
+		return ceilDiv(length*4, 3)
+	default:
+		// 全角标点约1个token，emoji等符号按UTF-8字节切分为1-3个
+		return ceilDiv(length, 3)
+	}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
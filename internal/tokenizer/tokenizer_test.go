@@ -0,0 +1,51 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{name: "empty", text: "", want: 0},
+		{name: "single word", text: "hello", want: 1},
+		{name: "space joins the next word", text: "hello world", want: 2},
+		{name: "long word split by bytes", text: "internationalization", want: 4},
+		{name: "digits in groups of three", text: "1234567", want: 3},
+		{name: "ascii punctuation", text: "Hello, world!", want: 4},
+		{name: "cjk", text: "你好世界", want: 6},
+		{name: "cjk with full-width punctuation", text: "你好，世界。", want: 8},
+		{name: "mixed ascii and cjk", text: "Hello, 世界!", want: 7},
+		{name: "code", text: "func main() {}", want: 5},
+		{name: "code fence and indentation", text: "```go\n    return nil\n```", want: 10},
+		{name: "whitespace run", text: "\n\n    ", want: 1},
+		{name: "emoji", text: "😀", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Count(tt.text); got != tt.want {
+				t.Fatalf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountMessages(t *testing.T) {
+	messages := []*schema.Message{
+		schema.SystemMessage("hello"),
+		schema.UserMessage("你好世界"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{Function: schema.FunctionCall{Name: "search", Arguments: `{"q":"go"}`}}}},
+	}
+	want := ReplyOverhead + (MessageOverhead + 1) + (MessageOverhead + 6) + (MessageOverhead + Count("search") + Count(`{"q":"go"}`))
+	if got := CountMessages(messages); got != want {
+		t.Fatalf("CountMessages() = %d, want %d", got, want)
+	}
+	if got := CountMessages(nil); got != ReplyOverhead {
+		t.Fatalf("CountMessages(nil) = %d, want %d", got, ReplyOverhead)
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func BenchmarkChunkEventData(b *testing.B) {
+	chunk := `Here is some "quoted" output, 带中文和换行` + "\n"
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ChunkEventData(chunk)
+	}
+}
+
+func BenchmarkChunkCoalescer(b *testing.B) {
+	chunks := strings.Fields(strings.Repeat("token stream with ```code``` and sentences. ", 40))
+	emit := func(string) error { return nil }
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := NewChunkCoalescer(0, emit)
+		for _, chunk := range chunks[:200] {
+			c.Write(chunk + " ")
+		}
+		c.Flush()
+	}
+}
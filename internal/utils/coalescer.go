@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// coalescerMaxBuffer 缓冲超过该字节数时无论边界都强制刷新，避免长时间无输出
+const coalescerMaxBuffer = 512
+
+// coalescerMaxWait 距上次推送超过该时间（且不短于合并间隔）时由定时器强制刷新，
+// 避免模型输出缓慢时内容停在缓冲中等不到下一个边界
+const coalescerMaxWait = 250 * time.Millisecond
+
+// ChunkCoalescer 将模型增量输出合并到词/句边界后再发送，减少SSE事件数量，
+// 并避免在代码块围栏（```）中间截断导致客户端渲染闪烁。
+// 定时刷新在独立的goroutine中调用emit，调用方发送其他事件前需先调用Flush
+type ChunkCoalescer struct {
+	mu        sync.Mutex
+	buf       strings.Builder
+	interval  time.Duration
+	lastFlush time.Time
+	inFence   bool
+	emit      func(string) error
+
+	timer *time.Timer
+	// err 定时刷新的发送错误，由下一次Write或Flush返回
+	err error
+}
+
+func NewChunkCoalescer(interval time.Duration, emit func(string) error) *ChunkCoalescer {
+	return &ChunkCoalescer{
+		interval:  interval,
+		lastFlush: time.Now(),
+		emit:      emit,
+	}
+}
+
+// Write 写入一个增量片段，满足刷新条件时发送缓冲内容
+func (c *ChunkCoalescer) Write(chunk string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.buf.WriteString(chunk)
+	if c.buf.Len() >= coalescerMaxBuffer {
+		return c.flushSafeLocked()
+	}
+	if time.Since(c.lastFlush) >= c.interval && c.atBoundary() {
+		return c.flushLocked(c.buf.Len())
+	}
+	c.armLocked()
+	return nil
+}
+
+// Flush 发送剩余的缓冲内容，流结束时调用
+func (c *ChunkCoalescer) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.err != nil {
+		return c.err
+	}
+	return c.flushLocked(c.buf.Len())
+}
+
+// armLocked 缓冲中有内容时启动定时刷新
+func (c *ChunkCoalescer) armLocked() {
+	if c.timer != nil || c.buf.Len() == 0 {
+		return
+	}
+	wait := c.interval
+	if wait < coalescerMaxWait {
+		wait = coalescerMaxWait
+	}
+	delay := wait - time.Since(c.lastFlush)
+	// 上次定时刷新只剩围栏标记没有发送时，等待下一轮而不是立即重试
+	if delay <= 0 {
+		delay = wait
+	}
+	c.timer = time.AfterFunc(delay, c.onTimer)
+}
+
+func (c *ChunkCoalescer) onTimer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timer = nil
+	if c.err != nil {
+		return
+	}
+	c.err = c.flushSafeLocked()
+}
+
+// flushSafeLocked 不等边界强制刷新，但保留末尾的反引号，避免把围栏标记拆到两次推送中
+func (c *ChunkCoalescer) flushSafeLocked() error {
+	data := c.buf.String()
+	n := len(strings.TrimRight(data, "`"))
+	if err := c.flushLocked(n); err != nil {
+		return err
+	}
+	c.armLocked()
+	return nil
+}
+
+// flushLocked 发送缓冲中的前n个字节，其余内容留在缓冲中
+func (c *ChunkCoalescer) flushLocked(n int) error {
+	if n == 0 {
+		return nil
+	}
+	data := c.buf.String()
+	rest := data[n:]
+	data = data[:n]
+	c.buf.Reset()
+	c.buf.WriteString(rest)
+	c.lastFlush = time.Now()
+	if strings.Count(data, "```")%2 == 1 {
+		c.inFence = !c.inFence
+	}
+	return c.emit(data)
+}
+
+// atBoundary 判断当前缓冲是否停在合适的刷新位置
+func (c *ChunkCoalescer) atBoundary() bool {
+	data := c.buf.String()
+	// 不在未闭合的围栏标记中间刷新
+	if strings.HasSuffix(data, "`") {
+		return false
+	}
+
+	inFence := c.inFence
+	if strings.Count(data, "```")%2 == 1 {
+		inFence = !inFence
+	}
+	// 代码块内只在整行结束时刷新
+	if inFence {
+		return strings.HasSuffix(data, "\n")
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(data)
+	if unicode.IsSpace(r) {
+		return true
+	}
+	return strings.ContainsRune(".,;:!?。，；：！？、", r)
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type emitRecorder struct {
+	mu     sync.Mutex
+	chunks []string
+	ch     chan string
+}
+
+func newEmitRecorder() *emitRecorder {
+	return &emitRecorder{ch: make(chan string, 16)}
+}
+
+func (r *emitRecorder) emit(chunk string) error {
+	r.mu.Lock()
+	r.chunks = append(r.chunks, chunk)
+	r.mu.Unlock()
+	r.ch <- chunk
+	return nil
+}
+
+func (r *emitRecorder) all() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.chunks...)
+}
+
+func TestChunkCoalescerDoesNotSplitFence(t *testing.T) {
+	filler := strings.Repeat("a", coalescerMaxBuffer-2)
+	tests := []struct {
+		name   string
+		chunks []string
+	}{
+		{name: "marker across size limit", chunks: []string{filler, "``", "`go\n", "x := 1\n", "```\n"}},
+		{name: "marker at size limit", chunks: []string{filler + "```", "go\n", "```\n"}},
+		{name: "plain text", chunks: []string{"hello ", "world."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newEmitRecorder()
+			c := NewChunkCoalescer(time.Hour, r.emit)
+			for _, chunk := range tt.chunks {
+				if err := c.Write(chunk); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+
+			emitted := r.all()
+			if got, want := strings.Join(emitted, ""), strings.Join(tt.chunks, ""); got != want {
+				t.Fatalf("emitted %q, want %q", got, want)
+			}
+			for i := 0; i+1 < len(emitted); i++ {
+				if strings.HasSuffix(emitted[i], "`") && strings.HasPrefix(emitted[i+1], "`") {
+					t.Errorf("fence marker split between %q and %q", emitted[i], emitted[i+1])
+				}
+			}
+		})
+	}
+}
+
+func TestChunkCoalescerFlushesOnTimer(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk string
+		want  string
+	}{
+		{name: "mid word", chunk: "hel", want: "hel"},
+		{name: "holds back partial fence", chunk: "code ``", want: "code "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newEmitRecorder()
+			c := NewChunkCoalescer(10*time.Millisecond, r.emit)
+			if err := c.Write(tt.chunk); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			select {
+			case got := <-r.ch:
+				if got != tt.want {
+					t.Errorf("timer flushed %q, want %q", got, tt.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("buffered chunk was not flushed by the timer")
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+		})
+	}
+}
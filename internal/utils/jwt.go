@@ -9,6 +9,11 @@ import (
 
 type Claims struct {
 	UserID uint `json:"user_id"`
+	// Guest 访客token，只能访问会话相关接口并受免费消息额度限制
+	Guest bool `json:"guest,omitempty"`
+	// ImpersonatorID 管理员代入用户身份时签发token的管理员，ImpersonationID为对应的代入会话
+	ImpersonatorID  uint `json:"impersonator_id,omitempty"`
+	ImpersonationID uint `json:"impersonation_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -27,6 +32,39 @@ func GenerateJWT(userID uint, secret string, expiration time.Duration) (string,
 	return token.SignedString([]byte(secret))
 }
 
+// GenerateGuestJWT 生成访客token
+func GenerateGuestJWT(userID uint, secret string, expiration time.Duration) (string, error) {
+	claims := Claims{
+		UserID: userID,
+		Guest:  true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// GenerateImpersonationJWT 生成管理员代入用户身份的token，有效期为代入会话的剩余时间
+func GenerateImpersonationJWT(userID, adminID, impersonationID uint, secret string, expiration time.Duration) (string, error) {
+	claims := Claims{
+		UserID:          userID,
+		ImpersonatorID:  adminID,
+		ImpersonationID: impersonationID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
 // ValidateJWT 验证JWT token
 func ValidateJWT(tokenString, secret string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
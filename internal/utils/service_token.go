@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ServiceTokenAudience 服务间调用token的受众，避免与用户JWT混用
+const ServiceTokenAudience = "ai-chat-backend/internal"
+
+var ErrUnknownService = errors.New("unknown service")
+
+// GenerateServiceToken 生成服务间调用token，由调用方使用自己的密钥签名，issuer为服务名
+func GenerateServiceToken(service, secret string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    service,
+		Audience:  jwt.ClaimStrings{ServiceTokenAudience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ValidateServiceToken 按issuer查找服务密钥并验证token，返回服务名。
+// 有效期超过maxAge的token一律拒绝，防止调用方签发长期token
+func ValidateServiceToken(tokenString string, secretFor func(service string) (string, bool), maxAge time.Duration) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		service, err := token.Claims.GetIssuer()
+		if err != nil {
+			return nil, err
+		}
+		secret, ok := secretFor(service)
+		if !ok {
+			return nil, ErrUnknownService
+		}
+		return []byte(secret), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(ServiceTokenAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return "", err
+	}
+	if !token.Valid || claims.IssuedAt == nil {
+		return "", errors.New("invalid token")
+	}
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) > maxAge {
+		return "", errors.New("token lifetime too long")
+	}
+
+	return claims.Issuer, nil
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"encoding/json"
+)
+
+// ChunkEventData 构造流式输出chunk事件的data，内容按JSON字符串转义
+func ChunkEventData(content string) []byte {
+	contentBytes, _ := json.Marshal(content)
+	data := make([]byte, 0, len(contentBytes)+32)
+	data = append(data, `{"type": "chunk", "content": `...)
+	data = append(data, contentBytes...)
+	data = append(data, '}')
+	return data
+}
@@ -1,56 +1,387 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"log"
+	"os"
 	"time"
 
+	"ai-chat-backend/internal/backup"
 	"ai-chat-backend/internal/config"
 	"ai-chat-backend/internal/database"
+	"ai-chat-backend/internal/diagnostics"
+	"ai-chat-backend/internal/events"
 	"ai-chat-backend/internal/handler"
+	"ai-chat-backend/internal/mail"
+	"ai-chat-backend/internal/metrics"
 	"ai-chat-backend/internal/middleware"
+	"ai-chat-backend/internal/secrets"
 	"ai-chat-backend/internal/service"
+	"ai-chat-backend/internal/storage"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
 	// 初始化配置
 	cfg := config.Load()
 
-	// 初始化数据库
-	db, err := database.Init(cfg.Database.DSN)
+	// 从Vault加载密钥（可选），写入环境变量后重新加载配置
+	var secretsManager *secrets.Manager
+	if cfg.Secrets.VaultAddr != "" {
+		source := secrets.NewVaultSource(cfg.Secrets.VaultAddr, cfg.Secrets.VaultPath, cfg.Secrets.VaultToken, cfg.Secrets.VaultTokenFile, cfg.Secrets.VaultNamespace)
+		secretsManager = secrets.NewManager(source, 10*time.Second)
+		if err := secretsManager.Load(); err != nil {
+			log.Fatal("Failed to load secrets from vault:", err)
+		}
+		cfg = config.Load()
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+
+	// 初始化数据库。Vault定期刷新时，新建连接使用轮换后DATABASE_DSN中的密码
+	var currentDSN func() string
+	if secretsManager != nil && cfg.Secrets.RefreshInterval > 0 {
+		currentDSN = func() string { return secretsManager.Value("DATABASE_DSN") }
+	}
+	db, err := database.Init(cfg.Database, currentDSN)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// 子命令（backup/restore）执行后退出，不启动服务
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, db, os.Args[1:]))
+	}
+
+	// 初始化Redis（可选）
+	var rdb *redis.Client
+	if cfg.Redis.Addr != "" {
+		rdb, err = database.InitRedis(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
+		if err != nil {
+			log.Fatal("Failed to connect to redis:", err)
+		}
+	}
+
 	// 初始化AI服务
 	aiService, err := service.NewAIService(cfg)
 	if err != nil {
 		log.Fatal("Failed to initialize AI service:", err)
 	}
 
+	// 定期刷新密钥。JWT、数据库密码、SMTP密码在下次使用时读取，轮换后自动生效；
+	// 模型服务Key、Stripe密钥需替换客户端，其余密钥只在启动时读取，轮换后需重启
+	if secretsManager != nil {
+		secretsManager.ReadOnUse("JWT_PREVIOUS_SECRET", "DATABASE_DSN", "SMTP_PASSWORD")
+		// JWT密钥轮换后保留旧密钥，已签发的token在过期前仍然有效
+		secretsManager.OnChange("JWT_SECRET", func(oldValue, newValue string) {
+			os.Setenv("JWT_PREVIOUS_SECRET", oldValue)
+		})
+		secretsManager.OnChange("AI_API_KEY", func(oldValue, newValue string) {
+			if err := aiService.SetAPIKey(newValue); err != nil {
+				log.Printf("Failed to rotate AI API key: %v", err)
+			}
+		})
+		stopSecrets := secretsManager.Start(cfg.Secrets.RefreshInterval)
+		defer stopSecrets()
+	}
+
+	// 初始化套餐
+	planService := service.NewPlanService(db)
+	if err := planService.EnsureDefaults(); err != nil {
+		log.Fatal("Failed to initialize plans:", err)
+	}
+
+	// 初始化事件总线及订阅者
+	bus := events.NewMemoryBus()
+	defer bus.Close()
+
+	creditService := service.NewCreditService(db)
+	creditService.Subscribe(bus)
+
+	auditService := service.NewAuditService(db)
+	auditService.Subscribe(bus)
+	// 管理员代入用户身份排查问题，全程写入审计日志
+	impersonationService := service.NewImpersonationService(db, cfg, auditService)
+	activityService := service.NewActivityService(db)
+	activityService.Subscribe(bus)
+	// 新手引导清单，步骤完成时发布事件
+	onboardingService := service.NewOnboardingService(db, bus)
+	onboardingService.Subscribe(bus)
+
+	// 会话列表实时推送，配置Redis时跨实例转发
+	updateService := service.NewUpdateService(rdb)
+	updateService.Subscribe(bus)
+	stopUpdates := updateService.Start()
+	defer stopUpdates()
+
+	// 会话级webhook，AI回复完成后推送
+	webhookService := service.NewWebhookService(db)
+	webhookService.Subscribe(bus)
+
+	// Kafka分析事件（可选）
+	if len(cfg.Kafka.Brokers) > 0 {
+		kafkaSink := events.NewKafkaSink(cfg.Kafka.Brokers, cfg.Kafka.AnalyticsTopic)
+		kafkaSink.Subscribe(bus)
+		defer kafkaSink.Close()
+	}
+
 	// 初始化服务层
-	userService := service.NewUserService(db)
-	chatService := service.NewChatService(db, aiService)
+	// 一次性邮箱域名列表，加载失败时只记录日志，不影响启动
+	emailBlocklist := service.NewEmailBlocklist(db, cfg.Signup.DisposableDomains)
+	if err := emailBlocklist.Load(context.Background()); err != nil {
+		log.Printf("Failed to load disposable email domains: %v", err)
+	}
+	stopBlocklist := emailBlocklist.Start(cfg.Signup.DisposableRefresh)
+	defer stopBlocklist()
+	userService := service.NewUserService(db, mail.NewSender(cfg.Mail), emailBlocklist, bus)
+	consentService := service.NewConsentService(db)
+	apiKeyService, err := service.NewAPIKeyService(db, aiService, cfg.App.EncryptionKey)
+	if err != nil {
+		log.Fatal("Failed to initialize API key service:", err)
+	}
+	orgService, err := service.NewOrgService(db, aiService, cfg.App.EncryptionKey)
+	if err != nil {
+		log.Fatal("Failed to initialize organization service:", err)
+	}
+	// MCP工具，会话启用后供AI调用
+	toolService, err := service.NewToolService(db, cfg.App.EncryptionKey)
+	if err != nil {
+		log.Fatal("Failed to initialize tool service:", err)
+	}
+	toolService.Subscribe(bus)
+	// 日历工具，用户授权后供AI调用
+	calendarService, err := service.NewCalendarService(db, cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize calendar service:", err)
+	}
+	toolService.AddProvider(calendarService)
+	// 计算器、当前时间和网页搜索等内置工具
+	toolService.AddProvider(service.NewBuiltinToolService(db, cfg.Tools))
+	// 版本化的系统提示词和安全约束模板
+	promptService := service.NewPromptService(db)
+	chatService := service.NewChatService(db, rdb, aiService, planService, creditService, apiKeyService, orgService, toolService, promptService, bus)
+	// 首次登录时创建欢迎会话
+	userService.UseWelcome(chatService)
+	// 首token延迟SLO，滚动窗口内p95超标时告警
+	sloService := service.NewSLOService(cfg.SLO, bus)
+	sloService.Subscribe(bus)
+	chatService.UseSLO(sloService)
+	stopSLO := sloService.Start()
+	defer stopSLO()
+	// 新模型灰度发布，错误率或差评率超过阈值时自动回滚
+	canaryService := service.NewCanaryService(db, aiService, bus)
+	chatService.UseCanary(canaryService)
+	feedbackService := service.NewFeedbackService(db)
+	systemService := service.NewSystemService(cfg.Server.ReadOnly)
+	counterService := service.NewCounterService(db)
+
+	// 定期刷新灰度发布并检查回滚条件，只读模式下暂停
+	stopCanary := canaryService.Start(time.Minute, systemService.IsReadOnly)
+	defer stopCanary()
+
+	// 访客试用，定期删除过期未注册的访客，只读模式下暂停
+	guestService := service.NewGuestService(db, rdb, cfg.Guest)
+	stopGuests := guestService.Start(time.Hour, systemService.IsReadOnly)
+	defer stopGuests()
+
+	// 定期校正用户计数，只读模式下暂停
+	stopReconciler := counterService.Start(cfg.Chat.CounterReconcileInterval, systemService.IsReadOnly)
+	defer stopReconciler()
+
+	// 定期归档闲置会话，只读模式下暂停
+	archiveService := service.NewArchiveService(db, bus, cfg.Chat.AutoArchiveDays)
+	stopArchiver := archiveService.Start(cfg.Chat.AutoArchiveInterval, systemService.IsReadOnly)
+	defer stopArchiver()
+
+	// 定期将旧消息内容移入对象存储（可选），只读模式下暂停
+	objectStore, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal("Failed to initialize object storage:", err)
+	}
+	coldStorageService := service.NewColdStorageService(db, objectStore, cfg.Chat.ColdStorageDays)
+	coldStorageService.UseHistoryCache(chatService.HistoryCache())
+	stopColdStorage := coldStorageService.Start(cfg.Chat.ColdStorageInterval, systemService.IsReadOnly)
+	defer stopColdStorage()
+
+	// 会话分享链接，定期撤销过期、达到访问次数上限和闲置的链接，只读模式下暂停
+	shareService := service.NewShareService(db, coldStorageService, cfg.Share, cfg.App.FrontendURL)
+	shareService.Subscribe(bus)
+	stopShares := shareService.Start(systemService.IsReadOnly)
+	defer stopShares()
+
+	// 头像生成，图片保存在对象存储中
+	avatarService := service.NewAvatarService(db, aiService, userService, objectStore, cfg.Storage, cfg.Avatar)
+	exportService, err := service.NewExportService(db, coldStorageService, cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize export service:", err)
+	}
+	supportService := service.NewSupportService(db, exportService, mail.NewSender(cfg.Mail), bus)
+
+	// 计费（未配置Stripe时接口返回503），定期降级宽限期已过的订阅
+	billingService := service.NewBillingService(db, creditService, bus)
+	if secretsManager != nil {
+		secretsManager.OnChange("STRIPE_SECRET_KEY", func(oldValue, newValue string) {
+			billingService.SetStripeSecretKey(newValue)
+		})
+		secretsManager.OnChange("STRIPE_WEBHOOK_SECRET", func(oldValue, newValue string) {
+			billingService.SetWebhookSecret(newValue)
+		})
+	}
+	promoService := service.NewPromoService(db, bus)
+	syncService := service.NewSyncService(db)
+	slackService := service.NewSlackService(db, chatService)
+	telegramService := service.NewTelegramService(db, chatService)
+	diagnosticsService := service.NewDiagnosticsService(db, chatService, systemService)
+	mcpService := service.NewMCPService(chatService, systemService)
+	// 后台任务队列，进程退出时取消未完成的任务
+	jobService := service.NewJobService(db, cfg.Job.Workers, cfg.Job.QueueSize)
+	stopJobs := jobService.Start()
+	defer stopJobs()
+	// 上传的文件，配置ClamAV时扫描通过前保存在隔离区，定期重新扫描未完成的文件；随消息发送的图片识别其中的文字
+	extractor := service.NewExtractor(cfg.RAG)
+	attachmentService := service.NewAttachmentService(db, objectStore, cfg.Storage, cfg.Upload, jobService, extractor, bus)
+	stopRescan := attachmentService.Start(systemService.IsReadOnly)
+	defer stopRescan()
+	chatService.UseAttachments(attachmentService)
+	// 知识库：附件或网页加入知识库后由后台任务提取文本并分块，网页定期重新抓取，生成回复时对会话启用的知识库做关键词和向量混合检索
+	knowledgeService := service.NewKnowledgeService(db, attachmentService, planService, jobService, extractor, cfg.RAG)
+	knowledgeService.Subscribe(bus)
+	knowledgeService.UseOnboarding(onboardingService)
+	stopCrawl := knowledgeService.Start(systemService.IsReadOnly)
+	defer stopCrawl()
+	if err := chatService.UseKnowledge(knowledgeService); err != nil {
+		log.Fatal("Failed to build chat pipeline:", err)
+	}
+	workflowService := service.NewWorkflowService(db, chatService, jobService)
+	workflowService.Subscribe(bus)
+	workflowService.UseOnboarding(onboardingService)
+	evalService := service.NewEvalService(db, aiService, promptService, jobService)
+
+	// pprof（可选，独立监听本机地址）
+	if cfg.Server.PprofAddr != "" {
+		if _, err := diagnostics.StartPprof(cfg.Server.PprofAddr); err != nil {
+			log.Fatal("Failed to start pprof server:", err)
+		}
+	}
+	// Prometheus指标（可选，独立监听内网地址，不在对外的服务地址上开放）
+	if cfg.Server.MetricsEnabled {
+		if _, err := diagnostics.StartMetrics(cfg.Server.MetricsAddr); err != nil {
+			log.Fatal("Failed to start metrics server:", err)
+		}
+	}
+	stopGraceChecker := billingService.Start(time.Hour, systemService.IsReadOnly)
+	defer stopGraceChecker()
+
+	// 定时备份（可选），多实例部署时只需在一个实例上开启
+	stopBackups := backup.NewScheduler(db, cfg.Backup).Start(cfg.Backup.Interval)
+	defer stopBackups()
 
 	// 初始化处理器
-	userHandler := handler.NewUserHandler(userService)
-	chatHandler := handler.NewChatHandler(chatService)
+	userHandler := handler.NewUserHandler(userService, consentService)
+	guestHandler := handler.NewGuestHandler(guestService, consentService)
+	avatarHandler := handler.NewAvatarHandler(avatarService)
+	emailDomainHandler := handler.NewEmailDomainHandler(emailBlocklist)
+	chatHandler := handler.NewChatHandler(chatService, guestService)
+	coldStorageHandler := handler.NewColdStorageHandler(coldStorageService)
+	exportHandler := handler.NewExportHandler(exportService, cfg.App.FrontendURL)
+	calendarHandler := handler.NewCalendarHandler(calendarService, cfg.App.FrontendURL)
+	supportHandler := handler.NewSupportHandler(supportService)
+	feedbackHandler := handler.NewFeedbackHandler(feedbackService)
+	canaryHandler := handler.NewCanaryHandler(canaryService)
+	activityHandler := handler.NewActivityHandler(activityService)
+	onboardingHandler := handler.NewOnboardingHandler(onboardingService)
+	planHandler := handler.NewPlanHandler(planService)
+	billingHandler := handler.NewBillingHandler(billingService)
+	promoHandler := handler.NewPromoHandler(promoService)
+	creditHandler := handler.NewCreditHandler(creditService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	orgHandler := handler.NewOrgHandler(orgService)
+	syncHandler := handler.NewSyncHandler(syncService)
+	updateHandler := handler.NewUpdateHandler(updateService)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+	shareHandler := handler.NewShareHandler(shareService)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService, cfg.Upload.MaxSize)
+	knowledgeHandler := handler.NewKnowledgeHandler(knowledgeService)
+	toolHandler := handler.NewToolHandler(toolService)
+	mcpHandler := handler.NewMCPHandler(mcpService)
+	workflowHandler := handler.NewWorkflowHandler(workflowService)
+	promptHandler := handler.NewPromptHandler(promptService)
+	jobHandler := handler.NewJobHandler(jobService)
+	evalHandler := handler.NewEvalHandler(evalService)
+	slackHandler := handler.NewSlackHandler(slackService)
+	telegramHandler := handler.NewTelegramHandler(telegramService)
+	impersonationHandler := handler.NewImpersonationHandler(impersonationService)
+	adminHandler := handler.NewAdminHandler(systemService, auditService, counterService, diagnosticsService, sloService)
 
 	// 创建Hertz服务器
 	h := server.Default(
 		server.WithHostPorts(cfg.Server.Address),
 		server.WithReadTimeout(30*time.Second),
 		server.WithWriteTimeout(30*time.Second),
+		// 上传文件的multipart请求体略大于文件本身
+		server.WithMaxRequestBodySize(int(cfg.Upload.MaxSize)+1<<20),
 	)
+	// 按IP的限流、访客额度等依赖客户端IP，只信任配置的反向代理转发的地址
+	clientIP, err := middleware.ClientIP(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatal("Invalid SERVER_TRUSTED_PROXIES:", err)
+	}
+	h.SetClientIPFunc(clientIP)
 
 	// 中间件
 	h.Use(middleware.CORS())
 	h.Use(middleware.Logger())
+	// 只读模式下仍允许登录、刷新token和管理员关闭只读模式；MCP的读取工具同样可用，写入工具由MCPService拒绝
+	h.Use(middleware.ReadOnly(systemService, "/api/v1/user/login", "/api/v1/user/refresh", "/api/v1/admin/read-only", "/internal/v1/read-only", "/api/v1/mcp"))
+
+	// 代入用户身份时不允许修改登录凭据、API Key、付款、代替用户表态，以及创建分享链接、Webhook、
+	// IM账号绑定码和第三方授权这类在代入结束后仍对外生效的凭据
+	impersonation := middleware.Impersonation(impersonationService,
+		"/api/v1/user/consent",
+		"/api/v1/user/password",
+		"/api/v1/user/email",
+		"/api/v1/user/api-key",
+		"/api/v1/user/api-key/validate",
+		"/api/v1/user/promo/redeem",
+		"/api/v1/user/impersonations/:id",
+		"/api/v1/user/impersonations/:id/approve",
+		"/api/v1/user/impersonations/:id/deny",
+		"/api/v1/billing/checkout",
+		"/api/v1/billing/credits/checkout",
+		"POST /api/v1/conversations/:id/shares",
+		"POST /api/v1/conversations/:id/webhooks",
+		"/api/v1/integrations/slack/link-code",
+		"/api/v1/integrations/telegram/link-code",
+		"/api/v1/integrations/export/:provider/authorize",
+		"/api/v1/integrations/export/:provider/connect",
+		"/api/v1/integrations/calendar/authorize",
+		"/api/v1/integrations/calendar/connect",
+	)
+	// WebSocket连接只在升级时经过上面的中间件，连接中逐条重新检查代入会话并写入审计日志
+	updateHandler.UseSocketChecks(middleware.SocketImpersonation(impersonationService))
+
+	// 限流：公开接口按IP，认证后按用户；配置Redis时多个实例共享限额
+	var rateLimitRedis *redis.Client
+	if cfg.RateLimit.Redis {
+		rateLimitRedis = rdb
+	}
+	rateLimitStore := middleware.NewRateLimitStore(rateLimitRedis)
+	loginLimit := middleware.RateLimit(rateLimitStore, "login", cfg.RateLimit.Login)
+	apiLimit := middleware.RateLimit(rateLimitStore, "api", cfg.RateLimit.API)
+	chatLimit := middleware.RateLimit(rateLimitStore, "chat", cfg.RateLimit.Chat)
+	// WebSocket连接中的每条消息同样计入聊天限额，并检查只读模式和代入会话
+	chatHandler.UseSocketChecks(
+		middleware.SocketImpersonation(impersonationService),
+		middleware.SocketRateLimit(rateLimitStore, "chat", cfg.RateLimit.Chat),
+		middleware.SocketMutating(systemService),
+	)
 
 	// API路由
 	api := h.Group("/api/v1")
@@ -58,39 +389,291 @@ func main() {
 		// 用户相关路由
 		user := api.Group("/user")
 		{
-			user.POST("/register", userHandler.Register)
-			user.POST("/login", userHandler.Login)
-			user.POST("/forgot-password", userHandler.ForgotPassword)
-			user.POST("/reset-password", userHandler.ResetPassword)
+			user.POST("/register", loginLimit, userHandler.Register)
+			user.POST("/login", loginLimit, userHandler.Login)
+			user.POST("/refresh", userHandler.Refresh)
+			user.POST("/logout", userHandler.Logout)
+			user.POST("/forgot-password", loginLimit, userHandler.ForgotPassword)
+			user.POST("/reset-password", loginLimit, userHandler.ResetPassword)
+			user.POST("/verify-email", loginLimit, userHandler.VerifyEmail)
+			user.POST("/verify-email/resend", loginLimit, userHandler.ResendVerification)
+			user.POST("/email/confirm", loginLimit, userHandler.ConfirmEmailChange)
+			user.GET("/username/available", userHandler.CheckUsername)
+			user.POST("/guest", loginLimit, guestHandler.CreateGuest)
 		}
 
-		// 流式聊天路由（不需要Auth中间件，因为EventSource不支持自定义headers）
-		api.GET("/conversations/:id/stream", chatHandler.StreamChat)
+		// 会话分享链接，凭token公开访问
+		api.GET("/shares/:token", shareHandler.ViewShare)
 
-		// 需要认证的路由
-		auth := api.Group("/", middleware.Auth())
+		// 生成的头像，文件名为随机串，公开访问
+		api.GET("/avatars/:user_id/:name", avatarHandler.Get)
+
+		// Stripe webhook，通过签名校验来源
+		api.POST("/billing/webhook", billingHandler.Webhook)
+
+		// Slack Events API，通过签名校验来源
+		api.POST("/integrations/slack/events", slackHandler.Events)
+
+		// Telegram webhook，通过secret token校验来源
+		api.POST("/integrations/telegram/webhook", telegramHandler.Webhook)
+		// 导出集成的OAuth回调（由state识别用户）
+		api.GET("/integrations/export/:provider/callback", exportHandler.Callback)
+		api.GET("/integrations/calendar/callback", calendarHandler.Callback)
+
+		// 流式聊天路由（EventSource不支持自定义headers，token通过URL参数传递）
+		api.GET("/conversations/:id/stream", middleware.Mutating(systemService), middleware.QueryAuth(), chatLimit, impersonation, middleware.Residency(userService), middleware.Consent(consentService), middleware.GuestQuota(guestService), chatHandler.StreamChat)
+
+		// WebSocket流式聊天，同一连接上发送消息和取消生成；token通过Authorization头或子协议传递，不出现在URL中
+		api.GET("/conversations/:id/ws", middleware.Mutating(systemService), middleware.SocketAuth(), chatLimit, impersonation, middleware.Residency(userService), middleware.Consent(consentService), chatHandler.ChatSocket)
+
+		// 会话列表变更推送（浏览器WebSocket同样不支持自定义headers）
+		api.GET("/ws/updates", middleware.QueryAuth(), impersonation, middleware.Residency(userService), middleware.Consent(consentService), updateHandler.Updates)
+
+		// 后台任务进度推送
+		api.GET("/jobs/:id/events", middleware.QueryAuth(), impersonation, middleware.Residency(userService), middleware.Consent(consentService), jobHandler.StreamJob)
+
+		// 需要认证的路由，数据属于其他区域的用户转到对应区域的部署；访客只能访问资料和会话相关接口
+		auth := api.Group("/", middleware.Auth(), apiLimit, impersonation, middleware.Residency(userService), middleware.GuestAccess(
+			"/api/v1/user/profile",
+			"/api/v1/user/consent",
+			"/api/v1/conversations",
+			"/api/v1/conversations/:id",
+			"/api/v1/conversations/:id/messages",
+			"/api/v1/conversations/:id/stream/cancel",
+		))
 		{
-			// 用户信息
+			// 未接受最新条款时仍可查看资料并接受条款
 			auth.GET("/user/profile", userHandler.GetProfile)
+			auth.POST("/user/consent", userHandler.AcceptConsent)
+
+			// 之后注册的路由要求已接受最新条款
+			auth.Use(middleware.Consent(consentService))
+
+			// 用户信息
 			auth.PUT("/user/profile", userHandler.UpdateProfile)
+			auth.GET("/user/onboarding", onboardingHandler.GetOnboarding)
+			auth.POST("/user/avatar/generate", avatarHandler.Generate)
 			auth.PUT("/user/password", userHandler.ChangePassword)
+			auth.POST("/user/email", userHandler.ChangeEmail)
+			auth.PUT("/user/username", userHandler.SetUsername)
+			auth.GET("/user/plan", planHandler.GetPlan)
+			auth.GET("/user/usage", planHandler.GetUsage)
+			auth.GET("/user/usage/export", planHandler.ExportUsage)
+			auth.POST("/user/promo/redeem", promoHandler.Redeem)
+			auth.GET("/user/credits", creditHandler.GetBalance)
+			auth.GET("/user/credits/transactions", creditHandler.GetTransactions)
+			auth.GET("/user/api-key", apiKeyHandler.GetAPIKey)
+			auth.PUT("/user/api-key", apiKeyHandler.SetAPIKey)
+			auth.DELETE("/user/api-key", apiKeyHandler.DeleteAPIKey)
+			auth.POST("/user/api-key/validate", apiKeyHandler.ValidateAPIKey)
+			auth.GET("/user/impersonations", impersonationHandler.ListMine)
+			auth.POST("/user/impersonations/:id/approve", impersonationHandler.Approve)
+			auth.POST("/user/impersonations/:id/deny", impersonationHandler.Deny)
+			auth.DELETE("/user/impersonations/:id", impersonationHandler.End)
 
 			// 聊天相关
+			auth.GET("/models", chatHandler.GetModels)
 			auth.GET("/conversations", chatHandler.GetConversations)
 			auth.POST("/conversations", chatHandler.CreateConversation)
+			auth.POST("/conversations/merge", chatHandler.MergeConversations)
 			auth.GET("/conversations/:id", chatHandler.GetConversation)
 			auth.PUT("/conversations/:id", chatHandler.UpdateConversation)
 			auth.DELETE("/conversations/:id", chatHandler.DeleteConversation)
+			auth.PUT("/conversations/:id/auto-archive", chatHandler.SetAutoArchive)
+			auth.PUT("/conversations/:id/model-endpoint", chatHandler.SetModelEndpoint)
+			auth.PUT("/conversations/:id/model", chatHandler.SetModel)
+			auth.PUT("/conversations/:id/retrieval", chatHandler.SetRetrieval)
+			auth.PUT("/conversations/:id/tags", chatHandler.SetTags)
 			auth.GET("/conversations/:id/messages", chatHandler.GetMessages)
-			auth.POST("/conversations/:id/messages", chatHandler.SendMessage)
+			auth.POST("/conversations/:id/rehydrate", coldStorageHandler.Rehydrate)
+			auth.GET("/conversations/:id/export", exportHandler.Markdown)
+			auth.POST("/conversations/:id/export/:provider", exportHandler.Push)
+			auth.POST("/conversations/:id/messages", chatLimit, middleware.GuestQuota(guestService), chatHandler.SendMessage)
+			auth.POST("/conversations/:id/stream/cancel", chatHandler.CancelStream)
+			auth.GET("/conversations/:id/messages/:message_id/context", chatHandler.GetMessageContext)
+			auth.DELETE("/conversations/:id/messages/:message_id", chatHandler.DeleteMessage)
+			auth.PUT("/conversations/:id/messages/:message_id/feedback", feedbackHandler.RateMessage)
+			auth.DELETE("/conversations/:id/messages/:message_id/feedback", feedbackHandler.RemoveRating)
+			auth.GET("/conversations/:id/webhooks", webhookHandler.ListWebhooks)
+			auth.POST("/conversations/:id/webhooks", webhookHandler.CreateWebhook)
+			auth.DELETE("/conversations/:id/webhooks/:webhook_id", webhookHandler.DeleteWebhook)
+			auth.POST("/attachments", attachmentHandler.Upload)
+			auth.GET("/attachments/:id", attachmentHandler.GetAttachment)
+			auth.GET("/attachments/:id/download", attachmentHandler.Download)
+			auth.DELETE("/attachments/:id", attachmentHandler.DeleteAttachment)
+			auth.GET("/collections", knowledgeHandler.ListCollections)
+			auth.POST("/collections", knowledgeHandler.CreateCollection)
+			auth.PUT("/collections/:id", knowledgeHandler.UpdateCollection)
+			auth.DELETE("/collections/:id", knowledgeHandler.DeleteCollection)
+			auth.POST("/collections/:id/reindex", knowledgeHandler.ReindexCollection)
+			auth.GET("/collections/:id/search", knowledgeHandler.SearchCollection)
+			auth.GET("/collections/:id/documents", knowledgeHandler.ListDocuments)
+			auth.POST("/collections/:id/documents", knowledgeHandler.AddDocument)
+			auth.GET("/documents/:id", knowledgeHandler.GetDocument)
+			auth.GET("/documents/:id/chunks", knowledgeHandler.GetDocumentChunks)
+			auth.POST("/documents/:id/recrawl", knowledgeHandler.RecrawlDocument)
+			auth.DELETE("/documents/:id", knowledgeHandler.DeleteDocument)
+			auth.GET("/conversations/:id/shares", shareHandler.ListShares)
+			auth.POST("/conversations/:id/shares", shareHandler.CreateShare)
+			auth.DELETE("/conversations/:id/shares/:share_id", shareHandler.RevokeShare)
+			auth.GET("/conversations/:id/tools", toolHandler.ListConversationTools)
+			auth.PUT("/conversations/:id/tools/:server_id", toolHandler.SetConversationTool)
+			auth.GET("/conversations/:id/collections", knowledgeHandler.ListConversationCollections)
+			auth.PUT("/conversations/:id/collections/:collection_id", knowledgeHandler.SetConversationCollection)
+			auth.GET("/workflow-agents", workflowHandler.ListAgents)
+			auth.POST("/conversations/:id/workflow-runs", workflowHandler.RunWorkflow)
+			auth.GET("/conversations/:id/workflow-runs", workflowHandler.ListRuns)
+			auth.GET("/conversations/:id/workflow-runs/:run_id", workflowHandler.GetRun)
+
+			// 保存的工作流，异步执行并通过后台任务查看进度
+			auth.GET("/workflows", workflowHandler.ListWorkflows)
+			auth.POST("/workflows", workflowHandler.CreateWorkflow)
+			auth.GET("/workflows/:id", workflowHandler.GetWorkflow)
+			auth.PUT("/workflows/:id", workflowHandler.UpdateWorkflow)
+			auth.DELETE("/workflows/:id", workflowHandler.DeleteWorkflow)
+			auth.POST("/workflows/:id/run", workflowHandler.RunSavedWorkflow)
+			auth.GET("/jobs/:id", jobHandler.GetJob)
+
+			// 离线客户端增量同步
+			auth.GET("/sync", syncHandler.Sync)
+
+			// MCP服务端，供外部智能体框架访问会话
+			auth.POST("/mcp", mcpHandler.Handle)
+			auth.GET("/mcp", mcpHandler.Stream)
+
+			// 组织及组织模型服务
+			auth.GET("/orgs", orgHandler.ListOrgs)
+			auth.POST("/orgs", orgHandler.CreateOrg)
+			auth.POST("/orgs/:id/members", orgHandler.AddMember)
+			auth.DELETE("/orgs/:id/members/:user_id", orgHandler.RemoveMember)
+			auth.GET("/orgs/:id/model-endpoints", orgHandler.ListEndpoints)
+			auth.POST("/orgs/:id/model-endpoints", orgHandler.CreateEndpoint)
+			auth.DELETE("/orgs/:id/model-endpoints/:endpoint_id", orgHandler.DeleteEndpoint)
+
+			// Slack频道关联
+			auth.GET("/integrations/slack/channels", slackHandler.ListChannels)
+			auth.POST("/integrations/slack/link-code", slackHandler.CreateLinkCode)
+			auth.DELETE("/integrations/slack/channels/:id", slackHandler.UnlinkChannel)
+
+			// Telegram聊天绑定
+			auth.POST("/integrations/telegram/link-code", telegramHandler.CreateLinkCode)
+			auth.GET("/integrations/telegram/chats", telegramHandler.ListChats)
+			auth.DELETE("/integrations/telegram/chats/:id", telegramHandler.UnlinkChat)
+
+			// 导出集成（Notion / Google文档）
+			auth.GET("/integrations/export", exportHandler.ListIntegrations)
+			auth.POST("/integrations/export/:provider/authorize", exportHandler.Authorize)
+			auth.POST("/integrations/export/:provider/connect", exportHandler.Connect)
+			auth.DELETE("/integrations/export/:provider", exportHandler.Disconnect)
+
+			// 日历工具授权（Google日历）
+			auth.GET("/integrations/calendar", calendarHandler.Status)
+			auth.POST("/integrations/calendar/authorize", calendarHandler.Authorize)
+			auth.POST("/integrations/calendar/connect", calendarHandler.Connect)
+			auth.DELETE("/integrations/calendar", calendarHandler.Disconnect)
+			auth.GET("/integrations/calendar/mutations", calendarHandler.ListMutations)
+
+			// 人工客服工单
+			auth.POST("/support/tickets", supportHandler.CreateTicket)
+			auth.GET("/support/tickets", supportHandler.ListTickets)
+			auth.GET("/support/tickets/:id", supportHandler.GetTicket)
+
+			// 用户动态
+			auth.GET("/activity", activityHandler.GetActivities)
+
+			// 计费
+			auth.POST("/billing/checkout", billingHandler.Checkout)
+			auth.POST("/billing/credits/checkout", billingHandler.CreditCheckout)
+			auth.GET("/billing/invoices", billingHandler.GetInvoices)
+		}
+
+		// 管理员路由
+		admin := api.Group("/admin", middleware.Auth(), middleware.Admin(userService))
+		{
+			admin.GET("/read-only", adminHandler.GetReadOnly)
+			admin.PUT("/read-only", adminHandler.SetReadOnly)
+			admin.POST("/counters/reconcile", adminHandler.ReconcileCounters)
+			admin.GET("/email-domains", emailDomainHandler.GetStatus)
+			admin.POST("/email-domains/refresh", emailDomainHandler.Refresh)
+			admin.GET("/support/tickets", supportHandler.AdminListTickets)
+			admin.GET("/support/tickets/:id", supportHandler.AdminGetTicket)
+			admin.PUT("/support/tickets/:id/assign", supportHandler.AssignTicket)
+			admin.PUT("/support/tickets/:id/status", supportHandler.UpdateTicketStatus)
+			admin.PUT("/email-domains/:domain", emailDomainHandler.SetOverride)
+			admin.DELETE("/email-domains/:domain", emailDomainHandler.DeleteOverride)
+			admin.GET("/promo-codes", promoHandler.ListCodes)
+			admin.POST("/promo-codes", promoHandler.CreateCode)
+			admin.POST("/users/:id/credits", creditHandler.AdjustCredits)
+			admin.POST("/users/:id/impersonate", impersonationHandler.Create)
+			admin.GET("/impersonations", impersonationHandler.List)
+			admin.GET("/impersonations/:id", impersonationHandler.Get)
+			admin.POST("/impersonations/:id/token", impersonationHandler.IssueToken)
+			admin.DELETE("/impersonations/:id", impersonationHandler.End)
+			admin.GET("/reports/validation", adminHandler.ValidationReport)
+			admin.GET("/debug/stats", adminHandler.DebugStats)
+			admin.GET("/slo/first-token", adminHandler.FirstTokenSLO)
+			admin.GET("/canaries", canaryHandler.ListRollouts)
+			admin.POST("/canaries", canaryHandler.CreateRollout)
+			admin.GET("/canaries/:id", canaryHandler.GetRollout)
+			admin.PUT("/canaries/:id", canaryHandler.UpdateRollout)
+			admin.POST("/canaries/:id/complete", canaryHandler.CompleteRollout)
+			admin.POST("/canaries/:id/rollback", canaryHandler.RollbackRollout)
+			admin.GET("/mcp-servers", toolHandler.ListServers)
+			admin.POST("/mcp-servers", toolHandler.CreateServer)
+			admin.PUT("/mcp-servers/:id", toolHandler.UpdateServer)
+			admin.DELETE("/mcp-servers/:id", toolHandler.DeleteServer)
+			admin.GET("/tool-invocations", toolHandler.ListInvocations)
+			admin.GET("/prompt-audits", adminHandler.ListPromptAudits)
+			admin.GET("/generations/:id/trace", adminHandler.GetGenerationTrace)
+			admin.GET("/security-incidents", adminHandler.ListSecurityIncidents)
+			admin.GET("/security-incidents/summary", adminHandler.SecurityIncidentSummary)
+			admin.GET("/shares/analytics", shareHandler.Analytics)
+			admin.GET("/prompt-templates", promptHandler.ListTemplates)
+			admin.GET("/prompt-templates/:name/versions", promptHandler.ListVersions)
+			admin.POST("/prompt-templates/:name/versions", promptHandler.CreateVersion)
+			admin.POST("/prompt-templates/:name/rollback", promptHandler.Rollback)
+			admin.GET("/eval-cases", evalHandler.ListCases)
+			admin.POST("/eval-cases", evalHandler.CreateCase)
+			admin.PUT("/eval-cases/:id", evalHandler.UpdateCase)
+			admin.DELETE("/eval-cases/:id", evalHandler.DeleteCase)
+			admin.GET("/eval-runs", evalHandler.ListRuns)
+			admin.POST("/eval-runs", evalHandler.StartRun)
+			admin.GET("/eval-runs/:id", evalHandler.GetRun)
+			admin.GET("/eval-reports", evalHandler.ListReports)
+			admin.POST("/eval-reports", evalHandler.CreateReport)
+			admin.GET("/eval-reports/:id", evalHandler.GetReport)
 		}
 	}
 
 	// 健康检查
 	h.GET("/health", func(ctx context.Context, c *app.RequestContext) {
-		c.JSON(consts.StatusOK, map[string]string{"status": "ok"})
+		status := map[string]string{"status": "ok"}
+		if systemService.IsReadOnly() {
+			status["mode"] = "read_only"
+		}
+		c.JSON(consts.StatusOK, status)
 	})
 
+	// Prometheus指标：服务间调用使用带服务token的内部接口，抓取使用独立的内网监听地址
+	metricsHandler := func(ctx context.Context, c *app.RequestContext) {
+		var buf bytes.Buffer
+		metrics.WritePrometheus(&buf)
+		c.Data(consts.StatusOK, "text/plain; version=0.0.4", buf.Bytes())
+	}
+
+	// 内部接口（服务间调用，使用服务token而非用户JWT，按scope授权）
+	if len(cfg.Internal.Services) > 0 {
+		internal := h.Group("/internal/v1")
+		{
+			internal.GET("/read-only", middleware.ServiceAuth(cfg.Internal, "read-only:read"), adminHandler.GetReadOnly)
+			internal.PUT("/read-only", middleware.ServiceAuth(cfg.Internal, "read-only:write"), adminHandler.SetReadOnly)
+			internal.POST("/counters/reconcile", middleware.ServiceAuth(cfg.Internal, "counters:reconcile"), adminHandler.ReconcileCounters)
+			internal.GET("/reports/validation", middleware.ServiceAuth(cfg.Internal, "reports:read"), adminHandler.ValidationReport)
+			internal.GET("/debug/stats", middleware.ServiceAuth(cfg.Internal, "debug:read"), adminHandler.DebugStats)
+			internal.GET("/metrics", middleware.ServiceAuth(cfg.Internal, "metrics:read"), metricsHandler)
+		}
+	}
+
 	hlog.Info("Server starting on", cfg.Server.Address)
 	h.Spin()
-}
\ No newline at end of file
+}
@@ -0,0 +1,64 @@
+// 非流式聊天场景：登录 -> 创建会话 -> 发送消息 -> 读取消息。
+//   k6 run -e BASE_URL=http://localhost:8080 -e EMAIL=load@example.com -e PASSWORD=password123 test/load/k6/chat.js
+// 阈值不满足时 k6 以非0退出，可直接用于CI。
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+
+const BASE_URL = __ENV.BASE_URL || 'http://localhost:8080';
+
+export const options = {
+  scenarios: {
+    chat: {
+      executor: 'ramping-vus',
+      startVUs: 1,
+      stages: [
+        { duration: '30s', target: 10 },
+        { duration: '1m', target: 10 },
+        { duration: '15s', target: 0 },
+      ],
+    },
+  },
+  thresholds: {
+    http_req_failed: ['rate<0.01'],
+    'http_req_duration{name:list_messages}': ['p(95)<200'],
+    'http_req_duration{name:list_conversations}': ['p(95)<200'],
+    'http_req_duration{name:send_message}': ['p(95)<15000'],
+  },
+};
+
+export function setup() {
+  const res = http.post(`${BASE_URL}/api/v1/user/login`, JSON.stringify({
+    email: __ENV.EMAIL,
+    password: __ENV.PASSWORD,
+  }), { headers: { 'Content-Type': 'application/json' } });
+  check(res, { 'login ok': (r) => r.status === 200 });
+  return { token: res.json('data.token') };
+}
+
+export default function (data) {
+  const params = {
+    headers: {
+      'Content-Type': 'application/json',
+      Authorization: `Bearer ${data.token}`,
+    },
+  };
+
+  let res = http.post(`${BASE_URL}/api/v1/conversations`, JSON.stringify({ title: `load ${__VU}-${__ITER}` }),
+    Object.assign({ tags: { name: 'create_conversation' } }, params));
+  check(res, { 'conversation created': (r) => r.status === 201 });
+  const id = res.json('data.id');
+
+  res = http.post(`${BASE_URL}/api/v1/conversations/${id}/messages`, JSON.stringify({ content: '用一句话介绍你自己' }),
+    Object.assign({ tags: { name: 'send_message' } }, params));
+  check(res, { 'message sent': (r) => r.status === 200 });
+
+  res = http.get(`${BASE_URL}/api/v1/conversations/${id}/messages?page=1&page_size=50`,
+    Object.assign({ tags: { name: 'list_messages' } }, params));
+  check(res, { 'messages listed': (r) => r.status === 200 });
+
+  res = http.get(`${BASE_URL}/api/v1/conversations?page=1&page_size=20`,
+    Object.assign({ tags: { name: 'list_conversations' } }, params));
+  check(res, { 'conversations listed': (r) => r.status === 200 });
+
+  sleep(1);
+}
@@ -0,0 +1,27 @@
+// 流式聊天场景：测量SSE首包时间和完整响应时间。
+//   k6 run -e BASE_URL=http://localhost:8080 -e TOKEN=<jwt> -e CONVERSATION_ID=1 test/load/k6/stream.js
+// k6 的 http 模块会读完整个响应，http_req_waiting 近似首包时间，http_req_duration 为完整生成时间。
+import http from 'k6/http';
+import { check } from 'k6';
+
+const BASE_URL = __ENV.BASE_URL || 'http://localhost:8080';
+
+export const options = {
+  vus: Number(__ENV.VUS || 5),
+  duration: __ENV.DURATION || '1m',
+  thresholds: {
+    http_req_failed: ['rate<0.01'],
+    http_req_waiting: ['p(95)<2000'],
+    http_req_duration: ['p(95)<30000'],
+  },
+};
+
+export default function () {
+  const url = `${BASE_URL}/api/v1/conversations/${__ENV.CONVERSATION_ID}/stream`
+    + `?token=${encodeURIComponent(__ENV.TOKEN)}&content=${encodeURIComponent('简单介绍一下Go语言')}`;
+  const res = http.get(url, { timeout: '60s' });
+  check(res, {
+    'stream ok': (r) => r.status === 200,
+    'stream ended': (r) => r.body.includes('"type": "end"'),
+  });
+}
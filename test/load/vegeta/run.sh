@@ -0,0 +1,19 @@
+#!/usr/bin/env sh
+# 对只读接口施加固定速率压力，p95 超过 MAX_P95_MS 时以非0退出。
+#   TOKEN=<jwt> CONVERSATION_ID=1 ./test/load/vegeta/run.sh
+set -eu
+
+RATE=${RATE:-200}
+DURATION=${DURATION:-30s}
+MAX_P95_MS=${MAX_P95_MS:-100}
+DIR=$(dirname "$0")
+
+envsubst < "$DIR/targets.txt" \
+  | vegeta attack -rate="$RATE" -duration="$DURATION" \
+  | tee /tmp/vegeta-results.bin \
+  | vegeta report
+
+P95_NS=$(vegeta report -type=json < /tmp/vegeta-results.bin | sed -n 's/.*"95th":\([0-9]*\).*/\1/p')
+P95_MS=$((P95_NS / 1000000))
+echo "p95: ${P95_MS}ms (max ${MAX_P95_MS}ms)"
+[ "$P95_MS" -le "$MAX_P95_MS" ]